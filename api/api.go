@@ -0,0 +1,7 @@
+// Package api holds the protobuf schema the services share for their gRPC
+// transports, in swg/<service>/v<N>/*.proto, and the Go packages generated
+// from it next to each file. Regenerate them after editing a .proto with
+// go generate, which needs buf, protoc-gen-go and protoc-gen-go-grpc.
+package api
+
+//go:generate buf generate
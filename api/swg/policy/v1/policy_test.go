@@ -0,0 +1,87 @@
+package policyv1_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	policyv1 "github.com/nisatyap/api/swg/policy/v1"
+)
+
+// The policy engine's GET /policy
+const policyJSON = `{"blocked":["malware.example"],"exact":["ads.example.org"],"wildcards":["*.tracker.example"],
+	"regexes":["^x[0-9]+\\.example$"],"categories":{"intranet":{"action":"trusted","domains":["wiki.corp.example"]}},
+	"version":43,"generated_at":"2024-05-01T10:00:00Z"}`
+
+func TestPolicyResponseReadsPolicyJSON(t *testing.T) {
+	var policy policyv1.PolicyResponse
+	if err := protojson.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		t.Fatal(err)
+	}
+	intranet := policy.GetCategories()["intranet"]
+	if policy.GetVersion() != 43 || intranet.GetAction() != "trusted" || intranet.GetDomains()[0] != "wiki.corp.example" {
+		t.Errorf("policy = %v", &policy)
+	}
+	if policy.GetRegexes()[0] != `^x[0-9]+\.example$` || policy.GetGeneratedAt().AsTime().Year() != 2024 {
+		t.Errorf("policy = %v", &policy)
+	}
+}
+
+// policyServer serves one policy and announces its version
+type policyServer struct {
+	policyv1.UnimplementedPolicyServiceServer
+	policy *policyv1.PolicyResponse
+}
+
+func (s *policyServer) GetPolicy(ctx context.Context, req *policyv1.GetPolicyRequest) (*policyv1.PolicyResponse, error) {
+	return s.policy, nil
+}
+
+func (s *policyServer) WatchPolicy(req *policyv1.WatchPolicyRequest, stream grpc.ServerStreamingServer[policyv1.PolicyVersion]) error {
+	return stream.Send(&policyv1.PolicyVersion{Version: s.policy.GetVersion()})
+}
+
+func TestPolicyServiceStubs(t *testing.T) {
+	var policy policyv1.PolicyResponse
+	if err := protojson.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		t.Fatal(err)
+	}
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	policyv1.RegisterPolicyServiceServer(server, &policyServer{policy: &policy})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///policy-engine",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := policyv1.NewPolicyServiceClient(conn)
+
+	ctx := context.Background()
+	got, err := client.GetPolicy(ctx, &policyv1.GetPolicyRequest{Group: "students"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, &policy) {
+		t.Errorf("GetPolicy = %v, want %v", got, &policy)
+	}
+
+	stream, err := client.WatchPolicy(ctx, &policyv1.WatchPolicyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := stream.Recv()
+	if err != nil || version.GetVersion() != 43 {
+		t.Errorf("WatchPolicy = %v, %v", version, err)
+	}
+}
@@ -0,0 +1,67 @@
+package posturev1_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	posturev1 "github.com/nisatyap/api/swg/posture/v1"
+)
+
+// A report as the agent posts it to the collector's /report
+const reportJSON = `{"schema_version":2,"hostname":"laptop-1","ip":"10.0.0.5","disk_usage":95.5,
+	"cpu_usage":12,"memory_usage":40,"os":{"name":"linux","arch":"amd64"},"firewall_enabled":false,
+	"status":"UNHEALTHY","score":50,"severity":"high","failing_checks":["disk_usage"],
+	"timestamp":"2024-05-01T10:00:00Z","checks":[{"name":"disk_usage","passed":false,"severity":"critical"}],
+	"tamper_events":[{"kind":"config_modified","path":"/etc/agent.json","severity":"critical","timestamp":"2024-05-01T09:59:00Z"}],
+	"logs":[{"time":"2024-05-01T09:58:00Z","level":"WARN","message":"disk almost full","attrs":{"mount":"/"}}],
+	"idempotency_key":"laptop-1-42"}`
+
+func TestDeviceStatusReadsReportJSON(t *testing.T) {
+	var status posturev1.DeviceStatus
+	if err := protojson.Unmarshal([]byte(reportJSON), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.GetHostname() != "laptop-1" || status.GetScore() != 50 || status.GetOs().GetArch() != "amd64" {
+		t.Errorf("status = %v", &status)
+	}
+	if status.FirewallEnabled == nil || status.GetFirewallEnabled() {
+		t.Errorf("firewall_enabled = %v, want set and false", status.FirewallEnabled)
+	}
+	if got := status.GetTimestamp().AsTime(); !got.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("timestamp = %v", got)
+	}
+	if len(status.GetTamperEvents()) != 1 || status.GetTamperEvents()[0].GetKind() != "config_modified" {
+		t.Errorf("tamper_events = %v", status.GetTamperEvents())
+	}
+	if status.GetLogs()[0].GetAttrs()["mount"] != "/" {
+		t.Errorf("logs = %v", status.GetLogs())
+	}
+
+	// Written back with the proto names, it is the collector's JSON again
+	out, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"idempotency_key"`, `"failing_checks"`, `"firewall_enabled":false`, `"tamper_events"`} {
+		if !strings.Contains(strings.ReplaceAll(string(out), " ", ""), field) {
+			t.Errorf("%s missing from %s", field, out)
+		}
+	}
+}
+
+func TestPostureVerdictReadsPostureJSON(t *testing.T) {
+	// GET /posture
+	const verdictJSON = `{"device_id":"laptop-1","tenant":"acme","ip":"10.0.0.5","compliant":false,
+		"status":"STALE","source":"agent","score":97,"reason":"no report for 12m0s",
+		"last_seen":"2024-05-01T10:00:00Z","checked_at":"2024-05-01T10:12:00Z"}`
+	var verdict posturev1.PostureVerdict
+	if err := protojson.Unmarshal([]byte(verdictJSON), &verdict); err != nil {
+		t.Fatal(err)
+	}
+	if verdict.GetCompliant() || verdict.GetStatus() != "STALE" || verdict.GetCheckedAt().AsTime().Sub(verdict.GetLastSeen().AsTime()) != 12*time.Minute {
+		t.Errorf("verdict = %v", &verdict)
+	}
+}
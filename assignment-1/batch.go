@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// row is the results of every operation for one input
+type row struct {
+	Input   string            `json:"input"`
+	N       *int              `json:"n,omitempty"`
+	Results map[string]any    `json:"results,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+	// Error is why the input isn't a number
+	Error string `json:"error,omitempty"`
+}
+
+// runBatch runs every operation on every input, writing a table or JSON
+// to w and the errors to errw, and returns the exit code: 1 if any input
+// wasn't a whole number or any operation failed
+func runBatch(inputs []string, asJSON bool, w, errw io.Writer) int {
+	rows := make([]row, len(inputs))
+	failed := false
+	for i, input := range inputs {
+		rows[i] = compute(input)
+		failed = failed || rows[i].Error != "" || len(rows[i].Errors) > 0
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(rows)
+	} else {
+		writeTable(w, errw, rows)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// compute runs every operation on input
+func compute(input string) row {
+	r := row{Input: input}
+	n, err := strconv.Atoi(input)
+	if err != nil {
+		r.Error = fmt.Sprintf("%q is not a whole number", input)
+		return r
+	}
+	r.N = &n
+	r.Results = make(map[string]any)
+	for _, op := range operations {
+		if v, err := op.apply(n); err != nil {
+			if r.Errors == nil {
+				r.Errors = make(map[string]string)
+			}
+			r.Errors[op.name] = err.Error()
+		} else {
+			r.Results[op.name] = v
+		}
+	}
+	return r
+}
+
+// writeTable writes a row per input and a column per operation, with
+// "error" in the cells that failed and the errors themselves on errw
+func writeTable(w, errw io.Writer, rows []row) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "n")
+	for _, op := range operations {
+		fmt.Fprintf(tw, "\t%s", op.name)
+	}
+	fmt.Fprintln(tw)
+	for _, r := range rows {
+		fmt.Fprint(tw, r.Input)
+		for _, op := range operations {
+			switch v, ok := r.Results[op.name]; {
+			case ok:
+				fmt.Fprintf(tw, "\t%v", v)
+			case r.Error != "":
+				fmt.Fprint(tw, "\t-")
+			default:
+				fmt.Fprint(tw, "\terror")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	for _, r := range rows {
+		if r.Error != "" {
+			fmt.Fprintf(errw, "Error: %s\n", r.Error)
+		}
+		for _, op := range operations {
+			if err, ok := r.Errors[op.name]; ok {
+				fmt.Fprintf(errw, "Error: %s\n", err)
+			}
+		}
+	}
+}
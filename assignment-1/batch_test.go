@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBatchTable(t *testing.T) {
+	var out, errOut bytes.Buffer
+	code := runBatch([]string{"5", "21", "x"}, false, &out, &errOut)
+	want := `n   factorial  fibonacci  prime
+5   120        5          true
+21  error      10946      false
+x   -          -          -
+`
+	if code != 1 || out.String() != want {
+		t.Errorf("runBatch = %d, table\n%s\nwant\n%s", code, out.String(), want)
+	}
+	if got := errOut.String(); !strings.Contains(got, "Factorial(21)") || !strings.Contains(got, `"x" is not a whole number`) {
+		t.Errorf("errors = %q", got)
+	}
+
+	out.Reset()
+	if code := runBatch([]string{"1", "2"}, false, &out, &errOut); code != 0 {
+		t.Errorf("runBatch(1, 2) = %d, %s", code, out.String())
+	}
+}
+
+func TestBatchJSON(t *testing.T) {
+	var out bytes.Buffer
+	code := runBatch([]string{"100", "-1"}, true, &out, &out)
+	var rows []struct {
+		Input   string
+		N       *int
+		Results map[string]json.RawMessage
+		Errors  map[string]string
+	}
+	if err := json.Unmarshal(out.Bytes(), &rows); err != nil || code != 1 || len(rows) != 2 {
+		t.Fatalf("runBatch = %d, %s: %v", code, out.String(), err)
+	}
+	// A big.Int is still a JSON number
+	if got := string(rows[0].Results["fibonacci"]); got != "354224848179261915075" {
+		t.Errorf("fibonacci(100) = %s", got)
+	}
+	if got := string(rows[0].Results["prime"]); got != "false" {
+		t.Errorf("prime(100) = %s", got)
+	}
+	if _, ok := rows[0].Errors["factorial"]; !ok {
+		t.Errorf("factorial(100) should have failed: %+v", rows[0])
+	}
+	if rows[1].N == nil || *rows[1].N != -1 || len(rows[1].Errors) != 2 {
+		t.Errorf("row for -1 = %+v", rows[1])
+	}
+
+	// Too big to compute, even as a big.Int
+	out.Reset()
+	if code := runBatch([]string{"1000000000"}, true, &out, &out); code != 1 || !strings.Contains(out.String(), "n must be at most") {
+		t.Errorf("runBatch(1000000000) = %d, %s", code, out.String())
+	}
+}
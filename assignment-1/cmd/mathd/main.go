@@ -0,0 +1,73 @@
+// Command mathd serves the mathops functions over HTTP; see package
+// mathservice for the endpoints.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nisatyap/golearn/diskcache"
+	"github.com/nisatyap/golearn/mathservice"
+	"github.com/nisatyap/shared/middleware"
+)
+
+func main() {
+	listen := flag.String("listen", ":8090", "Address to listen on")
+	maxN := flag.Int("max-n", mathservice.DefaultMaxN, "Largest n for /factorial and /fibonacci")
+	maxLimit := flag.Int("max-limit", mathservice.DefaultMaxLimit, "Largest limit for /primes")
+	maxInFlight := flag.Int("max-in-flight", 0, "Requests computing at once before the rest get 503 (default twice the CPUs)")
+	cacheSize := flag.Int("cache-size", mathservice.DefaultCacheSize, "Factorials and Fibonacci numbers to keep for repeated requests")
+	cacheDir := flag.String("cache-dir", "", "Directory to keep results in across restarts (default none)")
+	cacheMaxBytes := flag.Int64("cache-max-bytes", diskcache.DefaultMaxBytes, "Size -cache-dir is kept to, removing the least recently used results past it")
+	cacheMinCost := flag.Duration("cache-min-cost", mathservice.DefaultDiskMinCost, "How long a result must take to compute to be kept in -cache-dir")
+	flag.Parse()
+
+	var disk *diskcache.Cache
+	if *cacheDir != "" {
+		var err error
+		if disk, err = diskcache.Open(*cacheDir, diskcache.Options{MaxBytes: *cacheMaxBytes}); err != nil {
+			log.Fatalf("[MATHD] %v", err)
+		}
+		log.Printf("[MATHD] Caching results that take %v or more in %s, up to %d bytes", *cacheMinCost, *cacheDir, *cacheMaxBytes)
+	}
+
+	mux := http.NewServeMux()
+	httpMetrics := middleware.NewMetrics()
+	mathservice.New(mathservice.Options{
+		MaxN: *maxN, MaxLimit: *maxLimit, MaxInFlight: *maxInFlight, CacheSize: *cacheSize, Disk: disk,
+		DiskMinCost: *cacheMinCost, HTTPMetrics: httpMetrics,
+	}).Register(mux)
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           middleware.Chain(mux, middleware.RequestID, middleware.Log(nil), middleware.Recover(nil), httpMetrics.Middleware),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		MaxHeaderBytes:    16 << 10,
+	}
+
+	go func() {
+		log.Printf("[MATHD] Listening on %s", *listen)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("[MATHD] Server failed: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Printf("[MATHD] Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("[MATHD] Shutdown error: %v", err)
+	}
+}
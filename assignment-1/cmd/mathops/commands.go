@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nisatyap/golearn/diskcache"
+	"github.com/nisatyap/golearn/mathops"
+	"github.com/nisatyap/golearn/stats"
+)
+
+// result is the value of a function of one whole number, or why there is
+// none
+type result struct {
+	N      int      `json:"n"`
+	Result *big.Int `json:"result,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func (c *cli) factorial(inputs []string) int {
+	return c.each("factorial", "Factorial", inputs, mathops.FactorialChecked, cached(c, "factorial", diskcache.BigInt, mathops.ParallelFactorialBig))
+}
+
+func (c *cli) fibonacci(inputs []string) int {
+	return c.each("fib", "Fibonacci", inputs, mathops.FibonacciChecked, cached(c, "fibonacci", diskcache.BigInt, mathops.FibonacciBig))
+}
+
+// each applies the function called fn to every input, with checked, or
+// with exact for -big, printing a result or an error for each
+func (c *cli) each(name, fn string, inputs []string, checked func(int) (int, error), exact func(int) *big.Int) int {
+	ns, err := parseInts(inputs)
+	if err != nil {
+		return c.usageError(name, err)
+	}
+	results := make([]result, len(ns))
+	failed := false
+	for i, n := range ns {
+		results[i].N = n
+		switch {
+		case n < 0:
+			err = fmt.Errorf("%s(%d): %w", fn, n, mathops.ErrNegative)
+		case c.big:
+			results[i].Result = exact(n)
+		default:
+			var v int
+			if v, err = checked(n); err == nil {
+				results[i].Result = newInt(v)
+			} else if errors.Is(err, mathops.ErrOverflow) {
+				err = fmt.Errorf("%w; use -big", err)
+			}
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			failed = true
+		}
+	}
+
+	if c.json {
+		c.printJSON(results)
+	} else {
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Fprintf(c.stderr, "mathops %s: %s\n", name, r.Error)
+			} else {
+				fmt.Fprintf(c.stdout, "%s(%d) = %s\n", fn, r.N, r.Result)
+			}
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func (c *cli) primes(inputs []string) int {
+	if len(inputs) != 1 {
+		return c.usageError("primes", fmt.Errorf("want one limit, got %d numbers", len(inputs)))
+	}
+	limits, err := parseInts(inputs)
+	if err != nil {
+		return c.usageError("primes", err)
+	}
+	limit := limits[0]
+	primes := cached(c, "primes", diskcache.Ints, mathops.Sieve)(limit)
+	if c.json {
+		c.printJSON(struct {
+			Limit  int   `json:"limit"`
+			Count  int   `json:"count"`
+			Primes []int `json:"primes"`
+		}{limit, len(primes), append([]int{}, primes...)})
+		return 0
+	}
+	for _, p := range primes {
+		fmt.Fprintln(c.stdout, p)
+	}
+	return 0
+}
+
+func (c *cli) gcd(inputs []string) int {
+	if len(inputs) == 0 {
+		return c.usageError("gcd", errors.New("no numbers"))
+	}
+	ns := make([]*big.Int, len(inputs))
+	for i, s := range inputs {
+		n, ok := new(big.Int).SetString(s, 10)
+		switch {
+		case !ok:
+			return c.usageError("gcd", fmt.Errorf("%q is not a whole number", s))
+		case !c.big && (!n.IsInt64() || n.Int64() < math.MinInt || n.Int64() > math.MaxInt):
+			return c.usageError("gcd", fmt.Errorf("%s is too large; use -big", s))
+		}
+		ns[i] = n
+	}
+
+	// The GCD of math.MinInt and 0 is 2^63, too large for mathops.GCD,
+	// so inputs of math.MinInt take the big.Int path
+	hasMinInt := slices.ContainsFunc(ns, func(n *big.Int) bool { return n.Int64() == math.MinInt })
+	g := new(big.Int)
+	if c.big || hasMinInt {
+		for _, n := range ns {
+			g.GCD(nil, nil, g, n)
+		}
+	} else {
+		acc := 0
+		for _, n := range ns {
+			acc = mathops.GCD(acc, int(n.Int64()))
+		}
+		g.SetInt64(int64(acc))
+	}
+
+	if c.json {
+		c.printJSON(struct {
+			Numbers []*big.Int `json:"numbers"`
+			GCD     *big.Int   `json:"gcd"`
+		}{ns, g})
+		return 0
+	}
+	fmt.Fprintf(c.stdout, "GCD(%s) = %s\n", strings.Join(inputs, ", "), g)
+	return 0
+}
+
+// summary is the stats of a sample
+type summary struct {
+	Count    int       `json:"count"`
+	Mean     float64   `json:"mean"`
+	Median   float64   `json:"median"`
+	Mode     []float64 `json:"mode"`
+	Variance float64   `json:"variance"`
+	StdDev   float64   `json:"stddev"`
+	Min      float64   `json:"min"`
+	Max      float64   `json:"max"`
+}
+
+func (c *cli) stats(inputs []string) int {
+	if len(inputs) == 0 {
+		return c.usageError("stats", errors.New("no numbers"))
+	}
+	xs := make([]float64, len(inputs))
+	for i, s := range inputs {
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+			return c.usageError("stats", fmt.Errorf("%q is not a finite number", s))
+		}
+		xs[i] = x
+	}
+	// None of these fail on a sample that isn't empty
+	s := summary{Count: len(xs), Min: slices.Min(xs), Max: slices.Max(xs)}
+	s.Mean, _ = stats.Mean(xs)
+	s.Median, _ = stats.Median(xs)
+	s.Mode, _ = stats.Mode(xs)
+	s.Variance, _ = stats.Variance(xs)
+	s.StdDev, _ = stats.StdDev(xs)
+
+	if c.json {
+		c.printJSON(s)
+		return 0
+	}
+	modes := make([]string, len(s.Mode))
+	for i, m := range s.Mode {
+		modes[i] = formatFloat(m)
+	}
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "count\t%d\n", s.Count)
+	fmt.Fprintf(tw, "mean\t%s\n", formatFloat(s.Mean))
+	fmt.Fprintf(tw, "median\t%s\n", formatFloat(s.Median))
+	fmt.Fprintf(tw, "mode\t%s\n", strings.Join(modes, " "))
+	fmt.Fprintf(tw, "variance\t%s\n", formatFloat(s.Variance))
+	fmt.Fprintf(tw, "stddev\t%s\n", formatFloat(s.StdDev))
+	fmt.Fprintf(tw, "min\t%s\n", formatFloat(s.Min))
+	fmt.Fprintf(tw, "max\t%s\n", formatFloat(s.Max))
+	tw.Flush()
+	return 0
+}
+
+// parseInts parses whole numbers that fit in an int
+func parseInts(inputs []string) ([]int, error) {
+	ns := make([]int, len(inputs))
+	for i, s := range inputs {
+		n, err := strconv.Atoi(s)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("%s is too large", s)
+		} else if err != nil {
+			return nil, fmt.Errorf("%q is not a whole number", s)
+		}
+		ns[i] = n
+	}
+	return ns, nil
+}
+
+func newInt(n int) *big.Int {
+	return big.NewInt(int64(n))
+}
+
+// formatFloat formats x as briefly as it can be read back exactly
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// evaluation is the value of an expression, or why there is none
+type evaluation struct {
+	Expr   string `json:"expr"`
+	Result *int   `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (c *cli) eval(exprs []string) int {
+	if len(exprs) == 0 {
+		return c.usageError("eval", errors.New("no expression"))
+	}
+	evals := make([]evaluation, len(exprs))
+	failed := false
+	for i, expr := range exprs {
+		evals[i].Expr = expr
+		if v, err := mathops.Eval(expr); err != nil {
+			evals[i].Error = err.Error()
+			failed = true
+		} else {
+			evals[i].Result = &v
+		}
+	}
+
+	if c.json {
+		c.printJSON(evals)
+	} else {
+		for _, e := range evals {
+			if e.Error != "" {
+				fmt.Fprintf(c.stderr, "mathops eval: %s: %s\n", e.Expr, e.Error)
+			} else {
+				fmt.Fprintf(c.stdout, "%s = %d\n", e.Expr, *e.Result)
+			}
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
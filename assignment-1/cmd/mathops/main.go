@@ -0,0 +1,200 @@
+// Command mathops runs the functions of the mathops and stats packages
+// from the command line, on numbers given as arguments or read from stdin:
+//
+//	mathops factorial 5 10 20
+//	mathops fib -big 100
+//	seq 1 10 | mathops stats -json
+//	mathops eval 'fact(10) / fib(12) % 7'
+//
+// It is the scriptable counterpart of the interactive program in the
+// module root. If MATHOPS_CACHE_DIR names a directory, exact factorials,
+// Fibonacci numbers and primes are kept there, so that a later run
+// doesn't compute them again.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nisatyap/golearn/diskcache"
+)
+
+// command is a mathops subcommand
+type command struct {
+	name    string
+	summary string
+	usage   string
+	// big registers the -big flag, for commands with results past an int
+	big bool
+	// expr makes the arguments a single expression, and stdin one a line
+	expr bool
+	run  func(c *cli, inputs []string) int
+}
+
+var commands = []*command{
+	{name: "factorial", summary: "Factorials of whole numbers", usage: "[-big] [-json] [n ...]", big: true, run: (*cli).factorial},
+	{name: "fib", summary: "Fibonacci numbers", usage: "[-big] [-json] [n ...]", big: true, run: (*cli).fibonacci},
+	{name: "primes", summary: "The primes up to a limit", usage: "[-json] [limit]", run: (*cli).primes},
+	{name: "gcd", summary: "Greatest common divisor of whole numbers", usage: "[-big] [-json] [n ...]", big: true, run: (*cli).gcd},
+	{name: "stats", summary: "Mean, median, mode and spread of a sample", usage: "[-json] [x ...]", run: (*cli).stats},
+	{name: "eval", summary: "Values of integer expressions such as fact(5) + 1", usage: "[-json] [expression]", expr: true, run: (*cli).eval},
+}
+
+// cli holds a run's streams and flags
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	big, json      bool
+	// disk keeps results across runs, if not nil
+	disk *diskcache.Cache
+}
+
+func main() {
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	if dir := os.Getenv("MATHOPS_CACHE_DIR"); dir != "" {
+		var err error
+		if c.disk, err = diskcache.Open(dir, diskcache.Options{}); err != nil {
+			fmt.Fprintf(c.stderr, "mathops: %v; computing without it\n", err)
+		}
+	}
+	os.Exit(c.run(os.Args[1:]))
+}
+
+// cached returns f keeping its results in c's disk cache, if it has one,
+// under the name of the function
+func cached[V any](c *cli, name string, codec diskcache.Codec[V], f func(int) V) func(int) V {
+	if c.disk == nil {
+		return f
+	}
+	return diskcache.Func(c.disk, name, codec, 0, f)
+}
+
+// run runs the subcommand named by args[0] and returns the exit code: 0
+// on success, 1 if any computation failed and 2 for bad usage or input
+func (c *cli) run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		c.printUsage()
+		return 0
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		fs := flag.NewFlagSet("mathops "+cmd.name, flag.ContinueOnError)
+		fs.SetOutput(c.stderr)
+		fs.BoolVar(&c.json, "json", false, "Print the results as JSON")
+		if cmd.big {
+			fs.BoolVar(&c.big, "big", false, "Compute with big integers, which don't overflow")
+		}
+		fs.Usage = func() {
+			of := "the arguments or else of the numbers on stdin"
+			if cmd.expr {
+				of = "the arguments, taken together, or else of each line of stdin"
+			}
+			fmt.Fprintf(fs.Output(), "Usage: mathops %s %s\n\n%s, of %s.\n\nFlags:\n", cmd.name, cmd.usage, cmd.summary, of)
+			fs.PrintDefaults()
+		}
+		inputs, err := parseArgs(fs, args[1:])
+		if err != nil {
+			if err == flag.ErrHelp {
+				return 0
+			}
+			return 2
+		}
+		switch {
+		case cmd.expr && len(inputs) > 0:
+			inputs = []string{strings.Join(inputs, " ")}
+		case len(inputs) == 0:
+			read := readWords
+			if cmd.expr {
+				read = readLines
+			}
+			var err error
+			if inputs, err = read(c.stdin); err != nil {
+				fmt.Fprintf(c.stderr, "mathops %s: reading stdin: %v\n", cmd.name, err)
+				return 1
+			}
+		}
+		return cmd.run(c, inputs)
+	}
+	fmt.Fprintf(c.stderr, "mathops: unknown command %q\n\n", args[0])
+	c.printUsage()
+	return 2
+}
+
+// printUsage lists the subcommands
+func (c *cli) printUsage() {
+	fmt.Fprintf(c.stderr, "Usage: mathops <command> [flags] [numbers]\n\nNumbers come from the arguments, or else from stdin.\n\nCommands:\n")
+	tw := tabwriter.NewWriter(c.stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(c.stderr, "\nRun 'mathops <command> -h' for command flags.\n")
+}
+
+// parseArgs parses the flags in args, which may come before, after or
+// among the numbers, and returns the numbers. Negative numbers are not
+// flags, and everything after "--" is a number.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var numbers []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(numbers, args[i+1:]...), nil
+		}
+		if _, err := strconv.ParseFloat(arg, 64); err == nil || !strings.HasPrefix(arg, "-") {
+			numbers = append(numbers, arg)
+			continue
+		}
+		// The flags are all booleans, so each is a single argument
+		if err := fs.Parse([]string{arg}); err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, fs.Args()...) // "-", which isn't a flag
+	}
+	return numbers, nil
+}
+
+// readWords returns the whitespace-separated words of r
+func readWords(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	sc.Split(bufio.ScanWords)
+	var words []string
+	for sc.Scan() {
+		words = append(words, sc.Text())
+	}
+	return words, sc.Err()
+}
+
+// readLines returns the lines of r that aren't blank, trimmed
+func readLines(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	var lines []string
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// printJSON writes v to stdout as indented JSON
+func (c *cli) printJSON(v any) {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// usageError reports bad input to the command called name and returns
+// the exit code for it
+func (c *cli) usageError(name string, err error) int {
+	fmt.Fprintf(c.stderr, "mathops %s: %v\n", name, err)
+	return 2
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nisatyap/golearn/diskcache"
+)
+
+// runCLI runs mathops with args and stdin, returning its exit code and
+// output
+func runCLI(stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &out, stderr: &errOut}
+	code = c.run(args)
+	return code, out.String(), errOut.String()
+}
+
+func TestCommands(t *testing.T) {
+	for _, c := range []struct {
+		stdin string
+		args  []string
+		code  int
+		want  string
+	}{
+		{"", []string{"factorial", "0", "5"}, 0, "Factorial(0) = 1\nFactorial(5) = 120\n"},
+		{"", []string{"factorial", "25", "-big"}, 0, "Factorial(25) = 15511210043330985984000000\n"},
+		{"10\n20\n", []string{"fib"}, 0, "Fibonacci(10) = 55\nFibonacci(20) = 6765\n"},
+		{"", []string{"fib", "-big", "100"}, 0, "Fibonacci(100) = 354224848179261915075\n"},
+		{"", []string{"fib", "10", "93"}, 1, "Fibonacci(10) = 55\n"},
+		{"", []string{"primes", "20"}, 0, "2\n3\n5\n7\n11\n13\n17\n19\n"},
+		{"", []string{"primes", "1"}, 0, ""},
+		{"", []string{"gcd", "-12", "18", "24"}, 0, "GCD(-12, 18, 24) = 6\n"},
+		{"", []string{"gcd", "-9223372036854775808", "0"}, 0, "GCD(-9223372036854775808, 0) = 9223372036854775808\n"},
+		{"", []string{"gcd", "-big", "100000000000000000000", "150000000000000000000"}, 0, "GCD(100000000000000000000, 150000000000000000000) = 50000000000000000000\n"},
+		{"1 2 3 4", []string{"stats"}, 0, "count     4\nmean      2.5\nmedian    2.5\nmode      1 2 3 4\nvariance  1.25\nstddev    1.118033988749895\nmin       1\nmax       4\n"},
+		{"", []string{"eval", "fact(5)", "+", "gcd(12, 18)"}, 0, "fact(5) + gcd(12, 18) = 126\n"},
+		{"1 + 2\n\n  -7 / 2  \n", []string{"eval"}, 0, "1 + 2 = 3\n-7 / 2 = -3\n"},
+		{"", []string{"help"}, 0, ""},
+		{"", []string{"fib", "-h"}, 0, ""},
+	} {
+		code, stdout, stderr := runCLI(c.stdin, c.args...)
+		if code != c.code || stdout != c.want {
+			t.Errorf("mathops %s = %d, %q; want %d, %q (stderr %q)", strings.Join(c.args, " "), code, stdout, c.code, c.want, stderr)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"fib", "93"}, 1, "Fibonacci(93): result is too large (the largest n is 92); use -big"},
+		{[]string{"factorial", "-big", "-3"}, 1, "Factorial(-3): input must not be negative"},
+		{[]string{"fib", "x"}, 2, `"x" is not a whole number`},
+		{[]string{"fib", "99999999999999999999"}, 2, "99999999999999999999 is too large"},
+		{[]string{"gcd", "99999999999999999999", "3"}, 2, "use -big"},
+		{[]string{"primes", "10", "20"}, 2, "want one limit, got 2 numbers"},
+		{[]string{"primes", "-big", "10"}, 2, "flag provided but not defined: -big"},
+		{[]string{"stats", "1", "NaN"}, 2, `"NaN" is not a finite number`},
+		{[]string{"eval", "2 *"}, 1, "mathops eval: 2 *: expected a number, found end of expression at column 4"},
+		{[]string{"eval", "fib(100)"}, 1, "Fibonacci(100): result is too large"},
+		{[]string{"cube", "3"}, 2, `unknown command "cube"`},
+	} {
+		code, _, stderr := runCLI("", c.args...)
+		if code != c.code || !strings.Contains(stderr, c.want) {
+			t.Errorf("mathops %s = %d, %q; want %d, %q", strings.Join(c.args, " "), code, stderr, c.code, c.want)
+		}
+	}
+	if code, _, stderr := runCLI("", "stats"); code != 2 || !strings.Contains(stderr, "no numbers") {
+		t.Errorf("stats with empty stdin = %d, %q", code, stderr)
+	}
+	if code, _, stderr := runCLI("\n", "eval"); code != 2 || !strings.Contains(stderr, "no expression") {
+		t.Errorf("eval with empty stdin = %d, %q", code, stderr)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	code, stdout, _ := runCLI("", "fib", "-json", "10", "-1")
+	var results []struct {
+		N      int
+		Result json.Number
+		Error  string
+	}
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil || code != 1 {
+		t.Fatalf("fib -json = %d, %q: %v", code, stdout, err)
+	}
+	if len(results) != 2 || results[0].Result != "55" || results[1].Error == "" {
+		t.Errorf("fib -json results = %+v", results)
+	}
+
+	_, stdout, _ = runCLI("", "primes", "-json", "1")
+	if want := `{"limit":1,"count":0,"primes":[]}`; compact(t, stdout) != want {
+		t.Errorf("primes -json 1 = %s, want %s", stdout, want)
+	}
+	_, stdout, _ = runCLI("2 4 4 4 5 5 7 9", "stats", "-json")
+	if want := `{"count":8,"mean":5,"median":4.5,"mode":[4],"variance":4,"stddev":2,"min":2,"max":9}`; compact(t, stdout) != want {
+		t.Errorf("stats -json = %s, want %s", stdout, want)
+	}
+	_, stdout, _ = runCLI("", "gcd", "-json", "-big", "12", "30")
+	if want := `{"numbers":[12,30],"gcd":6}`; compact(t, stdout) != want {
+		t.Errorf("gcd -json = %s, want %s", stdout, want)
+	}
+	_, stdout, _ = runCLI("0 * 5\n1 / 0\n", "eval", "-json")
+	if want := `[{"expr":"0 * 5","result":0},{"expr":"1 / 0","error":"division by zero at column 3"}]`; compact(t, stdout) != want {
+		t.Errorf("eval -json = %s, want %s", stdout, want)
+	}
+}
+
+func compact(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		t.Fatalf("%q: %v", s, err)
+	}
+	return buf.String()
+}
+
+func TestDiskCache(t *testing.T) {
+	disk, err := diskcache.Open(t.TempDir(), diskcache.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for run := range 2 {
+		var out bytes.Buffer
+		c := &cli{stdin: strings.NewReader(""), stdout: &out, stderr: io.Discard, disk: disk}
+		if code := c.run([]string{"fib", "-big", "200"}); code != 0 || out.String() != "Fibonacci(200) = 280571172992510140037611932413038677189525\n" {
+			t.Errorf("run %d: fib -big 200 = %d, %q", run, code, out.String())
+		}
+	}
+	if want := (diskcache.Stats{Hits: 1, Misses: 1}); disk.Stats() != want {
+		t.Errorf("disk cache Stats() = %+v, want %+v", disk.Stats(), want)
+	}
+}
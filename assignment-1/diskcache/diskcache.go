@@ -0,0 +1,304 @@
+// Package diskcache keeps the results of expensive functions, such as
+// huge factorials and prime sieves, in files, so that they outlive the
+// process that computed them.
+//
+// A Cache is a directory with a file a result, at dir/<function>/<key>.
+// Files are written whole and then renamed into place, so a reader never
+// sees half of one, and each carries a checksum, so a damaged one is
+// recomputed rather than believed. The files take up to a set size in
+// all, past which the least recently used are removed. Put memo in front
+// of a Cache to keep the hottest results in memory as well.
+package diskcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxBytes is the size of a Cache's files for the zero Options
+const DefaultMaxBytes = 1 << 30
+
+// Errors of a Cache
+var (
+	// ErrCorrupt is the error of a cache file whose checksum doesn't match
+	ErrCorrupt = errors.New("corrupt cache file")
+	// ErrTooLarge is the error of a value that would take more than the
+	// whole cache
+	ErrTooLarge = errors.New("value larger than the cache")
+)
+
+// Options configure a Cache
+type Options struct {
+	// MaxBytes caps the size of the cache's files, past which the least
+	// recently used are removed; 0 means DefaultMaxBytes
+	MaxBytes int64
+}
+
+// Stats counts how a Cache has been used
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Errors counts files that couldn't be read or written, and so were
+	// computed again or not kept
+	Errors uint64
+	// Evictions counts files removed to keep the cache under its size
+	Evictions uint64
+}
+
+// Cache stores values by key in a directory. It is safe to use from
+// several goroutines, and from several processes sharing the directory;
+// each process keeps the directory to its own MaxBytes.
+type Cache struct {
+	dir      string
+	maxBytes int64
+	// size is the bytes of the files, as of the last sweep and the Puts
+	// since; other processes' Puts are counted by the next sweep
+	size                 atomic.Int64
+	sweepMu              sync.Mutex
+	hits, misses, errors atomic.Uint64
+	evictions            atomic.Uint64
+}
+
+// Open opens the cache in dir, creating the directory if need be
+func Open(dir string, opts Options) (*Cache, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("opening cache: %w", err)
+	}
+	c := &Cache{dir: dir, maxBytes: opts.MaxBytes}
+	if err := c.sweep(); err != nil {
+		return nil, fmt.Errorf("opening cache: %w", err)
+	}
+	return c, nil
+}
+
+// Dir returns the cache's directory
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Get returns the value stored for key, which is a file name or a path of
+// them separated by "/". It returns an error wrapping fs.ErrNotExist if
+// there is none, and ErrCorrupt if the file is damaged. The file's
+// modification time is set to now, marking it used.
+func (c *Cache) Get(key string) ([]byte, error) {
+	path, err := c.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < crc32.Size || crc32.ChecksumIEEE(data[crc32.Size:]) != binary.BigEndian.Uint32(data) {
+		return nil, fmt.Errorf("%s: %w", path, ErrCorrupt)
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now) // the file is still read if this fails, just evicted sooner
+	return data[crc32.Size:], nil
+}
+
+// Put stores value for key, replacing what was there, then removes the
+// least recently used files if the cache has outgrown its size
+func (c *Cache) Put(key string, value []byte) error {
+	path, err := c.path(key)
+	if err != nil {
+		return err
+	}
+	size := int64(crc32.Size + len(value))
+	if size > c.maxBytes {
+		return fmt.Errorf("%s: %d bytes: %w", key, size, ErrTooLarge)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails harmlessly once renamed
+	_, err = f.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(value)))
+	if err == nil {
+		_, err = f.Write(value)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	var replaced int64
+	if info, err := os.Stat(path); err == nil {
+		replaced = info.Size()
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	if c.size.Add(size-replaced) > c.maxBytes {
+		return c.sweep()
+	}
+	return nil
+}
+
+// Stats returns the counts of the cache's lookups through Func, and of
+// the files evicted
+func (c *Cache) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Errors: c.errors.Load(), Evictions: c.evictions.Load()}
+}
+
+// sweep counts the cache's files and, if they take more than maxBytes,
+// removes the least recently used until they take 90% of it, so that the
+// next Puts don't each sweep again
+func (c *Cache) sweep() error {
+	c.sweepMu.Lock()
+	defer c.sweepMu.Unlock()
+	type file struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var files []file
+	var total int64
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // removed by another process since it was listed
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if total > c.maxBytes {
+		slices.SortFunc(files, func(a, b file) int { return a.used.Compare(b.used) })
+		for _, f := range files {
+			if total <= c.maxBytes-c.maxBytes/10 {
+				break
+			}
+			if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			total -= f.size
+			c.evictions.Add(1)
+		}
+	}
+	c.size.Store(total)
+	return nil
+}
+
+// path returns the file for key, refusing keys that would leave the
+// cache's directory
+func (c *Cache) path(key string) (string, error) {
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.HasPrefix(part, ".tmp-") || strings.ContainsFunc(part, badKeyRune) {
+			return "", fmt.Errorf("invalid cache key %q", key)
+		}
+	}
+	return filepath.Join(c.dir, filepath.FromSlash(key)), nil
+}
+
+func badKeyRune(r rune) bool {
+	return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_' || r == '.')
+}
+
+// Codec turns values into bytes for a Cache and back
+type Codec[V any] struct {
+	Encode func(V) ([]byte, error)
+	Decode func([]byte) (V, error)
+}
+
+// BigInt stores *big.Ints in binary, which is far quicker to read back
+// than decimal for numbers of millions of digits
+var BigInt = Codec[*big.Int]{
+	Encode: func(n *big.Int) ([]byte, error) { return n.GobEncode() },
+	Decode: func(data []byte) (*big.Int, error) {
+		n := new(big.Int)
+		return n, n.GobDecode(data)
+	},
+}
+
+// Ints stores []ints as varints, such as the primes from mathops.Sieve
+var Ints = Codec[[]int]{
+	Encode: func(ns []int) ([]byte, error) {
+		data := binary.AppendUvarint(nil, uint64(len(ns)))
+		for _, n := range ns {
+			data = binary.AppendVarint(data, int64(n))
+		}
+		return data, nil
+	},
+	Decode: func(data []byte) ([]int, error) {
+		count, k := binary.Uvarint(data)
+		if k <= 0 || count > uint64(len(data)) {
+			return nil, ErrCorrupt
+		}
+		data = data[k:]
+		ns := make([]int, count)
+		for i := range ns {
+			n, k := binary.Varint(data)
+			if k <= 0 {
+				return nil, ErrCorrupt
+			}
+			ns[i], data = int(n), data[k:]
+		}
+		return ns, nil
+	},
+}
+
+// Func returns a version of f that keeps its results in c, under the name
+// of the function, which must be a valid key. f must be a pure function:
+// the same n must always give the same value, in this process and any
+// later one. Results that took less than minCost to compute aren't kept,
+// being cheaper to compute again than the space they would take. Values
+// that can't be read are computed again, and ones that can't be stored
+// are still returned; both count in Stats.Errors.
+func Func[V any](c *Cache, name string, codec Codec[V], minCost time.Duration, f func(int) V) func(int) V {
+	return func(n int) V {
+		key := name + "/" + strconv.Itoa(n)
+		data, err := c.Get(key)
+		if err == nil {
+			var v V
+			if v, err = codec.Decode(data); err == nil {
+				c.hits.Add(1)
+				return v
+			}
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.errors.Add(1)
+		}
+		c.misses.Add(1)
+		start := time.Now()
+		v := f(n)
+		if time.Since(start) < minCost {
+			return v
+		}
+		if data, err := codec.Encode(v); err != nil || c.Put(key, data) != nil {
+			c.errors.Add(1)
+		}
+		return v
+	}
+}
@@ -0,0 +1,182 @@
+package diskcache
+
+import (
+	"errors"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/golearn/mathops"
+)
+
+func TestGetPut(t *testing.T) {
+	c, err := Open(filepath.Join(t.TempDir(), "cache"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("fact/10"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of a missing key = %v, want fs.ErrNotExist", err)
+	}
+	for _, value := range []string{"3628800", "", "replaced"} {
+		if err := c.Put("fact/10", []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := c.Get("fact/10"); err != nil || string(got) != value {
+			t.Errorf("Get after Put(%q) = %q, %v", value, got, err)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(c.Dir(), "fact"))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("the cache holds %v, %v; want just the one file", entries, err)
+	}
+	os.WriteFile(filepath.Join(c.Dir(), "fact", "10"), []byte("\x00\x00\x00\x00garbage"), 0o644)
+	if _, err := c.Get("fact/10"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Get of a damaged file = %v, want ErrCorrupt", err)
+	}
+
+	for _, key := range []string{"", "/abs", "../up", "a/../../b", "a//b", "fact/.tmp-1", "spaced out", "fact/é"} {
+		if err := c.Put(key, nil); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, err := c.Get(key); err == nil || errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Get(%q) = %v, want an invalid key error", key, err)
+		}
+	}
+}
+
+func TestFunc(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	factorial := func(n int) *big.Int {
+		calls++
+		return mathops.FactorialBig(n)
+	}
+
+	c, _ := Open(dir, Options{})
+	f := Func(c, "factorial", BigInt, 0, factorial)
+	for _, n := range []int{500, 500, 0} {
+		if got := f(n); got.Cmp(mathops.FactorialBig(n)) != 0 {
+			t.Errorf("f(%d) = %s", n, got)
+		}
+	}
+	if want := (Stats{Hits: 1, Misses: 2}); calls != 2 || c.Stats() != want {
+		t.Errorf("after three calls, %d computed and Stats() = %+v; want 2 and %+v", calls, c.Stats(), want)
+	}
+
+	// A new process finds the results where the last left them
+	c, _ = Open(dir, Options{})
+	f = Func(c, "factorial", BigInt, 0, factorial)
+	if got := f(500); got.Cmp(mathops.FactorialBig(500)) != 0 || calls != 2 {
+		t.Errorf("f(500) from a reopened cache = %s after %d calls", got, calls)
+	}
+
+	os.WriteFile(filepath.Join(dir, "factorial", "500"), []byte("damaged"), 0o644)
+	if got := f(500); got.Cmp(mathops.FactorialBig(500)) != 0 || calls != 3 {
+		t.Errorf("f(500) from a damaged file = %s after %d calls", got, calls)
+	}
+	if got := f(500); calls != 3 || got.Cmp(mathops.FactorialBig(500)) != 0 {
+		t.Errorf("the damaged file wasn't replaced: %d calls", calls)
+	}
+	if want := (Stats{Hits: 2, Misses: 1, Errors: 1}); c.Stats() != want {
+		t.Errorf("Stats() = %+v, want %+v", c.Stats(), want)
+	}
+}
+
+func TestFuncMinCost(t *testing.T) {
+	c, err := Open(t.TempDir(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quick := Func(c, "quick", Ints, time.Hour, mathops.Sieve)
+	slow := Func(c, "slow", Ints, time.Millisecond, func(n int) []int {
+		time.Sleep(2 * time.Millisecond)
+		return mathops.Sieve(n)
+	})
+	quick(100)
+	slow(100)
+	if _, err := c.Get("quick/100"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a result quicker than minCost was kept: %v", err)
+	}
+	if _, err := c.Get("slow/100"); err != nil {
+		t.Errorf("a result slower than minCost wasn't kept: %v", err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	dir := t.TempDir()
+	// Room for ten 100-byte values with their checksums
+	c, err := Open(dir, Options{MaxBytes: 10 * 104})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := make([]byte, 100)
+	old := time.Now().Add(-time.Hour)
+	for i := range 10 {
+		key := "v/" + strconv.Itoa(i)
+		if err := c.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+		// Each file used a minute after the last
+		used := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(dir, "v", strconv.Itoa(i)), used, used)
+	}
+	if got := c.Stats().Evictions; got != 0 {
+		t.Fatalf("evicted %d files from a cache that isn't full", got)
+	}
+
+	// Reading 0 makes it the most recently used, so 1 and 2 go to make room
+	if _, err := c.Get("v/0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put("v/10", value); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"v/1", "v/2"} {
+		if _, err := c.Get(key); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Get(%q) after eviction = %v, want fs.ErrNotExist", key, err)
+		}
+	}
+	for _, key := range []string{"v/0", "v/3", "v/9", "v/10"} {
+		if _, err := c.Get(key); err != nil {
+			t.Errorf("Get(%q) = %v, want it kept", key, err)
+		}
+	}
+	if got := c.Stats().Evictions; got != 2 {
+		t.Errorf("Evictions = %d, want 2", got)
+	}
+
+	// Reopening with a smaller size evicts down to it
+	c, err = Open(dir, Options{MaxBytes: 5 * 104})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "v"))
+	if len(entries) > 4 {
+		t.Errorf("reopened cache holds %d files, want at most 4", len(entries))
+	}
+
+	if err := c.Put("big", make([]byte, 5*104)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Put of a value larger than the cache = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestInts(t *testing.T) {
+	for _, ns := range [][]int{nil, mathops.Sieve(1000), {-1, 0, 1 << 62, -1 << 63}} {
+		data, _ := Ints.Encode(ns)
+		got, err := Ints.Decode(data)
+		if err != nil || !slices.Equal(got, ns) {
+			t.Errorf("Ints round trip of %v = %v, %v", ns, got, err)
+		}
+		if len(data) > 1 {
+			if _, err := Ints.Decode(data[:len(data)-1]); err == nil {
+				t.Errorf("Ints.Decode of a truncated %v succeeded", ns)
+			}
+		}
+	}
+}
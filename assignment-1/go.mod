@@ -1,3 +1,7 @@
 module github.com/nisatyap/golearn
 
-go 1.21
+go 1.23
+
+require github.com/nisatyap/shared v0.0.0
+
+replace github.com/nisatyap/shared => ../shared
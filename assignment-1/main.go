@@ -1,17 +1,80 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
-
-	"github.com/nisatyap/golearn/mathops"
+	"io"
+	"os"
+	"strings"
 )
 
 func main() {
-	var n int
+	asJSON := flag.Bool("json", false, "Print the results as JSON rather than a table")
+	file := flag.String("file", "", "Read the numbers from this file, one per line (- for stdin)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  golearn                      start an interactive session
+  golearn [flags] [--] n ...   compute the numbers given
+  golearn [flags] -file nums   compute the numbers in a file, one per line
+
+With no numbers and stdin not a terminal, the numbers are read from stdin.
+
+Flags:
+`)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	inputs := flag.Args()
+	switch {
+	case *file != "":
+		var err error
+		if inputs, err = readInputs(*file); err != nil {
+			report(err)
+			os.Exit(1)
+		}
+	case len(inputs) == 0 && isTerminal(os.Stdin):
+		os.Exit(runREPL(os.Stdin, os.Stdout))
+	case len(inputs) == 0:
+		var err error
+		if inputs, err = readInputs("-"); err != nil {
+			report(err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(runBatch(inputs, *asJSON, os.Stdout, os.Stderr))
+}
+
+// readInputs returns the lines of the file at path, or of stdin for "-",
+// leaving out blank ones
+func readInputs(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var inputs []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			inputs = append(inputs, line)
+		}
+	}
+	return inputs, sc.Err()
+}
 
-	fmt.Print("Enter a number: ")
-	fmt.Scan(&n)
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	fmt.Printf("Factorial(%d) = %d\n", n, mathops.Factorial(n))
-	fmt.Printf("Fibonacci(%d) = %d\n", n, mathops.Fibonacci(n))
+// report explains an error from mathops
+func report(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 }
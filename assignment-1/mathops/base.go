@@ -0,0 +1,141 @@
+package mathops
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Errors of the conversions, wrapped with the call that failed
+var (
+	ErrBase   = errors.New("base must be from 2 to 36")
+	ErrSyntax = errors.New("invalid digits")
+	ErrRange  = errors.New("input out of range")
+)
+
+// digits are the digits of bases up to 36, in order
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// ToBase formats n in the given base, from 2 to 36, with the lowercase
+// letters a to z for the digits past 9 and a leading "-" if n is negative,
+// as strconv.FormatInt does. It returns an error wrapping ErrBase for any
+// other base.
+func ToBase(n, base int) (string, error) {
+	if base < 2 || base > len(digits) {
+		return "", fmt.Errorf("ToBase(%d, %d): %w", n, base, ErrBase)
+	}
+	// Enough for math.MinInt in binary, sign included
+	var buf [65]byte
+	i := len(buf)
+	u, b := absUint(n), uint(base)
+	for {
+		i--
+		buf[i] = digits[u%b]
+		if u /= b; u == 0 {
+			break
+		}
+	}
+	if n < 0 {
+		i--
+		buf[i] = '-'
+	}
+	return string(buf[i:]), nil
+}
+
+// FromBase parses s, a number in the given base as ToBase writes it, with
+// an optional sign and digits in either case. It returns an error wrapping
+// ErrBase for a base outside 2 to 36, ErrSyntax if s isn't a number in
+// that base and ErrOverflow if it doesn't fit in an int.
+func FromBase(s string, base int) (int, error) {
+	if base < 2 || base > len(digits) {
+		return 0, fmt.Errorf("FromBase(%q, %d): %w", s, base, ErrBase)
+	}
+	magnitude, negative := s, false
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		magnitude, negative = s[1:], s[0] == '-'
+	}
+	if magnitude == "" {
+		return 0, fmt.Errorf("FromBase(%q, %d): %w", s, base, ErrSyntax)
+	}
+	// Accumulate |n| as a uint, which holds math.MinInt too
+	var u uint
+	for i := 0; i < len(magnitude); i++ {
+		c := magnitude[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		d := strings.IndexByte(digits[:base], c)
+		if d < 0 {
+			return 0, fmt.Errorf("FromBase(%q, %d): %w", s, base, ErrSyntax)
+		}
+		var err error
+		if u, err = CheckedMul(u, uint(base)); err == nil {
+			u, err = CheckedAdd(u, uint(d))
+		}
+		if err != nil || u > math.MaxInt+1 || (u > math.MaxInt && !negative) {
+			return 0, fmt.Errorf("FromBase(%q, %d): %w", s, base, ErrOverflow)
+		}
+	}
+	if negative {
+		return int(-u), nil
+	}
+	return int(u), nil
+}
+
+// romanNumerals pairs the values that Roman numerals are written with,
+// subtractive forms included, with their symbols, largest first
+var romanNumerals = [...]struct {
+	value  int
+	symbol string
+}{
+	{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"},
+	{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"},
+	{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+}
+
+// MaxRoman is the largest number Roman numerals write without overlines
+const MaxRoman = 3999
+
+// ToRoman writes n as a Roman numeral in the standard subtractive form,
+// e.g. 1994 as "MCMXCIV". It returns an error wrapping ErrRange for n
+// outside 1 to MaxRoman, as there is no numeral for zero.
+func ToRoman(n int) (string, error) {
+	if n < 1 || n > MaxRoman {
+		return "", fmt.Errorf("ToRoman(%d): %w (the numerals run from 1 to %d)", n, ErrRange, MaxRoman)
+	}
+	var sb strings.Builder
+	for _, numeral := range romanNumerals {
+		for n >= numeral.value {
+			sb.WriteString(numeral.symbol)
+			n -= numeral.value
+		}
+	}
+	return sb.String(), nil
+}
+
+// FromRoman parses a Roman numeral in either case. It accepts only the
+// standard form that ToRoman writes, so not "IIII" or "IC", and returns
+// an error wrapping ErrSyntax for anything else.
+func FromRoman(s string) (int, error) {
+	// strings.ToUpper would also turn some non-ASCII letters into I
+	upper := strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return r
+	}, s)
+	n, rest := 0, upper
+	for _, numeral := range romanNumerals {
+		for strings.HasPrefix(rest, numeral.symbol) {
+			n += numeral.value
+			rest = rest[len(numeral.symbol):]
+		}
+	}
+	// Reading greedily accepts some non-standard forms, such as "IVI";
+	// writing the value back out catches them
+	if canonical, err := ToRoman(n); rest != "" || err != nil || canonical != upper {
+		return 0, fmt.Errorf("FromRoman(%q): %w", s, ErrSyntax)
+	}
+	return n, nil
+}
@@ -0,0 +1,129 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestToBase(t *testing.T) {
+	for _, c := range []struct {
+		n, base int
+		want    string
+	}{
+		{0, 2, "0"},
+		{10, 2, "1010"},
+		{-255, 16, "-ff"},
+		{35, 36, "z"},
+		{36, 36, "10"},
+		{math.MaxInt, 10, strconv.Itoa(math.MaxInt)},
+		{math.MinInt, 2, strconv.FormatInt(math.MinInt64, 2)},
+	} {
+		if got, err := ToBase(c.n, c.base); err != nil || got != c.want {
+			t.Errorf("ToBase(%d, %d) = %q, %v; want %q", c.n, c.base, got, err, c.want)
+		}
+	}
+	for _, base := range []int{-1, 0, 1, 37} {
+		if _, err := ToBase(5, base); !errors.Is(err, ErrBase) {
+			t.Errorf("ToBase(5, %d) error = %v, want ErrBase", base, err)
+		}
+	}
+}
+
+func TestFromBase(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		base int
+		want int
+	}{
+		{"1010", 2, 10},
+		{"-FF", 16, -255},
+		{"+Zz", 36, 36*35 + 35},
+		{"007", 8, 7},
+		{strconv.FormatInt(math.MinInt64, 3), 3, math.MinInt},
+		{strconv.FormatInt(math.MaxInt64, 36), 36, math.MaxInt},
+	} {
+		if got, err := FromBase(c.s, c.base); err != nil || got != c.want {
+			t.Errorf("FromBase(%q, %d) = %d, %v; want %d", c.s, c.base, got, err, c.want)
+		}
+	}
+	for _, c := range []struct {
+		s    string
+		base int
+		want error
+	}{
+		{"", 10, ErrSyntax},
+		{"-", 10, ErrSyntax},
+		{"12", 2, ErrSyntax},
+		{"1 0", 10, ErrSyntax},
+		{"--1", 10, ErrSyntax},
+		{"\u212a", 36, ErrSyntax}, // the Kelvin sign, which lowercases to k
+		{"1", 1, ErrBase},
+		{"9223372036854775808", 10, ErrOverflow},
+		{"-9223372036854775809", 10, ErrOverflow},
+		{"1" + strconv.FormatInt(math.MaxInt64, 2), 2, ErrOverflow},
+	} {
+		if got, err := FromBase(c.s, c.base); !errors.Is(err, c.want) {
+			t.Errorf("FromBase(%q, %d) = %d, %v; want %v", c.s, c.base, got, err, c.want)
+		}
+	}
+}
+
+func TestBaseRoundTrip(t *testing.T) {
+	for base := 2; base <= 36; base++ {
+		for _, n := range []int{0, 1, -1, base - 1, base, 123456789, -987654321, math.MaxInt, math.MinInt} {
+			s, err := ToBase(n, base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strconv.FormatInt(int64(n), base); s != want {
+				t.Errorf("ToBase(%d, %d) = %q, strconv gives %q", n, base, s, want)
+			}
+			if got, err := FromBase(s, base); err != nil || got != n {
+				t.Errorf("FromBase(ToBase(%d, %d)) = %d, %v", n, base, got, err)
+			}
+		}
+	}
+}
+
+func TestRoman(t *testing.T) {
+	for n, want := range map[int]string{
+		1:    "I",
+		4:    "IV",
+		9:    "IX",
+		14:   "XIV",
+		40:   "XL",
+		90:   "XC",
+		400:  "CD",
+		1994: "MCMXCIV",
+		2024: "MMXXIV",
+		3999: "MMMCMXCIX",
+	} {
+		if got, err := ToRoman(n); err != nil || got != want {
+			t.Errorf("ToRoman(%d) = %q, %v; want %q", n, got, err, want)
+		}
+	}
+	for _, n := range []int{0, -5, MaxRoman + 1} {
+		if _, err := ToRoman(n); !errors.Is(err, ErrRange) {
+			t.Errorf("ToRoman(%d) error = %v, want ErrRange", n, err)
+		}
+	}
+	if got, err := FromRoman("mcmxciv"); err != nil || got != 1994 {
+		t.Errorf("FromRoman(mcmxciv) = %d, %v", got, err)
+	}
+	for _, s := range []string{"", "IIII", "IC", "VX", "IVI", "MMMM", "XIIX", "ABC", "X I", "\u0131v"} {
+		if got, err := FromRoman(s); !errors.Is(err, ErrSyntax) {
+			t.Errorf("FromRoman(%q) = %d, %v; want ErrSyntax", s, got, err)
+		}
+	}
+	for n := 1; n <= MaxRoman; n++ {
+		s, err := ToRoman(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := FromRoman(s); err != nil || got != n {
+			t.Fatalf("FromRoman(%q) = %d, %v; want %d", s, got, err, n)
+		}
+	}
+}
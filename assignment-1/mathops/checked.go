@@ -0,0 +1,109 @@
+package mathops
+
+import "fmt"
+
+// CheckedAdd returns a + b, or an error wrapping ErrOverflow if the sum
+// doesn't fit in T
+func CheckedAdd[T Integer](a, b T) (T, error) {
+	sum := a + b
+	if addOverflows(a, b, sum) {
+		return 0, fmt.Errorf("CheckedAdd(%d, %d): %w", a, b, ErrOverflow)
+	}
+	return sum, nil
+}
+
+// CheckedSum returns the sum of values as Sum does, 0 if there are none,
+// or an error wrapping ErrOverflow if a partial sum doesn't fit in T
+func CheckedSum[T Integer](values ...T) (T, error) {
+	total, ok := sum(values)
+	if !ok {
+		return 0, fmt.Errorf("CheckedSum(%d): %w", values, ErrOverflow)
+	}
+	return total, nil
+}
+
+// CheckedMul returns a * b, or an error wrapping ErrOverflow if the
+// product doesn't fit in T
+func CheckedMul[T Integer](a, b T) (T, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	p := a * b
+	if mulOverflows(a, b, p) {
+		return 0, fmt.Errorf("CheckedMul(%d, %d): %w", a, b, ErrOverflow)
+	}
+	return p, nil
+}
+
+// CheckedPow returns base raised to exp as Pow does, or an error wrapping
+// ErrOverflow if the result doesn't fit in T
+func CheckedPow[T Integer](base T, exp uint) (T, error) {
+	result, ok := pow(base, exp)
+	if !ok {
+		return 0, fmt.Errorf("CheckedPow(%d, %d): %w", base, exp, ErrOverflow)
+	}
+	return result, nil
+}
+
+// The unchecked functions share the checks below with the checked ones,
+// and panic where those return an error. Float arithmetic never overflows
+// here: it saturates at ±Inf, which the checks let through.
+
+// addOverflows reports whether sum, a + b computed in T, wrapped around
+func addOverflows[T Number](a, b, sum T) bool {
+	return (b > 0 && sum < a) || (b < 0 && sum > a)
+}
+
+// mulOverflows reports whether p, a * b computed in T, wrapped around
+func mulOverflows[T Number](a, b, p T) bool {
+	if !isInteger[T]() || a == 0 || b == 0 {
+		return false
+	}
+	// Dividing back catches every overflow but the most negative value
+	// times -1, which comes out with the wrong sign
+	return p/b != a || ((a < 0) == (b < 0)) != (p > 0)
+}
+
+// isInteger reports whether T is an integer type, where 1/2 truncates to 0
+func isInteger[T Number]() bool {
+	half := T(1)
+	half /= 2
+	return half == 0
+}
+
+// sum adds up values, reporting false if a partial sum overflows
+func sum[T Number](values []T) (T, bool) {
+	var total T
+	for _, v := range values {
+		next := total + v
+		if addOverflows(total, v, next) {
+			return 0, false
+		}
+		total = next
+	}
+	return total, true
+}
+
+// pow raises base to exp by repeated squaring, reporting false if the
+// result overflows. It squares base only while exp has bits left, so the
+// intermediate values never exceed the result.
+func pow[T Number](base T, exp uint) (T, bool) {
+	result := T(1)
+	for b, e := base, exp; ; {
+		if e&1 == 1 {
+			next := result * b
+			if mulOverflows(result, b, next) {
+				return 0, false
+			}
+			result = next
+		}
+		if e >>= 1; e == 0 {
+			return result, true
+		}
+		next := b * b
+		if mulOverflows(b, b, next) {
+			return 0, false
+		}
+		b = next
+	}
+}
@@ -0,0 +1,109 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCheckedAdd(t *testing.T) {
+	for _, c := range []struct {
+		a, b, want int
+		overflow   bool
+	}{
+		{2, 3, 5, false},
+		{-2, 3, 1, false},
+		{math.MaxInt, 0, math.MaxInt, false},
+		{math.MaxInt, math.MinInt, -1, false},
+		{math.MaxInt - 1, 1, math.MaxInt, false},
+		{math.MinInt + 1, -1, math.MinInt, false},
+		{math.MaxInt, 1, 0, true},
+		{math.MinInt, -1, 0, true},
+		{math.MinInt, math.MinInt, 0, true},
+	} {
+		if got, err := CheckedAdd(c.a, c.b); got != c.want || errors.Is(err, ErrOverflow) != c.overflow {
+			t.Errorf("CheckedAdd(%d, %d) = %d, %v", c.a, c.b, got, err)
+		}
+	}
+	if _, err := CheckedAdd[uint8](200, 56); !errors.Is(err, ErrOverflow) {
+		t.Errorf("CheckedAdd(uint8(200), 56) error = %v", err)
+	}
+}
+
+func TestCheckedSum(t *testing.T) {
+	for _, c := range []struct {
+		values   []int
+		want     int
+		overflow bool
+	}{
+		{nil, 0, false},
+		{[]int{1, 2, 3}, 6, false},
+		{[]int{math.MaxInt, math.MinInt}, -1, false},
+		{[]int{math.MaxInt, 1}, 0, true},
+		{[]int{math.MaxInt, 1, -1}, 0, true}, // a partial sum overflows
+		{[]int{math.MinInt, -1}, 0, true},
+	} {
+		if got, err := CheckedSum(c.values...); got != c.want || errors.Is(err, ErrOverflow) != c.overflow {
+			t.Errorf("CheckedSum(%d) = %d, %v", c.values, got, err)
+		}
+	}
+}
+
+func TestCheckedMul(t *testing.T) {
+	for _, c := range []struct {
+		a, b, want int
+		overflow   bool
+	}{
+		{6, 7, 42, false},
+		{-6, 7, -42, false},
+		{-6, -7, 42, false},
+		{0, math.MinInt, 0, false},
+		{math.MinInt, 1, math.MinInt, false},
+		{math.MaxInt, -1, -math.MaxInt, false},
+		{math.MinInt / 2, 2, math.MinInt, false},
+		{math.MaxInt/2 + 1, 2, 0, true},
+		{math.MinInt, -1, 0, true},
+		{-1, math.MinInt, 0, true},
+		{math.MaxInt, math.MaxInt, 0, true},
+	} {
+		if got, err := CheckedMul(c.a, c.b); got != c.want || errors.Is(err, ErrOverflow) != c.overflow {
+			t.Errorf("CheckedMul(%d, %d) = %d, %v", c.a, c.b, got, err)
+		}
+	}
+	// A product that wraps to exactly 0
+	if _, err := CheckedMul[uint32](1<<16, 1<<16); !errors.Is(err, ErrOverflow) {
+		t.Errorf("CheckedMul(uint32(1<<16), 1<<16) error = %v", err)
+	}
+	if _, err := CheckedMul[int8](-128, -1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("CheckedMul(int8(-128), -1) error = %v", err)
+	}
+}
+
+func TestCheckedPow(t *testing.T) {
+	for _, c := range []struct {
+		base     int64
+		exp      uint
+		want     int64
+		overflow bool
+	}{
+		{2, 10, 1024, false},
+		{-3, 3, -27, false},
+		{7, 0, 1, false},
+		{0, 0, 1, false},
+		{-1, 1 << 40, 1, false},
+		{2, 62, 1 << 62, false},
+		{-2, 63, math.MinInt64, false},
+		{3, 39, 4052555153018976267, false},
+		{2, 63, 0, true},
+		{3, 40, 0, true},
+		{10, 100, 0, true},
+	} {
+		got, err := CheckedPow(c.base, c.exp)
+		if got != c.want || errors.Is(err, ErrOverflow) != c.overflow {
+			t.Errorf("CheckedPow(%d, %d) = %d, %v", c.base, c.exp, got, err)
+		}
+		if !c.overflow && got != Pow(c.base, c.exp) {
+			t.Errorf("CheckedPow(%d, %d) = %d, Pow gives %d", c.base, c.exp, got, Pow(c.base, c.exp))
+		}
+	}
+}
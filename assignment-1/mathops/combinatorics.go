@@ -0,0 +1,116 @@
+package mathops
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Binomial returns n choose k, the number of ways to choose k of n items,
+// and 0 for k > n. It returns an error wrapping ErrNegative for negative n
+// or k, and ErrOverflow if the result doesn't fit in an int64; the
+// intermediate values never exceed the result.
+func Binomial(n, k int64) (int64, error) {
+	if n < 0 || k < 0 {
+		return 0, fmt.Errorf("Binomial(%d, %d): %w", n, k, ErrNegative)
+	}
+	if k > n {
+		return 0, nil
+	}
+	k = min(k, n-k)
+	// After step i, c = C(n-k+i, i), which is exact and grows with i
+	c := int64(1)
+	for i := int64(1); i <= k; i++ {
+		next, ok := mulDiv(c, n-k+i, i)
+		if !ok {
+			return 0, fmt.Errorf("Binomial(%d, %d): %w", n, k, ErrOverflow)
+		}
+		c = next
+	}
+	return c, nil
+}
+
+// Permutations returns the number of ordered arrangements of k of n
+// items, n!/(n-k)!, and 0 for k > n. It returns an error wrapping
+// ErrNegative for negative n or k, and ErrOverflow if the result doesn't
+// fit in an int64.
+func Permutations(n, k int64) (int64, error) {
+	if n < 0 || k < 0 {
+		return 0, fmt.Errorf("Permutations(%d, %d): %w", n, k, ErrNegative)
+	}
+	if k > n {
+		return 0, nil
+	}
+	p := int64(1)
+	for i := int64(0); i < k; i++ {
+		var err error
+		if p, err = CheckedMul(p, n-i); err != nil {
+			return 0, fmt.Errorf("Permutations(%d, %d): %w", n, k, ErrOverflow)
+		}
+	}
+	return p, nil
+}
+
+// Catalan returns the nth Catalan number, C(2n, n)/(n+1): the number of
+// balanced strings of n pairs of brackets, among much else. Catalan(35)
+// is the largest that fits in an int64; past it, and for negative n, it
+// returns an error wrapping ErrOverflow or ErrNegative.
+func Catalan(n int64) (int64, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("Catalan(%d): %w", n, ErrNegative)
+	}
+	// Catalan(i+1) = Catalan(i) * 2(2i+1) / (i+2)
+	c := int64(1)
+	for i := int64(0); i < n; i++ {
+		next, ok := mulDiv(c, 2*(2*i+1), i+2)
+		if !ok {
+			return 0, fmt.Errorf("Catalan(%d): %w", n, ErrOverflow)
+		}
+		c = next
+	}
+	return c, nil
+}
+
+// BinomialBig returns n choose k for any n and k, and 0 for negative
+// inputs or k > n
+func BinomialBig(n, k int64) *big.Int {
+	if n < 0 || k < 0 || k > n {
+		return new(big.Int)
+	}
+	return new(big.Int).Binomial(n, k)
+}
+
+// PermutationsBig returns n!/(n-k)! for any n and k, and 0 for negative
+// inputs or k > n
+func PermutationsBig(n, k int64) *big.Int {
+	if n < 0 || k < 0 || k > n {
+		return new(big.Int)
+	}
+	if k == 0 {
+		return big.NewInt(1)
+	}
+	return new(big.Int).MulRange(n-k+1, n)
+}
+
+// CatalanBig returns the nth Catalan number for any n, and 0 for negative
+// n
+func CatalanBig(n int64) *big.Int {
+	if n < 0 {
+		return new(big.Int)
+	}
+	c := new(big.Int).Binomial(2*n, n)
+	return c.Quo(c, big.NewInt(n+1))
+}
+
+// mulDiv returns a*b/c for non-negative a, b and positive c when the
+// quotient is exact, reporting false if it doesn't fit in an int64. It
+// divides out the common factor of a and c first, so a*b itself may
+// overflow.
+func mulDiv(a, b, c int64) (int64, bool) {
+	g, r := a, c
+	for r != 0 {
+		g, r = r, g%r
+	}
+	// c/g divides b, as it divides a*b and shares no factor with a/g
+	q, err := CheckedMul(a/g, b/(c/g))
+	return q, err == nil
+}
@@ -0,0 +1,112 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestBinomial(t *testing.T) {
+	for _, c := range []struct{ n, k, want int64 }{
+		{0, 0, 1},
+		{5, 0, 1},
+		{5, 5, 1},
+		{5, 2, 10},
+		{5, 3, 10},
+		{3, 5, 0},
+		{52, 5, 2598960},
+		{60, 30, 118264581564861424},
+		{66, 33, 7219428434016265740}, // the largest central binomial that fits
+		{1 << 40, 1, 1 << 40},
+		{1 << 32, 2, (1 << 31) * (1<<32 - 1)},
+	} {
+		if got, err := Binomial(c.n, c.k); err != nil || got != c.want {
+			t.Errorf("Binomial(%d, %d) = %d, %v; want %d", c.n, c.k, got, err, c.want)
+		}
+		if got := BinomialBig(c.n, c.k); !got.IsInt64() || got.Int64() != c.want {
+			t.Errorf("BinomialBig(%d, %d) = %s, want %d", c.n, c.k, got, c.want)
+		}
+	}
+	for _, c := range []struct {
+		n, k int64
+		want error
+	}{
+		{-1, 0, ErrNegative},
+		{5, -1, ErrNegative},
+		{68, 34, ErrOverflow},
+		{1 << 40, 3, ErrOverflow},
+	} {
+		if got, err := Binomial(c.n, c.k); !errors.Is(err, c.want) {
+			t.Errorf("Binomial(%d, %d) = %d, %v; want %v", c.n, c.k, got, err, c.want)
+		}
+	}
+	if got := BinomialBig(100, 50).String(); got != "100891344545564193334812497256" {
+		t.Errorf("BinomialBig(100, 50) = %s", got)
+	}
+	if got := BinomialBig(-1, 0); got.Sign() != 0 {
+		t.Errorf("BinomialBig(-1, 0) = %s, want 0", got)
+	}
+}
+
+func TestPermutations(t *testing.T) {
+	for _, c := range []struct{ n, k, want int64 }{
+		{0, 0, 1},
+		{5, 0, 1},
+		{5, 2, 20},
+		{5, 5, 120},
+		{2, 3, 0},
+		{20, 20, 2432902008176640000},
+		{1 << 31, 2, (1 << 31) * (1<<31 - 1)},
+		{math.MaxInt64, 1, math.MaxInt64},
+	} {
+		if got, err := Permutations(c.n, c.k); err != nil || got != c.want {
+			t.Errorf("Permutations(%d, %d) = %d, %v; want %d", c.n, c.k, got, err, c.want)
+		}
+		if got := PermutationsBig(c.n, c.k); !got.IsInt64() || got.Int64() != c.want {
+			t.Errorf("PermutationsBig(%d, %d) = %s, want %d", c.n, c.k, got, c.want)
+		}
+	}
+	for _, c := range []struct {
+		n, k int64
+		want error
+	}{
+		{-3, 1, ErrNegative},
+		{21, 21, ErrOverflow},
+		{1 << 32, 3, ErrOverflow},
+	} {
+		if got, err := Permutations(c.n, c.k); !errors.Is(err, c.want) {
+			t.Errorf("Permutations(%d, %d) = %d, %v; want %v", c.n, c.k, got, err, c.want)
+		}
+	}
+	if got := PermutationsBig(25, 25).String(); got != "15511210043330985984000000" {
+		t.Errorf("PermutationsBig(25, 25) = %s", got)
+	}
+}
+
+func TestCatalan(t *testing.T) {
+	first := []int64{1, 1, 2, 5, 14, 42, 132, 429, 1430, 4862, 16796}
+	for n, want := range first {
+		if got, err := Catalan(int64(n)); err != nil || got != want {
+			t.Errorf("Catalan(%d) = %d, %v; want %d", n, got, err, want)
+		}
+	}
+	// Catalan(35) fits even though C(70, 35) doesn't
+	if got, err := Catalan(35); err != nil || got != 3116285494907301262 {
+		t.Errorf("Catalan(35) = %d, %v", got, err)
+	}
+	for n := int64(0); n <= 35; n++ {
+		got, _ := Catalan(n)
+		if big := CatalanBig(n); !big.IsInt64() || big.Int64() != got {
+			t.Errorf("CatalanBig(%d) = %s, Catalan(%d) = %d", n, big, n, got)
+		}
+	}
+	if got, err := Catalan(36); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Catalan(36) = %d, %v; want ErrOverflow", got, err)
+	}
+	if got, err := Catalan(-1); !errors.Is(err, ErrNegative) {
+		t.Errorf("Catalan(-1) = %d, %v; want ErrNegative", got, err)
+	}
+	if got := CatalanBig(36).String(); got != "11959798385860453492" {
+		t.Errorf("CatalanBig(36) = %s", got)
+	}
+}
@@ -0,0 +1,211 @@
+package mathops
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// ErrNoPattern is the error of a sequence that Detect can't place
+var ErrNoPattern = errors.New("no known pattern")
+
+// Pattern is a kind of sequence that Detect recognizes
+type Pattern string
+
+const (
+	PatternArithmetic Pattern = "arithmetic" // a constant difference
+	PatternGeometric  Pattern = "geometric"  // a constant ratio
+	PatternSquares    Pattern = "squares"    // consecutive squares
+	PatternPrimes     Pattern = "primes"     // consecutive primes
+	PatternFibonacci  Pattern = "fibonacci"  // each term the sum of the two before
+)
+
+// DetectTerms is how many terms Detect predicts
+const DetectTerms = 3
+
+// Detection is the pattern Detect found in a sequence
+type Detection struct {
+	Pattern Pattern
+	// Rule says how the terms go on, as in "add 3" or "the squares from
+	// 4^2"
+	Rule string
+	// Next holds the next DetectTerms terms, or fewer where a term would
+	// overflow an int or, for a fractional ratio, not be whole
+	Next []int
+	// Confidence, from 0 up to 1, grows with the terms that bear the
+	// pattern out beyond those it takes to pin it down: two terms fix an
+	// arithmetic sequence, so a third that fits gives 0.5, a fourth 0.75,
+	// and so on
+	Confidence float64
+}
+
+// matcher tries a pattern on seq. It returns the pattern's rule and
+// successor function, and how many terms it took to pin down, if seq
+// fits it.
+type matcher func(seq []int) (rule string, next func(prev []int) (int, bool), fixed int, ok bool)
+
+// matchers are tried in order, which breaks ties in confidence in favour
+// of the simpler pattern
+var matchers = []struct {
+	pattern Pattern
+	match   matcher
+}{
+	{PatternArithmetic, matchArithmetic},
+	{PatternGeometric, matchGeometric},
+	{PatternSquares, matchSquares},
+	{PatternPrimes, matchPrimes},
+	{PatternFibonacci, matchFibonacci},
+}
+
+// Detect finds which of the patterns seq follows, preferring the one that
+// the most terms bear out, and predicts how it goes on:
+//
+//	d, _ := mathops.Detect([]int{2, 3, 5, 7, 11})
+//	// d.Pattern == PatternPrimes, d.Next == []int{13, 17, 19}
+//
+// It needs at least three terms, and returns an error wrapping
+// ErrNoPattern if there are fewer or if none of the patterns fits.
+func Detect(seq []int) (Detection, error) {
+	if len(seq) < 3 {
+		return Detection{}, fmt.Errorf("Detect: %d terms are too few: %w", len(seq), ErrNoPattern)
+	}
+	var best Detection
+	for _, m := range matchers {
+		rule, next, fixed, ok := m.match(seq)
+		if !ok {
+			continue
+		}
+		confidence := 1 - math.Pow(2, float64(fixed-len(seq)))
+		if confidence <= best.Confidence {
+			continue
+		}
+		best = Detection{Pattern: m.pattern, Rule: rule, Confidence: confidence}
+		terms := append([]int(nil), seq...)
+		for range DetectTerms {
+			v, ok := next(terms)
+			if !ok {
+				break
+			}
+			terms = append(terms, v)
+		}
+		best.Next = terms[len(seq):]
+	}
+	if best.Pattern == "" {
+		return Detection{}, fmt.Errorf("Detect: %w", ErrNoPattern)
+	}
+	return best, nil
+}
+
+func matchArithmetic(seq []int) (string, func([]int) (int, bool), int, bool) {
+	// -seq[0] would overflow for math.MinInt
+	d, err := CheckedAdd(seq[1], -seq[0])
+	if err != nil || seq[0] == math.MinInt {
+		return "", nil, 0, false
+	}
+	for i := 2; i < len(seq); i++ {
+		if v, err := CheckedAdd(seq[i-1], d); err != nil || v != seq[i] {
+			return "", nil, 0, false
+		}
+	}
+	next := func(prev []int) (int, bool) {
+		v, err := CheckedAdd(prev[len(prev)-1], d)
+		return v, err == nil
+	}
+	rule := fmt.Sprintf("add %d", d)
+	if d < 0 {
+		rule = fmt.Sprintf("subtract %d", -d)
+	}
+	return rule, next, 2, true
+}
+
+func matchGeometric(seq []int) (string, func([]int) (int, bool), int, bool) {
+	if seq[0] == 0 {
+		return "", nil, 0, false
+	}
+	// The ratio is num/den in lowest terms, with den > 0
+	r := big.NewRat(int64(seq[1]), int64(seq[0]))
+	if !r.Num().IsInt64() || !r.Denom().IsInt64() {
+		return "", nil, 0, false
+	}
+	num, den := int(r.Num().Int64()), int(r.Denom().Int64())
+	step := func(v int) (int, bool) {
+		p, err := CheckedMul(v, num)
+		if err != nil || p%den != 0 {
+			return 0, false
+		}
+		return p / den, true
+	}
+	for i := 2; i < len(seq); i++ {
+		if v, ok := step(seq[i-1]); !ok || v != seq[i] {
+			return "", nil, 0, false
+		}
+	}
+	next := func(prev []int) (int, bool) {
+		return step(prev[len(prev)-1])
+	}
+	return fmt.Sprintf("multiply by %s", r.RatString()), next, 2, true
+}
+
+func matchSquares(seq []int) (string, func([]int) (int, bool), int, bool) {
+	if seq[0] < 0 {
+		return "", nil, 0, false
+	}
+	k := isqrt(seq[0])
+	square := func(i int) (int, bool) {
+		v, err := CheckedMul(k+i, k+i)
+		return v, err == nil
+	}
+	for i, v := range seq {
+		if sq, ok := square(i); !ok || sq != v {
+			return "", nil, 0, false
+		}
+	}
+	next := func(prev []int) (int, bool) {
+		return square(len(prev))
+	}
+	return fmt.Sprintf("the squares from %d^2", k), next, 1, true
+}
+
+func matchPrimes(seq []int) (string, func([]int) (int, bool), int, bool) {
+	if seq[0] < 2 || !IsPrime(uint64(seq[0])) {
+		return "", nil, 0, false
+	}
+	next := func(prev []int) (int, bool) {
+		p, err := NextPrime(uint64(prev[len(prev)-1]))
+		return int(p), err == nil && p <= math.MaxInt
+	}
+	for i := 1; i < len(seq); i++ {
+		if p, ok := next(seq[:i]); !ok || p != seq[i] {
+			return "", nil, 0, false
+		}
+	}
+	return fmt.Sprintf("the primes from %d", seq[0]), next, 1, true
+}
+
+func matchFibonacci(seq []int) (string, func([]int) (int, bool), int, bool) {
+	next := func(prev []int) (int, bool) {
+		v, err := CheckedAdd(prev[len(prev)-2], prev[len(prev)-1])
+		return v, err == nil
+	}
+	for i := 2; i < len(seq); i++ {
+		if v, ok := next(seq[:i]); !ok || v != seq[i] {
+			return "", nil, 0, false
+		}
+	}
+	rule := "add the two terms before"
+	// Name the Fibonacci numbers themselves, if that is what these are
+	a, b := 0, 1
+	for k := 0; a <= seq[0]; k++ {
+		if a == seq[0] && b == seq[1] {
+			rule = fmt.Sprintf("the Fibonacci numbers from F(%d)", k)
+			break
+		}
+		sum, err := CheckedAdd(a, b)
+		if err != nil {
+			break
+		}
+		a, b = b, sum
+	}
+	return rule, next, 2, true
+}
@@ -0,0 +1,85 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	for _, c := range []struct {
+		seq        []int
+		pattern    Pattern
+		rule       string
+		next       []int
+		confidence float64
+	}{
+		{[]int{1, 2, 3}, PatternArithmetic, "add 1", []int{4, 5, 6}, 0.5},
+		{[]int{10, 7, 4, 1}, PatternArithmetic, "subtract 3", []int{-2, -5, -8}, 0.75},
+		{[]int{5, 5, 5}, PatternArithmetic, "add 0", []int{5, 5, 5}, 0.5},
+		{[]int{3, 6, 12, 24}, PatternGeometric, "multiply by 2", []int{48, 96, 192}, 0.75},
+		{[]int{-2, 6, -18}, PatternGeometric, "multiply by -3", []int{54, -162, 486}, 0.5},
+		{[]int{64, 32, 16, 8}, PatternGeometric, "multiply by 1/2", []int{4, 2, 1}, 0.75},
+		{[]int{54, 36, 24}, PatternGeometric, "multiply by 2/3", []int{16}, 0.5},
+		{[]int{0, 1, 4}, PatternSquares, "the squares from 0^2", []int{9, 16, 25}, 0.75},
+		{[]int{49, 64, 81, 100}, PatternSquares, "the squares from 7^2", []int{121, 144, 169}, 0.875},
+		{[]int{2, 3, 5, 7, 11}, PatternPrimes, "the primes from 2", []int{13, 17, 19}, 0.9375},
+		{[]int{89, 97, 101}, PatternPrimes, "the primes from 89", []int{103, 107, 109}, 0.75},
+		{[]int{0, 1, 1, 2, 3, 5}, PatternFibonacci, "the Fibonacci numbers from F(0)", []int{8, 13, 21}, 0.9375},
+		{[]int{1, 1, 2, 3}, PatternFibonacci, "the Fibonacci numbers from F(1)", []int{5, 8, 13}, 0.75},
+		{[]int{2, 1, 3, 4, 7}, PatternFibonacci, "add the two terms before", []int{11, 18, 29}, 0.875},
+		{[]int{-1, -1, -2}, PatternFibonacci, "add the two terms before", []int{-3, -5, -8}, 0.5},
+		// Fits the primes better than the Fibonacci rule, which it also fits
+		{[]int{2, 3, 5}, PatternPrimes, "the primes from 2", []int{7, 11, 13}, 0.75},
+		// Terms past an int aren't predicted
+		{[]int{math.MaxInt - 2, math.MaxInt - 1, math.MaxInt}, PatternArithmetic, "add 1", []int{}, 0.5},
+		{[]int{1 << 60, 1 << 61, 1 << 62}, PatternGeometric, "multiply by 2", []int{}, 0.5},
+		{[]int{math.MinInt + 2, math.MinInt + 1, math.MinInt}, PatternArithmetic, "subtract 1", []int{}, 0.5},
+	} {
+		d, err := Detect(c.seq)
+		if err != nil {
+			t.Errorf("Detect(%v): %v", c.seq, err)
+			continue
+		}
+		if d.Pattern != c.pattern || d.Rule != c.rule || !slices.Equal(d.Next, c.next) || d.Confidence != c.confidence {
+			t.Errorf("Detect(%v) = %+v, want %s %q %v %g", c.seq, d, c.pattern, c.rule, c.next, c.confidence)
+		}
+	}
+}
+
+func TestDetectNoPattern(t *testing.T) {
+	for _, seq := range [][]int{
+		nil,
+		{1, 2},
+		{1, 2, 4, 7},
+		{0, 5, 10, 16},
+		{2, 3, 5, 7, 13},
+		{math.MinInt, 0, math.MaxInt},
+		{0, 0, 1},
+	} {
+		if d, err := Detect(seq); !errors.Is(err, ErrNoPattern) {
+			t.Errorf("Detect(%v) = %+v, %v; want ErrNoPattern", seq, d, err)
+		}
+	}
+}
+
+func FuzzDetect(f *testing.F) {
+	f.Add(1, 2, 3, 4)
+	f.Add(0, 1, 1, 2)
+	f.Add(math.MaxInt, math.MinInt, -1, 0)
+	f.Fuzz(func(t *testing.T, a, b, c, d int) {
+		seq := []int{a, b, c, d}
+		det, err := Detect(seq)
+		if err != nil {
+			return
+		}
+		if det.Confidence <= 0 || det.Confidence >= 1 || len(det.Next) > DetectTerms {
+			t.Fatalf("Detect(%v) = %+v", seq, det)
+		}
+		// The predictions must fit the pattern too
+		if again, err := Detect(append(seq, det.Next...)); len(det.Next) > 0 && (err != nil || again.Confidence <= det.Confidence) {
+			t.Fatalf("Detect(%v) = %+v, but with its predictions %+v, %v", seq, det, again, err)
+		}
+	})
+}
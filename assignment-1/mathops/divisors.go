@@ -0,0 +1,150 @@
+package mathops
+
+import (
+	"fmt"
+	"slices"
+)
+
+// EulerTotient returns φ(n), how many of 1 to n are coprime to n, and 0
+// for n < 1. It works from the prime factors of n, φ(n) = n ∏ (1 - 1/p).
+func EulerTotient(n int) int {
+	if n < 1 {
+		return 0
+	}
+	phi := n
+	for _, f := range factorize(n) {
+		p := int(f.p)
+		phi = phi / p * (p - 1)
+	}
+	return phi
+}
+
+// Divisors returns the positive divisors of n in increasing order, and nil
+// for n < 1. It builds them from the prime factors of n rather than trying
+// every candidate.
+func Divisors(n int) []int {
+	if n < 1 {
+		return nil
+	}
+	divisors := []int{1}
+	for _, f := range factorize(n) {
+		// Times p, p^2, ..., p^k, the divisors made of the smaller primes
+		count, pk := len(divisors), 1
+		for range f.k {
+			pk *= int(f.p)
+			for _, d := range divisors[:count] {
+				divisors = append(divisors, d*pk)
+			}
+		}
+	}
+	slices.Sort(divisors)
+	return divisors
+}
+
+// SumOfDivisors returns σ(n), the sum of the positive divisors of n, and 0
+// for n < 1. It returns an error wrapping ErrOverflow if σ(n), which can
+// be several times n, doesn't fit in an int.
+func SumOfDivisors(n int) (int, error) {
+	if n < 1 {
+		return 0, nil
+	}
+	// σ is the product of 1 + p + ... + p^k over the prime powers of n
+	sum := 1
+	for _, f := range factorize(n) {
+		term, pk := 1, 1
+		var err error
+		for i := 0; i < f.k && err == nil; i++ {
+			pk *= int(f.p) // a divisor of n, so it fits
+			term, err = CheckedAdd(term, pk)
+		}
+		if err == nil {
+			sum, err = CheckedMul(sum, term)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("SumOfDivisors(%d): %w", n, ErrOverflow)
+		}
+	}
+	return sum, nil
+}
+
+// IsPerfect reports whether n is a perfect number, the sum of its proper
+// divisors, as 28 = 1 + 2 + 4 + 7 + 14 is
+func IsPerfect(n int) bool {
+	// σ(n) overflows only for n past the largest perfect number an int
+	// holds, so an error means false
+	sum, err := SumOfDivisors(n)
+	return n > 0 && err == nil && sum-n == n
+}
+
+// primePower is a prime factor p that divides a number k times
+type primePower struct {
+	p uint
+	k int
+}
+
+// trialPrimes are the primes that factorize divides out one by one before
+// it resorts to Pollard's rho, which is slow to find small factors
+var trialPrimes = smallSieve(1000)
+
+// factorize returns the prime factors of n >= 1 in increasing order, with
+// their multiplicities. It takes O(n^(1/4)) steps in the worst case.
+func factorize(n int) []primePower {
+	var primes []uint
+	m := uint(n)
+	for _, p := range trialPrimes {
+		if uint(p*p) > m {
+			break
+		}
+		for m%uint(p) == 0 {
+			primes = append(primes, uint(p))
+			m /= uint(p)
+		}
+	}
+	primes = appendPrimeFactors(primes, m)
+	slices.Sort(primes)
+
+	var factors []primePower
+	for _, p := range primes {
+		if last := len(factors) - 1; last >= 0 && factors[last].p == p {
+			factors[last].k++
+		} else {
+			factors = append(factors, primePower{p, 1})
+		}
+	}
+	return factors
+}
+
+// appendPrimeFactors appends the prime factors of m, which has none among
+// trialPrimes unless it is prime, to primes
+func appendPrimeFactors(primes []uint, m uint) []uint {
+	switch {
+	case m == 1:
+		return primes
+	case IsPrime(uint64(m)):
+		return append(primes, m)
+	}
+	d := pollardRho(m)
+	return appendPrimeFactors(appendPrimeFactors(primes, d), m/d)
+}
+
+// pollardRho returns a factor of the odd composite m other than 1 and m,
+// by Pollard's rho method: iterating x -> x^2 + c mod m until two values
+// collide modulo a prime factor, with Floyd's cycle detection
+func pollardRho(m uint) uint {
+	n := uint64(m)
+	for c := uint64(1); ; c++ {
+		// n < 2^63, as m came from an int, so adding c can't overflow
+		step := func(x uint64) uint64 {
+			return (mulMod(x, x, n) + c) % n
+		}
+		x, y, d := uint64(2), uint64(2), uint(1)
+		for d == 1 {
+			x, y = step(x), step(step(y))
+			d = gcd(uint(max(x, y)-min(x, y)), m)
+		}
+		// d == m means x and y collided modulo m itself; try another c
+		if d != m {
+			return d
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package mathops
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestDivisors(t *testing.T) {
+	for _, c := range []struct {
+		n       int
+		want    []int
+		totient int
+		sum     int
+	}{
+		{1, []int{1}, 1, 1},
+		{2, []int{1, 2}, 1, 3},
+		{12, []int{1, 2, 3, 4, 6, 12}, 4, 28},
+		{28, []int{1, 2, 4, 7, 14, 28}, 12, 56},
+		{97, []int{1, 97}, 96, 98},
+		{1 << 20, nil, 1 << 19, 1<<21 - 1},
+		// Too big to factor by trial division in reasonable time
+		{998244359987710471, []int{1, 998244353, 1000000007, 998244359987710471}, 998244357989466112, 998244359987710471 + 998244353 + 1000000007 + 1},
+		{1<<61 - 1, []int{1, 1<<61 - 1}, 1<<61 - 2, 1 << 61},
+		{1 << 62, nil, 1 << 61, 1<<63 - 1},
+	} {
+		got := Divisors(c.n)
+		if c.want != nil && !slices.Equal(got, c.want) {
+			t.Errorf("Divisors(%d) = %v, want %v", c.n, got, c.want)
+		}
+		if got := EulerTotient(c.n); got != c.totient {
+			t.Errorf("EulerTotient(%d) = %d, want %d", c.n, got, c.totient)
+		}
+		if got, err := SumOfDivisors(c.n); err != nil || got != c.sum {
+			t.Errorf("SumOfDivisors(%d) = %d, %v; want %d", c.n, got, err, c.sum)
+		}
+	}
+	if got := Divisors(720720); len(got) != 240 || got[239] != 720720 {
+		t.Errorf("Divisors(720720) has %d divisors, want 240", len(got))
+	}
+	if _, err := SumOfDivisors(8_000_000_000_000_000_000); !errors.Is(err, ErrOverflow) {
+		t.Errorf("SumOfDivisors(8e18) error = %v, want ErrOverflow", err)
+	}
+	for _, n := range []int{0, -6} {
+		if Divisors(n) != nil || EulerTotient(n) != 0 || IsPerfect(n) {
+			t.Errorf("n = %d should have no divisors", n)
+		}
+		if got, err := SumOfDivisors(n); got != 0 || err != nil {
+			t.Errorf("SumOfDivisors(%d) = %d, %v", n, got, err)
+		}
+	}
+}
+
+func TestIsPerfect(t *testing.T) {
+	var got []int
+	for n := range 10_000 {
+		if IsPerfect(n) {
+			got = append(got, n)
+		}
+	}
+	if want := []int{6, 28, 496, 8128}; !slices.Equal(got, want) {
+		t.Errorf("perfect numbers below 10000 = %v, want %v", got, want)
+	}
+	if !IsPerfect(2305843008139952128) || IsPerfect(2305843008139952130) {
+		t.Error("IsPerfect is wrong about 2^30 (2^31 - 1)")
+	}
+}
+
+// FuzzEulerTotient checks EulerTotient against counting coprimes
+func FuzzEulerTotient(f *testing.F) {
+	for _, n := range []int{-1, 0, 1, 2, 36, 97, 1001, 65536} {
+		f.Add(n)
+	}
+	f.Fuzz(func(t *testing.T, n int) {
+		n %= 20_000
+		want := 0
+		for i := 1; i <= n; i++ {
+			if GCD(i, n) == 1 {
+				want++
+			}
+		}
+		if got := EulerTotient(n); got != want {
+			t.Errorf("EulerTotient(%d) = %d, want %d", n, got, want)
+		}
+	})
+}
+
+// FuzzDivisors checks Divisors, SumOfDivisors and IsPerfect against trying
+// every candidate
+func FuzzDivisors(f *testing.F) {
+	for _, n := range []int{-1, 0, 1, 6, 28, 360, 997, 1 << 16} {
+		f.Add(n)
+	}
+	f.Fuzz(func(t *testing.T, n int) {
+		n %= 200_000
+		var want []int
+		sum := 0
+		for d := 1; d <= n; d++ {
+			if n%d == 0 {
+				want = append(want, d)
+				sum += d
+			}
+		}
+		if got := Divisors(n); !slices.Equal(got, want) {
+			t.Errorf("Divisors(%d) = %v, want %v", n, got, want)
+		}
+		if got, err := SumOfDivisors(n); err != nil || got != sum {
+			t.Errorf("SumOfDivisors(%d) = %d, %v; want %d", n, got, err, sum)
+		}
+		if got := IsPerfect(n); got != (n > 0 && sum == 2*n) {
+			t.Errorf("IsPerfect(%d) = %t", n, got)
+		}
+	})
+}
@@ -0,0 +1,351 @@
+package mathops
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrDivideByZero is the error of dividing by zero in an expression
+var ErrDivideByZero = errors.New("division by zero")
+
+// EvalError is an error in an expression, with where in it the error is
+type EvalError struct {
+	Expr string
+	// Pos is the byte offset in Expr of the token at fault
+	Pos int
+	Err error
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%v at column %d", e.Err, e.Pos+1)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// Func is a function that expressions can call, such as fact or gcd
+type Func func(args ...int) (int, error)
+
+type registeredFunc struct {
+	arity int // -1 for one or more
+	f     Func
+}
+
+var (
+	funcsMu sync.RWMutex
+	funcs   = map[string]registeredFunc{
+		"fact": {1, func(args ...int) (int, error) { return FactorialChecked(args[0]) }},
+		"fib":  {1, func(args ...int) (int, error) { return FibonacciChecked(args[0]) }},
+		"gcd": {-1, func(args ...int) (int, error) {
+			var g uint
+			for _, a := range args {
+				g = gcd(g, absUint(a))
+			}
+			if g > math.MaxInt {
+				return 0, fmt.Errorf("GCD: %w", ErrOverflow)
+			}
+			return int(g), nil
+		}},
+	}
+)
+
+// RegisterFunc makes f callable in expressions as name, with exactly
+// arity arguments, or one or more if arity is -1. It replaces any function
+// already registered as name; fact, fib and gcd are registered to begin
+// with.
+func RegisterFunc(name string, arity int, f Func) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	funcs[name] = registeredFunc{arity, f}
+}
+
+// Funcs returns the names of the functions that expressions can call, in
+// order
+func Funcs() []string {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Eval evaluates an integer expression such as "fact(5) / (2 + 3) % 7",
+// with the operators + - * / % and unary minus at the usual precedence,
+// parentheses and calls to the registered functions. Division truncates
+// toward zero, as Go's does. Errors are *EvalErrors saying where the
+// expression went wrong; arithmetic that overflows an int wraps
+// ErrOverflow, and division by zero ErrDivideByZero.
+func Eval(expr string) (int, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return 0, err
+	}
+	p := &parser{src: expr, toks: toks}
+	v, err := p.expr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf(p.peek(), "unexpected %s", p.peek())
+	}
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp // one of + - * / % ( ) ,
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// tokenize splits expr into tokens, ending with tokEOF
+func tokenize(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case isDigit(c):
+			for i < len(expr) && isDigit(expr[i]) {
+				i++
+			}
+			toks = append(toks, token{tokNumber, expr[start:i], start})
+		case isLetter(c):
+			for i < len(expr) && (isLetter(expr[i]) || isDigit(expr[i])) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, expr[start:i], start})
+		case strings.IndexByte("+-*/%(),", c) >= 0:
+			i++
+			toks = append(toks, token{tokOp, expr[start:i], start})
+		default:
+			r := []rune(expr[i:])[0]
+			return nil, &EvalError{expr, i, fmt.Errorf("unexpected character %q", r)}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(expr)}), nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+// parser evaluates tokens by recursive descent, one function a level of
+// precedence:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%") unary }
+//	unary   = ("-" | "+") unary | primary
+//	primary = number | name "(" [ expr { "," expr } ] ")" | "(" expr ")"
+type parser struct {
+	src  string
+	toks []token
+	next int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.toks[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept takes the next token if it is the operator op
+func (p *parser) accept(op string) (token, bool) {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		return p.take(), true
+	}
+	return token{}, false
+}
+
+func (p *parser) errorf(at token, format string, args ...any) error {
+	return &EvalError{p.src, at.pos, fmt.Errorf(format, args...)}
+}
+
+// wrap attributes err, from arithmetic or a function, to the token at
+func (p *parser) wrap(at token, err error) error {
+	return &EvalError{p.src, at.pos, err}
+}
+
+func (p *parser) expr() (int, error) {
+	v, err := p.term()
+	for err == nil {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "+" && t.text != "-") {
+			break
+		}
+		p.take()
+		var rhs int
+		if rhs, err = p.term(); err != nil {
+			break
+		}
+		if t.text == "+" {
+			v, err = CheckedAdd(v, rhs)
+		} else if rhs == math.MinInt {
+			// -rhs would overflow, but v - rhs may not
+			if v, err = CheckedAdd(v, math.MaxInt); err == nil {
+				v, err = CheckedAdd(v, 1)
+			}
+		} else {
+			v, err = CheckedAdd(v, -rhs)
+		}
+		if err != nil {
+			err = p.wrap(t, ErrOverflow)
+		}
+	}
+	return v, err
+}
+
+func (p *parser) term() (int, error) {
+	v, err := p.unary()
+	for err == nil {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "*" && t.text != "/" && t.text != "%") {
+			break
+		}
+		p.take()
+		var rhs int
+		if rhs, err = p.unary(); err != nil {
+			break
+		}
+		switch {
+		case t.text == "*":
+			if v, err = CheckedMul(v, rhs); err != nil {
+				err = p.wrap(t, ErrOverflow)
+			}
+		case rhs == 0:
+			err = p.wrap(t, ErrDivideByZero)
+		case t.text == "/" && v == math.MinInt && rhs == -1:
+			err = p.wrap(t, ErrOverflow)
+		case t.text == "/":
+			v /= rhs
+		default:
+			v %= rhs
+		}
+	}
+	return v, err
+}
+
+func (p *parser) unary() (int, error) {
+	if t, ok := p.accept("-"); ok {
+		// -9223372036854775808 is a number, though its digits alone overflow
+		if n := p.peek(); n.kind == tokNumber && n.text == strconv.FormatUint(-math.MinInt, 10) {
+			p.take()
+			return math.MinInt, nil
+		}
+		v, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		if v == math.MinInt {
+			return 0, p.wrap(t, ErrOverflow)
+		}
+		return -v, nil
+	}
+	if _, ok := p.accept("+"); ok {
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (int, error) {
+	t := p.take()
+	switch {
+	case t.kind == tokNumber:
+		v, err := strconv.Atoi(t.text)
+		if err != nil {
+			return 0, p.wrap(t, ErrOverflow)
+		}
+		return v, nil
+	case t.kind == tokIdent:
+		return p.call(t)
+	case t.kind == tokOp && t.text == "(":
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return 0, p.errorf(p.peek(), "expected \")\" to close the \"(\" at column %d, found %s", t.pos+1, p.peek())
+		}
+		return v, nil
+	}
+	return 0, p.errorf(t, "expected a number, found %s", t)
+}
+
+// call evaluates the call of the function called name.text
+func (p *parser) call(name token) (int, error) {
+	funcsMu.RLock()
+	fn, ok := funcs[name.text]
+	funcsMu.RUnlock()
+	if !ok {
+		return 0, p.errorf(name, "unknown function %q (the functions are %s)", name.text, strings.Join(Funcs(), ", "))
+	}
+	if _, ok := p.accept("("); !ok {
+		return 0, p.errorf(p.peek(), "expected \"(\" after %s, found %s", name.text, p.peek())
+	}
+	var args []int
+	if _, ok := p.accept(")"); !ok {
+		for {
+			v, err := p.expr()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, v)
+			if _, ok := p.accept(")"); ok {
+				break
+			}
+			if _, ok := p.accept(","); !ok {
+				return 0, p.errorf(p.peek(), "expected \",\" or \")\" in the arguments of %s, found %s", name.text, p.peek())
+			}
+		}
+	}
+	switch {
+	case fn.arity == 1 && len(args) != 1:
+		return 0, p.errorf(name, "%s takes 1 argument, not %d", name.text, len(args))
+	case fn.arity >= 0 && len(args) != fn.arity:
+		return 0, p.errorf(name, "%s takes %d arguments, not %d", name.text, fn.arity, len(args))
+	case fn.arity < 0 && len(args) == 0:
+		return 0, p.errorf(name, "%s takes at least one argument", name.text)
+	}
+	v, err := fn.f(args...)
+	if err != nil {
+		return 0, p.wrap(name, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,103 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	for expr, want := range map[string]int{
+		"42":                           42,
+		"1 + 2 * 3":                    7,
+		"(1 + 2) * 3":                  9,
+		"10 - 4 - 3":                   3,
+		"2 * 3 % 4":                    2,
+		"-7 / 2":                       -3,
+		"-7 % 3":                       -1,
+		"--5":                          5,
+		"+5 - -5":                      10,
+		"-(2 + 3) * 2":                 -10,
+		"fact(5)":                      120,
+		"fact(5) / (2 + 3)":            24,
+		"fib(10) + fib(11)":            144,
+		"gcd(12, 18)":                  6,
+		"gcd(12, 18, fib(8))":          3,
+		"gcd(0)":                       0,
+		"gcd(-9223372036854775808, 6)": 2,
+		"fact(fib(5))":                 120,
+		"  ( ( 1 ) )  ":                1,
+		"9223372036854775807":          math.MaxInt,
+		"-9223372036854775808":         math.MinInt,
+		"-9223372036854775807 - 1":     math.MinInt,
+		"-1 - -9223372036854775808":    math.MaxInt,
+		"-9223372036854775808 % -1":    0,
+	} {
+		if got, err := Eval(expr); err != nil || got != want {
+			t.Errorf("Eval(%q) = %d, %v; want %d", expr, got, err, want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		pos  int
+		msg  string
+		is   error
+	}{
+		{"", 0, "expected a number, found end of expression", nil},
+		{"1 +", 3, "expected a number, found end of expression", nil},
+		{"1 2", 2, `unexpected "2"`, nil},
+		{"(1 + 2", 6, `expected ")" to close the "(" at column 1, found end of expression`, nil},
+		{"1 + )", 4, `expected a number, found ")"`, nil},
+		{"2 ^ 3", 2, `unexpected character '^'`, nil},
+		{"2 × 3", 2, `unexpected character '×'`, nil},
+		{"sqrt(4)", 0, `unknown function "sqrt" (the functions are fact, fib, gcd)`, nil},
+		{"fact 5", 5, `expected "(" after fact, found "5"`, nil},
+		{"fact(1, 2)", 0, "fact takes 1 argument, not 2", nil},
+		{"gcd()", 0, "gcd takes at least one argument", nil},
+		{"gcd(1; 2)", 5, `unexpected character ';'`, nil},
+		{"gcd(1 2)", 6, `expected "," or ")" in the arguments of gcd, found "2"`, nil},
+		{"7 / (3 - 3)", 2, "division by zero", ErrDivideByZero},
+		{"7 % 0", 2, "division by zero", ErrDivideByZero},
+		{"9223372036854775807 + 1", 20, "result is too large", ErrOverflow},
+		{"-9223372036854775808 - 1", 21, "result is too large", ErrOverflow},
+		{"-9223372036854775808 / -1", 21, "result is too large", ErrOverflow},
+		{"3037000500 * 3037000500", 11, "result is too large", ErrOverflow},
+		{"99999999999999999999", 0, "result is too large", ErrOverflow},
+		{"-(-9223372036854775808)", 0, "result is too large", ErrOverflow},
+		{"1 + fact(21)", 4, "Factorial(21): result is too large (the largest n is 20)", ErrOverflow},
+		{"fib(-1)", 0, "Fibonacci(-1): input must not be negative", ErrNegative},
+		{"gcd(-9223372036854775808, 0)", 0, "GCD: result is too large", ErrOverflow},
+	} {
+		_, err := Eval(c.expr)
+		var e *EvalError
+		if !errors.As(err, &e) {
+			t.Errorf("Eval(%q) error = %v, want an *EvalError", c.expr, err)
+			continue
+		}
+		if want := c.msg + " at column " + strconv.Itoa(c.pos+1); e.Pos != c.pos || err.Error() != want {
+			t.Errorf("Eval(%q) error = %q (Pos %d), want %q", c.expr, err, e.Pos, want)
+		}
+		if c.is != nil && !errors.Is(err, c.is) {
+			t.Errorf("Eval(%q) error = %v, want %v", c.expr, err, c.is)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	RegisterFunc("max2", 2, func(args ...int) (int, error) { return max(args[0], args[1]), nil })
+	defer func() {
+		funcsMu.Lock()
+		delete(funcs, "max2")
+		funcsMu.Unlock()
+	}()
+	if got, err := Eval("max2(3, 7) * 2"); err != nil || got != 14 {
+		t.Errorf("max2(3, 7) * 2 = %d, %v", got, err)
+	}
+	if _, err := Eval("max2(3)"); err == nil || err.Error() != "max2 takes 2 arguments, not 1 at column 1" {
+		t.Errorf("max2(3) error = %v", err)
+	}
+}
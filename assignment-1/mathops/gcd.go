@@ -0,0 +1,71 @@
+package mathops
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// GCD returns the greatest common divisor of a and b, which is never
+// negative, with GCD(0, 0) = 0. It panics with an error wrapping
+// ErrOverflow for the one result an int can't hold, -math.MinInt, from
+// GCD(math.MinInt, 0) or GCD(math.MinInt, math.MinInt).
+func GCD(a, b int) int {
+	g := gcd(absUint(a), absUint(b))
+	if g > math.MaxInt {
+		panic(fmt.Errorf("GCD(%d, %d): %w", a, b, ErrOverflow))
+	}
+	return int(g)
+}
+
+// LCM returns the least common multiple of a and b, which is never
+// negative, with LCM(x, 0) = 0. It divides before it multiplies, so it
+// overflows only if the result itself does, and then returns an error
+// wrapping ErrOverflow.
+func LCM(a, b int) (int, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	ua, ub := absUint(a), absUint(b)
+	hi, lo := bits.Mul(ua/gcd(ua, ub), ub)
+	if hi != 0 || lo > math.MaxInt {
+		return 0, fmt.Errorf("LCM(%d, %d): %w", a, b, ErrOverflow)
+	}
+	return int(lo), nil
+}
+
+// ExtendedGCD returns g = GCD(a, b) and Bézout coefficients x and y with
+// a*x + b*y = g, by the extended Euclidean algorithm. When a and b are
+// both nonzero the coefficients are small: |x| <= |b/g| and |y| <= |a/g|.
+// Inputs of math.MinInt may overflow.
+func ExtendedGCD(a, b int) (g, x, y int) {
+	oldR, r := a, b
+	oldX, x := 1, 0
+	oldY, y := 0, 1
+	for r != 0 {
+		q := oldR / r
+		oldR, r = r, oldR-q*r
+		oldX, x = x, oldX-q*x
+		oldY, y = y, oldY-q*y
+	}
+	if oldR < 0 {
+		return -oldR, -oldX, -oldY
+	}
+	return oldR, oldX, oldY
+}
+
+// gcd is Euclid's algorithm on magnitudes
+func gcd(a, b uint) uint {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// absUint returns |n| as a uint, which holds it even for math.MinInt
+func absUint(n int) uint {
+	if n < 0 {
+		return uint(-(n + 1)) + 1
+	}
+	return uint(n)
+}
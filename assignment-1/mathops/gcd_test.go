@@ -0,0 +1,102 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGCD(t *testing.T) {
+	for _, c := range []struct{ a, b, want int }{
+		{0, 0, 0},
+		{0, 7, 7},
+		{7, 0, 7},
+		{12, 18, 6},
+		{-12, 18, 6},
+		{12, -18, 6},
+		{-12, -18, 6},
+		{17, 5, 1},
+		{1 << 40, 1 << 20, 1 << 20},
+		{math.MaxInt, math.MaxInt, math.MaxInt},
+		{math.MinInt, 6, 2},
+		{math.MinInt, math.MaxInt, 1},
+	} {
+		if got := GCD(c.a, c.b); got != c.want {
+			t.Errorf("GCD(%d, %d) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestGCDOverflow(t *testing.T) {
+	for _, c := range []struct{ a, b int }{
+		{math.MinInt, 0},
+		{0, math.MinInt},
+		{math.MinInt, math.MinInt},
+	} {
+		if err := overflowPanic(func() { GCD(c.a, c.b) }); !errors.Is(err, ErrOverflow) {
+			t.Errorf("GCD(%d, %d) panicked with %v, want ErrOverflow", c.a, c.b, err)
+		}
+	}
+}
+
+func TestLCM(t *testing.T) {
+	for _, c := range []struct{ a, b, want int }{
+		{0, 0, 0},
+		{0, 5, 0},
+		{4, 6, 12},
+		{-4, 6, 12},
+		{-4, -6, 12},
+		{7, 7, 7},
+		{21, 6, 42},
+		// Both near the limit, but the result fits: a*b alone would overflow
+		{math.MaxInt, math.MaxInt, math.MaxInt},
+		{1 << 40, 1 << 50, 1 << 50},
+		{math.MinInt + 1, 1, math.MaxInt},
+	} {
+		if got, err := LCM(c.a, c.b); err != nil || got != c.want {
+			t.Errorf("LCM(%d, %d) = %d, %v; want %d", c.a, c.b, got, err, c.want)
+		}
+	}
+	for _, c := range []struct{ a, b int }{
+		{math.MaxInt, 2},
+		{math.MaxInt, math.MaxInt - 1},
+		{math.MinInt, 1},
+		{math.MinInt, 3},
+	} {
+		if got, err := LCM(c.a, c.b); !errors.Is(err, ErrOverflow) {
+			t.Errorf("LCM(%d, %d) = %d, %v; want ErrOverflow", c.a, c.b, got, err)
+		}
+	}
+}
+
+func TestExtendedGCD(t *testing.T) {
+	for _, c := range []struct{ a, b, g, x, y int }{
+		{0, 0, 0, 1, 0},
+		{0, 5, 5, 0, 1},
+		{5, 0, 5, 1, 0},
+		{240, 46, 2, -9, 47},
+		{46, 240, 2, 47, -9},
+		{-240, 46, 2, 9, 47},
+		{99, 78, 3, -11, 14},
+		{7, 7, 7, 0, 1},
+	} {
+		g, x, y := ExtendedGCD(c.a, c.b)
+		if g != c.g || x != c.x || y != c.y {
+			t.Errorf("ExtendedGCD(%d, %d) = %d, %d, %d; want %d, %d, %d", c.a, c.b, g, x, y, c.g, c.x, c.y)
+		}
+	}
+
+	// Bézout's identity and the bounds on the coefficients
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		a, b := rng.Intn(1<<31)-1<<30, rng.Intn(1<<31)-1<<30
+		g, x, y := ExtendedGCD(a, b)
+		if g != GCD(a, b) || a*x+b*y != g {
+			t.Fatalf("ExtendedGCD(%d, %d) = %d, %d, %d", a, b, g, x, y)
+		}
+		if a != 0 && b != 0 && (Abs(x) > Abs(b/g) || Abs(y) > Abs(a/g)) {
+			t.Fatalf("ExtendedGCD(%d, %d) = %d, %d, %d: coefficients too large", a, b, g, x, y)
+		}
+	}
+}
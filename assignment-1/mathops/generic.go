@@ -0,0 +1,60 @@
+package mathops
+
+import "fmt"
+
+// Integer is any integer type, as constraints.Integer in golang.org/x/exp
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Float is any floating-point type
+type Float interface {
+	~float32 | ~float64
+}
+
+// Number is any integer or floating-point type.
+//
+// Integer results of the generic functions that don't fit in T panic with
+// an error wrapping ErrOverflow rather than wrap around; CheckedSum and
+// CheckedPow return that error instead. Float results become ±Inf (or NaN,
+// for a NaN input) as Go's operators make them. Compute in a wider type,
+// or use math/big, when that matters.
+type Number interface {
+	Integer | Float
+}
+
+// Sum returns the sum of values, 0 if there are none. It panics if a
+// partial sum of integers overflows; see Number.
+func Sum[T Number](values ...T) T {
+	total, ok := sum(values)
+	if !ok {
+		panic(fmt.Errorf("Sum(%v): %w", values, ErrOverflow))
+	}
+	return total
+}
+
+// Pow returns base raised to exp by repeated squaring, in O(log exp)
+// multiplications; Pow(x, 0) is 1 for every x. It panics if an integer
+// result overflows; see Number. For a fractional or negative exponent use
+// math.Pow.
+func Pow[T Number](base T, exp uint) T {
+	result, ok := pow(base, exp)
+	if !ok {
+		panic(fmt.Errorf("Pow(%v, %d): %w", base, exp, ErrOverflow))
+	}
+	return result
+}
+
+// Abs returns the absolute value of x; Abs(-0.0) is -0.0. It panics for
+// the most negative value of a signed integer type, such as
+// Abs(int8(-128)), which has no positive counterpart; see Number.
+func Abs[T Number](x T) T {
+	if x < 0 {
+		if -x < 0 {
+			panic(fmt.Errorf("Abs(%v): %w", x, ErrOverflow))
+		}
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,107 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSum(t *testing.T) {
+	if got := Sum[int](); got != 0 {
+		t.Errorf("Sum() = %d, want 0", got)
+	}
+	if got := Sum(1, 2, 3, -4); got != 2 {
+		t.Errorf("Sum(1, 2, 3, -4) = %d, want 2", got)
+	}
+	if got := Sum(0.5, 0.25); got != 0.75 {
+		t.Errorf("Sum(0.5, 0.25) = %g, want 0.75", got)
+	}
+	// Overflow panics for integers and goes to +Inf for floats
+	if err := overflowPanic(func() { Sum[int8](100, 100) }); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sum[int8](100, 100) panicked with %v, want ErrOverflow", err)
+	}
+	if err := overflowPanic(func() { Sum[uint8](200, 100) }); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sum[uint8](200, 100) panicked with %v, want ErrOverflow", err)
+	}
+	if got := Sum[int8](100, 27, -100); got != 27 {
+		t.Errorf("Sum[int8](100, 27, -100) = %d, want 27", got)
+	}
+	if got := Sum(math.MaxFloat64, math.MaxFloat64); !math.IsInf(got, 1) {
+		t.Errorf("Sum(MaxFloat64, MaxFloat64) = %g, want +Inf", got)
+	}
+}
+
+func TestPow(t *testing.T) {
+	for _, c := range []struct {
+		base int64
+		exp  uint
+		want int64
+	}{
+		{0, 0, 1},
+		{7, 0, 1},
+		{0, 5, 0},
+		{2, 10, 1024},
+		{-3, 3, -27},
+		{-1, 1001, -1},
+		{10, 18, 1_000_000_000_000_000_000},
+		{-2, 63, math.MinInt64},
+	} {
+		if got := Pow(c.base, c.exp); got != c.want {
+			t.Errorf("Pow(%d, %d) = %d, want %d", c.base, c.exp, got, c.want)
+		}
+	}
+	for _, exp := range []uint{63, 64} {
+		if err := overflowPanic(func() { Pow[int64](2, exp) }); !errors.Is(err, ErrOverflow) {
+			t.Errorf("Pow(2, %d) panicked with %v, want ErrOverflow", exp, err)
+		}
+	}
+	if got := Pow(1.5, 2); got != 2.25 {
+		t.Errorf("Pow(1.5, 2) = %g, want 2.25", got)
+	}
+	if got := Pow(float32(10), 39); !math.IsInf(float64(got), 1) {
+		t.Errorf("Pow(float32(10), 39) = %g, want +Inf", got)
+	}
+	if got := Pow[uint8](3, 5); got != 243 {
+		t.Errorf("Pow[uint8](3, 5) = %d, want 243", got)
+	}
+}
+
+func TestAbs(t *testing.T) {
+	if got := Abs(-5); got != 5 {
+		t.Errorf("Abs(-5) = %d", got)
+	}
+	if got := Abs(uint(5)); got != 5 {
+		t.Errorf("Abs(uint(5)) = %d", got)
+	}
+	if got := Abs(-2.5); got != 2.5 {
+		t.Errorf("Abs(-2.5) = %g", got)
+	}
+	if got := Abs(math.Inf(-1)); !math.IsInf(got, 1) {
+		t.Errorf("Abs(-Inf) = %g", got)
+	}
+	if got := Abs(math.NaN()); !math.IsNaN(got) {
+		t.Errorf("Abs(NaN) = %g", got)
+	}
+	if got := Abs(int8(math.MinInt8 + 1)); got != math.MaxInt8 {
+		t.Errorf("Abs(int8(-127)) = %d", got)
+	}
+	if got := Abs(math.Copysign(0, -1)); got != 0 || !math.Signbit(got) {
+		t.Errorf("Abs(-0.0) = %g, want -0.0 unchanged", got)
+	}
+	type celsius float64
+	if got := Abs(celsius(-40)); got != 40 {
+		t.Errorf("Abs(celsius(-40)) = %g", got)
+	}
+}
+
+func TestAbsOverflow(t *testing.T) {
+	for name, f := range map[string]func(){
+		"Abs(math.MinInt)":   func() { Abs(math.MinInt) },
+		"Abs(int8(-128))":    func() { Abs(int8(math.MinInt8)) },
+		"Abs(int64(MinInt))": func() { Abs(int64(math.MinInt64)) },
+	} {
+		if err := overflowPanic(f); !errors.Is(err, ErrOverflow) {
+			t.Errorf("%s panicked with %v, want ErrOverflow", name, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package mathops provides small integer math functions.
+package mathops
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+)
+
+// Errors of the checked functions, wrapped with the call that failed
+var (
+	ErrNegative = errors.New("input must not be negative")
+	ErrOverflow = errors.New("result is too large")
+)
+
+// Largest inputs whose results fit in an int: MaxFactorial is 20 and
+// MaxFibonacci 92 where int is 64 bits, 12 and 46 where it is 32
+const (
+	MaxFactorial = 12 + 8*(strconv.IntSize/64)
+	MaxFibonacci = 46 + 46*(strconv.IntSize/64)
+)
+
+// Factorial returns n!, and 1 for negative n. It panics past MaxFactorial,
+// where n! overflows int; FactorialChecked returns that error instead, and
+// FactorialBig the result.
+func Factorial(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return must(FactorialChecked(n))
+}
+
+// FactorialBig returns n! for any n, and 1 for negative n, as Factorial
+// does without overflowing. ParallelFactorialBig is faster for large n on
+// several cores.
+func FactorialBig(n int) *big.Int {
+	if n <= 1 {
+		return big.NewInt(1)
+	}
+	return new(big.Int).MulRange(2, int64(n))
+}
+
+// Fibonacci returns the nth Fibonacci number, with Fibonacci(0) = 0,
+// Fibonacci(1) = 1, and 0 for negative n. It takes O(n) time. It panics
+// past MaxFibonacci, where the result overflows int; FibonacciChecked
+// returns that error instead, and FibonacciBig the result.
+func Fibonacci(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return must(FibonacciChecked(n))
+}
+
+// FibonacciBig returns the nth Fibonacci number for any n, as Fibonacci
+// does without overflowing. It takes O(n) additions.
+func FibonacciBig(n int) *big.Int {
+	a, b := big.NewInt(0), big.NewInt(1)
+	for i := 0; i < n; i++ {
+		a.Add(a, b)
+		a, b = b, a
+	}
+	return a
+}
+
+// FibonacciFast returns Fibonacci(n), panicking past MaxFibonacci in the
+// same way, in O(log n) time by raising the matrix [[1 1] [1 0]], whose
+// nth power is [[F(n+1) F(n)] [F(n) F(n-1)]], to the nth power by
+// repeated squaring
+func FibonacciFast(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	checkFibonacci("FibonacciFast", n)
+	// result and m are symmetric 2x2 matrices, [[a b] [b c]]
+	ra, rb, rc := 1, 0, 1 // the identity
+	ma, mb, mc := 1, 1, 0
+	for e := n; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			ra, rb, rc = ra*ma+rb*mb, ra*mb+rb*mc, rb*mb+rc*mc
+		}
+		ma, mb, mc = ma*ma+mb*mb, ma*mb+mb*mc, mb*mb+mc*mc
+	}
+	return rb
+}
+
+// FibonacciDoubling returns Fibonacci(n), panicking past MaxFibonacci in
+// the same way, in O(log n) time by the doubling identities
+// F(2k) = F(k)(2F(k+1) - F(k)) and F(2k+1) = F(k)^2 + F(k+1)^2. It does
+// about half the multiplications of FibonacciFast.
+func FibonacciDoubling(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	checkFibonacci("FibonacciDoubling", n)
+	a, b := 0, 1 // F(k), F(k+1) for k = the bits of n read so far
+	for i := bits.Len(uint(n)) - 1; i >= 0; i-- {
+		a, b = a*(2*b-a), a*a+b*b
+		if n>>i&1 == 1 {
+			a, b = b, a+b
+		}
+	}
+	return a
+}
+
+// FactorialChecked returns n!, or an error wrapping ErrNegative for
+// negative n and ErrOverflow for n past MaxFactorial. It multiplies with
+// CheckedMul, so the result can't wrap around.
+func FactorialChecked(n int) (int, error) {
+	if n < 0 {
+		return 0, rangeError("Factorial", n, MaxFactorial)
+	}
+	f := 1
+	for i := 2; i <= n; i++ {
+		var err error
+		if f, err = CheckedMul(f, i); err != nil {
+			return 0, rangeError("Factorial", n, MaxFactorial)
+		}
+	}
+	return f, nil
+}
+
+// FibonacciChecked returns the nth Fibonacci number, or an error wrapping
+// ErrNegative for negative n and ErrOverflow for n past MaxFibonacci. It
+// adds with CheckedAdd, so the result can't wrap around.
+func FibonacciChecked(n int) (int, error) {
+	if n < 0 {
+		return 0, rangeError("Fibonacci", n, MaxFibonacci)
+	}
+	a, b := 0, 1
+	for i := 0; i < n; i++ {
+		next, err := CheckedAdd(a, b)
+		// b runs one term ahead, so only the last step's a+b may be too big
+		if err != nil && i < n-1 {
+			return 0, rangeError("Fibonacci", n, MaxFibonacci)
+		}
+		a, b = b, next
+	}
+	return a, nil
+}
+
+// checkFibonacci panics if F(n) doesn't fit in an int, for the function
+// called name. Below that the O(log n) methods may still wrap around in
+// terms they compute on the way, such as F(n+1), but int arithmetic is
+// exact modulo 2^bits, so a result that fits comes out right.
+func checkFibonacci(name string, n int) {
+	if n > MaxFibonacci {
+		panic(rangeError(name, n, MaxFibonacci))
+	}
+}
+
+// must returns v, panicking with err if it isn't nil, for the unchecked
+// functions that wrap checked ones
+func must(v int, err error) int {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// rangeError explains why n is out of range, given the largest n whose
+// result fits, for the function called name
+func rangeError(name string, n, limit int) error {
+	if n < 0 {
+		return fmt.Errorf("%s(%d): %w", name, n, ErrNegative)
+	}
+	return fmt.Errorf("%s(%d): %w (the largest n is %d)", name, n, ErrOverflow, limit)
+}
@@ -0,0 +1,207 @@
+package mathops
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestFactorial(t *testing.T) {
+	if Factorial(0) != 1 {
+		t.Error("Factorial(0) should be 1")
+	}
+	if Factorial(5) != 120 {
+		t.Error("Factorial(5) should be 120")
+	}
+}
+
+func TestFactorialBig(t *testing.T) {
+	for n := -1; n <= MaxFactorial; n++ {
+		if got := FactorialBig(n); !got.IsInt64() || got.Int64() != int64(Factorial(n)) {
+			t.Fatalf("FactorialBig(%d) = %s, Factorial(%d) = %d", n, got, n, Factorial(n))
+		}
+	}
+	if got := FactorialBig(30).String(); got != "265252859812191058636308480000000" {
+		t.Errorf("FactorialBig(30) = %s", got)
+	}
+}
+
+func TestFibonacci(t *testing.T) {
+	if Fibonacci(0) != 0 {
+		t.Error("Fibonacci(0) should be 0")
+	}
+	if Fibonacci(10) != 55 {
+		t.Error("Fibonacci(10) should be 55")
+	}
+}
+
+func TestFibonacciLimit(t *testing.T) {
+	if Fibonacci(-5) != 0 {
+		t.Error("Fibonacci(-5) should be 0")
+	}
+	if MaxFibonacci == 92 && Fibonacci(92) != 7540113804746346429 {
+		t.Errorf("Fibonacci(92) = %d, want 7540113804746346429", Fibonacci(92))
+	}
+	if got := Fibonacci(MaxFibonacci); got <= 0 || got < Fibonacci(MaxFibonacci-1) {
+		t.Errorf("Fibonacci(MaxFibonacci) = %d overflowed", got)
+	}
+}
+
+// overflowPanic returns the error f panicked with, or nil if it returned
+func overflowPanic(f func()) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err, _ = v.(error)
+			if err == nil {
+				err = fmt.Errorf("panicked with %v", v)
+			}
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestOverflowBoundaries(t *testing.T) {
+	if MaxFactorial != 20 || MaxFibonacci != 92 {
+		t.Skip("the boundaries are those of a 64-bit int")
+	}
+	for _, c := range []struct {
+		name string
+		f    func(int) int
+		n    int
+		want int // 0 if it overflows
+	}{
+		{"Factorial", Factorial, 20, 2432902008176640000},
+		{"Factorial", Factorial, 21, 0},
+		{"Fibonacci", Fibonacci, 92, 7540113804746346429},
+		{"Fibonacci", Fibonacci, 93, 0},
+		{"FibonacciFast", FibonacciFast, 92, 7540113804746346429},
+		{"FibonacciFast", FibonacciFast, 93, 0},
+		{"FibonacciDoubling", FibonacciDoubling, 92, 7540113804746346429},
+		{"FibonacciDoubling", FibonacciDoubling, 93, 0},
+	} {
+		var got int
+		err := overflowPanic(func() { got = c.f(c.n) })
+		switch {
+		case c.want == 0 && !errors.Is(err, ErrOverflow):
+			t.Errorf("%s(%d) = %d, %v; want a panic wrapping ErrOverflow", c.name, c.n, got, err)
+		case c.want != 0 && (err != nil || got != c.want):
+			t.Errorf("%s(%d) = %d, %v; want %d", c.name, c.n, got, err, c.want)
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		f    func(int) (int, error)
+		n    int
+		want int
+	}{
+		{"FactorialChecked", FactorialChecked, 20, 2432902008176640000},
+		{"FactorialChecked", FactorialChecked, 21, 0},
+		{"FibonacciChecked", FibonacciChecked, 92, 7540113804746346429},
+		{"FibonacciChecked", FibonacciChecked, 93, 0},
+	} {
+		got, err := c.f(c.n)
+		if got != c.want || (c.want == 0) != errors.Is(err, ErrOverflow) {
+			t.Errorf("%s(%d) = %d, %v; want %d", c.name, c.n, got, err, c.want)
+		}
+	}
+}
+
+func TestFibonacciBig(t *testing.T) {
+	for n := -1; n <= MaxFibonacci; n++ {
+		if got := FibonacciBig(n); !got.IsInt64() || got.Int64() != int64(Fibonacci(n)) {
+			t.Fatalf("FibonacciBig(%d) = %s, Fibonacci(%d) = %d", n, got, n, Fibonacci(n))
+		}
+	}
+	for n, want := range map[int]string{
+		93:  "12200160415121876738",
+		100: "354224848179261915075",
+		300: "222232244629420445529739893461909967206666939096499764990979600",
+	} {
+		if got := FibonacciBig(n).String(); got != want {
+			t.Errorf("FibonacciBig(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestChecked(t *testing.T) {
+	if got, err := FactorialChecked(MaxFactorial); err != nil || got != Factorial(MaxFactorial) {
+		t.Errorf("FactorialChecked(MaxFactorial) = %d, %v", got, err)
+	}
+	if got, err := FibonacciChecked(10); err != nil || got != 55 {
+		t.Errorf("FibonacciChecked(10) = %d, %v", got, err)
+	}
+	if got, err := FibonacciChecked(MaxFibonacci); err != nil || got != Fibonacci(MaxFibonacci) {
+		t.Errorf("FibonacciChecked(MaxFibonacci) = %d, %v", got, err)
+	}
+	for _, c := range []struct {
+		name string
+		f    func(int) (int, error)
+		n    int
+		want error
+	}{
+		{"Factorial", FactorialChecked, -1, ErrNegative},
+		{"Factorial", FactorialChecked, MaxFactorial + 1, ErrOverflow},
+		{"Fibonacci", FibonacciChecked, -5, ErrNegative},
+		{"Fibonacci", FibonacciChecked, MaxFibonacci + 1, ErrOverflow},
+		{"Factorial", FactorialChecked, math.MaxInt, ErrOverflow},
+		{"Fibonacci", FibonacciChecked, math.MaxInt, ErrOverflow},
+	} {
+		if got, err := c.f(c.n); !errors.Is(err, c.want) || got != 0 {
+			t.Errorf("%sChecked(%d) = %d, %v; want %v", c.name, c.n, got, err, c.want)
+		}
+	}
+}
+
+func TestFibonacciFast(t *testing.T) {
+	for n := -2; n <= MaxFibonacci; n++ {
+		want := Fibonacci(n)
+		if got := FibonacciFast(n); got != want {
+			t.Errorf("FibonacciFast(%d) = %d, want %d", n, got, want)
+		}
+		if got := FibonacciDoubling(n); got != want {
+			t.Errorf("FibonacciDoubling(%d) = %d, want %d", n, got, want)
+		}
+	}
+	for _, n := range []int{MaxFibonacci + 1, 1000, math.MaxInt} {
+		if err := overflowPanic(func() { FibonacciFast(n) }); !errors.Is(err, ErrOverflow) {
+			t.Errorf("FibonacciFast(%d) panicked with %v, want ErrOverflow", n, err)
+		}
+		if err := overflowPanic(func() { FibonacciDoubling(n) }); !errors.Is(err, ErrOverflow) {
+			t.Errorf("FibonacciDoubling(%d) panicked with %v, want ErrOverflow", n, err)
+		}
+	}
+}
+
+// fibonacciRecursive is how Fibonacci used to work, in O(φ^n) time
+func fibonacciRecursive(n int) int {
+	if n <= 1 {
+		return max(n, 0)
+	}
+	return fibonacciRecursive(n-1) + fibonacciRecursive(n-2)
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	for _, impl := range []struct {
+		name string
+		f    func(int) int
+	}{
+		{"Recursive", fibonacciRecursive},
+		{"Iterative", Fibonacci},
+		{"Matrix", FibonacciFast},
+		{"Doubling", FibonacciDoubling},
+	} {
+		for _, n := range []int{30, MaxFibonacci} {
+			if impl.name == "Recursive" && n > 30 {
+				continue // would take hours
+			}
+			b.Run(fmt.Sprintf("%s/n=%d", impl.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					impl.f(n)
+				}
+			})
+		}
+	}
+}
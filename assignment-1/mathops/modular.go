@@ -0,0 +1,93 @@
+package mathops
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors of the modular arithmetic functions, wrapped with the call that
+// failed
+var (
+	ErrModulus    = errors.New("modulus must be positive")
+	ErrNoInverse  = errors.New("no modular inverse")
+	ErrNoSolution = errors.New("no solution")
+)
+
+// Mod returns a mod m in [0, m), unlike a % m, which takes the sign of a.
+// m must be positive.
+func Mod(a, m int) int {
+	r := a % m
+	if r < 0 {
+		r += m
+	}
+	return r
+}
+
+// ModPow returns base^exp mod m in [0, m) by fast exponentiation, in
+// O(log exp) multiplications that never overflow. A negative exp raises
+// the modular inverse of base, if it has one.
+func ModPow(base, exp, m int) (int, error) {
+	if m <= 0 {
+		return 0, fmt.Errorf("ModPow(%d, %d, %d): %w", base, exp, m, ErrModulus)
+	}
+	if m == 1 {
+		return 0, nil
+	}
+	b := Mod(base, m)
+	if exp < 0 {
+		inv, err := ModInverse(b, m)
+		if err != nil {
+			return 0, fmt.Errorf("ModPow(%d, %d, %d): %w", base, exp, m, ErrNoInverse)
+		}
+		b = inv
+	}
+	return int(powMod(uint64(b), uint64(absUint(exp)), uint64(m))), nil
+}
+
+// ModInverse returns x in [0, m) with a*x ≡ 1 (mod m), which exists only
+// if a and m are coprime
+func ModInverse(a, m int) (int, error) {
+	if m <= 0 {
+		return 0, fmt.Errorf("ModInverse(%d, %d): %w", a, m, ErrModulus)
+	}
+	g, x, _ := ExtendedGCD(Mod(a, m), m)
+	if g != 1 {
+		return 0, fmt.Errorf("ModInverse(%d, %d): %w: they share the factor %d", a, m, ErrNoInverse, g)
+	}
+	return Mod(x, m), nil
+}
+
+// CRT solves the system x ≡ residues[i] (mod moduli[i]) by the Chinese
+// remainder theorem, returning the solution x in [0, m) and m, the LCM of
+// the moduli: the solutions are exactly x + k*m. The moduli need not be
+// coprime, but a system that then contradicts itself has no solution and
+// returns an error wrapping ErrNoSolution. If m overflows an int the error
+// wraps ErrOverflow.
+func CRT(residues, moduli []int) (x, m int, err error) {
+	if len(residues) != len(moduli) {
+		return 0, 0, fmt.Errorf("CRT: %d residues for %d moduli", len(residues), len(moduli))
+	}
+	x, m = 0, 1
+	for i, mi := range moduli {
+		if mi <= 0 {
+			return 0, 0, fmt.Errorf("CRT: moduli[%d] = %d: %w", i, mi, ErrModulus)
+		}
+		// Combine x (mod m) with ri (mod mi): x + m*t ≡ ri (mod mi), so
+		// (m/g)*t ≡ (ri-x)/g (mod mi/g) for g = GCD(m, mi)
+		g := GCD(m, mi)
+		diff := Mod(residues[i], mi) - Mod(x, mi)
+		if diff%g != 0 {
+			return 0, 0, fmt.Errorf("CRT: x ≡ %d (mod %d) contradicts the congruences before it: %w", residues[i], mi, ErrNoSolution)
+		}
+		lcm, err := LCM(m, mi)
+		if err != nil {
+			return 0, 0, fmt.Errorf("CRT: the moduli's LCM: %w", ErrOverflow)
+		}
+		step := mi / g
+		inv, _ := ModInverse(m/g, step) // coprime, since g took their common factors
+		t := mulMod(uint64(Mod(diff/g, step)), uint64(inv), uint64(step))
+		// x < m and t < step, so x + m*t < m*step = lcm
+		x, m = x+m*int(t), lcm
+	}
+	return x, m, nil
+}
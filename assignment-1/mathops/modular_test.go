@@ -0,0 +1,130 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMod(t *testing.T) {
+	for _, c := range []struct{ a, m, want int }{
+		{7, 3, 1},
+		{-7, 3, 2},
+		{-6, 3, 0},
+		{0, 5, 0},
+		{-1, math.MaxInt, math.MaxInt - 1},
+	} {
+		if got := Mod(c.a, c.m); got != c.want {
+			t.Errorf("Mod(%d, %d) = %d, want %d", c.a, c.m, got, c.want)
+		}
+	}
+}
+
+func TestModPow(t *testing.T) {
+	for _, c := range []struct{ base, exp, m, want int }{
+		{4, 13, 497, 445},
+		{2, 10, 1000, 24},
+		{2, 0, 7, 1},
+		{0, 0, 7, 1},
+		{5, 3, 1, 0},
+		{-2, 3, 5, 2},                        // -8 ≡ 2
+		{3, -1, 7, 5},                        // 3*5 ≡ 1
+		{3, -2, 7, 4},                        // 5^2 = 25 ≡ 4
+		{math.MaxInt - 1, 2, math.MaxInt, 1}, // (-1)^2, where a plain product would overflow
+		{math.MaxInt - 1, math.MaxInt, math.MaxInt, math.MaxInt - 1},
+	} {
+		if got, err := ModPow(c.base, c.exp, c.m); err != nil || got != c.want {
+			t.Errorf("ModPow(%d, %d, %d) = %d, %v; want %d", c.base, c.exp, c.m, got, err, c.want)
+		}
+	}
+	// Fermat's little theorem: a^(p-1) ≡ 1 (mod p) for a prime p not dividing a
+	for _, p := range []int{3, 101, 65537, 1_000_000_007, 1<<61 - 1} {
+		for _, a := range []int{2, 10, p - 1} {
+			if got, err := ModPow(a, p-1, p); err != nil || got != 1 {
+				t.Errorf("ModPow(%d, %d, %d) = %d, %v; want 1", a, p-1, p, got, err)
+			}
+		}
+	}
+	for _, c := range []struct {
+		base, exp, m int
+		want         error
+	}{
+		{2, 3, 0, ErrModulus},
+		{2, 3, -5, ErrModulus},
+		{4, -1, 8, ErrNoInverse},
+	} {
+		if got, err := ModPow(c.base, c.exp, c.m); !errors.Is(err, c.want) {
+			t.Errorf("ModPow(%d, %d, %d) = %d, %v; want %v", c.base, c.exp, c.m, got, err, c.want)
+		}
+	}
+}
+
+func TestModInverse(t *testing.T) {
+	for _, c := range []struct{ a, m, want int }{
+		{3, 11, 4},
+		{-3, 11, 7},
+		{10, 17, 12},
+		{1, 1, 0},
+		{7, 1, 0},
+		{math.MaxInt - 1, math.MaxInt, math.MaxInt - 1}, // -1 is its own inverse
+	} {
+		if got, err := ModInverse(c.a, c.m); err != nil || got != c.want {
+			t.Errorf("ModInverse(%d, %d) = %d, %v; want %d", c.a, c.m, got, err, c.want)
+		}
+	}
+	for _, c := range []struct {
+		a, m int
+		want error
+	}{
+		{6, 9, ErrNoInverse},
+		{0, 7, ErrNoInverse},
+		{3, 0, ErrModulus},
+	} {
+		if got, err := ModInverse(c.a, c.m); !errors.Is(err, c.want) {
+			t.Errorf("ModInverse(%d, %d) = %d, %v; want %v", c.a, c.m, got, err, c.want)
+		}
+	}
+}
+
+func TestCRT(t *testing.T) {
+	for _, c := range []struct {
+		residues, moduli []int
+		x, m             int
+	}{
+		{nil, nil, 0, 1},
+		{[]int{2, 3, 2}, []int{3, 5, 7}, 23, 105},
+		{[]int{-1, -1}, []int{4, 9}, 35, 36},
+		{[]int{2, 4}, []int{6, 8}, 20, 24}, // not coprime, but consistent
+		{[]int{3, 3}, []int{10, 10}, 3, 10},
+		{[]int{1, 2, 3, 4}, []int{1_000_000_007, 998_244_353, 1, 2}, 0, 0}, // x and m checked below
+	} {
+		x, m, err := CRT(c.residues, c.moduli)
+		if err != nil {
+			t.Errorf("CRT(%v, %v): %v", c.residues, c.moduli, err)
+			continue
+		}
+		if c.m != 0 && (x != c.x || m != c.m) {
+			t.Errorf("CRT(%v, %v) = %d, %d; want %d, %d", c.residues, c.moduli, x, m, c.x, c.m)
+		}
+		for i, mi := range c.moduli {
+			if x < 0 || x >= m || Mod(x, mi) != Mod(c.residues[i], mi) {
+				t.Errorf("CRT(%v, %v) = %d, %d, which fails the congruence mod %d", c.residues, c.moduli, x, m, mi)
+			}
+		}
+	}
+	for _, c := range []struct {
+		residues, moduli []int
+		want             error
+	}{
+		{[]int{1, 2}, []int{4, 6}, ErrNoSolution},
+		{[]int{1}, []int{0}, ErrModulus},
+		{[]int{0, 0}, []int{math.MaxInt, math.MaxInt - 1}, ErrOverflow},
+	} {
+		if x, m, err := CRT(c.residues, c.moduli); !errors.Is(err, c.want) {
+			t.Errorf("CRT(%v, %v) = %d, %d, %v; want %v", c.residues, c.moduli, x, m, err, c.want)
+		}
+	}
+	if _, _, err := CRT([]int{1, 2}, []int{3}); err == nil {
+		t.Error("CRT with more residues than moduli succeeded")
+	}
+}
@@ -0,0 +1,60 @@
+package mathops
+
+import (
+	"math/big"
+	"runtime"
+	"sync"
+)
+
+// parallelFactorialMin is the smallest n that ParallelFactorialBig splits
+// up; below it the goroutines cost more than they save
+const parallelFactorialMin = 5000
+
+// ParallelFactorialBig returns n! as FactorialBig does, splitting the
+// product 2 * 3 * ... * n into ranges that GOMAXPROCS goroutines multiply
+// out at once, then multiplying those partial products together in pairs,
+// also in parallel. Only the last multiplication runs alone, so it scales
+// well to a few cores for n in the tens of thousands and up.
+func ParallelFactorialBig(n int) *big.Int {
+	return parallelFactorial(n, runtime.GOMAXPROCS(0))
+}
+
+// parallelFactorial returns n! using up to about workers goroutines at once
+func parallelFactorial(n, workers int) *big.Int {
+	if n < parallelFactorialMin || workers < 2 {
+		return FactorialBig(n)
+	}
+	// The products of later ranges are larger; a few ranges per worker
+	// keep them all busy to the end
+	parts := make([]*big.Int, 4*workers)
+	count := int64(n - 1) // the factors 2 to n
+	var wg sync.WaitGroup
+	for i := range parts {
+		lo := 2 + count*int64(i)/int64(len(parts))
+		hi := 1 + count*int64(i+1)/int64(len(parts))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parts[i] = new(big.Int).MulRange(lo, hi)
+		}()
+	}
+	wg.Wait()
+
+	for len(parts) > 1 {
+		next := make([]*big.Int, (len(parts)+1)/2)
+		for i := range next {
+			if 2*i+1 == len(parts) {
+				next[i] = parts[2*i]
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				next[i] = parts[2*i].Mul(parts[2*i], parts[2*i+1])
+			}()
+		}
+		wg.Wait()
+		parts = next
+	}
+	return parts[0]
+}
@@ -0,0 +1,38 @@
+package mathops
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParallelFactorialBig(t *testing.T) {
+	for _, n := range []int{-1, 0, 1, 20, parallelFactorialMin - 1, parallelFactorialMin, 12345} {
+		want := FactorialBig(n)
+		if got := ParallelFactorialBig(n); got.Cmp(want) != 0 {
+			t.Errorf("ParallelFactorialBig(%d) differs from FactorialBig", n)
+		}
+		// Whatever GOMAXPROCS is here, including an odd number of parts
+		for _, workers := range []int{2, 3, 8} {
+			if got := parallelFactorial(n, workers); got.Cmp(want) != 0 {
+				t.Errorf("parallelFactorial(%d, %d) differs from FactorialBig", n, workers)
+			}
+		}
+	}
+}
+
+// Run with -cpu 1,2,4,8 to see ParallelFactorialBig scale with the cores
+// it is given
+func BenchmarkFactorialBig(b *testing.B) {
+	for _, n := range []int{10_000, 100_000, 300_000} {
+		b.Run(fmt.Sprintf("Sequential/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				FactorialBig(n)
+			}
+		})
+		b.Run(fmt.Sprintf("Parallel/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ParallelFactorialBig(n)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package mathops
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// MaxPrime64 is the largest prime that fits in a uint64, 2^64 - 59
+const MaxPrime64 uint64 = 18446744073709551557
+
+// witnesses are the Miller-Rabin bases that decide every n < 2^64: all
+// the primes up to 37 (Sorenson and Webster, 2015)
+var witnesses = [...]uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37}
+
+// IsPrime reports whether n is prime. It runs a Miller-Rabin test with a
+// fixed set of bases that is exact, not probabilistic, for 64-bit inputs.
+func IsPrime(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	// Trial division by the bases also keeps them smaller than n below
+	for _, p := range witnesses {
+		if n%p == 0 {
+			return n == p
+		}
+	}
+	// n-1 = d * 2^s with d odd
+	s := bits.TrailingZeros64(n - 1)
+	d := (n - 1) >> s
+	for _, a := range witnesses {
+		x := powMod(a, d, n)
+		if x == 1 || x == n-1 {
+			continue
+		}
+		composite := true
+		for r := 1; r < s; r++ {
+			x = mulMod(x, x, n)
+			if x == n-1 {
+				composite = false
+				break
+			}
+		}
+		if composite {
+			return false
+		}
+	}
+	return true
+}
+
+// NextPrime returns the smallest prime greater than n, or an error
+// wrapping ErrOverflow if n >= MaxPrime64
+func NextPrime(n uint64) (uint64, error) {
+	if n >= MaxPrime64 {
+		return 0, fmt.Errorf("NextPrime(%d): %w", n, ErrOverflow)
+	}
+	if n < 2 {
+		return 2, nil
+	}
+	// Odd candidates only; none of them overflows below MaxPrime64
+	c := n + 1 + n%2
+	for !IsPrime(c) {
+		c += 2
+	}
+	return c, nil
+}
+
+// sieveSegment is how many numbers Sieve crosses off at a time: small
+// enough for the segment to stay in the CPU cache
+const sieveSegment = 1 << 15
+
+// Sieve returns the primes up to and including n, in order, using a
+// segmented sieve of Eratosthenes: O(n log log n) time, and O(sqrt n)
+// memory besides the result.
+func Sieve(n int) []int {
+	if n < 2 {
+		return nil
+	}
+	base := smallSieve(isqrt(n))
+	// π(n) < 1.25506 n / ln n for n > 1 (Rosser and Schoenfeld)
+	primes := make([]int, 0, int(1.25506*float64(n)/math.Log(float64(n)))+1)
+	composite := make([]bool, sieveSegment)
+	for low := 2; ; low += sieveSegment {
+		high := low + min(sieveSegment-1, n-low)
+		primes = sieveSegmentOf(primes, composite, low, high, base)
+		if high == n {
+			return primes
+		}
+	}
+}
+
+// sieveSegmentOf appends the primes in [low, high] to primes, crossing off
+// the multiples of base, which must hold every prime up to sqrt(high), in
+// composite, which must hold high-low+1 entries
+func sieveSegmentOf(primes []int, composite []bool, low, high int, base []int) []int {
+	clear(composite)
+	for _, p := range base {
+		// Multiples below p*p have a smaller prime factor. m < start
+		// once m overflows, near the largest int.
+		start := max(p*p, (low+p-1)/p*p)
+		for m := start; m <= high && m >= start; m += p {
+			composite[m-low] = true
+		}
+	}
+	for i := low; i <= high; i++ {
+		if !composite[i-low] {
+			primes = append(primes, i)
+		}
+	}
+	return primes
+}
+
+// smallSieve returns the primes up to n with a plain sieve of Eratosthenes
+func smallSieve(n int) []int {
+	composite := make([]bool, n+1)
+	var primes []int
+	for i := 2; i <= n; i++ {
+		if composite[i] {
+			continue
+		}
+		primes = append(primes, i)
+		for m := i * i; m <= n; m += i {
+			composite[m] = true
+		}
+	}
+	return primes
+}
+
+// isqrt returns the integer square root of n >= 0
+func isqrt(n int) int {
+	r := int(math.Sqrt(float64(n)))
+	// float64 rounding can be off by one either way for large n. Compare
+	// by dividing, as (r+1)*(r+1) can overflow.
+	for r > 0 && r > n/r {
+		r--
+	}
+	for r+1 <= n/(r+1) {
+		r++
+	}
+	return r
+}
+
+// mulMod returns a*b mod m for a, b < m, without overflowing
+func mulMod(a, b, m uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	_, rem := bits.Div64(hi, lo, m)
+	return rem
+}
+
+// powMod returns base^exp mod m for base < m
+func powMod(base, exp, m uint64) uint64 {
+	result := uint64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result = mulMod(result, base, m)
+		}
+		base = mulMod(base, base, m)
+		exp >>= 1
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestIsPrime(t *testing.T) {
+	// Against the sieve for every small n
+	const limit = 100_000
+	primes := Sieve(limit)
+	for n, i := 0, 0; n <= limit; n++ {
+		want := i < len(primes) && primes[i] == n
+		if want {
+			i++
+		}
+		if got := IsPrime(uint64(n)); got != want {
+			t.Fatalf("IsPrime(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	for _, c := range []struct {
+		n    uint64
+		want bool
+	}{
+		{561, false},                 // Carmichael number
+		{3215031751, false},          // strong pseudoprime to bases 2, 3, 5 and 7
+		{3825123056546413051, false}, // strong pseudoprime to the bases up to 23
+		{1<<61 - 1, true},            // Mersenne prime
+		{1<<62 - 57, true},
+		{MaxPrime64, true},
+		{1<<64 - 1, false},
+		{4294967291 * 4294967279, false}, // the two largest 32-bit primes
+		{1000000007 * 998244353, false},
+	} {
+		if got := IsPrime(c.n); got != c.want {
+			t.Errorf("IsPrime(%d) = %v, want %v", c.n, got, c.want)
+		}
+	}
+}
+
+func TestNextPrime(t *testing.T) {
+	for _, c := range []struct{ n, want uint64 }{
+		{0, 2},
+		{1, 2},
+		{2, 3},
+		{3, 5},
+		{4, 5},
+		{13, 17},
+		{7919, 7927},
+		{1 << 31, 2147483659},
+		{MaxPrime64 - 1, MaxPrime64},
+	} {
+		if got, err := NextPrime(c.n); err != nil || got != c.want {
+			t.Errorf("NextPrime(%d) = %d, %v; want %d", c.n, got, err, c.want)
+		}
+	}
+	for _, n := range []uint64{MaxPrime64, 1<<64 - 1} {
+		if got, err := NextPrime(n); !errors.Is(err, ErrOverflow) {
+			t.Errorf("NextPrime(%d) = %d, %v; want ErrOverflow", n, got, err)
+		}
+	}
+}
+
+func TestSieve(t *testing.T) {
+	for n, want := range map[int][]int{
+		-1: nil,
+		0:  nil,
+		1:  nil,
+		2:  {2},
+		10: {2, 3, 5, 7},
+		30: {2, 3, 5, 7, 11, 13, 17, 19, 23, 29},
+		31: {2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31},
+	} {
+		if got := Sieve(n); !slices.Equal(got, want) {
+			t.Errorf("Sieve(%d) = %v, want %v", n, got, want)
+		}
+	}
+	// Across segments and at their edges, against a plain sieve
+	for _, n := range []int{sieveSegment - 1, sieveSegment, sieveSegment + 1, 2*sieveSegment + 1, 1_000_000} {
+		if got, want := Sieve(n), smallSieve(n); !slices.Equal(got, want) {
+			t.Errorf("Sieve(%d) has %d primes, want %d", n, len(got), len(want))
+		}
+	}
+	if got := len(Sieve(1_000_000)); got != 78498 {
+		t.Errorf("π(1000000) = %d, want 78498", got)
+	}
+}
+
+func TestIsqrt(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 4, 15, 16, 17, 1<<52 - 1, 1 << 52, 1<<62 - 1, math.MaxInt} {
+		r := isqrt(n)
+		if r < 0 || r > n/max(r, 1) || r+1 <= n/(r+1) {
+			t.Errorf("isqrt(%d) = %d", n, r)
+		}
+	}
+}
+
+func BenchmarkIsPrime(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		IsPrime(MaxPrime64)
+	}
+}
+
+func BenchmarkNextPrime(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NextPrime(1 << 62)
+	}
+}
+
+func BenchmarkSieve(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Sieve(10_000_000)
+	}
+}
@@ -0,0 +1,107 @@
+package mathops
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrEmptyRange is the error of a random draw from a range with nothing in
+// it, such as IntRange(5, 1)
+var ErrEmptyRange = errors.New("empty range")
+
+// Rand draws random numbers within ranges. It embeds a *rand.Rand, so the
+// rest of math/rand/v2, such as Perm and Shuffle, draws from the same
+// source.
+//
+// A Rand from NewRand draws the same numbers every time for the same
+// seed, which makes failures in randomized tests reproducible; it is not
+// safe for concurrent use. One from NewCryptoRand draws from crypto/rand,
+// so its numbers can't be predicted, and it is safe for concurrent use.
+type Rand struct {
+	*rand.Rand
+	seed   uint64
+	seeded bool
+}
+
+// NewRand returns a Rand whose draws are determined by seed
+func NewRand(seed uint64) *Rand {
+	return &Rand{Rand: rand.New(rand.NewPCG(seed, seed)), seed: seed, seeded: true}
+}
+
+// NewCryptoRand returns a Rand that draws from crypto/rand, for anything
+// an attacker mustn't guess, such as tokens or the jitter that spreads out
+// retries
+func NewCryptoRand() *Rand {
+	return &Rand{Rand: rand.New(cryptoSource{})}
+}
+
+// Seed returns the seed of a Rand from NewRand, to report alongside a
+// failure, and false for one from NewCryptoRand
+func (r *Rand) Seed() (uint64, bool) {
+	return r.seed, r.seeded
+}
+
+// IntRange returns a uniformly random int from lo to hi, both included.
+// It returns an error wrapping ErrEmptyRange if lo > hi.
+func (r *Rand) IntRange(lo, hi int) (int, error) {
+	if lo > hi {
+		return 0, fmt.Errorf("IntRange(%d, %d): %w", lo, hi, ErrEmptyRange)
+	}
+	// The span in a uint64 is exact even where hi - lo overflows an int
+	span := uint64(hi) - uint64(lo)
+	if span == math.MaxUint64 {
+		return int(r.Uint64()), nil
+	}
+	return lo + int(r.Uint64N(span+1)), nil
+}
+
+// FloatRange returns a uniformly random float64 from lo up to but not
+// including hi. It returns an error wrapping ErrEmptyRange unless lo < hi
+// and both are finite, and ErrRange if hi - lo is too large for a float64.
+func (r *Rand) FloatRange(lo, hi float64) (float64, error) {
+	if !(lo < hi) || math.IsInf(lo, 0) || math.IsInf(hi, 0) {
+		return 0, fmt.Errorf("FloatRange(%g, %g): %w", lo, hi, ErrEmptyRange)
+	}
+	span := hi - lo
+	if math.IsInf(span, 0) {
+		return 0, fmt.Errorf("FloatRange(%g, %g): %w", lo, hi, ErrRange)
+	}
+	x := lo + span*r.Float64()
+	if x >= hi {
+		// Rounding can reach hi itself
+		x = math.Nextafter(hi, lo)
+	}
+	return x, nil
+}
+
+// Jitter returns d scaled by a random factor from 1-frac to 1+frac, so
+// that clients retrying every d don't all retry at once. frac is capped
+// at 1. If frac or d isn't positive, d is returned as it is.
+func (r *Rand) Jitter(d time.Duration, frac float64) time.Duration {
+	if !(frac > 0) || d <= 0 {
+		return d
+	}
+	frac = min(frac, 1)
+	x := float64(d) * (1 + frac*(2*r.Float64()-1))
+	if x >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(x)
+}
+
+// cryptoSource is a rand.Source reading crypto/rand
+type cryptoSource struct{}
+
+func (cryptoSource) Uint64() uint64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		// crypto/rand fails only if the system's source is unusable
+		panic(fmt.Sprintf("mathops: reading crypto/rand: %v", err))
+	}
+	return binary.LittleEndian.Uint64(b[:])
+}
@@ -0,0 +1,107 @@
+package mathops
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewRandReproducible(t *testing.T) {
+	draw := func(r *Rand) []int {
+		ns := make([]int, 20)
+		for i := range ns {
+			ns[i], _ = r.IntRange(-1000, 1000)
+		}
+		return ns
+	}
+	a, b := draw(NewRand(42)), draw(NewRand(42))
+	if !slices.Equal(a, b) {
+		t.Errorf("two Rands seeded 42 drew %v and %v", a, b)
+	}
+	if c := draw(NewRand(43)); slices.Equal(a, c) {
+		t.Errorf("Rands seeded 42 and 43 both drew %v", a)
+	}
+	if seed, ok := NewRand(42).Seed(); seed != 42 || !ok {
+		t.Errorf("Seed() = %d, %t", seed, ok)
+	}
+	if _, ok := NewCryptoRand().Seed(); ok {
+		t.Error("a crypto Rand has a seed")
+	}
+}
+
+func TestIntRange(t *testing.T) {
+	for _, r := range []*Rand{NewRand(1), NewCryptoRand()} {
+		for _, c := range []struct{ lo, hi int }{
+			{0, 0}, {-3, 3}, {1, 6}, {math.MaxInt - 1, math.MaxInt}, {math.MinInt, math.MinInt + 1}, {math.MinInt, math.MaxInt},
+		} {
+			seen := make(map[int]bool)
+			for range 200 {
+				n, err := r.IntRange(c.lo, c.hi)
+				if err != nil || n < c.lo || n > c.hi {
+					t.Fatalf("IntRange(%d, %d) = %d, %v", c.lo, c.hi, n, err)
+				}
+				seen[n] = true
+			}
+			// Small ranges should come up whole
+			if span := c.hi - c.lo + 1; span > 0 && span <= 7 && len(seen) != span {
+				t.Errorf("IntRange(%d, %d) drew only %v", c.lo, c.hi, seen)
+			}
+		}
+	}
+	if _, err := NewRand(1).IntRange(5, 1); !errors.Is(err, ErrEmptyRange) {
+		t.Errorf("IntRange(5, 1) = %v, want ErrEmptyRange", err)
+	}
+}
+
+func TestFloatRange(t *testing.T) {
+	r := NewRand(7)
+	for _, c := range []struct{ lo, hi float64 }{
+		{0, 1}, {-2.5, 2.5}, {1, math.Nextafter(1, 2)}, {-math.MaxFloat64 / 2, math.MaxFloat64 / 2},
+	} {
+		for range 200 {
+			x, err := r.FloatRange(c.lo, c.hi)
+			if err != nil || x < c.lo || x >= c.hi {
+				t.Fatalf("FloatRange(%g, %g) = %g, %v", c.lo, c.hi, x, err)
+			}
+		}
+	}
+	for _, c := range []struct {
+		lo, hi float64
+		want   error
+	}{
+		{1, 1, ErrEmptyRange},
+		{2, 1, ErrEmptyRange},
+		{math.NaN(), 1, ErrEmptyRange},
+		{0, math.Inf(1), ErrEmptyRange},
+		{-math.MaxFloat64, math.MaxFloat64, ErrRange},
+	} {
+		if _, err := r.FloatRange(c.lo, c.hi); !errors.Is(err, c.want) {
+			t.Errorf("FloatRange(%g, %g) = %v, want %v", c.lo, c.hi, err, c.want)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	r := NewRand(3)
+	for range 200 {
+		if d := r.Jitter(time.Second, 0.2); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("Jitter(1s, 0.2) = %v", d)
+		}
+		if d := r.Jitter(time.Second, 5); d < 0 || d > 2*time.Second {
+			t.Fatalf("Jitter(1s, 5) = %v", d)
+		}
+	}
+	for _, c := range []struct {
+		d    time.Duration
+		frac float64
+	}{{time.Second, 0}, {time.Second, -1}, {time.Second, math.NaN()}, {0, 0.5}, {-time.Second, 0.5}} {
+		if got := r.Jitter(c.d, c.frac); got != c.d {
+			t.Errorf("Jitter(%v, %g) = %v, want it unchanged", c.d, c.frac, got)
+		}
+	}
+	if d := r.Jitter(math.MaxInt64, 1); d < 0 {
+		t.Errorf("Jitter(MaxInt64, 1) = %v", d)
+	}
+}
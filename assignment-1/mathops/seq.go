@@ -0,0 +1,62 @@
+package mathops
+
+import (
+	"iter"
+	"math"
+	"math/big"
+)
+
+// FibonacciSeq returns the Fibonacci sequence, without end, as pairs of n
+// and Fibonacci(n) from n = 0, computed one term at a time as the caller
+// ranges over it:
+//
+//	for n, f := range mathops.FibonacciSeq() {
+//		if n > 100 {
+//			break
+//		}
+//		fmt.Println(n, f)
+//	}
+//
+// The terms are big.Ints, as they soon outgrow an int; each is the
+// caller's to keep or change.
+func FibonacciSeq() iter.Seq2[int, *big.Int] {
+	return func(yield func(int, *big.Int) bool) {
+		a, b := big.NewInt(0), big.NewInt(1)
+		for n := 0; ; n++ {
+			if !yield(n, new(big.Int).Set(a)) {
+				return
+			}
+			a.Add(a, b)
+			a, b = b, a
+		}
+	}
+}
+
+// PrimesSeq returns the primes in order, from 2 up to the largest int
+// (which no caller will reach), computed a segment of the segmented sieve
+// at a time as the caller ranges over it. It holds O(sqrt p) memory for
+// the largest prime p reached.
+func PrimesSeq() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		composite := make([]bool, sieveSegment)
+		var base, primes []int
+		baseLimit := 0
+		for low := 2; ; low += sieveSegment {
+			high := low + min(sieveSegment-1, math.MaxInt-low)
+			if r := isqrt(high); r > baseLimit {
+				// Grow the base primes geometrically, not every segment
+				baseLimit = min(max(r, 2*baseLimit), isqrt(math.MaxInt))
+				base = smallSieve(baseLimit)
+			}
+			primes = sieveSegmentOf(primes[:0], composite, low, high, base)
+			for _, p := range primes {
+				if !yield(p) {
+					return
+				}
+			}
+			if high == math.MaxInt {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mathops
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFibonacciSeq(t *testing.T) {
+	count := 0
+	for n, f := range FibonacciSeq() {
+		if n != count {
+			t.Fatalf("term %d has n = %d", count, n)
+		}
+		if want := FibonacciBig(n); f.Cmp(want) != 0 {
+			t.Fatalf("FibonacciSeq term %d = %s, want %s", n, f, want)
+		}
+		f.SetInt64(-1) // the caller's to change, without upsetting the sequence
+		count++
+		if n == 200 {
+			break
+		}
+	}
+	if count != 201 {
+		t.Errorf("ranged over %d terms, want 201", count)
+	}
+}
+
+func TestPrimesSeq(t *testing.T) {
+	// Across many segments, and as the base primes grow
+	const limit = 3_000_000
+	var got []int
+	for p := range PrimesSeq() {
+		if p > limit {
+			break
+		}
+		got = append(got, p)
+	}
+	if want := Sieve(limit); !slices.Equal(got, want) {
+		t.Errorf("PrimesSeq up to %d gave %d primes, want %d", limit, len(got), len(want))
+	}
+
+	// Stopping at once doesn't sieve more than it must
+	for p := range PrimesSeq() {
+		if p != 2 {
+			t.Errorf("first prime = %d", p)
+		}
+		break
+	}
+}
+
+func BenchmarkPrimesSeq(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for p := range PrimesSeq() {
+			if p > 10_000_000 {
+				break
+			}
+		}
+	}
+}
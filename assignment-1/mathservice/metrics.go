@@ -0,0 +1,155 @@
+package mathservice
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/golearn/diskcache"
+	"github.com/nisatyap/golearn/memo"
+	"github.com/nisatyap/shared/promtext"
+)
+
+// durationBuckets are the request duration histogram bounds in seconds
+var durationBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// cacheStats reads a cache's counts at scrape time
+type cacheStats func() memo.Stats
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+type requestKey struct {
+	endpoint string
+	code     int
+}
+
+// metrics counts the service's requests and serves them in the Prometheus
+// text format
+type metrics struct {
+	caches   map[string]cacheStats
+	inFlight func() int
+	// disk reads the disk cache's counts, if there is one
+	disk func() diskcache.Stats
+
+	mu        sync.Mutex
+	start     time.Time
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+}
+
+func newMetrics(caches map[string]cacheStats, inFlight func() int) *metrics {
+	return &metrics{
+		caches:    caches,
+		inFlight:  inFlight,
+		start:     time.Now(),
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+// observe records a request to endpoint that was answered with code
+func (m *metrics) observe(endpoint string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{endpoint, code}]++
+	h := m.durations[endpoint]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(durationBuckets)+1)}
+		m.durations[endpoint] = h
+	}
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(durationBuckets, seconds)
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+// ServeHTTP writes all metrics in Prometheus text format
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	m.render(&b)
+	w.Header().Set("Content-Type", promtext.ContentType)
+	fmt.Fprint(w, b.String())
+}
+
+func (m *metrics) render(b *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	promtext.Header(b, "mathd_start_time_seconds", "gauge", "Unix time the service started.")
+	promtext.Sample(b, "mathd_start_time_seconds", nil, float64(m.start.Unix()))
+
+	promtext.Header(b, "mathd_requests_total", "counter", "Requests by endpoint and status code; 503s were turned away as too many were in progress.")
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		promtext.Sample(b, "mathd_requests_total", map[string]string{"endpoint": k.endpoint, "code": strconv.Itoa(k.code)}, float64(m.requests[k]))
+	}
+
+	promtext.Header(b, "mathd_requests_in_flight", "gauge", "Requests computing now.")
+	promtext.Sample(b, "mathd_requests_in_flight", nil, float64(m.inFlight()))
+
+	const duration = "mathd_request_duration_seconds"
+	promtext.Header(b, duration, "histogram", "Request duration by endpoint.")
+	for _, endpoint := range sortedKeys(m.durations) {
+		h := m.durations[endpoint]
+		var cumulative uint64
+		for i, bound := range durationBuckets {
+			cumulative += h.counts[i]
+			promtext.Sample(b, duration+"_bucket", map[string]string{"endpoint": endpoint, "le": strconv.FormatFloat(bound, 'f', -1, 64)}, float64(cumulative))
+		}
+		promtext.Sample(b, duration+"_bucket", map[string]string{"endpoint": endpoint, "le": "+Inf"}, float64(h.count))
+		promtext.Sample(b, duration+"_sum", map[string]string{"endpoint": endpoint}, h.sum)
+		promtext.Sample(b, duration+"_count", map[string]string{"endpoint": endpoint}, float64(h.count))
+	}
+
+	promtext.Header(b, "mathd_cache_hits_total", "counter", "Results served from the cache, by function.")
+	for _, fn := range sortedKeys(m.caches) {
+		promtext.Sample(b, "mathd_cache_hits_total", map[string]string{"function": fn}, float64(m.caches[fn]().Hits))
+	}
+	promtext.Header(b, "mathd_cache_misses_total", "counter", "Results computed because they weren't cached, by function.")
+	for _, fn := range sortedKeys(m.caches) {
+		promtext.Sample(b, "mathd_cache_misses_total", map[string]string{"function": fn}, float64(m.caches[fn]().Misses))
+	}
+	promtext.Header(b, "mathd_cache_entries", "gauge", "Results in the cache, by function.")
+	for _, fn := range sortedKeys(m.caches) {
+		promtext.Sample(b, "mathd_cache_entries", map[string]string{"function": fn}, float64(m.caches[fn]().Len))
+	}
+
+	if m.disk != nil {
+		disk := m.disk()
+		promtext.Header(b, "mathd_disk_cache_hits_total", "counter", "Results read from the disk cache.")
+		promtext.Sample(b, "mathd_disk_cache_hits_total", nil, float64(disk.Hits))
+		promtext.Header(b, "mathd_disk_cache_misses_total", "counter", "Results computed because they weren't on disk.")
+		promtext.Sample(b, "mathd_disk_cache_misses_total", nil, float64(disk.Misses))
+		promtext.Header(b, "mathd_disk_cache_errors_total", "counter", "Disk cache files that couldn't be read or written.")
+		promtext.Sample(b, "mathd_disk_cache_errors_total", nil, float64(disk.Errors))
+		promtext.Header(b, "mathd_disk_cache_evictions_total", "counter", "Disk cache files removed to keep it under its size.")
+		promtext.Sample(b, "mathd_disk_cache_evictions_total", nil, float64(disk.Evictions))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,232 @@
+// Package mathservice serves the functions of the mathops package over
+// HTTP as JSON:
+//
+//	GET /factorial?n=20   {"n":20,"result":2432902008176640000}
+//	GET /fibonacci?n=100  {"n":100,"result":354224848179261915075}
+//	GET /primes?limit=10  {"limit":10,"count":4,"primes":[2,3,5,7]}
+//
+// Results are exact, however large. Inputs are capped so that one request
+// can't tie up the server, as is the number of requests computing at
+// once, and GET /metrics reports on both in the Prometheus text format.
+// Results are cached in memory and, given a diskcache.Cache, the ones
+// that were slow to compute are kept on disk, so that they survive a
+// restart.
+package mathservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/nisatyap/golearn/diskcache"
+	"github.com/nisatyap/golearn/mathops"
+	"github.com/nisatyap/golearn/memo"
+	"github.com/nisatyap/shared/middleware"
+)
+
+// Defaults for the zero Options
+const (
+	DefaultMaxN        = 10_000
+	DefaultMaxLimit    = 1_000_000
+	DefaultCacheSize   = 256
+	DefaultDiskMinCost = 10 * time.Millisecond
+	defaultInFlightPer = 2 // requests computing at once, per CPU
+)
+
+// Options configure a Service
+type Options struct {
+	// MaxN caps n for /factorial and /fibonacci; 0 means DefaultMaxN
+	MaxN int
+	// MaxLimit caps the limit for /primes; 0 means DefaultMaxLimit
+	MaxLimit int
+	// MaxInFlight caps the requests computing at once, past which the
+	// service answers 503; 0 means twice GOMAXPROCS
+	MaxInFlight int
+	// CacheSize is how many factorials and Fibonacci numbers to keep for
+	// repeated requests; 0 means DefaultCacheSize
+	CacheSize int
+	// Disk, if not nil, keeps the results that took DiskMinCost or more
+	// to compute, for this run and later ones
+	Disk *diskcache.Cache
+	// DiskMinCost is how long a result must take to compute to be kept on
+	// Disk; 0 means DefaultDiskMinCost
+	DiskMinCost time.Duration
+	// HTTPMetrics, if not nil, are served on GET /metrics with the
+	// service's own; the server wraps its handler in
+	// HTTPMetrics.Middleware
+	HTTPMetrics *middleware.Metrics
+}
+
+// Service answers math requests
+type Service struct {
+	opts      Options
+	inFlight  chan struct{}
+	factorial func(int) *big.Int
+	fibonacci func(int) *big.Int
+	primes    func(int) []int
+	metrics   *metrics
+}
+
+// New creates a Service
+func New(opts Options) *Service {
+	if opts.MaxN <= 0 {
+		opts.MaxN = DefaultMaxN
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = DefaultMaxLimit
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = defaultInFlightPer * runtime.GOMAXPROCS(0)
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = DefaultCacheSize
+	}
+	if opts.DiskMinCost <= 0 {
+		opts.DiskMinCost = DefaultDiskMinCost
+	}
+	factorial, fibonacci, primes := mathops.ParallelFactorialBig, mathops.FibonacciBig, mathops.Sieve
+	if opts.Disk != nil {
+		factorial = diskcache.Func(opts.Disk, "factorial", diskcache.BigInt, opts.DiskMinCost, factorial)
+		fibonacci = diskcache.Func(opts.Disk, "fibonacci", diskcache.BigInt, opts.DiskMinCost, fibonacci)
+		primes = diskcache.Func(opts.Disk, "primes", diskcache.Ints, opts.DiskMinCost, primes)
+	}
+	cacheOpts := memo.Options{Size: opts.CacheSize, Concurrent: true}
+	factorial, factorials := memo.Func(factorial, cacheOpts)
+	fibonacci, fibonaccis := memo.Func(fibonacci, cacheOpts)
+	s := &Service{
+		opts:      opts,
+		inFlight:  make(chan struct{}, opts.MaxInFlight),
+		factorial: factorial,
+		fibonacci: fibonacci,
+		primes:    primes,
+	}
+	caches := map[string]cacheStats{"factorial": factorials.Stats, "fibonacci": fibonaccis.Stats}
+	s.metrics = newMetrics(caches, func() int { return len(s.inFlight) })
+	if opts.Disk != nil {
+		s.metrics.disk = opts.Disk.Stats
+	}
+	return s
+}
+
+// Register adds the service's routes to mux
+func (s *Service) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /health", s.Health)
+	mux.Handle("GET /healthz", middleware.Healthz(nil))
+	mux.Handle("GET /metrics", s.opts.HTTPMetrics.Handler(s.metrics))
+	mux.HandleFunc("GET /factorial", s.instrument("factorial", s.Factorial))
+	mux.HandleFunc("GET /fibonacci", s.instrument("fibonacci", s.Fibonacci))
+	mux.HandleFunc("GET /primes", s.instrument("primes", s.Primes))
+}
+
+// numberResponse is the result of a function of n
+type numberResponse struct {
+	N      int      `json:"n"`
+	Result *big.Int `json:"result"`
+}
+
+// primesResponse lists the primes up to a limit
+type primesResponse struct {
+	Limit  int   `json:"limit"`
+	Count  int   `json:"count"`
+	Primes []int `json:"primes"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Health reports that the service is up
+func (s *Service) Health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Factorial handles GET /factorial?n=N
+func (s *Service) Factorial(w http.ResponseWriter, r *http.Request) {
+	n, ok := intParam(w, r, "n", s.opts.MaxN)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, numberResponse{N: n, Result: s.factorial(n)})
+}
+
+// Fibonacci handles GET /fibonacci?n=N
+func (s *Service) Fibonacci(w http.ResponseWriter, r *http.Request) {
+	n, ok := intParam(w, r, "n", s.opts.MaxN)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, numberResponse{N: n, Result: s.fibonacci(n)})
+}
+
+// Primes handles GET /primes?limit=N
+func (s *Service) Primes(w http.ResponseWriter, r *http.Request) {
+	limit, ok := intParam(w, r, "limit", s.opts.MaxLimit)
+	if !ok {
+		return
+	}
+	primes := s.primes(limit)
+	if len(primes) == 0 {
+		primes = []int{}
+	}
+	writeJSON(w, http.StatusOK, primesResponse{Limit: limit, Count: len(primes), Primes: primes})
+}
+
+// instrument counts and times the requests to the endpoint called name,
+// and turns them away with 503 while MaxInFlight others are computing
+func (s *Service) instrument(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		select {
+		case s.inFlight <- struct{}{}:
+			// Deferred, so a handler that panics doesn't keep its slot
+			defer func() { <-s.inFlight }()
+			next(rec, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeJSON(rec, http.StatusServiceUnavailable, errorResponse{"too many requests in progress; try again shortly"})
+		}
+		s.metrics.observe(name, rec.status, time.Since(start))
+	}
+}
+
+// intParam reads the query parameter called name as an int from 0 to max,
+// answering 400 and returning false if it isn't one
+func intParam(w http.ResponseWriter, r *http.Request, name string, max int) (int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{fmt.Sprintf("missing %s parameter", name)})
+		return 0, false
+	}
+	n, err := strconv.Atoi(raw)
+	switch {
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, errorResponse{fmt.Sprintf("%s must be a whole number, not %q", name, raw)})
+		return 0, false
+	case n < 0 || n > max:
+		writeJSON(w, http.StatusBadRequest, errorResponse{fmt.Sprintf("%s must be from 0 to %d", name, max)})
+		return 0, false
+	}
+	return n, true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// statusRecorder remembers the status a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,201 @@
+package mathservice
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/golearn/diskcache"
+)
+
+func newServer(t *testing.T, opts Options) (*Service, *httptest.Server) {
+	t.Helper()
+	s := New(opts)
+	mux := http.NewServeMux()
+	s.Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestEndpoints(t *testing.T) {
+	_, srv := newServer(t, Options{MaxN: 100, MaxLimit: 50})
+	for _, c := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/factorial?n=20", 200, `{"n":20,"result":2432902008176640000}`},
+		{"/factorial?n=0", 200, `{"n":0,"result":1}`},
+		{"/factorial?n=25", 200, `{"n":25,"result":15511210043330985984000000}`},
+		{"/fibonacci?n=100", 200, `{"n":100,"result":354224848179261915075}`},
+		{"/primes?limit=10", 200, `{"limit":10,"count":4,"primes":[2,3,5,7]}`},
+		{"/primes?limit=1", 200, `{"limit":1,"count":0,"primes":[]}`},
+		{"/factorial", 400, `{"error":"missing n parameter"}`},
+		{"/factorial?n=abc", 400, `{"error":"n must be a whole number, not \"abc\""}`},
+		{"/fibonacci?n=-1", 400, `{"error":"n must be from 0 to 100"}`},
+		{"/fibonacci?n=101", 400, `{"error":"n must be from 0 to 100"}`},
+		{"/primes?limit=51", 400, `{"error":"limit must be from 0 to 50"}`},
+		{"/health", 200, `{"status":"ok"}`},
+		{"/healthz", 200, `{"status":"ok"}`},
+	} {
+		code, body := get(t, srv.URL+c.path)
+		if code != c.code || strings.TrimSpace(body) != c.want {
+			t.Errorf("GET %s = %d %s, want %d %s", c.path, code, body, c.code, c.want)
+		}
+	}
+	resp, err := http.Post(srv.URL+"/factorial?n=3", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /factorial = %d", resp.StatusCode)
+	}
+}
+
+func TestInFlightLimit(t *testing.T) {
+	s := New(Options{MaxInFlight: 1})
+	s.inFlight <- struct{}{} // a request in progress
+	rec := httptest.NewRecorder()
+	s.instrument("factorial", s.Factorial)(rec, httptest.NewRequest("GET", "/factorial?n=5", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("a request over the limit got %d, headers %v", rec.Code, rec.Header())
+	}
+	<-s.inFlight
+	rec = httptest.NewRecorder()
+	s.instrument("factorial", s.Factorial)(rec, httptest.NewRequest("GET", "/factorial?n=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("a request under the limit got %d", rec.Code)
+	}
+}
+
+func TestInFlightPanic(t *testing.T) {
+	s := New(Options{MaxInFlight: 1})
+	panics := s.instrument("factorial", func(http.ResponseWriter, *http.Request) { panic("boom") })
+	func() {
+		defer func() { recover() }() // as net/http does
+		panics(httptest.NewRecorder(), httptest.NewRequest("GET", "/factorial?n=5", nil))
+	}()
+	if n := len(s.inFlight); n != 0 {
+		t.Fatalf("%d requests in flight after a panic", n)
+	}
+	rec := httptest.NewRecorder()
+	s.instrument("factorial", s.Factorial)(rec, httptest.NewRequest("GET", "/factorial?n=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("a request after a panic got %d", rec.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	_, srv := newServer(t, Options{})
+	get(t, srv.URL+"/factorial?n=30")
+	get(t, srv.URL+"/factorial?n=30")
+	get(t, srv.URL+"/factorial?n=x")
+	get(t, srv.URL+"/primes?limit=100")
+	code, body := get(t, srv.URL+"/metrics")
+	if code != 200 {
+		t.Fatalf("GET /metrics = %d", code)
+	}
+	for _, want := range []string{
+		`mathd_requests_total{code="200",endpoint="factorial"} 2`,
+		`mathd_requests_total{code="400",endpoint="factorial"} 1`,
+		`mathd_requests_total{code="200",endpoint="primes"} 1`,
+		`mathd_request_duration_seconds_count{endpoint="factorial"} 3`,
+		`mathd_request_duration_seconds_bucket{endpoint="primes",le="+Inf"} 1`,
+		`mathd_requests_in_flight 0`,
+		`mathd_cache_hits_total{function="factorial"} 1`,
+		`mathd_cache_misses_total{function="factorial"} 1`,
+		`mathd_cache_entries{function="fibonacci"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s:\n%s", want, body)
+		}
+	}
+}
+
+// The cached results are shared, so a response must not change them
+func TestCachedResultsUnchanged(t *testing.T) {
+	_, srv := newServer(t, Options{})
+	var first, second numberResponse
+	for _, r := range []*numberResponse{&first, &second} {
+		_, body := get(t, srv.URL+"/fibonacci?n=500")
+		if err := json.Unmarshal([]byte(body), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.Result.Cmp(second.Result) != 0 {
+		t.Errorf("cached fibonacci(500) changed from %s to %s", first.Result, second.Result)
+	}
+}
+
+// With a disk cache, a restarted service reads its results back
+func TestDiskCache(t *testing.T) {
+	disk, err := diskcache.Open(t.TempDir(), diskcache.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, srv := newServer(t, Options{Disk: disk, DiskMinCost: time.Nanosecond})
+	_, first := get(t, srv.URL+"/factorial?n=300")
+	get(t, srv.URL+"/primes?limit=100")
+
+	_, srv = newServer(t, Options{Disk: disk, DiskMinCost: time.Nanosecond})
+	_, second := get(t, srv.URL+"/factorial?n=300")
+	if first != second {
+		t.Errorf("factorial from disk = %s, want %s", second, first)
+	}
+	get(t, srv.URL+"/primes?limit=1")
+	if _, body := get(t, srv.URL+"/primes?limit=1"); strings.TrimSpace(body) != `{"limit":1,"count":0,"primes":[]}` {
+		t.Errorf("no primes from disk = %s", body)
+	}
+	_, body := get(t, srv.URL+"/metrics")
+	for _, want := range []string{
+		"mathd_disk_cache_hits_total 2",
+		"mathd_disk_cache_misses_total 3",
+		"mathd_disk_cache_errors_total 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s:\n%s", want, body)
+		}
+	}
+}
+
+// Results quicker to compute than DiskMinCost aren't kept on disk
+func TestDiskMinCost(t *testing.T) {
+	dir := t.TempDir()
+	disk, err := diskcache.Open(dir, diskcache.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, srv := newServer(t, Options{Disk: disk, DiskMinCost: time.Hour})
+	get(t, srv.URL+"/factorial?n=300")
+	get(t, srv.URL+"/primes?limit=100")
+	if _, err := os.Stat(filepath.Join(dir, "factorial", "300")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a cheap factorial was kept on disk: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "primes", "100")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("cheap primes were kept on disk: %v", err)
+	}
+}
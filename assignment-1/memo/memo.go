@@ -0,0 +1,154 @@
+// Package memo caches the results of expensive functions, such as
+// mathops.FibonacciBig or mathops.IsPrime, so that repeated calls don't
+// compute them again.
+//
+// A Cache is size-bounded: once full it evicts the least recently used
+// result. It keeps hit, miss and eviction counts for tuning its size.
+package memo
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultSize is the number of results a Cache keeps unless told otherwise
+const DefaultSize = 1024
+
+// Options configure a Cache
+type Options struct {
+	// Size is how many results the cache keeps; 0 means DefaultSize
+	Size int
+	// Concurrent makes the cache safe to use from several goroutines, at
+	// the cost of a lock on every call
+	Concurrent bool
+}
+
+// Stats counts how a Cache has been used
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Len is how many results the cache holds now
+	Len int
+}
+
+// HitRate returns the fraction of lookups that found a result, 0 if
+// there have been none
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Cache is a least-recently-used cache of the values for keys
+type Cache[K comparable, V any] struct {
+	mu         sync.Mutex
+	concurrent bool
+	size       int
+	order      *list.List // of *entry[K, V], the most recently used first
+	entries    map[K]*list.Element
+	stats      Stats
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New creates an empty Cache
+func New[K comparable, V any](opts Options) *Cache[K, V] {
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+	return &Cache[K, V]{
+		concurrent: opts.Concurrent,
+		size:       opts.Size,
+		order:      list.New(),
+		entries:    make(map[K]*list.Element),
+	}
+}
+
+// Func returns a version of f that caches its results in a new Cache,
+// along with the Cache for its Stats. f must be a pure function: the same
+// key must always give the same value. Callers share the cached values,
+// so they must not modify ones that are pointers, such as a *big.Int.
+func Func[K comparable, V any](f func(K) V, opts Options) (func(K) V, *Cache[K, V]) {
+	c := New[K, V](opts)
+	return func(key K) V { return c.Do(key, f) }, c
+}
+
+// Get returns the value cached for key, if there is one
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.lock()
+	defer c.unlock()
+	if e, ok := c.entries[key]; ok {
+		c.stats.Hits++
+		c.order.MoveToFront(e)
+		return e.Value.(*entry[K, V]).value, true
+	}
+	c.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Put caches value for key, evicting the least recently used value if the
+// cache is full
+func (c *Cache[K, V]) Put(key K, value V) {
+	c.lock()
+	defer c.unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key, value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*entry[K, V])
+		delete(c.entries, oldest.key)
+		c.stats.Evictions++
+	}
+}
+
+// Do returns the value cached for key, or calls f to compute and cache
+// it. Concurrent callers that miss on the same key may each call f; f
+// runs without the lock held, so it may use the cache itself, as a
+// recursive function does.
+func (c *Cache[K, V]) Do(key K, f func(K) V) V {
+	if value, ok := c.Get(key); ok {
+		return value
+	}
+	value := f(key)
+	c.Put(key, value)
+	return value
+}
+
+// Stats returns the cache's counts so far
+func (c *Cache[K, V]) Stats() Stats {
+	c.lock()
+	defer c.unlock()
+	s := c.stats
+	s.Len = c.order.Len()
+	return s
+}
+
+// Reset empties the cache and zeroes its counts
+func (c *Cache[K, V]) Reset() {
+	c.lock()
+	defer c.unlock()
+	c.order.Init()
+	clear(c.entries)
+	c.stats = Stats{}
+}
+
+func (c *Cache[K, V]) lock() {
+	if c.concurrent {
+		c.mu.Lock()
+	}
+}
+
+func (c *Cache[K, V]) unlock() {
+	if c.concurrent {
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,112 @@
+package memo
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/nisatyap/golearn/mathops"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c := New[int, string](Options{Size: 2})
+	c.Put(1, "one")
+	c.Put(2, "two")
+	c.Get(1) // 2 is now the least recently used
+	c.Put(3, "three")
+	if _, ok := c.Get(2); ok {
+		t.Error("2 should have been evicted")
+	}
+	for k, want := range map[int]string{1: "one", 3: "three"} {
+		if got, ok := c.Get(k); !ok || got != want {
+			t.Errorf("Get(%d) = %q, %t; want %q", k, got, ok, want)
+		}
+	}
+	c.Put(3, "drei")
+	if got, _ := c.Get(3); got != "drei" {
+		t.Errorf("Get(3) after replacing = %q", got)
+	}
+	want := Stats{Hits: 4, Misses: 1, Evictions: 1, Len: 2}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got := c.Stats().HitRate(); got != 0.8 {
+		t.Errorf("HitRate() = %g, want 0.8", got)
+	}
+	c.Reset()
+	if got := c.Stats(); got != (Stats{}) {
+		t.Errorf("Stats() after Reset = %+v", got)
+	}
+	if got := New[int, int](Options{}).size; got != DefaultSize {
+		t.Errorf("default size = %d", got)
+	}
+}
+
+func TestFunc(t *testing.T) {
+	calls := 0
+	square := func(n int) int {
+		calls++
+		return n * n
+	}
+	f, c := Func(square, Options{Size: 10})
+	for range 3 {
+		for n := range 5 {
+			if got := f(n); got != n*n {
+				t.Fatalf("f(%d) = %d", n, got)
+			}
+		}
+	}
+	if calls != 5 {
+		t.Errorf("square ran %d times, want 5", calls)
+	}
+	if s := c.Stats(); s.Hits != 10 || s.Misses != 5 || s.Len != 5 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+// A recursive function can cache its own subproblems through Do
+func TestRecursive(t *testing.T) {
+	c := New[int, int](Options{})
+	var fib func(int) int
+	fib = func(n int) int {
+		if n < 2 {
+			return n
+		}
+		return c.Do(n-1, fib) + c.Do(n-2, fib)
+	}
+	if got := fib(90); got != mathops.Fibonacci(90) {
+		t.Errorf("fib(90) = %d", got)
+	}
+}
+
+// Run with -race
+func TestConcurrent(t *testing.T) {
+	isPrime, c := Func(mathops.IsPrime, Options{Size: 100, Concurrent: true})
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range uint64(500) {
+				if isPrime(n+uint64(g)) != mathops.IsPrime(n+uint64(g)) {
+					t.Errorf("isPrime(%d) is wrong", n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s := c.Stats(); s.Len != 100 || s.Hits+s.Misses != 8*500 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func ExampleFunc() {
+	fibonacci, cache := Func(mathops.FibonacciBig, Options{Size: 100})
+	fmt.Println(fibonacci(100))
+	fmt.Println(fibonacci(100))
+	fmt.Printf("%+v\n", cache.Stats())
+	// Output:
+	// 354224848179261915075
+	// 354224848179261915075
+	// {Hits:1 Misses:1 Evictions:0 Len:1}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nisatyap/golearn/mathops"
+)
+
+// operation is a computation the program runs on each number it is given
+type operation struct {
+	// name labels the results in tables and JSON
+	name string
+	// title is the function as the results are written, e.g. "Factorial"
+	title string
+	// command runs just this operation in the REPL, e.g. "fact 10"
+	command string
+	apply   func(n int) (any, error)
+}
+
+// operations are the computations, in the order they are shown
+var operations = []operation{
+	{"factorial", "Factorial", "fact", factorial},
+	{"fibonacci", "Fibonacci", "fib", fibonacci},
+	{"prime", "IsPrime", "prime", isPrime},
+}
+
+func factorial(n int) (any, error) {
+	return mathops.FactorialChecked(n)
+}
+
+// maxBigFibonacci is the largest n fibonacci computes as a big.Int, the
+// same as mathd's default -max-n: beyond it the time and memory grow
+// without bound
+const maxBigFibonacci = 10_000
+
+func fibonacci(n int) (any, error) {
+	f, err := mathops.FibonacciChecked(n)
+	if errors.Is(err, mathops.ErrOverflow) {
+		if n > maxBigFibonacci {
+			return nil, fmt.Errorf("%w: n must be at most %d", mathops.ErrOverflow, maxBigFibonacci)
+		}
+		// Too big for an int, but not for a big.Int
+		return mathops.FibonacciBig(n), nil
+	}
+	return f, err
+}
+
+func isPrime(n int) (any, error) {
+	return n > 1 && mathops.IsPrime(uint64(n)), nil
+}
@@ -0,0 +1,200 @@
+// Package rational does exact arithmetic on fractions of int64s.
+//
+// A Rat is always in lowest terms with a positive denominator, so equal
+// fractions are equal values and can be compared with ==. The arithmetic
+// is done exactly with math/big and fails with an error wrapping
+// ErrOverflow only if the result itself doesn't fit.
+package rational
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Errors, wrapped with the call that failed
+var (
+	ErrZeroDenominator = errors.New("zero denominator")
+	ErrOverflow        = errors.New("result doesn't fit in an int64 fraction")
+	ErrSyntax          = errors.New("not a fraction")
+)
+
+// Rat is the fraction Num/Den. The zero value is 0/0, which is not a
+// fraction; make Rats with New, Int or Parse.
+type Rat struct {
+	Num int64
+	Den int64
+}
+
+// Zero and One, as Rats
+var (
+	Zero = Rat{0, 1}
+	One  = Rat{1, 1}
+)
+
+// Simplify reduces num/den to lowest terms with a positive denominator,
+// e.g. 6/-8 to -3/4
+func Simplify(num, den int64) (int64, int64, error) {
+	r, err := New(num, den)
+	if err != nil {
+		return 0, 0, err
+	}
+	return r.Num, r.Den, nil
+}
+
+// New returns the fraction num/den in lowest terms
+func New(num, den int64) (Rat, error) {
+	if den == 0 {
+		return Rat{}, fmt.Errorf("%d/%d: %w", num, den, ErrZeroDenominator)
+	}
+	r, err := fromBig(big.NewRat(num, den))
+	if err != nil {
+		return Rat{}, fmt.Errorf("%d/%d: %w", num, den, err)
+	}
+	return r, nil
+}
+
+// Int returns n as a fraction
+func Int(n int64) Rat {
+	return Rat{n, 1}
+}
+
+// Add returns r + s
+func (r Rat) Add(s Rat) (Rat, error) {
+	return r.apply("+", s, (*big.Rat).Add)
+}
+
+// Sub returns r - s
+func (r Rat) Sub(s Rat) (Rat, error) {
+	return r.apply("-", s, (*big.Rat).Sub)
+}
+
+// Mul returns r * s
+func (r Rat) Mul(s Rat) (Rat, error) {
+	return r.apply("*", s, (*big.Rat).Mul)
+}
+
+// Div returns r / s, or an error wrapping ErrZeroDenominator if s is 0
+func (r Rat) Div(s Rat) (Rat, error) {
+	if s.Num == 0 {
+		return Rat{}, fmt.Errorf("%v / %v: %w", r, s, ErrZeroDenominator)
+	}
+	return r.apply("/", s, (*big.Rat).Quo)
+}
+
+// Neg returns -r, or an error wrapping ErrOverflow for a numerator of
+// math.MinInt64
+func (r Rat) Neg() (Rat, error) {
+	return Zero.Sub(r)
+}
+
+// Compare returns -1, 0 or +1 as r is less than, equal to or greater
+// than s. It never overflows.
+func Compare(r, s Rat) int {
+	return r.Big().Cmp(s.Big())
+}
+
+// Sign returns -1, 0 or +1 as r is negative, zero or positive
+func (r Rat) Sign() int {
+	switch {
+	case r.Num < 0:
+		return -1
+	case r.Num > 0:
+		return 1
+	}
+	return 0
+}
+
+// IsInt reports whether r is a whole number
+func (r Rat) IsInt() bool {
+	return r.Den == 1
+}
+
+// Float64 returns the nearest float64 to r
+func (r Rat) Float64() float64 {
+	f, _ := r.Big().Float64()
+	return f
+}
+
+// Big returns r as a big.Rat
+func (r Rat) Big() *big.Rat {
+	return big.NewRat(r.Num, r.Den)
+}
+
+// String formats r as "num/den", or just "num" for a whole number
+func (r Rat) String() string {
+	if r.IsInt() {
+		return fmt.Sprint(r.Num)
+	}
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+// Mixed formats r as a mixed number such as "-1 1/2", with the whole part
+// and the proper fraction that remains
+func (r Rat) Mixed() string {
+	whole, rem := r.Num/r.Den, r.Num%r.Den
+	switch {
+	case rem == 0:
+		return fmt.Sprint(whole)
+	case whole == 0:
+		return r.String()
+	case rem < 0:
+		rem = -rem
+	}
+	return fmt.Sprintf("%d %d/%d", whole, rem, r.Den)
+}
+
+// Decimal formats r as a decimal with prec digits after the point, the
+// last one rounded half away from zero, e.g. 2/3 as "0.667" for prec 3
+func (r Rat) Decimal(prec int) string {
+	return r.Big().FloatString(prec)
+}
+
+// Parse reads a fraction written as by String or Mixed, or as a decimal:
+// "3/4", "-7", "1 1/2", "-1 1/2" or "0.75"
+func Parse(s string) (Rat, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, mixed := strings.Cut(s, " ")
+	var sum big.Rat
+	if mixed {
+		w, ok := new(big.Int).SetString(whole, 10)
+		f, fok := new(big.Rat).SetString(strings.TrimSpace(frac))
+		// The fraction of a mixed number is proper, with no sign or point
+		if !ok || strings.ContainsAny(frac, "+-.eE") || !fok || f.Cmp(big.NewRat(1, 1)) >= 0 || f.Sign() == 0 {
+			return Rat{}, fmt.Errorf("parse %q: %w", s, ErrSyntax)
+		}
+		if w.Sign() < 0 || strings.HasPrefix(whole, "-") {
+			f.Neg(f)
+		}
+		sum.Add(new(big.Rat).SetInt(w), f)
+	} else if strings.ContainsAny(s, "eE") {
+		// big.Rat accepts exponents, but would spend a long time on 1e999999999
+		return Rat{}, fmt.Errorf("parse %q: %w", s, ErrSyntax)
+	} else if _, ok := sum.SetString(s); !ok {
+		return Rat{}, fmt.Errorf("parse %q: %w", s, ErrSyntax)
+	}
+	r, err := fromBig(&sum)
+	if err != nil {
+		return Rat{}, fmt.Errorf("parse %q: %w", s, err)
+	}
+	return r, nil
+}
+
+// apply returns the result of op on r and s, as "r <symbol> s" if it fails
+func (r Rat) apply(symbol string, s Rat, op func(z, x, y *big.Rat) *big.Rat) (Rat, error) {
+	result, err := fromBig(op(new(big.Rat), r.Big(), s.Big()))
+	if err != nil {
+		return Rat{}, fmt.Errorf("%v %s %v: %w", r, symbol, s, err)
+	}
+	return result, nil
+}
+
+// fromBig converts x, which big.Rat keeps in lowest terms with a positive
+// denominator, to a Rat
+func fromBig(x *big.Rat) (Rat, error) {
+	if !x.Num().IsInt64() || !x.Denom().IsInt64() {
+		return Rat{}, ErrOverflow
+	}
+	return Rat{x.Num().Int64(), x.Denom().Int64()}, nil
+}
@@ -0,0 +1,154 @@
+package rational
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func mustNew(t *testing.T, num, den int64) Rat {
+	t.Helper()
+	r, err := New(num, den)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSimplify(t *testing.T) {
+	for _, c := range []struct{ num, den, wantNum, wantDen int64 }{
+		{6, 8, 3, 4},
+		{6, -8, -3, 4},
+		{-6, -8, 3, 4},
+		{0, -5, 0, 1},
+		{7, 1, 7, 1},
+		{math.MaxInt64, math.MaxInt64, 1, 1},
+		{math.MinInt64, 2, math.MinInt64 / 2, 1},
+	} {
+		if num, den, err := Simplify(c.num, c.den); err != nil || num != c.wantNum || den != c.wantDen {
+			t.Errorf("Simplify(%d, %d) = %d, %d, %v; want %d, %d", c.num, c.den, num, den, err, c.wantNum, c.wantDen)
+		}
+	}
+	if _, _, err := Simplify(1, 0); !errors.Is(err, ErrZeroDenominator) {
+		t.Errorf("Simplify(1, 0) error = %v", err)
+	}
+	// Making the denominator positive would overflow
+	if _, _, err := Simplify(1, math.MinInt64); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Simplify(1, MinInt64) error = %v", err)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	half, third := mustNew(t, 1, 2), mustNew(t, 1, 3)
+	for _, c := range []struct {
+		name string
+		f    func(Rat) (Rat, error)
+		arg  Rat
+		want Rat
+	}{
+		{"1/2 + 1/3", half.Add, third, Rat{5, 6}},
+		{"1/2 - 1/3", half.Sub, third, Rat{1, 6}},
+		{"1/3 - 1/2", third.Sub, half, Rat{-1, 6}},
+		{"1/2 * 1/3", half.Mul, third, Rat{1, 6}},
+		{"1/2 / 1/3", half.Div, third, Rat{3, 2}},
+		{"1/2 + 1/2", half.Add, half, One},
+		{"1/2 - 1/2", half.Sub, half, Zero},
+		// Intermediate products overflow int64, the result doesn't
+		{"big + small", Rat{math.MaxInt64 - 1, math.MaxInt64}.Add, Rat{1, math.MaxInt64}, One},
+	} {
+		if got, err := c.f(c.arg); err != nil || got != c.want {
+			t.Errorf("%s = %v, %v; want %v", c.name, got, err, c.want)
+		}
+	}
+	if _, err := Int(math.MaxInt64).Add(One); !errors.Is(err, ErrOverflow) {
+		t.Errorf("MaxInt64 + 1 error = %v", err)
+	}
+	if _, err := half.Div(Zero); !errors.Is(err, ErrZeroDenominator) {
+		t.Errorf("1/2 / 0 error = %v", err)
+	}
+	if got, err := half.Neg(); err != nil || got != (Rat{-1, 2}) {
+		t.Errorf("-(1/2) = %v, %v", got, err)
+	}
+	if _, err := Int(math.MinInt64).Neg(); !errors.Is(err, ErrOverflow) {
+		t.Errorf("-MinInt64 error = %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	for _, c := range []struct {
+		r, s Rat
+		want int
+	}{
+		{Rat{1, 3}, Rat{1, 2}, -1},
+		{Rat{1, 2}, Rat{1, 2}, 0},
+		{Rat{-1, 2}, Rat{-2, 3}, 1},
+		// Cross-multiplying these in int64 would overflow
+		{Rat{math.MaxInt64 - 1, math.MaxInt64}, Rat{math.MaxInt64 - 2, math.MaxInt64 - 1}, 1},
+	} {
+		if got := Compare(c.r, c.s); got != c.want {
+			t.Errorf("Compare(%v, %v) = %d, want %d", c.r, c.s, got, c.want)
+		}
+	}
+	if Int(-3).Sign() != -1 || Zero.Sign() != 0 || One.Sign() != 1 {
+		t.Error("Sign is wrong")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, c := range []struct {
+		r                   Rat
+		str, mixed, decimal string
+	}{
+		{Rat{3, 4}, "3/4", "3/4", "0.750"},
+		{Rat{-3, 4}, "-3/4", "-3/4", "-0.750"},
+		{Rat{7, 2}, "7/2", "3 1/2", "3.500"},
+		{Rat{-7, 2}, "-7/2", "-3 1/2", "-3.500"},
+		{Rat{2, 3}, "2/3", "2/3", "0.667"},
+		{Rat{5, 1}, "5", "5", "5.000"},
+		{Zero, "0", "0", "0.000"},
+	} {
+		if got := c.r.String(); got != c.str {
+			t.Errorf("%#v.String() = %q, want %q", c.r, got, c.str)
+		}
+		if got := c.r.Mixed(); got != c.mixed {
+			t.Errorf("%v.Mixed() = %q, want %q", c.r, got, c.mixed)
+		}
+		if got := c.r.Decimal(3); got != c.decimal {
+			t.Errorf("%v.Decimal(3) = %q, want %q", c.r, got, c.decimal)
+		}
+		for _, s := range []string{c.str, c.mixed} {
+			if got, err := Parse(s); err != nil || got != c.r {
+				t.Errorf("Parse(%q) = %v, %v; want %v", s, got, err, c.r)
+			}
+		}
+	}
+	if got := (Rat{1, 3}).Float64(); got != 1.0/3 {
+		t.Errorf("1/3 as a float64 = %v", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for s, want := range map[string]Rat{
+		"0.75":     {3, 4},
+		"-0.5":     {-1, 2},
+		" 6/8 ":    {3, 4},
+		"-0 1/2":   {-1, 2},
+		"10 3/4":   {43, 4},
+		"12":       {12, 1},
+		"1/3":      {1, 3},
+		"+2 1/3":   {7, 3},
+		"000.2500": {1, 4},
+	} {
+		if got, err := Parse(s); err != nil || got != want {
+			t.Errorf("Parse(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "abc", "1/0", "1 3/2", "1 -1/2", "1 0.5", "1 0/2", "1e3", "1/2 1/2", "-12/-16", "9223372036854775808", "1/9223372036854775808"} {
+		if got, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", s, got)
+		}
+	}
+	if _, err := Parse("9223372036854775808"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Parse of 2^63 error = %v, want ErrOverflow", err)
+	}
+}
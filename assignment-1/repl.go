@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nisatyap/golearn/mathops"
+)
+
+// repl is an interactive session, which reads a command a line
+type repl struct {
+	out     io.Writer
+	history []string
+}
+
+// runREPL reads commands from in until "quit" or the end of the input,
+// writing the prompts, results and errors to out, and returns the exit
+// code. Bad input is explained, and the session goes on.
+func runREPL(in io.Reader, out io.Writer) int {
+	r := &repl{out: out}
+	fmt.Fprintln(out, `Type a number to see all its results, "fact 10" for one, an expression such as "fib(20) % 7", or "help".`)
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return 0
+		}
+		if !r.exec(sc.Text()) {
+			return 0
+		}
+	}
+}
+
+// exec runs one line and reports whether the session goes on
+func (r *repl) exec(line string) bool {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "!") {
+		recalled, err := r.recall(line)
+		if err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+			return true
+		}
+		line = recalled
+		fmt.Fprintln(r.out, line)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	r.history = append(r.history, line)
+
+	switch name, args := fields[0], fields[1:]; name {
+	case "quit", "exit":
+		return false
+	case "help", "?":
+		r.help()
+	case "history":
+		for i, h := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, h)
+		}
+	default:
+		if op, ok := lookupCommand(name); ok {
+			if len(args) == 0 {
+				fmt.Fprintf(r.out, "Usage: %s n ...\n", op.command)
+			}
+			for _, arg := range args {
+				r.run(arg, []operation{op})
+			}
+		} else if allNumbers(fields) {
+			for _, arg := range fields {
+				r.run(arg, operations)
+			}
+		} else if strings.ContainsFunc(line, isExprRune) {
+			r.eval(line)
+		} else {
+			fmt.Fprintf(r.out, "Error: unknown command %q; type help for the commands\n", line)
+		}
+	}
+	return true
+}
+
+// run applies ops to the number arg
+func (r *repl) run(arg string, ops []operation) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %q is not a whole number\n", arg)
+		return
+	}
+	for _, op := range ops {
+		if v, err := op.apply(n); err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		} else {
+			fmt.Fprintf(r.out, "%s(%d) = %v\n", op.title, n, v)
+		}
+	}
+}
+
+// eval evaluates line as an expression, pointing out where it went wrong
+// if it did
+func (r *repl) eval(line string) {
+	v, err := mathops.Eval(line)
+	var e *mathops.EvalError
+	switch {
+	case errors.As(err, &e):
+		fmt.Fprintf(r.out, "Error: %v\n  %s\n  %s^\n", err, line, strings.Repeat(" ", utf8.RuneCountInString(line[:e.Pos])))
+	case err != nil:
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+	default:
+		fmt.Fprintf(r.out, "%s = %d\n", line, v)
+	}
+}
+
+// isExprRune reports whether r marks a line as an expression rather than a
+// mistyped command, which is all letters
+func isExprRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsSpace(r)
+}
+
+// recall returns the line that "!!" (the last) or "!n" (the nth) refers to
+func (r *repl) recall(ref string) (string, error) {
+	i := len(r.history)
+	if ref != "!!" {
+		var err error
+		if i, err = strconv.Atoi(ref[1:]); err != nil {
+			return "", fmt.Errorf("%q: use !! for the last command or !n for the nth", ref)
+		}
+	}
+	if i < 1 || i > len(r.history) {
+		return "", fmt.Errorf("%s: no such command in the history", ref)
+	}
+	return r.history[i-1], nil
+}
+
+func (r *repl) help() {
+	tw := tabwriter.NewWriter(r.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "n ...\tevery result for each n")
+	for _, op := range operations {
+		fmt.Fprintf(tw, "%s n ...\t%s(n) for each n\n", op.command, op.title)
+	}
+	fmt.Fprintf(tw, "fact(5) + 1, ...\tan expression, with + - * / %% ( ) and %s\n", strings.Join(mathops.Funcs(), ", "))
+	fmt.Fprintln(tw, "history\tthe commands so far")
+	fmt.Fprintln(tw, "!!, !n\trun the last, or the nth, command again")
+	fmt.Fprintln(tw, "help\tthis list")
+	fmt.Fprintln(tw, "quit\tend the session (or end the input)")
+	tw.Flush()
+}
+
+// allNumbers reports whether every field is a whole number
+func allNumbers(fields []string) bool {
+	for _, f := range fields {
+		if _, err := strconv.Atoi(f); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupCommand returns the operation that name runs, by its command or
+// its full name
+func lookupCommand(name string) (operation, bool) {
+	for _, op := range operations {
+		if name == op.command || name == op.name {
+			return op, true
+		}
+	}
+	return operation{}, false
+}
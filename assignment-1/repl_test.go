@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	in := strings.Join([]string{
+		"fact 5",
+		"abc",
+		"fib x 10",
+		"",
+		"3 4",
+		"!!",
+		"!1",
+		"!7",
+		"fact(4) * (2 + 1)",
+		"2 ^ 3",
+		"history",
+		"quit",
+		"fact 6", // never read
+	}, "\n")
+	var out bytes.Buffer
+	if code := runREPL(strings.NewReader(in), &out); code != 0 {
+		t.Errorf("runREPL = %d", code)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"> Factorial(5) = 120\n",
+		`Error: unknown command "abc"`,
+		"Error: \"x\" is not a whole number\nFibonacci(10) = 55\n",
+		"IsPrime(3) = true\nFactorial(4) = 24\nFibonacci(4) = 3\nIsPrime(4) = false\n",
+		"> 3 4\nFactorial(3) = 6\n",
+		"> fact 5\nFactorial(5) = 120\n",
+		"Error: !7: no such command in the history",
+		"> fact(4) * (2 + 1) = 72\n",
+		"Error: unexpected character '^' at column 3\n  2 ^ 3\n    ^\n",
+		"   6  fact 5\n   7  fact(4) * (2 + 1)\n   8  2 ^ 3\n   9  history\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("session output lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Factorial(6)") {
+		t.Error("the session went on after quit")
+	}
+}
+
+func TestREPLEndOfInput(t *testing.T) {
+	var out bytes.Buffer
+	if code := runREPL(strings.NewReader("help"), &out); code != 0 || !strings.Contains(out.String(), "fact n ...") {
+		t.Errorf("runREPL = %d, %q", code, out.String())
+	}
+}
@@ -0,0 +1,152 @@
+// Package stats provides descriptive statistics over float64 samples.
+//
+// The functions never modify the slices they are given. An empty sample
+// has no statistics, and they return an error wrapping ErrEmpty for one.
+// Median and Percentile, which order the sample, reject one containing a
+// NaN with an error wrapping ErrNaN; for the others a NaN makes the results
+// meaningless.
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Errors, wrapped with the call that failed
+var (
+	ErrEmpty = errors.New("empty sample")
+	ErrRange = errors.New("out of range")
+	ErrNaN   = errors.New("sample contains NaN")
+)
+
+// Mean returns the arithmetic mean of xs
+func Mean(xs []float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, fmt.Errorf("Mean: %w", ErrEmpty)
+	}
+	mean, _ := meanAndSquares(xs)
+	return mean, nil
+}
+
+// Median returns the middle value of xs, or the mean of the two middle
+// values if len(xs) is even
+func Median(xs []float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, fmt.Errorf("Median: %w", ErrEmpty)
+	}
+	if slices.ContainsFunc(xs, math.IsNaN) {
+		return 0, fmt.Errorf("Median: %w", ErrNaN)
+	}
+	return Percentile(xs, 50)
+}
+
+// Mode returns the values that occur most often in xs, in increasing
+// order: one value, unless there is a tie
+func Mode(xs []float64) ([]float64, error) {
+	if len(xs) == 0 {
+		return nil, fmt.Errorf("Mode: %w", ErrEmpty)
+	}
+	sorted := sortedCopy(xs)
+	var modes []float64
+	best := 0
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j] == sorted[i] {
+			j++
+		}
+		switch run := j - i; {
+		case run > best:
+			best, modes = run, []float64{sorted[i]}
+		case run == best:
+			modes = append(modes, sorted[i])
+		}
+		i = j
+	}
+	return modes, nil
+}
+
+// Variance returns the population variance of xs: the mean squared
+// distance from the mean. Use SampleVariance to estimate the variance of a
+// population from a sample of it.
+func Variance(xs []float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, fmt.Errorf("Variance: %w", ErrEmpty)
+	}
+	_, squares := meanAndSquares(xs)
+	return squares / float64(len(xs)), nil
+}
+
+// SampleVariance returns the sample variance of xs, which divides by
+// len(xs)-1 rather than len(xs) (Bessel's correction). It needs at least
+// two values.
+func SampleVariance(xs []float64) (float64, error) {
+	if len(xs) < 2 {
+		return 0, fmt.Errorf("SampleVariance: %d values: %w", len(xs), ErrEmpty)
+	}
+	_, squares := meanAndSquares(xs)
+	return squares / float64(len(xs)-1), nil
+}
+
+// StdDev returns the population standard deviation of xs, the square root
+// of Variance
+func StdDev(xs []float64) (float64, error) {
+	v, err := Variance(xs)
+	if err != nil {
+		return 0, fmt.Errorf("StdDev: %w", ErrEmpty)
+	}
+	return math.Sqrt(v), nil
+}
+
+// SampleStdDev returns the sample standard deviation of xs, the square
+// root of SampleVariance
+func SampleStdDev(xs []float64) (float64, error) {
+	v, err := SampleVariance(xs)
+	if err != nil {
+		return 0, fmt.Errorf("SampleStdDev: %d values: %w", len(xs), ErrEmpty)
+	}
+	return math.Sqrt(v), nil
+}
+
+// Percentile returns the pth percentile of xs for p in [0, 100],
+// interpolating linearly between the closest ranks (as spreadsheets'
+// PERCENTILE and NumPy's default do): Percentile(xs, 0) is the minimum,
+// 50 the median and 100 the maximum.
+func Percentile(xs []float64, p float64) (float64, error) {
+	if len(xs) == 0 {
+		return 0, fmt.Errorf("Percentile: %w", ErrEmpty)
+	}
+	if !(p >= 0 && p <= 100) {
+		return 0, fmt.Errorf("Percentile: p = %g: %w", p, ErrRange)
+	}
+	if slices.ContainsFunc(xs, math.IsNaN) {
+		return 0, fmt.Errorf("Percentile: %w", ErrNaN)
+	}
+	sorted := sortedCopy(xs)
+	rank := p / 100 * float64(len(sorted)-1)
+	i := int(rank)
+	if i == len(sorted)-1 {
+		return sorted[i], nil
+	}
+	frac := rank - float64(i)
+	return sorted[i] + frac*(sorted[i+1]-sorted[i]), nil
+}
+
+// meanAndSquares returns the mean of xs and the sum of the squared
+// distances from it, by Welford's method, which stays accurate where
+// summing squares and subtracting would cancel out
+func meanAndSquares(xs []float64) (mean, squares float64) {
+	for i, x := range xs {
+		d := x - mean
+		mean += d / float64(i+1)
+		squares += d * (x - mean)
+	}
+	return mean, squares
+}
+
+func sortedCopy(xs []float64) []float64 {
+	sorted := slices.Clone(xs)
+	slices.Sort(sorted)
+	return sorted
+}
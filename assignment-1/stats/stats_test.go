@@ -0,0 +1,114 @@
+package stats
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestStats(t *testing.T) {
+	xs := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	orig := slices.Clone(xs)
+	for name, c := range map[string]struct {
+		f    func([]float64) (float64, error)
+		want float64
+	}{
+		"Mean":           {Mean, 5},
+		"Median":         {Median, 4.5},
+		"Variance":       {Variance, 4},
+		"StdDev":         {StdDev, 2},
+		"SampleVariance": {SampleVariance, 32.0 / 7},
+		"SampleStdDev":   {SampleStdDev, math.Sqrt(32.0 / 7)},
+	} {
+		if got, err := c.f(xs); err != nil || !near(got, c.want) {
+			t.Errorf("%s = %g, %v; want %g", name, got, err, c.want)
+		}
+		if _, err := c.f(nil); !errors.Is(err, ErrEmpty) {
+			t.Errorf("%s(nil) error = %v, want ErrEmpty", name, err)
+		}
+	}
+	if !slices.Equal(xs, orig) {
+		t.Errorf("sample changed to %v", xs)
+	}
+
+	if got, _ := Median([]float64{3, 1, 2}); got != 2 {
+		t.Errorf("Median(3, 1, 2) = %g", got)
+	}
+	if got, _ := Mean([]float64{-7}); got != -7 {
+		t.Errorf("Mean(-7) = %g", got)
+	}
+	if got, err := Variance([]float64{3}); err != nil || got != 0 {
+		t.Errorf("Variance(3) = %g, %v", got, err)
+	}
+	if _, err := SampleVariance([]float64{3}); !errors.Is(err, ErrEmpty) {
+		t.Errorf("SampleVariance of one value: %v", err)
+	}
+	// Welford's method keeps its accuracy far from zero
+	if got, _ := Variance([]float64{1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16}); !near(got, 22.5) {
+		t.Errorf("Variance of large values = %g, want 22.5", got)
+	}
+}
+
+func TestMode(t *testing.T) {
+	for _, c := range []struct{ xs, want []float64 }{
+		{[]float64{1}, []float64{1}},
+		{[]float64{2, 4, 4, 4, 5, 5, 7, 9}, []float64{4}},
+		{[]float64{3, 1, 3, 1, 2}, []float64{1, 3}},
+		{[]float64{0.5, -1, 2}, []float64{-1, 0.5, 2}},
+	} {
+		if got, err := Mode(c.xs); err != nil || !slices.Equal(got, c.want) {
+			t.Errorf("Mode(%v) = %v, %v; want %v", c.xs, got, err, c.want)
+		}
+	}
+	if _, err := Mode(nil); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Mode(nil) error = %v", err)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	xs := []float64{15, 20, 35, 40, 50}
+	for _, c := range []struct{ p, want float64 }{
+		{0, 15},
+		{25, 20},
+		{40, 29},
+		{50, 35},
+		{90, 46},
+		{100, 50},
+	} {
+		if got, err := Percentile(xs, c.p); err != nil || !near(got, c.want) {
+			t.Errorf("Percentile(%v, %g) = %g, %v; want %g", xs, c.p, got, err, c.want)
+		}
+	}
+	if got, err := Percentile([]float64{42}, 99); err != nil || got != 42 {
+		t.Errorf("Percentile of one value = %g, %v", got, err)
+	}
+	for _, p := range []float64{-1, 100.5, math.NaN()} {
+		if _, err := Percentile(xs, p); !errors.Is(err, ErrRange) {
+			t.Errorf("Percentile(%g) error = %v, want ErrRange", p, err)
+		}
+	}
+}
+
+func TestNaN(t *testing.T) {
+	nan := math.NaN()
+	for _, xs := range [][]float64{
+		{nan},
+		{1, nan, 3},
+		{nan, 2, 3, 4},
+		{1, 2, 3, nan},
+	} {
+		if got, err := Median(xs); !errors.Is(err, ErrNaN) {
+			t.Errorf("Median(%v) = %g, %v; want ErrNaN", xs, got, err)
+		}
+		for _, p := range []float64{0, 50, 100} {
+			if got, err := Percentile(xs, p); !errors.Is(err, ErrNaN) {
+				t.Errorf("Percentile(%v, %g) = %g, %v; want ErrNaN", xs, p, got, err)
+			}
+		}
+	}
+}
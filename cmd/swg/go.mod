@@ -0,0 +1,34 @@
+module github.com/nisatyap/swg
+
+go 1.23.0
+
+require (
+	device-posture-agent v0.0.0
+	device-posture-collector v0.0.0
+	github.com/nisatyap/shared v0.0.0
+	github.com/nisatyap/week2-swg/policy-engine v0.0.0
+	github.com/nisatyap/week2-swg/proxy v0.0.0
+)
+
+require (
+	fyne.io/systray v1.12.0 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/pgx/v5 v5.7.6 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
+	github.com/mattn/go-sqlite3 v1.14.33 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/sync v0.13.0 // indirect
+	golang.org/x/sys v0.32.0 // indirect
+	golang.org/x/text v0.24.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace (
+	device-posture-agent => ../../week1-device-posture-agent/agent
+	device-posture-collector => ../../week1-device-posture-agent/collector
+	github.com/nisatyap/shared => ../../shared
+	github.com/nisatyap/week2-swg/policy-engine => ../../week2-secure-web-gateway/policy-engine
+	github.com/nisatyap/week2-swg/proxy => ../../week2-secure-web-gateway/proxy
+)
@@ -0,0 +1,144 @@
+// Command swg runs any of the zero-trust demo's services from one binary,
+// so that a deployment builds and ships one file:
+//
+//	swg agent run -url http://collector:8000/report
+//	swg collector -listen :8000
+//	swg policy -listen :8001 -insecure-no-auth
+//	swg proxy -policy-url http://localhost:8001/policy
+//
+// Each command takes the same flags, $<PREFIX>_<FLAG> environment variables
+// and -config file as the service's own binary, which keeps working
+// alongside, and logs, serves metrics and health checks the same way.
+//
+// swg up runs several commands in one process, their arguments separated
+// by --, until the first of them exits, then stops the rest as SIGTERM
+// would:
+//
+//	swg up collector -require-auth=false -- policy -listen :8001 -insecure-no-auth -- proxy -policy-url http://localhost:8001/policy
+//
+// Services run together share the in-process event bus, so the proxy
+// quarantines devices on the collector's tamper alerts without either
+// serving or dialling /events. Each keeps its own logger, so every record
+// still names the service that wrote it.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	agent "device-posture-agent/app"
+	collector "device-posture-collector/app"
+
+	"github.com/nisatyap/shared/lifecycle"
+	policy "github.com/nisatyap/week2-swg/policy-engine/app"
+	proxy "github.com/nisatyap/week2-swg/proxy/app"
+)
+
+// command is a service swg runs
+type command struct {
+	name    string
+	summary string
+	main    func(name string, args []string) int
+}
+
+var commands = []command{
+	{"agent", "Device posture agent: collect device health and report it to the collector", agent.Main},
+	{"collector", "Device posture collector: receive reports and issue posture tokens", collector.Main},
+	{"policy", "Policy engine: manage the gateway's rules, categories and blocklists", policy.Main},
+	{"proxy", "Secure web gateway proxy: filter web traffic by policy and device posture", proxy.Main},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run dispatches args to the command they name and returns its exit code
+func run(args []string, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(stderr)
+		return 0
+	}
+	if args[0] == "up" {
+		return up(args[1:], stderr)
+	}
+	if c, ok := lookup(args[0]); ok {
+		return c.main("swg "+c.name, args[1:])
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func lookup(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// up runs the commands args names, each followed by its own arguments and
+// separated by --, in this process until the first exits, then stops the
+// others and returns the first's exit code
+func up(args []string, stderr io.Writer) int {
+	var runs [][]string
+	start := 0
+	for i := 0; i <= len(args); i++ {
+		if i < len(args) && args[i] != "--" {
+			continue
+		}
+		if i == start {
+			fmt.Fprint(stderr, "Usage: swg up <command> [flags] [-- <command> [flags]]...\n")
+			return 2
+		}
+		if _, ok := lookup(args[start]); !ok {
+			fmt.Fprintf(stderr, "unknown command %q\n\n", args[start])
+			usage(stderr)
+			return 2
+		}
+		runs = append(runs, args[start:i])
+		start = i + 1
+	}
+
+	exited := make(chan int, len(runs))
+	for _, r := range runs {
+		c, _ := lookup(r[0])
+		go func() { exited <- c.main("swg "+c.name, r[1:]) }()
+	}
+	// Stop the rest only once every command has started its lifecycle.Run
+	// or exited: StopAll misses a Run started after it
+	code, done := 0, 0
+	for {
+		started, changed := lifecycle.Running()
+		if done > 0 && started+done >= len(runs) {
+			break
+		}
+		select {
+		case c := <-exited:
+			if done == 0 {
+				code = c
+			}
+			done++
+		case <-changed:
+		}
+	}
+	lifecycle.StopAll()
+	for ; done < len(runs); done++ {
+		<-exited
+	}
+	return code
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Usage: swg <command> [flags]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(tw, "  %s\t%s\n", "up", "Run several commands, separated by --, in one process sharing its event bus")
+	tw.Flush()
+	fmt.Fprint(w, "\nRun 'swg <command> -h' for command flags.\n")
+}
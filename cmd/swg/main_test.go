@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/shared/lifecycle"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	if code := run(nil, &out); code != 0 || !strings.Contains(out.String(), "collector") || !strings.Contains(out.String(), "proxy") {
+		t.Errorf("no command: %d %q", code, out.String())
+	}
+	out.Reset()
+	if code := run([]string{"gateway"}, &out); code != 2 || !strings.HasPrefix(out.String(), `unknown command "gateway"`) {
+		t.Errorf("unknown command: %d %q", code, out.String())
+	}
+	if code := run([]string{"proxy", "-no-such-flag"}, &out); code != 2 {
+		t.Errorf("bad proxy flag: %d", code)
+	}
+
+	for _, args := range [][]string{{"up"}, {"up", "collector", "--"}, {"up", "--", "proxy"}, {"up", "collector", "--", "gateway"}} {
+		out.Reset()
+		if code := run(args, &out); code != 2 {
+			t.Errorf("%q: %d %q", args, code, out.String())
+		}
+	}
+	out.Reset()
+	if code := run([]string{"up", "collector", "-print-config", "--", "proxy", "-print-config"}, &out); code != 0 {
+		t.Errorf("up with -print-config: %d %q", code, out.String())
+	}
+}
+
+func TestUpStopsCommandsStartedAfterAnExit(t *testing.T) {
+	// serve runs a service that takes delay to start, until it is stopped
+	serve := func(delay time.Duration) func(string, []string) int {
+		return func(string, []string) int {
+			time.Sleep(delay)
+			run := lifecycle.New(lifecycle.Options{})
+			run.Go("work", func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			})
+			if err := run.Wait(); err != nil {
+				return 1
+			}
+			return 0
+		}
+	}
+	saved := commands
+	defer func() { commands = saved }()
+	commands = []command{
+		{"bad-flags", "", func(string, []string) int { return 2 }},
+		{"fast", "", serve(0)},
+		{"slow", "", serve(100 * time.Millisecond)},
+	}
+
+	code := make(chan int, 1)
+	go func() { code <- up([]string{"slow", "--", "bad-flags", "--", "fast"}, &bytes.Buffer{}) }()
+	select {
+	case c := <-code:
+		if c != 2 {
+			t.Errorf("up = %d, want the early exit's 2", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("up did not stop a command that started after another exited")
+	}
+}
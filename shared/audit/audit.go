@@ -0,0 +1,242 @@
+// Package audit keeps the record of security events across the services:
+// requests the proxy blocked, changes to the policy, devices enrolled and
+// keys issued, and admins signing in, with who did it, from where and when.
+//
+// A Log numbers each event and chains it to the one before with a hash, so
+// an edited or deleted event breaks the chain and Verify finds it. It keeps
+// its events in one Store, which the audit API reads back:
+//
+//   - File, a file of JSON lines, for the proxy and the policy engine
+//   - the collector's database, through its store package
+//
+// and sends a copy of each to its Sinks as well, for archives and SIEMs:
+// syslog (NewSyslog) and HTTP webhooks (NewWebhook).
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/logging"
+)
+
+// Actors for events nobody caused through an API
+const (
+	ActorScheduler = "scheduler" // scheduled jobs, such as blocklist imports
+	ActorAnonymous = "anonymous" // development mode, without an admin token
+)
+
+// Actions more than one service records. Services name their own the same
+// way, object.verb, such as rule.create or policy.rollback.
+const (
+	ActionAdminLogin  = "admin.login"  // an admin's first request in a while
+	ActionAdminDenied = "admin.denied" // a request with a missing or wrong admin credential
+	ActionBlock       = "request.block"
+)
+
+// Outcomes of an event; empty for a change that was made
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// Event is one security event
+type Event struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Service string    `json:"service,omitempty"` // the service that recorded it
+	Tenant  string    `json:"tenant,omitempty"`
+	Actor   string    `json:"actor"`
+	Address string    `json:"address,omitempty"` // where the request came from
+	Action  string    `json:"action"`            // e.g. rule.create or request.block
+	Object  string    `json:"object,omitempty"`  // e.g. "rule 12" or "host example.com"
+	Outcome string    `json:"outcome,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+	Version int64     `json:"version,omitempty"` // the policy version a change left, or a block enforced
+	Prev    string    `json:"prev"`              // hash of the event before
+	Hash    string    `json:"hash"`
+}
+
+// hash returns the event's hash, which covers every field but Hash
+func (e Event) hash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Chain numbers e after last, the event before it or the zero Event, and
+// hashes it. Stores call it as they append.
+func Chain(last, e Event) Event {
+	e.Seq, e.Prev = last.Seq+1, last.Hash
+	e.Hash = e.hash()
+	return e
+}
+
+// Store keeps a Log's events
+type Store interface {
+	// Append chains e to the last event stored, as Chain does, and stores
+	// it
+	Append(ctx context.Context, e Event) (Event, error)
+	// Scan calls fn with each event stored, oldest first, stopping at the
+	// first error
+	Scan(ctx context.Context, fn func(Event) error) error
+}
+
+// Sink receives every event after it is stored, e.g. to forward it to
+// syslog
+type Sink interface {
+	Write(e Event) error
+}
+
+// Filter selects events. Zero fields match everything.
+type Filter struct {
+	Tenant string
+	Actor  string
+	Action string // an action, or a prefix ending in '.' such as "rule."
+	Object string
+	Since  time.Time
+	Until  time.Time // exclusive
+	Limit  int
+}
+
+func (f Filter) match(e Event) bool {
+	switch {
+	case f.Tenant != "" && e.Tenant != f.Tenant:
+		return false
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case f.Action != "" && e.Action != f.Action && !(strings.HasSuffix(f.Action, ".") && strings.HasPrefix(e.Action, f.Action)):
+		return false
+	case f.Object != "" && e.Object != f.Object:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Log records a service's events in a Store and sends them to its Sinks.
+// A nil Log records nothing.
+type Log struct {
+	service string
+	store   Store
+	now     func() time.Time
+
+	mu    sync.Mutex
+	sinks []Sink
+}
+
+// New returns a Log keeping the events of service in store
+func New(service string, store Store) *Log {
+	return &Log{service: service, store: store, now: time.Now}
+}
+
+// AddSink sends every event recorded from now on to s as well
+func (l *Log) AddSink(s Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sinks = append(l.sinks, s)
+}
+
+// Record stores an event, timing it and naming the Log's service in it,
+// then sends it to the sinks. Sinks that fail are logged; the event is
+// stored regardless.
+func (l *Log) Record(ctx context.Context, e Event) (Event, error) {
+	if l == nil {
+		return e, nil
+	}
+	e.Time = l.now().UTC()
+	if e.Service == "" {
+		e.Service = l.service
+	}
+	stored, err := l.store.Append(ctx, e)
+	if err != nil {
+		return Event{}, fmt.Errorf("record %s: %w", e.Action, err)
+	}
+	e = stored
+	l.mu.Lock()
+	sinks := l.sinks
+	l.mu.Unlock()
+	for _, s := range sinks {
+		if err := s.Write(e); err != nil {
+			logging.FromContext(ctx).WarnContext(ctx, "audit sink failed", "service", e.Service, "seq", e.Seq, "action", e.Action, "error", err)
+		}
+	}
+	return e, nil
+}
+
+// Events returns the events f selects, newest first
+func (l *Log) Events(ctx context.Context, f Filter) ([]Event, error) {
+	var out []Event
+	err := l.store.Scan(ctx, func(e Event) error {
+		if f.match(e) {
+			out = append(out, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+// Verify checks that every event is numbered in order and chained to the
+// one before it, returning how many events it checked
+func (l *Log) Verify(ctx context.Context) (int, error) {
+	n, prev := 0, ""
+	err := l.store.Scan(ctx, func(e Event) error {
+		n++
+		switch {
+		case e.Seq != int64(n):
+			return fmt.Errorf("event %d is numbered %d", n, e.Seq)
+		case e.Prev != prev:
+			return fmt.Errorf("event %d does not follow event %d", e.Seq, e.Seq-1)
+		case e.hash() != e.Hash:
+			return fmt.Errorf("event %d was changed after it was recorded", e.Seq)
+		}
+		prev = e.Hash
+		return nil
+	})
+	return n, err
+}
+
+// Close closes the sinks and the store that need closing, such as a
+// webhook with events still queued, returning the first error
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var first error
+	for _, s := range l.sinks {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	if c, ok := l.store.(io.Closer); ok {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
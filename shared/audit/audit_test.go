@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memorySink struct{ events []Event }
+
+func (s *memorySink) Write(e Event) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	file, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	l := New("swg-policy-engine", file)
+	now := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	sink := &memorySink{}
+	l.AddSink(sink)
+	for _, e := range []Event{
+		{Actor: "admin", Action: "rule.create", Object: "rule 1", Version: 2},
+		{Actor: "admin", Action: "rule.delete", Object: "rule 1", Version: 3},
+		{Actor: ActorScheduler, Action: "source.refresh", Object: "source urlhaus", Version: 3},
+	} {
+		if _, err := l.Record(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Hour)
+	}
+	l.Close()
+
+	// Reopening continues the chain
+	file, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = New("swg-policy-engine", file)
+	defer l.Close()
+	e, err := l.Record(ctx, Event{Actor: "admin", Action: "policy.rollback", Object: "version 2", Version: 4})
+	if err != nil || e.Seq != 4 || e.Service != "swg-policy-engine" {
+		t.Fatalf("event after reopening = %+v, %v", e, err)
+	}
+	if n, err := l.Verify(ctx); n != 4 || err != nil {
+		t.Errorf("Verify = %d, %v", n, err)
+	}
+	if len(sink.events) != 3 || sink.events[2].Hash == "" {
+		t.Errorf("sink got %+v", sink.events)
+	}
+
+	for _, c := range []struct {
+		f    Filter
+		want string
+	}{
+		{Filter{}, "4,3,2,1"},
+		{Filter{Action: "rule."}, "2,1"},
+		{Filter{Actor: ActorScheduler}, "3"},
+		{Filter{Object: "rule 1", Limit: 1}, "2"},
+		{Filter{Since: time.Date(2026, 6, 1, 10, 0, 0, 0, time.UTC), Until: time.Date(2026, 6, 1, 11, 0, 0, 0, time.UTC)}, "2"},
+	} {
+		events, err := l.Events(ctx, c.f)
+		var seqs []string
+		for _, e := range events {
+			seqs = append(seqs, strconv.FormatInt(e.Seq, 10))
+		}
+		if err != nil || strings.Join(seqs, ",") != c.want {
+			t.Errorf("Events(%+v) = %v, %v; want %s", c.f, seqs, err, c.want)
+		}
+	}
+
+	// Editing an event breaks the chain
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), `"rule.delete"`, `"rule.update"`, 1)), 0o600)
+	if n, err := l.Verify(ctx); err == nil || !strings.Contains(err.Error(), "event 2 was changed") {
+		t.Errorf("Verify after an edit = %d, %v", n, err)
+	}
+}
+
+func TestActor(t *testing.T) {
+	if name, addr := ActorFrom(context.Background()); name != ActorScheduler || addr != "" {
+		t.Errorf("ActorFrom(empty) = %s, %s", name, addr)
+	}
+	ctx := WithActor(context.Background(), "admin", "10.0.0.5:51234")
+	if name, addr := ActorFrom(ctx); name != "admin" || addr != "10.0.0.5:51234" {
+		t.Errorf("ActorFrom = %s, %s", name, addr)
+	}
+	var l *Log
+	if _, err := l.Record(context.Background(), Event{Action: "rule.create"}); err != nil {
+		t.Errorf("nil Log recorded: %v", err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var got []Event
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil || r.Header.Get("Idempotency-Key") != e.Hash ||
+			r.Header.Get("Authorization") != "Bearer siem-token" {
+			t.Errorf("webhook request: %v, headers %v", err, r.Header)
+		}
+		got = append(got, e)
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhook(srv.URL, http.Header{"Authorization": {"Bearer siem-token"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.client = w.client.WithAttempts(2)
+	l := New("swg-proxy", tempFile(t))
+	l.AddSink(w)
+	ctx := context.Background()
+	l.Record(ctx, Event{Actor: "10.0.0.5", Action: ActionBlock, Object: "host malware.test", Outcome: OutcomeDenied})
+	l.Record(ctx, Event{Actor: "10.0.0.6", Action: ActionBlock, Object: "host phish.test", Outcome: OutcomeDenied})
+	l.Close() // posts what is queued
+
+	if len(got) != 2 || got[0].Seq != 1 || got[1].Object != "host phish.test" || got[1].Service != "swg-proxy" {
+		t.Errorf("webhook got %+v", got)
+	}
+	if _, err := NewWebhook("ftp://siem.example", nil, nil); err == nil {
+		t.Error("NewWebhook accepted an ftp URL")
+	}
+}
+
+func TestLogins(t *testing.T) {
+	l := New("device-posture-collector", tempFile(t))
+	now := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	logins := NewLogins(l, time.Hour)
+	ctx := context.Background()
+
+	logins.Succeeded(ctx, "acme", "admin", "10.0.0.5:51234")
+	logins.Succeeded(ctx, "acme", "admin", "10.0.0.5:51240") // same login, new connection
+	logins.Succeeded(ctx, "globex", "admin", "10.0.0.5:51241")
+	logins.Failed(ctx, "acme", "10.0.0.9:40000", "wrong admin key")
+	now = now.Add(time.Hour)
+	logins.Succeeded(ctx, "acme", "admin", "10.0.0.5:51250")
+
+	events, _ := l.Events(ctx, Filter{Tenant: "acme"})
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	if got := strings.Join(actions, ","); got != "admin.login,admin.denied,admin.login" {
+		t.Errorf("acme events = %s", got)
+	}
+	if events[1].Outcome != OutcomeDenied || events[1].Detail != "wrong admin key" {
+		t.Errorf("denied event = %+v", events[1])
+	}
+
+	var none *Logins
+	none.Succeeded(ctx, "", "admin", "10.0.0.5:1")
+	if NewLogins(nil, time.Hour) != nil {
+		t.Error("NewLogins of a nil Log is not nil")
+	}
+}
+
+// tempFile opens a File in the test's temporary directory
+func tempFile(t *testing.T) *File {
+	f, err := OpenFile(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
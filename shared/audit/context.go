@@ -0,0 +1,22 @@
+package audit
+
+import "context"
+
+type actorKey struct{}
+
+type actor struct{ name, address string }
+
+// WithActor returns a copy of ctx saying who changes made under it are made
+// by, and from where
+func WithActor(ctx context.Context, name, address string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{name, address})
+}
+
+// ActorFrom returns who ctx says changes are made by, or the scheduler if
+// it says nothing
+func ActorFrom(ctx context.Context) (name, address string) {
+	if a, ok := ctx.Value(actorKey{}).(actor); ok {
+		return a.name, a.address
+	}
+	return ActorScheduler, ""
+}
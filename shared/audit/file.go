@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// File is a Store in a file of JSON lines, one event per line. Each event
+// is synced to disk before Append returns.
+type File struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	last Event
+}
+
+// OpenFile opens the log at path, creating it if it is missing, and
+// continues the chain from its last event
+func OpenFile(path string) (*File, error) {
+	f := &File{path: path}
+	err := f.scan(func(e Event) error {
+		f.last = e
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	f.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return f, nil
+}
+
+// Append chains e to the last event in the file and writes it
+func (f *File) Append(_ context.Context, e Event) (Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e = Chain(f.last, e)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return Event{}, err
+	}
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return Event{}, fmt.Errorf("write audit log: %w", err)
+	}
+	if err := f.file.Sync(); err != nil {
+		return Event{}, fmt.Errorf("write audit log: %w", err)
+	}
+	f.last = e
+	return e, nil
+}
+
+// Scan calls fn with each event in the file, oldest first
+func (f *File) Scan(_ context.Context, fn func(Event) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scan(fn)
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *File) scan(fn func(Event) error) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(data)) > 0 {
+				return fmt.Errorf("audit log line %d is incomplete", line)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read audit log: %w", err)
+		}
+		var e Event
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
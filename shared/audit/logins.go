@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/logging"
+)
+
+// maxLogins bounds how many admins a Logins remembers before it forgets
+// those it last saw more than a window ago
+const maxLogins = 4096
+
+// Logins records admins signing in to an API that authenticates every
+// request, as the services' admin APIs do: admin.login for an admin's first
+// request from an address in a window, and admin.denied for every request
+// with a wrong or missing credential. A nil Logins records nothing.
+type Logins struct {
+	log    *Log
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[[3]string]time.Time // tenant, actor, address: last request
+}
+
+// NewLogins returns a Logins recording in l, counting a request as a new
+// login after window without one
+func NewLogins(l *Log, window time.Duration) *Logins {
+	if l == nil {
+		return nil
+	}
+	return &Logins{log: l, window: window, seen: make(map[[3]string]time.Time)}
+}
+
+// Succeeded notes a request actor made from address as an admin of tenant,
+// empty for the whole service, recording admin.login if it is their first
+// in a window
+func (l *Logins) Succeeded(ctx context.Context, tenant, actor, address string) {
+	if l == nil {
+		return
+	}
+	key, now := [3]string{tenant, actor, host(address)}, l.log.now()
+	l.mu.Lock()
+	last, ok := l.seen[key]
+	l.seen[key] = now
+	if len(l.seen) > maxLogins {
+		for k, t := range l.seen {
+			if now.Sub(t) >= l.window {
+				delete(l.seen, k)
+			}
+		}
+	}
+	l.mu.Unlock()
+	if ok && now.Sub(last) < l.window {
+		return
+	}
+	l.record(ctx, Event{Tenant: tenant, Actor: actor, Address: address, Action: ActionAdminLogin, Outcome: OutcomeSuccess})
+}
+
+// Failed records admin.denied for a request from address whose credential
+// was wrong or missing; detail says which
+func (l *Logins) Failed(ctx context.Context, tenant, address, detail string) {
+	if l == nil {
+		return
+	}
+	l.record(ctx, Event{Tenant: tenant, Actor: ActorAnonymous, Address: address, Action: ActionAdminDenied, Outcome: OutcomeDenied, Detail: detail})
+}
+
+func (l *Logins) record(ctx context.Context, e Event) {
+	if _, err := l.log.Record(ctx, e); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to audit admin sign-in", "action", e.Action, "address", e.Address, "error", err)
+	}
+}
+
+// host returns the host of a host:port address, so that an admin's
+// requests on new connections count as one login
+func host(address string) string {
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		return h
+	}
+	return address
+}
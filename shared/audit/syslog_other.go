@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// NewSyslog is not available where Go has no syslog client
+func NewSyslog(addr, tag string) (Sink, error) {
+	return nil, fmt.Errorf("syslog export is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,49 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/url"
+)
+
+// syslogSink writes events to syslog as JSON, for compliance archives and
+// SIEMs
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslog returns a Sink writing to syslog at addr: "local" for the
+// local syslog daemon, or "udp://host:514" or "tcp://host:514" for a
+// remote one. Events go to the auth facility at notice level, tagged with
+// tag, such as swg-policy-engine.
+func NewSyslog(addr, tag string) (Sink, error) {
+	network, raddr := "", ""
+	if addr != "local" {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, fmt.Errorf("syslog address %q must be local, udp://host:port or tcp://host:port", addr)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_AUTH|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, fmt.Errorf("connect to syslog: %w", err)
+	}
+	return syslogSink{w: w}, nil
+}
+
+func (s syslogSink) Write(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.w.Notice(string(data))
+}
+
+// Close closes the connection to syslog
+func (s syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/httpclient"
+)
+
+// WebhookQueue is how many events a webhook holds while it catches up;
+// events recorded while it is full are dropped
+const WebhookQueue = 1024
+
+// Webhook is a Sink posting each event as JSON to an HTTP endpoint, such
+// as a SIEM's collector. Events are queued and posted in order in the
+// background, so a slow endpoint doesn't hold up what recorded them; each
+// is retried with the event's hash as its Idempotency-Key.
+type Webhook struct {
+	url     string
+	headers http.Header
+	client  *httpclient.Client
+	queue   chan Event
+	done    chan struct{}
+	logger  *slog.Logger // for events that fail to post
+
+	closeOnce sync.Once
+}
+
+// NewWebhook returns a Sink posting to rawURL, an http or https URL, with
+// headers, such as Authorization, on each request. Events that fail to
+// post are logged to logger, or slog.Default() if nil.
+func NewWebhook(rawURL string, headers http.Header, logger *slog.Logger) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("audit webhook %q must be an http or https URL", rawURL)
+	}
+	client, err := httpclient.New(httpclient.Options{Timeout: 10 * time.Second, Attempts: 4, UserAgent: "swg-audit"})
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	w := &Webhook{
+		url:     rawURL,
+		headers: headers,
+		client:  client,
+		queue:   make(chan Event, WebhookQueue),
+		done:    make(chan struct{}),
+		logger:  logger,
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write queues e to be posted
+func (w *Webhook) Write(e Event) error {
+	select {
+	case w.queue <- e:
+		return nil
+	default:
+		return fmt.Errorf("audit webhook queue full, dropping event %d", e.Seq)
+	}
+}
+
+// Close posts the events still queued and stops the webhook. Nothing may
+// be written to it after.
+func (w *Webhook) Close() error {
+	w.closeOnce.Do(func() { close(w.queue) })
+	<-w.done
+	return nil
+}
+
+func (w *Webhook) run() {
+	defer close(w.done)
+	for e := range w.queue {
+		if err := w.post(e); err != nil {
+			w.logger.Warn("audit webhook failed", "service", e.Service, "seq", e.Seq, "action", e.Action, "error", err)
+		}
+	}
+}
+
+// post sends one event
+func (w *Webhook) post(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", e.Hash)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
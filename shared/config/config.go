@@ -0,0 +1,306 @@
+// Package config loads a service's settings in layers, each overriding
+// the one before:
+//
+//  1. the defaults its flags are registered with
+//  2. a JSON config file, named by -config or $<PREFIX>_CONFIG
+//  3. environment variables, $<PREFIX>_<FLAG_NAME>
+//  4. the flags on the command line
+//
+// Services keep declaring their settings as flags, as they always have;
+// Load fills in whatever the command line leaves out from the file and
+// the environment. With -print-config the service can show the settings
+// it ended up with, and where each came from, secrets masked.
+//
+// A secret, such as an admin token or database password, may be given as
+// a reference to where it is kept, e.g. vault:secret/data/swg#token (see
+// the secrets package), which Load resolves: the flag ends up holding the
+// secret, and -print-config shows the reference. Plaintext reports the
+// secrets given in the clear on the command line or in the config file,
+// for the service to warn of.
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nisatyap/shared/secrets"
+)
+
+// ResolveTimeout limits how long Load waits for the secrets referred to,
+// e.g. from Vault
+var ResolveTimeout = 30 * time.Second
+
+// Source is the layer a setting's value came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Options configure Load
+type Options struct {
+	// EnvPrefix names the environment variables: with "PROXY", the flag
+	// -policy-url is read from $PROXY_POLICY_URL
+	EnvPrefix string
+	// Secrets name the flags that hold secrets, besides any whose name
+	// ends in "token", "password" or "secret": references in them are
+	// resolved, and Dump masks their values
+	Secrets []string
+	// Validate, if set, checks the settings once every layer is loaded
+	Validate func() error
+}
+
+// Settings are a flag set's values once loaded
+type Settings struct {
+	// File is the config file read, if any
+	File string
+	// Print is set when -print-config asks for the settings to be shown
+	// rather than used
+	Print bool
+
+	fs      *flag.FlagSet
+	sources map[string]Source
+	secrets map[string]bool
+	refs    map[string]string // secret references, by flag name
+}
+
+// Load registers -config and -print-config on fs, parses args with it and
+// fills in the flags they don't set from the config file and the
+// environment, then validates the result. Errors are handled as fs.Parse
+// handles them: reported to fs.Output(), then returned, or for an
+// ExitOnError flag set, exited on.
+func Load(fs *flag.FlagSet, args []string, opts Options) (*Settings, error) {
+	s := &Settings{fs: fs, sources: make(map[string]Source), secrets: make(map[string]bool), refs: make(map[string]string)}
+	for _, name := range opts.Secrets {
+		s.secrets[name] = true
+	}
+	fs.StringVar(&s.File, "config", "", "JSON file of settings, by flag name (default $"+EnvName(opts.EnvPrefix, "config")+")")
+	fs.BoolVar(&s.Print, "print-config", false, "Print the settings in effect, and where each came from, and exit")
+	if err := fs.Parse(args); err != nil {
+		return nil, err // fs has reported it
+	}
+	if err := s.load(opts); err != nil {
+		fmt.Fprintf(fs.Output(), "%v\n", err)
+		switch fs.ErrorHandling() {
+		case flag.ExitOnError:
+			os.Exit(2)
+		case flag.PanicOnError:
+			panic(err)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Settings) load(opts Options) error {
+	s.fs.Visit(func(f *flag.Flag) { s.sources[f.Name] = SourceFlag })
+	if s.sources["config"] == "" {
+		if file := os.Getenv(EnvName(opts.EnvPrefix, "config")); file != "" {
+			s.File = file
+			s.sources["config"] = SourceEnv
+		}
+	}
+
+	var file map[string]json.RawMessage
+	if s.File != "" {
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return fmt.Errorf("config file: %w", err)
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("config file %s: %w", s.File, err)
+		}
+		var unknown []string
+		for name := range file {
+			if f := s.fs.Lookup(name); f == nil || name == "config" || name == "print-config" {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return fmt.Errorf("config file %s: unknown settings %s", s.File, strings.Join(unknown, ", "))
+		}
+	}
+
+	var errs []error
+	s.fs.VisitAll(func(f *flag.Flag) {
+		if s.sources[f.Name] != "" || f.Name == "print-config" {
+			return
+		}
+		env := EnvName(opts.EnvPrefix, f.Name)
+		if value := os.Getenv(env); value != "" && f.Name != "config" {
+			if err := s.fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("$%s: invalid value %q for -%s: %w", env, value, f.Name, err))
+			}
+			s.sources[f.Name] = SourceEnv
+			return
+		}
+		if raw, ok := file[f.Name]; ok {
+			value, err := fileValue(raw)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("config file %s: %s: %w", s.File, f.Name, err))
+			} else if err := s.fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("config file %s: invalid value %q for %s: %w", s.File, value, f.Name, err))
+			}
+			s.sources[f.Name] = SourceFile
+		}
+	})
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	if opts.Validate != nil {
+		if err := opts.Validate(); err != nil {
+			return fmt.Errorf("invalid settings: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolve replaces the secret references in secret flags with the
+// secrets they refer to
+func (s *Settings) resolve() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ResolveTimeout)
+	defer cancel()
+	var errs []error
+	s.fs.VisitAll(func(f *flag.Flag) {
+		ref := f.Value.String()
+		if !s.isSecret(f.Name) || !secrets.IsReference(ref) {
+			return
+		}
+		secret, err := secrets.Resolve(ctx, ref)
+		if err == nil {
+			err = s.fs.Set(f.Name, secret)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", f.Name, err))
+			return
+		}
+		s.refs[f.Name] = ref
+	})
+	return errors.Join(errs...)
+}
+
+// Plaintext returns the names of the secret flags set to the secret
+// itself, rather than to a reference, on the command line, where other
+// users may see it in the process list, or in the config file
+func (s *Settings) Plaintext() []string {
+	var names []string
+	s.fs.VisitAll(func(f *flag.Flag) {
+		source := s.Source(f.Name)
+		if s.isSecret(f.Name) && s.refs[f.Name] == "" && f.Value.String() != "" && (source == SourceFlag || source == SourceFile) {
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
+
+// fileValue turns a config file value into a flag value: strings as they
+// are, numbers and booleans as written, and lists joined with commas
+func fileValue(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		values := make([]string, len(list))
+		for i, item := range list {
+			v, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			values[i] = v
+		}
+		return strings.Join(values, ","), nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	switch v.(type) {
+	case float64, bool:
+		return string(raw), nil
+	}
+	return "", fmt.Errorf("want a string, number, boolean or list, not %s", raw)
+}
+
+// EnvName returns the environment variable a flag is read from:
+// EnvName("PROXY", "policy-url") is "PROXY_POLICY_URL"
+func EnvName(prefix, flagName string) string {
+	name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flagName))
+	if prefix == "" {
+		return name
+	}
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// Source returns the layer the flag called name got its value from
+func (s *Settings) Source(name string) Source {
+	if source := s.sources[name]; source != "" {
+		return source
+	}
+	return SourceDefault
+}
+
+// Dump writes every setting, its value and its source, one a line in
+// order of name. Secrets are masked, as are the passwords in URLs such as
+// database connection strings, unless given as references, which are
+// shown instead.
+func (s *Settings) Dump(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	s.fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "print-config" {
+			return
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Name, s.display(f), s.Source(f.Name))
+	})
+	tw.Flush()
+}
+
+// display returns a flag's value as Dump shows it
+func (s *Settings) display(f *flag.Flag) string {
+	value := f.Value.String()
+	if value == "" {
+		return `""`
+	}
+	if ref := s.refs[f.Name]; ref != "" {
+		return ref
+	}
+	if s.isSecret(f.Name) {
+		return "********"
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return value
+}
+
+func (s *Settings) isSecret(name string) bool {
+	if s.secrets[name] {
+		return true
+	}
+	for _, suffix := range []string{"token", "password", "secret"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
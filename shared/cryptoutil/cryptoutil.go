@@ -0,0 +1,165 @@
+// Package cryptoutil holds the keys and signatures the services share, so
+// that whatever signs something and whatever checks it agree on the format:
+//
+//   - Ed25519 keys, the policy engine's for policy documents and the
+//     collector's for posture tokens, kept as PEM files with their public
+//     keys beside them in the same name plus .pub, for verifiers
+//   - HMAC-SHA256 with a shared secret, as agents sign their reports with
+//     their API keys
+//
+// Every key is identified by the first 8 bytes of the SHA-256 of its
+// public key, or of its secret, in hex. A signature of a body travels in
+// two headers, X-<Kind>-Signature in standard base64 and X-<Kind>-Key-ID,
+// such as X-Policy-Signature and X-Policy-Key-ID. Where a body could be
+// replayed in answer to another request, what is signed is the body with
+// its context, as Message builds it.
+//
+// Keys are replaced with RotateSigner, which keeps the old public key in
+// the .pub file until it expires, so that verifiers reading the file accept
+// what either key signed while the signer switches.
+package cryptoutil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Algorithms, as named in published keys
+const (
+	Ed25519    = "Ed25519"
+	HMACSHA256 = "HMAC-SHA256"
+)
+
+// Errors verification returns, wrapped
+var (
+	ErrUnsigned   = errors.New("not signed")
+	ErrUnknownKey = errors.New("signed with an unknown key")
+	ErrRetiredKey = errors.New("signed with a retired key")
+	ErrSignature  = errors.New("signature does not verify")
+)
+
+// KeyID identifies a key: the first 8 bytes of the SHA-256 of a public key
+// or a secret, in hex
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// EncodeSignature returns sig as it is sent, in standard base64
+func EncodeSignature(sig []byte) string {
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// DecodeSignature decodes a signature EncodeSignature encoded
+func DecodeSignature(s string) ([]byte, error) {
+	sig, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+	return sig, nil
+}
+
+// signatureHeaders names the headers a signature of kind travels in
+func signatureHeaders(kind string) (signature, keyID string) {
+	return "X-" + kind + "-Signature", "X-" + kind + "-Key-ID"
+}
+
+// SetSignature sets the headers carrying sig, the signature of a body of
+// kind, such as "Policy", made with the key keyID
+func SetSignature(h http.Header, kind, keyID string, sig []byte) {
+	signature, id := signatureHeaders(kind)
+	h.Set(signature, EncodeSignature(sig))
+	h.Set(id, keyID)
+}
+
+// Signature returns the key ID and signature SetSignature set in h, or
+// ErrUnsigned if h carries none
+func Signature(h http.Header, kind string) (keyID string, sig []byte, err error) {
+	signature, id := signatureHeaders(kind)
+	keyID = h.Get(id)
+	if keyID == "" || h.Get(signature) == "" {
+		return "", nil, ErrUnsigned
+	}
+	sig, err = DecodeSignature(h.Get(signature))
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, sig, nil
+}
+
+// Message returns what is signed for body when the same bytes could be
+// replayed in another context: each of fields, such as a document's type
+// and the version it applies to, on a line of its own, then the body. A
+// signature of one message doesn't verify another, so a verifier that
+// rebuilds the message from what it asked for rejects a body sent in
+// answer to something else. Fields must not contain newlines.
+func Message(body []byte, fields ...string) []byte {
+	var msg []byte
+	for _, f := range fields {
+		msg = append(msg, f...)
+		msg = append(msg, '\n')
+	}
+	return append(msg, body...)
+}
+
+// The policy documents the policy engine signs, GET /policy and GET
+// /policy/changes
+const (
+	PolicyDocument  = "policy"
+	ChangesDocument = "changes"
+)
+
+// PolicyMessage returns what the policy engine signs for a policy
+// document: its type, the version a delta applies to, 0 for a full policy,
+// and when it was generated, then the body. A proxy rebuilds it from what
+// it asked for, so that a delta for another version, or one answering GET
+// /policy, doesn't verify.
+func PolicyMessage(body []byte, document string, since int64, generatedAt time.Time) []byte {
+	return Message(body, document, strconv.FormatInt(since, 10), generatedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// HMAC signs with a secret shared by the signer and the verifier
+type HMAC struct {
+	id     string
+	secret []byte
+}
+
+// NewHMAC returns an HMAC-SHA256 signer and verifier keyed with secret
+func NewHMAC(secret []byte) *HMAC {
+	return &HMAC{id: KeyID(secret), secret: secret}
+}
+
+// GenerateHMACSecret returns a new random 256-bit secret
+func GenerateHMACSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate HMAC secret: %w", err)
+	}
+	return secret, nil
+}
+
+// ID returns the ID of the secret
+func (h *HMAC) ID() string { return h.id }
+
+// Sign returns the HMAC of data
+func (h *HMAC) Sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Verify checks that sig is the HMAC of data, in constant time
+func (h *HMAC) Verify(data, sig []byte) error {
+	if !hmac.Equal(h.Sign(data), sig) {
+		return ErrSignature
+	}
+	return nil
+}
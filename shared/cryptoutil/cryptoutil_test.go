@@ -0,0 +1,154 @@
+package cryptoutil
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateSigner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+	s, created, err := LoadOrCreateSigner(path, "signing key")
+	if err != nil || !created {
+		t.Fatalf("LoadOrCreateSigner new key = %v, %v", created, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("private key file: %v, %v", info.Mode(), err)
+	}
+	again, created, err := LoadOrCreateSigner(path, "signing key")
+	if err != nil || created || again.ID() != s.ID() {
+		t.Fatalf("LoadOrCreateSigner existing key = %v, %v, id %s", created, err, again.ID())
+	}
+
+	ring, err := ReadKeyRing(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"version":3}` + "\n")
+	if err := ring.Verify(again.ID(), body, again.Sign(body)); err != nil {
+		t.Errorf("signature does not verify with the .pub key: %v", err)
+	}
+	if err := ring.Verify(s.ID(), []byte(`{"version":4}`+"\n"), s.Sign(body)); !errors.Is(err, ErrSignature) {
+		t.Errorf("signature of another body = %v, want ErrSignature", err)
+	}
+	other, _ := GenerateSigner()
+	if err := ring.Verify(other.ID(), body, other.Sign(body)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("signature by another key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestRotateSigner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+	old, _, err := LoadOrCreateSigner(path, "signing key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	current, retired, err := RotateSigner(path, "signing key", 24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retired.ID != old.ID() || !retired.Expires.Equal(now.Add(24*time.Hour)) {
+		t.Errorf("retired key = %s until %v", retired.ID, retired.Expires)
+	}
+	if loaded, _, _ := LoadOrCreateSigner(path, "signing key"); loaded.ID() != current.ID() || current.ID() == old.ID() {
+		t.Fatalf("key after rotation = %s, want the new %s", loaded.ID(), current.ID())
+	}
+
+	data, _ := os.ReadFile(path + ".pub")
+	keys, err := ParsePublicKeys(path+".pub", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != current.ID() || !keys[0].Created.Equal(now) || !keys[0].Expires.IsZero() ||
+		keys[1].ID != old.ID() || !keys[1].Expires.Equal(now.Add(24*time.Hour)) {
+		t.Fatalf("public keys after rotation = %+v", keys)
+	}
+	ring := NewKeyRing(keys...)
+	body := []byte("policy")
+	if err := ring.VerifyAt(old.ID(), body, old.Sign(body), now.Add(time.Hour)); err != nil {
+		t.Errorf("old key before it expires: %v", err)
+	}
+	if err := ring.VerifyAt(old.ID(), body, old.Sign(body), now.Add(25*time.Hour)); !errors.Is(err, ErrRetiredKey) {
+		t.Errorf("old key after it expires = %v, want ErrRetiredKey", err)
+	}
+
+	// Rotating again after the old key expired drops it
+	newest, _, err := RotateSigner(path, "signing key", time.Hour, now.Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path + ".pub")
+	keys, _ = ParsePublicKeys(path+".pub", data)
+	if len(keys) != 2 || keys[0].ID != newest.ID() || keys[1].ID != current.ID() {
+		t.Errorf("public keys after a second rotation = %+v", keys)
+	}
+
+	if _, _, err := RotateSigner("env:TEST_SIGNING_KEY", "signing key", time.Hour, now); err == nil {
+		t.Error("RotateSigner replaced a key in a secret store")
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	secret, err := GenerateHMACSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatalf("GenerateHMACSecret = %d bytes, %v", len(secret), err)
+	}
+	h := NewHMAC(secret)
+	body := []byte(`{"hostname":"laptop-1"}`)
+	sig := h.Sign(body)
+	if err := NewHMAC(secret).Verify(body, sig); err != nil {
+		t.Errorf("Verify = %v", err)
+	}
+	if err := h.Verify([]byte(`{"hostname":"laptop-2"}`), sig); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify of another body = %v, want ErrSignature", err)
+	}
+	other, _ := GenerateHMACSecret()
+	if err := NewHMAC(other).Verify(body, sig); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify with another secret = %v, want ErrSignature", err)
+	}
+	if h.ID() != KeyID(secret) || len(h.ID()) != 16 {
+		t.Errorf("ID = %q", h.ID())
+	}
+}
+
+func TestSignatureHeaders(t *testing.T) {
+	h := http.Header{}
+	if _, _, err := Signature(h, "Policy"); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("Signature of unsigned headers = %v, want ErrUnsigned", err)
+	}
+	SetSignature(h, "Policy", "0123456789abcdef", []byte{1, 2, 3})
+	if h.Get("X-Policy-Signature") != "AQID" || h.Get("X-Policy-Key-ID") != "0123456789abcdef" {
+		t.Errorf("headers = %v", h)
+	}
+	id, sig, err := Signature(h, "Policy")
+	if err != nil || id != "0123456789abcdef" || string(sig) != "\x01\x02\x03" {
+		t.Errorf("Signature = %q, %v, %v", id, sig, err)
+	}
+	h.Set("X-Policy-Signature", "not base64!")
+	if _, _, err := Signature(h, "Policy"); err == nil {
+		t.Error("Signature accepted a malformed signature")
+	}
+}
+
+func TestMessage(t *testing.T) {
+	if got := string(Message([]byte(`{"v":1}`), "changes", "41")); got != "changes\n41\n{\"v\":1}" {
+		t.Errorf("Message = %q", got)
+	}
+	if got := string(Message([]byte("body"))); got != "body" {
+		t.Errorf("Message without fields = %q", got)
+	}
+	if string(Message([]byte("body"), "policy", "0")) == string(Message([]byte("body"), "changes", "0")) {
+		t.Error("Message is the same for different fields")
+	}
+}
+
+func TestPolicyMessage(t *testing.T) {
+	at := time.Date(2026, 6, 1, 9, 0, 0, 5, time.FixedZone("CEST", 2*60*60))
+	if got := string(PolicyMessage([]byte("{}"), ChangesDocument, 41, at)); got != "changes\n41\n2026-06-01T07:00:00.000000005Z\n{}" {
+		t.Errorf("PolicyMessage = %q", got)
+	}
+}
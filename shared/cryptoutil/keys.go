@@ -0,0 +1,362 @@
+package cryptoutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/secrets"
+)
+
+// Signer signs with an Ed25519 private key
+type Signer struct {
+	id  string
+	key ed25519.PrivateKey
+}
+
+// NewSigner returns a signer for key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{id: KeyID(key.Public().(ed25519.PublicKey)), key: key}
+}
+
+// GenerateSigner returns a signer for a new random key
+func GenerateSigner() (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(key), nil
+}
+
+// LoadOrCreateSigner reads the PEM-encoded PKCS #8 Ed25519 private key at
+// path. If there is no file, it generates a key and writes it there,
+// readable only by its owner, with the public key next to it in
+// path+".pub" for verifiers. It reports whether it created the key. what
+// names the key in errors, such as "signing key".
+//
+// path may instead be a secret reference, such as
+// vault:secret/data/swg#signing_key, to a key kept in a secret store, which
+// is read but never created.
+func LoadOrCreateSigner(path, what string) (*Signer, bool, error) {
+	if secrets.IsReference(path) {
+		data, err := secrets.Resolve(context.Background(), path)
+		if err != nil {
+			return nil, false, fmt.Errorf("read %s: %w", what, err)
+		}
+		s, err := parseSigner(path, what, []byte(data))
+		return s, false, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s, err := createSigner(path, what, time.Now())
+		return s, err == nil, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read %s: %w", what, err)
+	}
+	s, err := parseSigner(path, what, data)
+	return s, false, err
+}
+
+// parseSigner decodes the PEM key read from name
+func parseSigner(name, what string, data []byte) (*Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: not a PEM private key", name)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s must be Ed25519, not %T", name, what, key)
+	}
+	return NewSigner(ed), nil
+}
+
+func createSigner(path, what string, now time.Time) (*Signer, error) {
+	s, err := GenerateSigner()
+	if err != nil {
+		return nil, fmt.Errorf("generate %s: %w", what, err)
+	}
+	// O_EXCL: never overwrite a key that appeared since we looked
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("save %s: %w", what, err)
+	}
+	if _, err := f.Write(s.privateKeyPEM()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("save %s: %w", what, err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("save %s: %w", what, err)
+	}
+	pub := PublicKey{ID: s.id, Key: s.PublicKey(), Created: now.UTC()}
+	if err := os.WriteFile(path+".pub", pub.MarshalPEM(), 0o644); err != nil {
+		return nil, fmt.Errorf("save public key: %w", err)
+	}
+	return s, nil
+}
+
+// RotateSigner replaces the private key at path with a new one, and puts
+// its public key first in path+".pub". The old public key, which it
+// returns, stays in the file until retireAfter from now, by when
+// everything it signed should have been signed again or have expired;
+// keys there that have already expired are dropped. A key in a secret
+// store is replaced there instead.
+func RotateSigner(path, what string, retireAfter time.Duration, now time.Time) (*Signer, PublicKey, error) {
+	if secrets.IsReference(path) {
+		return nil, PublicKey{}, fmt.Errorf("%s is kept in a secret store; replace it there", what)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("read %s: %w", what, err)
+	}
+	old, err := parseSigner(path, what, data)
+	if err != nil {
+		return nil, PublicKey{}, err
+	}
+	var keys []PublicKey
+	if data, err := os.ReadFile(path + ".pub"); err == nil {
+		if keys, err = ParsePublicKeys(path+".pub", data); err != nil {
+			return nil, PublicKey{}, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, PublicKey{}, fmt.Errorf("read public keys: %w", err)
+	}
+
+	s, err := GenerateSigner()
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("generate %s: %w", what, err)
+	}
+	now = now.UTC()
+	retired := PublicKey{ID: old.id, Key: old.PublicKey(), Expires: now.Add(retireAfter)}
+	kept := []PublicKey{{ID: s.id, Key: s.PublicKey(), Created: now}}
+	found := false
+	for _, k := range keys {
+		if k.ID == old.id {
+			found = true
+			if k.Expires.IsZero() || k.Expires.After(retired.Expires) {
+				k.Expires = retired.Expires
+			}
+			retired = k
+		}
+		if !k.Expired(now) {
+			kept = append(kept, k)
+		}
+	}
+	if !found && !retired.Expired(now) {
+		kept = append(kept, retired)
+	}
+	var pubs bytes.Buffer
+	for _, k := range kept {
+		pubs.Write(k.MarshalPEM())
+	}
+	// The public keys first: a verifier given the file may then see the
+	// new key before it signs anything, but never a signature without it
+	if err := writeFile(path+".pub", pubs.Bytes(), 0o644); err != nil {
+		return nil, PublicKey{}, fmt.Errorf("save public keys: %w", err)
+	}
+	if err := writeFile(path, s.privateKeyPEM(), 0o600); err != nil {
+		return nil, PublicKey{}, fmt.Errorf("save %s: %w", what, err)
+	}
+	return s, retired, nil
+}
+
+// writeFile atomically replaces path with data
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ID returns the ID of the signer's key
+func (s *Signer) ID() string { return s.id }
+
+// PublicKey returns the public key that verifies the signer's signatures
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// PublicKeyPEM returns the public key as a PEM "PUBLIC KEY" block
+func (s *Signer) PublicKeyPEM() []byte {
+	der, _ := x509.MarshalPKIXPublicKey(s.PublicKey()) // can't fail for Ed25519
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func (s *Signer) privateKeyPEM() []byte {
+	der, _ := x509.MarshalPKCS8PrivateKey(s.key) // can't fail for Ed25519
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// Sign returns the signature of data
+func (s *Signer) Sign(data []byte) []byte {
+	return ed25519.Sign(s.key, data)
+}
+
+// PublicKey is an Ed25519 public key with its rotation metadata
+type PublicKey struct {
+	ID  string
+	Key ed25519.PublicKey
+	// Created is when the key was generated; zero if not known
+	Created time.Time
+	// Expires is when a rotated-out key stops verifying; zero while it is
+	// current
+	Expires time.Time
+}
+
+// Expired reports whether k no longer verifies at now
+func (k PublicKey) Expired(now time.Time) bool {
+	return !k.Expires.IsZero() && !now.Before(k.Expires)
+}
+
+// MarshalPEM returns k as a PEM "PUBLIC KEY" block, preceded by its
+// metadata as lines of text such as "Expires: 2024-05-01T10:00:00Z",
+// which PEM readers skip
+func (k PublicKey) MarshalPEM() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Key-ID: %s\n", KeyID(k.Key))
+	if !k.Created.IsZero() {
+		fmt.Fprintf(&b, "Created: %s\n", k.Created.UTC().Format(time.RFC3339))
+	}
+	if !k.Expires.IsZero() {
+		fmt.Fprintf(&b, "Expires: %s\n", k.Expires.UTC().Format(time.RFC3339))
+	}
+	der, _ := x509.MarshalPKIXPublicKey(k.Key) // can't fail for Ed25519
+	pem.Encode(&b, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return b.Bytes()
+}
+
+// ParsePublicKeys decodes the Ed25519 public keys in PEM data read from
+// name, with the metadata MarshalPEM writes before each. Blocks of other
+// types are skipped.
+func ParsePublicKeys(name string, data []byte) ([]PublicKey, error) {
+	var keys []PublicKey
+	for {
+		start := bytes.Index(data, []byte("-----BEGIN "))
+		if start < 0 {
+			break
+		}
+		meta := data[:start]
+		block, rest := pem.Decode(data[start:])
+		if block == nil {
+			break
+		}
+		data = rest
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: keys must be Ed25519, not %T", name, pub)
+		}
+		k := PublicKey{ID: KeyID(key), Key: key}
+		lines := bufio.NewScanner(bytes.NewReader(meta))
+		for lines.Scan() {
+			field, value, _ := strings.Cut(lines.Text(), ":")
+			var at *time.Time
+			switch strings.TrimSpace(field) {
+			case "Created":
+				at = &k.Created
+			case "Expires":
+				at = &k.Expires
+			default:
+				continue
+			}
+			if *at, err = time.Parse(time.RFC3339, strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("%s: key %s: %s: %w", name, k.ID, field, err)
+			}
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// KeyRing verifies signatures with the public keys of the signers it
+// trusts. It is safe for concurrent use.
+type KeyRing struct {
+	keys map[string]PublicKey
+}
+
+// NewKeyRing returns a key ring trusting keys. A key without an ID is
+// given its KeyID.
+func NewKeyRing(keys ...PublicKey) *KeyRing {
+	r := &KeyRing{keys: make(map[string]PublicKey, len(keys))}
+	for _, k := range keys {
+		if k.ID == "" {
+			k.ID = KeyID(k.Key)
+		}
+		r.keys[k.ID] = k
+	}
+	return r
+}
+
+// ReadKeyRing returns a key ring trusting the Ed25519 public keys in the
+// PEM file at path, such as a key's .pub file
+func ReadKeyRing(path string) (*KeyRing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParsePublicKeys(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no PEM public keys", path)
+	}
+	return NewKeyRing(keys...), nil
+}
+
+// Len returns how many keys r trusts
+func (r *KeyRing) Len() int { return len(r.keys) }
+
+// Verify checks that sig is the signature of data by the key keyID, which
+// r trusts and which hasn't expired
+func (r *KeyRing) Verify(keyID string, data, sig []byte) error {
+	return r.VerifyAt(keyID, data, sig, time.Now())
+}
+
+// VerifyAt is Verify at now
+func (r *KeyRing) VerifyAt(keyID string, data, sig []byte, now time.Time) error {
+	k, ok := r.keys[keyID]
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownKey, keyID)
+	}
+	if k.Expired(now) {
+		return fmt.Errorf("%w %s, expired %s", ErrRetiredKey, keyID, k.Expires.UTC().Format(time.RFC3339))
+	}
+	if !ed25519.Verify(k.Key, data, sig) {
+		return fmt.Errorf("%w with key %s", ErrSignature, keyID)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// Package eventbus carries events between the services: the collector
+// publishes a device's posture changes and tamper alerts, and the proxy
+// and policy engine subscribe to act on them as they happen, e.g. to
+// quarantine a device that reports tampering without waiting for its
+// posture token to expire.
+//
+// Events are published on dot-separated subjects such as
+// "posture.tamper". A subscription names a subject or a pattern in which
+// "*" stands for one token and a final ">" for one or more, as in NATS:
+// "posture.*" and "posture.>" both match "posture.tamper".
+//
+// Services that share a process, as under the swg binary, share the bus
+// Local returns. Across processes, the collector serves its bus over HTTP
+// with Handler and the other services Dial it. Delivery is at most once:
+// a subscriber too slow to keep up, or disconnected, misses events, so
+// events should prompt a subscriber to act rather than be its only record
+// of state.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subjects the collector publishes on
+const (
+	// SubjectPostureChanged carries a PostureChange when a device's status
+	// changes, including to and from STALE
+	SubjectPostureChanged = "posture.changed"
+	// SubjectPostureTamper carries a TamperAlert when an agent reports
+	// tamper findings
+	SubjectPostureTamper = "posture.tamper"
+)
+
+// PostureChange is the data of a posture.changed event. From is empty for
+// a device's first report.
+type PostureChange struct {
+	DeviceID string    `json:"device_id"`
+	Tenant   string    `json:"tenant"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Time     time.Time `json:"time"`
+}
+
+// TamperAlert is the data of a posture.tamper event
+type TamperAlert struct {
+	DeviceID string    `json:"device_id"`
+	Tenant   string    `json:"tenant"`
+	Kinds    []string  `json:"kinds"` // of the tamper findings, e.g. agent_binary
+	Summary  string    `json:"summary"`
+	Time     time.Time `json:"time"`
+}
+
+// SubscriberBuffer is how many events are queued for a subscriber that is
+// still handling an earlier one before more are dropped
+const SubscriberBuffer = 64
+
+// Event is one message on the bus
+type Event struct {
+	// ID orders the events of one bus; it restarts with the process
+	ID      uint64          `json:"id"`
+	Subject string          `json:"subject"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Decode unmarshals the event's data into v
+func (e Event) Decode(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("decoding %s event: %w", e.Subject, err)
+	}
+	return nil
+}
+
+// Bus publishes events and delivers them to subscribers
+type Bus interface {
+	// Publish sends data, encoded as JSON, to the subscribers of subject.
+	// It does not wait for them to handle it.
+	Publish(ctx context.Context, subject string, data any) error
+	// Subscribe calls handle, one event at a time, for every event
+	// published on a subject pattern matches, until unsubscribe is called
+	Subscribe(pattern string, handle func(Event)) (unsubscribe func(), err error)
+}
+
+// ValidSubject reports whether s is a subject events may be published on:
+// dot-separated tokens that are neither empty nor wildcards
+func ValidSubject(s string) bool {
+	for _, token := range strings.Split(s, ".") {
+		if token == "" || token == "*" || token == ">" || strings.ContainsAny(token, " \t\r\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidPattern reports whether p is a subject pattern: a subject whose
+// tokens may also be "*", and whose last token may be ">"
+func ValidPattern(p string) bool {
+	tokens := strings.Split(p, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "*":
+		case token == ">" && i == len(tokens)-1:
+		case !ValidSubject(token):
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether subject matches pattern
+func Match(pattern, subject string) bool {
+	patterns, subjects := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, p := range patterns {
+		if p == ">" {
+			return i < len(subjects)
+		}
+		if i >= len(subjects) || (p != "*" && p != subjects[i]) {
+			return false
+		}
+	}
+	return len(patterns) == len(subjects)
+}
+
+// encode returns data as the JSON of an event
+func encode(subject string, data any) (json.RawMessage, error) {
+	if !ValidSubject(subject) {
+		return nil, fmt.Errorf("invalid subject %q", subject)
+	}
+	if raw, ok := data.(json.RawMessage); ok {
+		if !json.Valid(raw) {
+			return nil, fmt.Errorf("%s event data is not valid JSON", subject)
+		}
+		return raw, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s event: %w", subject, err)
+	}
+	return raw, nil
+}
+
+// Memory is a Bus within one process. Each subscriber handles its events
+// on a goroutine of its own, so a slow one holds up neither the publisher
+// nor the other subscribers; it misses the events published while
+// SubscriberBuffer of them are waiting.
+type Memory struct {
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[*subscription]bool
+	now    func() time.Time
+}
+
+type subscription struct {
+	pattern string
+	events  chan Event
+	done    chan struct{}
+}
+
+// NewMemory creates a bus with no subscribers
+func NewMemory() *Memory {
+	return &Memory{subs: make(map[*subscription]bool), now: time.Now}
+}
+
+var local = NewMemory()
+
+// Local returns the bus shared by everything in this process
+func Local() *Memory { return local }
+
+// Publish delivers data to the matching subscribers
+func (m *Memory) Publish(ctx context.Context, subject string, data any) error {
+	raw, err := encode(subject, data)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	e := Event{ID: m.nextID, Subject: subject, Time: m.now().UTC(), Data: raw}
+	for s := range m.subs {
+		if !Match(s.pattern, subject) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe calls handle for the events published on subjects matching
+// pattern
+func (m *Memory) Subscribe(pattern string, handle func(Event)) (func(), error) {
+	if !ValidPattern(pattern) {
+		return nil, fmt.Errorf("invalid subject pattern %q", pattern)
+	}
+	s := &subscription{pattern: pattern, events: make(chan Event, SubscriberBuffer), done: make(chan struct{})}
+	m.mu.Lock()
+	m.subs[s] = true
+	m.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-s.done:
+				return
+			case e := <-s.events:
+				handle(e)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.subs, s)
+			m.mu.Unlock()
+			close(s.done)
+		})
+	}, nil
+}
+
+// Subscribers returns how many subscriptions the bus has
+func (m *Memory) Subscribers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.subs)
+}
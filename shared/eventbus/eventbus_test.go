@@ -0,0 +1,147 @@
+package eventbus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		want             bool
+	}{
+		{"posture.tamper", "posture.tamper", true},
+		{"posture.tamper", "posture.changed", false},
+		{"posture.*", "posture.tamper", true},
+		{"posture.*", "posture.tamper.agent", false},
+		{"posture.>", "posture.tamper.agent", true},
+		{"posture.>", "posture", false},
+		{">", "posture.changed", true},
+		{"*.changed", "posture.changed", true},
+		{"posture.tamper.agent", "posture.tamper", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "posture.", ".tamper", "posture.*", "posture.>", "posture tamper"} {
+		if ValidSubject(s) {
+			t.Errorf("ValidSubject(%q) = true", s)
+		}
+	}
+	for _, p := range []string{"", "posture.>.tamper", "posture..tamper"} {
+		if ValidPattern(p) {
+			t.Errorf("ValidPattern(%q) = true", p)
+		}
+	}
+}
+
+// receive returns the next event of events, failing the test if none
+// arrives in time
+func receive(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event arrived")
+		return Event{}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	bus := NewMemory()
+	ctx := context.Background()
+	tamper, all := make(chan Event, 10), make(chan Event, 10)
+	stopTamper, err := bus.Subscribe(SubjectPostureTamper, func(e Event) { tamper <- e })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bus.Subscribe("posture.>", func(e Event) { all <- e }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bus.Subscribe("posture.>.x", func(Event) {}); err == nil {
+		t.Error("Subscribe with an invalid pattern succeeded")
+	}
+
+	if err := bus.Publish(ctx, SubjectPostureChanged, PostureChange{DeviceID: "laptop-1", From: "HEALTHY", To: "UNHEALTHY"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(ctx, SubjectPostureTamper, TamperAlert{DeviceID: "laptop-1", Kinds: []string{"agent_binary"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(ctx, "posture.*", nil); err == nil {
+		t.Error("Publish on a wildcard subject succeeded")
+	}
+
+	var change PostureChange
+	if e := receive(t, all); e.Subject != SubjectPostureChanged || e.Decode(&change) != nil || change.To != "UNHEALTHY" {
+		t.Errorf("first event = %+v (%+v)", e, change)
+	}
+	if e := receive(t, all); e.Subject != SubjectPostureTamper || e.ID != 2 {
+		t.Errorf("second event = %+v", e)
+	}
+	var alert TamperAlert
+	if e := receive(t, tamper); e.Decode(&alert) != nil || alert.DeviceID != "laptop-1" {
+		t.Errorf("tamper event = %+v (%+v)", e, alert)
+	}
+
+	stopTamper()
+	stopTamper()
+	if n := bus.Subscribers(); n != 1 {
+		t.Errorf("Subscribers after unsubscribing = %d, want 1", n)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	bus := NewMemory()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		Handler(bus).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	if _, err := Dial("collector:8000/events", Options{}); err == nil {
+		t.Error("Dial without a scheme succeeded")
+	}
+	remote, err := Dial(server.URL, Options{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan Event, 10)
+	unsubscribe, err := remote.Subscribe(SubjectPostureTamper, func(e Event) { events <- e })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	deadline := time.Now().Add(5 * time.Second)
+	for bus.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx := context.Background()
+	if err := remote.Publish(ctx, SubjectPostureChanged, PostureChange{DeviceID: "laptop-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Publish(ctx, SubjectPostureTamper, TamperAlert{DeviceID: "laptop-2"}); err != nil {
+		t.Fatal(err)
+	}
+	var alert TamperAlert
+	if e := receive(t, events); e.Subject != SubjectPostureTamper || e.Decode(&alert) != nil || alert.DeviceID != "laptop-2" {
+		t.Errorf("event = %+v (%+v)", e, alert)
+	}
+
+	unauthorized, _ := Dial(server.URL, Options{})
+	if err := unauthorized.Publish(ctx, SubjectPostureTamper, nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Publish without the token = %v, want a 401 error", err)
+	}
+}
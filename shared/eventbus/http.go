@@ -0,0 +1,273 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/httpclient"
+)
+
+// LocalSpec names the in-process bus in Open
+const LocalSpec = "local"
+
+// Stream timings
+const (
+	streamHeartbeat   = 15 * time.Second
+	streamIdle        = 3 * streamHeartbeat // a stream this quiet has died
+	streamRetryMillis = 3000
+	maxPublishBytes   = 64 << 10
+)
+
+// Handler serves bus over HTTP, for Remote buses in other processes:
+//
+//	GET  ?subject=posture.>                    streams events as Server-Sent Events
+//	POST {"subject":"...","data":{...}}        publishes an event
+//
+// A stream's events are named after their subjects and carry the Event as
+// JSON data; subject defaults to ">", every event. Authenticating callers
+// is left to the service mounting the handler.
+func Handler(bus Bus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			serveStream(bus, w, r)
+		case http.MethodPost:
+			servePublish(bus, w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func serveStream(bus Bus, w http.ResponseWriter, r *http.Request) {
+	pattern := r.URL.Query().Get("subject")
+	if pattern == "" {
+		pattern = ">"
+	}
+	events := make(chan Event, SubscriberBuffer)
+	unsubscribe, err := bus.Subscribe(pattern, func(e Event) {
+		select {
+		case events <- e:
+		default:
+		}
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer unsubscribe()
+
+	// The server's write timeout would cut the stream off
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // stop nginx buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-events:
+			data, _ := json.Marshal(e) // Data is valid JSON
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Subject, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func servePublish(bus Bus, w http.ResponseWriter, r *http.Request) {
+	var e Event
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPublishBytes)).Decode(&e); err != nil {
+		http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(e.Data) == 0 {
+		e.Data = json.RawMessage("null")
+	}
+	if err := bus.Publish(r.Context(), e.Subject, e.Data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Options configure a Remote bus
+type Options struct {
+	// Token, when set, is sent as a bearer token, e.g. the collector's
+	// admin token
+	Token string
+	// TLS configures https:// connections; nil uses the defaults
+	TLS *tls.Config
+	// Logger records subscriptions dropping and resuming; nil uses
+	// slog.Default()
+	Logger *slog.Logger
+}
+
+// Remote is a Bus served by another process's Handler. Its subscriptions
+// reconnect, backing off, whenever their stream drops; events published
+// while one is down are missed.
+type Remote struct {
+	url    string
+	opts   Options
+	client *httpclient.Client
+}
+
+// Dial returns the bus Handler serves at rawURL. It does not connect
+// until the bus is used.
+func Dial(rawURL string, opts Options) (*Remote, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("event bus URL %q must be an http or https URL", rawURL)
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	client, err := httpclient.New(httpclient.Options{Timeout: 10 * time.Second, TLS: opts.TLS})
+	if err != nil {
+		return nil, err
+	}
+	return &Remote{url: u.String(), opts: opts, client: client}, nil
+}
+
+// Open returns the bus spec names: LocalSpec for Local, or the URL of
+// another process's bus to Dial
+func Open(spec string, opts Options) (Bus, error) {
+	if spec == LocalSpec {
+		return Local(), nil
+	}
+	return Dial(spec, opts)
+}
+
+// Publish posts the event to the remote bus
+func (b *Remote) Publish(ctx context.Context, subject string, data any) error {
+	raw, err := encode(subject, data)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(Event{Subject: subject, Data: raw})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	b.authorize(req)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("publishing %s event: %w", subject, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("publishing %s event: event bus returned status: %d", subject, resp.StatusCode)
+	}
+	return nil
+}
+
+// Subscribe follows the remote bus's stream of events matching pattern
+// until unsubscribe is called
+func (b *Remote) Subscribe(pattern string, handle func(Event)) (func(), error) {
+	if !ValidPattern(pattern) {
+		return nil, fmt.Errorf("invalid subject pattern %q", pattern)
+	}
+	u, _ := url.Parse(b.url) // checked by Dial
+	q := u.Query()
+	q.Set("subject", pattern)
+	u.RawQuery = q.Encode()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		backoff := httpclient.Backoff{Base: time.Second, Max: time.Minute, Jitter: 0.2}
+		for attempt := 1; ; attempt++ {
+			start := time.Now()
+			err := b.follow(ctx, u.String(), pattern, handle)
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(start) > backoff.Max {
+				attempt = 1 // it was up for a while; this is a new failure
+			}
+			retry := backoff.Delay(attempt)
+			b.opts.Logger.Warn("event bus subscription dropped", "subject", pattern, "error", err, "retry_in", retry)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+		}
+	}()
+	return cancel, nil
+}
+
+// follow reads one connection's stream until it fails, goes quiet or ctx
+// is done
+func (b *Remote) follow(ctx context.Context, rawURL, pattern string, handle func(Event)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	b.authorize(req)
+	resp, err := b.client.Stream(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("event bus returned status: %d", resp.StatusCode)
+	}
+	b.opts.Logger.Info("subscribed to event bus", "url", b.url, "subject", pattern)
+
+	idle := time.AfterFunc(streamIdle, cancel)
+	defer idle.Stop()
+	scanner := bufio.NewScanner(resp.Body)
+	var data string
+	for scanner.Scan() {
+		idle.Reset(streamIdle)
+		line := scanner.Text()
+		switch {
+		case line == "" && data != "":
+			var e Event
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				b.opts.Logger.Warn("ignoring malformed event", "error", err)
+			} else if Match(pattern, e.Subject) {
+				handle(e)
+			}
+			data = ""
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func (b *Remote) authorize(req *http.Request) {
+	if b.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.opts.Token)
+	}
+}
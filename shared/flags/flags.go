@@ -0,0 +1,370 @@
+// Package flags turns features on and off while a service runs, so that
+// a risky capability, such as the proxy intercepting HTTPS, can be rolled
+// out to a few devices, then a few more, and turned off again without a
+// release.
+//
+// A service declares the flags it checks, each off or on by default. A
+// flag's value is on, off or a percentage, e.g. 25%, of the units it is
+// evaluated for: a unit is whatever the rollout is spread across, such as
+// a device ID, and a flag at 25% is on for the same quarter of them every
+// time, growing to include more as the percentage is raised. Values come
+// from the service's own configuration, with Configure, and from the
+// policy engine's GET /flags, with Fetch, which wins over configuration.
+//
+//	features := flags.New(hostname, flags.Flag{Name: flags.FailClosed, Description: "..."})
+//	if err := features.Configure("fail-closed=on"); err != nil { ... }
+//	if features.Enabled(flags.FailClosed) { ... }
+//
+// Handler serves each flag's value and how often it was found on and off
+// in the Prometheus text format, so a rollout can be watched.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nisatyap/shared/httpclient"
+	"github.com/nisatyap/shared/promtext"
+)
+
+// Features the services check
+const (
+	// MITM makes the proxy intercept HTTPS, to apply the policy to the
+	// requests inside and show its block page over HTTPS
+	MITM = "mitm"
+	// FailClosed makes the proxy block every request while it holds no
+	// policy, instead of allowing them all
+	FailClosed = "fail-closed"
+	// DeltaReports makes the agent leave the sections of a report that
+	// haven't changed since its last accepted one out of the next
+	DeltaReports = "delta-reports"
+)
+
+// Value is a flag's setting: the percentage of units it is on for
+type Value int
+
+// Off and On are a flag off and on for every unit
+const (
+	Off Value = 0
+	On  Value = 100
+)
+
+// ParseValue parses on, off, true, false or a percentage such as 25%
+func ParseValue(s string) (Value, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "on", "true":
+		return On, nil
+	case "off", "false":
+		return Off, nil
+	}
+	percent, ok := strings.CutSuffix(strings.TrimSpace(s), "%")
+	n, err := strconv.Atoi(percent)
+	if !ok || err != nil || n < 0 || n > 100 {
+		return Off, fmt.Errorf("flag value %q is not on, off or a percentage from 0%% to 100%%", s)
+	}
+	return Value(n), nil
+}
+
+// String returns on, off, or the percentage
+func (v Value) String() string {
+	switch v {
+	case On:
+		return "on"
+	case Off:
+		return "off"
+	}
+	return strconv.Itoa(int(v)) + "%"
+}
+
+// MarshalText writes the value as String does
+func (v Value) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText parses the value as ParseValue does
+func (v *Value) UnmarshalText(text []byte) error {
+	parsed, err := ParseValue(string(text))
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+// namePattern is what flag names look like
+var namePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidName reports whether name is a flag name: lower-case words joined
+// by hyphens, such as fail-closed
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Flag declares a feature a service checks
+type Flag struct {
+	Name        string
+	Description string
+	Default     bool // on for every unit unless configured otherwise
+}
+
+// Where a flag's value came from
+const (
+	SourceDefault = "default"
+	SourceConfig  = "config"
+	SourceRemote  = "remote" // the policy engine
+)
+
+// Status is a flag's value and where it came from
+type Status struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Value       Value  `json:"value"`
+	Source      string `json:"source"`
+	Enabled     bool   `json:"enabled"` // for the set's own unit
+}
+
+// Document is the body of the policy engine's GET /flags: the fleet's
+// flag values by name
+type Document struct {
+	Flags   map[string]Value `json:"flags"`
+	Version int64            `json:"version,omitempty"` // the policy version that set them
+}
+
+// Set holds the flags a service checks and their values
+type Set struct {
+	unit   string
+	logger *slog.Logger // for changes Apply makes
+	mu     sync.RWMutex
+	flags  map[string]*state
+	names  []string // sorted
+}
+
+type state struct {
+	flag   Flag
+	config *Value
+	remote *Value
+	on     atomic.Uint64 // evaluations that found the flag on
+	off    atomic.Uint64
+}
+
+// value returns the flag's value and where it came from: the policy
+// engine's over the configuration's over the default
+func (st *state) value() (Value, string) {
+	switch {
+	case st.remote != nil:
+		return *st.remote, SourceRemote
+	case st.config != nil:
+		return *st.config, SourceConfig
+	case st.flag.Default:
+		return On, SourceDefault
+	}
+	return Off, SourceDefault
+}
+
+// New returns a set of flags at their defaults. unit is the one Enabled
+// decides for, e.g. the host name of the machine the service runs on.
+// It panics if a name isn't valid or is declared twice.
+func New(unit string, flags ...Flag) *Set {
+	s := &Set{unit: unit, logger: slog.Default(), flags: make(map[string]*state, len(flags))}
+	for _, f := range flags {
+		if !ValidName(f.Name) {
+			panic("flags: invalid flag name " + strconv.Quote(f.Name))
+		}
+		if _, dup := s.flags[f.Name]; dup {
+			panic("flags: flag " + f.Name + " declared twice")
+		}
+		s.flags[f.Name] = &state{flag: f}
+		s.names = append(s.names, f.Name)
+	}
+	sort.Strings(s.names)
+	return s
+}
+
+// SetLogger logs the changes the policy engine makes to logger rather
+// than slog.Default(), for a service sharing its process with others
+func (s *Set) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// Configure sets flag values from a service's configuration: a
+// comma-separated list of name=value, such as "mitm=10%,fail-closed=on".
+// A name alone turns its flag on. It fails, changing nothing, if a name
+// isn't declared or a value doesn't parse.
+func (s *Set) Configure(spec string) error {
+	values := make(map[string]Value)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, raw, hasValue := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if _, ok := s.flags[name]; !ok {
+			return fmt.Errorf("unknown flag %q (known: %s)", name, strings.Join(s.names, ", "))
+		}
+		v := On
+		if hasValue {
+			var err error
+			if v, err = ParseValue(raw); err != nil {
+				return fmt.Errorf("flag %s: %w", name, err)
+			}
+		}
+		values[name] = v
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, v := range values {
+		v := v
+		s.flags[name].config = &v
+	}
+	return nil
+}
+
+// Apply sets flag values from the policy engine, replacing those it set
+// before: flags doc doesn't name go back to their configured values.
+// Flags the service doesn't declare are ignored, since the policy engine
+// holds those of every service.
+func (s *Set) Apply(doc Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range s.names {
+		st := s.flags[name]
+		before, _ := st.value()
+		if v, ok := doc.Flags[name]; ok {
+			st.remote = &v
+		} else {
+			st.remote = nil
+		}
+		if after, source := st.value(); after != before {
+			s.logger.Info("feature flag changed", "flag", name, "from", before.String(), "to", after.String(), "source", source, "policy_version", doc.Version)
+		}
+	}
+}
+
+// Fetch applies the flag document at rawURL, the policy engine's GET
+// /flags
+func (s *Set) Fetch(ctx context.Context, client *httpclient.Client, rawURL string) error {
+	resp, err := client.Get(ctx, rawURL)
+	if err != nil {
+		return fmt.Errorf("fetch flags: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch flags: policy engine returned status %d", resp.StatusCode)
+	}
+	var doc Document
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("fetch flags: %w", err)
+	}
+	s.Apply(doc)
+	return nil
+}
+
+// Enabled reports whether the flag is on for the set's own unit. A flag
+// the set doesn't declare is off, as is every flag of a nil *Set.
+func (s *Set) Enabled(name string) bool {
+	if s == nil {
+		return false
+	}
+	return s.EnabledFor(name, s.unit)
+}
+
+// EnabledFor reports whether the flag is on for unit, e.g. the device a
+// request comes from. At a percentage, the same units find it on every
+// time. A nil *Set has every flag off.
+func (s *Set) EnabledFor(name, unit string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	st, ok := s.flags[name]
+	var v Value
+	if ok {
+		v, _ = st.value()
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	on := enabled(name, unit, v)
+	if on {
+		st.on.Add(1)
+	} else {
+		st.off.Add(1)
+	}
+	return on
+}
+
+// enabled decides a flag at value v for unit. Each unit falls in one of
+// 100 buckets, per flag, and the flag is on for the first v of them.
+func enabled(name, unit string, v Value) bool {
+	switch {
+	case v >= On:
+		return true
+	case v <= Off:
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(unit))
+	return Value(h.Sum32()%100) < v
+}
+
+// Flags returns the status of each flag, by name
+func (s *Set) Flags() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := make([]Status, 0, len(s.names))
+	for _, name := range s.names {
+		st := s.flags[name]
+		v, source := st.value()
+		statuses = append(statuses, Status{
+			Name: name, Description: st.flag.Description, Value: v, Source: source,
+			Enabled: enabled(name, s.unit, v),
+		})
+	}
+	return statuses
+}
+
+// Handler serves the flags' metrics in the Prometheus text format:
+//
+//	feature_flag_enabled{flag}                 1 if on for the set's unit
+//	feature_flag_rollout_percent{flag,source}  the flag's value
+//	feature_flag_evaluations_total{flag,result} checks that found it on or off
+func (s *Set) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		statuses := s.Flags()
+		promtext.Header(&b, "feature_flag_enabled", "gauge", "Whether a feature flag is on (1) or off (0) for this instance.")
+		for _, f := range statuses {
+			on := 0.0
+			if f.Enabled {
+				on = 1
+			}
+			promtext.Sample(&b, "feature_flag_enabled", map[string]string{"flag": f.Name}, on)
+		}
+		promtext.Header(&b, "feature_flag_rollout_percent", "gauge", "Percentage of units a feature flag is on for, by where its value came from.")
+		for _, f := range statuses {
+			promtext.Sample(&b, "feature_flag_rollout_percent", map[string]string{"flag": f.Name, "source": f.Source}, float64(f.Value))
+		}
+		promtext.Header(&b, "feature_flag_evaluations_total", "counter", "Times a feature flag was checked, by whether it was on.")
+		for _, f := range statuses {
+			st := s.flags[f.Name]
+			promtext.Sample(&b, "feature_flag_evaluations_total", map[string]string{"flag": f.Name, "result": "off"}, float64(st.off.Load()))
+			promtext.Sample(&b, "feature_flag_evaluations_total", map[string]string{"flag": f.Name, "result": "on"}, float64(st.on.Load()))
+		}
+		w.Header().Set("Content-Type", promtext.ContentType)
+		fmt.Fprint(w, b.String())
+	})
+}
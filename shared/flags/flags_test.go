@@ -0,0 +1,115 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nisatyap/shared/httpclient"
+)
+
+func TestParseValue(t *testing.T) {
+	for in, want := range map[string]Value{"on": On, "TRUE": On, "off": Off, "false": Off, "25%": 25, " 0% ": Off, "100%": On} {
+		if got, err := ParseValue(in); err != nil || got != want {
+			t.Errorf("ParseValue(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "yes", "25", "101%", "-1%", "x%"} {
+		if _, err := ParseValue(in); err == nil {
+			t.Errorf("ParseValue(%q) succeeded", in)
+		}
+	}
+	if s := Value(25).String(); s != "25%" {
+		t.Errorf("String = %s", s)
+	}
+}
+
+func TestSources(t *testing.T) {
+	set := New("laptop-1", Flag{Name: MITM}, Flag{Name: FailClosed, Default: true})
+	if set.Enabled(MITM) || !set.Enabled(FailClosed) || set.Enabled("undeclared") {
+		t.Fatal("defaults not applied")
+	}
+	if err := set.Configure("mitm, fail-closed=off"); err != nil {
+		t.Fatal(err)
+	}
+	if !set.Enabled(MITM) || set.Enabled(FailClosed) {
+		t.Error("configuration not applied")
+	}
+	for _, spec := range []string{"nosuch=on", "mitm=maybe"} {
+		if err := set.Configure(spec); err == nil {
+			t.Errorf("Configure(%q) succeeded", spec)
+		}
+	}
+
+	// The policy engine's values win, until it stops setting them
+	set.Apply(Document{Flags: map[string]Value{MITM: Off, DeltaReports: On}, Version: 7})
+	if set.Enabled(MITM) {
+		t.Error("remote value not applied")
+	}
+	set.Apply(Document{})
+	statuses := set.Flags()
+	if len(statuses) != 2 || statuses[1].Name != MITM || statuses[1].Source != SourceConfig || !statuses[1].Enabled {
+		t.Errorf("Flags = %+v", statuses)
+	}
+}
+
+func TestRollout(t *testing.T) {
+	set := New("proxy-1", Flag{Name: MITM})
+	on := func() map[string]bool {
+		devices := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			unit := fmt.Sprintf("laptop-%d", i)
+			if set.EnabledFor(MITM, unit) {
+				devices[unit] = true
+			}
+		}
+		return devices
+	}
+	set.Configure("mitm=10%")
+	ten := on()
+	set.Configure("mitm=30%")
+	thirty := on()
+	if len(ten) < 50 || len(ten) > 150 || len(thirty) < 230 || len(thirty) > 370 {
+		t.Errorf("on for %d and %d of 1000 units at 10%% and 30%%", len(ten), len(thirty))
+	}
+	// Raising the percentage keeps the units it was on for
+	for unit := range ten {
+		if !thirty[unit] {
+			t.Errorf("%s dropped out of the rollout", unit)
+		}
+	}
+	var nilSet *Set
+	if nilSet.EnabledFor(MITM, "laptop-1") || nilSet.Enabled(MITM) {
+		t.Error("nil set has a flag on")
+	}
+}
+
+func TestFetchAndMetrics(t *testing.T) {
+	engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"flags":{"fail-closed":"on","mitm":"25%","other-service":"on"},"version":3}`)
+	}))
+	defer engine.Close()
+	client, _ := httpclient.New(httpclient.Options{})
+	set := New("proxy-1", Flag{Name: MITM}, Flag{Name: FailClosed})
+	if err := set.Fetch(context.Background(), client, engine.URL); err != nil {
+		t.Fatal(err)
+	}
+	set.Enabled(FailClosed)
+	set.Enabled(FailClosed)
+
+	rec := httptest.NewRecorder()
+	set.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`feature_flag_enabled{flag="fail-closed"} 1`,
+		`feature_flag_rollout_percent{flag="mitm",source="remote"} 25`,
+		`feature_flag_evaluations_total{flag="fail-closed",result="on"} 2`,
+		`feature_flag_evaluations_total{flag="mitm",result="off"} 0`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics lack %s:\n%s", want, rec.Body)
+		}
+	}
+}
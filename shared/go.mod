@@ -0,0 +1,5 @@
+module github.com/nisatyap/shared
+
+go 1.21
+
+require golang.org/x/sync v0.8.0
@@ -0,0 +1,32 @@
+// Package hostmatch is how the policy engine and the proxy match host
+// names against the wildcard and regex rules of a policy, so that a dry
+// run on the engine blocks exactly what the proxy would.
+package hostmatch
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Wildcard reports whether a host's labels match a pattern such as
+// *.example.com, where '*' stands for any run of characters within a label.
+// A malformed pattern matches nothing.
+func Wildcard(pattern string, labels []string) bool {
+	patternLabels := strings.Split(pattern, ".")
+	if len(patternLabels) != len(labels) {
+		return false
+	}
+	for i, p := range patternLabels {
+		if ok, _ := path.Match(p, labels[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Regex compiles the pattern of a regex rule anchored at both ends, so it
+// must match the whole host name
+func Regex(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
@@ -0,0 +1,54 @@
+package hostmatch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "a.b.example.com", false},
+		{"ad*.example.com", "ads.example.com", true},
+		{"ad*.example.com", "bad.example.com", false},
+		{"*.*.example.com", "a.b.example.com", true},
+		{"www.example.*", "www.example.net", true},
+		{"?.example.com", "a.example.com", true},
+		{"?.example.com", "ab.example.com", false},
+		{"[.example.com", "[.example.com", false}, // a malformed pattern matches nothing
+	}
+	for _, tt := range tests {
+		if got := Wildcard(tt.pattern, strings.Split(tt.host, ".")); got != tt.want {
+			t.Errorf("Wildcard(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestRegex(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{`ads[0-9]+\.example\.com`, "ads1.example.com", true},
+		{`ads[0-9]+\.example\.com`, "ads1.example.com.evil.test", false},
+		{`ads[0-9]+\.example\.com`, "xads1.example.com", false},
+		{`a|b\.example\.com`, "a", true},
+		{`a|b\.example\.com`, "a.example.com", false}, // the alternation is anchored as a whole
+	}
+	for _, tt := range tests {
+		re, err := Regex(tt.pattern)
+		if err != nil {
+			t.Fatalf("Regex(%q): %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.host); got != tt.want {
+			t.Errorf("Regex(%q) matches %q = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+	if _, err := Regex("ads("); err == nil {
+		t.Error("Regex compiled a malformed pattern")
+	}
+}
@@ -0,0 +1,242 @@
+// Package httpclient is the HTTP client the services call each other
+// with. It retries what is safe to retry, backing off between attempts and
+// honouring Retry-After, stops when the request's context is done, and
+// reports every attempt to a hook for metrics and logs.
+//
+// A request is retried after a network error or a 429, 502, 503 or 504
+// response, and only if it is idempotent: a GET, HEAD, OPTIONS, PUT or
+// DELETE, or any request with an Idempotency-Key header, whose body, if
+// any, can be read again.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configure New
+type Options struct {
+	// Timeout limits each attempt, reading the response body included;
+	// zero means no limit
+	Timeout time.Duration
+	// Attempts is how many times a request is tried at most, 1 if zero
+	Attempts int
+	// Backoff spaces the attempts out
+	Backoff Backoff
+	// TLS configures https:// connections; nil uses the defaults
+	TLS *tls.Config
+	// Proxy is the URL of the proxy requests go through; empty uses the
+	// environment's $HTTPS_PROXY, $HTTP_PROXY and $NO_PROXY
+	Proxy string
+	// UserAgent, when set, is sent on requests that don't set their own
+	UserAgent string
+	// OnAttempt, when set, is called after every attempt
+	OnAttempt func(Attempt)
+}
+
+// Backoff is how long to wait between attempts: Base after the first,
+// doubling after each one after that up to Max, each wait scaled by a
+// random factor from 1-Jitter to 1+Jitter so that clients that failed
+// together don't retry together
+type Backoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+// DefaultBackoff is the Backoff of Options that leave it zero
+var DefaultBackoff = Backoff{Base: time.Second, Max: 30 * time.Second, Jitter: 0.2}
+
+// Delay returns the wait after the given attempt, counting from 1
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Base
+	for i := 1; i < attempt && (b.Max <= 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if b.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + min(b.Jitter, 1)*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// Attempt describes one try at a request, for OnAttempt
+type Attempt struct {
+	Request *http.Request
+	// Number counts the attempts at the request from 1
+	Number int
+	// StatusCode is the response's status, or 0 if Err is set
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+	// Retry is the wait before the next attempt, if there will be one
+	Retry time.Duration
+}
+
+// Client sends requests as its Options say. It is safe for concurrent use.
+type Client struct {
+	opts   Options
+	client *http.Client
+	stream *http.Client
+}
+
+// New returns a Client for opts. It returns an error only for an invalid
+// Proxy.
+func New(opts Options) (*Client, error) {
+	if opts.Attempts < 1 {
+		opts.Attempts = 1
+	}
+	if opts.Backoff == (Backoff{}) {
+		opts.Backoff = DefaultBackoff
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.TLS != nil {
+		transport.TLSClientConfig = opts.TLS
+	}
+	if opts.Proxy != "" {
+		u, err := url.Parse(opts.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	return &Client{
+		opts:   opts,
+		client: &http.Client{Transport: transport, Timeout: opts.Timeout},
+		stream: &http.Client{Transport: transport},
+	}, nil
+}
+
+// WithAttempts returns a copy of c that tries each request up to n times
+func (c *Client) WithAttempts(n int) *Client {
+	clone := *c
+	clone.opts.Attempts = max(n, 1)
+	return &clone
+}
+
+// Do sends req, retrying it as the package doc describes. It returns the
+// last response, or if the last attempt failed, its error. Like
+// http.Client.Do, it returns a response whatever its status, and the
+// caller must close its body.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if c.opts.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+	ctx := req.Context()
+	for n := 1; ; n++ {
+		if n > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		start := time.Now()
+		resp, err := c.client.Do(req)
+		attempt := Attempt{Request: req, Number: n, Err: err, Duration: time.Since(start)}
+		if err == nil {
+			attempt.StatusCode = resp.StatusCode
+		}
+
+		retry := n < c.opts.Attempts && ctx.Err() == nil && retryable(req, resp, err)
+		if retry {
+			attempt.Retry = c.opts.Backoff.Delay(n)
+			if wait := retryAfter(resp); wait > attempt.Retry {
+				attempt.Retry = wait
+			}
+		}
+		if c.opts.OnAttempt != nil {
+			c.opts.OnAttempt(attempt)
+		}
+		if !retry {
+			if err != nil && n > 1 {
+				err = fmt.Errorf("after %d attempts: %w", n, err)
+			}
+			return resp, err
+		}
+
+		if resp != nil {
+			// Drained, the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(attempt.Retry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Get fetches url
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Stream sends req once, without Timeout, for responses such as event
+// streams that stay open; req's context ends it
+func (c *Client) Stream(req *http.Request) (*http.Response, error) {
+	if c.opts.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+	return c.stream.Do(req)
+}
+
+// retryable reports whether a request that got resp or err may be tried
+// again
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the wait a 429 or 503 response asks for in its
+// Retry-After header, in seconds or as a date
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
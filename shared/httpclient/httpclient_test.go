@@ -0,0 +1,159 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fast is a backoff short enough for tests
+var fast = Backoff{Base: time.Millisecond, Max: 4 * time.Millisecond}
+
+// failing serves status to the first failures requests, then 200 with the
+// request body echoed
+func failing(failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	return srv, &calls
+}
+
+func TestRetries(t *testing.T) {
+	srv, calls := failing(2, http.StatusServiceUnavailable)
+	defer srv.Close()
+	var attempts []Attempt
+	c, err := New(Options{Attempts: 3, Backoff: fast, UserAgent: "test/1", OnAttempt: func(a Attempt) { attempts = append(attempts, a) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("report"))
+	req.Header.Set("Idempotency-Key", "k1")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "report" || calls.Load() != 3 {
+		t.Errorf("got %d %q after %d calls, want 200 \"report\" after 3", resp.StatusCode, body, calls.Load())
+	}
+	if len(attempts) != 3 || attempts[0].StatusCode != 503 || attempts[0].Retry == 0 || attempts[2].StatusCode != 200 || attempts[2].Number != 3 {
+		t.Errorf("attempts = %+v", attempts)
+	}
+	if got := req.Header.Get("User-Agent"); got != "test/1" {
+		t.Errorf("User-Agent = %q", got)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		method string
+		key    string
+		status int
+		calls  int32
+	}{
+		{"POST without an idempotency key", http.MethodPost, "", http.StatusServiceUnavailable, 1},
+		{"client error", http.MethodGet, "", http.StatusUnauthorized, 1},
+		{"server error", http.MethodGet, "", http.StatusInternalServerError, 1},
+		{"attempts used up", http.MethodGet, "", http.StatusTooManyRequests, 3},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			srv, calls := failing(10, c.status)
+			defer srv.Close()
+			client, _ := New(Options{Attempts: 3, Backoff: fast})
+			req, _ := http.NewRequest(c.method, srv.URL, bytes.NewReader([]byte("x")))
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.status || calls.Load() != c.calls {
+				t.Errorf("got %d after %d calls, want %d after %d", resp.StatusCode, calls.Load(), c.status, c.calls)
+			}
+		})
+	}
+}
+
+func TestNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	var n int
+	c, _ := New(Options{Attempts: 2, Backoff: fast, OnAttempt: func(Attempt) { n++ }})
+	_, err := c.Get(context.Background(), srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") || n != 2 {
+		t.Errorf("Get of a closed server = %v after %d attempts", err, n)
+	}
+}
+
+func TestContextStopsRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	c, _ := New(Options{Attempts: 5, Backoff: fast})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Get(ctx, srv.URL); err != context.DeadlineExceeded {
+		t.Errorf("Get = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Get waited out Retry-After despite its context")
+	}
+}
+
+func TestTimeoutAndStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("late"))
+	}))
+	defer srv.Close()
+	c, _ := New(Options{Timeout: 20 * time.Millisecond})
+	if _, err := c.Get(context.Background(), srv.URL); err == nil {
+		t.Error("Get outlived its timeout")
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Stream(req)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Base: time.Second, Max: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 60: 5 * time.Second} {
+		if got := b.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(2); d < time.Second || d > 3*time.Second {
+			t.Fatalf("Delay(2) with jitter 0.5 = %v", d)
+		}
+	}
+}
+
+func TestInvalidProxy(t *testing.T) {
+	if _, err := New(Options{Proxy: "not a url"}); err == nil {
+		t.Error("New accepted an invalid proxy URL")
+	}
+	if _, err := New(Options{Proxy: "http://proxy.internal:3128"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,275 @@
+// Package lifecycle runs a service from startup to shutdown: the servers
+// and background workers it starts, the signals that stop it, and the
+// order it stops in.
+//
+// A service starts its parts in order on a Run, each registered as it
+// starts, then waits:
+//
+//	run := lifecycle.New(lifecycle.Options{})
+//	run.Every("stale check", time.Minute, watcher.Check)
+//	run.Go("policy stream", followStream)
+//	run.Serve("api", server, server.ListenAndServe)
+//	if err := run.Wait(); err != nil { ... return 1 }
+//
+// The run stops on SIGINT or SIGTERM, when Stop is called, or when a
+// worker or server fails. Its context is then cancelled, and its parts are
+// stopped in the reverse of the order they were registered in, each
+// within the shutdown timeout: the server drains its requests first, then
+// the workers started before it return. Resources they share, such as a
+// store, are closed by the service's deferred calls once Wait returns.
+// Workers run on an errgroup, so the first one to fail stops the rest, and
+// a worker that ignores its context can't hold the service up past the
+// timeout.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultShutdownTimeout is how long each part has to stop when Options
+// leave ShutdownTimeout zero
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Options configure New
+type Options struct {
+	// ShutdownTimeout bounds how long each part may take to stop
+	ShutdownTimeout time.Duration
+	// Signals stop the run; nil means SIGINT and SIGTERM
+	Signals []os.Signal
+	// Stop, if set, stops the run when a signal arrives on it, as from a
+	// service manager rather than the OS
+	Stop <-chan os.Signal
+}
+
+// Run is a running service. Its methods may be called from any goroutine.
+type Run struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	group   *errgroup.Group
+	timeout time.Duration
+
+	mu      sync.Mutex
+	stops   []stopper
+	signal  os.Signal
+	failure error
+}
+
+// stopper is a registered part's way of stopping
+type stopper struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// started holds the Runs in the process that New created and Wait hasn't
+// finished stopping
+var started = struct {
+	sync.Mutex
+	runs    map[*Run]bool
+	changed chan struct{} // closed, and replaced, whenever runs changes
+}{runs: make(map[*Run]bool), changed: make(chan struct{})}
+
+// StopAll stops every Run in the process, as a signal would, so a binary
+// running several services, like swg up, can shut the rest down when one
+// exits. A Run New creates afterwards is not stopped: wait with Running
+// for every service to start first.
+func StopAll() {
+	started.Lock()
+	defer started.Unlock()
+	for r := range started.runs {
+		r.cancel()
+	}
+}
+
+// Running returns how many Runs in the process have started and not yet
+// stopped, and a channel that is closed when that changes
+func Running() (int, <-chan struct{}) {
+	started.Lock()
+	defer started.Unlock()
+	return len(started.runs), started.changed
+}
+
+// track adds r to the started Runs, or removes it once it has stopped
+func track(r *Run, running bool) {
+	started.Lock()
+	defer started.Unlock()
+	if running {
+		started.runs[r] = true
+	} else {
+		delete(started.runs, r)
+	}
+	close(started.changed)
+	started.changed = make(chan struct{})
+}
+
+// New starts a run, which stops as the package doc describes
+func New(opts Options) *Run {
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if opts.Signals == nil {
+		opts.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Run{cancel: cancel, timeout: opts.ShutdownTimeout}
+	r.group, r.ctx = errgroup.WithContext(ctx)
+	track(r, true)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, opts.Signals...)
+	go func() {
+		defer signal.Stop(signals)
+		var sig os.Signal
+		select {
+		case sig = <-signals:
+		case sig = <-opts.Stop:
+		case <-r.ctx.Done():
+			return
+		}
+		r.mu.Lock()
+		r.signal = sig
+		r.mu.Unlock()
+		cancel()
+	}()
+	return r
+}
+
+// Context is done once the run is stopping
+func (r *Run) Context() context.Context {
+	return r.ctx
+}
+
+// Go runs worker until the run stops. A worker that returns nil before
+// then just ends; one that returns an error stops the run. The run waits
+// for it, when stopping, once the parts registered after it have stopped.
+func (r *Run) Go(name string, worker func(ctx context.Context) error) {
+	done := make(chan struct{})
+	r.group.Go(func() error {
+		defer close(done)
+		if err := worker(r.ctx); err != nil && r.ctx.Err() == nil {
+			r.fail(fmt.Errorf("%s: %w", name, err))
+			return err
+		}
+		return nil
+	})
+	r.OnStop(name, func(ctx context.Context) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return errors.New("did not stop in time")
+		}
+	})
+}
+
+// Every runs task every interval, the first time an interval from now,
+// until the run stops
+func (r *Run) Every(name string, interval time.Duration, task func(ctx context.Context)) {
+	r.Go(name, func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				task(ctx)
+			}
+		}
+	})
+}
+
+// Serve runs serve, such as srv.ListenAndServe, until the run stops, then
+// shuts srv down gracefully, letting the requests it is serving finish.
+// A server that fails stops the run.
+func (r *Run) Serve(name string, srv *http.Server, serve func() error) {
+	r.Go(name, func(context.Context) error {
+		if err := serve(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+	// Registered after the worker, so it runs before the worker is waited
+	// for: Shutdown is what makes serve return
+	r.OnStop(name+" shutdown", func(ctx context.Context) error {
+		err := srv.Shutdown(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			srv.Close()
+		}
+		return err
+	})
+}
+
+// OnStop registers fn to be called when the run stops, after the parts
+// registered after it have stopped, with a context that ends at the
+// shutdown timeout
+func (r *Run) OnStop(name string, fn func(ctx context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stops = append(r.stops, stopper{name: name, stop: fn})
+}
+
+// Stop stops the run, as a signal would
+func (r *Run) Stop() {
+	r.cancel()
+}
+
+// Signal returns the signal that stopped the run, if one did
+func (r *Run) Signal() os.Signal {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.signal
+}
+
+// fail stops the run for err, the first failure it had
+func (r *Run) fail(err error) {
+	r.mu.Lock()
+	if r.failure == nil {
+		r.failure = err
+	}
+	r.mu.Unlock()
+	r.cancel()
+}
+
+// Wait blocks until the run stops, then stops its parts, last registered
+// first. It returns the failure that stopped the run, if any, joined with
+// the errors of parts that failed to stop.
+func (r *Run) Wait() error {
+	<-r.ctx.Done()
+	r.cancel()
+
+	r.mu.Lock()
+	stops := r.stops
+	r.stops = nil
+	r.mu.Unlock()
+	errs := []error{r.failed()}
+	stuck := false
+	for i := len(stops) - 1; i >= 0; i-- {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		if err := stops[i].stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", stops[i].name, err))
+			stuck = stuck || ctx.Err() != nil
+		}
+		cancel()
+	}
+	if !stuck {
+		r.group.Wait() // every worker has returned; their errors are recorded
+	}
+	track(r, false)
+	return errors.Join(errs...)
+}
+
+func (r *Run) failed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failure
+}
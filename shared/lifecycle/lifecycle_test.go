@@ -0,0 +1,163 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStopsInReverseOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, s)
+	}
+
+	run := New(Options{})
+	run.OnStop("store", func(context.Context) error { record("store closed"); return nil })
+	run.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond) // finishing up
+		record("worker returned")
+		return nil
+	})
+	ticks := make(chan struct{}, 10)
+	run.Every("ticker", time.Millisecond, func(context.Context) { ticks <- struct{}{} })
+	run.OnStop("server", func(context.Context) error { record("server drained"); return nil })
+
+	<-ticks
+	run.Stop()
+	if err := run.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	want := "server drained,worker returned,store closed"
+	if got := strings.Join(order, ","); got != want {
+		t.Errorf("stopped in order %s, want %s", got, want)
+	}
+	if run.Signal() != nil {
+		t.Errorf("Signal = %v after Stop", run.Signal())
+	}
+}
+
+func TestWorkerFailureStopsRun(t *testing.T) {
+	run := New(Options{})
+	stopped := make(chan struct{})
+	run.Go("importer", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err() // errors while stopping aren't failures
+	})
+	run.Go("stream", func(context.Context) error { return errors.New("connection refused") })
+	err := run.Wait()
+	if err == nil || err.Error() != "stream: connection refused" {
+		t.Errorf("Wait = %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("the other worker was not stopped")
+	}
+}
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+	run := New(Options{})
+	run.Serve("api", srv, func() error { return srv.Serve(ln) })
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	<-started
+	run.Stop()
+	if err := run.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("request in flight at shutdown failed: %v", err)
+	}
+
+	// A server that can't start stops the run
+	run = New(Options{})
+	run.Serve("api", &http.Server{}, func() error { return errors.New("address already in use") })
+	if err := run.Wait(); err == nil || !strings.Contains(err.Error(), "address already in use") {
+		t.Errorf("Wait = %v", err)
+	}
+}
+
+func TestStuckWorkerTimesOut(t *testing.T) {
+	run := New(Options{ShutdownTimeout: 20 * time.Millisecond})
+	block := make(chan struct{})
+	defer close(block)
+	run.Go("stuck", func(context.Context) error { <-block; return nil })
+	run.Stop()
+	start := time.Now()
+	if err := run.Wait(); err == nil || !strings.Contains(err.Error(), "stopping stuck: did not stop in time") {
+		t.Errorf("Wait = %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Wait waited for a stuck worker")
+	}
+}
+
+func TestStopChannel(t *testing.T) {
+	stop := make(chan os.Signal, 1)
+	run := New(Options{Stop: stop})
+	stop <- syscall.SIGTERM
+	if err := run.Wait(); err != nil || run.Signal() != syscall.SIGTERM {
+		t.Errorf("Wait = %v, Signal = %v", err, run.Signal())
+	}
+}
+
+func TestStopAll(t *testing.T) {
+	before, _ := Running()
+	a, b := New(Options{}), New(Options{})
+	n, changed := Running()
+	if n != before+2 {
+		t.Fatalf("Running = %d, want %d", n, before+2)
+	}
+	StopAll()
+	for _, run := range []*Run{a, b} {
+		if err := run.Wait(); err != nil {
+			t.Errorf("Wait = %v", err)
+		}
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("Running's channel was not closed when the runs stopped")
+	}
+	if n, _ := Running(); n != before {
+		t.Errorf("Running after Wait = %d, want %d", n, before)
+	}
+
+	// A run started after StopAll is left running
+	c := New(Options{})
+	if c.Context().Err() != nil {
+		t.Error("a run started after StopAll was stopped")
+	}
+	c.Stop()
+	c.Wait()
+}
@@ -0,0 +1,181 @@
+// Package logging sets up the log/slog loggers the services share, so that
+// their records carry the same fields under the same names: the service
+// and its version on every record, and the request and device a record is
+// about on those logged with a context that names them.
+//
+//	opts := logging.Options{Service: "proxy", Version: version}
+//	opts.AddFlags(flag.CommandLine)
+//	flag.Parse()
+//	logger, err := logging.New(opts)
+//	...
+//	logger.InfoContext(logging.WithRequestID(ctx, id), "blocked", "host", host)
+//
+// Services pass their logger to what they run rather than installing it
+// with slog.SetDefault, since swg up runs several services in one process
+// and each logs as itself. Code that only has a request's context logs to
+// FromContext, the logger middleware.Log put there.
+package logging
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// The keys of the fields the services have in common
+const (
+	KeyService   = "service"
+	KeyVersion   = "version"
+	KeyRequestID = "request_id"
+	KeyDeviceID  = "device_id"
+)
+
+// Formats that New can write records in
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configure New
+type Options struct {
+	// Service and Version, when set, are added to every record
+	Service string
+	Version string
+	// Level is the lowest level logged, info if nil. It can be changed
+	// while the service runs, such as from an admin endpoint.
+	Level *slog.LevelVar
+	// Format is FormatText, the default, or FormatJSON
+	Format string
+	// Output is where records are written, os.Stderr if nil
+	Output io.Writer
+}
+
+// AddFlags registers -log-level and -log-format on fs, setting o.Level
+// and o.Format
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	if o.Level == nil {
+		o.Level = new(slog.LevelVar)
+	}
+	if o.Format == "" {
+		o.Format = FormatText
+	}
+	fs.TextVar(o.Level, "log-level", o.Level, "Lowest level logged: debug, info, warn or error")
+	fs.StringVar(&o.Format, "log-format", o.Format, "Log format: text or json")
+}
+
+// New returns a logger writing as opts say
+func New(opts Options) (*slog.Logger, error) {
+	h, err := NewHandler(opts)
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(h), nil
+}
+
+// NewHandler returns the handler behind New, for services that wrap it in
+// handlers of their own
+func NewHandler(opts Options) (slog.Handler, error) {
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	var level slog.Leveler = slog.LevelInfo
+	if opts.Level != nil {
+		level = opts.Level
+	}
+	hopts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	switch opts.Format {
+	case FormatText, "":
+		h = slog.NewTextHandler(out, hopts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(out, hopts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q (want text or json)", opts.Format)
+	}
+
+	var attrs []slog.Attr
+	if opts.Service != "" {
+		attrs = append(attrs, slog.String(KeyService, opts.Service))
+	}
+	if opts.Version != "" {
+		attrs = append(attrs, slog.String(KeyVersion, opts.Version))
+	}
+	if len(attrs) > 0 {
+		h = h.WithAttrs(attrs)
+	}
+	return ContextHandler{h}, nil
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	deviceIDKey
+	loggerKey
+)
+
+// WithLogger returns a copy of ctx carrying the logger of the service it
+// belongs to
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger in ctx, or slog.Default() if there is
+// none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a copy of ctx naming the request it is serving
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID in ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithDeviceID returns a copy of ctx naming the device it is about
+func WithDeviceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, deviceIDKey, id)
+}
+
+// DeviceID returns the device ID in ctx, or "" if there is none
+func DeviceID(ctx context.Context) string {
+	id, _ := ctx.Value(deviceIDKey).(string)
+	return id
+}
+
+// ContextHandler adds the request and device IDs in a record's context to
+// the record before passing it on
+type ContextHandler struct {
+	slog.Handler
+}
+
+func (h ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	if id := DeviceID(ctx); id != "" {
+		r.AddAttrs(slog.String(KeyDeviceID, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return ContextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h ContextHandler) WithGroup(name string) slog.Handler {
+	return ContextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(Options{Service: "proxy", Version: "1.2.3", Format: FormatJSON, Output: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithDeviceID(WithRequestID(context.Background(), "req-1"), "laptop-1")
+	logger.InfoContext(ctx, "blocked", "host", "example.com")
+	logger.Debug("not logged at info")
+
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("%v in %q", err, out.String())
+	}
+	for key, want := range map[string]string{
+		"msg": "blocked", "level": "INFO", "host": "example.com",
+		KeyService: "proxy", KeyVersion: "1.2.3", KeyRequestID: "req-1", KeyDeviceID: "laptop-1",
+	} {
+		if record[key] != want {
+			t.Errorf("record has %s = %v, want %q", key, record[key], want)
+		}
+	}
+}
+
+func TestContextWithoutIDs(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(Options{Output: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.With("component", "stream").InfoContext(context.Background(), "connected")
+	line := out.String()
+	if !strings.Contains(line, "msg=connected component=stream") {
+		t.Errorf("logged %q", line)
+	}
+	for _, key := range []string{KeyService, KeyVersion, KeyRequestID, KeyDeviceID} {
+		if strings.Contains(line, key+"=") {
+			t.Errorf("logged %q, with an empty %s", line, key)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != slog.Default() {
+		t.Errorf("FromContext without a logger = %v, want slog.Default()", got)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if got := FromContext(WithLogger(context.Background(), logger)); got != logger {
+		t.Errorf("FromContext = %v, want the logger put there", got)
+	}
+}
+
+func TestFlagsAndLevel(t *testing.T) {
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts.AddFlags(fs)
+	if err := fs.Parse([]string{"-log-level", "warn", "-log-format", "json"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Level.Level() != slog.LevelWarn || opts.Format != FormatJSON {
+		t.Fatalf("flags set level %v, format %q", opts.Level.Level(), opts.Format)
+	}
+
+	var out bytes.Buffer
+	opts.Output = &out
+	logger, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("quiet")
+	opts.Level.Set(slog.LevelDebug)
+	logger.Debug("loud")
+	if got := out.String(); strings.Contains(got, "quiet") || !strings.Contains(got, "loud") {
+		t.Errorf("changing the level while running logged %q", got)
+	}
+
+	if err := fs.Parse([]string{"-log-level", "chatty"}); err == nil {
+		t.Error("-log-level accepted chatty")
+	}
+	if _, err := New(Options{Format: "xml"}); err == nil {
+		t.Error("New accepted format xml")
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CheckTimeout limits each health check
+var CheckTimeout = 5 * time.Second
+
+// Check reports whether something a service depends on, such as its
+// database, is usable
+type Check func(ctx context.Context) error
+
+// health is the body of a /healthz reply
+type health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Healthz answers health checks. It runs checks, by name, concurrently
+// and replies 200 {"status":"ok"} if all pass, or 503
+// {"status":"unavailable"} if any fails, with each check's result, "ok" or
+// its error, under "checks". With no checks it reports that the service
+// is up.
+func Healthz(checks map[string]Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), CheckTimeout)
+		defer cancel()
+
+		reply := health{Status: "ok"}
+		if len(checks) > 0 {
+			reply.Checks = make(map[string]string, len(checks))
+		}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for name, check := range checks {
+			wg.Add(1)
+			go func(name string, check Check) {
+				defer wg.Done()
+				err := check(ctx)
+				mu.Lock()
+				defer mu.Unlock()
+				reply.Checks[name] = "ok"
+				if err != nil {
+					reply.Checks[name] = err.Error()
+					reply.Status = "unavailable"
+				}
+			}(name, check)
+		}
+		wg.Wait()
+
+		code := http.StatusOK
+		if reply.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(reply)
+	})
+}
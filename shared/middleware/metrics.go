@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/promtext"
+)
+
+// durationBuckets are the request duration histogram bounds in seconds
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Routes that label requests that a ServeMux matched to no pattern, and
+// those to a handler that isn't a ServeMux
+const (
+	RouteUnmatched = "unmatched"
+	RouteAll       = "*"
+)
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+type requestKey struct {
+	method, route string
+	code          int
+}
+
+// Metrics counts and times requests, for every service under the same
+// names:
+//
+//	http_requests_total{method,route,code}
+//	http_request_duration_seconds{route}
+//	http_requests_in_flight
+//
+// The route is the ServeMux pattern a request matched, so that paths such
+// as /devices/{hostname} make one series and not one per device. A nil
+// *Metrics counts nothing.
+type Metrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+	inFlight  int64
+}
+
+// NewMetrics returns Metrics with nothing counted yet
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+// Middleware counts and times the requests to next. If next is a
+// *http.ServeMux, requests are labelled with the pattern they match;
+// otherwise they all have the route RouteAll.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	mux, _ := next.(*http.ServeMux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := RouteAll
+		if mux != nil {
+			if _, route = mux.Handler(r); route == "" {
+				route = RouteUnmatched
+			}
+		}
+		start := time.Now()
+		rec := record(w)
+		m.mu.Lock()
+		m.inFlight++
+		m.mu.Unlock()
+		defer func() {
+			code := rec.status
+			p := recover()
+			if p != nil {
+				// Recover, further out, will answer with a 500
+				code = http.StatusInternalServerError
+			}
+			m.observe(r.Method, route, code, time.Since(start))
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func (m *Metrics) observe(method, route string, code int, d time.Duration) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+	default:
+		method = "other" // so that made up methods don't make series
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	m.requests[requestKey{method, route, code}]++
+	h := m.durations[route]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(durationBuckets)+1)}
+		m.durations[route] = h
+	}
+	seconds := d.Seconds()
+	h.counts[sort.SearchFloat64s(durationBuckets, seconds)]++
+	h.sum += seconds
+	h.count++
+}
+
+// Handler serves the metrics in the Prometheus text format, followed by
+// those that each of more serves, so that a service's own metrics and
+// these share one /metrics. The headers and status that more set are
+// ignored; nil handlers are skipped.
+func (m *Metrics) Handler(more ...http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		if m != nil {
+			m.render(&b)
+		}
+		for _, h := range more {
+			if h != nil {
+				h.ServeHTTP(&bodyOnly{w: &b, header: make(http.Header)}, r)
+			}
+		}
+		w.Header().Set("Content-Type", promtext.ContentType)
+		fmt.Fprint(w, b.String())
+	})
+}
+
+// bodyOnly is a ResponseWriter that keeps only the body
+type bodyOnly struct {
+	w      io.Writer
+	header http.Header
+}
+
+func (b *bodyOnly) Header() http.Header         { return b.header }
+func (b *bodyOnly) Write(p []byte) (int, error) { return b.w.Write(p) }
+func (b *bodyOnly) WriteHeader(int)             {}
+
+func (m *Metrics) render(b *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	promtext.Header(b, "http_requests_total", "counter", "HTTP requests answered, by method, route and status code.")
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		promtext.Sample(b, "http_requests_total", map[string]string{"method": k.method, "route": k.route, "code": strconv.Itoa(k.code)}, float64(m.requests[k]))
+	}
+
+	promtext.Header(b, "http_requests_in_flight", "gauge", "HTTP requests being answered now.")
+	promtext.Sample(b, "http_requests_in_flight", nil, float64(m.inFlight))
+
+	const duration = "http_request_duration_seconds"
+	promtext.Header(b, duration, "histogram", "HTTP request duration by route.")
+	for _, route := range sortedKeys(m.durations) {
+		h := m.durations[route]
+		var cumulative uint64
+		for i, bound := range durationBuckets {
+			cumulative += h.counts[i]
+			promtext.Sample(b, duration+"_bucket", map[string]string{"route": route, "le": strconv.FormatFloat(bound, 'f', -1, 64)}, float64(cumulative))
+		}
+		promtext.Sample(b, duration+"_bucket", map[string]string{"route": route, "le": "+Inf"}, float64(h.count))
+		promtext.Sample(b, duration+"_sum", map[string]string{"route": route}, h.sum)
+		promtext.Sample(b, duration+"_count", map[string]string{"route": route}, float64(h.count))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,206 @@
+// Package middleware holds the HTTP handlers every service wraps its routes
+// in, so that their HTTP surfaces behave alike: a request ID on every
+// request and every log record about it, panics answered with a 500
+// instead of a dropped connection, a log record per request, Prometheus
+// metrics on GET /metrics and a health check on GET /healthz.
+//
+//	httpMetrics := middleware.NewMetrics()
+//	mux.Handle("GET /healthz", middleware.Healthz(checks))
+//	mux.Handle("GET /metrics", httpMetrics.Handler(registry))
+//	handler := middleware.Chain(mux,
+//		middleware.RequestID,
+//		middleware.Log(logger),
+//		middleware.Recover(logger),
+//		httpMetrics.Middleware,
+//	)
+//
+// httpMetrics.Middleware goes last, wrapping the mux itself, so that it
+// can label requests with the pattern they matched.
+package middleware
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/logging"
+)
+
+// HeaderRequestID carries a request's ID, in requests and their responses
+const HeaderRequestID = "X-Request-ID"
+
+// Middleware wraps a handler in another
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in mw, the first outermost, so that a request goes through
+// them in the order given
+func Chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// RequestID gives each request an ID: the X-Request-ID it came with if
+// that is a plausible one, so that a request keeps its ID from service to
+// service, or a new random one. The ID is set on the response and added
+// to the request's context for logging.RequestID, so that records logged
+// with that context carry it.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts up to 128 letters, digits and -_.: so that a
+// client can't put anything else into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.ContainsRune("-_.:", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Recover answers a request whose handler panics with a 500, if nothing
+// was written yet, and logs the panic with its stack to logger, or
+// slog.Default() if nil. http.ErrAbortHandler is let through, as the
+// server expects.
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := record(w)
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				loggerOr(logger).ErrorContext(r.Context(), "handler panicked",
+					"method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+				if !rec.wroteHeader {
+					rec.Header().Set("Content-Type", "application/json")
+					rec.WriteHeader(http.StatusInternalServerError)
+					rec.Write([]byte(`{"error":"internal server error"}` + "\n"))
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// Log logs a record of each request to logger, or slog.Default() if nil,
+// once it is answered: at error level for 5xx responses, at debug level
+// for health checks and metrics scrapes so that they don't drown the rest,
+// and at info level otherwise. Placed after RequestID, the record carries
+// the request's ID. Handlers and the shared packages they call find logger
+// in the request's context with logging.FromContext.
+func Log(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := record(w)
+			if logger != nil {
+				r = r.WithContext(logging.WithLogger(r.Context(), logger))
+			}
+			next.ServeHTTP(rec, r)
+
+			level := slog.LevelInfo
+			switch {
+			case rec.status >= 500:
+				level = slog.LevelError
+			case r.URL.Path == "/healthz" || r.URL.Path == "/metrics":
+				level = slog.LevelDebug
+			}
+			loggerOr(logger).Log(r.Context(), level, "request",
+				"method", r.Method, "path", r.URL.Path, "status", rec.status, "bytes", rec.bytes,
+				"duration", time.Since(start), "remote_addr", r.RemoteAddr)
+		})
+	}
+}
+
+func loggerOr(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// recorder notes the status and size of a response. It passes Flush and
+// Hijack through, and Unwrap lets http.ResponseController reach the
+// writer it wraps.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// record wraps w in a recorder, or returns w if it already is one, so that
+// middleware stacked on middleware share one
+func record(w http.ResponseWriter) *recorder {
+	if rec, ok := w.(*recorder); ok {
+		return rec
+	}
+	return &recorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *recorder) Flush() {
+	r.wroteHeader = true
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", r.ResponseWriter)
+	}
+	r.wroteHeader = true
+	return h.Hijack()
+}
+
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nisatyap/shared/logging"
+)
+
+// stack is the chain the services use, over a mux with a few routes
+func stack(t *testing.T, m *Metrics, out *bytes.Buffer) http.Handler {
+	t.Helper()
+	logger, err := logging.New(logging.Options{Format: logging.FormatJSON, Output: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/devices/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, logging.RequestID(r.Context()))
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	mux.HandleFunc("/enroll", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).InfoContext(r.Context(), "enrolled")
+	})
+	mux.Handle("/healthz", Healthz(nil))
+	mux.Handle("/metrics", m.Handler())
+	return Chain(mux, RequestID, Log(logger), Recover(logger), m.Middleware)
+}
+
+func get(h http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v[0])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// records decodes the JSON log records in out
+func records(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var all []map[string]any
+	if out.Len() == 0 {
+		return nil
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%v in %q", err, line)
+		}
+		all = append(all, record)
+	}
+	out.Reset()
+	return all
+}
+
+func TestRequestID(t *testing.T) {
+	var out bytes.Buffer
+	h := stack(t, NewMetrics(), &out)
+
+	rec := get(h, "/devices/laptop-1", http.Header{HeaderRequestID: {"from-the-gateway"}})
+	if got := rec.Header().Get(HeaderRequestID); got != "from-the-gateway" || rec.Body.String() != got {
+		t.Errorf("kept ID: header %q, handler saw %q", got, rec.Body.String())
+	}
+	if log := records(t, &out); len(log) != 1 || log[0][logging.KeyRequestID] != "from-the-gateway" || log[0]["status"] != 200.0 {
+		t.Errorf("logged %v", log)
+	}
+
+	for _, sent := range []string{"", "two words", strings.Repeat("x", 129)} {
+		rec := get(h, "/devices/laptop-1", http.Header{HeaderRequestID: {sent}})
+		if got := rec.Header().Get(HeaderRequestID); got == sent || len(got) != 16 || rec.Body.String() != got {
+			t.Errorf("sent %q: header %q, handler saw %q", sent, got, rec.Body.String())
+		}
+	}
+}
+
+func TestLogInContext(t *testing.T) {
+	var out bytes.Buffer
+	h := stack(t, NewMetrics(), &out)
+
+	get(h, "/enroll", http.Header{HeaderRequestID: {"enroll-1"}})
+	// The handler logs to the service's logger, not slog.Default()
+	log := records(t, &out)
+	if len(log) != 2 || log[0]["msg"] != "enrolled" || log[0][logging.KeyRequestID] != "enroll-1" || log[1]["msg"] != "request" {
+		t.Errorf("logged %v", log)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var out bytes.Buffer
+	h := stack(t, NewMetrics(), &out)
+	rec := get(h, "/panic", nil)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "internal server error") {
+		t.Errorf("panic answered %d %q", rec.Code, rec.Body.String())
+	}
+	log := records(t, &out)
+	if len(log) != 2 || log[0]["panic"] != "boom" || log[0]["stack"] == "" || log[1]["msg"] != "request" || log[1]["status"] != 500.0 || log[1]["level"] != "ERROR" {
+		t.Errorf("logged %v", log)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var out bytes.Buffer
+	m := NewMetrics()
+	h := stack(t, m, &out)
+	get(h, "/devices/a", nil)
+	get(h, "/devices/b", nil)
+	get(h, "/panic", nil)
+	get(h, "/nowhere", nil)
+	records(t, &out)
+
+	rec := get(h, "/metrics", nil)
+	body := rec.Body.String()
+	for _, want := range []string{
+		`http_requests_total{code="200",method="GET",route="/devices/"} 2`,
+		`http_requests_total{code="500",method="GET",route="/panic"} 1`,
+		`http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`http_request_duration_seconds_count{route="/devices/"} 2`,
+		`http_requests_in_flight 1`, // the scrape itself
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s:\n%s", want, body)
+		}
+	}
+	if log := records(t, &out); len(log) != 0 {
+		t.Errorf("scrape logged %v at info level", log) // it is at debug
+	}
+}
+
+func TestMetricsHandlerCombines(t *testing.T) {
+	own := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprintln(w, "mathd_requests_in_flight 0")
+	})
+	var m *Metrics
+	rec := get(m.Handler(own, nil), "/metrics", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "mathd_requests_in_flight 0\n" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("got %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	rec = get(NewMetrics().Handler(own), "/metrics", nil)
+	if body := rec.Body.String(); !strings.HasPrefix(body, "# HELP http_requests_total") || !strings.HasSuffix(body, "mathd_requests_in_flight 0\n") {
+		t.Errorf("combined metrics:\n%s", body)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	rec := get(Healthz(nil), "/healthz", nil)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"status":"ok"}` {
+		t.Errorf("no checks: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = get(Healthz(map[string]Check{
+		"store":  func(context.Context) error { return nil },
+		"policy": func(context.Context) error { return errors.New("no policy loaded yet") },
+	}), "/healthz", nil)
+	var reply health
+	json.Unmarshal(rec.Body.Bytes(), &reply)
+	if rec.Code != http.StatusServiceUnavailable || reply.Status != "unavailable" || reply.Checks["store"] != "ok" || reply.Checks["policy"] != "no policy loaded yet" {
+		t.Errorf("failing check: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	get(Chain(http.NotFoundHandler(), mark("a"), mark("b"), mark("c")), "/", nil)
+	if strings.Join(order, "") != "abc" {
+		t.Errorf("ran %v", order)
+	}
+}
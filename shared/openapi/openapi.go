@@ -0,0 +1,377 @@
+// Package openapi describes a service's HTTP API as an OpenAPI 3.0
+// document, built from its routes as they are registered, and serves it at
+// /openapi.json for client generation and contract tests.
+//
+// A service registers its routes on a Mux, which wraps its http.ServeMux,
+// each with an Operation documenting it:
+//
+//	api := spec.Mux(mux)
+//	api.HandleFunc("GET /devices/{hostname}", a.GetDevice, openapi.Operation{
+//		Summary:  "Latest status of one device",
+//		Response: store.Device{},
+//	})
+//
+// Request and response bodies are described by example Go values whose
+// types are reflected, as encoding/json would marshal them, into schemas:
+// named structs become shared components, and an Object lists the fields
+// of a body written from a map. Path parameters come from the pattern's
+// wildcards. Document.Validate checks a response against the document,
+// so tests can catch a handler drifting from what it documents.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Version is the OpenAPI version of the documents built
+const Version = "3.0.3"
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation documents one route
+type Operation struct {
+	Summary     string
+	Description string
+	// Auth names the security scheme, added with Spec.Security, the route
+	// needs; empty for none
+	Auth string
+	// Query lists the query parameters
+	Query []Param
+	// Request is a value of the JSON request body's type, or an Object;
+	// nil for none
+	Request any
+	// RequestType is the content type of a body that isn't JSON
+	RequestType string
+	// Response is a value of the JSON success response's type, or an
+	// Object; nil documents any JSON value
+	Response any
+	// ResponseType is the content type of a success response that isn't
+	// JSON, e.g. text/event-stream; several may be listed, comma-separated
+	ResponseType string
+	// Status is the success status, 200 if zero
+	Status int
+	// Responses are values of the JSON bodies of the route's other
+	// statuses, by status, where they aren't the error body
+	Responses map[int]any
+}
+
+// Param is a query parameter
+type Param struct {
+	Name        string
+	Description string
+	Type        string // string (the default), integer, number or boolean
+	Required    bool
+}
+
+// Params returns optional query parameters by name; a name may end in
+// ":integer", ":number" or ":boolean" to give its type
+func Params(names ...string) []Param {
+	params := make([]Param, 0, len(names))
+	for _, name := range names {
+		name, typ, _ := strings.Cut(name, ":")
+		params = append(params, Param{Name: name, Type: typ})
+	}
+	return params
+}
+
+// Object describes a JSON object written from a map: each value's type is
+// the schema of the field of its key. Fields are required unless Optional.
+type Object map[string]any
+
+// Optional marks a field of an Object as one that may be left out
+func Optional(value any) any {
+	return optional{value}
+}
+
+type optional struct{ value any }
+
+// SecurityScheme is how a route's caller authenticates
+type SecurityScheme struct {
+	Type         string `json:"type"`             // http or apiKey
+	Scheme       string `json:"scheme,omitempty"` // bearer or basic, for http
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`   // header, for apiKey
+	Name         string `json:"name,omitempty"` // the header, for apiKey
+	Description  string `json:"description,omitempty"`
+}
+
+// Bearer is a security scheme of bearer tokens in the Authorization header
+func Bearer(description string) SecurityScheme {
+	return SecurityScheme{Type: "http", Scheme: "bearer", Description: description}
+}
+
+// Spec collects a service's routes into its OpenAPI document. It serves
+// the document as JSON.
+type Spec struct {
+	mu       sync.Mutex
+	info     Info
+	routes   []route
+	security map[string]SecurityScheme
+	errors   any
+}
+
+type route struct {
+	method, path string
+	op           Operation
+}
+
+// New creates a spec with no routes
+func New(info Info) *Spec {
+	return &Spec{info: info, security: make(map[string]SecurityScheme)}
+}
+
+// Security adds a security scheme operations may name in Auth
+func (s *Spec) Security(name string, scheme SecurityScheme) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.security[name] = scheme
+}
+
+// Errors sets the JSON body of the error responses, documented as every
+// operation's default response
+func (s *Spec) Errors(body any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = body
+}
+
+// Add documents the route of a ServeMux pattern, such as
+// "GET /devices/{hostname}". A pattern without a method is documented as
+// GET.
+func (s *Spec) Add(pattern string, op Operation) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = http.MethodGet, pattern
+	}
+	if i := strings.IndexByte(path, '/'); i > 0 {
+		path = path[i:] // drop the host
+	}
+	path = strings.TrimSuffix(path, "{$}")
+	path = strings.ReplaceAll(path, "...}", "}")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = append(s.routes, route{method: strings.ToLower(method), path: path, op: op})
+}
+
+// Mux returns a Mux registering routes on mux and documenting them in s
+func (s *Spec) Mux(mux *http.ServeMux) *Mux {
+	return &Mux{mux: mux, spec: s}
+}
+
+// ServeHTTP serves the document
+func (s *Spec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Document())
+}
+
+// Mux registers routes on an http.ServeMux and documents them
+type Mux struct {
+	mux  *http.ServeMux
+	spec *Spec
+}
+
+// Handle registers handler for pattern, documented by op
+func (m *Mux) Handle(pattern string, handler http.Handler, op Operation) {
+	m.mux.Handle(pattern, handler)
+	m.spec.Add(pattern, op)
+}
+
+// HandleFunc registers handler for pattern, documented by op
+func (m *Mux) HandleFunc(pattern string, handler http.HandlerFunc, op Operation) {
+	m.Handle(pattern, handler, op)
+}
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                       `json:"openapi"`
+	Info       Info                         `json:"info"`
+	Paths      map[string]map[string]*OpDoc `json:"paths"` // by path, then lower-case method
+	Components Components                   `json:"components"`
+}
+
+// Components holds the schemas and security schemes operations refer to
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// OpDoc is an operation in a Document
+type OpDoc struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []ParamDoc            `json:"parameters,omitempty"`
+	RequestBody *Body                 `json:"requestBody,omitempty"`
+	Responses   map[string]*Body      `json:"responses"` // by status, or "default"
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// ParamDoc is a path or query parameter in a Document
+type ParamDoc struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path or query
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Body is a request body or a response in a Document
+type Body struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"` // by content type
+}
+
+// MediaType is the schema of a body of one content type
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Document builds the OpenAPI document of the routes added so far
+func (s *Spec) Document() *Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schemas := newSchemas()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    s.info,
+		Paths:   make(map[string]map[string]*OpDoc),
+		Components: Components{
+			Schemas:         schemas.components,
+			SecuritySchemes: s.security,
+		},
+	}
+	var errorBody *Body
+	if s.errors != nil {
+		errorBody = &Body{Description: "Error", Content: map[string]MediaType{"application/json": {Schema: schemas.of(s.errors)}}}
+	}
+
+	for _, r := range s.routes {
+		op := &OpDoc{
+			OperationID: operationID(r.method, r.path),
+			Summary:     r.op.Summary,
+			Description: r.op.Description,
+			Responses:   make(map[string]*Body),
+		}
+		if tag := tagOf(r.path); tag != "" {
+			op.Tags = []string{tag}
+		}
+		for _, name := range pathParams(r.path) {
+			op.Parameters = append(op.Parameters, ParamDoc{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		for _, p := range r.op.Query {
+			typ := p.Type
+			if typ == "" {
+				typ = "string"
+			}
+			op.Parameters = append(op.Parameters, ParamDoc{Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: &Schema{Type: typ}})
+		}
+		if r.op.Request != nil || r.op.RequestType != "" {
+			op.RequestBody = &Body{Required: true, Content: content(schemas, r.op.Request, r.op.RequestType)}
+		}
+
+		status := r.op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &Body{Description: http.StatusText(status)}
+		if status != http.StatusNoContent {
+			success.Content = content(schemas, r.op.Response, r.op.ResponseType)
+		}
+		op.Responses[strconv.Itoa(status)] = success
+		for code, value := range r.op.Responses {
+			body := &Body{Description: http.StatusText(code)}
+			if code != http.StatusNoContent {
+				body.Content = content(schemas, value, "")
+			}
+			op.Responses[strconv.Itoa(code)] = body
+		}
+		if errorBody != nil {
+			op.Responses["default"] = errorBody
+		}
+		if r.op.Auth != "" {
+			op.Security = []map[string][]string{{r.op.Auth: {}}}
+		}
+
+		if doc.Paths[r.path] == nil {
+			doc.Paths[r.path] = make(map[string]*OpDoc)
+		}
+		doc.Paths[r.path][r.method] = op
+	}
+	return doc
+}
+
+// content returns the media types of a body of value, or of the content
+// types listed
+func content(schemas *schemas, value any, types string) map[string]MediaType {
+	if types == "" {
+		return map[string]MediaType{"application/json": {Schema: schemas.of(value)}}
+	}
+	out := make(map[string]MediaType)
+	for _, typ := range strings.Split(types, ",") {
+		typ = strings.TrimSpace(typ)
+		if typ == "application/json" {
+			out[typ] = MediaType{Schema: schemas.of(value)}
+		} else {
+			out[typ] = MediaType{Schema: &Schema{Type: "string"}}
+		}
+	}
+	return out
+}
+
+// pathParams returns the names of path's parameters, in order
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, segment[1:len(segment)-1])
+		}
+	}
+	return names
+}
+
+// tagOf groups operations by the first segment of their path
+func tagOf(path string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if strings.HasPrefix(segment, "{") {
+		return ""
+	}
+	return segment
+}
+
+// operationID names an operation after its method and path, e.g.
+// getDevicesByHostnameHistory for GET /devices/{hostname}/history
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(method)
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") {
+			b.WriteString("By")
+			segment = strings.Trim(segment, "{}")
+		}
+		upper := true
+		for _, r := range segment {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				upper = true
+				continue
+			}
+			if upper {
+				r = unicode.ToUpper(r)
+				upper = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,229 @@
+// The module's go version predates method and wildcard patterns
+//go:debug httpmuxgo121=0
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type device struct {
+	Hostname string            `json:"hostname"`
+	Score    int               `json:"score"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Seen     time.Time         `json:"last_seen"`
+	Owner    *owner            `json:"owner"`
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	Count    int64             `json:"count,string,omitempty"`
+	secret   string
+	audit
+}
+
+type owner struct {
+	Name   string  `json:"name"`
+	Parent *owner  `json:"parent,omitempty"`
+	Score  float64 `json:"-"`
+}
+
+// audit is embedded, so its fields are device's
+type audit struct {
+	By   string `json:"by,omitempty"`
+	Name string `json:"hostname"` // hidden by device.Hostname
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// api is a small service documented with a Mux
+func api() (*Spec, http.Handler) {
+	spec := New(Info{Title: "Devices", Version: "1.0.0"})
+	spec.Security("bearer", Bearer("API key"))
+	spec.Errors(errorResponse{})
+	mux := http.NewServeMux()
+	m := spec.Mux(mux)
+	m.HandleFunc("GET /devices", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"total": 1, "devices": []device{{Hostname: "laptop-1"}}})
+	}, Operation{
+		Summary:  "List devices",
+		Auth:     "bearer",
+		Query:    Params("limit:integer", "status"),
+		Response: Object{"total": 0, "devices": []device{}, "next": Optional("")},
+	})
+	m.HandleFunc("GET /devices/{hostname}", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/laptop-1") {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(errorResponse{Error: "not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(device{Hostname: "laptop-1", Owner: &owner{Name: "it"}, Count: 3})
+	}, Operation{Summary: "Get a device", Response: device{}})
+	m.HandleFunc("GET /devices/stale", func(w http.ResponseWriter, r *http.Request) {
+		// Drifted: documented as a list
+		fmt.Fprint(w, `{"hostname":"laptop-1"}`)
+	}, Operation{Response: []device{}})
+	m.HandleFunc("POST /devices/{hostname}/tags", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("review") {
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"id":1}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}, Operation{
+		Request:   map[string]string{},
+		Status:    http.StatusNoContent,
+		Responses: map[int]any{http.StatusAccepted: Object{"id": 0}},
+	})
+	m.HandleFunc("GET /files/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "contents")
+	}, Operation{ResponseType: "text/plain"})
+	mux.Handle("GET /openapi.json", spec)
+	return spec, mux
+}
+
+func TestDocument(t *testing.T) {
+	_, h := api()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /openapi.json = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var doc Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != Version || doc.Info.Title != "Devices" {
+		t.Errorf("document = %s %+v", doc.OpenAPI, doc.Info)
+	}
+
+	get := doc.Paths["/devices/{hostname}"]["get"]
+	if get == nil || get.OperationID != "getDevicesByHostname" || get.Tags[0] != "devices" {
+		t.Fatalf("GET /devices/{hostname} = %+v", get)
+	}
+	if p := get.Parameters; len(p) != 1 || p[0].Name != "hostname" || p[0].In != "path" || !p[0].Required {
+		t.Errorf("parameters = %+v", p)
+	}
+	if ref := get.Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/Device" {
+		t.Errorf("response schema = %q", ref)
+	}
+	if ref := get.Responses["default"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/ErrorResponse" {
+		t.Errorf("error schema = %q", ref)
+	}
+
+	list := doc.Paths["/devices"]["get"]
+	if len(list.Security) != 1 || list.Security[0]["bearer"] == nil || doc.Components.SecuritySchemes["bearer"].Scheme != "bearer" {
+		t.Errorf("security = %v, schemes = %v", list.Security, doc.Components.SecuritySchemes)
+	}
+	if q := list.Parameters; len(q) != 2 || q[0].Schema.Type != "integer" || q[1].Schema.Type != "string" || q[1].In != "query" {
+		t.Errorf("query = %+v", q)
+	}
+	body := list.Responses["200"].Content["application/json"].Schema
+	if body.Properties["devices"].Items.Ref != "#/components/schemas/Device" || body.Properties["next"].Type != "string" || strings.Join(body.Required, ",") != "devices,total" {
+		t.Errorf("list body = %+v", body)
+	}
+
+	if files := doc.Paths["/files/{path}"]["get"]; files == nil || files.Responses["200"].Content["text/plain"].Schema.Type != "string" {
+		t.Errorf("GET /files/{path} = %+v", files)
+	}
+	tags := doc.Paths["/devices/{hostname}/tags"]["post"]
+	if tags.RequestBody.Content["application/json"].Schema.AdditionalProperties.Type != "string" || tags.Responses["204"].Content != nil || tags.Responses["202"] == nil {
+		t.Errorf("POST tags = %+v", tags)
+	}
+}
+
+func TestSchemas(t *testing.T) {
+	spec, _ := api()
+	schemas := spec.Document().Components.Schemas
+	d := schemas["Device"]
+	if d == nil {
+		t.Fatalf("schemas = %v", schemas)
+	}
+	for name, want := range map[string]string{
+		"hostname": "string", "score": "integer", "tags": "object", "last_seen": "string", "raw": "", "count": "string", "by": "string",
+	} {
+		if got := d.Properties[name]; got == nil || got.Type != want {
+			t.Errorf("%s = %+v, want type %q", name, got, want)
+		}
+	}
+	if _, ok := d.Properties["secret"]; ok {
+		t.Error("unexported field documented")
+	}
+	if d.Properties["last_seen"].Format != "date-time" || d.Properties["tags"].Nullable {
+		t.Errorf("last_seen = %+v, tags = %+v", d.Properties["last_seen"], d.Properties["tags"])
+	}
+	if got := strings.Join(d.Required, ","); got != "hostname,last_seen,owner,score" {
+		t.Errorf("required = %s", got)
+	}
+	// A pointer to a component is a nullable reference
+	if o := d.Properties["owner"]; !o.Nullable || len(o.AllOf) != 1 || o.AllOf[0].Ref != "#/components/schemas/Owner" {
+		t.Errorf("owner = %+v", o)
+	}
+	// Recursive types refer to themselves
+	o := schemas["Owner"]
+	if o.Properties["parent"].Ref != "#/components/schemas/Owner" || len(o.Properties) != 2 {
+		t.Errorf("Owner = %+v", o)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	spec, h := api()
+	doc := spec.Document()
+	call := func(method, path string) error {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return doc.Validate(method, path, rec.Code, rec.Body.Bytes())
+	}
+
+	for _, path := range []string{"/devices?limit=1", "/devices/laptop-1", "/devices/laptop-9", "/files/a/b"} {
+		if err := call(http.MethodGet, path); err != nil {
+			t.Errorf("GET %s: %v", path, err)
+		}
+	}
+	for _, path := range []string{"/devices/laptop-1/tags", "/devices/laptop-1/tags?review=1"} {
+		if err := call(http.MethodPost, path); err != nil {
+			t.Errorf("POST %s: %v", path, err)
+		}
+	}
+	if err := call(http.MethodGet, "/devices/stale"); err == nil || !strings.Contains(err.Error(), "object, want array") {
+		t.Errorf("drifted response: %v", err)
+	}
+	if err := call(http.MethodDelete, "/devices/laptop-1"); err == nil || !strings.Contains(err.Error(), "not documented") {
+		t.Errorf("undocumented route: %v", err)
+	}
+
+	for body, want := range map[string]string{
+		`{"hostname":"a","score":1.5,"last_seen":"2024-05-01T10:00:00Z","owner":null}`:              "1.5 is not an integer",
+		`{"hostname":"a","score":1,"last_seen":"yesterday","owner":null}`:                           "not a date-time",
+		`{"hostname":"a","score":1,"last_seen":"2024-05-01T10:00:00Z"}`:                             `missing "owner"`,
+		`{"hostname":"a","score":1,"last_seen":"2024-05-01T10:00:00Z","owner":null,"extra":true}`:   `undocumented field "extra"`,
+		`{"hostname":"a","score":1,"last_seen":"2024-05-01T10:00:00Z","owner":{"name":7}}`:          "$.owner.name: number, want string",
+		`{"hostname":"a","score":1,"last_seen":"2024-05-01T10:00:00Z","owner":null,"tags":{"a":1}}`: "$.tags.a: number, want string",
+		`{"hostname":"a","score":1,"last_seen":"2024-05-01T10:00:00Z","owner":null,"raw":[1]}`:      "",
+	} {
+		err := doc.Validate(http.MethodGet, "/devices/laptop-1", http.StatusOK, []byte(body))
+		if want == "" && err != nil || want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%s: %v, want %q", body, err, want)
+		}
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	for _, c := range []struct{ method, path, want string }{
+		{"get", "/", "get"},
+		{"post", "/report", "postReport"},
+		{"get", "/devices/{hostname}/history", "getDevicesByHostnameHistory"},
+		{"delete", "/api/v1/rules/{id}", "deleteApiV1RulesById"},
+		{"get", "/fleet/export.csv", "getFleetExportCsv"},
+		{"put", "/tenant-keys/{tenant_id}", "putTenantKeysByTenantId"},
+	} {
+		if got := operationID(c.method, c.path); got != c.want {
+			t.Errorf("operationID(%s %s) = %s, want %s", c.method, c.path, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Schema is an OpenAPI schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+// refPrefix is where a Document's component schemas are
+const refPrefix = "#/components/schemas/"
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshaler     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	objectType        = reflect.TypeOf(Object{})
+	schemaPointerType = reflect.TypeOf(&Schema{})
+)
+
+// schemas reflects Go types into the schemas of one document, naming each
+// struct type a component
+type schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+}
+
+// of returns the schema of a body of value: an Object's fields, or the
+// schema of value's type. A *Schema is used as it is, and nil is any value.
+func (s *schemas) of(value any) *Schema {
+	switch v := value.(type) {
+	case nil:
+		return &Schema{}
+	case *Schema:
+		return v
+	case Object:
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		for name, field := range v {
+			if o, ok := field.(optional); ok {
+				schema.Properties[name] = notNull(s.of(o.value))
+				continue
+			}
+			schema.Properties[name] = s.of(field)
+			schema.Required = append(schema.Required, name)
+		}
+		sort.Strings(schema.Required)
+		return schema
+	}
+	t := reflect.TypeOf(value)
+	if t.Kind() == reflect.Slice && t.Elem() == objectType {
+		// []Object{{...}} is an array of those objects
+		items := reflect.ValueOf(value)
+		if items.Len() > 0 {
+			return &Schema{Type: "array", Nullable: true, Items: s.of(items.Index(0).Interface())}
+		}
+	}
+	return s.typeOf(t)
+}
+
+// typeOf returns the schema of the JSON encoding/json writes for values of
+// type t. Pointers, slices and maps are nullable, since nil is written as
+// null.
+func (s *schemas) typeOf(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == schemaPointerType:
+		return &Schema{}
+	case t.Kind() != reflect.Pointer && (t.Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(jsonMarshaler)):
+		// Whatever it marshals itself as, e.g. json.RawMessage
+		return &Schema{}
+	case t.Kind() != reflect.Pointer && (t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler)):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Pointer:
+		return nullable(s.typeOf(t.Elem()))
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: true}
+		}
+		return &Schema{Type: "array", Nullable: true, Items: s.typeOf(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: s.typeOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", Nullable: true, AdditionalProperties: s.typeOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structOf(t)
+		}
+		return &Schema{Ref: refPrefix + s.component(t)}
+	}
+	// Channels and functions don't marshal
+	return &Schema{}
+}
+
+// component names t's schema among the components, adding it first if
+// it's new. A name another package's type already has is prefixed with the
+// package's.
+func (s *schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := componentName(t.Name())
+	if _, taken := s.components[name]; taken {
+		pkg := t.PkgPath()
+		pkg = pkg[strings.LastIndexByte(pkg, '/')+1:]
+		name = componentName(pkg) + name
+	}
+	s.names[t] = name
+	s.components[name] = &Schema{} // placeholder for recursive types
+	*s.components[name] = *s.structOf(t)
+	return name
+}
+
+// componentName makes name fit a component's, keeping its letters, digits
+// and underscores. Instantiated generic types are named after their
+// arguments too.
+func componentName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			if upper {
+				r = unicode.ToUpper(r)
+				upper = false
+			}
+			b.WriteRune(r)
+		default:
+			upper = true
+		}
+	}
+	return b.String()
+}
+
+// field is a struct field as encoding/json sees it
+type field struct {
+	name      string
+	omitempty bool
+	quoted    bool
+	typ       reflect.Type
+}
+
+// structOf returns the object schema of a struct type
+func (s *schemas) structOf(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, f := range jsonFields(t) {
+		var property *Schema
+		switch {
+		case f.quoted:
+			property = &Schema{Type: "string"}
+		case f.omitempty:
+			// An empty value is left out rather than written as null
+			property = notNull(s.typeOf(f.typ))
+		default:
+			property = s.typeOf(f.typ)
+		}
+		schema.Properties[f.name] = property
+		if !f.omitempty {
+			schema.Required = append(schema.Required, f.name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// jsonFields returns the fields encoding/json writes for struct type t,
+// with those of embedded structs promoted. A shallower field hides deeper
+// ones of the same name.
+func jsonFields(t reflect.Type) []field {
+	var fields []field
+	seen := make(map[string]bool)
+	level := []reflect.Type{t}
+	visited := map[reflect.Type]bool{t: true}
+	for len(level) > 0 {
+		var next []reflect.Type
+		names := make(map[string]bool)
+		var found []field
+		for _, st := range level {
+			for i := 0; i < st.NumField(); i++ {
+				sf := st.Field(i)
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				ft := sf.Type
+				if sf.Anonymous && name == "" {
+					if ft.Kind() == reflect.Pointer {
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						if !visited[ft] {
+							visited[ft] = true
+							next = append(next, ft)
+						}
+						continue
+					}
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				if name == "" {
+					name = sf.Name
+				}
+				if seen[name] || names[name] {
+					continue
+				}
+				names[name] = true
+				f := field{name: name, typ: sf.Type}
+				for _, opt := range strings.Split(opts, ",") {
+					switch opt {
+					case "omitempty", "omitzero":
+						f.omitempty = true
+					case "string":
+						f.quoted = quotable(sf.Type)
+					}
+				}
+				found = append(found, f)
+			}
+		}
+		for name := range names {
+			seen[name] = true
+		}
+		fields = append(fields, found...)
+		level = next
+	}
+	return fields
+}
+
+// quotable reports whether the ",string" option applies to type t
+func quotable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+	return false
+}
+
+// nullable allows null as well as what schema allows. A reference can't
+// carry nullable beside it, so it is wrapped.
+func nullable(schema *Schema) *Schema {
+	if schema.Ref != "" {
+		return &Schema{AllOf: []*Schema{schema}, Nullable: true}
+	}
+	if schema.Type == "" {
+		return schema // any value already includes null
+	}
+	copied := *schema
+	copied.Nullable = true
+	return &copied
+}
+
+// notNull is schema without null
+func notNull(schema *Schema) *Schema {
+	if !schema.Nullable {
+		return schema
+	}
+	if len(schema.AllOf) == 1 && schema.Type == "" {
+		return schema.AllOf[0]
+	}
+	copied := *schema
+	copied.Nullable = false
+	return &copied
+}
@@ -0,0 +1,223 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks a response against the document: that it documents the
+// operation and the status, and that a JSON body has the documented
+// schema. Objects documented with properties may not have others, so a
+// field a handler writes but the document leaves out is caught too. path
+// is the request's, e.g. /devices/laptop-1; its query is ignored.
+func (d *Document) Validate(method, path string, status int, body []byte) error {
+	op, err := d.Operation(method, path)
+	if err != nil {
+		return err
+	}
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if response, ok = op.Responses["default"]; !ok {
+			return fmt.Errorf("%s %s: status %d not documented", method, path, status)
+		}
+	}
+	media, ok := response.Content["application/json"]
+	if !ok || media.Schema == nil {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("%s %s: %d response is not JSON: %w", method, path, status, err)
+	}
+	if err := d.check("$", media.Schema, value); err != nil {
+		return fmt.Errorf("%s %s: %d response: %w", method, path, status, err)
+	}
+	return nil
+}
+
+// Operation returns the operation serving a request, matching path
+// against the document's path templates
+func (d *Document) Operation(method, path string) (*OpDoc, error) {
+	path, _, _ = strings.Cut(path, "?")
+	method = strings.ToLower(method)
+	segments := strings.Split(path, "/")
+	// Most specific first, so /devices/stale wins over /devices/{hostname}
+	templates := make([]string, 0, len(d.Paths))
+	for template := range d.Paths {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		wi, wj := strings.Count(templates[i], "{"), strings.Count(templates[j], "{")
+		if wi != wj {
+			return wi < wj
+		}
+		return templates[i] < templates[j]
+	})
+	// A {name...} wildcard is documented as {name}, so a path longer than
+	// any template matches one ending in a parameter
+	for _, rest := range []bool{false, true} {
+		for _, template := range templates {
+			if !matchPath(strings.Split(template, "/"), segments, rest) {
+				continue
+			}
+			if op, ok := d.Paths[template][method]; ok {
+				return op, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s %s not documented", strings.ToUpper(method), path)
+}
+
+// matchPath reports whether the segments of a path match a template's.
+// With rest, a parameter ending the template matches the rest of the path.
+func matchPath(template, segments []string, rest bool) bool {
+	for i, want := range template {
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(want, "{") {
+			if rest && i == len(template)-1 && segments[i] != "" {
+				return true
+			}
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if want != segments[i] {
+			return false
+		}
+	}
+	return len(template) == len(segments)
+}
+
+// check reports where value, decoded with json.Number, differs from schema
+func (d *Document) check(at string, schema *Schema, value any) error {
+	if schema.Ref != "" {
+		resolved, ok := d.Components.Schemas[strings.TrimPrefix(schema.Ref, refPrefix)]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", at, schema.Ref)
+		}
+		return d.check(at, resolved, value)
+	}
+	if value == nil {
+		if schema.Nullable || (schema.Type == "" && len(schema.AllOf) == 0) {
+			return nil
+		}
+		return fmt.Errorf("%s: null, want %s", at, describe(schema))
+	}
+	for _, sub := range schema.AllOf {
+		if err := d.check(at, sub, value); err != nil {
+			return err
+		}
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: %s, want string", at, kindOf(value))
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, s)
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: %s, want boolean", at, kindOf(value))
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: %s, want integer", at, kindOf(value))
+		}
+		if _, err := strconv.ParseInt(n.String(), 10, 64); err != nil {
+			if _, err := strconv.ParseUint(n.String(), 10, 64); err != nil {
+				return fmt.Errorf("%s: %s is not an integer", at, n)
+			}
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s: %s, want number", at, kindOf(value))
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: %s, want array", at, kindOf(value))
+		}
+		if schema.Items == nil {
+			return nil
+		}
+		for i, item := range items {
+			if err := d.check(fmt.Sprintf("%s[%d]", at, i), schema.Items, item); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: %s, want object", at, kindOf(value))
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: missing %q", at, name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				property = schema.AdditionalProperties
+			}
+			if property == nil {
+				if len(schema.Properties) > 0 {
+					return fmt.Errorf("%s: undocumented field %q", at, name)
+				}
+				continue
+			}
+			if err := d.check(at+"."+name, property, object[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// describe names what schema allows, for errors
+func describe(schema *Schema) string {
+	if schema.Type == "" {
+		return "a value"
+	}
+	return schema.Type
+}
+
+// kindOf names the JSON type of a decoded value, for errors
+func kindOf(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "null"
+}
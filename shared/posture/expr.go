@@ -0,0 +1,542 @@
+// Package posture is what the agent and the collector share to judge a
+// device: the rule expressions policies are written in, the facts they
+// range over, and how check results become a score and a status. Both
+// evaluate a policy with it, so a policy file means the same thing on
+// either side.
+package posture
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Rule expressions are a small boolean language evaluated against a
+// device's facts, for example:
+//
+//	disk_usage > 90 || !firewall.enabled || os.version < "22.04"
+//
+// Supported: numbers, "strings", true/false, dotted variable names,
+// + - * /, == != < <= > >=, !, && and ||, and parentheses. Strings that look
+// like versions ("13.2.1") compare component by component.
+
+// Expr is a compiled rule expression
+type Expr interface {
+	Eval(env map[string]any) (any, error)
+}
+
+// CompileExpr parses src and verifies every variable it references is known
+func CompileExpr(src string, known map[string]bool) (Expr, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	for _, name := range exprVariables(expr) {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown variable %q (known: %s)", name, strings.Join(sortedKeys(known), ", "))
+		}
+	}
+	return expr, nil
+}
+
+// EvalBool evaluates expr and requires a boolean result
+func EvalBool(expr Expr, env map[string]any) (bool, error) {
+	value, err := expr.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression must evaluate to true or false, got %v", value)
+	}
+	return b, nil
+}
+
+// --- lexer ---
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// exprOperators are matched longest first
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/"}
+
+func lexExpr(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '(' || c == ')':
+			kind := tokLParen
+			if c == ')' {
+				kind = tokRParen
+			}
+			tokens = append(tokens, token{kind: kind, text: string(c), pos: i})
+			i++
+
+		case c == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokString, text: src[i+1 : i+1+end], pos: i})
+			i += end + 2
+
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], pos: start})
+
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_' || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// --- parser ---
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token { return p.tokens[p.pos] }
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) acceptOp(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "||", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (Expr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.acceptOp("==", "!=", "<=", ">=", "<", ">"); ok {
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &compareExpr{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	if op, ok := p.acceptOp("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return &literalExpr{value: value}, nil
+	case tokString:
+		return &literalExpr{value: tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalExpr{value: true}, nil
+		case "false":
+			return &literalExpr{value: false}, nil
+		}
+		return &varExpr{name: tok.text}, nil
+	case tokLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at position %d", closing.pos)
+		}
+		return expr, nil
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+}
+
+// --- AST ---
+
+type literalExpr struct{ value any }
+
+func (e *literalExpr) Eval(env map[string]any) (any, error) { return e.value, nil }
+
+type varExpr struct{ name string }
+
+func (e *varExpr) Eval(env map[string]any) (any, error) {
+	value, ok := env[e.name]
+	if !ok || value == nil {
+		return nil, fmt.Errorf("%s is not available on this device", e.name)
+	}
+	return value, nil
+}
+
+type unaryExpr struct {
+	op      string
+	operand Expr
+}
+
+func (e *unaryExpr) Eval(env map[string]any) (any, error) {
+	value, err := e.operand.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case bool:
+		if e.op == "!" {
+			return !v, nil
+		}
+	case float64:
+		if e.op == "-" {
+			return -v, nil
+		}
+	}
+	return nil, fmt.Errorf("operator %s cannot be applied to %v", e.op, value)
+}
+
+type logicalExpr struct {
+	op          string
+	left, right Expr
+}
+
+// Eval short-circuits, so "a || b" doesn't fail when only b is unavailable
+func (e *logicalExpr) Eval(env map[string]any) (any, error) {
+	left, err := EvalBool(e.left, env)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "||" && left {
+		return true, nil
+	}
+	if e.op == "&&" && !left {
+		return false, nil
+	}
+	return EvalBool(e.right, env)
+}
+
+type arithExpr struct {
+	op          string
+	left, right Expr
+}
+
+func (e *arithExpr) Eval(env map[string]any) (any, error) {
+	l, r, err := evalOperands(e.left, e.right, env)
+	if err != nil {
+		return nil, err
+	}
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s needs numbers, got %v and %v", e.op, l, r)
+	}
+	switch e.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	default:
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	}
+}
+
+type compareExpr struct {
+	op          string
+	left, right Expr
+}
+
+func (e *compareExpr) Eval(env map[string]any) (any, error) {
+	l, r, err := evalOperands(e.left, e.right, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmp int
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number %v with %v", lv, r)
+		}
+		cmp = compareFloats(lv, rv)
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string %q with %v", lv, r)
+		}
+		cmp = compareStrings(lv, rv)
+	case bool:
+		rv, ok := r.(bool)
+		if !ok || (e.op != "==" && e.op != "!=") {
+			return nil, fmt.Errorf("booleans only support == and !=")
+		}
+		if lv != rv {
+			cmp = 1
+		}
+	default:
+		return nil, fmt.Errorf("unsupported value %v", l)
+	}
+
+	switch e.op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func evalOperands(left, right Expr, env map[string]any) (any, any, error) {
+	l, err := left.Eval(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := right.Eval(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, r, nil
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareStrings compares dotted version strings numerically per component
+// ("9.1" < "22.04") and everything else lexically
+func compareStrings(a, b string) int {
+	av, aok := parseVersion(a)
+	bv, bok := parseVersion(b)
+	if !aok || !bok {
+		return strings.Compare(a, b)
+	}
+	for i := 0; i < len(av) || i < len(bv); i++ {
+		var x, y int
+		if i < len(av) {
+			x = av[i]
+		}
+		if i < len(bv) {
+			y = bv[i]
+		}
+		if x != y {
+			return compareFloats(float64(x), float64(y))
+		}
+	}
+	return 0
+}
+
+func parseVersion(s string) ([]int, bool) {
+	parts := strings.Split(s, ".")
+	version := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		version = append(version, n)
+	}
+	return version, true
+}
+
+// exprVariables lists the variable names referenced by expr
+func exprVariables(expr Expr) []string {
+	var names []string
+	var walk func(Expr)
+	walk = func(e Expr) {
+		switch n := e.(type) {
+		case *varExpr:
+			names = append(names, n.name)
+		case *unaryExpr:
+			walk(n.operand)
+		case *logicalExpr:
+			walk(n.left)
+			walk(n.right)
+		case *arithExpr:
+			walk(n.left)
+			walk(n.right)
+		case *compareExpr:
+			walk(n.left)
+			walk(n.right)
+		}
+	}
+	walk(expr)
+	return names
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,62 @@
+package posture
+
+import "testing"
+
+func TestEvalRules(t *testing.T) {
+	env := map[string]any{
+		"disk_usage":       95.0,
+		"firewall.enabled": true,
+		"os.version":       "9.10",
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`disk_usage > 90`, true},
+		{`disk_usage > 90 && !firewall.enabled`, false},
+		{`disk_usage > 90 || !firewall.enabled || os.version < "22.04"`, true},
+		{`os.version < "22.04"`, true}, // numeric per component, not lexical
+		{`os.version >= "9.2"`, true},
+		{`(disk_usage - 5) / 10 == 9`, true},
+		{`!(firewall.enabled == true)`, false},
+		{`-disk_usage < 0`, true},
+		{`false && missing > 1`, false}, // short-circuit skips the unknown variable
+	}
+
+	known := map[string]bool{"disk_usage": true, "firewall.enabled": true, "os.version": true, "missing": true}
+	for _, tt := range tests {
+		expr, err := CompileExpr(tt.expr, known)
+		if err != nil {
+			t.Fatalf("CompileExpr(%q) error: %v", tt.expr, err)
+		}
+		got, err := EvalBool(expr, env)
+		if err != nil {
+			t.Fatalf("EvalBool(%q) error: %v", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("EvalBool(%q) = %v; want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalRulesErrors(t *testing.T) {
+	known := map[string]bool{"disk_usage": true, "missing": true}
+
+	for _, src := range []string{`disk_usage >`, `(disk_usage > 1`, `disk_usage > 1 )`, `"open`, `disk_usage # 1`, `unknown > 1`} {
+		if _, err := CompileExpr(src, known); err == nil {
+			t.Errorf("CompileExpr(%q) expected error", src)
+		}
+	}
+
+	env := map[string]any{"disk_usage": 50.0}
+	for _, src := range []string{`missing > 1`, `disk_usage`, `disk_usage > "50"`, `disk_usage / 0 > 1`} {
+		expr, err := CompileExpr(src, known)
+		if err != nil {
+			t.Fatalf("CompileExpr(%q) error: %v", src, err)
+		}
+		if _, err := EvalBool(expr, env); err == nil {
+			t.Errorf("EvalBool(%q) expected error", src)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package posture
+
+// Variables are the names a rule expression may reference
+var Variables = map[string]bool{
+	"hostname":         true,
+	"ip":               true,
+	"disk_usage":       true,
+	"cpu_usage":        true,
+	"memory_usage":     true,
+	"os.name":          true,
+	"os.version":       true,
+	"os.arch":          true,
+	"firewall.enabled": true,
+}
+
+// Facts are what rule expressions know about a device, from the agent's
+// collection or a report the collector received
+type Facts struct {
+	Hostname    string
+	IP          string
+	DiskUsage   float64
+	CPUUsage    float64
+	MemoryUsage float64
+	OSName      string
+	OSVersion   string
+	OSArch      string
+	Firewall    *bool // nil when the state couldn't be read
+}
+
+// Env exposes the facts to rule expressions. Facts that weren't collected
+// are left out, so rules using them fail to evaluate.
+func (f Facts) Env() map[string]any {
+	env := map[string]any{
+		"hostname":     f.Hostname,
+		"ip":           f.IP,
+		"disk_usage":   f.DiskUsage,
+		"cpu_usage":    f.CPUUsage,
+		"memory_usage": f.MemoryUsage,
+	}
+	for name, value := range map[string]string{"os.name": f.OSName, "os.version": f.OSVersion, "os.arch": f.OSArch} {
+		if value != "" {
+			env[name] = value
+		}
+	}
+	if f.Firewall != nil {
+		env["firewall.enabled"] = *f.Firewall
+	}
+	return env
+}
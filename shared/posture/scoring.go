@@ -0,0 +1,166 @@
+package posture
+
+import (
+	"fmt"
+	"math"
+)
+
+// Device statuses
+const (
+	StatusHealthy   = "HEALTHY"
+	StatusDegraded  = "DEGRADED"
+	StatusUnhealthy = "UNHEALTHY"
+)
+
+// Check failure severities
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Overall severity levels derived from the health score
+const (
+	HealthSeverityNone     = "none"
+	HealthSeverityLow      = "low"
+	HealthSeverityMedium   = "medium"
+	HealthSeverityHigh     = "high"
+	HealthSeverityCritical = "critical"
+)
+
+// Default score cut-offs. A critical disk failure (weight 50) on its own
+// makes a device UNHEALTHY.
+const (
+	DefaultHealthyScore   = 80
+	DefaultUnhealthyScore = 50
+)
+
+// DefaultRuleWeight applies when a policy rule omits its weight
+const DefaultRuleWeight = 25
+
+// DefaultCheckWeights apply when a policy check omits its weight
+var DefaultCheckWeights = map[string]float64{
+	"disk_usage":   50,
+	"cpu_usage":    20,
+	"memory_usage": 30,
+}
+
+// CheckLabels are the metric checks a policy may set thresholds for, by
+// the human-readable names used in check messages
+var CheckLabels = map[string]string{
+	"disk_usage":   "Disk usage",
+	"cpu_usage":    "CPU usage",
+	"memory_usage": "Memory usage",
+}
+
+// CheckResult is the outcome of one check, included in every report
+type CheckResult struct {
+	Name        string `json:"name"`
+	Passed      bool   `json:"passed"`
+	Severity    string `json:"severity,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Threshold fails the check name, labelled label in its message, with a
+// warning when value is above warn and critically above critical. A zero
+// threshold disables that level.
+func Threshold(name, label string, value, warn, critical float64) CheckResult {
+	switch {
+	case critical > 0 && value > critical:
+		return CheckResult{
+			Name:     name,
+			Severity: SeverityCritical,
+			Message:  fmt.Sprintf("%s at %.2f%% (threshold: %.0f%%)", label, value, critical),
+		}
+	case warn > 0 && value > warn:
+		return CheckResult{
+			Name:     name,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%s at %.2f%% (warning threshold: %.0f%%)", label, value, warn),
+		}
+	}
+	return CheckResult{Name: name, Passed: true}
+}
+
+// Rule fails the rule name with severity and message when expr, compiled
+// from source, is true in env. A rule that can't be evaluated (e.g. the
+// firewall state is unknown) is a warning.
+func Rule(name, source string, expr Expr, env map[string]any, severity, message string) CheckResult {
+	matched, err := EvalBool(expr, env)
+	if err != nil {
+		return CheckResult{
+			Name:     name,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("rule could not be evaluated: %v", err),
+		}
+	}
+	if !matched {
+		return CheckResult{Name: name, Passed: true}
+	}
+	if message == "" {
+		message = "rule matched: " + source
+	}
+	return CheckResult{Name: name, Severity: severity, Message: message}
+}
+
+// Model turns weighted check results into a 0–100 health score. Each
+// failing check deducts its weight (half of it for a warning); the score
+// then maps onto HEALTHY / DEGRADED / UNHEALTHY via two cut-offs.
+type Model struct {
+	HealthyScore   float64 // score at or above which the device is HEALTHY
+	UnhealthyScore float64 // score at or below which the device is UNHEALTHY
+}
+
+// DefaultModel returns the default cut-offs
+func DefaultModel() Model {
+	return Model{HealthyScore: DefaultHealthyScore, UnhealthyScore: DefaultUnhealthyScore}
+}
+
+// Score computes the health score from results and the checks' weights,
+// by name, and names the failing checks
+func (m Model) Score(weights map[string]float64, results []CheckResult) (int, []string) {
+	score := 100.0
+	var failing []string
+	for _, result := range results {
+		if result.Passed {
+			continue
+		}
+		failing = append(failing, result.Name)
+
+		penalty := weights[result.Name]
+		if result.Severity != SeverityCritical {
+			penalty /= 2
+		}
+		score -= penalty
+	}
+
+	return int(math.Round(math.Max(score, 0))), failing
+}
+
+// Status maps a score to HEALTHY, DEGRADED or UNHEALTHY
+func (m Model) Status(score int) string {
+	switch {
+	case float64(score) <= m.UnhealthyScore:
+		return StatusUnhealthy
+	case float64(score) < m.HealthyScore:
+		return StatusDegraded
+	default:
+		return StatusHealthy
+	}
+}
+
+// Severity maps a score to a coarse severity level for alerting
+func (m Model) Severity(score int) string {
+	switch {
+	case score >= 100:
+		return HealthSeverityNone
+	case float64(score) >= m.HealthyScore:
+		return HealthSeverityLow
+	case float64(score) > m.UnhealthyScore:
+		return HealthSeverityMedium
+	case score > 25:
+		return HealthSeverityHigh
+	default:
+		return HealthSeverityCritical
+	}
+}
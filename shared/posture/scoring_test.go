@@ -0,0 +1,59 @@
+package posture
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModel(t *testing.T) {
+	weights := map[string]float64{"disk_usage": 50, "cpu_usage": 20, "firewall": 40}
+	results := []CheckResult{
+		Threshold("disk_usage", CheckLabels["disk_usage"], 85, 80, 90),
+		Threshold("cpu_usage", CheckLabels["cpu_usage"], 95, 0, 90),
+		{Name: "firewall", Passed: true},
+	}
+	if results[0].Severity != SeverityWarning || results[1].Severity != SeverityCritical {
+		t.Fatalf("results = %+v, want a disk warning and a critical CPU failure", results)
+	}
+
+	m := DefaultModel()
+	// Half the disk weight for the warning, all of the CPU weight
+	score, failing := m.Score(weights, results)
+	if score != 55 || strings.Join(failing, ",") != "disk_usage,cpu_usage" {
+		t.Errorf("Score = %d %v, want 55 [disk_usage cpu_usage]", score, failing)
+	}
+
+	tests := []struct {
+		score            int
+		status, severity string
+	}{
+		{100, StatusHealthy, HealthSeverityNone},
+		{80, StatusHealthy, HealthSeverityLow},
+		{55, StatusDegraded, HealthSeverityMedium},
+		{50, StatusUnhealthy, HealthSeverityHigh},
+		{25, StatusUnhealthy, HealthSeverityCritical},
+	}
+	for _, tt := range tests {
+		if got := m.Status(tt.score); got != tt.status {
+			t.Errorf("Status(%d) = %s, want %s", tt.score, got, tt.status)
+		}
+		if got := m.Severity(tt.score); got != tt.severity {
+			t.Errorf("Severity(%d) = %s, want %s", tt.score, got, tt.severity)
+		}
+	}
+}
+
+func TestRule(t *testing.T) {
+	expr, err := CompileExpr("!firewall.enabled", Variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := false
+	if r := Rule("firewall", "!firewall.enabled", expr, Facts{Firewall: &off}.Env(), SeverityCritical, ""); r.Passed || r.Severity != SeverityCritical || r.Message != "rule matched: !firewall.enabled" {
+		t.Errorf("Rule with the firewall off = %+v, want a critical failure", r)
+	}
+	// Without the firewall state the rule can't be evaluated: a warning only
+	if r := Rule("firewall", "!firewall.enabled", expr, Facts{}.Env(), SeverityCritical, ""); r.Passed || r.Severity != SeverityWarning {
+		t.Errorf("Rule without the firewall state = %+v, want a warning", r)
+	}
+}
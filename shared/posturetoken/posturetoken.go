@@ -0,0 +1,245 @@
+// Package posturetoken issues and verifies the short-lived tokens that
+// carry a device's posture from the collector to the gateway: the
+// collector signs its verdict on a device, the device presents the token
+// with its requests, and the proxy checks the signature and expiry before
+// letting the verdict decide what the device may reach.
+//
+// Tokens are JWTs signed with Ed25519 ("alg":"EdDSA"), whose "kid" is the
+// key's cryptoutil.KeyID, as for the policy engine's policy signatures. A
+// token is presented in the X-Posture-Token header or, through a proxy, as
+// a bearer token in Proxy-Authorization.
+package posturetoken
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/cryptoutil"
+)
+
+// Headers a token is presented in
+const (
+	HeaderToken      = "X-Posture-Token"
+	HeaderProxyAuthz = "Proxy-Authorization"
+)
+
+// Leeway is how far the clocks of the collector and the proxy may disagree
+var Leeway = 30 * time.Second
+
+// Errors Verify returns, wrapped
+var (
+	ErrMalformed   = errors.New("malformed posture token")
+	ErrUnknownKey  = errors.New("posture token signed with an unknown key")
+	ErrSignature   = errors.New("posture token signature is invalid")
+	ErrExpired     = errors.New("posture token has expired")
+	ErrNotYetValid = errors.New("posture token is not valid yet")
+)
+
+// Claims is the collector's verdict on a device that a token carries
+type Claims struct {
+	DeviceID  string
+	Tenant    string
+	Compliant bool
+	Status    string // HEALTHY, DEGRADED, UNHEALTHY, STALE or ENROLLED
+	Score     int
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// header and claims are the JSON of a token's first two parts
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+type claims struct {
+	Subject   string `json:"sub"`
+	Tenant    string `json:"tenant,omitempty"`
+	Compliant bool   `json:"compliant"`
+	Status    string `json:"status"`
+	Score     int    `json:"score"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// KeyID identifies a public key: the first 8 bytes of its SHA-256, in hex
+func KeyID(pub ed25519.PublicKey) string {
+	return cryptoutil.KeyID(pub)
+}
+
+// Issuer signs tokens with the collector's private key
+type Issuer struct {
+	key *cryptoutil.Signer
+}
+
+// NewIssuer returns an issuer signing with key
+func NewIssuer(key ed25519.PrivateKey) *Issuer {
+	return &Issuer{key: cryptoutil.NewSigner(key)}
+}
+
+// LoadOrCreate reads the PEM-encoded PKCS #8 Ed25519 private key at path.
+// If there is no file, it generates a key and writes it there, readable
+// only by its owner, with the public key next to it in path+".pub" for
+// the proxies. It reports whether it created the key.
+//
+// path may instead be a secret reference, such as
+// vault:secret/data/swg#posture_token_key, to a key kept in a secret store, which
+// is read but never created.
+func LoadOrCreate(path string) (*Issuer, bool, error) {
+	key, created, err := cryptoutil.LoadOrCreateSigner(path, "posture token key")
+	if err != nil {
+		return nil, false, err
+	}
+	return &Issuer{key: key}, created, nil
+}
+
+// ID returns the ID of the issuer's key
+func (i *Issuer) ID() string { return i.key.ID() }
+
+// PublicKey returns the public key proxies verify tokens with
+func (i *Issuer) PublicKey() ed25519.PublicKey { return i.key.PublicKey() }
+
+// PublicKeyPEM returns the public key as a PEM "PUBLIC KEY" block
+func (i *Issuer) PublicKeyPEM() []byte { return i.key.PublicKeyPEM() }
+
+// Issue returns a token carrying c, valid from c.IssuedAt for ttl
+func (i *Issuer) Issue(c Claims, ttl time.Duration) (string, error) {
+	if c.DeviceID == "" {
+		return "", errors.New("a posture token needs a device ID")
+	}
+	if c.IssuedAt.IsZero() {
+		c.IssuedAt = time.Now()
+	}
+	h, err := json.Marshal(header{Algorithm: "EdDSA", Type: "JWT", KeyID: i.key.ID()})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(claims{
+		Subject: c.DeviceID, Tenant: c.Tenant, Compliant: c.Compliant, Status: c.Status, Score: c.Score,
+		IssuedAt: c.IssuedAt.Unix(), ExpiresAt: c.IssuedAt.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := encoding.EncodeToString(h) + "." + encoding.EncodeToString(body)
+	return signed + "." + encoding.EncodeToString(i.key.Sign([]byte(signed))), nil
+}
+
+// Verifier checks tokens against the public keys of the collectors it
+// trusts. It is safe for concurrent use.
+type Verifier struct {
+	keys *cryptoutil.KeyRing
+	now  func() time.Time
+}
+
+// NewVerifier returns a verifier trusting keys
+func NewVerifier(keys ...ed25519.PublicKey) *Verifier {
+	pubs := make([]cryptoutil.PublicKey, len(keys))
+	for i, k := range keys {
+		pubs[i] = cryptoutil.PublicKey{Key: k}
+	}
+	return &Verifier{keys: cryptoutil.NewKeyRing(pubs...), now: time.Now}
+}
+
+// ReadVerifier returns a verifier trusting the Ed25519 public keys in the
+// PEM file at path, such as the collector's posture-token.key.pub. Keeping
+// the old and new keys in the file lets the collector's key be replaced
+// without rejecting the tokens it already issued; a key the file marks as
+// expired, once rotated out, is no longer trusted.
+func ReadVerifier(path string) (*Verifier, error) {
+	keys, err := cryptoutil.ReadKeyRing(path)
+	if err != nil {
+		return nil, fmt.Errorf("read posture token keys: %w", err)
+	}
+	return &Verifier{keys: keys, now: time.Now}, nil
+}
+
+// Keys returns how many keys v trusts
+func (v *Verifier) Keys() int { return v.keys.Len() }
+
+// Verify checks token's signature and validity period and returns its
+// claims
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+	var h header
+	if err := decode(parts[0], &h); err != nil {
+		return Claims{}, err
+	}
+	if h.Algorithm != "EdDSA" {
+		return Claims{}, fmt.Errorf("%w: algorithm %q", ErrMalformed, h.Algorithm)
+	}
+	now := v.now()
+	sig, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrSignature
+	}
+	err = v.keys.VerifyAt(h.KeyID, []byte(parts[0]+"."+parts[1]), sig, now)
+	switch {
+	case errors.Is(err, cryptoutil.ErrUnknownKey), errors.Is(err, cryptoutil.ErrRetiredKey):
+		return Claims{}, fmt.Errorf("%w %q", ErrUnknownKey, h.KeyID)
+	case err != nil:
+		return Claims{}, ErrSignature
+	}
+	var c claims
+	if err := decode(parts[1], &c); err != nil {
+		return Claims{}, err
+	}
+	out := Claims{
+		DeviceID: c.Subject, Tenant: c.Tenant, Compliant: c.Compliant, Status: c.Status, Score: c.Score,
+		IssuedAt: time.Unix(c.IssuedAt, 0), ExpiresAt: time.Unix(c.ExpiresAt, 0),
+	}
+	if !now.Before(out.ExpiresAt.Add(Leeway)) {
+		return Claims{}, fmt.Errorf("%w at %s", ErrExpired, out.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	// A token issued in the future would stay valid past its lifetime
+	if out.IssuedAt.After(now.Add(Leeway)) {
+		return Claims{}, fmt.Errorf("%w: issued at %s", ErrNotYetValid, out.IssuedAt.UTC().Format(time.RFC3339))
+	}
+	if out.DeviceID == "" {
+		return Claims{}, fmt.Errorf("%w: no device ID", ErrMalformed)
+	}
+	return out, nil
+}
+
+func decode(part string, v any) error {
+	data, err := encoding.DecodeString(part)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return nil
+}
+
+// FromRequest returns the token r presents, in the X-Posture-Token header
+// or as a bearer token in Proxy-Authorization, or "" if it has none
+func FromRequest(r *http.Request) string {
+	if token := strings.TrimSpace(r.Header.Get(HeaderToken)); token != "" {
+		return token
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get(HeaderProxyAuthz), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// Strip removes the headers a token is presented in from h, so that a
+// proxy doesn't pass it on to the sites it forwards to
+func Strip(h http.Header) {
+	h.Del(HeaderToken)
+	h.Del(HeaderProxyAuthz)
+}
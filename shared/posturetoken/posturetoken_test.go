@@ -0,0 +1,116 @@
+package posturetoken
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "posture-token.key")
+	issuer, created, err := LoadOrCreate(path)
+	if err != nil || !created {
+		t.Fatalf("LoadOrCreate = %v, created %v", err, created)
+	}
+	again, created, err := LoadOrCreate(path)
+	if err != nil || created || again.ID() != issuer.ID() {
+		t.Fatalf("LoadOrCreate again = %v, created %v, id %s != %s", err, created, again.ID(), issuer.ID())
+	}
+	verifier, err := ReadVerifier(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued := time.Now().Truncate(time.Second)
+	token, err := issuer.Issue(Claims{DeviceID: "laptop-1", Tenant: "acme", Compliant: true, Status: "HEALTHY", Score: 97, IssuedAt: issued}, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := verifier.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Claims{DeviceID: "laptop-1", Tenant: "acme", Compliant: true, Status: "HEALTHY", Score: 97, IssuedAt: issued, ExpiresAt: issued.Add(5 * time.Minute)}
+	if !got.IssuedAt.Equal(want.IssuedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("times = %v, %v, want %v, %v", got.IssuedAt, got.ExpiresAt, want.IssuedAt, want.ExpiresAt)
+	}
+	got.IssuedAt, got.ExpiresAt, want.IssuedAt, want.ExpiresAt = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	if got != want {
+		t.Errorf("claims = %+v, want %+v", got, want)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	issuer, _, err := LoadOrCreate(filepath.Join(t.TempDir(), "k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, _ := LoadOrCreate(filepath.Join(t.TempDir(), "k"))
+	verifier := NewVerifier(issuer.PublicKey())
+	valid, _ := issuer.Issue(Claims{DeviceID: "laptop-1", Compliant: true}, time.Minute)
+	fromOther, _ := other.Issue(Claims{DeviceID: "laptop-1", Compliant: true}, time.Minute)
+	expired, _ := issuer.Issue(Claims{DeviceID: "laptop-1", Compliant: true, IssuedAt: time.Now().Add(-time.Hour)}, time.Minute)
+	future, _ := issuer.Issue(Claims{DeviceID: "laptop-1", Compliant: true, IssuedAt: time.Now().Add(time.Hour)}, time.Minute)
+	skewed, _ := issuer.Issue(Claims{DeviceID: "laptop-1", Compliant: true, IssuedAt: time.Now().Add(Leeway / 2)}, time.Minute)
+
+	parts := strings.Split(valid, ".")
+	forged, _ := issuer.Issue(Claims{DeviceID: "laptop-1", Compliant: false}, time.Minute)
+	tampered := parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+
+	for _, c := range []struct {
+		name, token string
+		want        error
+	}{
+		{"garbage", "not-a-token", ErrMalformed},
+		{"other key", fromOther, ErrUnknownKey},
+		{"tampered claims", tampered, ErrSignature},
+		{"expired", expired, ErrExpired},
+		{"issued in the future", future, ErrNotYetValid},
+	} {
+		if _, err := verifier.Verify(c.token); !errors.Is(err, c.want) {
+			t.Errorf("%s: Verify = %v, want %v", c.name, err, c.want)
+		}
+	}
+	if _, err := verifier.Verify(skewed); err != nil {
+		t.Errorf("token issued within the clock leeway: Verify = %v", err)
+	}
+	if _, err := issuer.Issue(Claims{}, time.Minute); err == nil {
+		t.Error("Issue accepted claims without a device ID")
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	for _, c := range []struct {
+		header http.Header
+		want   string
+	}{
+		{http.Header{"X-Posture-Token": {"a.b.c"}}, "a.b.c"},
+		{http.Header{"Proxy-Authorization": {"Bearer a.b.c"}}, "a.b.c"},
+		{http.Header{"Proxy-Authorization": {"Basic dXNlcjpwYXNz"}}, ""},
+		{http.Header{}, ""},
+	} {
+		r := &http.Request{Header: c.header}
+		if got := FromRequest(r); got != c.want {
+			t.Errorf("FromRequest(%v) = %q, want %q", c.header, got, c.want)
+		}
+		Strip(r.Header)
+		if len(r.Header) != 0 {
+			t.Errorf("Strip left %v", r.Header)
+		}
+	}
+}
+
+func TestReadVerifierErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	os.WriteFile(path, []byte("no keys here"), 0o644)
+	if _, err := ReadVerifier(path); err == nil {
+		t.Error("ReadVerifier accepted a file without keys")
+	}
+	if _, err := ReadVerifier(path + ".missing"); err == nil {
+		t.Error("ReadVerifier accepted a missing file")
+	}
+}
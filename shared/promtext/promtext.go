@@ -0,0 +1,59 @@
+// Package promtext writes metrics in the Prometheus text exposition format,
+// the one every service's /metrics speaks, so that the services escape
+// label values and format samples alike.
+//
+//	var b strings.Builder
+//	promtext.Header(&b, "http_requests_total", "counter", "Requests by route.")
+//	promtext.Sample(&b, "http_requests_total", map[string]string{"route": "/"}, 42)
+//	w.Header().Set("Content-Type", promtext.ContentType)
+//	io.WriteString(w, b.String())
+package promtext
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// Header writes the HELP and TYPE lines of the metric name of kind
+// "counter", "gauge" or "histogram"
+func Header(b *strings.Builder, name, kind, help string) {
+	b.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	b.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// Sample writes one sample of name, with its labels sorted by name
+func Sample(b *strings.Builder, name string, labels map[string]string, value float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(k + `="` + labelEscaper.Replace(labels[k]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + strconv.FormatFloat(value, 'f', -1, 64) + "\n")
+}
+
+// Metric writes the header of a metric with a single sample, and the sample
+func Metric(b *strings.Builder, name, kind, help string, labels map[string]string, value float64) {
+	Header(b, name, kind, help)
+	Sample(b, name, labels, value)
+}
@@ -0,0 +1,42 @@
+package promtext
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+		want   string
+	}{
+		{"no labels", nil, 3, "up 3\n"},
+		{"sorted labels", map[string]string{"route": "/", "method": "GET"}, 1, `up{method="GET",route="/"} 1` + "\n"},
+		{"fractions", nil, 0.25, "up 0.25\n"},
+		{"large counts", nil, 1e15, "up 1000000000000000\n"},
+		{"infinity", nil, math.Inf(1), "up +Inf\n"},
+		{"escaped values", map[string]string{"host": "a\"b\\c\nd"}, 1, `up{host="a\"b\\c\nd"} 1` + "\n"},
+		{"unicode kept", map[string]string{"host": "café"}, 1, `up{host="café"} 1` + "\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		Sample(&b, "up", tt.labels, tt.value)
+		if b.String() != tt.want {
+			t.Errorf("%s: Sample wrote %q, want %q", tt.name, b.String(), tt.want)
+		}
+	}
+}
+
+func TestMetric(t *testing.T) {
+	var b strings.Builder
+	Metric(&b, "queue_depth", "gauge", "Jobs waiting.\nPer queue, with \\ in it.", map[string]string{"queue": "mail"}, 7)
+	want := "# HELP queue_depth Jobs waiting.\\nPer queue, with \\\\ in it.\n" +
+		"# TYPE queue_depth gauge\n" +
+		"queue_depth{queue=\"mail\"} 7\n"
+	if b.String() != want {
+		t.Errorf("Metric wrote %q, want %q", b.String(), want)
+	}
+}
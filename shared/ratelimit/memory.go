@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMaxKeys bounds a Memory created with no bound
+const DefaultMaxKeys = 100_000
+
+// Memory keeps counts in memory, for a service with one replica or limits
+// it needn't share. It holds at most its maximum number of keys, dropping
+// the least recently used; a dropped key starts afresh, as if idle, so the
+// maximum should exceed the clients active at once.
+type Memory struct {
+	maxKeys int
+
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List // of *memoryKey, most recently used first
+}
+
+type memoryKey struct {
+	key   string
+	count count
+}
+
+// NewMemory returns a store of at most maxKeys keys, or DefaultMaxKeys if
+// maxKeys is not positive
+func NewMemory(maxKeys int) *Memory {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &Memory{maxKeys: maxKeys, keys: make(map[string]*list.Element), order: list.New()}
+}
+
+// Take charges a request to key
+func (m *Memory) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.keys[key]
+	if ok {
+		m.order.MoveToFront(e)
+	} else {
+		for m.order.Len() >= m.maxKeys {
+			oldest := m.order.Back()
+			delete(m.keys, oldest.Value.(*memoryKey).key)
+			m.order.Remove(oldest)
+		}
+		e = m.order.PushFront(&memoryKey{key: key})
+		m.keys[key] = e
+	}
+	return e.Value.(*memoryKey).count.take(limit, now), nil
+}
+
+// Len is the number of keys held
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
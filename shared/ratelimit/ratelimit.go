@@ -0,0 +1,259 @@
+// Package ratelimit bounds how fast clients may make requests, per key
+// such as a device or client address. A Limiter applies one Limit to every
+// key, with a token bucket, which allows a burst and then a steady rate,
+// or a sliding window, which allows no more than the burst in any window.
+//
+// Limiters keep their counts in a Store: in memory, bounded to a number of
+// keys, by default, or in Redis, so that the replicas of a service behind a
+// load balancer share their limits:
+//
+//	store, err := ratelimit.OpenRedis("redis://:password@redis:6379/0")
+//	clients := ratelimit.New("proxy-client", ratelimit.PerSecond(20, 40), store)
+//	handler = clients.Middleware(ratelimit.ClientIP)(handler)
+//
+// A request that can't be counted, with Redis unreachable, is allowed: the
+// limits protect the services from overload, and an outage of Redis
+// shouldn't become one of theirs.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nisatyap/shared/logging"
+)
+
+// Algorithm is how a Limit counts requests
+type Algorithm int
+
+const (
+	// TokenBucket allows Burst requests at once, refilled at Rate
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Burst requests in any window of Burst/Rate
+	SlidingWindow
+)
+
+// Limit is how fast one key may make requests
+type Limit struct {
+	// Rate is the sustained requests per second; zero disables the limit
+	Rate float64
+	// Burst is how many requests may be made back to back, at least 1
+	Burst int
+	// Algorithm counts the requests; the zero value is TokenBucket
+	Algorithm Algorithm
+}
+
+// PerSecond is a token bucket of burst refilled at n requests per second
+func PerSecond(n float64, burst int) Limit {
+	return Limit{Rate: n, Burst: burst}
+}
+
+// PerMinute is a token bucket of burst refilled at n requests per minute
+func PerMinute(n float64, burst int) Limit {
+	return Limit{Rate: n / 60, Burst: burst}
+}
+
+// window is the length of a sliding window, in which Burst requests are
+// allowed
+func (l Limit) window() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// ttl is how long a key's count matters after its last request: by then
+// a bucket has refilled, and a window has slid past it
+func (l Limit) ttl() time.Duration {
+	return 2 * l.window()
+}
+
+// Result is the outcome of a request
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long a rejected request should wait
+	RetryAfter time.Duration
+	// Remaining is how many more requests would be allowed now
+	Remaining int
+	// First reports whether a rejected request is the first in a row for
+	// its key, so that a limited client is logged once per burst
+	First bool
+}
+
+// Store keeps the counts of a Limiter's keys
+type Store interface {
+	// Take charges a request to key under limit at now
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Limiter applies a Limit to each key
+type Limiter struct {
+	name  string
+	limit Limit
+	store Store
+}
+
+// New returns a limiter called name, which keeps its counts in store, or
+// in a new Memory if store is nil. Limiters sharing a store need different
+// names.
+func New(name string, limit Limit, store Store) *Limiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	if store == nil {
+		store = NewMemory(0)
+	}
+	return &Limiter{name: name, limit: limit, store: store}
+}
+
+// Limit returns the limit l applies
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Allow charges a request to key. A nil or disabled limiter allows every
+// request. An error from the store is returned with the request allowed.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.AllowAt(ctx, key, time.Now())
+}
+
+// AllowAt is Allow for a request made at now
+func (l *Limiter) AllowAt(ctx context.Context, key string, now time.Time) (Result, error) {
+	if l == nil || l.limit.Rate <= 0 {
+		return Result{Allowed: true, Remaining: math.MaxInt}, nil
+	}
+	r, err := l.store.Take(ctx, l.name+":"+key, l.limit, now)
+	if err != nil {
+		return Result{Allowed: true}, err
+	}
+	return r, nil
+}
+
+// Middleware answers the requests of a key over the limit with 429 Too
+// Many Requests and Retry-After, the key of a request being what key
+// returns for it
+func (l *Limiter) Middleware(key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.Serve(w, r, key(r)) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Serve charges r to key, and if it is over the limit answers it with 429
+// Too Many Requests and Retry-After and returns false
+func (l *Limiter) Serve(w http.ResponseWriter, r *http.Request, key string) bool {
+	result, err := l.Allow(r.Context(), key)
+	if err != nil {
+		logging.FromContext(r.Context()).WarnContext(r.Context(), "rate limit unavailable, allowing request", "limiter", l.name, "error", err)
+	}
+	if result.Allowed {
+		return true
+	}
+	if result.First {
+		logging.FromContext(r.Context()).WarnContext(r.Context(), "rate limiting", "limiter", l.name, "key", key, "retry_after", result.RetryAfter.Round(time.Millisecond))
+	}
+	SetRetryAfter(w, result)
+	http.Error(w, "too many requests, slow down", http.StatusTooManyRequests)
+	return false
+}
+
+// SetRetryAfter sets the Retry-After header of a rejected request's answer,
+// in whole seconds rounded up
+func SetRetryAfter(w http.ResponseWriter, r Result) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(r.RetryAfter.Seconds()))))
+}
+
+// ClientIP keys a request by the address it came from
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// count is a key's state under either algorithm, which Memory keeps and
+// Redis's script mirrors
+type count struct {
+	tokens float64   // TokenBucket: the tokens left
+	last   time.Time // TokenBucket: when they were counted; zero is a full bucket
+
+	start     time.Time // SlidingWindow: the start of the current fixed window
+	cur, prev float64   // SlidingWindow: the requests in it and the one before
+
+	limited bool // whether the last request was rejected
+}
+
+// take charges a request to c under limit at now
+func (c *count) take(limit Limit, now time.Time) Result {
+	var ok bool
+	var wait time.Duration
+	var remaining float64
+	if limit.Algorithm == SlidingWindow {
+		ok, wait, remaining = c.slide(limit, now)
+	} else {
+		ok, wait, remaining = c.refill(limit, now)
+	}
+	r := Result{Allowed: ok, RetryAfter: wait, Remaining: int(remaining), First: !ok && !c.limited}
+	c.limited = !ok
+	return r
+}
+
+// refill takes a token from a bucket refilled continuously at limit.Rate
+func (c *count) refill(limit Limit, now time.Time) (bool, time.Duration, float64) {
+	burst := float64(limit.Burst)
+	if c.last.IsZero() {
+		c.tokens = burst
+	} else {
+		elapsed := max(now.Sub(c.last).Seconds(), 0)
+		c.tokens = math.Min(burst, c.tokens+elapsed*limit.Rate)
+	}
+	c.last = now
+	if c.tokens >= 1 {
+		c.tokens--
+		return true, 0, c.tokens
+	}
+	return false, time.Duration((1 - c.tokens) / limit.Rate * float64(time.Second)), 0
+}
+
+// slide counts a request in a sliding window, estimated from the counts
+// of the current fixed window and the previous one weighted by how much
+// of it the sliding window still covers
+func (c *count) slide(limit Limit, now time.Time) (bool, time.Duration, float64) {
+	window := limit.window()
+	// Windows start at whole windows since the Unix epoch, as in Redis;
+	// Round(0) drops the monotonic clock, which would tell starts apart
+	start := now.Add(-time.Duration(now.UnixNano() % int64(window))).Round(0)
+	switch {
+	case c.start.Equal(start):
+	case c.start.Add(window).Equal(start):
+		c.prev, c.cur = c.cur, 0
+	default:
+		c.prev, c.cur = 0, 0
+	}
+	c.start = start
+
+	burst := float64(limit.Burst)
+	elapsed := float64(now.Sub(start)) / float64(window)
+	estimate := c.prev*(1-elapsed) + c.cur
+	if estimate+1 <= burst {
+		c.cur++
+		return true, 0, burst - estimate - 1
+	}
+	// Wait for the previous window's weight to drop enough, or failing
+	// that, for the current one's in the next window
+	excess := estimate + 1 - burst
+	if c.prev > 0 && c.prev*(1-elapsed) >= excess {
+		return false, time.Duration(excess / c.prev * float64(window)), 0
+	}
+	next := start.Add(window).Sub(now)
+	if c.cur > burst-1 {
+		next += time.Duration((1 - (burst-1)/c.cur) * float64(window))
+	}
+	return false, next, 0
+}
@@ -0,0 +1,261 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	l := New("devices", PerMinute(6, 2), nil)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, false, false} {
+		r, err := l.AllowAt(ctx, "laptop-1", now)
+		if err != nil || r.Allowed != want {
+			t.Fatalf("request %d = %+v, %v; want allowed %v", i, r, err, want)
+		}
+		if i == 2 && (!r.First || r.RetryAfter != 10*time.Second) {
+			t.Errorf("first rejection = %+v, want First and a 10s wait", r)
+		}
+		if i == 3 && r.First {
+			t.Error("second rejection in a row marked first")
+		}
+	}
+	if r, _ := l.AllowAt(ctx, "laptop-2", now); !r.Allowed || r.Remaining != 1 {
+		t.Errorf("another key = %+v", r)
+	}
+	if r, _ := l.AllowAt(ctx, "laptop-1", now.Add(10*time.Second)); !r.Allowed {
+		t.Errorf("after refill = %+v", r)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	// Three requests in any three seconds
+	l := New("api", Limit{Rate: 1, Burst: 3, Algorithm: SlidingWindow}, nil)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Truncate(3 * time.Second)
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, true, false} {
+		if r, _ := l.AllowAt(ctx, "10.0.0.5", start.Add(time.Duration(i)*100*time.Millisecond)); r.Allowed != want {
+			t.Fatalf("request %d = %+v, want allowed %v", i, r, want)
+		}
+	}
+	// A new fixed window still counts the last one's requests in full
+	r, _ := l.AllowAt(ctx, "10.0.0.5", start.Add(3*time.Second))
+	if r.Allowed || r.RetryAfter != time.Second {
+		t.Errorf("at the next window = %+v, want a 1s wait", r)
+	}
+	if r, _ := l.AllowAt(ctx, "10.0.0.5", start.Add(4*time.Second)); !r.Allowed {
+		t.Errorf("a third into the next window = %+v", r)
+	}
+
+	// Times from the clock carry monotonic readings, which mustn't start
+	// a window of their own
+	live := New("api", Limit{Rate: 2.0 / 60, Burst: 2, Algorithm: SlidingWindow}, nil)
+	for i, want := range []bool{true, true, false} {
+		if r, _ := live.Allow(ctx, "10.0.0.5"); r.Allowed != want {
+			t.Errorf("request %d now = %+v, want allowed %v", i, r, want)
+		}
+	}
+}
+
+func TestMemoryBound(t *testing.T) {
+	store := NewMemory(2)
+	l := New("clients", PerSecond(1, 1), store)
+	now := time.Now()
+	ctx := context.Background()
+
+	l.AllowAt(ctx, "a", now)
+	l.AllowAt(ctx, "b", now)
+	if r, _ := l.AllowAt(ctx, "a", now); r.Allowed {
+		t.Fatal("a allowed over its limit")
+	}
+	l.AllowAt(ctx, "c", now) // drops b, the least recently used
+	if store.Len() != 2 {
+		t.Errorf("Len = %d, want 2", store.Len())
+	}
+	if r, _ := l.AllowAt(ctx, "a", now); r.Allowed {
+		t.Error("a was dropped rather than b")
+	}
+	if r, _ := l.AllowAt(ctx, "b", now); !r.Allowed {
+		t.Error("b was kept")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := New("proxy-client", PerSecond(1, 1), nil)
+	handler := l.Middleware(ClientIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("10.0.0.5:40000"); rec.Code != http.StatusOK {
+		t.Errorf("first request = %d", rec.Code)
+	}
+	rec := get("10.0.0.5:40001")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("over the limit = %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := get("10.0.0.6:40000"); rec.Code != http.StatusOK {
+		t.Errorf("another client = %d", rec.Code)
+	}
+
+	var disabled *Limiter
+	if r, err := disabled.Allow(context.Background(), "x"); !r.Allowed || err != nil {
+		t.Errorf("nil limiter = %+v, %v", r, err)
+	}
+}
+
+// fakeRedis answers the commands a Redis store sends, recording them
+func fakeRedis(t *testing.T, answer func(args []string) string) (addr string, commands chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	commands = make(chan []string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					cmd, err := readReply(rd)
+					if err != nil {
+						return
+					}
+					var args []string
+					for _, arg := range cmd.([]any) {
+						args = append(args, arg.(string))
+					}
+					commands <- args
+					fmt.Fprint(conn, answer(args))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), commands
+}
+
+func TestRedis(t *testing.T) {
+	addr, commands := fakeRedis(t, func(args []string) string {
+		switch args[0] {
+		case "EVALSHA":
+			return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		case "EVAL":
+			return "*4\r\n:0\r\n$4\r\n2500\r\n$1\r\n0\r\n:0\r\n"
+		}
+		return "+OK\r\n"
+	})
+	store, err := OpenRedis("redis://swg:hunter2@" + addr + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	r, err := New("collector-device", PerMinute(12, 20), store).AllowAt(context.Background(), "acme/laptop-1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Allowed || r.RetryAfter != 2500*time.Millisecond || !r.First {
+		t.Errorf("result = %+v", r)
+	}
+
+	want := []string{
+		"AUTH swg hunter2",
+		"SELECT 2",
+		"EVALSHA " + takeSHA + " 1 ratelimit:collector-device:acme/laptop-1 0 0.0002 20 1714557600000 200000 100000",
+		"EVAL " + takeScript + " 1 ratelimit:collector-device:acme/laptop-1 0 0.0002 20 1714557600000 200000 100000",
+	}
+	for _, w := range want {
+		if got := strings.Join(<-commands, " "); got != w {
+			t.Errorf("sent %.80q, want %.80q", got, w)
+		}
+	}
+}
+
+// TestRedisServer runs the script in a real Redis, at
+// RATELIMIT_TEST_REDIS_URL, and checks it decides as Memory does
+func TestRedisServer(t *testing.T) {
+	url := os.Getenv("RATELIMIT_TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("RATELIMIT_TEST_REDIS_URL not set")
+	}
+	store, err := OpenRedis(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.Prefix = fmt.Sprintf("ratelimit-test:%d:", time.Now().UnixNano())
+
+	// now isn't on a whole window, and the window, 7s, isn't a whole
+	// number of milliseconds as Burst/Rate works it out in floating point
+	start := time.Date(2024, 5, 1, 10, 0, 0, 123e6, time.UTC)
+	offsets := []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 6 * time.Second,
+		7500 * time.Millisecond, 8 * time.Second, 9 * time.Second, 12 * time.Second, 30 * time.Second, 30100 * time.Millisecond}
+	for _, limit := range []Limit{
+		{Rate: 3.0 / 7, Burst: 3, Algorithm: SlidingWindow},
+		{Rate: 3.0 / 7, Burst: 3, Algorithm: TokenBucket},
+	} {
+		redis, memory := New("test", limit, store), New("test", limit, NewMemory(0))
+		key := fmt.Sprintf("algorithm-%d", limit.Algorithm)
+		allowed := 0
+		for _, offset := range offsets {
+			now := start.Add(offset)
+			got, err := redis.AllowAt(context.Background(), key, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := memory.AllowAt(context.Background(), key, now)
+			if got.Allowed != want.Allowed || got.Remaining != want.Remaining || (got.RetryAfter-want.RetryAfter).Abs() > time.Millisecond {
+				t.Errorf("algorithm %d at +%v: Redis = %+v, Memory = %+v", limit.Algorithm, offset, got, want)
+			}
+			if got.Allowed {
+				allowed++
+			}
+		}
+		if allowed == len(offsets) {
+			t.Errorf("algorithm %d: every request was allowed", limit.Algorithm)
+		}
+	}
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	store, err := OpenRedis("redis://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New("proxy-client", PerSecond(1, 1), store).Allow(context.Background(), "10.0.0.5")
+	if err == nil || !r.Allowed {
+		t.Errorf("unreachable Redis = %+v, %v; want the request allowed with an error", r, err)
+	}
+
+	for _, bad := range []string{"http://redis:6379", "redis:///0", "redis://redis/zero"} {
+		if _, err := OpenRedis(bad); err == nil {
+			t.Errorf("OpenRedis(%q) succeeded", bad)
+		}
+	}
+}
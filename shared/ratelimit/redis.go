@@ -0,0 +1,351 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redis keeps counts in Redis, shared by every replica that uses it. Each
+// request is counted by a script run atomically in Redis, which does what
+// Memory does, on the clock of the replica the request came to; the
+// replicas' clocks should agree to within a small part of the limits'
+// windows. Keys expire once their counts no longer matter.
+type Redis struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	// Timeout bounds each command, besides the caller's context
+	Timeout time.Duration
+	// Prefix begins every key the store sets
+	Prefix string
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// maxIdleRedis is how many connections a Redis store keeps open
+const maxIdleRedis = 8
+
+// OpenRedis returns a store in the Redis at rawURL, as in
+// redis://[user:password@]host[:port][/db], or rediss:// over TLS. It
+// connects when first used.
+func OpenRedis(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis url: %w", err)
+	}
+	r := &Redis{Timeout: time.Second, Prefix: "ratelimit:"}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		r.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return nil, fmt.Errorf("redis url %s: scheme must be redis or rediss", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("redis url %s: no host", u.Redacted())
+	}
+	r.addr = u.Host
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+		if r.password == "" {
+			// redis://password@host, as some clients take it
+			r.username, r.password = "", r.username
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis url %s: database %q is not a number", u.Redacted(), db)
+		}
+	}
+	return r, nil
+}
+
+// takeScript is count.take in Lua. KEYS[1] is the key; ARGV the
+// algorithm (0 TokenBucket, 1 SlidingWindow), rate per millisecond, burst,
+// now, the key's time to live and the sliding window's length, in
+// milliseconds. Windows start at whole milliseconds, so that a window's
+// start survives tostring, which keeps 14 digits. It returns whether the
+// request was allowed, the wait in milliseconds and the requests
+// remaining, as strings since Redis truncates numbers to integers, and
+// whether the key was limited before.
+const takeScript = `
+local algorithm, rate, burst, now, ttl, window = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4]), tonumber(ARGV[5]), tonumber(ARGV[6])
+local c = redis.call('HMGET', KEYS[1], 'a', 'b', 'c', 'limited')
+local limited = c[4] == '1'
+local ok, wait, remaining = false, 0, 0
+if algorithm == 1 then
+	local start = now - now % window
+	local cstart, cur, prev = tonumber(c[1]), tonumber(c[2]) or 0, tonumber(c[3]) or 0
+	if cstart == start then
+	elseif cstart == start - window then
+		prev, cur = cur, 0
+	else
+		prev, cur = 0, 0
+	end
+	local elapsed = (now - start) / window
+	local estimate = prev * (1 - elapsed) + cur
+	if estimate + 1 <= burst then
+		cur = cur + 1
+		ok, remaining = true, burst - estimate - 1
+	else
+		local excess = estimate + 1 - burst
+		if prev > 0 and prev * (1 - elapsed) >= excess then
+			wait = excess / prev * window
+		else
+			wait = start + window - now
+			if cur > burst - 1 then
+				wait = wait + (1 - (burst - 1) / cur) * window
+			end
+		end
+	end
+	redis.call('HSET', KEYS[1], 'a', tostring(start), 'b', tostring(cur), 'c', tostring(prev), 'limited', ok and '0' or '1')
+else
+	local tokens, last = tonumber(c[1]), tonumber(c[2])
+	if last == nil then
+		tokens = burst
+	else
+		tokens = math.min(burst, tokens + math.max(now - last, 0) * rate)
+	end
+	if tokens >= 1 then
+		tokens = tokens - 1
+		ok, remaining = true, tokens
+	else
+		wait = (1 - tokens) / rate
+	end
+	redis.call('HSET', KEYS[1], 'a', tostring(tokens), 'b', tostring(now), 'limited', ok and '0' or '1')
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {ok and 1 or 0, tostring(wait), tostring(remaining), limited and 1 or 0}
+`
+
+var takeSHA = func() string {
+	sum := sha1.Sum([]byte(takeScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// Take charges a request to key
+func (r *Redis) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	args := []string{
+		"1", r.Prefix + key,
+		strconv.Itoa(int(limit.Algorithm)),
+		strconv.FormatFloat(limit.Rate/1000, 'g', -1, 64),
+		strconv.Itoa(limit.Burst),
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(max(limit.ttl().Milliseconds(), 1), 10),
+		strconv.FormatInt(max(limit.window().Round(time.Millisecond).Milliseconds(), 1), 10),
+	}
+	reply, err := r.do(ctx, append([]string{"EVALSHA", takeSHA}, args...)...)
+	var rerr redisError
+	if errors.As(err, &rerr) && strings.HasPrefix(string(rerr), "NOSCRIPT") {
+		// EVAL caches the script for the EVALSHAs that follow
+		reply, err = r.do(ctx, append([]string{"EVAL", takeScript}, args...)...)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	values, ok := reply.([]any)
+	if !ok || len(values) != 4 {
+		return Result{}, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	waitMS, _ := values[1].(string)
+	remaining, _ := values[2].(string)
+	limited, _ := values[3].(int64)
+	wait, _ := strconv.ParseFloat(waitMS, 64)
+	left, _ := strconv.ParseFloat(remaining, 64)
+	return Result{
+		Allowed:    allowed == 1,
+		RetryAfter: time.Duration(wait * float64(time.Millisecond)),
+		Remaining:  int(left),
+		First:      allowed == 0 && limited == 0,
+	}, nil
+}
+
+// String returns the store's address and database, without its password
+func (r *Redis) String() string {
+	return fmt.Sprintf("%s/%d", r.addr, r.db)
+}
+
+// Ping checks that Redis answers, as a health check
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.idle {
+		c.conn.Close()
+	}
+	r.idle = nil
+	return nil
+}
+
+// do sends a command on an idle connection, or a new one, and returns its
+// reply. A connection is reused unless the command failed on it.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(ctx, r.Timeout, args...)
+	var rerr redisError
+	if err != nil && !errors.As(err, &rerr) {
+		c.conn.Close()
+		return nil, fmt.Errorf("redis %s: %w", r.addr, err)
+	}
+	r.put(c)
+	return reply, err
+}
+
+func (r *Redis) get(ctx context.Context) (*redisConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return c, nil
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	var conn net.Conn
+	var err error
+	if r.tls != nil {
+		conn, err = (&tls.Dialer{Config: r.tls}).DialContext(ctx, "tcp", r.addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", r.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	c := &redisConn{conn: conn, rd: bufio.NewReader(conn)}
+	var setup [][]string
+	if r.password != "" {
+		if r.username != "" {
+			setup = append(setup, []string{"AUTH", r.username, r.password})
+		} else {
+			setup = append(setup, []string{"AUTH", r.password})
+		}
+	}
+	if r.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	for _, args := range setup {
+		if _, err := c.do(ctx, r.Timeout, args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis %s %s: %w", r.addr, strings.ToLower(args[0]), err)
+		}
+	}
+	return c, nil
+}
+
+func (r *Redis) put(c *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) >= maxIdleRedis {
+		c.conn.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+// redisError is an error reply
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisConn speaks RESP, Redis's protocol, on a connection
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// do sends a command and reads its reply, by the earlier of the context's
+// deadline and timeout
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+// readReply reads a reply: a string, an int64, nil, a redisError or a
+// []any of them
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+	switch kind, rest := line[0], line[1:]; kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = readReply(rd); err != nil {
+				var rerr redisError
+				if !errors.As(err, &rerr) {
+					return nil, err
+				}
+				values[i] = rerr
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// lookupKeychain reads the password the OS keychain keeps for a service
+// and account, named as "swg-proxy/admin"
+func lookupKeychain(ctx context.Context, name string) (string, error) {
+	service, account, ok := strings.Cut(name, "/")
+	if !ok || service == "" || account == "" {
+		return "", fmt.Errorf("keychain reference needs a service and account, as in keychain:service/account")
+	}
+	args, err := keychainCommand(runtime.GOOS, service, account)
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && stdout.Len() == 0 {
+			// Both tools exit non-zero, saying little, for a missing item
+			return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), ErrNotFound)
+		}
+		return "", fmt.Errorf("keychain: %w", err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// keychainCommand returns the command line that prints the password
+func keychainCommand(goos, service, account string) ([]string, error) {
+	switch goos {
+	case "darwin":
+		return []string{"security", "find-generic-password", "-s", service, "-a", account, "-w"}, nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return []string{"secret-tool", "lookup", "service", service, "account", account}, nil
+	}
+	return nil, fmt.Errorf("keychain secrets are not supported on %s", goos)
+}
@@ -0,0 +1,139 @@
+// Package secrets looks up the services' credentials, such as admin
+// tokens, signing keys and database passwords, from where they are kept
+// rather than from plaintext in flags and config files. A setting that
+// holds a secret may name it with a reference instead:
+//
+//	env:NAME                  the environment variable NAME
+//	file:/path/to/secret      the file's contents, surrounding whitespace trimmed
+//	vault:PATH#FIELD          FIELD of the HashiCorp Vault secret at PATH
+//	keychain:SERVICE/ACCOUNT  the OS keychain's password for SERVICE and ACCOUNT
+//
+// Resolve returns the secret a reference names, and any other value as it
+// is, so that settings written before references keep working.
+//
+// Vault is reached at $VAULT_ADDR with the token in $VAULT_TOKEN, or in
+// ~/.vault-token as the vault CLI leaves it, and $VAULT_NAMESPACE if set.
+// PATH is the secret's API path after /v1/, e.g. secret/data/swg/policy
+// for a KV version 2 engine mounted at secret/. FIELD may be left out of a
+// secret with a single field.
+//
+// The keychain is the macOS login keychain, read with security(1), or on
+// Linux the Secret Service, e.g. GNOME Keyring, read with secret-tool(1)
+// from the attributes service and account.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned, wrapped, for a reference to a secret that
+// doesn't exist
+var ErrNotFound = errors.New("secret not found")
+
+// Provider looks secrets up in one store
+type Provider interface {
+	// Lookup returns the secret called name: what follows the scheme in
+	// a reference
+	Lookup(ctx context.Context, name string) (string, error)
+}
+
+// ProviderFunc adapts a function to a Provider
+type ProviderFunc func(ctx context.Context, name string) (string, error)
+
+// Lookup calls f
+func (f ProviderFunc) Lookup(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{
+		"env":      ProviderFunc(lookupEnv),
+		"file":     ProviderFunc(lookupFile),
+		"vault":    &Vault{},
+		"keychain": ProviderFunc(lookupKeychain),
+	}
+)
+
+// Register makes p resolve the references of scheme, replacing the
+// provider it had, e.g. to reach Vault with other settings than the
+// environment's
+func Register(scheme string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[scheme] = p
+}
+
+// Schemes returns the schemes references may use, sorted
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	schemes := make([]string, 0, len(providers))
+	for scheme := range providers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// IsReference reports whether value names a secret, rather than being one
+func IsReference(value string) bool {
+	_, ok := provider(value)
+	return ok
+}
+
+// provider returns the provider of a reference
+func provider(value string) (Provider, bool) {
+	scheme, _, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[scheme]
+	return p, ok
+}
+
+// Resolve returns the secret value names, or value itself if it isn't a
+// reference. An empty secret is an error, since a setting referring to
+// one would otherwise fall back to no credentials at all.
+func Resolve(ctx context.Context, value string) (string, error) {
+	p, ok := provider(value)
+	if !ok {
+		return value, nil
+	}
+	_, name, _ := strings.Cut(value, ":")
+	secret, err := p.Lookup(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", value, err)
+	}
+	if secret == "" {
+		return "", fmt.Errorf("secret %s is empty", value)
+	}
+	return secret, nil
+}
+
+func lookupEnv(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("$%s is not set: %w", name, ErrNotFound)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+func lookupFile(_ context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
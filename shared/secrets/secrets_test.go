@@ -0,0 +1,152 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TEST_SECRET", "hunter2")
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte("  s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for ref, want := range map[string]string{
+		"env:TEST_SECRET": "hunter2",
+		"file:" + file:    "s3cret",
+		// Values that aren't references are the secret itself
+		"plaintext":              "plaintext",
+		"postgres://u:p@db/x":    "postgres://u:p@db/x",
+		"token-with:colon-in-it": "token-with:colon-in-it",
+		"":                       "",
+	} {
+		if got, err := Resolve(ctx, ref); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", ref, got, err, want)
+		}
+	}
+	for _, ref := range []string{"env:NO_SUCH_SECRET_SET", "file:" + file + ".missing"} {
+		if _, err := Resolve(ctx, ref); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Resolve(%q) = %v, want ErrNotFound", ref, err)
+		}
+	}
+	t.Setenv("EMPTY_SECRET", "")
+	if _, err := Resolve(ctx, "env:EMPTY_SECRET"); err == nil {
+		t.Error("Resolve of an empty secret succeeded")
+	}
+	if !IsReference("vault:secret/data/x#y") || !IsReference("keychain:svc/acct") || IsReference("vaults:x") {
+		t.Error("IsReference misjudged a scheme")
+	}
+
+	Register("test", ProviderFunc(func(_ context.Context, name string) (string, error) {
+		return strings.ToUpper(name), nil
+	}))
+	defer func() {
+		mu.Lock()
+		delete(providers, "test")
+		mu.Unlock()
+	}()
+	if got, err := Resolve(ctx, "test:abc"); err != nil || got != "ABC" {
+		t.Errorf("registered provider resolved %q, %v", got, err)
+	}
+}
+
+func TestVault(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "swg" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/policy":
+			fmt.Fprint(w, `{"data":{"data":{"admin_token":"hunter2","db_password":"s3cret"},"metadata":{"version":3}}}`)
+		case "/v1/kv/proxy":
+			fmt.Fprint(w, `{"data":{"token":"xyzzy"}}`)
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+	t.Setenv("VAULT_NAMESPACE", "swg")
+	ctx := context.Background()
+
+	for ref, want := range map[string]string{
+		"vault:secret/data/policy#db_password": "s3cret",
+		"vault:/kv/proxy":                      "xyzzy", // the only field
+	} {
+		if got, err := Resolve(ctx, ref); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", ref, got, err, want)
+		}
+	}
+	for ref, want := range map[string]string{
+		"vault:secret/data/policy":      "has fields admin_token, db_password",
+		"vault:secret/data/policy#nope": "no field nope",
+		"vault:secret/data/missing#x":   ErrNotFound.Error(),
+		"vault:#x":                      "needs a path",
+	} {
+		if _, err := Resolve(ctx, ref); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Resolve(%q) = %v, want an error containing %q", ref, err, want)
+		}
+	}
+	t.Setenv("VAULT_TOKEN", "wrong")
+	if _, err := Resolve(ctx, "vault:kv/proxy"); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Resolve with a bad token = %v", err)
+	}
+}
+
+func TestKeychainCommand(t *testing.T) {
+	for goos, want := range map[string]string{
+		"darwin": "security find-generic-password -s swg-proxy -a admin -w",
+		"linux":  "secret-tool lookup service swg-proxy account admin",
+	} {
+		if args, err := keychainCommand(goos, "swg-proxy", "admin"); err != nil || strings.Join(args, " ") != want {
+			t.Errorf("keychainCommand(%s) = %v, %v", goos, args, err)
+		}
+	}
+	if _, err := keychainCommand("windows", "swg-proxy", "admin"); err == nil {
+		t.Error("keychain supported on windows")
+	}
+	if _, err := Resolve(context.Background(), "keychain:no-account"); err == nil {
+		t.Error("keychain reference without an account resolved")
+	}
+}
+
+func TestWithPassword(t *testing.T) {
+	for conn, want := range map[string]string{
+		"postgres://posture@db/posture":     "postgres://posture:p%40ss%27@db/posture",
+		"postgres://posture:old@db/posture": "postgres://posture:p%40ss%27@db/posture",
+		"host=db user=posture":              `host=db user=posture password='p@ss\''`,
+	} {
+		if got, err := WithPassword(conn, "p@ss'"); err != nil || got != want {
+			t.Errorf("WithPassword(%q) = %q, %v, want %q", conn, got, err, want)
+		}
+	}
+	if _, err := WithPassword("postgres://posture:sec ret@db:port/x", "p"); err == nil || strings.Contains(err.Error(), "sec ret") {
+		t.Errorf("WithPassword of a bad URL = %v, want an error without the URL", err)
+	}
+}
+
+func TestFromFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := FromFile("flag", ""); err != nil || got != "flag" {
+		t.Errorf("FromFile without a file = %q, %v, want flag", got, err)
+	}
+	if got, err := FromFile("flag", file); err != nil || got != "from-file" {
+		t.Errorf("FromFile = %q, %v, want from-file", got, err)
+	}
+	if _, err := FromFile("flag", file+".missing"); err == nil {
+		t.Error("FromFile of a missing file succeeded")
+	}
+}
@@ -0,0 +1,43 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// FromFile returns the secret kept in the file at path, surrounding
+// whitespace trimmed, if path is set, or else value, as for a service's
+// -admin-token and -admin-token-file
+func FromFile(value, path string) (string, error) {
+	if path == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// WithPassword sets the password of a PostgreSQL connection string, either
+// a URL or key=value settings, so that it can be kept out of the
+// connection string a service is configured with
+func WithPassword(conn, password string) (string, error) {
+	if !strings.Contains(conn, "://") {
+		return conn + " password='" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password) + "'", nil
+	}
+	u, err := url.Parse(conn)
+	if err != nil {
+		// The error would repeat the URL, which may hold a password
+		return "", errors.New("not a valid PostgreSQL URL")
+	}
+	var user string
+	if u.User != nil {
+		user = u.User.Username()
+	}
+	u.User = url.UserPassword(user, password)
+	return u.String(), nil
+}
@@ -0,0 +1,144 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/httpclient"
+)
+
+// Vault reads secrets from HashiCorp Vault's HTTP API: the data of the
+// KV version 1 or 2 secret at a path. The zero Vault takes its settings
+// from the environment as the vault CLI does.
+type Vault struct {
+	// Addr is Vault's URL, e.g. https://vault:8200; empty uses $VAULT_ADDR
+	Addr string
+	// Token authenticates to Vault; empty uses $VAULT_TOKEN, then
+	// ~/.vault-token
+	Token string
+	// Namespace is the Vault Enterprise namespace, if any; empty uses
+	// $VAULT_NAMESPACE
+	Namespace string
+	// Client sends the requests; nil uses one that retries three times
+	Client *httpclient.Client
+
+	once   sync.Once
+	client *httpclient.Client
+}
+
+// Lookup returns a field of the secret at a path, named as
+// "secret/data/swg/policy#admin_token"
+func (v *Vault) Lookup(ctx context.Context, name string) (string, error) {
+	path, field, _ := strings.Cut(name, "#")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", fmt.Errorf("vault reference needs a path, as in vault:secret/data/app#field")
+	}
+	addr := firstSet(v.Addr, os.Getenv("VAULT_ADDR"))
+	if addr == "" {
+		return "", fmt.Errorf("vault address not set: set $VAULT_ADDR")
+	}
+	token := firstSet(v.Token, os.Getenv("VAULT_TOKEN"))
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if token == "" {
+		return "", fmt.Errorf("vault token not set: set $VAULT_TOKEN or run vault login")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := firstSet(v.Namespace, os.Getenv("VAULT_NAMESPACE")); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := v.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("vault path %s: %w", path, ErrNotFound)
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("vault path %s: %w", path, err)
+	}
+	data := secret.Data
+	// A KV version 2 secret's fields are under data.data, beside its
+	// metadata
+	if inner, ok := data["data"]; ok && data["metadata"] != nil {
+		data = nil
+		if err := json.Unmarshal(inner, &data); err != nil {
+			return "", fmt.Errorf("vault path %s: %w", path, err)
+		}
+	}
+	if field == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("vault path %s has fields %s: name one, as in vault:%s#field", path, strings.Join(fieldNames(data), ", "), path)
+		}
+		for name := range data {
+			field = name
+		}
+	}
+	raw, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault path %s has no field %s: %w", path, field, ErrNotFound)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("vault path %s: field %s is not a string", path, field)
+	}
+	return value, nil
+}
+
+func (v *Vault) httpClient() *httpclient.Client {
+	if v.Client != nil {
+		return v.Client
+	}
+	v.once.Do(func() {
+		v.client, _ = httpclient.New(httpclient.Options{Timeout: 10 * time.Second, Attempts: 3})
+	})
+	return v.client
+}
+
+func fieldNames(data map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func firstSet(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package sqlstore
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/sqlite/0010_keys.sql":    {Data: []byte("CREATE TABLE keys (id TEXT)")},
+		"migrations/sqlite/0002_reports.sql": {Data: []byte("CREATE TABLE reports (id INTEGER)")},
+		"migrations/sqlite/README":           {Data: []byte("not a migration")},
+	}
+	migrations, err := ReadMigrations(fsys, "migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ordered by version, not name
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[1].Version != 10 || migrations[1].SQL != "CREATE TABLE keys (id TEXT)" {
+		t.Errorf("migrations = %+v, want 0002 then 0010", migrations)
+	}
+
+	fsys["migrations/sqlite/initial.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	if _, err := ReadMigrations(fsys, "migrations/sqlite"); err == nil {
+		t.Error("ReadMigrations accepted a migration without a version")
+	}
+	if _, err := ReadMigrations(fsys, "migrations/postgres"); err == nil {
+		t.Error("ReadMigrations of a missing directory succeeded")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := `SELECT id FROM reports WHERE tenant = ? AND hostname = ?`
+	if got := Rebind(SQLite, query); got != query {
+		t.Errorf("Rebind(sqlite) = %s", got)
+	}
+	if got, want := Rebind(Postgres, query), `SELECT id FROM reports WHERE tenant = $1 AND hostname = $2`; got != want {
+		t.Errorf("Rebind(postgres) = %s, want %s", got, want)
+	}
+}
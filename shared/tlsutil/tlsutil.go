@@ -0,0 +1,256 @@
+// Package tlsutil builds the services' TLS configurations from the files
+// and settings they declare, for servers and clients alike, and reloads
+// certificates as they are renewed.
+//
+// A Reloader re-reads its files when they change on disk, checked at most
+// once every ReloadCheck on a handshake, and whenever Reload is called, as
+// on SIGHUP. A renewed certificate is so served, or presented, without a
+// restart; connections already established keep what they negotiated.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client authentication modes of a server
+const (
+	// ClientAuthNone asks clients for no certificate
+	ClientAuthNone = "none"
+	// ClientAuthRequest verifies a client certificate against the CA if
+	// one is presented, leaving it to handlers to insist
+	ClientAuthRequest = "request"
+	// ClientAuthRequire refuses clients without a certificate from the CA
+	ClientAuthRequire = "require"
+)
+
+// ReloadCheck is how often, at most, a Reloader looks for changed files
+var ReloadCheck = time.Second
+
+// Config declares a TLS configuration
+type Config struct {
+	// CertFile and KeyFile are the PEM certificate and key a server
+	// serves, or a client presents; a client may leave them empty
+	CertFile string
+	KeyFile  string
+	// CAFile is the PEM bundle a server verifies client certificates
+	// against, or a client verifies the server's; empty, a client uses
+	// the system roots
+	CAFile string
+	// MinVersion is "1.2", the default, or "1.3"
+	MinVersion string
+	// ClientAuth is a server's mode, ClientAuthRequest if CAFile is set
+	// and ClientAuthNone if not
+	ClientAuth string
+}
+
+// Enabled reports whether c names any file, that is whether TLS is wanted
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != ""
+}
+
+// Validate checks that c is consistent, without reading its files
+func (c Config) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("a TLS certificate and key must be set together")
+	}
+	if _, err := minVersion(c.MinVersion); err != nil {
+		return err
+	}
+	switch c.ClientAuth {
+	case "", ClientAuthNone:
+	case ClientAuthRequest, ClientAuthRequire:
+		if c.CAFile == "" {
+			return fmt.Errorf("client auth %q needs a CA file to verify client certificates against", c.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("invalid client auth %q (want none, request or require)", c.ClientAuth)
+	}
+	return nil
+}
+
+func minVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid TLS minimum version %q (want 1.2 or 1.3)", v)
+}
+
+// Reloader holds the certificate and CA that a Config names, reloading
+// them as the package doc describes
+type Reloader struct {
+	cfg Config
+	min uint16
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTimes  [3]time.Time // of the certificate, key and CA files loaded
+	checkedAt time.Time
+	err       error // of the last reload on a file change, until one succeeds
+}
+
+// New validates cfg and loads its files
+func New(cfg Config) (*Reloader, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	r := &Reloader{cfg: cfg}
+	r.min, _ = minVersion(cfg.MinVersion)
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the certificate, key and CA. On error the ones loaded
+// before stay in use.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load(r.modTimesNow())
+}
+
+// load reads the files; the caller holds the write lock
+func (r *Reloader) load(modTimes [3]time.Time) error {
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load TLS certificate: %w", err)
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		pem, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("load CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("load CA: no certificates in %s", r.cfg.CAFile)
+		}
+	}
+	r.cert, r.pool, r.modTimes, r.err = cert, pool, modTimes, nil
+	return nil
+}
+
+func (r *Reloader) modTimesNow() [3]time.Time {
+	var times [3]time.Time
+	for i, path := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// current returns the certificate and CA, first reloading them if their
+// files have changed since they were loaded
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	due := time.Since(r.checkedAt) >= ReloadCheck
+	cert, pool := r.cert, r.pool
+	r.mu.RUnlock()
+	if !due {
+		return cert, pool
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checkedAt) >= ReloadCheck {
+		r.checkedAt = time.Now()
+		if times := r.modTimesNow(); times != r.modTimes {
+			if err := r.load(times); err != nil {
+				// A certificate caught half written is retried next
+				// check; until then the loaded one serves
+				r.err = err
+			}
+		}
+	}
+	return r.cert, r.pool
+}
+
+// Err returns the error of the last reload made because the files changed,
+// if it failed and nothing has been loaded since
+func (r *Reloader) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+// ServerConfig returns a server configuration serving the certificate and
+// verifying client certificates as the Config's ClientAuth says
+func (r *Reloader) ServerConfig() (*tls.Config, error) {
+	if r.cfg.CertFile == "" {
+		return nil, errors.New("a TLS server needs a certificate and key")
+	}
+	base := &tls.Config{
+		MinVersion: r.min,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+	}
+	mode := r.cfg.ClientAuth
+	if mode == "" && r.cfg.CAFile != "" {
+		mode = ClientAuthRequest
+	}
+	switch mode {
+	case ClientAuthRequest:
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return base, nil
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		_, pool := r.current()
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = pool
+		return c, nil
+	}
+	return base, nil
+}
+
+// ClientConfig returns a client configuration verifying servers against
+// the CA, or the system roots without one, and presenting the certificate,
+// if any. The CA is fixed when ClientConfig is called; the certificate is
+// reloaded.
+func (r *Reloader) ClientConfig() *tls.Config {
+	_, pool := r.current()
+	c := &tls.Config{MinVersion: r.min, RootCAs: pool}
+	if r.cfg.CertFile != "" {
+		c.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		}
+	}
+	return c
+}
+
+// ClientConfig returns the client configuration cfg declares, or nil if it
+// names no file, so that a client without TLS settings uses the defaults
+func ClientConfig(cfg Config) (*tls.Config, error) {
+	if !cfg.Enabled() && cfg.MinVersion == "" {
+		return nil, nil
+	}
+	r, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return r.ClientConfig(), nil
+}
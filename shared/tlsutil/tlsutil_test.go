@@ -0,0 +1,217 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issue creates a certificate for cn signed by parent (self-signed when nil)
+func issue(t *testing.T, cn string, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// writePair writes cert to certFile and, if keyFile is set, key to keyFile,
+// dated at so that the Reloader sees them change
+func writePair(t *testing.T, certFile, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey, at time.Time) {
+	t.Helper()
+	files := map[string][]byte{certFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})}
+	if keyFile != "" {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[keyFile] = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, at, at)
+	}
+}
+
+// pki is a CA, a server certificate from it, and a client certificate
+// from it, in files
+type pki struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	server Config
+	client Config
+}
+
+func newPKI(t *testing.T) pki {
+	dir := t.TempDir()
+	p := pki{
+		server: Config{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "server.key"), CAFile: filepath.Join(dir, "ca.crt")},
+		client: Config{CertFile: filepath.Join(dir, "client.crt"), KeyFile: filepath.Join(dir, "client.key"), CAFile: filepath.Join(dir, "ca.crt")},
+	}
+	p.ca, p.caKey = issue(t, "ca", 1, nil, nil, true)
+	at := time.Now().Add(-time.Minute)
+	writePair(t, p.server.CAFile, "", p.ca, nil, at)
+	server, serverKey := issue(t, "server", 2, p.ca, p.caKey, false)
+	writePair(t, p.server.CertFile, p.server.KeyFile, server, serverKey, at)
+	client, clientKey := issue(t, "laptop-1", 3, p.ca, p.caKey, false)
+	writePair(t, p.client.CertFile, p.client.KeyFile, client, clientKey, at)
+	return p
+}
+
+// serve starts an HTTPS server with cfg that replies with the client
+// certificate's common name
+func serve(t *testing.T, cfg Config) *httptest.Server {
+	t.Helper()
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	if srv.TLS, err = r.ServerConfig(); err != nil {
+		t.Fatal(err)
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get fetches url with a client for cfg, returning the server's serial and
+// the client name it saw
+func get(t *testing.T, url string, cfg Config) (serial int64, name string, err error) {
+	t.Helper()
+	tlsConfig, err := ClientConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig.ServerName = "server"
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body := make([]byte, 64)
+	n, _ := resp.Body.Read(body)
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), string(body[:n]), nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	p := newPKI(t)
+	anonymous := Config{CAFile: p.client.CAFile}
+
+	srv := serve(t, p.server) // ClientAuthRequest, as a CA is set
+	if serial, name, err := get(t, srv.URL, p.client); err != nil || serial != 2 || name != "laptop-1" {
+		t.Errorf("with a client certificate: serial %d, name %q, %v", serial, name, err)
+	}
+	if _, name, err := get(t, srv.URL, anonymous); err != nil || name != "" {
+		t.Errorf("without a client certificate: name %q, %v", name, err)
+	}
+
+	required := p.server
+	required.ClientAuth = ClientAuthRequire
+	srv = serve(t, required)
+	if _, _, err := get(t, srv.URL, anonymous); err == nil {
+		t.Error("ClientAuthRequire served a client without a certificate")
+	}
+	if _, name, err := get(t, srv.URL, p.client); err != nil || name != "laptop-1" {
+		t.Errorf("ClientAuthRequire with a certificate: name %q, %v", name, err)
+	}
+
+	// The client refuses a server from another CA
+	other, otherKey := issue(t, "other-ca", 9, nil, nil, true)
+	writePair(t, p.client.CAFile, "", other, otherKey, time.Now())
+	if _, _, err := get(t, srv.URL, p.client); err == nil {
+		t.Error("client accepted a server from an unknown CA")
+	}
+}
+
+func TestHotReload(t *testing.T) {
+	defer func(d time.Duration) { ReloadCheck = d }(ReloadCheck)
+	ReloadCheck = 0
+	p := newPKI(t)
+	srv := serve(t, p.server)
+
+	// A renewed certificate is served once its files change
+	renewed, renewedKey := issue(t, "server", 5, p.ca, p.caKey, false)
+	writePair(t, p.server.CertFile, p.server.KeyFile, renewed, renewedKey, time.Now())
+	if serial, _, err := get(t, srv.URL, p.client); err != nil || serial != 5 {
+		t.Errorf("after renewal: serial %d, %v", serial, err)
+	}
+
+	// A broken one isn't; the last good one serves until it is fixed
+	os.WriteFile(p.server.CertFile, []byte("half written"), 0o600)
+	os.Chtimes(p.server.CertFile, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	if serial, _, err := get(t, srv.URL, p.client); err != nil || serial != 5 {
+		t.Errorf("after a broken renewal: serial %d, %v", serial, err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	p := newPKI(t)
+	r, err := New(p.server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(p.server.CAFile, []byte("not a certificate"), 0o600)
+	if err := r.Reload(); err == nil {
+		t.Error("Reload accepted an invalid CA")
+	}
+	if _, err := New(Config{CertFile: p.server.CertFile, KeyFile: p.client.KeyFile}); err == nil {
+		t.Error("New loaded a mismatched key")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []Config{
+		{CertFile: "a.crt"},
+		{MinVersion: "1.1"},
+		{ClientAuth: ClientAuthRequire},
+		{CAFile: "ca.crt", ClientAuth: "sometimes"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate accepted %+v", c)
+		}
+	}
+	if err := (Config{CertFile: "a.crt", KeyFile: "a.key", CAFile: "ca.crt", MinVersion: "1.3", ClientAuth: ClientAuthRequire}).Validate(); err != nil {
+		t.Error(err)
+	}
+	if c, err := ClientConfig(Config{}); c != nil || err != nil {
+		t.Errorf("ClientConfig of nothing = %v, %v", c, err)
+	}
+}
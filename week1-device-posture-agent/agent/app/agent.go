@@ -0,0 +1,545 @@
+// Package app is the device posture agent: its command line, which the
+// agent's own binary and the unified swg binary run, and everything the
+// commands do
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/httpclient"
+	"github.com/nisatyap/shared/lifecycle"
+)
+
+const (
+	defaultCollectorURL      = "http://localhost:8000/report"
+	defaultInterval          = 10 * time.Second
+	defaultInventoryInterval = 5 * time.Minute
+	flagsInterval            = 5 * time.Minute
+	maxRetries               = 3
+)
+
+// agentFlags are the features the agent checks
+var agentFlags = []flags.Flag{
+	{Name: flags.DeltaReports, Description: "Leave the OS and checks out of reports while they are unchanged"},
+}
+
+// runConfig holds the options for the long-running "run" command
+type runConfig struct {
+	CollectorURL  string
+	APIKeyFile    string // device API key issued at enrollment
+	EnrollToken   string // one-time token to enroll with when APIKeyFile doesn't exist yet
+	TLS           ClientTLS
+	Interval      time.Duration
+	DryRun        bool
+	MetricsListen string
+	StallTimeout  time.Duration
+	Policy        string // policy file or URL; empty uses the built-in checks
+	Notify        bool
+	Tray          bool
+	Manifest      string        // release manifest for the binary hash self-check
+	WatchFiles    string        // comma-separated config files to watch for tampering
+	Inventory     time.Duration // how often to diff software, ports and USB devices; 0 disables
+	InventoryFile string        // where the last inventory snapshot is kept across restarts
+	QuietHours    string        // "HH:MM-HH:MM" window without desktop notifications
+	TokenFile     string        // where to keep the posture token for local software
+	TrustRelay    string        // address of the relay adding the posture token to requests
+	Gateway       string        // proxy the relay forwards to
+	Features      string        // feature flags, e.g. "delta-reports=on"
+	FlagsURL      string        // policy engine's GET /flags; empty uses Features alone
+	Plaintext     []string      // secret flags given in the clear, to warn of
+	Log           LogConfig
+	Process       ProcessLimits
+	Limits        ResourceLimits
+}
+
+// stallTimeout is how long the report loop may go without completing a cycle.
+// The default leaves room for a full retry sequence on top of the interval.
+func (c runConfig) stallTimeout() time.Duration {
+	if c.StallTimeout > 0 {
+		return c.StallTimeout
+	}
+	return 3*c.Interval + time.Minute
+}
+
+// Agent wires together collection, reporting and supervision for "agent run"
+type Agent struct {
+	cfg        runConfig
+	collector  *SystemCollector
+	reporter   *Reporter
+	metrics    *MetricsExporter
+	supervisor *Supervisor
+	logs       *LogBuffer // nil unless log forwarding is enabled
+	checks     []Check    // built-in or policy checks, plus the integrity check
+	scoring    ScoringModel
+	integrity  *IntegrityMonitor // nil unless a manifest or watched files are set
+	inventory  *InventoryTracker // nil when inventory tracking is disabled
+	notifier   *Notifier         // nil unless desktop notifications are enabled
+	trust      *TrustBroker      // nil unless a posture token file or relay is set
+	features   *flags.Set
+	board      *StatusBoard
+	trigger    chan struct{} // requests an immediate collection
+	log        *slog.Logger
+}
+
+// NewAgent creates a new Agent instance
+func NewAgent(cfg runConfig, logger *slog.Logger) *Agent {
+	hostname, _ := os.Hostname()
+	agent := &Agent{
+		cfg:        cfg,
+		collector:  NewSystemCollector(cfg.Limits, logger),
+		reporter:   NewReporter(cfg.CollectorURL, cfg.APIKeyFile, logger),
+		metrics:    NewMetricsExporter(),
+		supervisor: NewSupervisor(cfg.stallTimeout(), logger),
+		checks:     DefaultChecks(),
+		scoring:    DefaultScoringModel(),
+		board:      NewStatusBoard(),
+		trigger:    make(chan struct{}, 1),
+		features:   flags.New(hostname, agentFlags...),
+		log:        logger,
+	}
+	agent.features.SetLogger(logger)
+	agent.reporter.OnAttempt = agent.metrics.ObserveAttempt
+	agent.reporter.features = agent.features
+	agent.metrics.features = agent.features
+	if cfg.Inventory > 0 {
+		agent.inventory = NewInventoryTracker(cfg.Inventory, cfg.InventoryFile, agent.collector.limits.CheckTimeout, logger)
+	}
+	return agent
+}
+
+// Main runs the agent's command line, args without the program name, and
+// returns its exit code. name is how the agent is invoked, e.g. "agent",
+// or "swg agent" from the unified binary; the service it installs is run
+// the same way.
+func Main(name string, args []string) int {
+	invocation = strings.Fields(name)[1:]
+	return rootCommand(name).Execute(name, normalizeArgs(args))
+}
+
+// runAgent collects and reports on a fixed interval until it receives SIGINT
+// or SIGTERM, or a value arrives on stop
+func runAgent(cfg runConfig, stop <-chan os.Signal) int {
+	var logs *LogBuffer
+	if cfg.Log.Forward {
+		logs = NewLogBuffer(cfg.Log.ForwardMax)
+	}
+	logger, closer, err := setupLogging(cfg.Log, logs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "run: %v\n", err)
+		return 2
+	}
+	defer closer.Close()
+	agent := NewAgent(cfg, logger)
+	agent.logs = logs
+	for _, name := range cfg.Plaintext {
+		logger.Warn("secret set in plaintext; give a secret reference such as env:, file:, vault: or keychain: instead", "flag", name)
+	}
+
+	if err := applyProcessLimits(cfg.Process, logger); err != nil {
+		logger.Error("invalid process limits", "error", err)
+		return 2
+	}
+
+	if !cfg.DryRun && cfg.CollectorURL != "" {
+		if err := enrollIfNeeded(cfg.CollectorURL, cfg.EnrollToken, cfg.APIKeyFile, cfg.TLS, logger); err != nil {
+			logger.Error("enrollment failed", "error", err)
+			return 2
+		}
+		if err := agent.reporter.UseTLS(cfg.TLS); err != nil {
+			logger.Error("invalid TLS configuration", "error", err)
+			return 2
+		}
+	}
+
+	if err := agent.features.Configure(cfg.Features); err != nil {
+		logger.Error("invalid -features", "error", err)
+		return 2
+	}
+	if cfg.Policy != "" {
+		policy, err := LoadPolicy(cfg.Policy)
+		if err != nil {
+			logger.Error("invalid policy", "source", cfg.Policy, "error", err)
+			return 2
+		}
+		agent.checks, agent.scoring = policy.BuildChecks(), policy.ScoringModel()
+	}
+
+	if err := agent.setupIntegrity(); err != nil {
+		logger.Error("integrity self-check setup failed", "error", err)
+		return 2
+	}
+
+	if cfg.Notify {
+		quiet, err := ParseQuietHours(cfg.QuietHours)
+		if err != nil {
+			logger.Error("invalid notification settings", "error", err)
+			return 2
+		}
+		agent.notifier = NewNotifier(quiet, logger)
+	}
+
+	if cfg.TokenFile != "" || cfg.TrustRelay != "" {
+		if agent.trust, err = NewTrustBroker(cfg.TokenFile, cfg.Gateway, logger); err != nil {
+			logger.Error("invalid device trust settings", "error", err)
+			return 2
+		}
+	}
+	if cfg.Tray && !traySupported {
+		logger.Error("this agent was built without tray support; rebuild with -tags tray")
+		return 2
+	}
+
+	var relayLn net.Listener
+	if cfg.TrustRelay != "" {
+		if relayLn, err = net.Listen("tcp", cfg.TrustRelay); err != nil {
+			logger.Error("trust relay failed", "addr", cfg.TrustRelay, "error", err)
+			return 2
+		}
+	}
+
+	// Optional local endpoints (Prometheus metrics and the status page). The
+	// tray needs the status page, so it gets a loopback port if none is set.
+	listenAddr := cfg.MetricsListen
+	if listenAddr == "" && cfg.Tray {
+		listenAddr = "127.0.0.1:0"
+	}
+	var localLn net.Listener
+	var statusURL string
+	if listenAddr != "" {
+		if localLn, err = net.Listen("tcp", listenAddr); err != nil {
+			logger.Error("local listener failed", "addr", listenAddr, "error", err)
+			if relayLn != nil {
+				relayLn.Close()
+			}
+			return 2
+		}
+		statusURL = localURL(localLn.Addr())
+	}
+
+	run := lifecycle.New(lifecycle.Options{Stop: stop})
+	if cfg.FlagsURL != "" {
+		run.Go("feature flags", func(ctx context.Context) error {
+			agent.pollFlags(ctx, cfg.FlagsURL, flagsInterval)
+			return nil
+		})
+	}
+	if relayLn != nil {
+		logger.Info("trust relay listening", "pac_url", localURL(relayLn.Addr())+"proxy.pac", "gateway", cfg.Gateway)
+		relay := agent.trust.relayServer(relayLn.Addr())
+		run.Serve("trust relay", relay, func() error { return relay.Serve(relayLn) })
+	}
+	if localLn != nil {
+		local := agent.localServer()
+		run.Serve("local listener", local, func() error { return local.Serve(localLn) })
+	}
+
+	if cfg.Log.Pretty {
+		printBanner()
+		fmt.Printf("🚀 Device Posture Agent started\n")
+		fmt.Printf("   Collector URL: %s\n", cfg.CollectorURL)
+		fmt.Printf("   Report Interval: %v\n", cfg.Interval)
+		fmt.Printf("   Dry Run Mode: %v\n", cfg.DryRun)
+		if cfg.Policy != "" {
+			fmt.Printf("   Policy: %s (%d checks)\n", cfg.Policy, len(agent.checks))
+		}
+		if cfg.MetricsListen != "" {
+			fmt.Printf("   Metrics: http://%s/metrics\n", cfg.MetricsListen)
+		}
+		if statusURL != "" {
+			fmt.Printf("   Status page: %s\n", statusURL)
+		}
+		fmt.Printf("   Watchdog: restart loop after %v without progress\n", cfg.stallTimeout())
+		fmt.Printf("   Press Ctrl+C to stop\n")
+		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	} else {
+		logger.Info("agent started",
+			"collector_url", cfg.CollectorURL,
+			"interval", cfg.Interval,
+			"dry_run", cfg.DryRun,
+			"policy", cfg.Policy,
+			"metrics_listen", cfg.MetricsListen,
+			"status_url", statusURL,
+			"stall_timeout", cfg.stallTimeout(),
+		)
+	}
+
+	run.Go("report loop", func(ctx context.Context) error {
+		agent.supervisor.Run(ctx, agent.reportLoop)
+		return nil
+	})
+	if cfg.Tray {
+		agent.runTrayUntilStopped(run, statusURL)
+	}
+
+	<-run.Context().Done()
+	sig := run.Signal()
+	if cfg.Log.Pretty {
+		if sig != nil {
+			fmt.Printf("\n📪 Received signal: %v\n", sig)
+		}
+		fmt.Println("🛑 Shutting down gracefully...")
+	} else {
+		logger.Info("agent stopping", "signal", sig)
+	}
+	if err := run.Wait(); err != nil {
+		logger.Error("agent stopped with an error", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// setupIntegrity starts the tamper self-checks when a release manifest or
+// watched files are configured. A local policy file is always watched.
+func (a *Agent) setupIntegrity() error {
+	var watch []string
+	for _, path := range strings.Split(a.cfg.WatchFiles, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			watch = append(watch, path)
+		}
+	}
+	if a.cfg.Policy != "" && !isURL(a.cfg.Policy) {
+		watch = append(watch, a.cfg.Policy)
+	}
+	if a.cfg.Manifest == "" && len(watch) == 0 {
+		return nil
+	}
+
+	var manifest *ReleaseManifest
+	if a.cfg.Manifest != "" {
+		var err error
+		if manifest, err = LoadReleaseManifest(a.cfg.Manifest); err != nil {
+			return err
+		}
+	}
+	monitor, err := NewIntegrityMonitor(manifest, watch, a.log)
+	if err != nil {
+		return err
+	}
+	a.integrity = monitor
+	a.checks = append(a.checks, IntegrityCheck(monitor))
+	return nil
+}
+
+// pollFlags applies the policy engine's feature flags at rawURL now and
+// every interval after, until ctx is cancelled; until they are fetched,
+// -features holds
+func (a *Agent) pollFlags(ctx context.Context, rawURL string, interval time.Duration) {
+	client, _ := httpclient.New(httpclient.Options{Timeout: 10 * time.Second, UserAgent: "DevicePostureAgent/" + version})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := a.features.Fetch(ctx, client, rawURL); err != nil && ctx.Err() == nil {
+			a.log.Warn("feature flag update failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reportLoop runs one collection immediately and then on every tick, until done is closed
+func (a *Agent) reportLoop(done <-chan struct{}) {
+	// Create a ticker for periodic execution
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		a.collectAndReport()
+		a.supervisor.Heartbeat()
+
+		select {
+		case <-ticker.C:
+		case <-a.trigger:
+		case <-done:
+			return
+		}
+	}
+}
+
+// CollectNow asks the report loop for an immediate collection. Requests made
+// while one is already pending are merged.
+func (a *Agent) CollectNow() {
+	select {
+	case a.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// localURL turns a listener address into a browsable URL, using loopback
+// when the listener is bound to all interfaces
+func localURL(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || tcp.IP.IsUnspecified() {
+		_, port, _ := net.SplitHostPort(addr.String())
+		return "http://127.0.0.1:" + port + "/"
+	}
+	return "http://" + tcp.String() + "/"
+}
+
+// collectAndReport collects device status and sends it to the collector API.
+// An empty collector URL skips sending, for metrics-only deployments.
+func (a *Agent) collectAndReport() {
+	pretty := a.cfg.Log.Pretty
+	if pretty {
+		fmt.Printf("\n[%s] Collecting device status...\n", logTimestamp(time.Now()))
+	} else {
+		a.log.Debug("collecting device status")
+	}
+
+	// Collect device status; a panicking collector is recorded, not fatal
+	var status *DeviceStatus
+	var err error
+	if !a.supervisor.Protect("collector", func() { status, err = a.collector.CollectDeviceStatus() }) {
+		err = fmt.Errorf("collector panicked")
+	}
+	if err != nil {
+		a.log.Error("error collecting device status", "error", err)
+		a.metrics.ObserveCollectionError()
+		return
+	}
+	if a.integrity != nil {
+		a.integrity.Verify()
+	}
+	if a.inventory != nil {
+		a.supervisor.Protect("inventory", a.inventory.Update)
+	}
+	ApplyChecks(status, a.checks, a.scoring)
+	a.metrics.ObserveStatus(status)
+	a.board.Update(status)
+	if a.notifier != nil {
+		a.notifier.Observe(status)
+	}
+
+	// Print collected data
+	if pretty {
+		printDeviceStatus(status)
+	} else {
+		logDeviceStatus(a.log, status)
+	}
+	for _, result := range status.Checks {
+		if !result.Passed {
+			a.log.Warn("check failed", "check", result.Name, "severity", result.Severity, "message", result.Message)
+		}
+	}
+
+	// Attach crash reasons, tamper events, inventory changes and forwarded logs
+	// recorded since the last delivered report
+	status.Crashes = a.supervisor.PendingCrashes()
+	if a.integrity != nil {
+		status.Tamper = a.integrity.Pending()
+	}
+	if a.inventory != nil {
+		status.Changes = a.inventory.Pending()
+	}
+	if a.logs != nil {
+		status.Logs = a.logs.Pending()
+	}
+
+	// Send report (or print if dry-run)
+	if a.cfg.DryRun {
+		jsonData, _ := json.MarshalIndent(status, "", "  ")
+		if pretty {
+			fmt.Println("\n🔍 DRY RUN MODE - JSON Payload:")
+		}
+		fmt.Println(string(jsonData))
+	} else if a.reporter.collectorURL != "" {
+		err := a.reporter.SendReportWithRetry(status, maxRetries)
+		a.metrics.ObserveReport(err)
+		a.board.ObserveReport(err)
+		if err != nil {
+			a.log.Error("failed to send report", "error", err)
+		} else {
+			a.supervisor.AckCrashes(len(status.Crashes))
+			if a.integrity != nil {
+				a.integrity.Ack(len(status.Tamper))
+			}
+			if a.inventory != nil {
+				a.inventory.Ack(len(status.Changes))
+			}
+			if a.logs != nil {
+				a.logs.Ack(len(status.Logs))
+			}
+			if a.trust != nil {
+				a.trust.Refresh(a.reporter, status)
+			}
+		}
+	}
+
+	if pretty {
+		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	}
+}
+
+// logDeviceStatus emits the collected status as a single structured record
+func logDeviceStatus(logger *slog.Logger, status *DeviceStatus) {
+	attrs := []any{
+		"status", status.Status,
+		"score", status.Score,
+		"severity", status.Severity,
+		"failing_checks", status.FailingChecks,
+		"hostname", status.Hostname,
+		"ip", status.IP,
+		"disk_usage", status.DiskUsage,
+		"cpu_usage", status.CPUUsage,
+		"memory_usage", status.MemoryUsage,
+		"message", status.Message,
+	}
+
+	level := slog.LevelInfo
+	if status.Status != StatusHealthy {
+		level = slog.LevelWarn
+	}
+	logger.Log(context.Background(), level, "device status collected", attrs...)
+}
+
+// printDeviceStatus prints the device status in a formatted way
+func printDeviceStatus(status *DeviceStatus) {
+	statusIcon := "✓"
+	if status.Status != StatusHealthy {
+		statusIcon = "⚠"
+	}
+
+	fmt.Printf("  %s Status: %s (score %d/100, severity %s)\n", statusIcon, status.Status, status.Score, status.Severity)
+	fmt.Printf("  📍 Hostname: %s\n", status.Hostname)
+	fmt.Printf("  🌐 IP Address: %s\n", status.IP)
+	fmt.Printf("  💾 Disk Usage: %.2f%%\n", status.DiskUsage)
+	fmt.Printf("  🧠 CPU Usage: %.2f%%\n", status.CPUUsage)
+	fmt.Printf("  📊 Memory Usage: %.2f%%\n", status.MemoryUsage)
+	if status.Message != "" {
+		fmt.Printf("  💬 Message: %s\n", status.Message)
+	}
+	for _, result := range status.Checks {
+		checkIcon := "✓"
+		if !result.Passed {
+			checkIcon = "✗"
+		}
+		fmt.Printf("  %s Check %s\n", checkIcon, result.Name)
+		if result.Remediation != "" {
+			fmt.Printf("      → %s\n", result.Remediation)
+		}
+	}
+	for _, crash := range status.Crashes {
+		fmt.Printf("  💥 Crash in %s: %s\n", crash.Component, crash.Reason)
+	}
+}
+
+// printBanner prints a nice banner
+func printBanner() {
+	banner := `
+╔═══════════════════════════════════════════════════╗
+║     🛡️  DEVICE POSTURE AGENT v1.0 🛡️            ║
+║     Cisco Secure Client - Training Edition       ║
+╚═══════════════════════════════════════════════════╝
+`
+	fmt.Println(banner)
+}
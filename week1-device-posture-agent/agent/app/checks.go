@@ -0,0 +1,139 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nisatyap/shared/posture"
+)
+
+// Check is a single posture check evaluated against collected device data
+type Check struct {
+	Name        string
+	Description string
+	Weight      float64 // score points lost on a critical failure (half on a warning)
+	Remediation string  // what the user can do about a failure
+	Evaluate    func(status *DeviceStatus) CheckResult
+}
+
+// CheckResult is the outcome of one check, included in every report
+type CheckResult = posture.CheckResult
+
+// Check failure severities
+const (
+	SeverityWarning  = posture.SeverityWarning
+	SeverityCritical = posture.SeverityCritical
+)
+
+// DefaultChecks returns the built-in posture checks in evaluation order
+func DefaultChecks() []Check {
+	return []Check{
+		ThresholdCheck("disk_usage", posture.CheckLabels["disk_usage"], diskUsageMetric, 50, 0, DiskThreshold),
+		ThresholdCheck("memory_usage", posture.CheckLabels["memory_usage"], memoryUsageMetric, 30, 90, 98),
+		ThresholdCheck("cpu_usage", posture.CheckLabels["cpu_usage"], cpuUsageMetric, 20, 90, 0),
+	}
+}
+
+// metricFuncs maps check names usable in policies to the value they inspect
+var metricFuncs = map[string]func(*DeviceStatus) float64{
+	"disk_usage":   diskUsageMetric,
+	"cpu_usage":    cpuUsageMetric,
+	"memory_usage": memoryUsageMetric,
+}
+
+func diskUsageMetric(s *DeviceStatus) float64   { return s.DiskUsage }
+func cpuUsageMetric(s *DeviceStatus) float64    { return s.CPUUsage }
+func memoryUsageMetric(s *DeviceStatus) float64 { return s.MemoryUsage }
+
+// ThresholdCheck fails with a warning above warn and critically above
+// critical. A zero threshold disables that level.
+func ThresholdCheck(name, label string, metric func(*DeviceStatus) float64, weight, warn, critical float64) Check {
+	var description string
+	switch {
+	case warn > 0 && critical > 0:
+		description = fmt.Sprintf("%s should stay below %.0f%% and must not exceed %.0f%%", label, warn, critical)
+	case warn > 0:
+		description = fmt.Sprintf("%s should stay below %.0f%%", label, warn)
+	default:
+		description = fmt.Sprintf("%s must not exceed %.0f%%", label, critical)
+	}
+
+	return Check{
+		Name:        name,
+		Description: description,
+		Weight:      weight,
+		Remediation: checkRemediations[name],
+		Evaluate: func(status *DeviceStatus) CheckResult {
+			return posture.Threshold(name, label, metric(status), warn, critical)
+		},
+	}
+}
+
+// RuleCheck fails with severity whenever the expression evaluates to true.
+// An expression that can't be evaluated (e.g. the firewall state is unknown)
+// is reported as a warning.
+func RuleCheck(name, source string, expr posture.Expr, severity string, weight float64, message string) Check {
+	return Check{
+		Name:        name,
+		Description: "fails when " + source,
+		Weight:      weight,
+		Evaluate: func(status *DeviceStatus) CheckResult {
+			return posture.Rule(name, source, expr, ruleEnv(status), severity, message)
+		},
+	}
+}
+
+// RunChecks evaluates every check against the status. A panicking check is
+// reported as a warning rather than taking down the whole collection.
+func RunChecks(checks []Check, status *DeviceStatus) []CheckResult {
+	results := make([]CheckResult, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, evaluateCheck(check, status))
+	}
+	return results
+}
+
+func evaluateCheck(check Check, status *DeviceStatus) (result CheckResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = CheckResult{
+				Name:     check.Name,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("check panicked: %v", r),
+			}
+		}
+	}()
+	result = check.Evaluate(status)
+	if !result.Passed && result.Remediation == "" {
+		result.Remediation = check.Remediation
+	}
+	return result
+}
+
+// ApplyChecks runs the checks, scores the results with model and fills in
+// the status, score, severity and failing checks on status.
+func ApplyChecks(status *DeviceStatus, checks []Check, model ScoringModel) {
+	weights := make(map[string]float64, len(checks))
+	for _, check := range checks {
+		weights[check.Name] = check.Weight
+	}
+	status.Checks = RunChecks(checks, status)
+	status.Score, status.FailingChecks = model.Score(weights, status.Checks)
+	status.Status = model.Status(status.Score)
+	status.Severity = model.Severity(status.Score)
+	status.Message = "All systems operational"
+
+	// Surface the most serious failure as the headline message
+	for _, result := range status.Checks {
+		if result.Passed {
+			continue
+		}
+		if result.Severity == SeverityCritical {
+			status.Message = "Critical: " + result.Message
+			return
+		}
+		if !strings.HasPrefix(status.Message, "Warning: ") {
+			status.Message = "Warning: " + result.Message
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cpuSampleWindow is how long Linux CPU sampling waits between /proc/stat reads
+const cpuSampleWindow = 500 * time.Millisecond
+
+// ResourceLimits bounds how much work a single collection may do
+type ResourceLimits struct {
+	CollectConcurrency int           // metric collectors running at once
+	CheckTimeout       time.Duration // deadline for each collector; its command is killed on expiry
+}
+
+// DefaultResourceLimits keeps collection light enough to go unnoticed on a laptop
+func DefaultResourceLimits() ResourceLimits {
+	return ResourceLimits{CollectConcurrency: 2, CheckTimeout: 10 * time.Second}
+}
+
+// SystemCollector handles collection of system information
+type SystemCollector struct {
+	limits ResourceLimits
+	log    *slog.Logger
+}
+
+// NewSystemCollector creates a new SystemCollector instance
+func NewSystemCollector(limits ResourceLimits, logger *slog.Logger) *SystemCollector {
+	if limits.CollectConcurrency <= 0 {
+		limits.CollectConcurrency = 1
+	}
+	if limits.CheckTimeout <= 0 {
+		limits.CheckTimeout = DefaultResourceLimits().CheckTimeout
+	}
+	return &SystemCollector{limits: limits, log: logger}
+}
+
+// GetHostname retrieves the system hostname
+func (sc *SystemCollector) GetHostname() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get hostname: %w", err)
+	}
+	return hostname, nil
+}
+
+// GetLocalIP retrieves the local IP address (non-loopback)
+func (sc *SystemCollector) GetLocalIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to get network interfaces: %w", err)
+	}
+
+	for _, addr := range addrs {
+		// Check if it's an IP address (not a network interface)
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			// Get IPv4 address
+			if ipNet.IP.To4() != nil {
+				return ipNet.IP.String(), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no valid local IP address found")
+}
+
+// GetDiskUsage retrieves disk usage percentage based on OS
+func (sc *SystemCollector) GetDiskUsage(ctx context.Context) (float64, error) {
+	switch runtime.GOOS {
+	case "darwin", "linux":
+		return sc.getDiskUsageUnix(ctx)
+	case "windows":
+		return sc.getDiskUsageWindows(ctx)
+	default:
+		return 0, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
+// getDiskUsageUnix gets disk usage for Unix-like systems (macOS, Linux)
+func (sc *SystemCollector) getDiskUsageUnix(ctx context.Context) (float64, error) {
+	cmd := exec.CommandContext(ctx, "df", "-h", "/")
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute df command: %w", err)
+	}
+
+	lines := strings.Split(string(output), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected df output format")
+	}
+
+	// Parse the second line (actual disk info)
+	fields := strings.Fields(lines[1])
+	if len(fields) < 5 {
+		return 0, fmt.Errorf("unexpected df output fields")
+	}
+
+	// The 5th field is the usage percentage (e.g., "45%")
+	usageStr := strings.TrimSuffix(fields[4], "%")
+	usage, err := strconv.ParseFloat(usageStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse disk usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// getDiskUsageWindows reads the system drive's capacity with GetDiskFreeSpaceExW
+func (sc *SystemCollector) getDiskUsageWindows(ctx context.Context) (float64, error) {
+	drive := os.Getenv("SystemDrive")
+	if drive == "" {
+		drive = "C:"
+	}
+	total, free, err := windowsDiskSpace(drive + `\`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s disk space: %w", drive, err)
+	}
+	return usedPercent(total, free)
+}
+
+// usedPercent converts a capacity and the free part of it to a used percentage
+func usedPercent(total, free uint64) (float64, error) {
+	if total == 0 || free > total {
+		return 0, fmt.Errorf("invalid capacity: %d free of %d", free, total)
+	}
+	return float64(total-free) / float64(total) * 100, nil
+}
+
+// GetMemoryUsage retrieves physical memory usage percentage based on OS
+func (sc *SystemCollector) GetMemoryUsage(ctx context.Context) (float64, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return sc.getMemoryUsageLinux(ctx)
+	case "darwin":
+		return sc.getMemoryUsageDarwin(ctx)
+	case "windows":
+		return sc.getMemoryUsageWindows(ctx)
+	default:
+		return 0, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
+// getMemoryUsageLinux reads MemTotal and MemAvailable from /proc/meminfo
+func (sc *SystemCollector) getMemoryUsageLinux(ctx context.Context) (float64, error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read /proc/meminfo: %w", err)
+	}
+
+	var total, available float64
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value
+		case "MemAvailable:":
+			available = value
+		}
+	}
+
+	if total == 0 {
+		return 0, fmt.Errorf("unexpected /proc/meminfo format")
+	}
+	return (total - available) / total * 100, nil
+}
+
+// getMemoryUsageDarwin combines sysctl hw.memsize with vm_stat page counts
+func (sc *SystemCollector) getMemoryUsageDarwin(ctx context.Context) (float64, error) {
+	memsize, err := exec.CommandContext(ctx, "sysctl", "-n", "hw.memsize").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute sysctl command: %w", err)
+	}
+	total, err := strconv.ParseFloat(strings.TrimSpace(string(memsize)), 64)
+	if err != nil || total == 0 {
+		return 0, fmt.Errorf("failed to parse hw.memsize: %v", err)
+	}
+
+	output, err := exec.CommandContext(ctx, "vm_stat").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute vm_stat command: %w", err)
+	}
+
+	// First line looks like "Mach Virtual Memory Statistics: (page size of 16384 bytes)"
+	pageSize := 4096.0
+	lines := strings.Split(string(output), "\n")
+	if idx := strings.Index(lines[0], "page size of "); idx >= 0 {
+		fields := strings.Fields(lines[0][idx+len("page size of "):])
+		if len(fields) > 0 {
+			if size, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				pageSize = size
+			}
+		}
+	}
+
+	var freePages float64
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "Pages free", "Pages inactive", "Pages speculative":
+			value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(parts[1]), "."), 64)
+			if err == nil {
+				freePages += value
+			}
+		}
+	}
+
+	used := total - freePages*pageSize
+	return used / total * 100, nil
+}
+
+// getMemoryUsageWindows reads physical memory with GlobalMemoryStatusEx
+func (sc *SystemCollector) getMemoryUsageWindows(ctx context.Context) (float64, error) {
+	total, available, err := windowsMemoryStatus()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query memory status: %w", err)
+	}
+	return usedPercent(total, available)
+}
+
+// GetCPUUsage retrieves overall CPU utilization percentage based on OS
+func (sc *SystemCollector) GetCPUUsage(ctx context.Context) (float64, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return sc.getCPUUsageLinux(ctx)
+	case "darwin":
+		return sc.getCPUUsageDarwin(ctx)
+	case "windows":
+		return sc.getCPUUsageWindows(ctx)
+	default:
+		return 0, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
+// getCPUUsageLinux samples the aggregate "cpu" line of /proc/stat twice
+func (sc *SystemCollector) getCPUUsageLinux(ctx context.Context) (float64, error) {
+	readStat := func() (idle, total float64, err error) {
+		data, err := os.ReadFile("/proc/stat")
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read /proc/stat: %w", err)
+		}
+		fields := strings.Fields(strings.SplitN(string(data), "\n", 2)[0])
+		if len(fields) < 5 || fields[0] != "cpu" {
+			return 0, 0, fmt.Errorf("unexpected /proc/stat format")
+		}
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to parse /proc/stat: %w", err)
+			}
+			total += value
+			// idle and iowait are the 4th and 5th columns
+			if i == 3 || i == 4 {
+				idle += value
+			}
+		}
+		return idle, total, nil
+	}
+
+	idle1, total1, err := readStat()
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case <-time.After(cpuSampleWindow):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	idle2, total2, err := readStat()
+	if err != nil {
+		return 0, err
+	}
+
+	delta := total2 - total1
+	if delta <= 0 {
+		return 0, nil
+	}
+	return (delta - (idle2 - idle1)) / delta * 100, nil
+}
+
+// getCPUUsageDarwin parses the "CPU usage" summary line from top
+func (sc *SystemCollector) getCPUUsageDarwin(ctx context.Context) (float64, error) {
+	output, err := exec.CommandContext(ctx, "top", "-l", "1", "-n", "0").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute top command: %w", err)
+	}
+
+	// e.g. "CPU usage: 5.12% user, 8.33% sys, 86.54% idle"
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.HasPrefix(line, "CPU usage:") {
+			continue
+		}
+		for _, part := range strings.Split(strings.TrimPrefix(line, "CPU usage:"), ",") {
+			fields := strings.Fields(part)
+			if len(fields) == 2 && fields[1] == "idle" {
+				idle, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+				if err != nil {
+					return 0, fmt.Errorf("failed to parse CPU usage: %w", err)
+				}
+				return 100 - idle, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("unexpected top output format")
+}
+
+// getCPUUsageWindows samples GetSystemTimes twice, like /proc/stat on Linux
+func (sc *SystemCollector) getCPUUsageWindows(ctx context.Context) (float64, error) {
+	before, err := windowsSystemTimes()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query system times: %w", err)
+	}
+	select {
+	case <-time.After(cpuSampleWindow):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	after, err := windowsSystemTimes()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query system times: %w", err)
+	}
+	return before.busyPercent(after), nil
+}
+
+// cpuTimes are the cumulative system times from GetSystemTimes, in 100ns
+// units. Kernel time includes idle time.
+type cpuTimes struct {
+	idle, kernel, user uint64
+}
+
+// busyPercent is the share of non-idle time between two samples
+func (t cpuTimes) busyPercent(next cpuTimes) float64 {
+	total := (next.kernel - t.kernel) + (next.user - t.user)
+	idle := next.idle - t.idle
+	if total == 0 || idle > total {
+		return 0
+	}
+	return float64(total-idle) / float64(total) * 100
+}
+
+// GetOSInfo identifies the OS release. A missing version is not an error;
+// rules referencing os.version will simply fail to evaluate.
+func (sc *SystemCollector) GetOSInfo(ctx context.Context) OSInfo {
+	info := OSInfo{Name: runtime.GOOS, Arch: runtime.GOARCH}
+
+	switch runtime.GOOS {
+	case "linux":
+		if data, err := os.ReadFile("/etc/os-release"); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if value, ok := strings.CutPrefix(line, "VERSION_ID="); ok {
+					info.Version = strings.Trim(value, `"'`)
+				}
+			}
+		}
+	case "darwin":
+		if output, err := exec.CommandContext(ctx, "sw_vers", "-productVersion").Output(); err == nil {
+			info.Version = strings.TrimSpace(string(output))
+		}
+	case "windows":
+		info.Version = windowsVersion()
+	}
+	return info
+}
+
+// GetFirewallEnabled reports whether the host firewall is active
+func (sc *SystemCollector) GetFirewallEnabled(ctx context.Context) (bool, error) {
+	switch runtime.GOOS {
+	case "linux":
+		// ufw first, then firewalld
+		if output, err := exec.CommandContext(ctx, "ufw", "status").Output(); err == nil {
+			return strings.Contains(string(output), "Status: active"), nil
+		}
+		output, err := exec.CommandContext(ctx, "firewall-cmd", "--state").Output()
+		if err != nil {
+			return false, fmt.Errorf("no supported firewall tool (ufw, firewall-cmd) found: %w", err)
+		}
+		return strings.TrimSpace(string(output)) == "running", nil
+	case "darwin":
+		output, err := exec.CommandContext(ctx, "/usr/libexec/ApplicationFirewall/socketfilterfw", "--getglobalstate").Output()
+		if err != nil {
+			return false, fmt.Errorf("failed to query application firewall: %w", err)
+		}
+		return strings.Contains(string(output), "enabled"), nil
+	case "windows":
+		return windowsFirewallEnabled()
+	default:
+		return false, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
+// collectTask is one metric collector and where to store its result
+type collectTask struct {
+	name  string
+	fn    func(ctx context.Context) (float64, error)
+	value *float64
+	err   *error
+}
+
+// runLimited runs tasks with at most CollectConcurrency in flight, each under
+// its own CheckTimeout deadline
+func (sc *SystemCollector) runLimited(tasks []collectTask) {
+	sem := make(chan struct{}, sc.limits.CollectConcurrency)
+	var wg sync.WaitGroup
+
+	for _, task := range tasks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(task collectTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), sc.limits.CheckTimeout)
+			defer cancel()
+
+			*task.value, *task.err = task.fn(ctx)
+			if ctx.Err() == context.DeadlineExceeded {
+				*task.err = fmt.Errorf("%s collection timed out after %v", task.name, sc.limits.CheckTimeout)
+			}
+		}(task)
+	}
+	wg.Wait()
+}
+
+// CollectDeviceStatus collects all system information and determines health status
+func (sc *SystemCollector) CollectDeviceStatus() (*DeviceStatus, error) {
+	hostname, err := sc.GetHostname()
+	if err != nil {
+		return nil, err
+	}
+
+	ip, err := sc.GetLocalIP()
+	if err != nil {
+		return nil, err
+	}
+
+	// Metric collectors run concurrently, bounded by the resource limits
+	var diskUsage, cpuUsage, memoryUsage float64
+	var diskErr, cpuErr, memoryErr error
+	sc.runLimited([]collectTask{
+		{name: "disk_usage", fn: sc.GetDiskUsage, value: &diskUsage, err: &diskErr},
+		{name: "cpu_usage", fn: sc.GetCPUUsage, value: &cpuUsage, err: &cpuErr},
+		{name: "memory_usage", fn: sc.GetMemoryUsage, value: &memoryUsage, err: &memoryErr},
+	})
+
+	if diskErr != nil {
+		return nil, diskErr
+	}
+
+	// CPU and memory are informational; a failure here shouldn't drop the report
+	if cpuErr != nil {
+		sc.log.Warn("could not collect CPU usage", "error", cpuErr)
+	}
+	if memoryErr != nil {
+		sc.log.Warn("could not collect memory usage", "error", memoryErr)
+	}
+
+	status := &DeviceStatus{
+		Hostname:    hostname,
+		IP:          ip,
+		DiskUsage:   diskUsage,
+		CPUUsage:    cpuUsage,
+		MemoryUsage: memoryUsage,
+		Timestamp:   time.Now(),
+	}
+
+	// OS and firewall facts feed policy rules; they never fail the collection
+	ctx, cancel := context.WithTimeout(context.Background(), sc.limits.CheckTimeout)
+	defer cancel()
+	status.OS = sc.GetOSInfo(ctx)
+	if enabled, err := sc.GetFirewallEnabled(ctx); err != nil {
+		sc.log.Debug("could not determine firewall state", "error", err)
+	} else {
+		status.Firewall = &enabled
+	}
+
+	// Determine health status from the posture checks
+	ApplyChecks(status, DefaultChecks(), DefaultScoringModel())
+
+	return status, nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package app
+
+import "errors"
+
+// The Win32 collectors are only reachable when runtime.GOOS is "windows"
+var errWindowsOnly = errors.New("only available on Windows")
+
+func windowsDiskSpace(root string) (total, free uint64, err error) { return 0, 0, errWindowsOnly }
+
+func windowsMemoryStatus() (total, available uint64, err error) { return 0, 0, errWindowsOnly }
+
+func windowsSystemTimes() (cpuTimes, error) { return cpuTimes{}, errWindowsOnly }
+
+func windowsVersion() string { return "" }
+
+func windowsFirewallEnabled() (bool, error) { return false, errWindowsOnly }
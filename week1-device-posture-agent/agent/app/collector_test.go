@@ -0,0 +1,31 @@
+package app
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUsedPercent(t *testing.T) {
+	got, err := usedPercent(500, 125)
+	if err != nil || got != 75 {
+		t.Errorf("usedPercent(500, 125) = %v, %v; want 75", got, err)
+	}
+	for _, tt := range [][2]uint64{{0, 0}, {100, 200}} {
+		if _, err := usedPercent(tt[0], tt[1]); err == nil {
+			t.Errorf("usedPercent(%d, %d) expected error", tt[0], tt[1])
+		}
+	}
+}
+
+func TestCPUTimesBusyPercent(t *testing.T) {
+	before := cpuTimes{idle: 1000, kernel: 3000, user: 1000}
+
+	// 400 ticks elapsed: kernel +300 (of which idle +100), user +100 -> 75% busy
+	after := cpuTimes{idle: 1100, kernel: 3300, user: 1100}
+	if got := before.busyPercent(after); math.Abs(got-75) > 1e-9 {
+		t.Errorf("busyPercent() = %v; want 75", got)
+	}
+	if got := before.busyPercent(before); got != 0 {
+		t.Errorf("busyPercent() with no elapsed time = %v; want 0", got)
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// kernel32 calls that golang.org/x/sys/windows doesn't wrap
+var (
+	modkernel32              = windows.NewLazySystemDLL("kernel32.dll")
+	procGlobalMemoryStatusEx = modkernel32.NewProc("GlobalMemoryStatusEx")
+	procGetSystemTimes       = modkernel32.NewProc("GetSystemTimes")
+)
+
+// windowsDiskSpace returns the total and free bytes of the volume at root
+func windowsDiskSpace(root string) (total, free uint64, err error) {
+	path, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return 0, 0, err
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, &total, &free); err != nil {
+		return 0, 0, err
+	}
+	return total, free, nil
+}
+
+// memoryStatusEx mirrors MEMORYSTATUSEX
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+// windowsMemoryStatus returns total and available physical memory in bytes
+func windowsMemoryStatus() (total, available uint64, err error) {
+	status := memoryStatusEx{}
+	status.length = uint32(unsafe.Sizeof(status))
+	if r, _, callErr := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); r == 0 {
+		return 0, 0, callErr
+	}
+	return status.totalPhys, status.availPhys, nil
+}
+
+// windowsSystemTimes returns the cumulative idle, kernel and user times
+func windowsSystemTimes() (cpuTimes, error) {
+	var idle, kernel, user windows.Filetime
+	r, _, err := procGetSystemTimes.Call(
+		uintptr(unsafe.Pointer(&idle)),
+		uintptr(unsafe.Pointer(&kernel)),
+		uintptr(unsafe.Pointer(&user)),
+	)
+	if r == 0 {
+		return cpuTimes{}, err
+	}
+	ticks := func(ft windows.Filetime) uint64 {
+		return uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime)
+	}
+	return cpuTimes{idle: ticks(idle), kernel: ticks(kernel), user: ticks(user)}, nil
+}
+
+// windowsVersion returns "major.minor.build", e.g. "10.0.22631"
+func windowsVersion() string {
+	info := windows.RtlGetVersion()
+	return fmt.Sprintf("%d.%d.%d", info.MajorVersion, info.MinorVersion, info.BuildNumber)
+}
+
+// firewallProfiles pairs the group policy and local registry key for each
+// firewall profile; a policy setting overrides the local one
+var firewallProfiles = []struct{ policy, local string }{
+	{`SOFTWARE\Policies\Microsoft\WindowsFirewall\DomainProfile`, `SYSTEM\CurrentControlSet\Services\SharedAccess\Parameters\FirewallPolicy\DomainProfile`},
+	{`SOFTWARE\Policies\Microsoft\WindowsFirewall\PrivateProfile`, `SYSTEM\CurrentControlSet\Services\SharedAccess\Parameters\FirewallPolicy\StandardProfile`},
+	{`SOFTWARE\Policies\Microsoft\WindowsFirewall\PublicProfile`, `SYSTEM\CurrentControlSet\Services\SharedAccess\Parameters\FirewallPolicy\PublicProfile`},
+}
+
+// windowsFirewallEnabled reports whether every firewall profile is on
+func windowsFirewallEnabled() (bool, error) {
+	for _, profile := range firewallProfiles {
+		enabled, ok := readDWORD(profile.policy, "EnableFirewall")
+		if !ok {
+			if enabled, ok = readDWORD(profile.local, "EnableFirewall"); !ok {
+				return false, fmt.Errorf("firewall state not found under %s", profile.local)
+			}
+		}
+		if enabled == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func readDWORD(path, name string) (uint64, bool) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return 0, false
+	}
+	defer key.Close()
+	value, _, err := key.GetIntegerValue(name)
+	return value, err == nil
+}
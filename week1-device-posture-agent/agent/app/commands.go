@@ -0,0 +1,586 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nisatyap/shared/config"
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/secrets"
+)
+
+// version is the agent release; override at build time with
+// -ldflags "-X device-posture-agent/app.version=1.2.3"
+var version = "1.0.0"
+
+// Command is a node in the agent's CLI tree. Leaf commands implement Run
+// and get a flag set of their own, which SetFlags fills in; group commands
+// (like "checks") only hold Subcommands. Execute parses the flags and
+// writes the help of both.
+type Command struct {
+	Name    string
+	Summary string
+	Usage   string // what follows the command in its usage line, e.g. "[flags]"
+	// SetFlags registers a leaf command's flags; nil for one without any
+	SetFlags func(fs *flag.FlagSet)
+	// Parse parses args with the command's flag set; nil uses fs.Parse
+	Parse func(fs *flag.FlagSet, args []string) error
+	// UsageExit is the exit code for flags that don't parse; 2 if zero
+	UsageExit int
+	// Run runs a leaf command once its flags are parsed, with fs.Args()
+	// holding the arguments after them
+	Run         func(fs *flag.FlagSet) int
+	Subcommands []*Command
+	// Output receives help and usage errors, os.Stderr if nil. It is set
+	// on the root command and used by the whole tree.
+	Output io.Writer
+}
+
+// Execute dispatches args to the matching subcommand, or parses them and
+// runs the command itself, and returns the exit code. "-h", "--help" and
+// "help [command...]" print the help of a command.
+func (c *Command) Execute(path string, args []string) int {
+	out := c.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	return c.execute(path, args, out)
+}
+
+func (c *Command) execute(path string, args []string, out io.Writer) int {
+	if len(c.Subcommands) == 0 {
+		fs := c.flagSet(path, out)
+		parse := c.Parse
+		if parse == nil {
+			parse = (*flag.FlagSet).Parse
+		}
+		if err := parse(fs, args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			if c.UsageExit != 0 {
+				return c.UsageExit
+			}
+			return 2
+		}
+		return c.Run(fs)
+	}
+
+	switch {
+	case len(args) == 0 || args[0] == "-h" || args[0] == "--help":
+		c.printUsage(path, out)
+		return 0
+	case args[0] == "help":
+		// "help checks list" is "checks list -h"
+		return c.execute(path, append(append([]string{}, args[1:]...), "-h"), out)
+	}
+
+	for _, sub := range c.Subcommands {
+		if sub.Name == args[0] {
+			return sub.execute(path+" "+sub.Name, args[1:], out)
+		}
+	}
+
+	fmt.Fprintf(out, "unknown command %q for %q\n\n", args[0], path)
+	c.printUsage(path, out)
+	return 2
+}
+
+// printUsage lists the available subcommands
+func (c *Command) printUsage(path string, out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s <command> [flags]\n\n", path)
+	if c.Summary != "" {
+		fmt.Fprintf(out, "%s\n\n", c.Summary)
+	}
+	fmt.Fprintln(out, "Commands:")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, sub := range c.Subcommands {
+		fmt.Fprintf(tw, "  %s\t%s\n", sub.Name, sub.Summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "\nRun '%s <command> -h' or '%s help <command>' for command flags.\n", path, path)
+}
+
+// flagSet returns a leaf command's flag set, with its flags registered and
+// usage output that includes the command summary
+func (c *Command) flagSet(path string, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(out)
+	if c.SetFlags != nil {
+		c.SetFlags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\n%s\n", strings.TrimSpace(path+" "+c.Usage), c.Summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(fs.Output(), "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// addLogFlags registers the logging options shared by long-running commands
+func addLogFlags(fs *flag.FlagSet, cfg *LogConfig) {
+	fs.StringVar(&cfg.Level, "log-level", "info", "Log level: debug, info, warn, error")
+	fs.StringVar(&cfg.Format, "log-format", "text", "Structured log format: text or json")
+	fs.StringVar(&cfg.File, "log-file", "", "Write logs to this file instead of stderr (rotated by size)")
+	fs.IntVar(&cfg.MaxSizeMB, "log-max-size", 10, "Rotate the log file after this many megabytes")
+	fs.IntVar(&cfg.MaxBackups, "log-max-backups", 5, "Number of rotated log files to keep")
+	fs.BoolVar(&cfg.Pretty, "pretty", false, "Human-friendly console output (default when stdout is a terminal)")
+	fs.BoolVar(&cfg.Forward, "forward-logs", false, "Upload recent agent logs to the collector alongside reports")
+	fs.StringVar(&cfg.ForwardLevel, "forward-log-level", "warn", "Minimum level of logs to forward")
+	fs.IntVar(&cfg.ForwardMax, "forward-log-max", 200, "Maximum log entries buffered between reports")
+}
+
+// addLimitFlags registers the agent's self-imposed resource caps
+func addLimitFlags(fs *flag.FlagSet, cfg *runConfig) {
+	defaults := DefaultResourceLimits()
+	fs.IntVar(&cfg.Process.MaxProcs, "max-procs", 1, "GOMAXPROCS for the agent (0 = all CPUs)")
+	fs.StringVar(&cfg.Process.MemLimit, "mem-limit", "64MiB", "Soft memory limit for the agent, e.g. 64MiB (empty = unlimited)")
+	fs.IntVar(&cfg.Limits.CollectConcurrency, "collect-concurrency", defaults.CollectConcurrency, "Maximum collectors running at once")
+	fs.DurationVar(&cfg.Limits.CheckTimeout, "check-timeout", defaults.CheckTimeout, "Deadline for each collector; slow commands are killed")
+}
+
+// addRunFlags registers the flags of "agent run", which "install-service"
+// takes as well and passes on to the service
+func addRunFlags(fs *flag.FlagSet, cfg *runConfig) {
+	fs.StringVar(&cfg.CollectorURL, "url", defaultCollectorURL, "Collector API URL (empty disables reporting)")
+	fs.StringVar(&cfg.APIKeyFile, "api-key-file", "", "File holding the device API key (default $POSTURE_API_KEY)")
+	fs.DurationVar(&cfg.Interval, "interval", defaultInterval, "Report interval (e.g., 10s, 1m)")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "Collect data but don't send to API (print to console)")
+	fs.StringVar(&cfg.MetricsListen, "metrics-listen", "", "Expose Prometheus metrics on this address (e.g., :9100); empty disables")
+	fs.DurationVar(&cfg.StallTimeout, "stall-timeout", 0, "Restart the report loop after this long without progress (default: 3x interval + 1m)")
+	fs.StringVar(&cfg.Policy, "policy", "", "Policy file path or http(s) URL with checks and rules (default: built-in checks)")
+	fs.BoolVar(&cfg.Notify, "notify", false, "Show a desktop notification when the device becomes UNHEALTHY")
+	fs.StringVar(&cfg.QuietHours, "quiet-hours", "", "Hold notifications during this local time window (e.g., 22:00-07:00)")
+	fs.StringVar(&cfg.Manifest, "manifest", "", "Release manifest (file or URL) to verify the agent binary's SHA-256 against")
+	fs.StringVar(&cfg.WatchFiles, "watch-files", "", "Comma-separated config files to report as tampered if they change")
+	fs.DurationVar(&cfg.Inventory, "inventory-interval", defaultInventoryInterval, "How often to report software, listening port and USB changes (0 disables)")
+	fs.StringVar(&cfg.InventoryFile, "inventory-state", "", "File that keeps the last inventory snapshot across restarts")
+	fs.BoolVar(&cfg.Tray, "tray", false, "Show a system tray icon with posture status (needs a build with -tags tray)")
+	fs.StringVar(&cfg.TokenFile, "posture-token-file", "", "Keep a collector-signed posture token in this file for software that presents it to the gateway")
+	fs.StringVar(&cfg.TrustRelay, "trust-relay", "", "Relay browser traffic to -gateway with the posture token added, on this address (e.g., 127.0.0.1:3128); serves /proxy.pac")
+	fs.StringVar(&cfg.Gateway, "gateway", "", "Secure web gateway the trust relay forwards to (e.g., http://gateway:8080)")
+	fs.StringVar(&cfg.Features, "features", "", "Feature flags, e.g. delta-reports=on or delta-reports=25%; the policy engine's values win (flags: delta-reports)")
+	fs.StringVar(&cfg.FlagsURL, "flags-url", "", "Policy engine's flags endpoint to poll for feature flags (e.g., http://policy:8000/flags); empty uses -features alone")
+	cfg.TLS.addFlags(fs)
+	addLogFlags(fs, &cfg.Log)
+	addLimitFlags(fs, cfg)
+}
+
+// validate rejects run settings that don't fit together
+func (cfg *runConfig) validate() error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("-interval must be positive, not %v", cfg.Interval)
+	}
+	if cfg.Inventory < 0 {
+		return fmt.Errorf("-inventory-interval must not be negative")
+	}
+	if cfg.TrustRelay != "" && cfg.Gateway == "" {
+		return fmt.Errorf("-trust-relay needs -gateway")
+	}
+	if (cfg.TokenFile != "" || cfg.TrustRelay != "") && (cfg.DryRun || cfg.CollectorURL == "") {
+		return fmt.Errorf("posture tokens come from the collector; they need -url and no -dry-run")
+	}
+	if err := flags.New("", agentFlags...).Configure(cfg.Features); err != nil {
+		return fmt.Errorf("-features: %w", err)
+	}
+	if cfg.FlagsURL != "" {
+		if u, err := url.Parse(cfg.FlagsURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("-flags-url must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// resolvePretty enables pretty output for interactive runs unless the user
+// chose explicitly or is logging to a file
+func resolvePretty(fs *flag.FlagSet, cfg *LogConfig) {
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "pretty" {
+			explicit = true
+		}
+	})
+	if !explicit {
+		cfg.Pretty = cfg.File == "" && isTerminal(os.Stdout)
+	}
+}
+
+// rootCommand builds the full agent command tree for the agent invoked as
+// path
+func rootCommand(path string) *Command {
+	var runCfg runConfig
+	var runSettings *config.Settings
+	run := &Command{
+		Name:    "run",
+		Summary: "Run the agent continuously (default)",
+		Usage:   "[flags]",
+		SetFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&runCfg.EnrollToken, "enrollment-token", "", "Enroll on first run with this one-time token, or a secret reference such as keychain:posture-agent/enrollment, saving the key to -api-key-file")
+			addRunFlags(fs, &runCfg)
+		},
+		// Settings also come from -config and POSTURE_* variables
+		Parse: func(fs *flag.FlagSet, args []string) error {
+			var err error
+			runSettings, err = config.Load(fs, args, config.Options{
+				EnvPrefix: "POSTURE",
+				Validate:  runCfg.validate,
+			})
+			return err
+		},
+	}
+	run.Run = func(fs *flag.FlagSet) int {
+		cfg := runCfg
+		if runSettings.Print {
+			runSettings.Dump(os.Stdout)
+			return 0
+		}
+		cfg.Plaintext = runSettings.Plaintext()
+		resolvePretty(fs, &cfg.Log)
+
+		// Under the Windows service manager, stop requests come from the SCM
+		if code, handled := runUnderServiceManager(cfg); handled {
+			return code
+		}
+
+		return runAgent(cfg, nil)
+	}
+
+	var collectJSON bool
+	collect := &Command{
+		Name:    "collect",
+		Summary: "Collect device status once and print it",
+		Usage:   "[flags]",
+		SetFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&collectJSON, "json", false, "Print the raw JSON payload instead of a summary")
+		},
+	}
+	collect.Run = func(*flag.FlagSet) int {
+		status, err := NewSystemCollector(DefaultResourceLimits(), consoleLogger()).CollectDeviceStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "collect: collecting device status: %v\n", err)
+			return 1
+		}
+
+		if collectJSON {
+			jsonData, _ := json.MarshalIndent(status, "", "  ")
+			fmt.Println(string(jsonData))
+			return 0
+		}
+		printDeviceStatus(status)
+		return 0
+	}
+
+	var report struct {
+		collectorURL, apiKeyFile string
+		tls                      ClientTLS
+	}
+	reportCmd := &Command{
+		Name:    "report",
+		Summary: "Collect device status once and send it to the collector",
+		Usage:   "[flags]",
+		SetFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&report.collectorURL, "url", defaultCollectorURL, "Collector API URL")
+			fs.StringVar(&report.apiKeyFile, "api-key-file", "", "File holding the device API key (default $POSTURE_API_KEY)")
+			report.tls.addFlags(fs)
+		},
+	}
+	reportCmd.Run = func(*flag.FlagSet) int {
+		reporter := NewReporter(report.collectorURL, report.apiKeyFile, consoleLogger())
+		if err := reporter.UseTLS(report.tls); err != nil {
+			fmt.Fprintf(os.Stderr, "report: %v\n", err)
+			return 2
+		}
+
+		status, err := NewSystemCollector(DefaultResourceLimits(), consoleLogger()).CollectDeviceStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "report: collecting device status: %v\n", err)
+			return 1
+		}
+		printDeviceStatus(status)
+
+		if err := reporter.SendReportWithRetry(status, maxRetries); err != nil {
+			fmt.Fprintf(os.Stderr, "report: sending report: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	var enrollment struct {
+		collectorURL, token, apiKeyFile, hostname string
+		tls                                       ClientTLS
+	}
+	enroll := &Command{
+		Name:    "enroll",
+		Summary: "Enroll this device with the collector and save its API key",
+		Usage:   "[flags]",
+		SetFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&enrollment.collectorURL, "url", defaultCollectorURL, "Collector API URL")
+			fs.StringVar(&enrollment.token, "token", os.Getenv("POSTURE_ENROLLMENT_TOKEN"), "One-time enrollment token from the collector admin, or a secret reference such as env:NAME (default $POSTURE_ENROLLMENT_TOKEN)")
+			fs.StringVar(&enrollment.apiKeyFile, "api-key-file", "", "File to save the device API key to (required)")
+			fs.StringVar(&enrollment.hostname, "hostname", "", "Hostname to enroll as (default: this machine's hostname)")
+			enrollment.tls.addFlags(fs)
+		},
+	}
+	enroll.Run = func(*flag.FlagSet) int {
+		if enrollment.token == "" || enrollment.apiKeyFile == "" {
+			fmt.Fprintln(os.Stderr, "enroll: -token and -api-key-file are required")
+			return 2
+		}
+		token, err := secrets.Resolve(context.Background(), enrollment.token)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "enroll: -token: %v\n", err)
+			return 1
+		}
+		hostname := enrollment.hostname
+		if hostname == "" {
+			name, err := NewSystemCollector(DefaultResourceLimits(), consoleLogger()).GetHostname()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "enroll: %v\n", err)
+				return 1
+			}
+			hostname = name
+		}
+
+		enrolled, err := Enroll(enrollment.collectorURL, token, hostname, enrollment.apiKeyFile, enrollment.tls)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "enroll: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Enrolled %s (tenant %s, key %s)\n", enrolled.Hostname, enrolled.Tenant, enrolled.KeyID)
+		keys := make([]string, 0, len(enrolled.Tags))
+		for k := range enrolled.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("   %s: %s\n", k, enrolled.Tags[k])
+		}
+		fmt.Printf("   API key saved to %s\n", enrollment.apiKeyFile)
+		return 0
+	}
+
+	var checkPolicy string
+	var checkJSON bool
+	check := &Command{
+		Name:    "check",
+		Summary: "Evaluate posture once and exit 0/1/2 for healthy/degraded/unhealthy",
+		Usage:   "[flags]",
+		SetFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&checkPolicy, "policy", "", "Policy file path or http(s) URL (default: built-in checks)")
+			fs.BoolVar(&checkJSON, "json", false, "Print the evaluated status as JSON")
+		},
+		// Keep usage errors distinct from the 1/2 posture results
+		UsageExit: exitCheckError,
+		Run:       func(*flag.FlagSet) int { return runCheck(checkPolicy, checkJSON) },
+	}
+
+	var install struct {
+		name, enrollToken string
+		cfg               runConfig
+	}
+	installService := &Command{
+		Name:    "install-service",
+		Summary: "Register the agent with the system service manager, passing it the \"run\" flags given",
+		Usage:   "[flags]",
+		SetFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&install.name, "name", defaultServiceName, "Service name")
+			fs.StringVar(&install.enrollToken, "enrollment-token", os.Getenv("POSTURE_ENROLLMENT_TOKEN"), "Enroll before installing with this one-time token, or a secret reference, saving the key to -api-key-file")
+			addRunFlags(fs, &install.cfg)
+		},
+	}
+	installService.Run = func(fs *flag.FlagSet) int {
+		cfg := install.cfg
+		if err := cfg.validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "install-service: %v\n", err)
+			return 2
+		}
+		token, err := secrets.Resolve(context.Background(), install.enrollToken)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "install-service: -enrollment-token: %v\n", err)
+			return 1
+		}
+		// Enrolling here keeps the token out of the service definition
+		if err := enrollIfNeeded(cfg.CollectorURL, token, cfg.APIKeyFile, cfg.TLS, consoleLogger()); err != nil {
+			fmt.Fprintf(os.Stderr, "install-service: %v\n", err)
+			return 1
+		}
+		svc, err := newServiceConfig(install.name, fs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "install-service: %v\n", err)
+			return 1
+		}
+		if err := installSystemService(svc); err != nil {
+			fmt.Fprintf(os.Stderr, "install-service: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Service %q installed and started\n", svc.Name)
+		return 0
+	}
+
+	var uninstallName string
+	uninstallService := &Command{
+		Name:    "uninstall-service",
+		Summary: "Stop and remove the agent system service",
+		Usage:   "[flags]",
+		SetFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&uninstallName, "name", defaultServiceName, "Service name")
+		},
+	}
+	uninstallService.Run = func(*flag.FlagSet) int {
+		if err := uninstallSystemService(uninstallName); err != nil {
+			fmt.Fprintf(os.Stderr, "uninstall-service: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Service %q removed\n", uninstallName)
+		return 0
+	}
+
+	checksList := &Command{Name: "list", Summary: "List the posture checks the agent evaluates"}
+	checksList.Run = func(*flag.FlagSet) int {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tWEIGHT\tDESCRIPTION")
+		for _, check := range DefaultChecks() {
+			fmt.Fprintf(tw, "%s\t%.0f\t%s\n", check.Name, check.Weight, check.Description)
+		}
+		tw.Flush()
+		return 0
+	}
+
+	checks := &Command{
+		Name:        "checks",
+		Summary:     "Inspect posture checks",
+		Subcommands: []*Command{checksList},
+	}
+
+	var manifestSource string
+	verify := &Command{
+		Name:    "verify",
+		Summary: "Print the agent binary's SHA-256 and check it against a release manifest",
+		Usage:   "[flags]",
+		SetFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&manifestSource, "manifest", "", "Release manifest file path or http(s) URL")
+		},
+		Run: func(*flag.FlagSet) int { return runVerify(manifestSource) },
+	}
+
+	versionCmd := &Command{Name: "version", Summary: "Print the agent version"}
+	versionCmd.Run = func(*flag.FlagSet) int {
+		fmt.Printf("device-posture-agent %s (%s, %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return 0
+	}
+
+	return &Command{
+		Name:        path,
+		Summary:     "Device Posture Agent - collects device health and reports it to the collector",
+		Subcommands: []*Command{run, collect, reportCmd, enroll, check, checks, installService, uninstallService, verify, versionCmd},
+	}
+}
+
+// Exit codes for "agent check", suitable for CI pipelines and login hooks
+const (
+	exitHealthy    = 0
+	exitDegraded   = 1
+	exitUnhealthy  = 2
+	exitCheckError = 3
+)
+
+// runCheck collects once, evaluates the policy and maps the result to an exit code
+func runCheck(policySource string, asJSON bool) int {
+	checks, model := DefaultChecks(), DefaultScoringModel()
+	if policySource != "" {
+		policy, err := LoadPolicy(policySource)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "check: %v\n", err)
+			return exitCheckError
+		}
+		checks, model = policy.BuildChecks(), policy.ScoringModel()
+	}
+
+	status, err := NewSystemCollector(DefaultResourceLimits(), consoleLogger()).CollectDeviceStatus()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check: collecting device status: %v\n", err)
+		return exitCheckError
+	}
+	ApplyChecks(status, checks, model)
+
+	if asJSON {
+		jsonData, _ := json.MarshalIndent(status, "", "  ")
+		fmt.Println(string(jsonData))
+	} else {
+		printDeviceStatus(status)
+	}
+	return checkExitCode(status.Status)
+}
+
+// checkExitCode maps a posture status to the exit code of "agent check"
+func checkExitCode(status string) int {
+	switch status {
+	case StatusHealthy:
+		return exitHealthy
+	case StatusDegraded:
+		return exitDegraded
+	default:
+		return exitUnhealthy
+	}
+}
+
+// runVerify hashes the running binary and, given a manifest, compares it
+func runVerify(manifestSource string) int {
+	path, err := executablePath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 1
+	}
+	hash, _, err := hashFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: hashing %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Printf("%s  %s (%s/%s)\n", hash, path, runtime.GOOS, runtime.GOARCH)
+	if manifestSource == "" {
+		return 0
+	}
+
+	manifest, err := LoadReleaseManifest(manifestSource)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 1
+	}
+	expected, err := manifest.ExpectedHash()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 1
+	}
+	if hash != expected {
+		fmt.Fprintf(os.Stderr, "verify: binary does not match release %s (expected %s)\n", manifest.Version, expected)
+		return 1
+	}
+	fmt.Printf("Binary matches release %s\n", manifest.Version)
+	return 0
+}
+
+// normalizeArgs keeps the pre-subcommand invocation style working:
+// "agent -dry-run" and a bare "agent" are treated as "agent run ...".
+func normalizeArgs(args []string) []string {
+	if len(args) == 0 {
+		return []string{"run"}
+	}
+	if strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		return append([]string{"run"}, args...)
+	}
+	return args
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCommands is a tree of commands that record what they ran with
+func testCommands(ran *string) *Command {
+	var verbose bool
+	leaf := func(name string) *Command {
+		return &Command{
+			Name:     name,
+			Summary:  "Run " + name,
+			Usage:    "[flags]",
+			SetFlags: func(fs *flag.FlagSet) { fs.BoolVar(&verbose, "v", false, "Be verbose") },
+			Run: func(fs *flag.FlagSet) int {
+				*ran = strings.TrimSpace(strings.Join(append([]string{name}, fs.Args()...), " "))
+				if verbose {
+					*ran += " verbose"
+				}
+				return 0
+			},
+		}
+	}
+	strict := leaf("strict")
+	strict.UsageExit = 3
+	bare := &Command{Name: "bare", Summary: "Take no flags", Run: func(*flag.FlagSet) int { *ran = "bare"; return 0 }}
+	return &Command{
+		Name:    "agent",
+		Summary: "Test agent",
+		Subcommands: []*Command{
+			leaf("one"), strict, bare,
+			{Name: "group", Summary: "A group", Subcommands: []*Command{leaf("inner")}},
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantCode int
+		wantRan  string
+		wantOut  []string // in the help or error output, in order
+	}{
+		{[]string{"one"}, 0, "one", nil},
+		{[]string{"one", "-v", "extra"}, 0, "one extra verbose", nil},
+		{[]string{"group", "inner", "-v"}, 0, "inner verbose", nil},
+
+		// Help for the tree, a group and a leaf, asked for every way
+		{nil, 0, "", []string{"Usage: agent <command> [flags]", "Test agent", "one", "Run one", "group", "A group", "help <command>"}},
+		{[]string{"-h"}, 0, "", []string{"Usage: agent <command> [flags]", "Commands:"}},
+		{[]string{"--help"}, 0, "", []string{"Usage: agent <command> [flags]"}},
+		{[]string{"help"}, 0, "", []string{"Usage: agent <command> [flags]"}},
+		{[]string{"group"}, 0, "", []string{"Usage: agent group <command> [flags]", "inner"}},
+		{[]string{"group", "-h"}, 0, "", []string{"Usage: agent group <command> [flags]"}},
+		{[]string{"one", "-h"}, 0, "", []string{"Usage: agent one [flags]", "Run one", "Flags:", "-v", "Be verbose"}},
+		{[]string{"one", "--help"}, 0, "", []string{"Usage: agent one [flags]"}},
+		{[]string{"help", "one"}, 0, "", []string{"Usage: agent one [flags]", "-v"}},
+		{[]string{"help", "group", "inner"}, 0, "", []string{"Usage: agent group inner [flags]", "Run inner"}},
+		{[]string{"group", "help", "inner"}, 0, "", []string{"Usage: agent group inner [flags]"}},
+		{[]string{"strict", "-h"}, 0, "", []string{"Usage: agent strict [flags]"}},
+
+		// Unknown commands and flags
+		{[]string{"bogus"}, 2, "", []string{`unknown command "bogus" for "agent"`, "Usage: agent <command> [flags]"}},
+		{[]string{"group", "bogus"}, 2, "", []string{`unknown command "bogus" for "agent group"`, "Usage: agent group <command> [flags]"}},
+		{[]string{"help", "bogus"}, 2, "", []string{`unknown command "bogus" for "agent"`}},
+		{[]string{"one", "-bogus"}, 2, "", []string{"flag provided but not defined: -bogus", "Usage: agent one [flags]"}},
+		{[]string{"strict", "-bogus"}, 3, "", []string{"flag provided but not defined: -bogus"}},
+	}
+	for _, tt := range tests {
+		var ran string
+		var out bytes.Buffer
+		root := testCommands(&ran)
+		root.Output = &out
+		code := root.Execute("agent", tt.args)
+		if code != tt.wantCode || ran != tt.wantRan {
+			t.Errorf("Execute(%q) = %d, ran %q; want %d, ran %q", tt.args, code, ran, tt.wantCode, tt.wantRan)
+		}
+		rest := out.String()
+		for _, want := range tt.wantOut {
+			i := strings.Index(rest, want)
+			if i < 0 {
+				t.Errorf("Execute(%q) output lacks %q after what came before:\n%s", tt.args, want, out.String())
+				break
+			}
+			rest = rest[i+len(want):]
+		}
+		if tt.wantOut == nil && out.Len() > 0 {
+			t.Errorf("Execute(%q) wrote %q", tt.args, out.String())
+		}
+	}
+}
+
+func TestExecuteHelpWithoutFlags(t *testing.T) {
+	var ran string
+	var out bytes.Buffer
+	root := testCommands(&ran)
+	root.Output = &out
+	if code := root.Execute("agent", []string{"bare", "-h"}); code != 0 {
+		t.Fatalf("bare -h = %d", code)
+	}
+	if got, want := out.String(), "Usage: agent bare\n\nTake no flags\n"; got != want {
+		t.Errorf("bare -h wrote %q, want %q", got, want)
+	}
+}
+
+func TestAgentCommandHelp(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		wantCode int
+		wantOut  []string
+	}{
+		{[]string{"-h"}, 0, []string{"run", "collect", "report", "enroll", "check", "checks", "install-service", "uninstall-service", "verify", "version"}},
+		{[]string{"frobnicate"}, 2, []string{`unknown command "frobnicate" for "agent"`}},
+		{[]string{"run", "-h"}, 0, []string{"Usage: agent run [flags]", "-api-key-file", "-config", "-interval", "-log-level", "-url"}},
+		{[]string{"help", "report"}, 0, []string{"Usage: agent report [flags]", "-url"}},
+		{[]string{"checks", "list", "-h"}, 0, []string{"Usage: agent checks list"}},
+		{[]string{"check", "-no-such-flag"}, exitCheckError, []string{"-no-such-flag"}},
+		{[]string{"enroll", "-no-such-flag"}, 2, []string{"-no-such-flag", "Usage: agent enroll [flags]"}},
+		{[]string{"run", "-interval", "0"}, 2, []string{"-interval must be positive"}},
+	} {
+		var out bytes.Buffer
+		root := rootCommand("agent")
+		root.Output = &out
+		if code := root.Execute("agent", normalizeArgs(tt.args)); code != tt.wantCode {
+			t.Errorf("agent %q = %d, want %d; output:\n%s", tt.args, code, tt.wantCode, out.String())
+		}
+		for _, want := range tt.wantOut {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("agent %q output lacks %q:\n%s", tt.args, want, out.String())
+			}
+		}
+	}
+}
+
+func TestNormalizeArgs(t *testing.T) {
+	tests := []struct {
+		args, want []string
+	}{
+		{nil, []string{"run"}},
+		{[]string{"-dry-run"}, []string{"run", "-dry-run"}},
+		{[]string{"-url", "http://collector:3000", "-interval", "1m"}, []string{"run", "-url", "http://collector:3000", "-interval", "1m"}},
+		{[]string{"-h"}, []string{"-h"}},
+		{[]string{"--help"}, []string{"--help"}},
+		{[]string{"collect", "-json"}, []string{"collect", "-json"}},
+		{[]string{"help", "run"}, []string{"help", "run"}},
+	}
+	for _, tt := range tests {
+		if got := normalizeArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCheckExitCode(t *testing.T) {
+	tests := []struct {
+		status string
+		want   int
+	}{
+		{StatusHealthy, exitHealthy},
+		{StatusDegraded, exitDegraded},
+		{StatusUnhealthy, exitUnhealthy},
+		{"", exitUnhealthy}, // an unknown status never passes
+	}
+	for _, tt := range tests {
+		if got := checkExitCode(tt.status); got != tt.want {
+			t.Errorf("checkExitCode(%q) = %d, want %d", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string // the policy's rules; none writes no policy file
+		want  int
+	}{
+		{"passing rule", `{"name": "never", "fail_if": "false"}`, exitHealthy},
+		{"light failing rule", `{"name": "never", "fail_if": "false", "weight": 70}, {"name": "always", "fail_if": "true", "weight": 30}`, exitDegraded},
+		{"heavy failing rule", `{"name": "always", "fail_if": "true", "weight": 100}`, exitUnhealthy},
+		{"invalid policy", `{"name": "bad", "fail_if": "no_such_fact"}`, exitCheckError},
+		{"missing policy", "", exitCheckError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			if tt.rules != "" {
+				if err := os.WriteFile(path, []byte(`{"rules": [`+tt.rules+`]}`), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := runCheck(path, true); got != tt.want {
+				t.Errorf("runCheck = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/posturetoken"
+)
+
+// PostureToken is a signed token carrying the collector's verdict on this
+// device, which the gateway lets decide what the device may reach
+type PostureToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Verdict   struct {
+		Compliant bool   `json:"compliant"`
+		Status    string `json:"status"`
+		Score     int    `json:"score"`
+	} `json:"verdict"`
+	fetchedAt time.Time
+}
+
+// stale reports whether t should be replaced: it is past half its life,
+// or the device's status has changed since it was issued
+func (t *PostureToken) stale(status string, now time.Time) bool {
+	return t == nil || t.Verdict.Status != status || now.After(t.fetchedAt.Add(t.ExpiresAt.Sub(t.fetchedAt)/2))
+}
+
+// postureTokenURL derives the collector's posture token endpoint from its
+// report URL, e.g. http://collector:8000/report ->
+// http://collector:8000/posture/token?device_id=laptop-1
+func postureTokenURL(reportURL, hostname string) (string, error) {
+	u, err := url.Parse(reportURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid collector URL %q", reportURL)
+	}
+	u.Path = path.Join("/", path.Dir(u.Path), "posture", "token")
+	u.RawQuery = url.Values{"device_id": {hostname}}.Encode()
+	return u.String(), nil
+}
+
+// FetchPostureToken asks the collector for a token carrying its verdict on
+// the device it last received a report from. The device ID in the query
+// only matters to collectors with authentication disabled; the others
+// issue the token to the device the API key belongs to.
+func (r *Reporter) FetchPostureToken(hostname string) (*PostureToken, error) {
+	endpoint, err := postureTokenURL(r.collectorURL, hostname)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	apiKey, err := r.apiKey()
+	if err != nil {
+		return nil, err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach collector: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("collector does not issue posture tokens, or has no report from %s yet", hostname)
+	default:
+		return nil, fmt.Errorf("collector API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var token PostureToken
+	if err := json.Unmarshal(body, &token); err != nil || token.Token == "" {
+		return nil, fmt.Errorf("unexpected posture token response: %s", string(body))
+	}
+	token.fetchedAt = time.Now()
+	return &token, nil
+}
+
+// TrustBroker hands the device's posture token to the software that
+// presents it to the gateway: it keeps the token in a file, readable only
+// by its owner, for tools that add the X-Posture-Token header themselves,
+// and runs a relay that browsers reach through a PAC file, which forwards
+// their requests to the gateway with the header added.
+type TrustBroker struct {
+	file    string   // empty: no token file
+	gateway *url.URL // nil: no relay
+
+	mu    sync.RWMutex
+	token *PostureToken
+	log   *slog.Logger
+}
+
+// NewTrustBroker creates a broker writing the token to file, if set, and
+// relaying to the proxy at gateway, e.g. http://gateway:8080, if set
+func NewTrustBroker(file, gateway string, logger *slog.Logger) (*TrustBroker, error) {
+	b := &TrustBroker{file: file, log: logger}
+	if gateway != "" {
+		u, err := url.Parse(gateway)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid gateway URL %q", gateway)
+		}
+		b.gateway = u
+	}
+	return b, nil
+}
+
+// Refresh fetches a new token after a report when the one held is stale
+func (b *TrustBroker) Refresh(r *Reporter, status *DeviceStatus) {
+	b.mu.RLock()
+	stale := b.token.stale(status.Status, time.Now())
+	b.mu.RUnlock()
+	if !stale {
+		return
+	}
+	token, err := r.FetchPostureToken(status.Hostname)
+	if err != nil {
+		b.log.Warn("failed to fetch posture token", "error", err)
+		return
+	}
+	if b.file != "" {
+		if err := writeSecret(b.file, token.Token); err != nil {
+			b.log.Warn("failed to save posture token", "error", err)
+		}
+	}
+	b.mu.Lock()
+	b.token = token
+	b.mu.Unlock()
+	b.log.Info("posture token refreshed", "compliant", token.Verdict.Compliant, "status", token.Verdict.Status, "expires_at", token.ExpiresAt)
+}
+
+// Token returns the current token, or "" if there is none that is still valid
+func (b *TrustBroker) Token() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.token == nil || !time.Now().Before(b.token.ExpiresAt) {
+		return ""
+	}
+	return b.token.Token
+}
+
+// relayHandler serves the relay listening on addr. Requests in proxy form
+// (absolute URLs) from this machine are forwarded to the gateway with the
+// token; GET /proxy.pac tells browsers to send plain HTTP through the relay
+// and everything else straight to the gateway, which the relay can't add
+// a header to.
+func (b *TrustBroker) relayHandler(addr net.Addr) http.Handler {
+	transport := &http.Transport{Proxy: http.ProxyURL(b.gateway), ResponseHeaderTimeout: 30 * time.Second}
+	relay := strings.TrimSuffix(strings.TrimPrefix(localURL(addr), "http://"), "/")
+	pac := fmt.Sprintf(`function FindProxyForURL(url, host) {
+  if (url.substring(0, 5) == "http:") {
+    return "PROXY %s";
+  }
+  return "PROXY %s";
+}
+`, relay, b.gateway.Host)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopback(r.RemoteAddr) {
+			// Anyone else would browse with this device's posture
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodConnect {
+			http.Error(w, "the trust relay forwards plain HTTP only", http.StatusNotImplemented)
+			return
+		}
+		if !r.URL.IsAbs() {
+			if r.URL.Path != "/proxy.pac" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+			io.WriteString(w, pac)
+			return
+		}
+
+		out := r.Clone(r.Context())
+		out.RequestURI = ""
+		out.Header.Del("Proxy-Connection")
+		posturetoken.Strip(out.Header)
+		if token := b.Token(); token != "" {
+			out.Header.Set(posturetoken.HeaderToken, token)
+		}
+		resp, err := transport.RoundTrip(out)
+		if err != nil {
+			b.log.Warn("trust relay failed to reach the gateway", "url", r.URL.String(), "error", err)
+			http.Error(w, "gateway unreachable", http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for key, values := range resp.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})
+}
+
+// relayServer returns the server for the relay listening on addr
+func (b *TrustBroker) relayServer(addr net.Addr) *http.Server {
+	return &http.Server{
+		Handler:     b.relayHandler(addr),
+		ReadTimeout: 30 * time.Second,
+	}
+}
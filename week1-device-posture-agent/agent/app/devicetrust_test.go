@@ -0,0 +1,91 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostureTokenURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"http://collector:8000/report":               "http://collector:8000/posture/token?device_id=laptop+1",
+		"https://posture.example.com/api/report?x=1": "https://posture.example.com/api/posture/token?device_id=laptop+1",
+	} {
+		if got, err := postureTokenURL(in, "laptop 1"); err != nil || got != want {
+			t.Errorf("postureTokenURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+}
+
+func TestTrustBrokerRelaysToken(t *testing.T) {
+	fetches := 0
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/posture/token" || r.Header.Get("Authorization") != "Bearer dpk_secret" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches++
+		expires := time.Now().Add(5 * time.Minute).UTC().Format(time.RFC3339)
+		w.Write([]byte(`{"token":"a.b.c","expires_at":"` + expires + `","verdict":{"compliant":true,"status":"HEALTHY","score":97}}`))
+	}))
+	defer collector.Close()
+
+	var seen http.Header
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header
+		io.WriteString(w, "via gateway: "+r.URL.String())
+	}))
+	defer gateway.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "api-key"), []byte("dpk_secret\n"), 0600)
+	reporter := NewReporter(collector.URL+"/report", filepath.Join(dir, "api-key"), slog.Default())
+	broker, err := NewTrustBroker(filepath.Join(dir, "posture-token"), gateway.URL, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := &DeviceStatus{Hostname: "laptop-1", Status: StatusHealthy}
+	broker.Refresh(reporter, status)
+	broker.Refresh(reporter, status) // still fresh
+	if fetches != 1 || broker.Token() != "a.b.c" {
+		t.Fatalf("fetched %d tokens, holding %q", fetches, broker.Token())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "posture-token")); string(data) != "a.b.c\n" {
+		t.Errorf("token file holds %q", data)
+	}
+
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3128}
+	relay := broker.relayHandler(addr)
+
+	req := httptest.NewRequest(http.MethodGet, "http://intranet.example.com/wiki", nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	req.Header.Set("X-Posture-Token", "forged")
+	rec := httptest.NewRecorder()
+	relay.ServeHTTP(rec, req)
+	if rec.Body.String() != "via gateway: http://intranet.example.com/wiki" || seen.Get("X-Posture-Token") != "a.b.c" {
+		t.Errorf("relayed %d %q with token %q", rec.Code, rec.Body.String(), seen.Get("X-Posture-Token"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/proxy.pac", nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	rec = httptest.NewRecorder()
+	relay.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"PROXY 127.0.0.1:3128"`) {
+		t.Errorf("PAC file:\n%s", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://intranet.example.com/wiki", nil)
+	req.RemoteAddr = "10.0.0.7:50000"
+	rec = httptest.NewRecorder()
+	relay.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("relayed for another machine: %d", rec.Code)
+	}
+}
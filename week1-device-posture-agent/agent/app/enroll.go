@@ -0,0 +1,160 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/httpclient"
+)
+
+// Enrollment is the collector's reply to a successful enrollment
+type Enrollment struct {
+	Tenant   string            `json:"tenant"`
+	Hostname string            `json:"hostname"`
+	KeyID    string            `json:"key_id"`
+	APIKey   string            `json:"api_key"`
+	Tags     map[string]string `json:"tags"` // assigned by the enrollment token, e.g. the device's group
+}
+
+// enrollURL derives the collector's enrollment endpoint from its report URL,
+// e.g. http://collector:8000/report -> http://collector:8000/enroll
+func enrollURL(reportURL string) (string, error) {
+	u, err := url.Parse(reportURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid collector URL %q", reportURL)
+	}
+	u.Path = path.Join("/", path.Dir(u.Path), "enroll")
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// Enroll exchanges a one-time enrollment token for this device's API key
+// and saves the key to keyFile, readable only by its owner. It registers
+// the device's report signing key, created next to keyFile on the first
+// enrollment, with the collector. The device
+// certificate in files, if any, is presented but not required: the
+// collector issues credentials to devices that don't have one yet.
+func Enroll(reportURL, token, hostname, keyFile string, files ClientTLS) (*Enrollment, error) {
+	endpoint, err := enrollURL(reportURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := files.httpClient(httpclient.Options{Timeout: 10 * time.Second, UserAgent: "DevicePostureAgent/" + version})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the directory of %s: %w", keyFile, err)
+	}
+	signer, _, err := cryptoutil.LoadOrCreateSigner(signingKeyFile(keyFile), "signing key")
+	if err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(map[string]string{
+		"token":       token,
+		"hostname":    hostname,
+		"signing_key": base64.StdEncoding.EncodeToString(signer.PublicKey()),
+	})
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach collector: %w", err)
+	}
+	defer resp.Body.Close()
+	reply, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusForbidden:
+		return nil, errors.New("collector refused the enrollment token: it is invalid, already used or expired; ask an admin for a new one")
+	default:
+		return nil, fmt.Errorf("enrollment failed with status %d: %s", resp.StatusCode, string(reply))
+	}
+
+	var enrollment Enrollment
+	if err := json.Unmarshal(reply, &enrollment); err != nil || enrollment.APIKey == "" {
+		return nil, fmt.Errorf("unexpected enrollment response: %s", string(reply))
+	}
+	if err := writeSecret(keyFile, enrollment.APIKey); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// signingKeyFile is where the Ed25519 key the device signs its reports with
+// is kept, next to its API key
+func signingKeyFile(keyFile string) string {
+	return keyFile + ".signing-key"
+}
+
+// writeSecret atomically replaces path with value, readable only by its owner
+func writeSecret(path, value string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create the directory of %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	if _, err := tmp.WriteString(value + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return nil
+}
+
+// enrollIfNeeded enrolls the device on its first run: when an enrollment
+// token is given and the API key file does not exist yet. Later runs find
+// the key and skip enrollment, so the token may stay in the configuration.
+func enrollIfNeeded(reportURL, token, keyFile string, files ClientTLS, logger *slog.Logger) error {
+	if token == "" {
+		return nil
+	}
+	if keyFile == "" {
+		return errors.New("an enrollment token needs -api-key-file to store the issued API key")
+	}
+	if _, err := os.Stat(keyFile); err == nil {
+		return nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %w", err)
+	}
+	enrollment, err := Enroll(reportURL, token, hostname, keyFile, files)
+	if err != nil {
+		return err
+	}
+	logger.Info("device enrolled", "hostname", enrollment.Hostname, "tenant", enrollment.Tenant,
+		"key_id", enrollment.KeyID, "tags", enrollment.Tags, "api_key_file", keyFile)
+	return nil
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEnrollURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"http://collector:8000/report":               "http://collector:8000/enroll",
+		"https://posture.example.com/api/report?x=1": "https://posture.example.com/api/enroll",
+		"http://collector:8000":                      "http://collector:8000/enroll",
+	} {
+		if got, err := enrollURL(in); err != nil || got != want {
+			t.Errorf("enrollURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+}
+
+func TestEnrollSavesKey(t *testing.T) {
+	var req map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/enroll" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["token"] != "dpe_good" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"tenant":"default","hostname":"laptop-1","key_id":"dpk_1","api_key":"dpk_secret","tags":{"group":"eng"}}`))
+	}))
+	defer srv.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "posture", "api-key")
+	if _, err := Enroll(srv.URL+"/report", "dpe_bad", "laptop-1", keyFile, ClientTLS{}); err == nil {
+		t.Fatal("enrollment with a refused token succeeded")
+	}
+	enrollment, err := Enroll(srv.URL+"/report", "dpe_good", "laptop-1", keyFile, ClientTLS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req["hostname"] != "laptop-1" || enrollment.Tags["group"] != "eng" {
+		t.Errorf("request %v, enrollment %+v", req, enrollment)
+	}
+
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+	if key, _ := NewReporter(srv.URL, keyFile, slog.Default()).apiKey(); key != "dpk_secret" {
+		t.Errorf("saved key = %q", key)
+	}
+	// The signing key registered is the one reports are signed with
+	signer, err := NewReporter(srv.URL, keyFile, slog.Default()).signer()
+	if err != nil || signer == nil || req["signing_key"] != base64.StdEncoding.EncodeToString(signer.PublicKey()) {
+		t.Errorf("registered signing key %q, signer %v, %v", req["signing_key"], signer, err)
+	}
+
+	// An existing key file means the device is already enrolled
+	if err := enrollIfNeeded(srv.URL+"/report", "dpe_bad", keyFile, ClientTLS{}, slog.Default()); err != nil {
+		t.Errorf("enrollIfNeeded with a key file: %v", err)
+	}
+}
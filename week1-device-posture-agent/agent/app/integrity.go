@@ -0,0 +1,296 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tamper event kinds
+const (
+	TamperBinaryHash     = "binary_hash_mismatch"
+	TamperConfigModified = "config_modified"
+	TamperConfigRemoved  = "config_removed"
+)
+
+// integrityWeight makes any tamper finding push a device to UNHEALTHY under
+// the default scoring model
+const integrityWeight = 60
+
+// maxPendingTamper bounds how many tamper events are kept between reports
+const maxPendingTamper = 20
+
+// TamperEvent is a high-severity integrity finding sent with the next report
+type TamperEvent struct {
+	Kind      string    `json:"kind"`
+	Path      string    `json:"path"`
+	Expected  string    `json:"expected,omitempty"`
+	Actual    string    `json:"actual,omitempty"`
+	Severity  string    `json:"severity"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ReleaseManifest lists the published SHA-256 of each release binary:
+//
+//	{"version": "1.0.0", "sha256": {"linux/amd64": "9f86d0...", "darwin/arm64": "..."}}
+type ReleaseManifest struct {
+	Version string            `json:"version"`
+	SHA256  map[string]string `json:"sha256"`
+}
+
+// LoadReleaseManifest reads a manifest from a file path or an http(s) URL
+func LoadReleaseManifest(source string) (*ReleaseManifest, error) {
+	var data []byte
+	var err error
+	if isURL(source) {
+		data, err = fetchURL(source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load release manifest: %w", err)
+	}
+
+	var manifest ReleaseManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse release manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// ExpectedHash returns the published hash for this platform
+func (m *ReleaseManifest) ExpectedHash() (string, error) {
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	hash, ok := m.SHA256[platform]
+	if !ok {
+		return "", fmt.Errorf("release manifest %s has no hash for %s", m.Version, platform)
+	}
+	return strings.ToLower(hash), nil
+}
+
+// fileStamp lets unchanged files skip rehashing
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchedFile is a config file and the hash it had when the agent started
+type watchedFile struct {
+	baseline string // "" if the file didn't exist
+	stamp    fileStamp
+	hash     string
+}
+
+// IntegrityMonitor verifies the agent binary against a release manifest and
+// watches config files for changes made after startup. Findings stay active
+// until the agent restarts; each is reported once as a TamperEvent.
+type IntegrityMonitor struct {
+	mu           sync.Mutex
+	binaryPath   string
+	expectedHash string // "" skips the binary check
+	binaryStamp  fileStamp
+	binaryHash   string
+	files        map[string]*watchedFile
+	active       map[string]TamperEvent // keyed by kind and path
+	pending      []TamperEvent
+	log          *slog.Logger
+}
+
+// NewIntegrityMonitor records the baseline hash of every watched file.
+// manifest may be nil to skip binary verification.
+func NewIntegrityMonitor(manifest *ReleaseManifest, watch []string, logger *slog.Logger) (*IntegrityMonitor, error) {
+	m := &IntegrityMonitor{
+		files:  make(map[string]*watchedFile),
+		active: make(map[string]TamperEvent),
+		log:    logger,
+	}
+
+	if manifest != nil {
+		expected, err := manifest.ExpectedHash()
+		if err != nil {
+			return nil, err
+		}
+		if m.binaryPath, err = executablePath(); err != nil {
+			return nil, err
+		}
+		m.expectedHash = expected
+	}
+
+	for _, path := range watch {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		file := &watchedFile{}
+		hash, stamp, err := hashFile(abs)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to hash %s: %w", abs, err)
+		}
+		file.baseline, file.hash, file.stamp = hash, hash, stamp
+		m.files[abs] = file
+	}
+	return m, nil
+}
+
+// Verify rehashes the binary and watched files and records any new findings
+func (m *IntegrityMonitor) Verify() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.expectedHash != "" {
+		hash, err := m.rehash(m.binaryPath, &m.binaryStamp, &m.binaryHash)
+		switch {
+		case err != nil:
+			m.log.Warn("could not hash agent binary", "path", m.binaryPath, "error", err)
+		case hash != m.expectedHash:
+			m.record(TamperEvent{Kind: TamperBinaryHash, Path: m.binaryPath, Expected: m.expectedHash, Actual: hash})
+		}
+	}
+
+	for path, file := range m.files {
+		hash, err := m.rehash(path, &file.stamp, &file.hash)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if file.baseline != "" {
+				m.record(TamperEvent{Kind: TamperConfigRemoved, Path: path, Expected: file.baseline})
+			}
+		case err != nil:
+			m.log.Warn("could not hash watched file", "path", path, "error", err)
+		case hash != file.baseline:
+			m.record(TamperEvent{Kind: TamperConfigModified, Path: path, Expected: file.baseline, Actual: hash})
+		}
+	}
+}
+
+// rehash returns the file's hash, reusing the cached one when size and
+// modification time are unchanged
+func (m *IntegrityMonitor) rehash(path string, stamp *fileStamp, cached *string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if *cached != "" && info.Size() == stamp.size && info.ModTime().Equal(stamp.modTime) {
+		return *cached, nil
+	}
+	hash, newStamp, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	*cached, *stamp = hash, newStamp
+	return hash, nil
+}
+
+// record activates a finding the first time it is seen
+func (m *IntegrityMonitor) record(event TamperEvent) {
+	key := event.Kind + ":" + event.Path
+	if _, seen := m.active[key]; seen {
+		return
+	}
+	event.Severity = SeverityCritical
+	event.Timestamp = time.Now()
+	m.active[key] = event
+
+	m.log.Error("tamper detected", "kind", event.Kind, "path", event.Path, "expected", event.Expected, "actual", event.Actual)
+	m.pending = append(m.pending, event)
+	if len(m.pending) > maxPendingTamper {
+		m.pending = m.pending[len(m.pending)-maxPendingTamper:]
+	}
+}
+
+// Active returns every finding detected since startup
+func (m *IntegrityMonitor) Active() []TamperEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := make([]TamperEvent, 0, len(m.active))
+	for _, event := range m.active {
+		events = append(events, event)
+	}
+	return events
+}
+
+// Pending returns the tamper events not yet delivered to the collector
+func (m *IntegrityMonitor) Pending() []TamperEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]TamperEvent(nil), m.pending...)
+}
+
+// Ack drops the first n pending events once they have been delivered
+func (m *IntegrityMonitor) Ack(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n > len(m.pending) {
+		n = len(m.pending)
+	}
+	m.pending = m.pending[n:]
+}
+
+// IntegrityCheck fails critically while any tamper finding is active
+func IntegrityCheck(m *IntegrityMonitor) Check {
+	return Check{
+		Name:        "integrity",
+		Description: "agent binary matches the release manifest and watched config is unchanged",
+		Weight:      integrityWeight,
+		Remediation: "Reinstall the agent from a trusted release and contact IT security",
+		Evaluate: func(status *DeviceStatus) CheckResult {
+			active := m.Active()
+			if len(active) == 0 {
+				return CheckResult{Name: "integrity", Passed: true}
+			}
+			findings := make([]string, 0, len(active))
+			for _, event := range active {
+				findings = append(findings, fmt.Sprintf("%s (%s)", event.Kind, filepath.Base(event.Path)))
+			}
+			sort.Strings(findings)
+			return CheckResult{
+				Name:     "integrity",
+				Severity: SeverityCritical,
+				Message:  "Tamper detected: " + strings.Join(findings, ", "),
+			}
+		},
+	}
+}
+
+// executablePath resolves the running agent binary
+func executablePath() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate agent binary: %w", err)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve agent binary: %w", err)
+	}
+	return path, nil
+}
+
+// hashFile returns the hex SHA-256 of a file and its size/modtime stamp
+func hashFile(path string) (string, fileStamp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fileStamp{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fileStamp{}, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fileStamp{}, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), fileStamp{size: info.Size(), modTime: info.ModTime()}, nil
+}
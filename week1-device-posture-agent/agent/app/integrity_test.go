@@ -0,0 +1,57 @@
+package app
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIntegrityMonitorWatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	modified := filepath.Join(dir, "policy.json")
+	removed := filepath.Join(dir, "unit.service")
+	for _, path := range []string{modified, removed} {
+		if err := os.WriteFile(path, []byte("original"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := NewIntegrityMonitor(nil, []string{modified, removed}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewIntegrityMonitor error: %v", err)
+	}
+	m.Verify()
+	if events := m.Pending(); len(events) != 0 {
+		t.Fatalf("unchanged files reported %v", events)
+	}
+
+	// Same size, later mtime: must still be rehashed and caught
+	if err := os.WriteFile(modified, []byte("tampered"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(modified, later, later)
+	os.Remove(removed)
+
+	m.Verify()
+	m.Verify() // findings are only reported once
+	kinds := map[string]string{}
+	for _, event := range m.Pending() {
+		kinds[event.Path] = event.Kind
+	}
+	if len(m.Pending()) != 2 || kinds[modified] != TamperConfigModified || kinds[removed] != TamperConfigRemoved {
+		t.Fatalf("unexpected tamper events %v", m.Pending())
+	}
+
+	result := IntegrityCheck(m).Evaluate(&DeviceStatus{})
+	if result.Passed || result.Severity != SeverityCritical {
+		t.Errorf("integrity check = %+v; want critical failure", result)
+	}
+
+	m.Ack(2)
+	if len(m.Pending()) != 0 || len(m.Active()) != 2 {
+		t.Errorf("after Ack: pending %d, active %d; want 0 and 2", len(m.Pending()), len(m.Active()))
+	}
+}
@@ -0,0 +1,499 @@
+package app
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Inventory kinds
+const (
+	InventorySoftware = "software"
+	InventoryPort     = "listening_port"
+	InventoryUSB      = "usb_device"
+)
+
+// Change actions
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeUpdated = "updated"
+)
+
+// maxPendingChanges bounds how many change events are kept between reports
+const maxPendingChanges = 500
+
+// Inventory maps each kind to its items, keyed by a stable identifier with a
+// detail value (software version, listening address, device name)
+type Inventory map[string]map[string]string
+
+// ChangeEvent is one difference between two inventory snapshots
+type ChangeEvent struct {
+	Kind      string    `json:"kind"`
+	Action    string    `json:"action"`
+	Item      string    `json:"item"`
+	Detail    string    `json:"detail,omitempty"`
+	Previous  string    `json:"previous,omitempty"` // old detail for updates
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DiffInventory lists what changed from prev to next. Kinds missing from
+// next (their collector failed) are skipped rather than reported as removed.
+func DiffInventory(prev, next Inventory, at time.Time) []ChangeEvent {
+	var events []ChangeEvent
+	for kind, items := range next {
+		old, ok := prev[kind]
+		if !ok {
+			continue // no baseline for this kind yet
+		}
+		for item, detail := range items {
+			previous, existed := old[item]
+			switch {
+			case !existed:
+				events = append(events, ChangeEvent{Kind: kind, Action: ChangeAdded, Item: item, Detail: detail, Timestamp: at})
+			case previous != detail:
+				events = append(events, ChangeEvent{Kind: kind, Action: ChangeUpdated, Item: item, Detail: detail, Previous: previous, Timestamp: at})
+			}
+		}
+		for item, detail := range old {
+			if _, still := items[item]; !still {
+				events = append(events, ChangeEvent{Kind: kind, Action: ChangeRemoved, Item: item, Detail: detail, Timestamp: at})
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Kind != events[j].Kind {
+			return events[i].Kind < events[j].Kind
+		}
+		return events[i].Item < events[j].Item
+	})
+	return events
+}
+
+// InventoryTracker collects inventory on its own, slower schedule and queues
+// the changes between snapshots until they are delivered. With a state file
+// the last snapshot survives restarts, so changes made while the agent was
+// down are still reported.
+type InventoryTracker struct {
+	interval  time.Duration
+	statePath string
+	timeout   time.Duration
+
+	mu      sync.Mutex
+	last    Inventory
+	lastRun time.Time
+	pending []ChangeEvent
+	log     *slog.Logger
+}
+
+// NewInventoryTracker loads the previous snapshot from statePath if given
+func NewInventoryTracker(interval time.Duration, statePath string, timeout time.Duration, logger *slog.Logger) *InventoryTracker {
+	t := &InventoryTracker{interval: interval, statePath: statePath, timeout: timeout, log: logger}
+	if statePath == "" {
+		return t
+	}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("could not read inventory state", "path", statePath, "error", err)
+		}
+		return t
+	}
+	if err := json.Unmarshal(data, &t.last); err != nil {
+		logger.Warn("ignoring corrupt inventory state", "path", statePath, "error", err)
+	}
+	return t
+}
+
+// Update collects a new snapshot when the interval has elapsed and queues
+// the differences from the previous one
+func (t *InventoryTracker) Update() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.lastRun.IsZero() && time.Since(t.lastRun) < t.interval {
+		return
+	}
+	t.lastRun = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	next := CollectInventory(ctx, t.log)
+
+	if t.last != nil {
+		events := DiffInventory(t.last, next, time.Now())
+		for _, event := range events {
+			t.log.Info("inventory changed", "kind", event.Kind, "action", event.Action, "item", event.Item, "detail", event.Detail)
+		}
+		t.pending = append(t.pending, events...)
+		if len(t.pending) > maxPendingChanges {
+			t.pending = t.pending[len(t.pending)-maxPendingChanges:]
+		}
+	} else {
+		t.last = Inventory{}
+	}
+
+	// Keep the old baseline for kinds that failed this time
+	for kind, items := range next {
+		t.last[kind] = items
+	}
+	t.saveState()
+}
+
+func (t *InventoryTracker) saveState() {
+	if t.statePath == "" {
+		return
+	}
+	data, err := json.Marshal(t.last)
+	if err == nil {
+		err = os.WriteFile(t.statePath, data, 0o600)
+	}
+	if err != nil {
+		t.log.Warn("could not save inventory state", "path", t.statePath, "error", err)
+	}
+}
+
+// Pending returns the change events not yet delivered to the collector
+func (t *InventoryTracker) Pending() []ChangeEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]ChangeEvent(nil), t.pending...)
+}
+
+// Ack drops the first n pending events once they have been delivered
+func (t *InventoryTracker) Ack(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n > len(t.pending) {
+		n = len(t.pending)
+	}
+	t.pending = t.pending[n:]
+}
+
+// CollectInventory gathers installed software, listening TCP and bound UDP
+// ports and attached USB devices. A kind whose collector fails is left out.
+func CollectInventory(ctx context.Context, logger *slog.Logger) Inventory {
+	inv := Inventory{}
+	collectors := map[string]func(context.Context) (map[string]string, error){
+		InventorySoftware: installedSoftware,
+		InventoryPort:     listeningPorts,
+		InventoryUSB:      usbDevices,
+	}
+	for kind, collect := range collectors {
+		items, err := collect(ctx)
+		if err != nil {
+			logger.Debug("inventory collection failed", "kind", kind, "error", err)
+			continue
+		}
+		inv[kind] = items
+	}
+	return inv
+}
+
+// installedSoftware maps package or application names to versions
+func installedSoftware(ctx context.Context) (map[string]string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		output, err := exec.CommandContext(ctx, "dpkg-query", "-W", "-f", "${Package}\t${Version}\n").Output()
+		if err != nil {
+			output, err = exec.CommandContext(ctx, "rpm", "-qa", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\n").Output()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("no supported package manager (dpkg, rpm) found: %w", err)
+		}
+		return parseTabPairs(string(output)), nil
+	case "darwin":
+		return macApplications("/Applications")
+	case "windows":
+		return windowsInstalledSoftware()
+	default:
+		return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
+// parseTabPairs reads "name\tvalue" lines
+func parseTabPairs(output string) map[string]string {
+	items := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(strings.TrimRight(line, "\r"), "\t")
+		if ok && name != "" {
+			items[name] = value
+		}
+	}
+	return items
+}
+
+var bundleVersion = regexp.MustCompile(`<key>CFBundleShortVersionString</key>\s*<string>([^<]*)</string>`)
+
+// macApplications lists app bundles with their version from Info.plist
+// (XML plists only; binary plists get an empty version)
+func macApplications(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	items := make(map[string]string)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".app") {
+			continue
+		}
+		version := ""
+		if plist, err := os.ReadFile(filepath.Join(dir, entry.Name(), "Contents", "Info.plist")); err == nil {
+			if m := bundleVersion.FindSubmatch(plist); m != nil {
+				version = string(m[1])
+			}
+		}
+		items[strings.TrimSuffix(entry.Name(), ".app")] = version
+	}
+	return items, nil
+}
+
+// listeningPorts maps "tcp/<port>" and "udp/<port>" to the sorted local
+// addresses a TCP socket listens on, or a UDP socket is bound to, at it
+func listeningPorts(ctx context.Context) (map[string]string, error) {
+	byPort := make(map[string][]string)
+	add := func(proto string, addrs []string) {
+		for _, addr := range addrs {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				continue
+			}
+			key := proto + "/" + port
+			byPort[key] = append(byPort[key], host)
+		}
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		for _, f := range []struct{ proto, path, state string }{
+			{"tcp", "/proc/net/tcp", procNetListen},
+			{"tcp", "/proc/net/tcp6", procNetListen},
+			{"udp", "/proc/net/udp", procNetUnconnected},
+			{"udp", "/proc/net/udp6", procNetUnconnected},
+		} {
+			data, err := os.ReadFile(f.path)
+			if err != nil {
+				if strings.HasSuffix(f.path, "6") && os.IsNotExist(err) {
+					continue // IPv6 disabled
+				}
+				return nil, fmt.Errorf("failed to read %s: %w", f.path, err)
+			}
+			add(f.proto, parseProcNet(string(data), f.state))
+		}
+	case "darwin":
+		output, err := exec.CommandContext(ctx, "netstat", "-an").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute netstat command: %w", err)
+		}
+		tcp, udp := parseNetstatListeners(string(output))
+		add("tcp", tcp)
+		add("udp", udp)
+	case "windows":
+		tcp, udp, err := windowsListeningSockets()
+		if err != nil {
+			return nil, err
+		}
+		add("tcp", tcp)
+		add("udp", udp)
+	default:
+		return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+
+	items := make(map[string]string, len(byPort))
+	for key, hosts := range byPort {
+		sort.Strings(hosts)
+		items[key] = strings.Join(dedupe(hosts), ",")
+	}
+	return items, nil
+}
+
+// Socket states in /proc/net: a listening TCP socket, and a UDP socket
+// that is bound but not connected
+const (
+	procNetListen      = "0A"
+	procNetUnconnected = "07"
+)
+
+// parseProcNet returns the local "host:port" of sockets in state from
+// /proc/net/tcp, tcp6, udp or udp6
+func parseProcNet(data, state string) []string {
+	var addrs []string
+	for _, line := range strings.Split(data, "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[3] != state {
+			continue
+		}
+		hexIP, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil {
+			continue
+		}
+		raw, err := hex.DecodeString(hexIP)
+		if err != nil || (len(raw) != 4 && len(raw) != 16) {
+			continue
+		}
+		// The kernel prints each 32-bit word in host (little-endian) order
+		for i := 0; i < len(raw); i += 4 {
+			raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+		}
+		addrs = append(addrs, net.JoinHostPort(net.IP(raw).String(), strconv.FormatUint(port, 10)))
+	}
+	return addrs
+}
+
+// parseNetstatListeners returns the local "host:port" of the listening TCP
+// sockets ("tcp4 0 0 *.22 *.* LISTEN") and the unconnected UDP sockets
+// ("udp4 0 0 *.5353 *.*") in macOS netstat output
+func parseNetstatListeners(output string) (tcp, udp []string) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(fields[0], "tcp") && len(fields) == 6 && fields[5] == "LISTEN":
+			if addr, ok := netstatAddr(fields[0], fields[3]); ok {
+				tcp = append(tcp, addr)
+			}
+		case strings.HasPrefix(fields[0], "udp") && len(fields) == 5 && fields[4] == "*.*":
+			if addr, ok := netstatAddr(fields[0], fields[3]); ok {
+				udp = append(udp, addr)
+			}
+		}
+	}
+	return tcp, udp
+}
+
+// netstatAddr turns a macOS netstat local address, which separates the
+// port with the last dot and writes a wildcard host as *, into "host:port"
+func netstatAddr(proto, local string) (string, bool) {
+	i := strings.LastIndex(local, ".")
+	if i < 0 {
+		return "", false
+	}
+	host := local[:i]
+	if host == "*" {
+		host = "0.0.0.0"
+		if strings.HasSuffix(proto, "6") {
+			host = "::"
+		}
+	}
+	return net.JoinHostPort(host, local[i+1:]), true
+}
+
+// ipTableLayout is where the local address and port are in the rows of a
+// table from GetExtendedTcpTable or GetExtendedUdpTable, which follow a
+// DWORD count of them
+type ipTableLayout struct {
+	rowSize, addrAt, addrLen, portAt int
+}
+
+// The rows of the OWNER_PID table classes
+var (
+	tcp4Rows = ipTableLayout{rowSize: 24, addrAt: 4, addrLen: 4, portAt: 8}   // MIB_TCPROW_OWNER_PID
+	tcp6Rows = ipTableLayout{rowSize: 56, addrAt: 0, addrLen: 16, portAt: 20} // MIB_TCP6ROW_OWNER_PID
+	udp4Rows = ipTableLayout{rowSize: 12, addrAt: 0, addrLen: 4, portAt: 4}   // MIB_UDPROW_OWNER_PID
+	udp6Rows = ipTableLayout{rowSize: 28, addrAt: 0, addrLen: 16, portAt: 20} // MIB_UDP6ROW_OWNER_PID
+)
+
+// parseIPTable returns the local "host:port" of each row of table. The
+// count is little-endian, as Windows is; addresses and ports are in
+// network byte order, a port in the low half of its DWORD.
+func parseIPTable(table []byte, rows ipTableLayout) []string {
+	if len(table) < 4 {
+		return nil
+	}
+	var addrs []string
+	n := int(binary.LittleEndian.Uint32(table))
+	for i, off := 0, 4; i < n && off+rows.rowSize <= len(table); i, off = i+1, off+rows.rowSize {
+		row := table[off : off+rows.rowSize]
+		ip := net.IP(append([]byte(nil), row[rows.addrAt:rows.addrAt+rows.addrLen]...))
+		port := binary.BigEndian.Uint16(row[rows.portAt:])
+		addrs = append(addrs, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return addrs
+}
+
+// usbDevices maps a device identifier to its product name
+func usbDevices(ctx context.Context) (map[string]string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxUSBDevices("/sys/bus/usb/devices")
+	case "darwin":
+		output, err := exec.CommandContext(ctx, "ioreg", "-p", "IOUSB", "-w0").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute ioreg command: %w", err)
+		}
+		return parseIORegUSB(string(output)), nil
+	case "windows":
+		return windowsUSBDevices()
+	default:
+		return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
+// linuxUSBDevices reads vendor/product IDs from sysfs, skipping root hubs
+func linuxUSBDevices(root string) (map[string]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", root, err)
+	}
+	read := func(dir, name string) string {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		return strings.TrimSpace(string(data))
+	}
+
+	items := make(map[string]string)
+	for _, entry := range entries {
+		dir := filepath.Join(root, entry.Name())
+		vendor, product := read(dir, "idVendor"), read(dir, "idProduct")
+		if vendor == "" || vendor == "1d6b" { // 1d6b: Linux Foundation root hubs
+			continue
+		}
+		key := vendor + ":" + product
+		if serial := read(dir, "serial"); serial != "" {
+			key += ":" + serial
+		}
+		items[key] = strings.TrimSpace(read(dir, "manufacturer") + " " + read(dir, "product"))
+	}
+	return items, nil
+}
+
+var ioregDevice = regexp.MustCompile(`\+-o (.+?)@([0-9a-f]+)\s+<class (IOUSBHostDevice|IOUSBDevice)`)
+
+// parseIORegUSB reads device names and locations from "ioreg -p IOUSB"
+func parseIORegUSB(output string) map[string]string {
+	items := make(map[string]string)
+	for _, m := range ioregDevice.FindAllStringSubmatch(output, -1) {
+		items[m[1]+"@"+m[2]] = m[1]
+	}
+	return items
+}
+
+func dedupe(sorted []string) []string {
+	out := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
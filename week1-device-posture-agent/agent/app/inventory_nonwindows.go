@@ -0,0 +1,9 @@
+//go:build !windows
+
+package app
+
+func windowsInstalledSoftware() (map[string]string, error) { return nil, errWindowsOnly }
+
+func windowsListeningSockets() (tcp, udp []string, err error) { return nil, nil, errWindowsOnly }
+
+func windowsUSBDevices() (map[string]string, error) { return nil, errWindowsOnly }
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffInventory(t *testing.T) {
+	prev := Inventory{
+		InventorySoftware: {"curl": "7.88", "vim": "9.0"},
+		InventoryPort:     {"tcp/22": "0.0.0.0"},
+	}
+	next := Inventory{
+		InventorySoftware: {"curl": "8.1", "nginx": "1.24"},
+		InventoryPort:     {"tcp/22": "0.0.0.0", "tcp/8080": "::"},
+		InventoryUSB:      {"046d:c52b": "Logitech Receiver"}, // no baseline yet
+	}
+
+	got := DiffInventory(prev, next, time.Time{})
+	want := []ChangeEvent{
+		{Kind: InventoryPort, Action: ChangeAdded, Item: "tcp/8080", Detail: "::"},
+		{Kind: InventorySoftware, Action: ChangeUpdated, Item: "curl", Detail: "8.1", Previous: "7.88"},
+		{Kind: InventorySoftware, Action: ChangeAdded, Item: "nginx", Detail: "1.24"},
+		{Kind: InventorySoftware, Action: ChangeRemoved, Item: "vim", Detail: "9.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffInventory() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// A kind that failed to collect is not reported as everything removed
+	if events := DiffInventory(prev, Inventory{InventoryPort: prev[InventoryPort]}, time.Time{}); len(events) != 0 {
+		t.Errorf("missing kind produced events %+v", events)
+	}
+}
+
+func TestParseListeners(t *testing.T) {
+	procTCP := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1
+   1: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2 1
+   2: 0100007F:A1B2 0100007F:1F90 01 00000000:00000000 00:00000000 00000000     0        0 3 1
+`
+	if got, want := parseProcNet(procTCP, procNetListen), []string{"0.0.0.0:22", "127.0.0.1:8080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcNet(tcp) = %v; want %v", got, want)
+	}
+
+	procTCP6 := `  sl  local_address                         remote_address                        st
+   0: 00000000000000000000000001000000:0277 00000000000000000000000000000000:0000 0A 00000000:00000000
+`
+	if got, want := parseProcNet(procTCP6, procNetListen), []string{"[::1]:631"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcNet(tcp6) = %v; want %v", got, want)
+	}
+
+	procUDP := `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: 00000000:14E9 00000000:0000 07 00000000:00000000 00:00000000 00000000   104        0 1 2 0000000000000000 0
+  101: 0100007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000   101        0 2 2 0000000000000000 0
+  102: 0501A8C0:D431 08080808:0035 01 00000000:00000000 00:00000000 00000000  1000        0 3 2 0000000000000000 0
+`
+	if got, want := parseProcNet(procUDP, procNetUnconnected), []string{"0.0.0.0:5353", "127.0.0.1:53"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcNet(udp) = %v; want %v", got, want)
+	}
+
+	netstat := `Active Internet connections (including servers)
+Proto Recv-Q Send-Q  Local Address          Foreign Address        (state)
+tcp4       0      0  *.22                   *.*                    LISTEN
+tcp6       0      0  *.5000                 *.*                    LISTEN
+tcp4       0      0  127.0.0.1.631          *.*                    LISTEN
+tcp4       0      0  192.168.1.5.52000      17.1.2.3.443           ESTABLISHED
+udp4       0      0  *.5353                 *.*
+udp6       0      0  *.5353                 *.*
+udp4       0      0  192.168.1.5.60000      8.8.8.8.53
+`
+	tcp, udp := parseNetstatListeners(netstat)
+	if want := []string{"0.0.0.0:22", "[::]:5000", "127.0.0.1:631"}; !reflect.DeepEqual(tcp, want) {
+		t.Errorf("parseNetstatListeners() tcp = %v; want %v", tcp, want)
+	}
+	if want := []string{"0.0.0.0:5353", "[::]:5353"}; !reflect.DeepEqual(udp, want) {
+		t.Errorf("parseNetstatListeners() udp = %v; want %v", udp, want)
+	}
+}
+
+func TestParseIPTable(t *testing.T) {
+	table := func(rows ...[]byte) []byte {
+		buf := binary.LittleEndian.AppendUint32(nil, uint32(len(rows)))
+		for _, row := range rows {
+			buf = append(buf, row...)
+		}
+		return buf
+	}
+	// row lays out the address and port of a row of layout, leaving the
+	// state, scope and owning process fields zero
+	row := func(layout ipTableLayout, ip net.IP, port uint16) []byte {
+		r := make([]byte, layout.rowSize)
+		if layout.addrLen == 4 {
+			ip = ip.To4()
+		}
+		copy(r[layout.addrAt:], ip)
+		binary.BigEndian.PutUint16(r[layout.portAt:], port)
+		return r
+	}
+
+	for _, tt := range []struct {
+		name   string
+		layout ipTableLayout
+		table  []byte
+		want   []string
+	}{
+		{"tcp4", tcp4Rows, table(row(tcp4Rows, net.IPv4zero, 135), row(tcp4Rows, net.IPv4(127, 0, 0, 1), 8080)),
+			[]string{"0.0.0.0:135", "127.0.0.1:8080"}},
+		{"tcp6", tcp6Rows, table(row(tcp6Rows, net.IPv6unspecified, 445), row(tcp6Rows, net.IPv6loopback, 5357)),
+			[]string{"[::]:445", "[::1]:5357"}},
+		{"udp4", udp4Rows, table(row(udp4Rows, net.IPv4(192, 168, 1, 5), 137)), []string{"192.168.1.5:137"}},
+		{"udp6", udp6Rows, table(row(udp6Rows, net.IPv6unspecified, 5353)), []string{"[::]:5353"}},
+		{"empty", tcp4Rows, table(), nil},
+		{"truncated", tcp4Rows, table(row(tcp4Rows, net.IPv4zero, 135), row(tcp4Rows, net.IPv4zero, 139))[:4+24+10],
+			[]string{"0.0.0.0:135"}},
+		{"no count", tcp4Rows, []byte{1, 0}, nil},
+	} {
+		if got := parseIPTable(tt.table, tt.layout); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIPTable(%s) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// uninstallKeys are where installers register themselves (64-bit and 32-bit views)
+var uninstallKeys = []string{
+	`SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`,
+	`SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`,
+}
+
+// windowsInstalledSoftware reads DisplayName/DisplayVersion from the
+// machine-wide uninstall registry keys
+func windowsInstalledSoftware() (map[string]string, error) {
+	items := make(map[string]string)
+	opened := false
+	for _, path := range uninstallKeys {
+		root, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		opened = true
+		names, _ := root.ReadSubKeyNames(-1)
+		root.Close()
+
+		for _, name := range names {
+			key, err := registry.OpenKey(registry.LOCAL_MACHINE, path+`\`+name, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			display, _, err := key.GetStringValue("DisplayName")
+			if err == nil && display != "" {
+				version, _, _ := key.GetStringValue("DisplayVersion")
+				items[display] = version
+			}
+			key.Close()
+		}
+	}
+	if !opened {
+		return nil, fmt.Errorf("failed to open the uninstall registry keys")
+	}
+	return items, nil
+}
+
+// iphlpapi calls that golang.org/x/sys/windows doesn't wrap
+var (
+	modiphlpapi             = windows.NewLazySystemDLL("iphlpapi.dll")
+	procGetExtendedTcpTable = modiphlpapi.NewProc("GetExtendedTcpTable")
+	procGetExtendedUdpTable = modiphlpapi.NewProc("GetExtendedUdpTable")
+)
+
+// Table classes of GetExtendedTcpTable and GetExtendedUdpTable, whose rows
+// are laid out as tcp4Rows, tcp6Rows, udp4Rows and udp6Rows say
+const (
+	tcpTableOwnerPIDListener = 3 // TCP_TABLE_OWNER_PID_LISTENER
+	udpTableOwnerPID         = 1 // UDP_TABLE_OWNER_PID
+)
+
+// windowsListeningSockets returns the local "host:port" of the TCP sockets
+// listening and the UDP sockets bound, over IPv4 and IPv6
+func windowsListeningSockets() (tcp, udp []string, err error) {
+	for _, t := range []struct {
+		proc   *windows.LazyProc
+		family uint32
+		class  uint32
+		rows   ipTableLayout
+		addrs  *[]string
+	}{
+		{procGetExtendedTcpTable, windows.AF_INET, tcpTableOwnerPIDListener, tcp4Rows, &tcp},
+		{procGetExtendedTcpTable, windows.AF_INET6, tcpTableOwnerPIDListener, tcp6Rows, &tcp},
+		{procGetExtendedUdpTable, windows.AF_INET, udpTableOwnerPID, udp4Rows, &udp},
+		{procGetExtendedUdpTable, windows.AF_INET6, udpTableOwnerPID, udp6Rows, &udp},
+	} {
+		buf, err := extendedTable(t.proc, t.family, t.class)
+		if err != nil {
+			return nil, nil, err
+		}
+		*t.addrs = append(*t.addrs, parseIPTable(buf, t.rows)...)
+	}
+	return tcp, udp, nil
+}
+
+// extendedTable calls GetExtendedTcpTable or GetExtendedUdpTable, growing
+// the buffer until the table, which may grow between calls, fits
+func extendedTable(proc *windows.LazyProc, family, class uint32) ([]byte, error) {
+	var buf []byte
+	size := uint32(0)
+	for {
+		var table uintptr
+		if len(buf) > 0 {
+			table = uintptr(unsafe.Pointer(&buf[0]))
+		}
+		r, _, _ := proc.Call(table, uintptr(unsafe.Pointer(&size)), 0, uintptr(family), uintptr(class), 0)
+		switch errno := windows.Errno(r); errno {
+		case windows.ERROR_SUCCESS:
+			return buf, nil
+		case windows.ERROR_INSUFFICIENT_BUFFER:
+			buf = make([]byte, size)
+		default:
+			return nil, fmt.Errorf("%s failed: %w", proc.Name, errno)
+		}
+	}
+}
+
+// guidDevClassUSB is GUID_DEVCLASS_USB, the setup class of USB host
+// controllers, hubs and devices, {36FC9E60-C465-11CF-8056-444553540000}
+var guidDevClassUSB = windows.GUID{
+	Data1: 0x36fc9e60, Data2: 0xc465, Data3: 0x11cf,
+	Data4: [8]byte{0x80, 0x56, 0x44, 0x45, 0x53, 0x54, 0x00, 0x00},
+}
+
+// windowsUSBDevices maps the instance IDs of the USB devices present to
+// their friendly names, from SetupAPI
+func windowsUSBDevices() (map[string]string, error) {
+	devs, err := windows.SetupDiGetClassDevsEx(&guidDevClassUSB, "", 0, windows.DIGCF_PRESENT, 0, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list USB devices: %w", err)
+	}
+	defer devs.Close()
+
+	items := make(map[string]string)
+	for i := 0; ; i++ {
+		data, err := devs.EnumDeviceInfo(i)
+		if errors.Is(err, windows.ERROR_NO_MORE_ITEMS) {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		id, err := devs.DeviceInstanceID(data)
+		if err != nil {
+			continue
+		}
+		items[id] = deviceName(devs, data)
+	}
+	return items, nil
+}
+
+// deviceName returns a device's friendly name, or its description if it
+// has none, as Get-PnpDevice does
+func deviceName(devs windows.DevInfo, data *windows.DevInfoData) string {
+	for _, property := range []windows.SPDRP{windows.SPDRP_FRIENDLYNAME, windows.SPDRP_DEVICEDESC} {
+		value, err := devs.DeviceRegistryProperty(data, property)
+		if name, ok := value.(string); err == nil && ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// ProcessLimits caps the agent's own CPU and memory footprint
+type ProcessLimits struct {
+	MaxProcs int    // GOMAXPROCS; 0 leaves the runtime default
+	MemLimit string // soft memory limit like "64MiB"; empty leaves GOMEMLIMIT alone
+}
+
+// applyProcessLimits configures the Go runtime according to limits
+func applyProcessLimits(limits ProcessLimits, logger *slog.Logger) error {
+	if limits.MaxProcs > 0 {
+		runtime.GOMAXPROCS(limits.MaxProcs)
+	}
+
+	if limits.MemLimit != "" {
+		bytes, err := parseByteSize(limits.MemLimit)
+		if err != nil {
+			return fmt.Errorf("invalid memory limit %q: %w", limits.MemLimit, err)
+		}
+		debug.SetMemoryLimit(bytes)
+	}
+
+	logger.Debug("process limits applied",
+		"gomaxprocs", runtime.GOMAXPROCS(0),
+		"memory_limit_bytes", debug.SetMemoryLimit(-1),
+	)
+	return nil
+}
+
+// byteUnits are the suffixes accepted by parseByteSize, matching GOMEMLIMIT
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses sizes such as "512MiB", "1GiB" or a plain byte count
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSuffix(s, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number with an optional B/KiB/MiB/GiB/TiB suffix")
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("size must be positive")
+	}
+	return value * multiplier, nil
+}
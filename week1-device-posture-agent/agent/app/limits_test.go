@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"512B", 512, false},
+		{"64KiB", 64 << 10, false},
+		{"64MiB", 64 << 20, false},
+		{" 2 GiB ", 2 << 30, false},
+		{"1TiB", 1 << 40, false},
+		{"", 0, true},
+		{"MiB", 0, true},
+		{"64MB", 0, true},
+		{"1.5GiB", 0, true},
+		{"0", 0, true},
+		{"-1MiB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyProcessLimits(t *testing.T) {
+	procs, memLimit := runtime.GOMAXPROCS(0), debug.SetMemoryLimit(-1)
+	defer func() {
+		runtime.GOMAXPROCS(procs)
+		debug.SetMemoryLimit(memLimit)
+	}()
+
+	tests := []struct {
+		name      string
+		limits    ProcessLimits
+		wantProcs int
+		wantMem   int64
+		wantErr   bool
+	}{
+		{"both set", ProcessLimits{MaxProcs: 1, MemLimit: "64MiB"}, 1, 64 << 20, false},
+		{"zero leaves both alone", ProcessLimits{}, procs, memLimit, false},
+		{"bad memory limit", ProcessLimits{MemLimit: "lots"}, procs, memLimit, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime.GOMAXPROCS(procs)
+			debug.SetMemoryLimit(memLimit)
+			err := applyProcessLimits(tt.limits, discardLogger())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyProcessLimits = %v, want error %v", err, tt.wantErr)
+			}
+			if got := runtime.GOMAXPROCS(0); got != tt.wantProcs {
+				t.Errorf("GOMAXPROCS = %d, want %d", got, tt.wantProcs)
+			}
+			if got := debug.SetMemoryLimit(-1); got != tt.wantMem {
+				t.Errorf("memory limit = %d, want %d", got, tt.wantMem)
+			}
+		})
+	}
+}
+
+func TestRunLimited(t *testing.T) {
+	sc := NewSystemCollector(ResourceLimits{CollectConcurrency: 2, CheckTimeout: 50 * time.Millisecond}, discardLogger())
+
+	var running, peak atomic.Int32
+	values := make([]float64, 5)
+	errs := make([]error, 5)
+	var tasks []collectTask
+	for i := range values {
+		i := i
+		tasks = append(tasks, collectTask{
+			name: fmt.Sprintf("metric_%d", i),
+			fn: func(ctx context.Context) (float64, error) {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				if i == 4 {
+					<-ctx.Done() // a hung collector
+					return 0, ctx.Err()
+				}
+				time.Sleep(10 * time.Millisecond)
+				return float64(i), nil
+			},
+			value: &values[i],
+			err:   &errs[i],
+		})
+	}
+	sc.runLimited(tasks)
+
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d collectors ran at once, want at most 2", p)
+	}
+	for i := 0; i < 4; i++ {
+		if values[i] != float64(i) || errs[i] != nil {
+			t.Errorf("metric_%d = %v, %v", i, values[i], errs[i])
+		}
+	}
+	if errs[4] == nil || errors.Is(errs[4], context.DeadlineExceeded) || errs[4].Error() != "metric_4 collection timed out after 50ms" {
+		t.Errorf("hung collector error = %v", errs[4])
+	}
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxForwardedAttrLen keeps large attributes (stack traces, response bodies)
+// from bloating reports
+const maxForwardedAttrLen = 1024
+
+// LogEntry is one agent log record shipped to the collector with a report
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// LogBuffer holds recent log entries until a report carrying them is
+// accepted. When full, the oldest entries are dropped.
+type LogBuffer struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	max     int
+	dropped int
+}
+
+// NewLogBuffer creates a buffer keeping at most max entries
+func NewLogBuffer(max int) *LogBuffer {
+	if max <= 0 {
+		max = 200
+	}
+	return &LogBuffer{max: max}
+}
+
+// Add appends an entry, evicting the oldest one if the buffer is full
+func (b *LogBuffer) Add(entry LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries = append(b.entries, entry)
+	if len(b.entries) > b.max {
+		b.dropped += len(b.entries) - b.max
+		b.entries = b.entries[len(b.entries)-b.max:]
+	}
+}
+
+// Pending returns a copy of the buffered entries. If entries were dropped
+// since the last acknowledgement, a synthetic entry saying so comes first.
+func (b *LogBuffer) Pending() []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := make([]LogEntry, 0, len(b.entries)+1)
+	if b.dropped > 0 {
+		pending = append(pending, LogEntry{
+			Time:    time.Now(),
+			Level:   slog.LevelWarn.String(),
+			Message: "log buffer overflowed; older entries were dropped",
+			Attrs:   map[string]string{"dropped": slog.IntValue(b.dropped).String()},
+		})
+	}
+	return append(pending, b.entries...)
+}
+
+// Ack removes entries that were delivered in a report. n counts the entries
+// returned by Pending, including the overflow notice.
+func (b *LogBuffer) Ack(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.dropped > 0 && n > 0 {
+		b.dropped = 0
+		n--
+	}
+	if n > len(b.entries) {
+		n = len(b.entries)
+	}
+	b.entries = b.entries[n:]
+}
+
+// ForwardingHandler tees records at or above level into a LogBuffer while
+// passing everything through to the wrapped handler.
+type ForwardingHandler struct {
+	next   slog.Handler
+	buffer *LogBuffer
+	level  slog.Level
+	attrs  []slog.Attr
+}
+
+// NewForwardingHandler wraps next, capturing records at or above level
+func NewForwardingHandler(next slog.Handler, buffer *LogBuffer, level slog.Level) *ForwardingHandler {
+	return &ForwardingHandler{next: next, buffer: buffer, level: level}
+}
+
+func (h *ForwardingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level || h.next.Enabled(ctx, level)
+}
+
+func (h *ForwardingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= h.level {
+		entry := LogEntry{Time: r.Time, Level: r.Level.String(), Message: r.Message}
+		addAttr := func(a slog.Attr) bool {
+			if entry.Attrs == nil {
+				entry.Attrs = make(map[string]string)
+			}
+			value := a.Value.String()
+			if len(value) > maxForwardedAttrLen {
+				value = value[:maxForwardedAttrLen] + "…"
+			}
+			entry.Attrs[a.Key] = value
+			return true
+		}
+		for _, a := range h.attrs {
+			addAttr(a)
+		}
+		r.Attrs(addAttr)
+		h.buffer.Add(entry)
+	}
+
+	if h.next.Enabled(ctx, r.Level) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *ForwardingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ForwardingHandler{
+		next:   h.next.WithAttrs(attrs),
+		buffer: h.buffer,
+		level:  h.level,
+		attrs:  append(append([]slog.Attr(nil), h.attrs...), attrs...),
+	}
+}
+
+// WithGroup passes the group to the wrapped handler; forwarded entries stay flat
+func (h *ForwardingHandler) WithGroup(name string) slog.Handler {
+	return &ForwardingHandler{next: h.next.WithGroup(name), buffer: h.buffer, level: h.level, attrs: h.attrs}
+}
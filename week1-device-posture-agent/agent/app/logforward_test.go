@@ -0,0 +1,96 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogBuffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      int
+		added    int
+		acked    []int // Ack calls made after the entries are added
+		want     []string
+		overflow bool // an overflow notice comes first
+	}{
+		{"empty", 3, 0, nil, nil, false},
+		{"within capacity", 3, 2, nil, []string{"entry 0", "entry 1"}, false},
+		{"oldest dropped when full", 3, 5, nil, []string{"entry 2", "entry 3", "entry 4"}, true},
+		{"ack removes delivered entries", 3, 3, []int{2}, []string{"entry 2"}, false},
+		{"ack counts the overflow notice", 3, 5, []int{2}, []string{"entry 3", "entry 4"}, false},
+		{"ack beyond pending", 3, 2, []int{10}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewLogBuffer(tt.max)
+			for i := 0; i < tt.added; i++ {
+				b.Add(LogEntry{Time: time.Now(), Level: "WARN", Message: fmt.Sprintf("entry %d", i)})
+			}
+			for _, n := range tt.acked {
+				b.Ack(n)
+			}
+
+			pending := b.Pending()
+			if tt.overflow {
+				if len(pending) == 0 || !strings.Contains(pending[0].Message, "overflowed") {
+					t.Fatalf("pending = %+v, want an overflow notice first", pending)
+				}
+				pending = pending[1:]
+			}
+			var got []string
+			for _, entry := range pending {
+				got = append(got, entry.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("pending = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogBufferDefaultCapacity(t *testing.T) {
+	b := NewLogBuffer(0)
+	for i := 0; i < 250; i++ {
+		b.Add(LogEntry{Message: fmt.Sprintf("entry %d", i)})
+	}
+	if pending := b.Pending(); len(pending) != 201 || pending[1].Message != "entry 50" {
+		t.Errorf("kept %d entries from %q, want the overflow notice and the last 200", len(pending), pending[1].Message)
+	}
+}
+
+func TestForwardingHandler(t *testing.T) {
+	var out bytes.Buffer
+	buffer := NewLogBuffer(10)
+	next := slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelError})
+	logger := slog.New(NewForwardingHandler(next, buffer, slog.LevelWarn)).With("device", "laptop-1")
+
+	logger.Info("collected")
+	logger.Warn("collector slow", "latency", "3s", "body", strings.Repeat("x", maxForwardedAttrLen+10))
+	logger.WithGroup("report").Error("report failed", "status", 503)
+
+	pending := buffer.Pending()
+	if len(pending) != 2 {
+		t.Fatalf("forwarded %d entries, want the warning and the error: %+v", len(pending), pending)
+	}
+	warn, failed := pending[0], pending[1]
+	if warn.Level != "WARN" || warn.Message != "collector slow" || warn.Attrs["device"] != "laptop-1" || warn.Attrs["latency"] != "3s" {
+		t.Errorf("warning entry = %+v", warn)
+	}
+	if body := warn.Attrs["body"]; len(body) != maxForwardedAttrLen+len("…") {
+		t.Errorf("long attribute forwarded as %d bytes, want it cut to %d", len(body), maxForwardedAttrLen)
+	}
+	// Forwarded entries stay flat; the wrapped handler still gets the group
+	if failed.Level != "ERROR" || failed.Attrs["status"] != "503" || failed.Attrs["device"] != "laptop-1" {
+		t.Errorf("error entry = %+v", failed)
+	}
+
+	// Only the error reaches the wrapped handler, whose level is higher
+	if got := out.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, "report.status=503") {
+		t.Errorf("wrapped handler wrote %q", got)
+	}
+}
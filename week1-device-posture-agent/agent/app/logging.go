@@ -0,0 +1,255 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/logging"
+)
+
+// LogConfig controls how the agent writes its logs
+type LogConfig struct {
+	Level      string
+	Format     string // "text" or "json"
+	File       string // empty writes to stderr
+	MaxSizeMB  int
+	MaxBackups int
+	Pretty     bool // human-friendly console output for interactive runs
+
+	// Log forwarding: entries at or above ForwardLevel ride along with reports
+	Forward      bool
+	ForwardLevel string
+	ForwardMax   int
+}
+
+// setupLogging builds the configured logger for "agent run". When forward
+// is non-nil, qualifying records are also captured there. The returned
+// closer flushes and closes the log file, if any.
+func setupLogging(cfg LogConfig, forward *LogBuffer) (*slog.Logger, io.Closer, error) {
+	level := new(slog.LevelVar)
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	forwardLevel := slog.LevelWarn
+	if forward != nil && cfg.ForwardLevel != "" {
+		if err := forwardLevel.UnmarshalText([]byte(cfg.ForwardLevel)); err != nil {
+			return nil, nil, fmt.Errorf("invalid forward log level %q: %w", cfg.ForwardLevel, err)
+		}
+	}
+
+	var out io.Writer = os.Stderr
+	var closer io.Closer = io.NopCloser(nil)
+	if cfg.File != "" {
+		file, err := OpenRotatingFile(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		out, closer = file, file
+	}
+
+	var handler slog.Handler
+	if cfg.Pretty {
+		handler = NewPrettyHandler(out, level)
+	} else {
+		var err error
+		handler, err = logging.NewHandler(logging.Options{
+			Service: "device-posture-agent",
+			Version: version,
+			Level:   level,
+			Format:  cfg.Format,
+			Output:  out,
+		})
+		if err != nil {
+			closer.Close()
+			return nil, nil, err
+		}
+		// The collector knows devices by hostname
+		if hostname, err := os.Hostname(); err == nil {
+			handler = handler.WithAttrs([]slog.Attr{slog.String(logging.KeyDeviceID, hostname)})
+		}
+	}
+
+	if forward != nil {
+		handler = NewForwardingHandler(handler, forward, forwardLevel)
+	}
+
+	return slog.New(handler), closer, nil
+}
+
+// consoleLogger is the logger of the one-shot commands, in the interactive
+// console style
+func consoleLogger() *slog.Logger {
+	return slog.New(NewPrettyHandler(os.Stderr, slog.LevelInfo))
+}
+
+// isTerminal reports whether f is attached to a character device
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// PrettyHandler renders records as short console lines: the message,
+// after its level unless it is info, with attributes appended as
+// key=value pairs.
+type PrettyHandler struct {
+	mu    *sync.Mutex
+	out   io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+// NewPrettyHandler creates a PrettyHandler writing to out
+func NewPrettyHandler(out io.Writer, level slog.Leveler) *PrettyHandler {
+	return &PrettyHandler{mu: &sync.Mutex{}, out: out, level: level}
+}
+
+func (h *PrettyHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *PrettyHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if r.Level != slog.LevelInfo {
+		b.WriteString(r.Level.String() + " ")
+	}
+	b.WriteString(r.Message)
+
+	writeAttr := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, b.String())
+	return err
+}
+
+func (h *PrettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &clone
+}
+
+// WithGroup is a no-op; the pretty format is flat
+func (h *PrettyHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+// RotatingFile is an io.Writer that rotates the log file once it exceeds a
+// size limit, keeping a fixed number of numbered backups (agent.log.1, ...).
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// OpenRotatingFile opens (or creates) path for appending
+func OpenRotatingFile(path string, maxSizeMB, maxBackups int) (*RotatingFile, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = 10
+	}
+	rf := &RotatingFile{path: path, maxSize: int64(maxSizeMB) * 1024 * 1024, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	rf.file, rf.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would push the file past the limit.
+// If the file can't be rotated, p is appended to it as it is, and rotation
+// tried again on the next write.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		// Reopening failed after a rotation
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil && rf.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts agent.log.N-1 -> agent.log.N ... agent.log -> agent.log.1.
+// The file is closed for the renames, which Windows needs, and reopened
+// whether or not they succeed, so a failed rotation leaves the current
+// file open; rf.file is nil only if it can't be reopened.
+func (rf *RotatingFile) rotate() error {
+	rf.file.Close()
+	rf.file = nil
+
+	var rotateErr error
+	if rf.maxBackups <= 0 {
+		if err := os.Remove(rf.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			rotateErr = fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+			rotateErr = fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+// Close closes the underlying file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Close()
+}
+
+// logTimestamp formats times the way the pretty console output always has
+func logTimestamp(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	line := strings.Repeat("x", 9) + "\n" // 10 bytes
+
+	tests := []struct {
+		name       string
+		maxBackups int
+		writes     int
+		want       map[string]int // lines in each file, by suffix
+	}{
+		{"no rotation under the limit", 2, 3, map[string]int{"": 3}},
+		{"rotates past the limit", 2, 4, map[string]int{"": 1, ".1": 3}},
+		{"keeps at most maxBackups", 2, 10, map[string]int{"": 1, ".1": 3, ".2": 3}},
+		{"no backups truncates", 0, 4, map[string]int{"": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "agent.log")
+			rf, err := OpenRotatingFile(path, 1, tt.maxBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rf.Close()
+			rf.maxSize = 30
+			for i := 0; i < tt.writes; i++ {
+				if _, err := rf.Write([]byte(line)); err != nil {
+					t.Fatalf("write %d: %v", i, err)
+				}
+			}
+			matches, _ := filepath.Glob(path + "*")
+			if len(matches) != len(tt.want) {
+				t.Errorf("files = %v, want %d", matches, len(tt.want))
+			}
+			for suffix, lines := range tt.want {
+				data, err := os.ReadFile(path + suffix)
+				if err != nil {
+					t.Errorf("agent.log%s: %v", suffix, err)
+					continue
+				}
+				if got := strings.Count(string(data), "\n"); got != lines {
+					t.Errorf("agent.log%s has %d lines, want %d", suffix, got, lines)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileKeepsWritingWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	// A directory that isn't empty can be neither removed nor renamed over
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := OpenRotatingFile(path, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	rf.maxSize = 10
+
+	for i, msg := range []string{"first\n", "second\n", "third\n"} {
+		if n, err := rf.Write([]byte(msg)); err != nil || n != len(msg) {
+			t.Fatalf("write %d = %d, %v", i, n, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first\nsecond\nthird\n" {
+		t.Errorf("agent.log = %q, want every line kept", data)
+	}
+}
+
+func TestPrettyHandler(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(NewPrettyHandler(&out, slog.LevelDebug)).With("device", "laptop-1")
+	logger.Info("report sent", "status", 200)
+	logger.Warn("collector unreachable")
+	logger.Debug("retrying", "attempt", 2)
+	want := "report sent device=laptop-1 status=200\n" +
+		"WARN collector unreachable device=laptop-1\n" +
+		"DEBUG retrying device=laptop-1 attempt=2\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/httpclient"
+	"github.com/nisatyap/shared/promtext"
+)
+
+// MetricsExporter keeps the most recent collection results and exposes them
+// in the Prometheus text exposition format.
+type MetricsExporter struct {
+	mu               sync.RWMutex
+	lastStatus       *DeviceStatus
+	collectionsTotal uint64
+	collectionErrors uint64
+	reportsSent      uint64
+	reportsFailed    uint64
+	reportRetries    uint64
+	startTime        time.Time
+	features         *flags.Set // its flags' metrics follow the agent's; nil for none
+}
+
+// NewMetricsExporter creates a new MetricsExporter instance
+func NewMetricsExporter() *MetricsExporter {
+	return &MetricsExporter{startTime: time.Now()}
+}
+
+// ObserveStatus records a successful collection
+func (m *MetricsExporter) ObserveStatus(status *DeviceStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastStatus = status
+	m.collectionsTotal++
+}
+
+// ObserveCollectionError records a failed collection
+func (m *MetricsExporter) ObserveCollectionError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.collectionsTotal++
+	m.collectionErrors++
+}
+
+// ObserveReport records the outcome of sending a report to the collector
+func (m *MetricsExporter) ObserveReport(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.reportsFailed++
+	} else {
+		m.reportsSent++
+	}
+}
+
+// ObserveAttempt records an attempt at a request to the collector that
+// is to be retried
+func (m *MetricsExporter) ObserveAttempt(a httpclient.Attempt) {
+	if a.Retry == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reportRetries++
+}
+
+// ServeHTTP writes all metrics in Prometheus text format
+func (m *MetricsExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", promtext.ContentType)
+	fmt.Fprint(w, m.render())
+	if m.features != nil {
+		// The headers it sets come after the body has started, and are dropped
+		m.features.Handler().ServeHTTP(w, r)
+	}
+}
+
+// render builds the exposition text under a read lock
+func (m *MetricsExporter) render() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var b strings.Builder
+
+	promtext.Metric(&b, "posture_agent_start_time_seconds", "gauge",
+		"Unix time the agent process started.", nil, float64(m.startTime.Unix()))
+	promtext.Metric(&b, "posture_collections_total", "counter",
+		"Total number of collection cycles attempted.", nil, float64(m.collectionsTotal))
+	promtext.Metric(&b, "posture_collection_errors_total", "counter",
+		"Total number of collection cycles that failed.", nil, float64(m.collectionErrors))
+
+	promtext.Header(&b, "posture_reports_total", "counter", "Total number of reports sent to the collector by result.")
+	promtext.Sample(&b, "posture_reports_total", map[string]string{"result": "success"}, float64(m.reportsSent))
+	promtext.Sample(&b, "posture_reports_total", map[string]string{"result": "failure"}, float64(m.reportsFailed))
+	promtext.Metric(&b, "posture_report_retries_total", "counter",
+		"Total number of failed attempts at sending a report that were retried.", nil, float64(m.reportRetries))
+
+	status := m.lastStatus
+	if status == nil {
+		return b.String()
+	}
+
+	labels := map[string]string{"hostname": status.Hostname}
+
+	promtext.Metric(&b, "posture_disk_usage_percent", "gauge",
+		"Root filesystem usage percentage.", labels, status.DiskUsage)
+	promtext.Metric(&b, "posture_cpu_usage_percent", "gauge",
+		"Overall CPU utilization percentage.", labels, status.CPUUsage)
+	promtext.Metric(&b, "posture_memory_usage_percent", "gauge",
+		"Physical memory usage percentage.", labels, status.MemoryUsage)
+	promtext.Metric(&b, "posture_device_healthy", "gauge",
+		"1 if the device is HEALTHY, 0 otherwise.", labels, boolToFloat(status.Status == StatusHealthy))
+	promtext.Metric(&b, "posture_health_score", "gauge",
+		"Weighted health score from 0 (worst) to 100 (best).", labels, float64(status.Score))
+	promtext.Metric(&b, "posture_last_collection_timestamp_seconds", "gauge",
+		"Unix time of the last successful collection.", labels, float64(status.Timestamp.Unix()))
+
+	promtext.Header(&b, "posture_check_passed", "gauge", "1 if the posture check passed, 0 if it failed.")
+	for _, result := range status.Checks {
+		promtext.Sample(&b, "posture_check_passed",
+			map[string]string{"hostname": status.Hostname, "check": result.Name},
+			boolToFloat(result.Passed))
+	}
+
+	return b.String()
+}
+
+func boolToFloat(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
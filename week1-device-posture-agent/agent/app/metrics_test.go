@@ -0,0 +1,104 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/shared/httpclient"
+)
+
+func TestMetricsExporter(t *testing.T) {
+	status := &DeviceStatus{
+		Hostname:    `laptop-"1"`,
+		DiskUsage:   42.5,
+		MemoryUsage: 61,
+		Status:      StatusDegraded,
+		Score:       70,
+		Timestamp:   time.Unix(1700000000, 0),
+		Checks: []CheckResult{
+			{Name: "disk_usage", Passed: true},
+			{Name: "firewall_enabled", Passed: false},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		observe func(m *MetricsExporter)
+		want    []string
+		absent  []string
+	}{
+		{
+			name:    "before the first collection",
+			observe: func(m *MetricsExporter) {},
+			want: []string{
+				"# TYPE posture_collections_total counter",
+				"posture_collections_total 0",
+				`posture_reports_total{result="success"} 0`,
+			},
+			absent: []string{"posture_disk_usage_percent", "posture_check_passed{"},
+		},
+		{
+			name: "collections and reports",
+			observe: func(m *MetricsExporter) {
+				m.ObserveCollectionError()
+				m.ObserveStatus(status)
+				m.ObserveReport(nil)
+				m.ObserveReport(errors.New("collector unreachable"))
+				m.ObserveAttempt(httpclient.Attempt{Number: 1, Retry: time.Second})
+				m.ObserveAttempt(httpclient.Attempt{Number: 2})
+			},
+			want: []string{
+				"posture_collections_total 2",
+				"posture_collection_errors_total 1",
+				`posture_reports_total{result="success"} 1`,
+				`posture_reports_total{result="failure"} 1`,
+				"posture_report_retries_total 1",
+				"# TYPE posture_disk_usage_percent gauge",
+				`posture_disk_usage_percent{hostname="laptop-\"1\""} 42.5`,
+				`posture_memory_usage_percent{hostname="laptop-\"1\""} 61`,
+				`posture_device_healthy{hostname="laptop-\"1\""} 0`,
+				`posture_health_score{hostname="laptop-\"1\""} 70`,
+				`posture_last_collection_timestamp_seconds{hostname="laptop-\"1\""} 1700000000`,
+				`posture_check_passed{check="disk_usage",hostname="laptop-\"1\""} 1`,
+				`posture_check_passed{check="firewall_enabled",hostname="laptop-\"1\""} 0`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetricsExporter()
+			tt.observe(m)
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			lines := map[string]bool{}
+			for _, line := range strings.Split(rec.Body.String(), "\n") {
+				lines[line] = true
+			}
+			for _, line := range tt.want {
+				if !lines[line] {
+					t.Errorf("missing %q in\n%s", line, rec.Body)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(rec.Body.String(), s) {
+					t.Errorf("unexpected %q in\n%s", s, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsExporterRejectsWrites(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewMetricsExporter().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /metrics = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
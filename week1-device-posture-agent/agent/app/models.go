@@ -0,0 +1,48 @@
+package app
+
+import (
+	"time"
+
+	"github.com/nisatyap/shared/posture"
+)
+
+// reportSchemaVersion is the collector report schema this agent produces
+const reportSchemaVersion = 2
+
+// DeviceStatus represents the health status of a device
+type DeviceStatus struct {
+	SchemaVersion int           `json:"schema_version,omitempty"` // set by the Reporter
+	Hostname      string        `json:"hostname"`
+	IP            string        `json:"ip"`
+	DiskUsage     float64       `json:"disk_usage"`
+	CPUUsage      float64       `json:"cpu_usage"`
+	MemoryUsage   float64       `json:"memory_usage"`
+	OS            OSInfo        `json:"os"`
+	Firewall      *bool         `json:"firewall_enabled,omitempty"` // nil when the state couldn't be read
+	Status        string        `json:"status"`
+	Score         int           `json:"score"`
+	Severity      string        `json:"severity"`
+	FailingChecks []string      `json:"failing_checks,omitempty"`
+	Timestamp     time.Time     `json:"timestamp"`
+	Message       string        `json:"message,omitempty"`
+	Checks        []CheckResult `json:"checks,omitempty"`
+	Crashes       []CrashEvent  `json:"crashes,omitempty"`
+	Tamper        []TamperEvent `json:"tamper_events,omitempty"`
+	Changes       []ChangeEvent `json:"changes,omitempty"`
+	Logs          []LogEntry    `json:"logs,omitempty"`
+}
+
+// OSInfo identifies the operating system release
+type OSInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Arch    string `json:"arch"`
+}
+
+// HealthStatus constants
+const (
+	StatusHealthy   = posture.StatusHealthy
+	StatusDegraded  = posture.StatusDegraded
+	StatusUnhealthy = posture.StatusUnhealthy
+	DiskThreshold   = 90.0 // Threshold percentage for unhealthy status
+)
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notifyTimeout bounds how long a notification helper process may run
+const notifyTimeout = 30 * time.Second
+
+// QuietHours is a daily window, in minutes since midnight local time, during
+// which desktop notifications are held back. Start == End disables it.
+type QuietHours struct {
+	Start, End int
+}
+
+// ParseQuietHours parses "HH:MM-HH:MM"; the window may wrap past midnight
+// (e.g. "22:00-07:00"). An empty string means no quiet hours.
+func ParseQuietHours(s string) (QuietHours, error) {
+	if s == "" {
+		return QuietHours{}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours %q: expected HH:MM-HH:MM", s)
+	}
+
+	var q QuietHours
+	var err error
+	if q.Start, err = parseClock(from); err != nil {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours %q: %w", s, err)
+	}
+	if q.End, err = parseClock(to); err != nil {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours %q: %w", s, err)
+	}
+	return q, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls inside the quiet window
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.Start == q.End {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if q.Start < q.End {
+		return minute >= q.Start && minute < q.End
+	}
+	return minute >= q.Start || minute < q.End
+}
+
+// Notifier tells the logged-in user when the device becomes UNHEALTHY. One
+// notification is sent per unhealthy episode; a transition during quiet
+// hours is delivered once they end if the device is still unhealthy.
+type Notifier struct {
+	quiet QuietHours
+	send  func(title, body string) error
+
+	mu       sync.Mutex
+	notified bool // the current unhealthy episode has been announced
+	now      func() time.Time
+	log      *slog.Logger
+}
+
+// NewNotifier creates a Notifier using the platform's native notifications
+func NewNotifier(quiet QuietHours, logger *slog.Logger) *Notifier {
+	return &Notifier{quiet: quiet, send: sendDesktopNotification, now: time.Now, log: logger}
+}
+
+// Observe checks a freshly evaluated status and notifies on a transition
+// into UNHEALTHY
+func (n *Notifier) Observe(status *DeviceStatus) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if status.Status != StatusUnhealthy {
+		n.notified = false
+		return
+	}
+	if n.notified {
+		return
+	}
+	if n.quiet.Contains(n.now()) {
+		n.log.Debug("device unhealthy; notification held for quiet hours")
+		return
+	}
+
+	n.notified = true
+	title, body := notificationText(status)
+	go func() {
+		if err := n.send(title, body); err != nil {
+			n.log.Warn("desktop notification failed", "error", err)
+		}
+	}()
+}
+
+// notificationText summarises the failing checks and what to do about them
+func notificationText(status *DeviceStatus) (string, string) {
+	title := fmt.Sprintf("Device posture: %s (score %d)", status.Status, status.Score)
+
+	var lines []string
+	for _, result := range status.Checks {
+		if result.Passed {
+			continue
+		}
+		line := "• " + result.Message
+		if result.Remediation != "" {
+			line += " → " + result.Remediation
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, status.Message)
+	}
+	return title, strings.Join(lines, "\n")
+}
+
+// sendDesktopNotification shows a native notification on macOS, Windows or
+// Linux. The text is passed through the environment so it never needs
+// quoting for a script interpreter.
+func sendDesktopNotification(title, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript",
+			"-e", `display notification (system attribute "POSTURE_NOTIFY_BODY") with title (system attribute "POSTURE_NOTIFY_TITLE") sound name "Basso"`)
+	case "windows":
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsNotifyScript)
+	case "linux":
+		cmd = exec.CommandContext(ctx, "notify-send", "--urgency=critical", "--app-name="+serviceDisplayName, title, body)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+
+	cmd.Env = append(os.Environ(), "POSTURE_NOTIFY_TITLE="+title, "POSTURE_NOTIFY_BODY="+body)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// windowsNotifyScript shows a tray balloon, which Windows 10+ renders as a toast
+const windowsNotifyScript = `
+Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$icon = New-Object System.Windows.Forms.NotifyIcon
+$icon.Icon = [System.Drawing.SystemIcons]::Warning
+$icon.Visible = $true
+$icon.ShowBalloonTip(10000, $env:POSTURE_NOTIFY_TITLE, $env:POSTURE_NOTIFY_BODY, [System.Windows.Forms.ToolTipIcon]::Warning)
+Start-Sleep -Seconds 10
+$icon.Dispose()
+`
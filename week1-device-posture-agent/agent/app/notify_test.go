@@ -0,0 +1,81 @@
+package app
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestQuietHours(t *testing.T) {
+	at := func(hhmm string) time.Time {
+		ts, _ := time.Parse("15:04", hhmm)
+		return ts
+	}
+
+	overnight, err := ParseQuietHours("22:00-07:00")
+	if err != nil {
+		t.Fatalf("ParseQuietHours error: %v", err)
+	}
+	daytime, err := ParseQuietHours("12:00-13:30")
+	if err != nil {
+		t.Fatalf("ParseQuietHours error: %v", err)
+	}
+
+	tests := []struct {
+		quiet QuietHours
+		at    string
+		want  bool
+	}{
+		{overnight, "23:15", true},
+		{overnight, "03:00", true},
+		{overnight, "07:00", false},
+		{overnight, "21:59", false},
+		{daytime, "12:00", true},
+		{daytime, "13:29", true},
+		{daytime, "13:30", false},
+		{QuietHours{}, "03:00", false},
+	}
+	for _, tt := range tests {
+		if got := tt.quiet.Contains(at(tt.at)); got != tt.want {
+			t.Errorf("%+v.Contains(%s) = %v; want %v", tt.quiet, tt.at, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"22:00", "25:00-07:00", "22:00-7pm"} {
+		if _, err := ParseQuietHours(bad); err == nil {
+			t.Errorf("ParseQuietHours(%q) expected error", bad)
+		}
+	}
+}
+
+func TestNotifierOncePerEpisode(t *testing.T) {
+	sent := make(chan string, 10)
+	clock := time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	n := &Notifier{
+		quiet: QuietHours{Start: 22 * 60, End: 7 * 60},
+		send:  func(title, body string) error { sent <- title; return nil },
+		now:   func() time.Time { return clock },
+		log:   slog.Default(),
+	}
+	unhealthy := &DeviceStatus{Status: StatusUnhealthy, Checks: []CheckResult{{Name: "disk_usage", Message: "Disk usage at 95%"}}}
+
+	n.Observe(unhealthy) // quiet hours: held
+	clock = clock.Add(9 * time.Hour)
+	n.Observe(unhealthy) // delivered once quiet hours end
+	n.Observe(unhealthy) // same episode: no repeat
+	n.Observe(&DeviceStatus{Status: StatusHealthy})
+	n.Observe(unhealthy) // new episode
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sent:
+		case <-time.After(time.Second):
+			t.Fatalf("got %d notifications; want 2", i)
+		}
+	}
+	select {
+	case title := <-sent:
+		t.Errorf("unexpected extra notification %q", title)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/httpclient"
+	"github.com/nisatyap/shared/posture"
+)
+
+// Policy describes the thresholds a device must satisfy. It can be loaded
+// from a local JSON file or fetched from a URL.
+//
+//	{
+//	  "healthy_score": 80,
+//	  "unhealthy_score": 50,
+//	  "checks": [
+//	    {"name": "disk_usage",   "weight": 50, "warn": 80, "critical": 90},
+//	    {"name": "memory_usage", "weight": 30, "critical": 95}
+//	  ],
+//	  "rules": [
+//	    {"name": "baseline", "fail_if": "!firewall.enabled || os.version < \"22.04\"", "weight": 40}
+//	  ]
+//	}
+type Policy struct {
+	HealthyScore   float64       `json:"healthy_score,omitempty"`
+	UnhealthyScore float64       `json:"unhealthy_score,omitempty"`
+	Checks         []PolicyCheck `json:"checks"`
+	Rules          []PolicyRule  `json:"rules,omitempty"`
+}
+
+// PolicyCheck sets the weight and thresholds for one metric check
+type PolicyCheck struct {
+	Name     string  `json:"name"`
+	Weight   float64 `json:"weight,omitempty"`
+	Warn     float64 `json:"warn,omitempty"`
+	Critical float64 `json:"critical,omitempty"`
+}
+
+// PolicyRule is a custom check written as an expression over the collected
+// data, in the shared posture package's rule language. The device fails the rule when FailIf is true.
+type PolicyRule struct {
+	Name        string  `json:"name"`
+	FailIf      string  `json:"fail_if"`
+	Severity    string  `json:"severity,omitempty"` // warning or critical (default)
+	Weight      float64 `json:"weight,omitempty"`
+	Message     string  `json:"message,omitempty"`
+	Remediation string  `json:"remediation,omitempty"`
+
+	expr posture.Expr // compiled by Validate
+}
+
+// LoadPolicy reads a policy from a file path or an http(s) URL
+func LoadPolicy(source string) (*Policy, error) {
+	var data []byte
+	var err error
+
+	if isURL(source) {
+		data, err = fetchURL(source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// isURL reports whether a policy or manifest source is remote
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// fetchURL downloads a policy or manifest document, retrying while the
+// server is unreachable or overloaded
+func fetchURL(url string) ([]byte, error) {
+	client, _ := httpclient.New(httpclient.Options{
+		Timeout:   10 * time.Second,
+		Attempts:  3,
+		UserAgent: "DevicePostureAgent/" + version,
+	})
+	resp, err := client.Get(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Validate rejects unknown checks and inconsistent thresholds
+func (p *Policy) Validate() error {
+	if len(p.Checks) == 0 && len(p.Rules) == 0 {
+		return fmt.Errorf("policy defines no checks or rules")
+	}
+	for _, pc := range p.Checks {
+		if _, ok := metricFuncs[pc.Name]; !ok {
+			return fmt.Errorf("policy references unknown check %q", pc.Name)
+		}
+		if pc.Warn == 0 && pc.Critical == 0 {
+			return fmt.Errorf("check %q needs a warn or critical threshold", pc.Name)
+		}
+		if pc.Warn > 0 && pc.Critical > 0 && pc.Warn >= pc.Critical {
+			return fmt.Errorf("check %q: warn (%.0f) must be below critical (%.0f)", pc.Name, pc.Warn, pc.Critical)
+		}
+		if pc.Weight < 0 || pc.Weight > 100 {
+			return fmt.Errorf("check %q: weight must be between 0 and 100", pc.Name)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, pc := range p.Checks {
+		names[pc.Name] = true
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d needs a name", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q: name already used by another check or rule", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Severity != "" && rule.Severity != SeverityWarning && rule.Severity != SeverityCritical {
+			return fmt.Errorf("rule %q: severity must be %q or %q", rule.Name, SeverityWarning, SeverityCritical)
+		}
+		if rule.Weight < 0 || rule.Weight > 100 {
+			return fmt.Errorf("rule %q: weight must be between 0 and 100", rule.Name)
+		}
+		expr, err := posture.CompileExpr(rule.FailIf, posture.Variables)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		rule.expr = expr
+	}
+
+	model := p.ScoringModel()
+	if model.UnhealthyScore >= model.HealthyScore {
+		return fmt.Errorf("unhealthy_score (%.0f) must be below healthy_score (%.0f)", model.UnhealthyScore, model.HealthyScore)
+	}
+	return nil
+}
+
+// ScoringModel returns the policy's score cut-offs, falling back to defaults
+func (p *Policy) ScoringModel() ScoringModel {
+	model := DefaultScoringModel()
+	if p.HealthyScore > 0 {
+		model.HealthyScore = p.HealthyScore
+	}
+	if p.UnhealthyScore > 0 {
+		model.UnhealthyScore = p.UnhealthyScore
+	}
+	return model
+}
+
+// BuildChecks turns the policy into executable checks. The policy must have
+// passed Validate, which compiles the rule expressions.
+func (p *Policy) BuildChecks() []Check {
+	checks := make([]Check, 0, len(p.Checks))
+	for _, pc := range p.Checks {
+		weight := pc.Weight
+		if weight == 0 {
+			weight = posture.DefaultCheckWeights[pc.Name]
+		}
+		checks = append(checks, ThresholdCheck(pc.Name, posture.CheckLabels[pc.Name], metricFuncs[pc.Name], weight, pc.Warn, pc.Critical))
+	}
+	for _, rule := range p.Rules {
+		severity, weight := rule.Severity, rule.Weight
+		if severity == "" {
+			severity = SeverityCritical
+		}
+		if weight == 0 {
+			weight = posture.DefaultRuleWeight
+		}
+		check := RuleCheck(rule.Name, rule.FailIf, rule.expr, severity, weight, rule.Message)
+		check.Remediation = rule.Remediation
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkRemediations are shown to the user when a built-in check fails
+var checkRemediations = map[string]string{
+	"disk_usage":   "Free up disk space by removing unused files or applications",
+	"cpu_usage":    "Close CPU-heavy applications or restart the device",
+	"memory_usage": "Close unused applications to free memory",
+}
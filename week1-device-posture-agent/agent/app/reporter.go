@@ -0,0 +1,362 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/httpclient"
+	"github.com/nisatyap/shared/secrets"
+)
+
+// Reporter handles sending device status to the collector API
+type Reporter struct {
+	collectorURL  string
+	apiKeyFile    string // re-read on every report so a rotated key is picked up
+	client        *httpclient.Client
+	schemaVersion int // 0 once the collector has rejected reportSchemaVersion
+
+	// features turns delta reports on with the delta-reports flag; nil
+	// leaves them off
+	features *flags.Set
+	// last holds the sections of the last report the collector accepted,
+	// which a delta report leaves out while they are unchanged; nil until
+	// one is accepted, and after a report fails
+	last *reportSections
+	// noDelta is set once the collector turns out not to know delta
+	// reports
+	noDelta bool
+
+	// OnAttempt, when set, is called after every attempt at a request,
+	// for metrics
+	OnAttempt func(httpclient.Attempt)
+
+	log *slog.Logger
+}
+
+// NewReporter creates a new Reporter instance. apiKeyFile holds the device
+// API key issued at enrollment; when empty, $POSTURE_API_KEY is used, which
+// may be a secret reference such as keychain:posture-agent/api-key.
+func NewReporter(collectorURL, apiKeyFile string, logger *slog.Logger) *Reporter {
+	r := &Reporter{
+		collectorURL:  collectorURL,
+		apiKeyFile:    apiKeyFile,
+		schemaVersion: reportSchemaVersion,
+		log:           logger,
+	}
+	r.client, _ = httpclient.New(r.clientOptions()) // fails only for a bad proxy URL
+	return r
+}
+
+// clientOptions configure the reporter's HTTP client: retries back off
+// from 2s, or wait as long as a rate-limiting collector asks
+func (r *Reporter) clientOptions() httpclient.Options {
+	return httpclient.Options{
+		Timeout:   10 * time.Second,
+		Backoff:   httpclient.Backoff{Base: 2 * time.Second, Max: time.Minute, Jitter: 0.2},
+		UserAgent: "DevicePostureAgent/" + version,
+		OnAttempt: r.observeAttempt,
+	}
+}
+
+// observeAttempt logs the attempts that will be retried
+func (r *Reporter) observeAttempt(a httpclient.Attempt) {
+	if r.OnAttempt != nil {
+		r.OnAttempt(a)
+	}
+	if a.Retry == 0 {
+		return
+	}
+	err := a.Err
+	if err == nil {
+		err = fmt.Errorf("collector API returned status %d", a.StatusCode)
+	}
+	r.log.Warn("failed to send report", "attempt", a.Number, "retry_in", a.Retry, "error", err)
+}
+
+// UseTLS makes the reporter verify the collector and present the device
+// certificate as files configures
+func (r *Reporter) UseTLS(files ClientTLS) error {
+	client, err := files.httpClient(r.clientOptions())
+	if err != nil {
+		return err
+	}
+	r.client = client
+	return nil
+}
+
+// SendReport sends device status to the collector API. If the collector
+// rejects the schema version, the report is resent in the unversioned
+// legacy format, which every collector accepts, and later reports keep
+// using it.
+func (r *Reporter) SendReport(status *DeviceStatus) error {
+	return r.sendReport(r.client, status, newIdempotencyKey())
+}
+
+// sendReport sends one report with client under the given idempotency key,
+// so the collector stores it once however often it is resent. A delta
+// report the collector can't fill in is resent in full.
+func (r *Reporter) sendReport(client *httpclient.Client, status *DeviceStatus, key string) error {
+	err := r.send(client, status, r.unchanged(status), key)
+	var rejected *schemaRejectedError
+	if errors.As(err, &rejected) && r.schemaVersion != 0 {
+		r.log.Warn("collector does not accept this report schema, falling back to the legacy format",
+			"schema_version", r.schemaVersion, "collector", rejected.message)
+		r.schemaVersion = 0
+		err = r.send(client, status, nil, key)
+	}
+	var delta *deltaRejectedError
+	if errors.As(err, &delta) {
+		if delta.unsupported {
+			r.log.Warn("collector does not accept delta reports, sending full reports", "collector", delta.message)
+			r.noDelta = true
+		} else {
+			r.log.Info("collector could not fill in the delta report, sending it in full", "collector", delta.message)
+		}
+		err = r.send(client, status, nil, key)
+	}
+	r.last = nil
+	if err == nil {
+		r.last = &reportSections{OS: status.OS, Checks: status.Checks}
+	}
+	return err
+}
+
+// Report sections a delta report may leave out, as the collector names
+// them
+const (
+	sectionOS     = "os"
+	sectionChecks = "checks"
+)
+
+// reportSections are the parts of a report a delta report may leave out
+type reportSections struct {
+	OS     OSInfo
+	Checks []CheckResult
+}
+
+// unchanged returns the sections of status that are the same as in the
+// last report the collector accepted, for a delta report to leave out.
+// There are none unless the delta-reports flag is on for the device.
+func (r *Reporter) unchanged(status *DeviceStatus) []string {
+	// Collectors only fill in versioned reports: one that predates delta
+	// reports would store a legacy report with the sections missing
+	if r.last == nil || r.noDelta || r.schemaVersion < 2 || !r.features.Enabled(flags.DeltaReports) {
+		return nil
+	}
+	var sections []string
+	if status.OS == r.last.OS {
+		sections = append(sections, sectionOS)
+	}
+	if slices.Equal(status.Checks, r.last.Checks) {
+		sections = append(sections, sectionChecks)
+	}
+	return sections
+}
+
+// deltaReport is a report without the sections named in Unchanged, which
+// the collector takes from the device's previous report. Its fields hide
+// those of the same name in DeviceStatus.
+type deltaReport struct {
+	*DeviceStatus
+	OS        *OSInfo       `json:"os,omitempty"`
+	Checks    []CheckResult `json:"checks,omitempty"`
+	Unchanged []string      `json:"unchanged"`
+}
+
+// newDeltaReport leaves the unchanged sections out of status
+func newDeltaReport(status *DeviceStatus, unchanged []string) deltaReport {
+	delta := deltaReport{DeviceStatus: status, OS: &status.OS, Checks: status.Checks, Unchanged: unchanged}
+	for _, section := range unchanged {
+		switch section {
+		case sectionOS:
+			delta.OS = nil
+		case sectionChecks:
+			delta.Checks = nil
+		}
+	}
+	return delta
+}
+
+// newIdempotencyKey returns a random key identifying one report
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// schemaRejectedError is a 422 naming the schema_version field
+type schemaRejectedError struct {
+	message string
+}
+
+func (e *schemaRejectedError) Error() string {
+	return "collector rejected schema_version: " + e.message
+}
+
+// rateLimitedError is a 429; the collector asks us to wait retryAfter
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("collector is rate limiting reports (retry after %s)", e.retryAfter)
+}
+
+// deltaRejectedError is a collector's refusal of a delta report: a 409
+// when it holds no previous report to fill it in from, or a 422 naming
+// the unchanged field
+type deltaRejectedError struct {
+	message     string
+	unsupported bool // the collector doesn't know delta reports at all
+}
+
+func (e *deltaRejectedError) Error() string {
+	return "collector rejected the delta report: " + e.message
+}
+
+// send sends status once, leaving out the sections named in unchanged
+func (r *Reporter) send(client *httpclient.Client, status *DeviceStatus, unchanged []string, idempotencyKey string) error {
+	status.SchemaVersion = r.schemaVersion
+
+	// Marshal the status to JSON
+	var payload any = status
+	if len(unchanged) > 0 {
+		payload = newDeltaReport(status, unchanged)
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device status: %w", err)
+	}
+
+	// Create HTTP POST request
+	req, err := http.NewRequest("POST", r.collectorURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	// Collectors that predate idempotency keys ignore the header
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	apiKey, err := r.apiKey()
+	if err != nil {
+		return err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	// Signed with the key registered at enrollment, so the collector can
+	// tell that the body is the one the device sent
+	signer, err := r.signer()
+	if err != nil {
+		return err
+	}
+	if signer != nil {
+		cryptoutil.SetSignature(req.Header, "Report", signer.ID(), signer.Sign(jsonData))
+	}
+
+	// Send the request; it is retried, with the idempotency key, after
+	// network errors and responses asking to try again later
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Check response status
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("collector rejected the device API key (missing, revoked or expired; re-enroll the device): %s", string(body))
+	case http.StatusForbidden:
+		return fmt.Errorf("collector refused the report: %s", string(body))
+	case http.StatusTooManyRequests:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &rateLimitedError{retryAfter: time.Duration(seconds) * time.Second}
+	case http.StatusConflict:
+		if len(unchanged) > 0 {
+			return &deltaRejectedError{message: string(body)}
+		}
+	}
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		var rejection struct {
+			Details []struct {
+				Field   string `json:"field"`
+				Message string `json:"message"`
+			} `json:"details"`
+		}
+		json.Unmarshal(body, &rejection)
+		for _, d := range rejection.Details {
+			switch {
+			case d.Field == "schema_version":
+				return &schemaRejectedError{message: d.Message}
+			case strings.HasPrefix(d.Field, "unchanged") && len(unchanged) > 0:
+				// A collector that predates delta reports names the field
+				// itself; one that knows them names the entry it can't take
+				return &deltaRejectedError{message: d.Field + ": " + d.Message, unsupported: d.Field == "unchanged"}
+			}
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	r.log.Info("report sent", "response", string(body))
+	return nil
+}
+
+// apiKey returns the current device API key, if one is configured
+func (r *Reporter) apiKey() (string, error) {
+	if r.apiKeyFile == "" {
+		// Resolved on every report too, so a key rotated in its store is
+		// picked up
+		return secrets.Resolve(context.Background(), strings.TrimSpace(os.Getenv("POSTURE_API_KEY")))
+	}
+	data, err := os.ReadFile(r.apiKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// signer returns the key the device registered at enrollment to sign its
+// reports with; nil if it has none, such as when it enrolled before
+// reports were signed
+func (r *Reporter) signer() (*cryptoutil.Signer, error) {
+	if r.apiKeyFile == "" {
+		return nil, nil
+	}
+	path := signingKeyFile(r.apiKeyFile)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	s, _, err := cryptoutil.LoadOrCreateSigner(path, "signing key")
+	return s, err
+}
+
+// SendReportWithRetry sends the report, making up to maxAttempts attempts.
+// Every attempt carries the same idempotency key, so a report whose
+// response was lost isn't stored twice.
+func (r *Reporter) SendReportWithRetry(status *DeviceStatus, maxAttempts int) error {
+	return r.sendReport(r.client.WithAttempts(maxAttempts), status, newIdempotencyKey())
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"errors"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/flags"
+)
+
+func TestReporterFallsBackToLegacySchema(t *testing.T) {
+	var versions []int
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		v, _ := body["schema_version"].(float64)
+		versions = append(versions, int(v))
+		if v > 1 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error":"invalid report","details":[{"field":"schema_version","message":"unsupported version 2"}]}`))
+			return
+		}
+		w.Write([]byte(`{"accepted":true}`))
+	}))
+	defer srv.Close()
+
+	r := NewReporter(srv.URL, "", slog.Default())
+	for i := 0; i < 2; i++ {
+		if err := r.SendReport(&DeviceStatus{Hostname: "laptop-1"}); err != nil {
+			t.Fatalf("SendReport: %v", err)
+		}
+	}
+	// One rejected versioned report, then legacy reports only
+	if len(versions) != 3 || versions[0] != reportSchemaVersion || versions[1] != 0 || versions[2] != 0 {
+		t.Errorf("schema versions sent = %v", versions)
+	}
+	// The resent report keeps its idempotency key; the next report gets its own
+	if keys[0] == "" || keys[1] != keys[0] || keys[2] == keys[0] {
+		t.Errorf("idempotency keys sent = %q", keys)
+	}
+}
+
+func TestReporterRereadsAPIKey(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"accepted":true}`))
+	}))
+	defer srv.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "api-key")
+	os.WriteFile(keyFile, []byte("dpk_old\n"), 0600)
+	r := NewReporter(srv.URL, keyFile, slog.Default())
+	r.SendReport(&DeviceStatus{Hostname: "laptop-1"})
+	os.WriteFile(keyFile, []byte("dpk_new\n"), 0600)
+	r.SendReport(&DeviceStatus{Hostname: "laptop-1"})
+
+	if len(got) != 2 || got[0] != "Bearer dpk_old" || got[1] != "Bearer dpk_new" {
+		t.Errorf("Authorization headers = %q", got)
+	}
+
+	// $POSTURE_API_KEY may refer to the key rather than hold it
+	t.Setenv("POSTURE_API_KEY", "file:"+keyFile)
+	NewReporter(srv.URL, "", slog.Default()).SendReport(&DeviceStatus{Hostname: "laptop-1"})
+	if len(got) != 3 || got[2] != "Bearer dpk_new" {
+		t.Errorf("Authorization headers = %q", got)
+	}
+}
+
+func TestReporterSignsReports(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "api-key")
+	os.WriteFile(keyFile, []byte("dpk_secret\n"), 0600)
+	signer, _, err := cryptoutil.LoadOrCreateSigner(signingKeyFile(keyFile), "signing key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: signer.PublicKey()})
+
+	var verified error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		keyID, sig, err := cryptoutil.Signature(r.Header, "Report")
+		if err == nil {
+			err = ring.Verify(keyID, body, sig)
+		}
+		verified = err
+		w.Write([]byte(`{"accepted":true}`))
+	}))
+	defer srv.Close()
+
+	if err := NewReporter(srv.URL, keyFile, slog.Default()).SendReport(&DeviceStatus{Hostname: "laptop-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if verified != nil {
+		t.Errorf("report signature: %v", verified)
+	}
+
+	// A device enrolled before reports were signed sends them unsigned
+	os.Remove(signingKeyFile(keyFile))
+	if err := NewReporter(srv.URL, keyFile, slog.Default()).SendReport(&DeviceStatus{Hostname: "laptop-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(verified, cryptoutil.ErrUnsigned) {
+		t.Errorf("report without a signing key: %v", verified)
+	}
+}
+
+func TestReporterSendsDeltaReports(t *testing.T) {
+	var bodies []map[string]any
+	var keys []string
+	conflict := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if _, delta := body["unchanged"]; delta && conflict {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error":"no previous report to fill in the unchanged sections from"}`))
+			return
+		}
+		w.Write([]byte(`{"accepted":true}`))
+	}))
+	defer srv.Close()
+
+	r := NewReporter(srv.URL, "", slog.Default())
+	r.features = flags.New("laptop-1", agentFlags...)
+	r.features.Configure("delta-reports")
+	status := &DeviceStatus{
+		Hostname: "laptop-1",
+		OS:       OSInfo{Name: "linux", Arch: "amd64"},
+		Checks:   []CheckResult{{Name: "disk_usage", Passed: true}},
+	}
+	unchanged := func(i int) any {
+		return bodies[i]["unchanged"]
+	}
+
+	r.SendReport(status)
+	r.SendReport(status)
+	if unchanged(0) != nil || bodies[0]["os"] == nil {
+		t.Errorf("first report = %v, want it in full", bodies[0])
+	}
+	if !reflect.DeepEqual(unchanged(1), []any{"os", "checks"}) || bodies[1]["os"] != nil || bodies[1]["checks"] != nil {
+		t.Errorf("unchanged report = %v, want os and checks left out", bodies[1])
+	}
+
+	status.Checks = []CheckResult{{Name: "disk_usage", Passed: false, Severity: SeverityCritical}}
+	r.SendReport(status)
+	if !reflect.DeepEqual(unchanged(2), []any{"os"}) || bodies[2]["checks"] == nil {
+		t.Errorf("report with new checks = %v", bodies[2])
+	}
+
+	// A collector without the previous report gets the report in full,
+	// under the same idempotency key
+	conflict = true
+	if err := r.SendReport(status); err != nil {
+		t.Fatalf("SendReport: %v", err)
+	}
+	if len(bodies) != 5 || unchanged(3) == nil || unchanged(4) != nil || keys[4] != keys[3] {
+		t.Errorf("after a conflict sent %v", bodies[3:])
+	}
+
+	r.features.Configure("delta-reports=off")
+	r.SendReport(status)
+	if unchanged(5) != nil {
+		t.Errorf("report with the flag off = %v", bodies[5])
+	}
+}
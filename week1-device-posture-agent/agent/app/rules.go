@@ -0,0 +1,20 @@
+package app
+
+import "github.com/nisatyap/shared/posture"
+
+// ruleEnv exposes the collected status to rule expressions, written in the
+// shared posture package's language. Facts the agent couldn't collect are
+// left out, so rules using them fail to evaluate.
+func ruleEnv(status *DeviceStatus) map[string]any {
+	return posture.Facts{
+		Hostname:    status.Hostname,
+		IP:          status.IP,
+		DiskUsage:   status.DiskUsage,
+		CPUUsage:    status.CPUUsage,
+		MemoryUsage: status.MemoryUsage,
+		OSName:      status.OS.Name,
+		OSVersion:   status.OS.Version,
+		OSArch:      status.OS.Arch,
+		Firewall:    status.Firewall,
+	}.Env()
+}
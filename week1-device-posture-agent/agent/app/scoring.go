@@ -0,0 +1,13 @@
+package app
+
+import "github.com/nisatyap/shared/posture"
+
+// ScoringModel turns weighted check results into a 0–100 health score
+// and a status, the same way the collector scores reports
+type ScoringModel = posture.Model
+
+// DefaultScoringModel keeps the original behaviour: a critical disk failure
+// (weight 50) on its own makes the device UNHEALTHY.
+func DefaultScoringModel() ScoringModel {
+	return posture.DefaultModel()
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyChecks(t *testing.T) {
+	strict := DefaultScoringModel()
+	strict.HealthyScore = 95
+	panicking := Check{Name: "flaky", Weight: 40, Evaluate: func(*DeviceStatus) CheckResult { panic("no data") }}
+
+	tests := []struct {
+		name        string
+		disk, mem   float64
+		cpu         float64
+		checks      []Check
+		model       ScoringModel
+		wantScore   int
+		wantStatus  string
+		wantFailing []string
+		wantMessage string
+	}{
+		{
+			name: "all checks pass", disk: 50, mem: 50, cpu: 10,
+			wantScore: 100, wantStatus: StatusHealthy,
+			wantMessage: "All systems operational",
+		},
+		{
+			name: "a warning costs half the weight", disk: 50, mem: 50, cpu: 95,
+			wantScore: 90, wantStatus: StatusHealthy, wantFailing: []string{"cpu_usage"},
+			wantMessage: "Warning: CPU usage at 95.00% (warning threshold: 90%)",
+		},
+		{
+			name: "warnings add up", disk: 50, mem: 92, cpu: 95,
+			wantScore: 75, wantStatus: StatusDegraded, wantFailing: []string{"memory_usage", "cpu_usage"},
+			wantMessage: "Warning: Memory usage at 92.00% (warning threshold: 90%)",
+		},
+		{
+			name: "a critical disk alone is unhealthy", disk: 95, mem: 50, cpu: 10,
+			wantScore: 50, wantStatus: StatusUnhealthy, wantFailing: []string{"disk_usage"},
+			wantMessage: "Critical: Disk usage at 95.00% (threshold: 90%)",
+		},
+		{
+			name: "critical outranks warnings in the message", disk: 50, mem: 99, cpu: 95,
+			wantScore: 60, wantStatus: StatusDegraded, wantFailing: []string{"memory_usage", "cpu_usage"},
+			wantMessage: "Critical: Memory usage at 99.00% (threshold: 98%)",
+		},
+		{
+			name: "score never drops below zero", disk: 95, mem: 99, cpu: 95,
+			checks:    append(DefaultChecks(), ThresholdCheck("disk_again", "Disk usage", diskUsageMetric, 50, 0, 90)),
+			wantScore: 0, wantStatus: StatusUnhealthy, wantFailing: []string{"disk_usage", "memory_usage", "cpu_usage", "disk_again"},
+			wantMessage: "Critical: Disk usage at 95.00% (threshold: 90%)",
+		},
+		{
+			name: "policy cut-offs", disk: 50, mem: 50, cpu: 95, model: strict,
+			wantScore: 90, wantStatus: StatusDegraded, wantFailing: []string{"cpu_usage"},
+			wantMessage: "Warning: CPU usage at 95.00% (warning threshold: 90%)",
+		},
+		{
+			name: "a panicking check is a warning", disk: 50, mem: 50, cpu: 10,
+			checks:    append(DefaultChecks(), panicking),
+			wantScore: 80, wantStatus: StatusHealthy, wantFailing: []string{"flaky"},
+			wantMessage: "Warning: check panicked: no data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks, model := tt.checks, tt.model
+			if checks == nil {
+				checks = DefaultChecks()
+			}
+			if model == (ScoringModel{}) {
+				model = DefaultScoringModel()
+			}
+			status := &DeviceStatus{DiskUsage: tt.disk, MemoryUsage: tt.mem, CPUUsage: tt.cpu}
+			ApplyChecks(status, checks, model)
+
+			if status.Score != tt.wantScore || status.Status != tt.wantStatus {
+				t.Errorf("score %d, %s; want %d, %s", status.Score, status.Status, tt.wantScore, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(status.FailingChecks, tt.wantFailing) {
+				t.Errorf("failing checks = %q, want %q", status.FailingChecks, tt.wantFailing)
+			}
+			if status.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", status.Message, tt.wantMessage)
+			}
+			if status.Severity != model.Severity(status.Score) {
+				t.Errorf("severity = %q, want %q", status.Severity, model.Severity(status.Score))
+			}
+		})
+	}
+}
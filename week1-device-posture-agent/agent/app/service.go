@@ -0,0 +1,115 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultServiceName        = "device-posture-agent"
+	serviceDisplayName        = "Device Posture Agent"
+	serviceDescription        = "Collects device health and reports it to the posture collector"
+	serviceRestartDelaySecond = 5
+)
+
+// invocation is the arguments the binary needs before the agent's own
+// commands: none for the agent, "agent" for the unified swg binary
+var invocation []string
+
+// ServiceConfig describes how the agent is registered with the OS service manager
+type ServiceConfig struct {
+	Name       string
+	ExecPath   string
+	Args       []string
+	WorkingDir string
+}
+
+// serviceFlags are the install-service flags that aren't "run" flags
+var serviceFlags = map[string]bool{"name": true, "enrollment-token": true}
+
+// servicePathFlags hold local paths, which are made absolute since the
+// service starts in its own working directory. Sources may also be URLs.
+var servicePathFlags = map[string]func(string) (string, error){
+	"api-key-file":       filepath.Abs,
+	"log-file":           filepath.Abs,
+	"inventory-state":    filepath.Abs,
+	"posture-token-file": filepath.Abs,
+	"tls-cert":           filepath.Abs,
+	"tls-key":            filepath.Abs,
+	"ca-file":            filepath.Abs,
+	"policy":             absSource,
+	"manifest":           absSource,
+	"watch-files":        absList,
+}
+
+// newServiceConfig resolves the running binary and builds the "run" arguments
+// the service manager will launch the agent with: every "run" flag set on
+// install-service, plus the service definition to watch for tampering
+func newServiceConfig(name string, fs *flag.FlagSet) (*ServiceConfig, error) {
+	execPath, err := executablePath()
+	if err != nil {
+		return nil, err
+	}
+
+	args := append(append([]string(nil), invocation...), "run")
+	watch := serviceFilePath(name)
+	var errs []error
+	fs.Visit(func(f *flag.Flag) {
+		if serviceFlags[f.Name] {
+			return
+		}
+		value := f.Value.String()
+		if f.Name == "watch-files" && watch != "" {
+			value = strings.TrimPrefix(value+","+watch, ",")
+			watch = ""
+		}
+		if resolve := servicePathFlags[f.Name]; resolve != nil && value != "" {
+			if value, err = resolve(value); err != nil {
+				errs = append(errs, fmt.Errorf("failed to resolve -%s path: %w", f.Name, err))
+				return
+			}
+		}
+		// -flag=value keeps boolean flags and empty values intact
+		args = append(args, "-"+f.Name+"="+value)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if watch != "" {
+		args = append(args, "-watch-files="+watch)
+	}
+
+	return &ServiceConfig{
+		Name:       name,
+		ExecPath:   execPath,
+		Args:       args,
+		WorkingDir: filepath.Dir(execPath),
+	}, nil
+}
+
+// absSource makes a local file path absolute and leaves URLs alone
+func absSource(source string) (string, error) {
+	if isURL(source) {
+		return source, nil
+	}
+	return filepath.Abs(source)
+}
+
+// absList makes each path in a comma-separated list absolute
+func absList(list string) (string, error) {
+	var paths []string
+	for _, path := range strings.Split(list, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		paths = append(paths, abs)
+	}
+	return strings.Join(paths, ","), nil
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const launchdDaemonDir = "/Library/LaunchDaemons"
+
+// launchdLabel turns a service name into a reverse-DNS launchd label
+func launchdLabel(name string) string {
+	return "com.cisco." + name
+}
+
+// serviceFilePath is the launchd plist installed for the service
+func serviceFilePath(name string) string {
+	return filepath.Join(launchdDaemonDir, launchdLabel(name)+".plist")
+}
+
+// installSystemService writes a launchd daemon plist that keeps the agent
+// alive, then loads it
+func installSystemService(svc *ServiceConfig) error {
+	plistPath := serviceFilePath(svc.Name)
+	if _, err := os.Stat(plistPath); err == nil {
+		return fmt.Errorf("plist %s already exists; run uninstall-service first", plistPath)
+	}
+
+	if err := os.WriteFile(plistPath, []byte(launchdPlist(svc)), 0644); err != nil {
+		return fmt.Errorf("failed to write plist: %w", err)
+	}
+	return runServiceCommand("launchctl", "load", "-w", plistPath)
+}
+
+// launchdPlist renders the daemon plist for the service
+func launchdPlist(svc *ServiceConfig) string {
+	var args strings.Builder
+	for _, arg := range append([]string{svc.ExecPath}, svc.Args...) {
+		args.WriteString("\t\t<string>" + xmlEscape(arg) + "</string>\n")
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>ThrottleInterval</key>
+	<integer>%d</integer>
+	<key>StandardOutPath</key>
+	<string>/var/log/%s.log</string>
+	<key>StandardErrorPath</key>
+	<string>/var/log/%s.log</string>
+</dict>
+</plist>
+`, xmlEscape(launchdLabel(svc.Name)), args.String(), xmlEscape(svc.WorkingDir), serviceRestartDelaySecond, xmlEscape(svc.Name), xmlEscape(svc.Name))
+}
+
+// uninstallSystemService unloads and removes the launchd daemon
+func uninstallSystemService(name string) error {
+	plistPath := serviceFilePath(name)
+	if _, err := os.Stat(plistPath); err != nil {
+		return fmt.Errorf("plist %s not found", plistPath)
+	}
+
+	if err := runServiceCommand("launchctl", "unload", "-w", plistPath); err != nil {
+		return err
+	}
+	if err := os.Remove(plistPath); err != nil {
+		return fmt.Errorf("failed to remove plist: %w", err)
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// runServiceCommand runs a service manager command, surfacing its output on failure
+func runServiceCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
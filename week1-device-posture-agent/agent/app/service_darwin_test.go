@@ -0,0 +1,59 @@
+package app
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLaunchdPlist(t *testing.T) {
+	svc := &ServiceConfig{
+		Name:       "device-posture-agent",
+		ExecPath:   "/Applications/Posture & Co/agent",
+		Args:       []string{"run", "-url=http://collector:3000", "-quiet-hours=<22:00-07:00>"},
+		WorkingDir: "/Applications/Posture & Co",
+	}
+
+	// Read the plist back as a flat list of keys and values
+	var plist struct {
+		Dict struct {
+			Items []struct {
+				XMLName xml.Name
+				Text    string   `xml:",chardata"`
+				Strings []string `xml:"string"`
+			} `xml:",any"`
+		} `xml:"dict"`
+	}
+	if err := xml.NewDecoder(strings.NewReader(launchdPlist(svc))).Decode(&plist); err != nil {
+		t.Fatalf("plist does not parse: %v", err)
+	}
+	values := map[string]any{}
+	items := plist.Dict.Items
+	for i := 0; i+1 < len(items); i += 2 {
+		key, value := items[i].Text, items[i+1]
+		switch value.XMLName.Local {
+		case "array":
+			values[key] = value.Strings
+		case "true":
+			values[key] = true
+		default:
+			values[key] = value.Text
+		}
+	}
+
+	want := map[string]any{
+		"Label":            "com.cisco.device-posture-agent",
+		"ProgramArguments": append([]string{svc.ExecPath}, svc.Args...),
+		"WorkingDirectory": svc.WorkingDir,
+		"RunAtLoad":        true,
+		"KeepAlive":        true,
+		"ThrottleInterval": "5",
+		"StandardOutPath":  "/var/log/device-posture-agent.log",
+	}
+	for key, value := range want {
+		if !reflect.DeepEqual(values[key], value) {
+			t.Errorf("%s = %v, want %v", key, values[key], value)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const systemdUnitDir = "/etc/systemd/system"
+
+// serviceFilePath is the systemd unit installed for the service
+func serviceFilePath(name string) string {
+	return filepath.Join(systemdUnitDir, name+".service")
+}
+
+// installSystemService writes a systemd unit that restarts the agent on
+// failure, then enables and starts it
+func installSystemService(svc *ServiceConfig) error {
+	unitPath := serviceFilePath(svc.Name)
+	if _, err := os.Stat(unitPath); err == nil {
+		return fmt.Errorf("unit %s already exists; run uninstall-service first", unitPath)
+	}
+
+	if err := os.WriteFile(unitPath, []byte(systemdUnit(svc)), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+
+	if err := runServiceCommand("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	return runServiceCommand("systemctl", "enable", "--now", svc.Name+".service")
+}
+
+// systemdUnit renders the unit file for the service
+func systemdUnit(svc *ServiceConfig) string {
+	execStart := quoteSystemdArg(svc.ExecPath)
+	for _, arg := range svc.Args {
+		execStart += " " + quoteSystemdArg(arg)
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=%s - %s
+After=network-online.target
+Wants=network-online.target
+StartLimitIntervalSec=300
+StartLimitBurst=10
+
+[Service]
+Type=simple
+ExecStart=%s
+WorkingDirectory=%s
+Restart=always
+RestartSec=%d
+
+[Install]
+WantedBy=multi-user.target
+`, serviceDisplayName, serviceDescription, execStart, escapeSystemdSpecifiers(svc.WorkingDir), serviceRestartDelaySecond)
+}
+
+// uninstallSystemService stops, disables and removes the systemd unit
+func uninstallSystemService(name string) error {
+	unitPath := serviceFilePath(name)
+	if _, err := os.Stat(unitPath); err != nil {
+		return fmt.Errorf("unit %s not found", unitPath)
+	}
+
+	if err := runServiceCommand("systemctl", "disable", "--now", name+".service"); err != nil {
+		return err
+	}
+	if err := os.Remove(unitPath); err != nil {
+		return fmt.Errorf("failed to remove unit file: %w", err)
+	}
+	return runServiceCommand("systemctl", "daemon-reload")
+}
+
+// quoteSystemdArg quotes an ExecStart argument when it contains whitespace
+// or quotes, and escapes the % specifiers and $ variables systemd would
+// otherwise expand in it
+func quoteSystemdArg(arg string) string {
+	arg = strings.ReplaceAll(escapeSystemdSpecifiers(arg), "$", "$$")
+	if arg == "" || strings.ContainsAny(arg, " \t\"'\\") {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+	}
+	return arg
+}
+
+// escapeSystemdSpecifiers keeps systemd from expanding % specifiers
+func escapeSystemdSpecifiers(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// runServiceCommand runs a service manager command, surfacing its output on failure
+func runServiceCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteSystemdArg(t *testing.T) {
+	tests := []struct {
+		arg, want string
+	}{
+		{"-interval=30s", "-interval=30s"},
+		{"", `""`},
+		{"/opt/posture agent/agent", `"/opt/posture agent/agent"`},
+		{`-quiet-hours="22:00-07:00"`, `"-quiet-hours=\"22:00-07:00\""`},
+		{`C:\agent`, `"C:\\agent"`},
+		{"-features=delta-reports=25%", "-features=delta-reports=25%%"},
+		{"-api-key-file=/etc/posture/$HOST.key", "-api-key-file=/etc/posture/$$HOST.key"},
+		{"/var/lib/%i $USER", `"/var/lib/%%i $$USER"`},
+	}
+	for _, tt := range tests {
+		if got := quoteSystemdArg(tt.arg); got != tt.want {
+			t.Errorf("quoteSystemdArg(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit := systemdUnit(&ServiceConfig{
+		Name:       "device-posture-agent",
+		ExecPath:   "/opt/posture 100%/agent",
+		Args:       []string{"run", "-url=http://collector:3000", "-features=delta-reports=25%", "-dry-run=false"},
+		WorkingDir: "/opt/posture 100%",
+	})
+
+	lines := map[string]string{}
+	for _, line := range strings.Split(unit, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			if _, dup := lines[key]; dup {
+				t.Errorf("%s set twice", key)
+			}
+			lines[key] = value
+		}
+	}
+	want := map[string]string{
+		"Description":      serviceDisplayName + " - " + serviceDescription,
+		"ExecStart":        `"/opt/posture 100%%/agent" run -url=http://collector:3000 -features=delta-reports=25%% -dry-run=false`,
+		"WorkingDirectory": "/opt/posture 100%%",
+		"Restart":          "always",
+		"WantedBy":         "multi-user.target",
+	}
+	for key, value := range want {
+		if lines[key] != value {
+			t.Errorf("%s=%s, want %s", key, lines[key], value)
+		}
+	}
+	// Documentation= takes URIs only; systemd rejects free text there
+	if _, ok := lines["Documentation"]; ok {
+		t.Errorf("unit has Documentation=%s", lines["Documentation"])
+	}
+}
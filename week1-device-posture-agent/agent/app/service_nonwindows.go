@@ -0,0 +1,9 @@
+//go:build !windows
+
+package app
+
+// runUnderServiceManager is only meaningful on Windows, where the SCM needs
+// a control handler; systemd and launchd deliver plain signals.
+func runUnderServiceManager(cfg runConfig) (code int, handled bool) {
+	return 0, false
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+
+package app
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func serviceFilePath(name string) string { return "" }
+
+func installSystemService(svc *ServiceConfig) error {
+	return fmt.Errorf("service installation is not supported on %s", runtime.GOOS)
+}
+
+func uninstallSystemService(name string) error {
+	return fmt.Errorf("service installation is not supported on %s", runtime.GOOS)
+}
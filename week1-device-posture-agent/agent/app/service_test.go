@@ -0,0 +1,87 @@
+package app
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewServiceConfigForwardsRunFlags(t *testing.T) {
+	var install *Command
+	for _, sub := range rootCommand("agent").Subcommands {
+		if sub.Name == "install-service" {
+			install = sub
+		}
+	}
+	abs := func(path string) string {
+		t.Helper()
+		p, err := filepath.Abs(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	watch := ""
+	if path := serviceFilePath("posture"); path != "" {
+		watch = "," + path
+	}
+
+	// Flags are forwarded in name order, each as -flag=value
+	tests := []struct {
+		name     string
+		args     []string
+		want     []string
+		watching bool // -watch-files is among the args
+	}{
+		{
+			name: "defaults",
+			args: nil,
+			want: []string{"run"},
+		},
+		{
+			name: "install-only flags stay out",
+			args: []string{"-name", "posture", "-enrollment-token", "tok_secret"},
+			want: []string{"run"},
+		},
+		{
+			name: "every run flag is forwarded",
+			args: []string{"-interval", "1m", "-dry-run", "-notify", "-quiet-hours", "22:00-07:00",
+				"-features", "delta-reports=on", "-log-level", "debug", "-forward-logs", "-max-procs", "2", "-pretty=false"},
+			want: []string{"run", "-dry-run=true", "-features=delta-reports=on", "-forward-logs=true", "-interval=1m0s",
+				"-log-level=debug", "-max-procs=2", "-notify=true", "-pretty=false", "-quiet-hours=22:00-07:00"},
+		},
+		{
+			name: "paths are made absolute",
+			args: []string{"-api-key-file", "key", "-policy", "policy.json", "-manifest", "https://example.com/manifest.json",
+				"-tls-cert", "device.pem", "-posture-token-file", "token", "-log-file", ""},
+			want: []string{"run", "-api-key-file=" + abs("key"), "-log-file=", "-manifest=https://example.com/manifest.json",
+				"-policy=" + abs("policy.json"), "-posture-token-file=" + abs("token"), "-tls-cert=" + abs("device.pem")},
+		},
+		{
+			name:     "watched files keep the service definition",
+			args:     []string{"-watch-files", "a.conf, b.conf"},
+			want:     []string{"run", "-watch-files=" + abs("a.conf") + "," + abs("b.conf") + watch},
+			watching: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := install.flagSet("agent install-service", io.Discard)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			svc, err := newServiceConfig("posture", fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if watch != "" && !tt.watching {
+				want = append(want, "-watch-files="+watch[1:])
+			}
+			if !reflect.DeepEqual(svc.Args, want) {
+				t.Errorf("args = %q\nwant %q", svc.Args, want)
+			}
+		})
+	}
+}
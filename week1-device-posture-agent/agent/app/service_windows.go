@@ -0,0 +1,120 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceFilePath is empty on Windows: services live in the registry, not a file
+func serviceFilePath(name string) string { return "" }
+
+// installSystemService registers an auto-start Windows service with
+// restart-on-failure recovery actions, then starts it
+func installSystemService(cfg *ServiceConfig) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(cfg.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists; run uninstall-service first", cfg.Name)
+	}
+
+	s, err := m.CreateService(cfg.Name, cfg.ExecPath, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, cfg.Args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: serviceRestartDelaySecond * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, uint32((24 * time.Hour).Seconds())); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("service created but failed to start: %w", err)
+	}
+	return nil
+}
+
+// uninstallSystemService stops the service if running and deletes it
+func uninstallSystemService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s not found: %w", name, err)
+	}
+	defer s.Close()
+
+	if status, err := s.Query(); err == nil && status.State != svc.Stopped {
+		s.Control(svc.Stop)
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	return nil
+}
+
+// agentService adapts runAgent to the Windows service control protocol
+type agentService struct {
+	cfg runConfig
+}
+
+// Execute is called by the SCM; stop/shutdown requests become an interrupt
+func (a *agentService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan int, 1)
+	go func() { done <- runAgent(a.cfg, stop) }()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				stop <- os.Interrupt
+				<-done
+				return false, 0
+			}
+		case code := <-done:
+			return false, uint32(code)
+		}
+	}
+}
+
+// runUnderServiceManager runs the agent as a Windows service when launched by
+// the SCM. handled is false for interactive runs.
+func runUnderServiceManager(cfg runConfig) (code int, handled bool) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return 0, false
+	}
+
+	if err := svc.Run(defaultServiceName, &agentService{cfg: cfg}); err != nil {
+		fmt.Fprintf(os.Stderr, "run: service failed: %v\n", err)
+		return 1, true
+	}
+	return 0, true
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StatusSnapshot is what the status page and tray show about the agent
+type StatusSnapshot struct {
+	Status      *DeviceStatus `json:"status,omitempty"`
+	LastCollect time.Time     `json:"last_collect"`
+	LastReport  time.Time     `json:"last_report"` // last report the collector accepted
+	ReportError string        `json:"report_error,omitempty"`
+}
+
+// StatusBoard keeps the latest posture for local viewers
+type StatusBoard struct {
+	mu       sync.RWMutex
+	snapshot StatusSnapshot
+}
+
+// NewStatusBoard creates an empty StatusBoard
+func NewStatusBoard() *StatusBoard {
+	return &StatusBoard{}
+}
+
+// Update records a freshly evaluated status
+func (b *StatusBoard) Update(status *DeviceStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.snapshot.Status = status
+	b.snapshot.LastCollect = time.Now()
+}
+
+// ObserveReport records the outcome of sending a report
+func (b *StatusBoard) ObserveReport(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.snapshot.ReportError = err.Error()
+		return
+	}
+	b.snapshot.ReportError = ""
+	b.snapshot.LastReport = time.Now()
+}
+
+// Snapshot returns a copy of the current state
+func (b *StatusBoard) Snapshot() StatusSnapshot {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.snapshot
+}
+
+// localHandler serves the agent's local endpoints: Prometheus metrics, the
+// status page and its JSON form, and a loopback-only "collect now" action.
+func (a *Agent) localHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", a.metrics)
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.board.Snapshot())
+	})
+
+	mux.HandleFunc("/collect", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !isLoopback(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		a.CollectNow()
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		statusPage.Execute(w, a.board.Snapshot())
+	})
+
+	return mux
+}
+
+// localServer returns the server for the local endpoints
+func (a *Agent) localServer() *http.Server {
+	return &http.Server{
+		Handler:      a.localHandler(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+var statusPage = template.Must(template.New("status").Funcs(template.FuncMap{
+	"when": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>Device Posture</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+.HEALTHY { color: #1a7f37; } .DEGRADED { color: #9a6700; } .UNHEALTHY { color: #cf222e; }
+table { border-collapse: collapse; margin-top: 1em; }
+td, th { border-bottom: 1px solid #ddd; padding: 4px 12px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Device Posture</h1>
+{{with .Status}}
+<h2 class="{{.Status}}">{{.Status}} &middot; score {{.Score}}</h2>
+<p>{{.Message}}</p>
+<p>{{.Hostname}} ({{.IP}}) &middot; disk {{printf "%.1f" .DiskUsage}}% &middot; CPU {{printf "%.1f" .CPUUsage}}% &middot; memory {{printf "%.1f" .MemoryUsage}}%</p>
+<table>
+<tr><th>Check</th><th>Result</th><th>Details</th></tr>
+{{range .Checks}}<tr><td>{{.Name}}</td><td>{{if .Passed}}✓ passed{{else}}✗ {{.Severity}}{{end}}</td><td>{{.Message}}{{if .Remediation}}<br><em>{{.Remediation}}</em>{{end}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No collection yet.</p>
+{{end}}
+<p>Last collection: {{when .LastCollect}} &middot; Last report: {{when .LastReport}}{{with .ReportError}} &middot; <span class="UNHEALTHY">report failed: {{.}}</span>{{end}}</p>
+<form method="post" action="/collect"><button>Collect now</button></form>
+</body>
+</html>
+`))
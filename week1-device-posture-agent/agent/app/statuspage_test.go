@@ -0,0 +1,127 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusBoard(t *testing.T) {
+	board := NewStatusBoard()
+	if snap := board.Snapshot(); snap.Status != nil || !snap.LastCollect.IsZero() {
+		t.Fatalf("new board = %+v", snap)
+	}
+
+	board.Update(&DeviceStatus{Status: StatusHealthy})
+	board.ObserveReport(nil)
+	reported := board.Snapshot().LastReport
+	if reported.IsZero() {
+		t.Fatal("accepted report not recorded")
+	}
+
+	// A failed report keeps the time of the last accepted one
+	board.ObserveReport(errors.New("collector unreachable"))
+	snap := board.Snapshot()
+	if snap.ReportError != "collector unreachable" || !snap.LastReport.Equal(reported) {
+		t.Errorf("after a failed report: %+v", snap)
+	}
+	board.ObserveReport(nil)
+	if snap := board.Snapshot(); snap.ReportError != "" {
+		t.Errorf("report error %q kept after an accepted report", snap.ReportError)
+	}
+}
+
+func TestLocalHandler(t *testing.T) {
+	a := &Agent{metrics: NewMetricsExporter(), board: NewStatusBoard(), trigger: make(chan struct{}, 1)}
+	a.board.Update(&DeviceStatus{
+		Hostname: "<laptop-1>",
+		Status:   StatusDegraded,
+		Score:    70,
+		Checks:   []CheckResult{{Name: "cpu_usage", Severity: SeverityWarning, Message: "CPU usage at 95.00%"}},
+	})
+	handler := a.localHandler()
+
+	tests := []struct {
+		method, path, remote string
+		wantCode             int
+		wantBody             []string
+		wantCollect          bool
+	}{
+		{"GET", "/", "127.0.0.1:50000", http.StatusOK, []string{`class="DEGRADED"`, "score 70", "&lt;laptop-1&gt;", "cpu_usage", "Last report: never"}, false},
+		{"GET", "/status", "127.0.0.1:50000", http.StatusOK, []string{`"status":"DEGRADED"`, `"score":70`}, false},
+		{"GET", "/metrics", "127.0.0.1:50000", http.StatusOK, []string{"posture_collections_total"}, false},
+		{"GET", "/missing", "127.0.0.1:50000", http.StatusNotFound, nil, false},
+		{"POST", "/collect", "127.0.0.1:50000", http.StatusSeeOther, nil, true},
+		{"POST", "/collect", "[::1]:50000", http.StatusSeeOther, nil, true},
+		{"POST", "/collect", "192.0.2.10:50000", http.StatusForbidden, nil, false},
+		{"GET", "/collect", "127.0.0.1:50000", http.StatusMethodNotAllowed, nil, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.RemoteAddr = tt.remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s %s from %s = %d, want %d", tt.method, tt.path, tt.remote, rec.Code, tt.wantCode)
+		}
+		for _, want := range tt.wantBody {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s %s lacks %q:\n%s", tt.method, tt.path, want, rec.Body)
+			}
+		}
+		collected := false
+		select {
+		case <-a.trigger:
+			collected = true
+		default:
+		}
+		if collected != tt.wantCollect {
+			t.Errorf("%s %s from %s triggered a collection: %v, want %v", tt.method, tt.path, tt.remote, collected, tt.wantCollect)
+		}
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	a := &Agent{metrics: NewMetricsExporter(), board: NewStatusBoard()}
+	rec := httptest.NewRecorder()
+	a.localHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var snap StatusSnapshot
+	if err := json.NewDecoder(rec.Body).Decode(&snap); err != nil {
+		t.Fatal(err)
+	}
+	if snap.Status != nil || !snap.LastCollect.IsZero() {
+		t.Errorf("status before the first collection = %+v", snap)
+	}
+}
+
+func TestTrayText(t *testing.T) {
+	reported := time.Date(2024, 5, 1, 14, 30, 5, 0, time.Local)
+	tests := []struct {
+		snap       StatusSnapshot
+		title      string
+		lastReport string
+	}{
+		{StatusSnapshot{}, "Device posture: collecting...", "Last report: never"},
+		{
+			StatusSnapshot{Status: &DeviceStatus{Status: StatusHealthy, Score: 100}, LastReport: reported},
+			"Device posture: HEALTHY (score 100)", "Last report: 14:30:05",
+		},
+		{
+			StatusSnapshot{Status: &DeviceStatus{Status: StatusUnhealthy, Score: 40}, LastReport: reported, ReportError: "timeout"},
+			"Device posture: UNHEALTHY (score 40)", "Last report failed",
+		},
+	}
+	for _, tt := range tests {
+		if got := trayTitle(tt.snap); got != tt.title {
+			t.Errorf("trayTitle = %q, want %q", got, tt.title)
+		}
+		if got := trayLastReport(tt.snap); got != tt.lastReport {
+			t.Errorf("trayLastReport = %q, want %q", got, tt.lastReport)
+		}
+	}
+}
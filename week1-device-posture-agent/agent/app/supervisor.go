@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// maxPendingCrashes bounds how many crash events are kept between reports
+const maxPendingCrashes = 20
+
+// CrashEvent records a recovered panic or a stalled loop restart.
+// Pending events are attached to the next report sent to the collector.
+type CrashEvent struct {
+	Component string    `json:"component"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Supervisor keeps the report loop alive: it recovers panics, restarts the
+// loop when it stops making progress, and remembers why.
+type Supervisor struct {
+	mu         sync.Mutex
+	crashes    []CrashEvent
+	lastBeat   time.Time
+	stallAfter time.Duration
+	restarts   int
+	log        *slog.Logger
+}
+
+// NewSupervisor creates a supervisor that restarts the loop after stallAfter
+// without a heartbeat
+func NewSupervisor(stallAfter time.Duration, logger *slog.Logger) *Supervisor {
+	return &Supervisor{stallAfter: stallAfter, lastBeat: time.Now(), log: logger}
+}
+
+// Heartbeat marks that the supervised loop completed a cycle
+func (s *Supervisor) Heartbeat() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastBeat = time.Now()
+}
+
+// RecordCrash queues a crash event for the next report
+func (s *Supervisor) RecordCrash(component, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.crashes = append(s.crashes, CrashEvent{Component: component, Reason: reason, Timestamp: time.Now()})
+	if len(s.crashes) > maxPendingCrashes {
+		s.crashes = s.crashes[len(s.crashes)-maxPendingCrashes:]
+	}
+}
+
+// PendingCrashes returns the queued crash events without clearing them
+func (s *Supervisor) PendingCrashes() []CrashEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CrashEvent(nil), s.crashes...)
+}
+
+// AckCrashes drops the first n events once they have been delivered
+func (s *Supervisor) AckCrashes(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > len(s.crashes) {
+		n = len(s.crashes)
+	}
+	s.crashes = s.crashes[n:]
+}
+
+// Protect runs fn, converting a panic into a recorded crash. It reports
+// whether fn completed normally.
+func (s *Supervisor) Protect(component string, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			reason := fmt.Sprintf("panic: %v", r)
+			s.log.Error("recovered panic", "component", component, "reason", reason, "stack", string(debug.Stack()))
+			s.RecordCrash(component, reason)
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
+
+// Run starts loop and keeps it running until ctx is cancelled.
+// Each loop generation gets its own done channel; a stalled generation is
+// abandoned (it exits at its next check of done) and a fresh one started.
+func (s *Supervisor) Run(ctx context.Context, loop func(done <-chan struct{})) {
+	exited := make(chan struct{}, 1)
+	start := func() chan struct{} {
+		done := make(chan struct{})
+		s.Heartbeat()
+		go func() {
+			if !s.Protect("report_loop", func() { loop(done) }) {
+				exited <- struct{}{}
+			}
+		}()
+		return done
+	}
+
+	done := start()
+	watchdog := time.NewTicker(s.stallAfter / 2)
+	defer watchdog.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(done)
+			return
+
+		case <-exited:
+			s.restart(&done, start, "report loop crashed; restarting")
+
+		case <-watchdog.C:
+			s.mu.Lock()
+			stalled := time.Since(s.lastBeat)
+			s.mu.Unlock()
+
+			if stalled > s.stallAfter {
+				reason := fmt.Sprintf("report loop stalled for %v; restarting", stalled.Round(time.Millisecond))
+				s.RecordCrash("watchdog", reason)
+				s.restart(&done, start, reason)
+			}
+		}
+	}
+}
+
+// restart abandons the current generation and starts a new one
+func (s *Supervisor) restart(done *chan struct{}, start func() chan struct{}, reason string) {
+	s.mu.Lock()
+	s.restarts++
+	restarts := s.restarts
+	s.mu.Unlock()
+
+	s.log.Warn(reason, "restart", restarts)
+	close(*done)
+	*done = start()
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestSupervisorProtect(t *testing.T) {
+	s := NewSupervisor(time.Minute, discardLogger())
+	if !s.Protect("collector", func() {}) {
+		t.Error("Protect reported a normal return as a crash")
+	}
+	if s.Protect("collector", func() { panic("nil map") }) {
+		t.Error("Protect reported a panic as a normal return")
+	}
+	crashes := s.PendingCrashes()
+	if len(crashes) != 1 || crashes[0].Component != "collector" || crashes[0].Reason != "panic: nil map" {
+		t.Errorf("crashes = %+v", crashes)
+	}
+}
+
+func TestSupervisorPendingCrashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorded int
+		acked    int
+		want     int
+		first    string // reason of the first pending crash
+	}{
+		{"none", 0, 0, 0, ""},
+		{"unacknowledged", 3, 0, 3, "crash 0"},
+		{"partly acknowledged", 3, 2, 1, "crash 2"},
+		{"ack beyond pending", 2, 5, 0, ""},
+		{"oldest dropped past the cap", maxPendingCrashes + 5, 0, maxPendingCrashes, "crash 5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSupervisor(time.Minute, discardLogger())
+			for i := 0; i < tt.recorded; i++ {
+				s.RecordCrash("report_loop", fmt.Sprintf("crash %d", i))
+			}
+			s.AckCrashes(tt.acked)
+			crashes := s.PendingCrashes()
+			if len(crashes) != tt.want {
+				t.Fatalf("%d pending crashes, want %d", len(crashes), tt.want)
+			}
+			if len(crashes) > 0 && crashes[0].Reason != tt.first {
+				t.Errorf("first pending crash = %q, want %q", crashes[0].Reason, tt.first)
+			}
+		})
+	}
+}
+
+func TestSupervisorRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		loop   func(generation int32, done <-chan struct{})
+		reason string // of the recorded crashes
+	}{
+		{
+			name: "restarts a crashed loop",
+			loop: func(generation int32, done <-chan struct{}) {
+				panic(fmt.Sprintf("generation %d", generation))
+			},
+			reason: "panic: generation",
+		},
+		{
+			name: "restarts a stalled loop",
+			loop: func(generation int32, done <-chan struct{}) {
+				<-done // never beats
+			},
+			reason: "report loop stalled for",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSupervisor(20*time.Millisecond, discardLogger())
+			var generations atomic.Int32
+			restarted := make(chan struct{})
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				s.Run(ctx, func(done <-chan struct{}) {
+					n := generations.Add(1)
+					if n == 3 {
+						close(restarted)
+						<-done
+						return
+					}
+					tt.loop(n, done)
+				})
+			}()
+
+			select {
+			case <-restarted:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("loop ran %d times, want 3", generations.Load())
+			}
+			cancel()
+			<-stopped
+
+			crashes := s.PendingCrashes()
+			if len(crashes) < 2 {
+				t.Fatalf("crashes = %+v, want one per restart", crashes)
+			}
+			for _, crash := range crashes {
+				if !strings.HasPrefix(crash.Reason, tt.reason) {
+					t.Errorf("crash reason = %q, want %q...", crash.Reason, tt.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestSupervisorHeartbeatPreventsRestart(t *testing.T) {
+	s := NewSupervisor(40*time.Millisecond, discardLogger())
+	var generations atomic.Int32
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	s.Run(ctx, func(done <-chan struct{}) {
+		generations.Add(1)
+		tick := time.NewTicker(5 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				s.Heartbeat()
+			}
+		}
+	})
+	if n := generations.Load(); n != 1 {
+		t.Errorf("loop started %d times, want 1", n)
+	}
+	if crashes := s.PendingCrashes(); len(crashes) != 0 {
+		t.Errorf("crashes = %+v", crashes)
+	}
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/nisatyap/shared/httpclient"
+	"github.com/nisatyap/shared/tlsutil"
+)
+
+// ClientTLS names the files the agent uses on an https:// collector URL
+type ClientTLS struct {
+	CertFile string // device certificate issued by the enrollment CA
+	KeyFile  string // private key for CertFile
+	CAFile   string // CA the collector's certificate must chain to; empty uses the system roots
+}
+
+// addFlags registers the TLS flags shared by the commands that talk to the
+// collector
+func (c *ClientTLS) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.CertFile, "tls-cert", "", "Device certificate (PEM) presented to the collector")
+	fs.StringVar(&c.KeyFile, "tls-key", "", "Private key (PEM) for -tls-cert")
+	fs.StringVar(&c.CAFile, "ca-file", "", "CA bundle (PEM) the collector's certificate is verified against (default: system roots)")
+}
+
+// Config builds the client TLS configuration, or nil when no TLS file is
+// set. The device certificate is reloaded when it changes, like the API
+// key on every report, so a renewed certificate is picked up without a
+// restart.
+func (c ClientTLS) Config() (*tls.Config, error) {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+	cfg, err := tlsutil.ClientConfig(tlsutil.Config{CertFile: c.CertFile, KeyFile: c.KeyFile, CAFile: c.CAFile})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS files: %w", err)
+	}
+	return cfg, nil
+}
+
+// httpClient returns an HTTP client for the collector configured by opts,
+// using the TLS files if any are set
+func (c ClientTLS) httpClient(opts httpclient.Options) (*httpclient.Client, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	opts.TLS = cfg
+	return httpclient.New(opts)
+}
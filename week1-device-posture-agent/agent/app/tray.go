@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/nisatyap/shared/lifecycle"
+)
+
+// trayOptions is what the tray icon needs from the running agent
+type trayOptions struct {
+	board      *StatusBoard
+	statusURL  string
+	collectNow func()
+	quit       func() // stops the agent; the tray closes once it has
+	log        *slog.Logger
+}
+
+// runTrayUntilStopped shows the tray on the calling goroutine, which must be
+// the main one on macOS, while run's workers run in the background. It
+// returns once run is stopping, either by signal or from the tray's Quit
+// item.
+func (a *Agent) runTrayUntilStopped(run *lifecycle.Run, statusURL string) {
+	go func() {
+		<-run.Context().Done()
+		quitTray()
+	}()
+	runTray(trayOptions{
+		board:      a.board,
+		statusURL:  statusURL,
+		collectNow: a.CollectNow,
+		quit:       run.Stop,
+		log:        a.log,
+	})
+}
+
+// trayTitle summarises a snapshot for the tray tooltip and first menu line
+func trayTitle(snap StatusSnapshot) string {
+	if snap.Status == nil {
+		return "Device posture: collecting..."
+	}
+	return fmt.Sprintf("Device posture: %s (score %d)", snap.Status.Status, snap.Status.Score)
+}
+
+// trayLastReport describes when the collector last accepted a report
+func trayLastReport(snap StatusSnapshot) string {
+	switch {
+	case snap.ReportError != "":
+		return "Last report failed"
+	case snap.LastReport.IsZero():
+		return "Last report: never"
+	default:
+		return "Last report: " + snap.LastReport.Format("15:04:05")
+	}
+}
+
+// openBrowser opens url in the user's default browser
+func openBrowser(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "open", url)
+	case "windows":
+		cmd = exec.CommandContext(ctx, "rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.CommandContext(ctx, "xdg-open", url)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,11 @@
+//go:build !tray
+
+package app
+
+// traySupported is false in builds without -tags tray, keeping the default
+// binary free of GUI dependencies
+const traySupported = false
+
+func runTray(opts trayOptions) {}
+
+func quitTray() {}
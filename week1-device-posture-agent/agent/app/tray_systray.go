@@ -0,0 +1,146 @@
+//go:build tray
+
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"runtime"
+	"time"
+
+	"fyne.io/systray"
+)
+
+const traySupported = true
+
+// trayMaxFailing is how many failing checks the menu lists
+const trayMaxFailing = 5
+
+// runTray shows the tray icon and blocks until quitTray is called
+func runTray(opts trayOptions) {
+	systray.Run(func() { trayReady(opts) }, nil)
+}
+
+func quitTray() {
+	systray.Quit()
+}
+
+func trayReady(opts trayOptions) {
+	systray.SetTitle("Posture")
+
+	statusItem := systray.AddMenuItem("", "")
+	statusItem.Disable()
+	reportItem := systray.AddMenuItem("", "")
+	reportItem.Disable()
+	failingItems := make([]*systray.MenuItem, trayMaxFailing)
+	for i := range failingItems {
+		failingItems[i] = systray.AddMenuItem("", "")
+		failingItems[i].Disable()
+		failingItems[i].Hide()
+	}
+
+	systray.AddSeparator()
+	collectItem := systray.AddMenuItem("Collect now", "Run a posture collection immediately")
+	pageItem := systray.AddMenuItem("Open status page", opts.statusURL)
+	systray.AddSeparator()
+	quitItem := systray.AddMenuItem("Quit", "Stop the posture agent")
+
+	lastState := ""
+	refresh := func() {
+		snap := opts.board.Snapshot()
+		title := trayTitle(snap)
+		systray.SetTooltip(title)
+		statusItem.SetTitle(title)
+		reportItem.SetTitle(trayLastReport(snap))
+
+		state := ""
+		var failing []CheckResult
+		if snap.Status != nil {
+			state = snap.Status.Status
+			for _, result := range snap.Status.Checks {
+				if !result.Passed {
+					failing = append(failing, result)
+				}
+			}
+		}
+		for i, item := range failingItems {
+			if i < len(failing) {
+				item.SetTitle("✗ " + failing[i].Message)
+				item.SetTooltip(failing[i].Remediation)
+				item.Show()
+			} else {
+				item.Hide()
+			}
+		}
+
+		if state != lastState {
+			systray.SetIcon(trayIcon(state))
+			lastState = state
+		}
+	}
+	systray.SetIcon(trayIcon(""))
+	refresh()
+
+	go func() {
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refresh()
+			case <-collectItem.ClickedCh:
+				opts.collectNow()
+			case <-pageItem.ClickedCh:
+				if err := openBrowser(opts.statusURL); err != nil {
+					opts.log.Warn("could not open status page", "url", opts.statusURL, "error", err)
+				}
+			case <-quitItem.ClickedCh:
+				opts.quit()
+				return
+			}
+		}
+	}()
+}
+
+// trayIcon draws a status-coloured dot: PNG for macOS and Linux, wrapped in
+// an ICO container for Windows
+func trayIcon(state string) []byte {
+	fill := color.RGBA{0x8c, 0x95, 0x9f, 0xff} // not yet collected
+	switch state {
+	case StatusHealthy:
+		fill = color.RGBA{0x1a, 0x7f, 0x37, 0xff}
+	case StatusDegraded:
+		fill = color.RGBA{0xd4, 0xa7, 0x2c, 0xff}
+	case StatusUnhealthy:
+		fill = color.RGBA{0xcf, 0x22, 0x2e, 0xff}
+	}
+
+	const size = 32
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := x-size/2, y-size/2
+			if dx*dx+dy*dy <= (size/2-2)*(size/2-2) {
+				img.Set(x, y, fill)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	if runtime.GOOS != "windows" {
+		return buf.Bytes()
+	}
+
+	// ICONDIR + one ICONDIRENTRY pointing at the embedded PNG
+	var ico bytes.Buffer
+	binary.Write(&ico, binary.LittleEndian, []uint16{0, 1, 1})
+	ico.Write([]byte{size, size, 0, 0})
+	binary.Write(&ico, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&ico, binary.LittleEndian, []uint32{uint32(buf.Len()), 6 + 16})
+	ico.Write(buf.Bytes())
+	return ico.Bytes()
+}
@@ -2,4 +2,18 @@ module device-posture-agent
 
 go 1.21
 
-// No external dependencies required - uses only Go standard library
+// Standard library only, except golang.org/x/sys for the Windows service manager
+// and fyne.io/systray for the optional tray icon (built with -tags tray)
+
+require (
+	fyne.io/systray v1.12.0
+	github.com/nisatyap/shared v0.0.0
+	golang.org/x/sys v0.20.0
+)
+
+require (
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+)
+
+replace github.com/nisatyap/shared => ../../shared
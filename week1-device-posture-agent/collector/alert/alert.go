@@ -0,0 +1,119 @@
+// Package alert delivers collector alerts (unhealthy devices, stale devices,
+// tamper findings) to the configured notification channels.
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+// Alert kinds
+const (
+	KindUnhealthy = "unhealthy" // a device became UNHEALTHY
+	KindStale     = "stale"     // a device stopped reporting
+	KindTamper    = "tamper"    // an agent reported a tamper finding
+)
+
+// Kinds lists every alert kind
+var Kinds = []string{KindUnhealthy, KindStale, KindTamper}
+
+// Delivery outcomes passed to a DeliveryObserver
+const (
+	OutcomeDelivered = "delivered"
+	OutcomeFailed    = "failed"  // retries exhausted
+	OutcomeDropped   = "dropped" // the channel's queue was full
+)
+
+// DeliveryObserver is told how each alert delivery ended, e.g. to count
+// outcomes in metrics. kind is "digest" for batched emails.
+type DeliveryObserver func(channel, kind, outcome string)
+
+func ignoreDelivery(channel, kind, outcome string) {}
+
+// Event is one alert about a device
+type Event struct {
+	Kind          string               `json:"kind"`
+	Tenant        string               `json:"tenant"`
+	Device        string               `json:"device"`
+	IP            string               `json:"ip,omitempty"`
+	Status        string               `json:"status"`
+	LastStatus    string               `json:"last_status,omitempty"` // last reported status of a stale device
+	Score         int                  `json:"score"`
+	FailingChecks []string             `json:"failing_checks,omitempty"`
+	Tags          map[string]string    `json:"tags,omitempty"`
+	Tamper        []report.TamperEvent `json:"tamper_events,omitempty"`
+	Message       string               `json:"message"`
+	LastSeen      time.Time            `json:"last_seen"`
+	Time          time.Time            `json:"time"`
+}
+
+// Summary is a one-line description for chat and paging channels
+func (e Event) Summary() string {
+	switch e.Kind {
+	case KindUnhealthy:
+		if len(e.FailingChecks) == 0 {
+			return fmt.Sprintf("%s is UNHEALTHY (score %d)", e.Device, e.Score)
+		}
+		return fmt.Sprintf("%s is UNHEALTHY (score %d, failing: %s)", e.Device, e.Score, strings.Join(e.FailingChecks, ", "))
+	case KindStale:
+		return fmt.Sprintf("%s is STALE: %s", e.Device, e.Message)
+	case KindTamper:
+		kinds := make([]string, 0, len(e.Tamper))
+		for _, t := range e.Tamper {
+			kinds = append(kinds, t.Kind)
+		}
+		return fmt.Sprintf("%s reported tampering: %s", e.Device, strings.Join(kinds, ", "))
+	default:
+		return fmt.Sprintf("%s: %s", e.Device, e.Message)
+	}
+}
+
+// Notifier sends alerts to one channel
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Log writes alerts to the collector log
+type Log struct {
+	Logger *slog.Logger
+}
+
+func (l Log) Notify(ctx context.Context, e Event) error {
+	l.Logger.WarnContext(ctx, "alert", "kind", e.Kind, "device", e.Device, "ip", e.IP, "status", e.Status,
+		"score", e.Score, "failing", e.FailingChecks, "tags", e.Tags, "message", e.Message)
+	return nil
+}
+
+// Route forwards only alerts about devices whose tags match Match, so for
+// example each site's alerts can go to its own channel
+type Route struct {
+	Match    map[string]string
+	Notifier Notifier
+}
+
+func (r Route) Notify(ctx context.Context, e Event) error {
+	if !store.MatchTags(e.Tags, r.Match) {
+		return nil
+	}
+	return r.Notifier.Notify(ctx, e)
+}
+
+// Multi sends every alert to each notifier, returning their joined errors
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, e Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,113 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Config is the alerts config file:
+//
+//	{
+//	  "webhooks": [
+//	    {"name": "ops", "url": "https://hooks.slack.com/services/...", "format": "slack", "events": ["unhealthy", "tamper"]},
+//	    {"name": "pager", "url": "https://events.pagerduty.com/v2/enqueue", "format": "pagerduty", "routing_key": "..."}
+//	  ],
+//	  "email": {
+//	    "smtp": {"host": "smtp.example.com", "username": "posture", "password_env": "SMTP_PASSWORD", "from": "posture@example.com"},
+//	    "recipients": [{"name": "ams-it", "to": ["it-ams@example.com"], "match": {"site": "ams"}}],
+//	    "digest": "1h"
+//	  }
+//	}
+type Config struct {
+	Webhooks []WebhookConfig `json:"webhooks"`
+	Email    *EmailConfig    `json:"email,omitempty"`
+}
+
+// LoadConfig reads and validates an alerts config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alerts config: %w", err)
+	}
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse alerts config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Channels builds the notifier for every configured channel, logging to
+// logger. Start must be called to begin delivery.
+func (c *Config) Channels(logger *slog.Logger) (*Channels, error) {
+	ch := &Channels{all: Multi{Log{Logger: logger}}}
+	for _, wc := range c.Webhooks {
+		w, err := NewWebhook(wc, logger)
+		if err != nil {
+			return nil, err
+		}
+		ch.webhooks = append(ch.webhooks, w)
+		ch.all = append(ch.all, w)
+	}
+	if c.Email != nil {
+		e, err := NewEmail(*c.Email, logger)
+		if err != nil {
+			return nil, err
+		}
+		ch.email = e
+		ch.all = append(ch.all, e)
+	}
+	return ch, nil
+}
+
+// Channels fans alerts out to the collector log and every configured channel
+type Channels struct {
+	all      Multi
+	webhooks []*Webhook
+	email    *Email
+}
+
+// Run runs the delivery workers until ctx is cancelled, returning once
+// they all have
+func (c *Channels) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, w := range c.webhooks {
+		wg.Add(1)
+		go func(w *Webhook) {
+			defer wg.Done()
+			w.Run(ctx)
+		}(w)
+	}
+	if c.email != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.email.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *Channels) Notify(ctx context.Context, e Event) error {
+	return c.all.Notify(ctx, e)
+}
+
+// Observe reports every channel's delivery outcomes to fn. Call it before
+// Run.
+func (c *Channels) Observe(fn DeliveryObserver) {
+	for _, w := range c.webhooks {
+		w.observe = fn
+	}
+	if c.email != nil {
+		c.email.observe = fn
+	}
+}
+
+// Len is the number of configured channels, not counting the log
+func (c *Channels) Len() int { return len(c.all) - 1 }
@@ -0,0 +1,353 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"device-posture-collector/store"
+)
+
+// Email throttling defaults
+const (
+	defaultDeviceCooldown = 30 * time.Minute
+	defaultMaxPerHour     = 20
+	emailQueueSize        = 64
+)
+
+// EmailConfig configures the SMTP alert channel
+type EmailConfig struct {
+	SMTP       SMTPConfig       `json:"smtp"`
+	Recipients []RecipientGroup `json:"recipients"`
+	// Digest batches each group's alerts into one email per interval
+	// (e.g. "1h"); empty sends every alert as it happens
+	Digest Duration `json:"digest,omitempty"`
+	// DeviceCooldown suppresses repeats of the same alert kind for a device
+	// (default 30m)
+	DeviceCooldown *Duration `json:"device_cooldown,omitempty"`
+	// MaxPerHour caps immediate emails per group; further alerts wait for
+	// the next hourly digest (default 20)
+	MaxPerHour int `json:"max_per_hour,omitempty"`
+}
+
+// SMTPConfig is the outgoing mail server
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"` // default 587
+	Username string `json:"username,omitempty"`
+	// PasswordEnv names the environment variable holding the password, so
+	// it stays out of the config file
+	PasswordEnv string `json:"password_env,omitempty"`
+	From        string `json:"from"`
+}
+
+// RecipientGroup receives the alerts matching its events and device tags
+type RecipientGroup struct {
+	Name   string            `json:"name"`
+	To     []string          `json:"to"`
+	Events []string          `json:"events,omitempty"` // empty receives all kinds
+	Match  map[string]string `json:"match,omitempty"`
+	Tenant string            `json:"tenant,omitempty"` // only this tenant's devices
+}
+
+// Duration is a time.Duration written as a string ("30m") in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("duration must be a string like \"30m\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(time.Duration(d).String())), nil
+}
+
+// Email sends alerts over SMTP. Alerts are throttled per device and per
+// group, and either sent one per email or batched into digests.
+type Email struct {
+	cfg      EmailConfig
+	addr     string
+	auth     smtp.Auth
+	cooldown time.Duration
+	groups   []*recipientState
+	send     func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+	now      func() time.Time
+	queue    chan message
+	observe  DeliveryObserver
+	log      *slog.Logger
+}
+
+// recipientState tracks throttling and the pending digest of one group
+type recipientState struct {
+	RecipientGroup
+	events map[string]bool
+
+	mu         sync.Mutex
+	lastAlert  map[string]time.Time // device + kind
+	suppressed int
+	hourStart  time.Time
+	sentInHour int
+	lastDigest time.Time
+	pending    []Event
+}
+
+type message struct {
+	kind    string // alert kind, or "digest"
+	to      []string
+	subject string
+	body    string
+}
+
+// NewEmail validates cfg and creates the email channel, logging delivery
+// failures to logger
+func NewEmail(cfg EmailConfig, logger *slog.Logger) (*Email, error) {
+	if cfg.SMTP.Host == "" || cfg.SMTP.From == "" {
+		return nil, fmt.Errorf("email: smtp host and from are required")
+	}
+	if len(cfg.Recipients) == 0 {
+		return nil, fmt.Errorf("email: at least one recipient group is required")
+	}
+	if cfg.SMTP.Port == 0 {
+		cfg.SMTP.Port = 587
+	}
+	if cfg.MaxPerHour == 0 {
+		cfg.MaxPerHour = defaultMaxPerHour
+	}
+
+	e := &Email{
+		cfg:      cfg,
+		addr:     net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+		cooldown: defaultDeviceCooldown,
+		send:     smtp.SendMail,
+		now:      time.Now,
+		queue:    make(chan message, emailQueueSize),
+		observe:  ignoreDelivery,
+		log:      logger,
+	}
+	if cfg.DeviceCooldown != nil {
+		e.cooldown = time.Duration(*cfg.DeviceCooldown)
+	}
+	if cfg.SMTP.Username != "" {
+		password := os.Getenv(cfg.SMTP.PasswordEnv)
+		if cfg.SMTP.PasswordEnv != "" && password == "" {
+			return nil, fmt.Errorf("email: %s is not set", cfg.SMTP.PasswordEnv)
+		}
+		// net/smtp only sends PLAIN credentials over TLS or to localhost
+		e.auth = smtp.PlainAuth("", cfg.SMTP.Username, password, cfg.SMTP.Host)
+	}
+
+	for i, g := range cfg.Recipients {
+		if g.Name == "" {
+			g.Name = "group " + strconv.Itoa(i+1)
+		}
+		if len(g.To) == 0 {
+			return nil, fmt.Errorf("email: recipient group %s has no addresses", g.Name)
+		}
+		state := &recipientState{RecipientGroup: g, lastAlert: make(map[string]time.Time), lastDigest: e.now()}
+		if len(g.Events) > 0 {
+			state.events = make(map[string]bool)
+			for _, kind := range g.Events {
+				if !isKind(kind) {
+					return nil, fmt.Errorf("email: recipient group %s: unknown event %q (want %v)", g.Name, kind, Kinds)
+				}
+				state.events[kind] = true
+			}
+		}
+		e.groups = append(e.groups, state)
+	}
+	return e, nil
+}
+
+// Notify sends or batches the alert for every matching recipient group
+func (e *Email) Notify(ctx context.Context, ev Event) error {
+	now := e.now()
+	for _, g := range e.groups {
+		if g.events != nil && !g.events[ev.Kind] {
+			continue
+		}
+		if !store.MatchTags(ev.Tags, g.Match) || (g.Tenant != "" && ev.Tenant != g.Tenant) {
+			continue
+		}
+		if msg, ok := e.accept(g, ev, now); ok {
+			select {
+			case e.queue <- msg:
+			default:
+				e.log.Warn("email queue full, dropping alert", "kind", ev.Kind, "device", ev.Device)
+				e.observe("email", ev.Kind, OutcomeDropped)
+			}
+		}
+	}
+	return nil
+}
+
+// accept applies throttling and returns the message to send now, if any
+func (e *Email) accept(g *recipientState, ev Event, now time.Time) (message, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := ev.Device + "/" + ev.Kind
+	if last, ok := g.lastAlert[key]; ok && now.Sub(last) < e.cooldown {
+		g.suppressed++
+		return message{}, false
+	}
+	g.lastAlert[key] = now
+
+	if e.cfg.Digest > 0 {
+		g.pending = append(g.pending, ev)
+		return message{}, false
+	}
+
+	if now.Sub(g.hourStart) >= time.Hour {
+		g.hourStart, g.sentInHour = now, 0
+	}
+	if g.sentInHour >= e.cfg.MaxPerHour {
+		if len(g.pending) == 0 {
+			e.log.Info("email alert limit reached, batching the rest of the hour", "group", g.Name, "max_per_hour", e.cfg.MaxPerHour)
+		}
+		g.pending = append(g.pending, ev)
+		return message{}, false
+	}
+	g.sentInHour++
+	return message{kind: ev.Kind, to: g.To, subject: "[Device Posture] " + ev.Summary(), body: alertBody(ev)}, true
+}
+
+// Run sends queued emails and flushes digests until ctx is cancelled
+func (e *Email) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-e.queue:
+			e.deliver(ctx, msg)
+		case <-ticker.C:
+			for _, msg := range e.dueDigests(e.now()) {
+				e.deliver(ctx, msg)
+			}
+		}
+	}
+}
+
+// dueDigests collects the digests whose interval (or, when sending
+// immediately, whose throttled hour) has ended
+func (e *Email) dueDigests(now time.Time) []message {
+	var out []message
+	for _, g := range e.groups {
+		g.mu.Lock()
+		interval := time.Duration(e.cfg.Digest)
+		last := g.lastDigest
+		if interval == 0 {
+			interval, last = time.Hour, g.hourStart
+		}
+		if len(g.pending) > 0 && now.Sub(last) >= interval {
+			out = append(out, digest(g.To, g.pending, g.suppressed))
+			g.pending, g.suppressed = nil, 0
+			g.lastDigest, g.hourStart, g.sentInHour = now, now, 0
+		}
+		g.mu.Unlock()
+	}
+	return out
+}
+
+// deliver sends msg, retrying twice on failure
+func (e *Email) deliver(ctx context.Context, msg message) {
+	data := e.format(msg)
+	backoff := 5 * time.Second
+	for attempt := 1; ; attempt++ {
+		err := e.send(e.addr, e.auth, e.cfg.SMTP.From, msg.to, data)
+		if err == nil {
+			e.observe("email", msg.kind, OutcomeDelivered)
+			return
+		}
+		if attempt == 3 {
+			e.log.Error("giving up on email", "subject", msg.subject, "to", msg.to, "error", err)
+			e.observe("email", msg.kind, OutcomeFailed)
+			return
+		}
+		e.log.Warn("email delivery failed", "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			e.observe("email", msg.kind, OutcomeFailed)
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// format builds an RFC 5322 plain-text message
+func (e *Email) format(msg message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.cfg.SMTP.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", e.now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+func alertBody(ev Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", ev.Summary())
+	fmt.Fprintf(&b, "Device:   %s (%s)\n", ev.Device, ev.IP)
+	fmt.Fprintf(&b, "Status:   %s, score %d\n", ev.Status, ev.Score)
+	if len(ev.FailingChecks) > 0 {
+		fmt.Fprintf(&b, "Failing:  %s\n", strings.Join(ev.FailingChecks, ", "))
+	}
+	if len(ev.Tags) > 0 {
+		keys := make([]string, 0, len(ev.Tags))
+		for k := range ev.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + "=" + ev.Tags[k]
+		}
+		fmt.Fprintf(&b, "Tags:     %s\n", strings.Join(pairs, ", "))
+	}
+	for _, t := range ev.Tamper {
+		fmt.Fprintf(&b, "Tamper:   %s %s\n", t.Kind, t.Path)
+	}
+	if ev.Message != "" {
+		fmt.Fprintf(&b, "Message:  %s\n", ev.Message)
+	}
+	fmt.Fprintf(&b, "Last seen: %s\n", ev.LastSeen.UTC().Format(time.RFC3339))
+	return b.String()
+}
+
+func digest(to []string, events []Event, suppressed int) message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d device posture alerts:\n\n", len(events))
+	for _, ev := range events {
+		fmt.Fprintf(&b, "%s  %s\n", ev.Time.UTC().Format("2006-01-02 15:04"), ev.Summary())
+	}
+	if suppressed > 0 {
+		fmt.Fprintf(&b, "\n%d repeated alerts were suppressed.\n", suppressed)
+	}
+	return message{
+		kind:    "digest",
+		to:      to,
+		subject: fmt.Sprintf("[Device Posture] Digest: %d alerts", len(events)),
+		body:    b.String(),
+	}
+}
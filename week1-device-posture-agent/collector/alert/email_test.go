@@ -0,0 +1,104 @@
+package alert
+
+import (
+	"context"
+	"log/slog"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEmail(t *testing.T, cfg EmailConfig) (*Email, *time.Time) {
+	t.Helper()
+	cfg.SMTP = SMTPConfig{Host: "smtp.example.com", From: "posture@example.com"}
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	e, err := NewEmail(cfg, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.now = func() time.Time { return now }
+	for _, g := range e.groups {
+		g.lastDigest = now
+	}
+	return e, &now
+}
+
+func queued(e *Email) []message {
+	var out []message
+	for {
+		select {
+		case msg := <-e.queue:
+			out = append(out, msg)
+		default:
+			return out
+		}
+	}
+}
+
+func TestEmailRoutingAndThrottling(t *testing.T) {
+	e, now := newTestEmail(t, EmailConfig{
+		Recipients: []RecipientGroup{
+			{Name: "ams", To: []string{"ams@example.com"}, Match: map[string]string{"site": "ams"}},
+			{Name: "security", To: []string{"sec@example.com"}, Events: []string{KindTamper}},
+		},
+		MaxPerHour: 2,
+	})
+	ctx := context.Background()
+	ams := map[string]string{"site": "ams"}
+
+	e.Notify(ctx, Event{Kind: KindUnhealthy, Device: "laptop-1", Tags: ams})
+	e.Notify(ctx, Event{Kind: KindUnhealthy, Device: "laptop-1", Tags: ams}) // cooldown
+	e.Notify(ctx, Event{Kind: KindTamper, Device: "laptop-2", Tags: ams})
+	e.Notify(ctx, Event{Kind: KindStale, Device: "laptop-3", Tags: ams}) // over the hourly cap
+	e.Notify(ctx, Event{Kind: KindStale, Device: "laptop-4"})            // no group matches
+
+	var got []string
+	for _, msg := range queued(e) {
+		got = append(got, msg.to[0]+" "+msg.subject)
+	}
+	want := []string{
+		"ams@example.com [Device Posture] laptop-1 is UNHEALTHY (score 0)",
+		"ams@example.com [Device Posture] laptop-2 reported tampering: ",
+		"sec@example.com [Device Posture] laptop-2 reported tampering: ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("sent:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The alert held back by the cap arrives in a digest once the hour ends
+	if digests := e.dueDigests(now.Add(30 * time.Minute)); len(digests) != 0 {
+		t.Errorf("digest sent before the hour ended: %+v", digests)
+	}
+	digests := e.dueDigests(now.Add(time.Hour))
+	if len(digests) != 1 || digests[0].subject != "[Device Posture] Digest: 1 alerts" ||
+		!strings.Contains(digests[0].body, "laptop-3 is STALE") || !strings.Contains(digests[0].body, "1 repeated alerts were suppressed") {
+		t.Errorf("digests = %+v", digests)
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	e, now := newTestEmail(t, EmailConfig{
+		Recipients: []RecipientGroup{{To: []string{"it@example.com"}}},
+		Digest:     Duration(time.Hour),
+	})
+	var sent []string
+	e.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, string(msg))
+		return nil
+	}
+	ctx := context.Background()
+	e.Notify(ctx, Event{Kind: KindUnhealthy, Device: "laptop-1"})
+	e.Notify(ctx, Event{Kind: KindStale, Device: "laptop-2"})
+	if msgs := queued(e); len(msgs) != 0 {
+		t.Fatalf("digest mode sent immediately: %+v", msgs)
+	}
+
+	for _, msg := range e.dueDigests(now.Add(time.Hour)) {
+		e.deliver(ctx, msg)
+	}
+	if len(sent) != 1 || !strings.Contains(sent[0], "Subject: [Device Posture] Digest: 2 alerts\r\n") ||
+		!strings.Contains(sent[0], "To: it@example.com\r\n") {
+		t.Errorf("sent = %q", sent)
+	}
+}
@@ -0,0 +1,108 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"device-posture-collector/store"
+)
+
+// StatusStale is shown in place of a device's last reported status once it
+// has stopped reporting
+const StatusStale = "STALE"
+
+// IsStale reports whether a device last seen at lastSeen has missed the
+// window. A zero window disables stale detection.
+func IsStale(lastSeen, now time.Time, window time.Duration) bool {
+	return window > 0 && now.Sub(lastSeen) > window
+}
+
+// deviceID names a device; hostnames are only unique within a tenant
+type deviceID struct{ tenant, hostname string }
+
+// StaleWatcher periodically scans devices and alerts once when a device
+// goes stale. A device that reports again is re-armed.
+type StaleWatcher struct {
+	store    store.Store
+	window   time.Duration
+	notifier Notifier
+	now      func() time.Time
+	log      *slog.Logger
+
+	stale  map[deviceID]bool
+	seeded bool
+}
+
+// NewStaleWatcher creates a watcher alerting through n after window
+// without a report
+func NewStaleWatcher(s store.Store, window time.Duration, n Notifier, logger *slog.Logger) *StaleWatcher {
+	return &StaleWatcher{store: s, window: window, notifier: n, now: time.Now, log: logger, stale: make(map[deviceID]bool)}
+}
+
+// Run scans every interval until ctx is cancelled
+func (w *StaleWatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.Scan(ctx); err != nil {
+			w.log.Error("stale device scan failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan alerts for devices that went stale since the previous scan. Devices
+// already stale at the first scan are only counted, so restarting the
+// collector doesn't repeat alerts for long-gone machines.
+func (w *StaleWatcher) Scan(ctx context.Context) error {
+	devices, err := w.store.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	now := w.now()
+
+	current := make(map[deviceID]bool)
+	for _, d := range devices {
+		id := deviceID{d.Tenant, d.Hostname}
+		if !IsStale(d.LastSeen, now, w.window) {
+			if w.stale[id] {
+				w.log.Info("device is reporting again", "device", d.Hostname, "tenant", d.Tenant)
+			}
+			continue
+		}
+		current[id] = true
+		if !w.seeded || w.stale[id] {
+			continue
+		}
+		err := w.notifier.Notify(ctx, Event{
+			Kind:          KindStale,
+			Tenant:        d.Tenant,
+			Device:        d.Hostname,
+			IP:            d.IP,
+			Status:        StatusStale,
+			LastStatus:    d.Status,
+			Score:         d.Score,
+			FailingChecks: d.FailingChecks,
+			Tags:          d.Tags,
+			Message:       fmt.Sprintf("No report for %s (last status %s)", now.Sub(d.LastSeen).Round(time.Second), d.Status),
+			LastSeen:      d.LastSeen,
+			Time:          now,
+		})
+		if err != nil {
+			w.log.Error("failed to send stale alert", "device", d.Hostname, "error", err)
+		}
+	}
+
+	if !w.seeded && len(current) > 0 {
+		w.log.Info("devices already stale at startup", "count", len(current))
+	}
+	w.stale = current
+	w.seeded = true
+	return nil
+}
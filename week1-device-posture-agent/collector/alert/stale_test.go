@@ -0,0 +1,56 @@
+package alert
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+type recorder []Event
+
+func (r *recorder) Notify(ctx context.Context, e Event) error {
+	*r = append(*r, e)
+	return nil
+}
+
+func TestStaleWatcher(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := store.NewMemory(100)
+	save := func(host string, at time.Time) {
+		s.SaveReport(ctx, &report.DeviceStatus{Hostname: host, IP: "10.0.0.5", Status: report.StatusHealthy, Timestamp: at}, nil, at)
+	}
+	save("old", start.Add(-time.Hour))
+	save("laptop-1", start)
+
+	var got recorder
+	w := NewStaleWatcher(s, 10*time.Minute, &got, slog.Default())
+	now := start
+	w.now = func() time.Time { return now }
+
+	// Already stale at startup: counted, not alerted
+	w.Scan(ctx)
+	if len(got) != 0 {
+		t.Fatalf("alerted at startup: %+v", got)
+	}
+
+	now = start.Add(11 * time.Minute)
+	w.Scan(ctx)
+	w.Scan(ctx)
+	if len(got) != 1 || got[0].Device != "laptop-1" || got[0].Kind != KindStale || got[0].Status != StatusStale {
+		t.Fatalf("after going stale: %+v", got)
+	}
+
+	// Reporting again re-arms the alert
+	save("laptop-1", now)
+	w.Scan(ctx)
+	now = now.Add(11 * time.Minute)
+	w.Scan(ctx)
+	if len(got) != 2 {
+		t.Errorf("expected a second stale alert, got %+v", got)
+	}
+}
@@ -0,0 +1,265 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"device-posture-collector/store"
+)
+
+// Webhook payload formats
+const (
+	FormatJSON      = "json"      // the Event as JSON
+	FormatSlack     = "slack"     // Slack incoming webhook
+	FormatPagerDuty = "pagerduty" // PagerDuty Events API v2
+)
+
+// Delivery defaults
+const (
+	defaultMaxRetries = 5
+	webhookQueueSize  = 256
+	maxBackoff        = time.Minute
+)
+
+// WebhookConfig is one webhook in the alerts config file
+type WebhookConfig struct {
+	Name       string            `json:"name"`
+	URL        string            `json:"url"`
+	Format     string            `json:"format,omitempty"`      // json (default), slack or pagerduty
+	Events     []string          `json:"events,omitempty"`      // alert kinds to send; empty sends all
+	Match      map[string]string `json:"match,omitempty"`       // only devices with these tags
+	Tenant     string            `json:"tenant,omitempty"`      // only this tenant's devices
+	Template   string            `json:"template,omitempty"`    // text/template for the request body, replacing the format's
+	Headers    map[string]string `json:"headers,omitempty"`     // extra request headers, e.g. Authorization
+	RoutingKey string            `json:"routing_key,omitempty"` // PagerDuty integration key
+	MaxRetries *int              `json:"max_retries,omitempty"` // default 5
+}
+
+// Webhook posts alerts to an HTTP endpoint. Notify only renders and queues
+// the payload; Run delivers it, retrying with exponential backoff on network
+// errors, 429 and 5xx responses.
+type Webhook struct {
+	cfg        WebhookConfig
+	events     map[string]bool
+	tmpl       *template.Template
+	maxRetries int
+	client     *http.Client
+	backoff    time.Duration
+	queue      chan delivery
+	observe    DeliveryObserver
+	log        *slog.Logger
+}
+
+type delivery struct {
+	event Event
+	body  []byte
+}
+
+// templateFuncs are available to webhook templates; json quotes a value so
+// it can be embedded in a JSON body: {"text": {{json .Summary}}}
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// NewWebhook validates cfg and creates its notifier, logging delivery
+// failures to logger
+func NewWebhook(cfg WebhookConfig, logger *slog.Logger) (*Webhook, error) {
+	if cfg.Name == "" {
+		cfg.Name = cfg.URL
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook %s: url must be an http(s) URL", cfg.Name)
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = FormatJSON
+	case FormatJSON, FormatSlack:
+	case FormatPagerDuty:
+		if cfg.RoutingKey == "" && cfg.Template == "" {
+			return nil, fmt.Errorf("webhook %s: pagerduty needs a routing_key", cfg.Name)
+		}
+	default:
+		return nil, fmt.Errorf("webhook %s: unknown format %q (want json, slack or pagerduty)", cfg.Name, cfg.Format)
+	}
+
+	w := &Webhook{
+		cfg:        cfg,
+		maxRetries: defaultMaxRetries,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		backoff:    time.Second,
+		queue:      make(chan delivery, webhookQueueSize),
+		observe:    ignoreDelivery,
+		log:        logger,
+	}
+	if cfg.MaxRetries != nil {
+		w.maxRetries = *cfg.MaxRetries
+	}
+	if len(cfg.Events) > 0 {
+		w.events = make(map[string]bool)
+		for _, kind := range cfg.Events {
+			if !isKind(kind) {
+				return nil, fmt.Errorf("webhook %s: unknown event %q (want %v)", cfg.Name, kind, Kinds)
+			}
+			w.events[kind] = true
+		}
+	}
+	if cfg.Template != "" {
+		if w.tmpl, err = template.New(cfg.Name).Funcs(templateFuncs).Parse(cfg.Template); err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", cfg.Name, err)
+		}
+	}
+	return w, nil
+}
+
+// Notify queues the alert if this webhook subscribes to it
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	if w.events != nil && !w.events[e.Kind] {
+		return nil
+	}
+	if !store.MatchTags(e.Tags, w.cfg.Match) || (w.cfg.Tenant != "" && e.Tenant != w.cfg.Tenant) {
+		return nil
+	}
+	body, err := w.body(e)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", w.cfg.Name, err)
+	}
+	select {
+	case w.queue <- delivery{event: e, body: body}:
+		return nil
+	default:
+		w.observe(w.channel(), e.Kind, OutcomeDropped)
+		return fmt.Errorf("webhook %s: queue full, dropping %s alert for %s", w.cfg.Name, e.Kind, e.Device)
+	}
+}
+
+// Run delivers queued alerts until ctx is cancelled
+func (w *Webhook) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			if n := len(w.queue); n > 0 {
+				w.log.Warn("alerts undelivered at shutdown", "webhook", w.cfg.Name, "count", n)
+			}
+			return
+		case d := <-w.queue:
+			if err := w.deliver(ctx, d.body); err != nil {
+				w.log.Error("giving up on alert", "webhook", w.cfg.Name, "kind", d.event.Kind, "device", d.event.Device, "error", err)
+				w.observe(w.channel(), d.event.Kind, OutcomeFailed)
+			} else {
+				w.observe(w.channel(), d.event.Kind, OutcomeDelivered)
+			}
+		}
+	}
+}
+
+// channel names the webhook in delivery outcomes
+func (w *Webhook) channel() string { return "webhook:" + w.cfg.Name }
+
+// deliver posts body, retrying transient failures
+func (w *Webhook) deliver(ctx context.Context, body []byte) error {
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.maxRetries {
+			return err
+		}
+		w.log.Warn("alert delivery failed", "webhook", w.cfg.Name, "attempt", attempt+1, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// post sends one request, reporting whether a failure is worth retrying
+func (w *Webhook) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "device-posture-collector")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("server returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("server returned %s", resp.Status)
+	}
+}
+
+// body renders the request body for e
+func (w *Webhook) body(e Event) ([]byte, error) {
+	if w.tmpl != nil {
+		var buf bytes.Buffer
+		if err := w.tmpl.Execute(&buf, e); err != nil {
+			return nil, fmt.Errorf("render template: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	switch w.cfg.Format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": "[Device Posture] " + e.Summary()})
+	case FormatPagerDuty:
+		severity := "critical"
+		if e.Kind == KindStale {
+			severity = "warning"
+		}
+		return json.Marshal(map[string]any{
+			"routing_key":  w.cfg.RoutingKey,
+			"event_action": "trigger",
+			// One open incident per device and kind
+			"dedup_key": "device-posture/" + e.Kind + "/" + e.Device,
+			"payload": map[string]any{
+				"summary":        e.Summary(),
+				"source":         e.Device,
+				"severity":       severity,
+				"timestamp":      e.Time.Format(time.RFC3339),
+				"component":      "device-posture",
+				"class":          e.Kind,
+				"custom_details": e,
+			},
+		})
+	default:
+		return json.Marshal(e)
+	}
+}
+
+func isKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
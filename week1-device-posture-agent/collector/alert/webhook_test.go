@@ -0,0 +1,91 @@
+package alert
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookRetriesAndFormats(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhook(WebhookConfig{Name: "ops", URL: srv.URL, Format: FormatSlack, Events: []string{KindUnhealthy}, Match: map[string]string{"site": "ams"}}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	event := Event{Kind: KindUnhealthy, Device: "laptop-1", Score: 40, FailingChecks: []string{"disk_usage"}, Tags: map[string]string{"site": "ams"}}
+	w.Notify(ctx, Event{Kind: KindStale, Device: "laptop-1", Tags: event.Tags})                           // not subscribed
+	w.Notify(ctx, Event{Kind: KindUnhealthy, Device: "laptop-2", Tags: map[string]string{"site": "lon"}}) // other site
+	w.Notify(ctx, event)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(bodies)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 || len(bodies) != 1 {
+		t.Fatalf("calls = %d, delivered = %v; want a retry then one delivery", calls, bodies)
+	}
+	if want := `{"text":"[Device Posture] laptop-1 is UNHEALTHY (score 40, failing: disk_usage)"}`; bodies[0] != want {
+		t.Errorf("slack body = %s, want %s", bodies[0], want)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	w, err := NewWebhook(WebhookConfig{URL: "https://example.com/hook", Template: `{"device": {{json .Device}}, "summary": {{json .Summary}}}`}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := w.body(Event{Kind: KindStale, Device: `lap"top`, Message: "No report for 1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"device": "lap\"top", "summary": "lap\"top is STALE: No report for 1h"}`; string(body) != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+
+	for _, cfg := range []WebhookConfig{
+		{URL: "ftp://example.com"},
+		{URL: "https://example.com", Format: "teams"},
+		{URL: "https://example.com", Format: FormatPagerDuty},
+		{URL: "https://example.com", Events: []string{"offline"}},
+	} {
+		if _, err := NewWebhook(cfg, slog.Default()); err == nil {
+			t.Errorf("NewWebhook(%+v) accepted an invalid config", cfg)
+		} else if !strings.Contains(err.Error(), "webhook") {
+			t.Errorf("error %q does not name the webhook", err)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// Package app is the device posture collector's command line, which the
+// collector's own binary and the unified swg binary run
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/config"
+	"github.com/nisatyap/shared/eventbus"
+	"github.com/nisatyap/shared/lifecycle"
+	"github.com/nisatyap/shared/logging"
+	"github.com/nisatyap/shared/middleware"
+	"github.com/nisatyap/shared/posturetoken"
+	"github.com/nisatyap/shared/ratelimit"
+	"github.com/nisatyap/shared/secrets"
+	"github.com/nisatyap/shared/tlsutil"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/handlers"
+	"device-posture-collector/metrics"
+	"device-posture-collector/retention"
+	"device-posture-collector/store"
+)
+
+// Main runs the collector with args, the command line without the program
+// name, until it receives SIGINT or SIGTERM, and returns its exit code.
+// name is how the collector is invoked, e.g. "collector" or
+// "swg collector", for its usage message.
+func Main(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	listen := fs.String("listen", ":8000", "Address to listen on")
+	cfg := storeConfig{pool: store.DefaultPoolConfig}
+	fs.StringVar(&cfg.backend, "store", "sqlite", "Storage backend: sqlite, postgres or memory")
+	fs.StringVar(&cfg.db, "db", "", "SQLite database file (default collector.db) or PostgreSQL URL (default $COLLECTOR_DATABASE_URL)")
+	fs.StringVar(&cfg.password, "db-password", "", "Password for the PostgreSQL -db, kept out of the URL: a secret reference such as vault:secret/data/swg/collector#db_password")
+	fs.IntVar(&cfg.maxReports, "max-reports", 10000, "Reports kept in memory before the oldest are dropped (with -store memory)")
+	fs.IntVar(&cfg.pool.MaxOpenConns, "db-max-conns", cfg.pool.MaxOpenConns, "PostgreSQL connection pool size")
+	fs.IntVar(&cfg.pool.MaxIdleConns, "db-max-idle-conns", cfg.pool.MaxIdleConns, "Idle PostgreSQL connections kept open")
+	staleAfter := fs.Duration("stale-after", 10*time.Minute, "Mark devices STALE and alert after this long without a report (0 disables)")
+	staleCheck := fs.Duration("stale-check-interval", time.Minute, "How often to look for stale devices")
+	alertsConfig := fs.String("alerts-config", "", "JSON file configuring alert webhooks")
+	requireAuth := fs.Bool("require-auth", true, "Reject reports without a valid device API key")
+	adminToken := fs.String("admin-token", "", "Admin token, or a secret reference such as vault:secret/data/swg/collector#admin_token")
+	adminTokenFile := fs.String("admin-token-file", "", "File holding the admin token, instead of -admin-token")
+	limits := handlers.DefaultRateLimit
+	fs.Float64Var(&limits.PerDevice, "device-rate-limit", limits.PerDevice, "Reports per minute accepted from one device (0 disables)")
+	fs.IntVar(&limits.DeviceBurst, "device-burst", limits.DeviceBurst, "Reports a device may send back to back")
+	fs.Float64Var(&limits.Global, "global-rate-limit", limits.Global, "Reports per second accepted from all devices (0 disables)")
+	fs.IntVar(&limits.GlobalBurst, "global-burst", limits.GlobalBurst, "Reports accepted at once across the fleet")
+	rateLimitRedis := fs.String("rate-limit-redis", "", "Redis URL, as in redis://:password@redis:6379/0, to keep the rate limits in, shared by every collector replica using it (default in memory)")
+	policy := retention.DefaultPolicy
+	fs.DurationVar(&policy.Reports, "retain-reports", policy.Reports, "How long raw reports are kept (0 keeps them forever)")
+	fs.DurationVar(&policy.Rollups, "retain-rollups", policy.Rollups, "How long hourly rollups are kept (0 keeps them forever)")
+	retentionInterval := fs.Duration("retention-interval", time.Hour, "How often to roll up and prune reports (0 disables)")
+	maxReportBytes := fs.Int64("max-report-bytes", handlers.DefaultMaxReportBytes, "Largest report body accepted")
+	maxBatchBytes := fs.Int64("max-batch-bytes", handlers.DefaultMaxBatchBytes, "Largest POST /reports batch body accepted")
+	serveMetrics := fs.Bool("metrics", true, "Serve Prometheus metrics on /metrics")
+	postureMaxAge := fs.Duration("posture-max-age", handlers.DefaultPostureMaxAge, "How long gateways may cache a GET /posture verdict")
+	postureTokenKey := fs.String("posture-token-key", "posture-token.key", "Ed25519 private key (PEM) posture tokens are signed with; created, with its public key in the same name plus .pub, if missing (empty disables tokens). May be a secret reference such as vault:secret/data/swg/collector#posture_token_key")
+	postureTokenTTL := fs.Duration("posture-token-ttl", handlers.DefaultPostureTokenTTL, "How long a posture token is valid")
+	events := fs.Bool("events", true, "Publish posture changes and tamper alerts on the in-process event bus, and serve it to the other services on /events")
+	multiTenant := fs.Bool("multi-tenant", false, "Partition devices, keys and reports by tenant; read endpoints then need an admin credential")
+	var tlsFiles tlsutil.Config
+	fs.StringVar(&tlsFiles.CertFile, "tls-cert", "", "PEM certificate to serve HTTPS with (reloaded when it changes, or on SIGHUP)")
+	fs.StringVar(&tlsFiles.KeyFile, "tls-key", "", "PEM private key for -tls-cert")
+	fs.StringVar(&tlsFiles.CAFile, "client-ca", "", "PEM bundle of the enrollment CA; client certificates presented are verified against it")
+	fs.StringVar(&tlsFiles.MinVersion, "tls-min-version", "1.2", "Lowest TLS version accepted: 1.2 or 1.3")
+	requireClientCert := fs.Bool("require-client-cert", false, "Require device endpoints to present a -client-ca certificate issued to the API key's device")
+	requireSigned := fs.Bool("require-signed-reports", false, "Reject reports not signed with the signing key the device registered at enrollment, as agents sign them; signatures are checked whenever present")
+	auditSyslog := fs.String("audit-syslog", "", "Also send audit events, kept in the database, to syslog: local, udp://host:514 or tcp://host:514")
+	auditWebhook := fs.String("audit-webhook", "", "Also POST audit events as JSON to this http or https URL, such as a SIEM's")
+	logOpts := logging.Options{Service: "collector"}
+	logOpts.AddFlags(fs)
+	settings, err := config.Load(fs, args, config.Options{
+		EnvPrefix: "COLLECTOR",
+		Validate: func() error {
+			switch {
+			case !*requireAuth && *multiTenant:
+				return fmt.Errorf("-multi-tenant needs -require-auth: a device's API key decides its tenant")
+			case (tlsFiles.CertFile == "") != (tlsFiles.KeyFile == ""):
+				return fmt.Errorf("-tls-cert and -tls-key must be set together")
+			case tlsFiles.CAFile != "" && tlsFiles.CertFile == "":
+				return fmt.Errorf("-client-ca needs -tls-cert and -tls-key")
+			case *requireClientCert && (tlsFiles.CAFile == "" || !*requireAuth):
+				return fmt.Errorf("-require-client-cert needs -client-ca and -require-auth: the certificate must match the API key's device")
+			case *requireSigned && !*requireAuth:
+				return fmt.Errorf("-require-signed-reports needs -require-auth: signing keys are registered with the device's API key")
+			case *postureTokenTTL <= 0:
+				return fmt.Errorf("-posture-token-ttl must be positive")
+			}
+			if *rateLimitRedis != "" {
+				if _, err := ratelimit.OpenRedis(*rateLimitRedis); err != nil {
+					return fmt.Errorf("-rate-limit-redis: %w", err)
+				}
+			}
+			if *auditWebhook != "" {
+				if u, err := url.Parse(*auditWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("-audit-webhook must be an http or https URL")
+				}
+			}
+			if err := tlsFiles.Validate(); err != nil {
+				return err
+			}
+			_, err := logging.NewHandler(logOpts)
+			return err
+		},
+	})
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if settings.Print {
+		settings.Dump(os.Stdout)
+		return 0
+	}
+
+	logger, _ := logging.New(logOpts) // checked by Validate
+	for _, name := range settings.Plaintext() {
+		logger.Warn("secret set in plaintext; give a secret reference such as env:, file:, vault: or keychain: instead", "flag", name)
+	}
+	token, err := secrets.FromFile(*adminToken, *adminTokenFile)
+	if err != nil {
+		logger.Error("invalid admin token", "error", err)
+		return 1
+	}
+	if *requireAuth && token == "" {
+		logger.Error("-require-auth needs an admin token to issue enrollment tokens: set COLLECTOR_ADMIN_TOKEN, -admin-token or -admin-token-file (or run with -require-auth=false for development)")
+		return 1
+	}
+	if !*requireAuth {
+		logger.Warn("authentication disabled, any client can submit reports")
+	}
+	var tokens *posturetoken.Issuer
+	if *postureTokenKey != "" {
+		var created bool
+		if tokens, created, err = posturetoken.LoadOrCreate(*postureTokenKey); err != nil {
+			logger.Error("invalid posture token key", "error", err)
+			return 1
+		}
+		if created {
+			logger.Info("created posture token key; give proxies its public key", "key", *postureTokenKey, "public_key", *postureTokenKey+".pub")
+		}
+		logger.Info("issuing posture tokens", "key_id", tokens.ID(), "ttl", *postureTokenTTL)
+	}
+	if *rateLimitRedis != "" {
+		redis, _ := ratelimit.OpenRedis(*rateLimitRedis) // checked by Validate
+		defer redis.Close()
+		limits.Store = redis
+		logger.Info("keeping rate limits in Redis", "redis", redis.String())
+	}
+	var certs *tlsutil.Reloader
+	if tlsFiles.CertFile != "" {
+		if certs, err = tlsutil.New(tlsFiles); err != nil {
+			logger.Error("invalid TLS configuration", "error", err)
+			return 1
+		}
+	}
+
+	reports, err := openStore(cfg, logger)
+	if err != nil {
+		logger.Error("storage unavailable", "error", err)
+		return 1
+	}
+	defer reports.Close()
+	auditLog := audit.New(handlers.AuditService, store.AuditStore(reports))
+	defer auditLog.Close()
+	if *auditSyslog != "" {
+		sink, err := audit.NewSyslog(*auditSyslog, handlers.AuditService)
+		if err != nil {
+			logger.Error("invalid -audit-syslog", "error", err)
+			return 1
+		}
+		auditLog.AddSink(sink)
+		logger.Info("sending audit events to syslog", "addr", *auditSyslog)
+	}
+	if *auditWebhook != "" {
+		sink, err := audit.NewWebhook(*auditWebhook, nil, logger)
+		if err != nil {
+			logger.Error("invalid -audit-webhook", "error", err)
+			return 1
+		}
+		auditLog.AddSink(sink)
+		u, _ := url.Parse(*auditWebhook)
+		logger.Info("sending audit events to a webhook", "url", u.Redacted())
+	}
+
+	notifier, err := loadAlerts(*alertsConfig, logger)
+	if err != nil {
+		logger.Error("invalid -alerts-config", "error", err)
+		return 1
+	}
+	var pruner *retention.Job
+	if *retentionInterval > 0 {
+		pruner = retention.NewJob(reports, policy, logger)
+	}
+	var registry *metrics.Registry
+	var httpMetrics *middleware.Metrics
+	api := reports
+	if *serveMetrics {
+		registry = metrics.New(reports, *staleAfter, pruner, logger)
+		httpMetrics = middleware.NewMetrics()
+		api = metrics.Instrument(reports, registry)
+		notifier.Observe(registry.ObserveAlert)
+	}
+	var bus eventbus.Bus
+	if *events {
+		bus = eventbus.Local()
+	}
+	mux := http.NewServeMux()
+	service := handlers.NewAPI(api, handlers.Options{
+		StaleAfter:           *staleAfter,
+		Notifier:             notifier,
+		RequireAuth:          *requireAuth,
+		RequireClientCert:    *requireClientCert,
+		RequireSignedReports: *requireSigned,
+		AdminToken:           token,
+		RateLimit:            limits,
+		MaxReportBytes:       *maxReportBytes,
+		MaxBatchBytes:        *maxBatchBytes,
+		Retention:            pruner,
+		Metrics:              registry,
+		HTTPMetrics:          httpMetrics,
+		MultiTenant:          *multiTenant,
+		PostureMaxAge:        *postureMaxAge,
+		PostureTokens:        tokens,
+		PostureTokenTTL:      *postureTokenTTL,
+		Events:               bus,
+		Audit:                auditLog,
+		Logger:               logger,
+	})
+	service.Register(mux)
+
+	run := lifecycle.New(lifecycle.Options{})
+	run.Go("alert delivery", func(ctx context.Context) error {
+		notifier.Run(ctx)
+		return nil
+	})
+	if *staleAfter > 0 {
+		watcher := alert.NewStaleWatcher(reports, *staleAfter, alert.Multi{notifier, service.Broker()}, logger)
+		run.Go("stale device scan", func(ctx context.Context) error {
+			watcher.Run(ctx, *staleCheck)
+			return nil
+		})
+	}
+	if pruner != nil {
+		run.Go("retention", func(ctx context.Context) error {
+			pruner.Run(ctx, *retentionInterval)
+			return nil
+		})
+	}
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           middleware.Chain(mux, middleware.RequestID, middleware.Log(logger), middleware.Recover(logger), httpMetrics.Middleware),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		MaxHeaderBytes:    64 << 10,
+	}
+	if certs != nil {
+		server.TLSConfig, _ = certs.ServerConfig() // -tls-cert is set
+		run.Go("TLS reload", func(ctx context.Context) error {
+			reloadCerts(ctx, certs, logger)
+			return nil
+		})
+		logger.Info("device posture collector listening", "addr", *listen, "tls", true)
+		run.Serve("server", server, func() error { return server.ListenAndServeTLS("", "") })
+	} else {
+		logger.Info("device posture collector listening", "addr", *listen)
+		run.Serve("server", server, server.ListenAndServe)
+	}
+
+	<-run.Context().Done()
+	logger.Info("shutting down")
+	if err := run.Wait(); err != nil {
+		logger.Error("collector stopped with an error", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// reloadCerts re-reads the TLS certificate and client CA on SIGHUP, besides
+// whenever they change, so they can be renewed without dropping connections
+func reloadCerts(ctx context.Context, certs *tlsutil.Reloader, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := certs.Reload(); err != nil {
+				logger.Error("TLS reload failed, keeping the current certificates", "error", err)
+				continue
+			}
+			logger.Info("reloaded TLS certificates")
+		}
+	}
+}
+
+// loadAlerts builds the alert channels from the config file, if any
+func loadAlerts(path string, logger *slog.Logger) (*alert.Channels, error) {
+	cfg := &alert.Config{}
+	if path != "" {
+		var err error
+		if cfg, err = alert.LoadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	channels, err := cfg.Channels(logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alerts config: %w", err)
+	}
+	if path != "" {
+		logger.Info("loaded alert channels", "channels", channels.Len(), "path", path)
+	}
+	return channels, nil
+}
+
+// storeConfig selects and configures the storage backend
+type storeConfig struct {
+	backend    string
+	db         string
+	password   string // for a PostgreSQL db
+	maxReports int
+	pool       store.PoolConfig
+}
+
+// openStore creates the configured storage backend
+func openStore(cfg storeConfig, logger *slog.Logger) (store.Store, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch cfg.backend {
+	case "sqlite":
+		path := cfg.db
+		if path == "" {
+			path = "collector.db"
+		}
+		logger.Info("using SQLite", "path", path)
+		return store.OpenSQLite(ctx, path)
+	case "postgres":
+		// Prefer the environment so the password doesn't show up in ps output
+		url := cfg.db
+		if url == "" {
+			url = os.Getenv("COLLECTOR_DATABASE_URL")
+		}
+		if url == "" {
+			return nil, fmt.Errorf("-store postgres needs -db or COLLECTOR_DATABASE_URL")
+		}
+		if cfg.password != "" {
+			var err error
+			if url, err = secrets.WithPassword(url, cfg.password); err != nil {
+				return nil, fmt.Errorf("-db: %w", err)
+			}
+		}
+		logger.Info("using PostgreSQL", "pool_size", cfg.pool.MaxOpenConns)
+		return store.OpenPostgres(ctx, url, cfg.pool)
+	case "memory":
+		logger.Warn("using in-memory storage; reports are lost on restart")
+		return store.NewMemory(cfg.maxReports), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q (want sqlite, postgres or memory)", cfg.backend)
+	}
+}
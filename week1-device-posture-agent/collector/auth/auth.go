@@ -0,0 +1,72 @@
+// Package auth generates and verifies the secrets devices and admins use
+// to authenticate to the collector.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Secret prefixes make leaked values easy to recognise in logs and scanners
+const (
+	PrefixEnrollmentToken = "dpe"
+	PrefixAPIKey          = "dpk"
+	PrefixTenantAdminKey  = "dpa"
+)
+
+// Secret is a newly generated credential. Value is shown to the user once;
+// only Hash is stored.
+type Secret struct {
+	Value string
+	ID    string // short, non-secret identifier derived from the hash
+	Hash  string
+}
+
+// NewSecret generates a random 256-bit secret such as "dpk_Jt8..."
+func NewSecret(prefix string) (Secret, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return Secret{}, fmt.Errorf("generate secret: %w", err)
+	}
+	value := prefix + "_" + base64.RawURLEncoding.EncodeToString(buf)
+	hash := Hash(value)
+	return Secret{Value: value, ID: prefix + "_" + hash[:12], Hash: hash}, nil
+}
+
+// Hash is the stored form of a secret. The secrets are random and long, so
+// a plain SHA-256 is enough; there is nothing to brute-force.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Equal compares a presented secret with the expected one in constant time
+func Equal(presented, expected string) bool {
+	a, b := sha256.Sum256([]byte(presented)), sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+// BearerToken returns the token from an "Authorization: Bearer" header
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Token returns the bearer token, or failing that the password of HTTP
+// Basic authentication, which is what browsers can send for the dashboard
+func Token(r *http.Request) string {
+	if token := BearerToken(r); token != "" {
+		return token
+	}
+	_, password, _ := r.BasicAuth()
+	return password
+}
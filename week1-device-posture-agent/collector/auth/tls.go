@@ -0,0 +1,14 @@
+package auth
+
+import "crypto/tls"
+
+// CertificateDevice returns the hostname a verified client certificate was
+// issued to, its subject common name. ok is false when the connection
+// carried no verified certificate.
+func CertificateDevice(state *tls.ConnectionState) (hostname string, ok bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	name := state.VerifiedChains[0][0].Subject.CommonName
+	return name, name != ""
+}
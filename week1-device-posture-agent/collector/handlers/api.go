@@ -0,0 +1,874 @@
+// Package handlers exposes the collector's HTTP API.
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/eventbus"
+	"github.com/nisatyap/shared/middleware"
+	"github.com/nisatyap/shared/openapi"
+	"github.com/nisatyap/shared/posturetoken"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/metrics"
+	"device-posture-collector/report"
+	"device-posture-collector/retention"
+	"device-posture-collector/store"
+)
+
+// DefaultMaxReportBytes caps a single report body; forwarded logs make
+// reports larger than the metrics alone
+const DefaultMaxReportBytes = 1 << 20
+
+// Options configures optional API behaviour
+type Options struct {
+	// StaleAfter is how long a device may go without reporting before it
+	// is shown as STALE; 0 disables stale detection
+	StaleAfter time.Duration
+	// Notifier receives UNHEALTHY and tamper alerts; nil only logs them
+	Notifier alert.Notifier
+	// RequireAuth rejects reports without a valid device API key
+	RequireAuth bool
+	// RequireClientCert additionally requires device endpoints to be
+	// called with a verified TLS client certificate issued to the API
+	// key's device; it only applies with RequireAuth
+	RequireClientCert bool
+	// RequireSignedReports rejects reports whose bodies aren't signed with
+	// the device's API key, as agents sign them; signatures are checked
+	// whenever present, and only with RequireAuth
+	RequireSignedReports bool
+	// AdminToken protects enrollment, key and other management endpoints;
+	// empty leaves them open
+	AdminToken string
+	// RateLimit throttles report ingestion; the zero value disables it
+	RateLimit RateLimit
+	// MaxReportBytes caps a report body; 0 means DefaultMaxReportBytes
+	MaxReportBytes int64
+	// MaxBatchBytes caps a POST /reports body; 0 means DefaultMaxBatchBytes
+	MaxBatchBytes int64
+	// Retention is the pruning job whose stats GET /retention shows; nil
+	// when retention is disabled
+	Retention *retention.Job
+	// Metrics serves GET /metrics and counts ingestion results; nil
+	// disables both
+	Metrics *metrics.Registry
+	// HTTPMetrics are the request counts served on GET /metrics alongside
+	// Metrics; the server wraps its handler in HTTPMetrics.Middleware
+	HTTPMetrics *middleware.Metrics
+	// MultiTenant serves several tenants: read endpoints then need an
+	// admin credential, and the /tenants endpoints are added
+	MultiTenant bool
+	// PostureMaxAge is how long gateways may cache GET /posture verdicts;
+	// 0 means DefaultPostureMaxAge
+	PostureMaxAge time.Duration
+	// PostureTokens signs the posture tokens devices present to the
+	// gateway; nil disables POST /posture/token
+	PostureTokens *posturetoken.Issuer
+	// PostureTokenTTL is how long a posture token is valid; 0 means
+	// DefaultPostureTokenTTL
+	PostureTokenTTL time.Duration
+	// Events receives posture changes and tamper alerts for the other
+	// services, and is served to them on /events; nil disables both
+	Events eventbus.Bus
+	// Audit records enrollments, key and policy changes and admin
+	// sign-ins; nil records them in the store alone
+	Audit *audit.Log
+	// Logger is what the API logs to; nil logs with slog.Default()
+	Logger *slog.Logger
+}
+
+// API serves report ingestion and queries backed by a Store
+type API struct {
+	store    store.Store
+	opts     Options
+	limiter  *rateLimiter
+	stream   *Broker
+	policies policyCache
+	logins   *audit.Logins
+	now      func() time.Time
+	log      *slog.Logger
+}
+
+// NewAPI creates an API over the given store
+func NewAPI(s store.Store, opts Options) *API {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Notifier == nil {
+		opts.Notifier = alert.Log{Logger: opts.Logger}
+	}
+	stream := NewBroker()
+	stream.bus = opts.Events
+	stream.log = opts.Logger
+	opts.Notifier = alert.Multi{opts.Notifier, stream}
+	if opts.MaxReportBytes <= 0 {
+		opts.MaxReportBytes = DefaultMaxReportBytes
+	}
+	if opts.MaxBatchBytes <= 0 {
+		opts.MaxBatchBytes = DefaultMaxBatchBytes
+	}
+	if opts.PostureMaxAge <= 0 {
+		opts.PostureMaxAge = DefaultPostureMaxAge
+	}
+	if opts.PostureTokenTTL <= 0 {
+		opts.PostureTokenTTL = DefaultPostureTokenTTL
+	}
+	if opts.Audit == nil {
+		opts.Audit = audit.New(AuditService, store.AuditStore(s))
+	}
+	return &API{
+		store: s, opts: opts, limiter: newRateLimiter(opts.RateLimit), stream: stream,
+		logins: audit.NewLogins(opts.Audit, adminLoginWindow), now: time.Now, log: opts.Logger,
+	}
+}
+
+// Register adds the API routes to mux, with their OpenAPI document on
+// GET /openapi.json
+func (a *API) Register(mux *http.ServeMux) {
+	spec := a.spec()
+	device, admin, viewer, superAdmin := a.security(spec)
+	api := spec.Mux(mux)
+	api.HandleFunc("GET /{$}", a.Index, openapi.Operation{
+		Summary:  "Endpoint index",
+		Response: openapi.Object{"service": "", "endpoints": map[string]string{}},
+	})
+	api.HandleFunc("GET /health", a.Health, openapi.Operation{
+		Summary:  "Collector health check",
+		Response: openapi.Object{"status": "", "service": "", "timestamp": time.Time{}},
+	})
+	health := openapi.Object{"status": "", "checks": openapi.Optional(map[string]string{})}
+	api.Handle("GET /healthz", middleware.Healthz(map[string]middleware.Check{"store": a.checkStore}), openapi.Operation{
+		Summary:   "Readiness check, 503 while storage is unavailable",
+		Response:  health,
+		Responses: map[int]any{http.StatusServiceUnavailable: health},
+	})
+	api.HandleFunc("GET /schema", a.Schema, openapi.Operation{
+		Summary:  "Accepted report schema versions",
+		Response: openapi.Object{"current": 0, "min": 0, "max_clock_skew": ""},
+	})
+	api.HandleFunc("POST /report", a.countReports(a.requireDevice(a.limitReports(a.ReceiveReport))), openapi.Operation{
+		Summary:     "Submit a device status report",
+		Description: "A delta report leaves out the sections it names in unchanged, which are taken from the device's previous report; without one it is answered 409.",
+		Auth:        device,
+		Request:     report.DeviceStatus{},
+		Response:    Ack{},
+	})
+	api.HandleFunc("POST /reports", a.countBatches(a.requireDevice(a.limitReports(a.ReceiveBatch))), openapi.Operation{
+		Summary:  "Submit an array of reports in one transaction, with per-report results",
+		Auth:     device,
+		Request:  []report.DeviceStatus{},
+		Response: BatchResponse{},
+	})
+	api.HandleFunc("GET /reports", a.requireViewer(a.ListReports), openapi.Operation{
+		Summary:  "List reports",
+		Auth:     viewer,
+		Query:    openapi.Params("hostname", "status", "mismatch:boolean", "limit:integer"),
+		Response: openapi.Object{"total": 0, "reports": []store.StoredReport{}},
+	})
+	api.HandleFunc("GET /reports/unhealthy", a.requireViewer(a.ListUnhealthy), openapi.Operation{
+		Summary:  "List reports from unhealthy devices",
+		Auth:     viewer,
+		Query:    openapi.Params("limit:integer"),
+		Response: openapi.Object{"total": 0, "reports": []store.StoredReport{}},
+	})
+	api.HandleFunc("GET /reports/{hostname}", a.requireViewer(a.DeviceReports), openapi.Operation{
+		Summary:  "List a device's reports",
+		Auth:     viewer,
+		Query:    openapi.Params("limit:integer"),
+		Response: openapi.Object{"total": 0, "reports": []store.StoredReport{}},
+	})
+	api.HandleFunc("GET /export/reports", a.requireViewer(a.ExportReports), openapi.Operation{
+		Summary:      "Stream reports as CSV or NDJSON",
+		Auth:         viewer,
+		Query:        openapi.Params("format", "hostname", "status", "since", "until", "cursor:integer", "limit:integer"),
+		ResponseType: "text/csv, application/x-ndjson",
+	})
+	api.HandleFunc("DELETE /reports", a.requireAdmin(a.ClearReports), openapi.Operation{
+		Summary:  "Delete every report",
+		Auth:     admin,
+		Response: openapi.Object{"deleted": 0},
+	})
+	api.HandleFunc("GET /devices", a.requireViewer(a.ListDevices), openapi.Operation{
+		Summary:  "List devices with their latest status",
+		Auth:     viewer,
+		Query:    openapi.Params("tag"),
+		Response: openapi.Object{"total": 0, "devices": []store.Device{}},
+	})
+	api.HandleFunc("GET /devices/stale", a.requireViewer(a.ListStale), openapi.Operation{
+		Summary:  "Devices that stopped reporting",
+		Auth:     viewer,
+		Query:    openapi.Params("tag"),
+		Response: openapi.Object{"total": 0, "stale_after": "", "devices": []store.Device{}},
+	})
+	api.HandleFunc("GET /fleet/summary", a.requireViewer(a.FleetSummary), openapi.Operation{
+		Summary:  "Fleet posture summary",
+		Auth:     viewer,
+		Query:    openapi.Params("group_by", "tag", "top:integer"),
+		Response: Fleet{},
+	})
+	api.HandleFunc("GET /devices/{hostname}", a.requireViewer(a.GetDevice), openapi.Operation{
+		Summary:  "Latest status of one device",
+		Auth:     viewer,
+		Response: store.Device{},
+	})
+	api.HandleFunc("GET /posture", a.requireViewer(a.Posture), openapi.Operation{
+		Summary:  "Compliance verdict for a gateway",
+		Auth:     viewer,
+		Query:    openapi.Params("ip", "device_id"),
+		Response: PostureVerdict{},
+	})
+	if a.opts.PostureTokens != nil {
+		api.HandleFunc("POST /posture/token", a.requireDevice(a.PostureToken), openapi.Operation{
+			Summary:  "Signed, short-lived posture token for the calling device to present to the gateway",
+			Auth:     device,
+			Query:    openapi.Params("device_id"),
+			Response: PostureTokenResponse{},
+		})
+		api.HandleFunc("GET /posture/keys", a.PostureKeys, openapi.Operation{
+			Summary:  "Public keys that posture tokens are signed with",
+			Response: openapi.Object{"keys": []PostureTokenKey{}},
+		})
+	}
+	api.HandleFunc("GET /devices/{hostname}/history", a.requireViewer(a.DeviceHistory), openapi.Operation{
+		Summary:  "Report history",
+		Auth:     viewer,
+		Query:    openapi.Params("since", "until", "fields", "order", "limit:integer", "cursor:integer"),
+		Response: History{},
+	})
+	api.HandleFunc("GET /devices/{hostname}/rollups", a.requireViewer(a.DeviceRollups), openapi.Operation{
+		Summary:  "Hourly summaries kept after reports are pruned",
+		Auth:     viewer,
+		Query:    openapi.Params("since", "until"),
+		Response: openapi.Object{"hostname": "", "interval": "", "count": 0, "rollups": []store.Rollup{}},
+	})
+	api.HandleFunc("PUT /devices/{hostname}/tags", a.requireAdmin(a.SetTags), openapi.Operation{
+		Summary:  "Replace a device's tags",
+		Auth:     admin,
+		Request:  map[string]string{},
+		Response: store.Device{},
+	})
+	api.HandleFunc("PATCH /devices/{hostname}/tags", a.requireAdmin(a.PatchTags), openapi.Operation{
+		Summary:  "Merge tags into a device's tags; null removes one",
+		Auth:     admin,
+		Request:  map[string]*string{},
+		Response: store.Device{},
+	})
+	api.HandleFunc("GET /devices/{hostname}/keys", a.requireAdmin(a.ListKeys), openapi.Operation{
+		Summary:  "A device's API keys, without their secrets",
+		Auth:     admin,
+		Response: openapi.Object{"total": 0, "keys": []store.APIKey{}},
+	})
+	api.HandleFunc("DELETE /devices/{hostname}/keys", a.requireAdmin(a.RevokeKeys), openapi.Operation{
+		Summary:  "Revoke a device's API keys",
+		Auth:     admin,
+		Response: openapi.Object{"hostname": "", "revoked": 0},
+	})
+	api.HandleFunc("POST /enrollment-tokens", a.requireAdmin(a.CreateEnrollmentToken), openapi.Operation{
+		Summary:  "Issue a one-time enrollment token",
+		Auth:     admin,
+		Request:  openapi.Object{"ttl": openapi.Optional(""), "tags": openapi.Optional(map[string]string{})},
+		Status:   http.StatusCreated,
+		Response: openapi.Object{"id": "", "tenant": "", "tags": map[string]string{}, "token": "", "expires_at": time.Time{}},
+	})
+	api.HandleFunc("GET /enrollment-tokens", a.requireAdmin(a.ListEnrollmentTokens), openapi.Operation{
+		Summary:  "List enrollment tokens",
+		Auth:     admin,
+		Response: openapi.Object{"total": 0, "tokens": []store.EnrollmentToken{}},
+	})
+	api.HandleFunc("GET /retention", a.requireViewer(a.Retention), openapi.Operation{
+		Summary:  "Retention policy and pruned row counts",
+		Auth:     viewer,
+		Response: openapi.Object{"enabled": false, "stats": openapi.Optional(retention.Stats{})},
+	})
+	api.HandleFunc("GET /policy", a.requireViewer(a.GetPolicy), openapi.Operation{
+		Summary:  "The posture policy the collector evaluates reports against",
+		Auth:     viewer,
+		Response: store.Policy{},
+	})
+	api.HandleFunc("PUT /policy", a.requireAdmin(a.SetPolicy), openapi.Operation{
+		Summary:  "Set the posture policy the collector evaluates reports against",
+		Auth:     admin,
+		Request:  map[string]any{},
+		Response: store.Policy{},
+	})
+	api.HandleFunc("DELETE /policy", a.requireAdmin(a.DeletePolicy), openapi.Operation{
+		Summary:  "Remove the posture policy",
+		Auth:     admin,
+		Response: openapi.Object{"deleted": true},
+	})
+	api.HandleFunc("GET /audit", a.requireAdmin(a.ListAudit), openapi.Operation{
+		Summary:  "Audit log of enrollments, key and policy changes and admin sign-ins",
+		Auth:     admin,
+		Query:    openapi.Params("actor", "action", "object", "since", "until", "limit:integer"),
+		Response: openapi.Object{"total": 0, "events": []audit.Event{}},
+	})
+	api.HandleFunc("GET /audit/verify", a.requireSuperAdmin(a.VerifyAudit), openapi.Operation{
+		Summary:   "Verify the audit log's hash chain",
+		Auth:      superAdmin,
+		Response:  openapi.Object{"ok": false, "events": 0},
+		Responses: map[int]any{http.StatusConflict: openapi.Object{"ok": false, "events": 0, "error": ""}},
+	})
+	api.HandleFunc("POST /enroll", a.Enroll, openapi.Operation{
+		Summary:  "Enroll a device with a one-time token, for its API key",
+		Request:  openapi.Object{"token": "", "hostname": ""},
+		Status:   http.StatusCreated,
+		Response: Credential{},
+	})
+	api.HandleFunc("POST /keys/rotate", a.requireDevice(a.RotateKey), openapi.Operation{
+		Summary:  "Replace the calling device's API key",
+		Auth:     device,
+		Response: openapi.Object{"tenant": "", "hostname": "", "key_id": "", "api_key": "", "previous_expires_at": time.Time{}},
+	})
+	if a.opts.Metrics != nil {
+		api.Handle("GET /metrics", a.opts.HTTPMetrics.Handler(a.opts.Metrics), openapi.Operation{
+			Summary:      "Prometheus metrics",
+			ResponseType: "text/plain",
+		})
+	}
+	if a.opts.MultiTenant {
+		api.HandleFunc("POST /tenants", a.requireSuperAdmin(a.CreateTenant), openapi.Operation{
+			Summary:  "Create a tenant and its admin key",
+			Auth:     superAdmin,
+			Request:  openapi.Object{"id": "", "name": openapi.Optional("")},
+			Status:   http.StatusCreated,
+			Response: openapi.Object{"tenant": store.Tenant{}, "admin_key": ""},
+		})
+		api.HandleFunc("GET /tenants", a.requireSuperAdmin(a.ListTenants), openapi.Operation{
+			Summary:  "List tenants",
+			Auth:     superAdmin,
+			Response: openapi.Object{"total": 0, "tenants": []store.Tenant{}},
+		})
+		api.HandleFunc("POST /tenants/{id}/admin-key", a.requireSuperAdmin(a.RotateTenantAdminKey), openapi.Operation{
+			Summary:  "Replace a tenant's admin key",
+			Auth:     superAdmin,
+			Response: openapi.Object{"tenant": "", "admin_key": ""},
+		})
+	}
+	grafana := openapi.Operation{Summary: "Grafana JSON data source connection test", Auth: viewer, Response: openapi.Object{"status": ""}}
+	api.HandleFunc("GET /grafana", a.requireViewer(a.GrafanaTest), grafana)
+	api.HandleFunc("GET /grafana/{$}", a.requireViewer(a.GrafanaTest), grafana)
+	api.HandleFunc("POST /grafana/search", a.requireViewer(a.GrafanaSearch), openapi.Operation{
+		Summary:  "Grafana metric names",
+		Auth:     viewer,
+		Response: []string{},
+	})
+	api.HandleFunc("POST /grafana/metrics", a.requireViewer(a.GrafanaMetrics), openapi.Operation{
+		Summary:  "Grafana metric names, with labels",
+		Auth:     viewer,
+		Response: []map[string]string{},
+	})
+	api.HandleFunc("POST /grafana/query", a.requireViewer(a.GrafanaQuery), openapi.Operation{
+		Summary:  "Fleet time series and tables for Grafana's JSON data source",
+		Auth:     viewer,
+		Request:  grafanaQuery{},
+		Response: []any{},
+	})
+	api.HandleFunc("POST /grafana/tag-keys", a.requireViewer(a.GrafanaTagKeys), openapi.Operation{
+		Summary:  "Grafana ad hoc filter keys",
+		Auth:     viewer,
+		Response: []map[string]string{},
+	})
+	api.HandleFunc("POST /grafana/tag-values", a.requireViewer(a.GrafanaTagValues), openapi.Operation{
+		Summary:  "Grafana ad hoc filter values of a key",
+		Auth:     viewer,
+		Request:  openapi.Object{"key": ""},
+		Response: []map[string]string{},
+	})
+	api.HandleFunc("GET /stream", a.requireViewer(a.StreamEvents), openapi.Operation{
+		Summary:      "Live reports, transitions and alerts as Server-Sent Events",
+		Auth:         viewer,
+		Query:        openapi.Params("hostname", "types"),
+		ResponseType: "text/event-stream",
+	})
+	if a.opts.Events != nil {
+		// Events span tenants
+		events := a.requireSuperAdmin(eventbus.Handler(a.opts.Events).ServeHTTP)
+		api.HandleFunc("GET /events", events, openapi.Operation{
+			Summary:      "Event bus posture changes and tamper alerts for the other services",
+			Auth:         superAdmin,
+			Query:        openapi.Params("subject"),
+			ResponseType: "text/event-stream",
+		})
+		api.HandleFunc("POST /events", events, openapi.Operation{
+			Summary: "Publish an event on the event bus",
+			Auth:    superAdmin,
+			Request: openapi.Object{"subject": "", "data": nil},
+			Status:  http.StatusNoContent,
+		})
+	}
+	api.HandleFunc("GET /dashboard", a.requireViewer(a.Dashboard), openapi.Operation{
+		Summary:      "Fleet dashboard",
+		Auth:         viewer,
+		ResponseType: "text/html",
+	})
+	api.HandleFunc("GET /dashboard/devices/{hostname}", a.requireViewer(a.DashboardDevice), openapi.Operation{
+		Summary:      "Device dashboard",
+		Auth:         viewer,
+		ResponseType: "text/html",
+	})
+	mux.Handle("GET /openapi.json", spec)
+}
+
+// spec starts the API's OpenAPI document, with errorResponse as the body
+// of every error
+func (a *API) spec() *openapi.Spec {
+	spec := openapi.New(openapi.Info{
+		Title:       "Device Posture Collector",
+		Version:     "1.0.0",
+		Description: "Receives device posture reports and answers fleet and access queries.",
+	})
+	spec.Errors(errorResponse{})
+	return spec
+}
+
+// security adds the security schemes authentication is configured to
+// enforce, returning the names routes guarded by requireDevice,
+// requireAdmin, requireViewer and requireSuperAdmin need; empty when such
+// routes are open
+func (a *API) security(spec *openapi.Spec) (device, admin, viewer, superAdmin string) {
+	if a.opts.RequireAuth {
+		device = "deviceKey"
+		spec.Security(device, openapi.Bearer("A device API key, issued by POST /enroll"))
+	}
+	if a.opts.AdminToken != "" {
+		admin, superAdmin = "adminToken", "adminToken"
+		description := "The admin token"
+		if a.opts.MultiTenant {
+			description += ", or a tenant's admin key outside the /tenants and /events endpoints"
+		}
+		spec.Security(admin, openapi.Bearer(description))
+	}
+	if a.opts.MultiTenant {
+		viewer = admin
+	}
+	return device, admin, viewer, superAdmin
+}
+
+// Ack is the structured acknowledgement returned for an accepted report
+type Ack struct {
+	Accepted      bool      `json:"accepted"`
+	ReportID      int64     `json:"report_id"`
+	Device        string    `json:"device"`
+	Status        string    `json:"status"`
+	Alert         bool      `json:"alert"`
+	ReceivedAt    time.Time `json:"received_at"`
+	Msg           string    `json:"msg"`
+	SchemaVersion int       `json:"schema_version"` // version the report was read as
+	// ServerStatus is the collector's verdict when a policy is set
+	ServerStatus   string `json:"server_status,omitempty"`
+	PolicyMismatch bool   `json:"policy_mismatch,omitempty"`
+	// Dedup is "replay" when the report's idempotency key was already
+	// stored and "repeat" when it was folded into the previous report;
+	// ReportID is then that earlier report
+	Dedup string `json:"dedup,omitempty"`
+}
+
+// errorResponse is the body of every non-2xx reply
+type errorResponse struct {
+	Error   string              `json:"error"`
+	Details []report.FieldError `json:"details,omitempty"`
+}
+
+func (a *API) Index(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"service": "Device Posture Collector",
+		"endpoints": map[string]string{
+			"POST /report":                "Submit a device status report",
+			"POST /reports":               "Submit an array of reports in one transaction, with per-report results",
+			"GET /reports":                "List reports (?hostname=&status=&mismatch=true&limit=)",
+			"GET /reports/unhealthy":      "List reports from unhealthy devices",
+			"GET /devices":                "List devices with their latest status (?tag=site:ams)",
+			"GET /devices/stale":          "Devices that stopped reporting",
+			"GET /export/reports":         "Stream reports as CSV or NDJSON (?format=&since=&cursor=&limit=)",
+			"GET /fleet/summary":          "Fleet posture summary (?group_by=site&tag=&top=5)",
+			"GET /devices/{host}":         "Latest status of one device",
+			"GET /posture":                "Compliance verdict for a gateway (?ip=&device_id=)",
+			"POST /posture/token":         "Signed, short-lived posture token for the calling device to present to the gateway",
+			"GET /posture/keys":           "Public keys that posture tokens are signed with",
+			"PUT /devices/{host}/tags":    "Replace a device's tags (PATCH merges)",
+			"GET /devices/{host}/history": "Report history (?since=7d&until=&fields=&order=&limit=&cursor=)",
+			"GET /devices/{host}/rollups": "Hourly summaries kept after reports are pruned (?since=90d&until=)",
+			"GET /retention":              "Retention policy and pruned row counts",
+			"PUT /policy":                 "Set the posture policy the collector evaluates reports against",
+			"GET /audit":                  "Audit log of enrollments, key and policy changes and admin sign-ins (?action=&since=&limit=)",
+			"GET /dashboard":              "Fleet dashboard (HTML)",
+			"GET /health":                 "Collector health check",
+			"GET /healthz":                "Readiness check, 503 while storage is unavailable",
+			"GET /metrics":                "Prometheus metrics",
+			"GET /stream":                 "Live reports, transitions and alerts as Server-Sent Events",
+			"GET /events":                 "Event bus posture changes and tamper alerts for the other services (?subject=posture.>)",
+			"POST /grafana/query":         "Fleet time series for Grafana's JSON data source",
+			"POST /tenants":               "Create a tenant and its admin key (multi-tenant mode)",
+			"GET /schema":                 "Accepted report schema versions",
+			"GET /openapi.json":           "OpenAPI 3 document of this API",
+		},
+	})
+}
+
+// Schema tells agents which report schema versions are accepted
+func (a *API) Schema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"current":        report.SchemaCurrent,
+		"min":            report.SchemaLegacy,
+		"max_clock_skew": report.MaxClockSkew.String(),
+	})
+}
+
+func (a *API) Health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":    "healthy",
+		"service":   "collector",
+		"timestamp": a.now().UTC(),
+	})
+}
+
+// checkStore tells /healthz whether storage answers, with a lookup that
+// finds nothing but still goes to the database
+func (a *API) checkStore(ctx context.Context) error {
+	if _, err := a.store.GetDevice(ctx, ""); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// ReceiveReport validates and stores one DeviceStatus. An Idempotency-Key
+// header stands in for the report's idempotency_key field.
+func (a *API) ReceiveReport(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r, a.opts.MaxReportBytes, "report")
+	if !ok || !a.checkSignature(w, r, body) {
+		return
+	}
+	status, code, rejection := a.checkReport(r, body, r.Header.Get("Idempotency-Key"))
+	if code != 0 {
+		writeJSON(w, code, rejection)
+		return
+	}
+
+	previous := a.previousDevice(r.Context(), status.Hostname)
+	verdict := a.evaluate(r.Context(), status)
+	stored, err := a.store.SaveReport(r.Context(), status, verdict, a.now().UTC())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to store report", "device", status.Hostname, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to store report", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.acceptReport(r.Context(), previous, &stored))
+}
+
+// readBody reads a request body of at most limit bytes, answering 413 or
+// 400 and returning false when it can't
+func readBody(w http.ResponseWriter, r *http.Request, limit int64, what string) ([]byte, bool) {
+	// Refuse declared oversize bodies before reading anything
+	if r.ContentLength > limit {
+		writeError(w, http.StatusRequestEntityTooLarge, what+" exceeds size limit", nil)
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, what+" exceeds size limit", nil)
+			return nil, false
+		}
+		writeError(w, http.StatusBadRequest, "failed to read "+what+": "+err.Error(), nil)
+		return nil, false
+	}
+	return body, true
+}
+
+// checkReport decodes and validates one report, giving it key unless it
+// carries its own. When it is rejected, code is the response status and
+// rejection the body explaining why.
+func (a *API) checkReport(r *http.Request, body []byte, key string) (status *report.DeviceStatus, code int, rejection errorResponse) {
+	status, err := report.Decode(body)
+	if err == nil && key != "" {
+		switch status.IdempotencyKey {
+		case "":
+			status.IdempotencyKey = key
+		case key:
+		default:
+			err = &report.ValidationError{Fields: []report.FieldError{{
+				Field: "idempotency_key", Message: "does not match the Idempotency-Key header",
+			}}}
+		}
+	}
+	if err == nil {
+		err = status.Validate(a.now())
+	}
+	if err != nil {
+		var verr *report.ValidationError
+		if errors.As(err, &verr) {
+			a.opts.Metrics.ObserveValidation(verr.Fields)
+			return nil, http.StatusUnprocessableEntity, errorResponse{Error: "invalid report", Details: verr.Fields}
+		}
+		return nil, http.StatusBadRequest, errorResponse{Error: "malformed JSON: " + err.Error()}
+	}
+
+	if device, ok := authenticatedDevice(r.Context()); ok && device != status.Hostname {
+		a.log.WarnContext(r.Context(), "rejected report signed by another device's key", "device", status.Hostname, "key_device", device)
+		return nil, http.StatusForbidden, errorResponse{Error: "API key belongs to a different device"}
+	}
+	if len(status.Unchanged) > 0 {
+		if code, rejection := a.fillUnchanged(r.Context(), status); code != 0 {
+			return nil, code, rejection
+		}
+	}
+	return status, 0, errorResponse{}
+}
+
+// fillUnchanged completes a delta report from the device's latest stored
+// report. Without one, it is answered 409 for the agent to resend it in
+// full.
+func (a *API) fillUnchanged(ctx context.Context, status *report.DeviceStatus) (int, errorResponse) {
+	latest, err := a.store.ListReports(ctx, store.Filter{Hostname: status.Hostname, Limit: 1})
+	if err != nil {
+		a.log.ErrorContext(ctx, "failed to load the latest report", "device", status.Hostname, "error", err)
+		return http.StatusInternalServerError, errorResponse{Error: "failed to load the previous report"}
+	}
+	if len(latest) == 0 {
+		return http.StatusConflict, errorResponse{Error: "no previous report to take the unchanged sections from; send the report in full"}
+	}
+	status.FillUnchanged(&latest[0].DeviceStatus)
+	return 0, errorResponse{}
+}
+
+// previousDevice loads a device's record before a new report replaces it.
+// It tells whether the report is a transition, and carries the tags alerts
+// are routed by.
+func (a *API) previousDevice(ctx context.Context, hostname string) store.Device {
+	previous, err := a.store.GetDevice(ctx, hostname)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		a.log.ErrorContext(ctx, "failed to load device", "device", hostname, "error", err)
+	}
+	return previous
+}
+
+// acceptReport acknowledges a stored report, flags policy disagreement,
+// and publishes the report and its alerts. A replayed report was handled
+// the first time it arrived and is only acknowledged again.
+func (a *API) acceptReport(ctx context.Context, previous store.Device, stored *store.StoredReport) Ack {
+	ack := Ack{
+		Accepted:      true,
+		ReportID:      stored.ID,
+		Device:        stored.Hostname,
+		Status:        stored.Status,
+		ReceivedAt:    stored.ReceivedAt,
+		Msg:           "Report received successfully",
+		SchemaVersion: stored.SchemaVersion,
+		Dedup:         stored.Dedup,
+	}
+	if stored.Dedup != "" {
+		a.opts.Metrics.ObserveDedup(stored.Dedup)
+	}
+	if stored.Dedup == store.DedupReplay {
+		ack.Msg = "Duplicate report; already stored"
+		a.log.InfoContext(ctx, "report replayed", "device", stored.Hostname, "report_id", stored.ID)
+		return ack
+	}
+	if verdict := stored.Server; verdict != nil {
+		ack.ServerStatus = verdict.Status
+		ack.PolicyMismatch = stored.PolicyMismatch
+		if stored.PolicyMismatch {
+			a.log.WarnContext(ctx, "policy disagreement", "device", stored.Hostname, "agent_status", stored.Status, "agent_score", stored.Score,
+				"policy_version", verdict.PolicyVersion, "policy_status", verdict.Status, "policy_score", verdict.Score)
+			a.opts.Metrics.ObservePolicyMismatch(stored.Status, verdict.Status)
+		}
+	}
+	if stored.Status == report.StatusUnhealthy {
+		ack.Alert = true
+		ack.Msg = "Report received - UNHEALTHY device detected"
+	}
+	a.log.InfoContext(ctx, "report", "device", stored.Hostname, "ip", stored.IP, "status", stored.Status, "score", stored.Score)
+	a.stream.publishReport(previous, previous.Hostname != "" && a.isStale(previous), stored)
+	// A repeat carries nothing the previous report didn't already alert on
+	if stored.Dedup != store.DedupRepeat {
+		a.raiseAlerts(ctx, previous, stored)
+	}
+	return ack
+}
+
+// raiseAlerts notifies when a device becomes UNHEALTHY and whenever its
+// agent reports tamper findings
+func (a *API) raiseAlerts(ctx context.Context, previous store.Device, stored *store.StoredReport) {
+	event := alert.Event{
+		Tenant:        stored.Tenant,
+		Device:        stored.Hostname,
+		IP:            stored.IP,
+		Status:        stored.Status,
+		Score:         stored.Score,
+		FailingChecks: stored.FailingChecks,
+		Tags:          previous.Tags,
+		Message:       stored.Message,
+		LastSeen:      stored.ReceivedAt,
+		Time:          stored.ReceivedAt,
+	}
+
+	var events []alert.Event
+	if stored.Status == report.StatusUnhealthy && previous.Status != report.StatusUnhealthy {
+		e := event
+		e.Kind = alert.KindUnhealthy
+		events = append(events, e)
+	}
+	if len(stored.Tamper) > 0 {
+		e := event
+		e.Kind = alert.KindTamper
+		e.Tamper = stored.Tamper
+		events = append(events, e)
+	}
+	for _, e := range events {
+		if err := a.opts.Notifier.Notify(ctx, e); err != nil {
+			a.log.ErrorContext(ctx, "failed to send alert", "kind", e.Kind, "device", e.Device, "error", err)
+		}
+	}
+}
+
+func (a *API) ListReports(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r, 50)
+	if !ok {
+		return
+	}
+	a.writeReports(w, r, store.Filter{
+		Hostname: r.URL.Query().Get("hostname"),
+		Status:   r.URL.Query().Get("status"),
+		Mismatch: r.URL.Query().Get("mismatch") == "true",
+		Limit:    limit,
+	})
+}
+
+func (a *API) ListUnhealthy(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r, 50)
+	if !ok {
+		return
+	}
+	a.writeReports(w, r, store.Filter{Status: report.StatusUnhealthy, Limit: limit})
+}
+
+func (a *API) DeviceReports(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r, 10)
+	if !ok {
+		return
+	}
+	a.writeReports(w, r, store.Filter{Hostname: r.PathValue("hostname"), Limit: limit})
+}
+
+func (a *API) writeReports(w http.ResponseWriter, r *http.Request, filter store.Filter) {
+	reports, err := a.store.ListReports(r.Context(), filter)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to list reports", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list reports", nil)
+		return
+	}
+	if reports == nil {
+		reports = []store.StoredReport{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total": len(reports), "reports": reports})
+}
+
+func (a *API) ClearReports(w http.ResponseWriter, r *http.Request) {
+	n, err := a.store.DeleteReports(r.Context())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to clear reports", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to clear reports", nil)
+		return
+	}
+	a.audit(r, audit.Event{Action: "reports.delete", Detail: fmt.Sprintf("%d reports", n)})
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": n})
+}
+
+func (a *API) ListDevices(w http.ResponseWriter, r *http.Request) {
+	devices, ok := a.listDevices(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total": len(devices), "devices": devices})
+}
+
+// ListStale lists devices that have not reported within the stale window
+func (a *API) ListStale(w http.ResponseWriter, r *http.Request) {
+	devices, ok := a.listDevices(w, r)
+	if !ok {
+		return
+	}
+	stale := []store.Device{}
+	for _, d := range devices {
+		if d.Stale {
+			stale = append(stale, d)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"total":       len(stale),
+		"stale_after": a.opts.StaleAfter.String(),
+		"devices":     stale,
+	})
+}
+
+// listDevices loads the devices matching the request's ?tag= filters and
+// flags the stale ones, writing an error response and returning false on
+// failure
+func (a *API) listDevices(w http.ResponseWriter, r *http.Request) ([]store.Device, bool) {
+	selector, ok := parseTagSelector(w, r)
+	if !ok {
+		return nil, false
+	}
+	devices, err := a.store.ListDevices(r.Context())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to list devices", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list devices", nil)
+		return nil, false
+	}
+	devices = filterTags(devices, selector)
+	for i := range devices {
+		devices[i].Stale = a.isStale(devices[i])
+	}
+	if devices == nil {
+		devices = []store.Device{}
+	}
+	return devices, true
+}
+
+// isStale reports whether d has missed the stale window
+func (a *API) isStale(d store.Device) bool {
+	return alert.IsStale(d.LastSeen, a.now(), a.opts.StaleAfter)
+}
+
+func (a *API) GetDevice(w http.ResponseWriter, r *http.Request) {
+	device, err := a.store.GetDevice(r.Context(), r.PathValue("hostname"))
+	if a.deviceError(w, err) {
+		return
+	}
+	device.Stale = a.isStale(device)
+	writeJSON(w, http.StatusOK, device)
+}
+
+// parseLimit reads ?limit=, writing a 400 and returning false if invalid
+func parseLimit(w http.ResponseWriter, r *http.Request, def int) (int, bool) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return def, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		writeError(w, http.StatusBadRequest, "limit must be a non-negative integer", nil)
+		return 0, false
+	}
+	return limit, true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string, details []report.FieldError) {
+	writeJSON(w, code, errorResponse{Error: msg, Details: details})
+}
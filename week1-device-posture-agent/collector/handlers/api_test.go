@@ -0,0 +1,1160 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/eventbus"
+	"github.com/nisatyap/shared/middleware"
+	"github.com/nisatyap/shared/openapi"
+	"github.com/nisatyap/shared/posturetoken"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/metrics"
+	"device-posture-collector/store"
+)
+
+const validReport = `{"hostname":"laptop-1","ip":"10.0.0.5","disk_usage":95.5,"cpu_usage":12,"memory_usage":40,
+	"status":"UNHEALTHY","score":50,"failing_checks":["disk_usage"],"timestamp":"2024-05-01T10:00:00Z"}`
+
+func newTestServer() *http.ServeMux {
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{StaleAfter: time.Hour}).Register(mux)
+	return mux
+}
+
+func do(mux *http.ServeMux, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func TestReceiveReport(t *testing.T) {
+	mux := newTestServer()
+
+	rec := do(mux, http.MethodPost, "/report", validReport)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /report = %d: %s", rec.Code, rec.Body)
+	}
+	var ack Ack
+	json.Unmarshal(rec.Body.Bytes(), &ack)
+	if !ack.Accepted || !ack.Alert || ack.ReportID != 1 || ack.Device != "laptop-1" {
+		t.Errorf("unexpected ack %+v", ack)
+	}
+
+	rec = do(mux, http.MethodGet, "/devices/laptop-1", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"UNHEALTHY"`) {
+		t.Errorf("GET /devices/laptop-1 = %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(mux, http.MethodGet, "/reports/unhealthy", "")
+	if !strings.Contains(rec.Body.String(), `"total":1`) {
+		t.Errorf("GET /reports/unhealthy = %s", rec.Body)
+	}
+}
+
+func TestReceiveReportRejectsInvalid(t *testing.T) {
+	mux := newTestServer()
+
+	tests := []struct {
+		body  string
+		code  int
+		field string
+	}{
+		{`{not json`, http.StatusBadRequest, ""},
+		{strings.Replace(validReport, `"10.0.0.5"`, `"nope"`, 1), http.StatusUnprocessableEntity, "ip"},
+		{strings.Replace(validReport, `95.5`, `195.5`, 1), http.StatusUnprocessableEntity, "disk_usage"},
+		{strings.Replace(validReport, `"UNHEALTHY"`, `"FINE"`, 1), http.StatusUnprocessableEntity, "status"},
+		{strings.Replace(validReport, `2024-05-01`, `2999-05-01`, 1), http.StatusUnprocessableEntity, "timestamp"},
+		{`{"schema_version":9,` + validReport[1:], http.StatusUnprocessableEntity, "schema_version"},
+		{`{"schema_version":2,"extra":1,` + validReport[1:], http.StatusUnprocessableEntity, "extra"},
+	}
+	for _, tt := range tests {
+		rec := do(mux, http.MethodPost, "/report", tt.body)
+		if rec.Code != tt.code {
+			t.Errorf("POST /report %q = %d; want %d", tt.body, rec.Code, tt.code)
+		}
+		if tt.field != "" && !strings.Contains(rec.Body.String(), `"field":"`+tt.field+`"`) {
+			t.Errorf("error for %q does not name field %s: %s", tt.body, tt.field, rec.Body)
+		}
+	}
+
+	if rec := do(mux, http.MethodGet, "/devices", ""); !strings.Contains(rec.Body.String(), `"total":0`) {
+		t.Errorf("invalid reports were stored: %s", rec.Body)
+	}
+}
+
+func TestReceiveBatch(t *testing.T) {
+	mux := newTestServer()
+
+	newer := strings.NewReplacer(`"UNHEALTHY"`, `"HEALTHY"`, `"score":50`, `"score":100`, `95.5`, `20`,
+		`["disk_usage"]`, `[]`, `T10:00`, `T11:00`).Replace(validReport)
+	invalid := strings.Replace(validReport, `"10.0.0.5"`, `"nope"`, 1)
+	rec := do(mux, http.MethodPost, "/reports", "["+newer+","+invalid+","+validReport+"]")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /reports = %d: %s", rec.Code, rec.Body)
+	}
+	var resp BatchResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Accepted != 2 || resp.Rejected != 1 || len(resp.Results) != 3 {
+		t.Fatalf("unexpected batch response %+v", resp)
+	}
+	if r := resp.Results[1]; r.Code != http.StatusUnprocessableEntity || r.Ack != nil || len(r.Details) == 0 || r.Details[0].Field != "ip" {
+		t.Errorf("invalid item result = %+v", r)
+	}
+	// Stored oldest first, whatever the order in the batch
+	if r := resp.Results[2]; r.Code != http.StatusOK || r.Ack.ReportID != 1 || !r.Ack.Alert {
+		t.Errorf("older item result = %+v", r.Ack)
+	}
+	if r := resp.Results[0]; r.Code != http.StatusOK || r.Ack.ReportID != 2 || r.Ack.Status != "HEALTHY" {
+		t.Errorf("newer item result = %+v", r.Ack)
+	}
+	if rec := do(mux, http.MethodGet, "/devices/laptop-1", ""); !strings.Contains(rec.Body.String(), `"status":"HEALTHY"`) {
+		t.Errorf("device does not reflect the newest report: %s", rec.Body)
+	}
+
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{validReport, http.StatusBadRequest},
+		{`[]`, http.StatusBadRequest},
+		{"[" + strings.Repeat(validReport+",", MaxBatchReports) + validReport + "]", http.StatusRequestEntityTooLarge},
+	} {
+		if rec := do(mux, http.MethodPost, "/reports", tt.body); rec.Code != tt.code {
+			t.Errorf("POST /reports %.40q = %d; want %d", tt.body, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestReportDedup(t *testing.T) {
+	mux := newTestServer()
+	post := func(key, body string) (int, Ack) {
+		req := httptest.NewRequest(http.MethodPost, "/report", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		var ack Ack
+		json.Unmarshal(rec.Body.Bytes(), &ack)
+		return rec.Code, ack
+	}
+
+	if code, ack := post("k-1", validReport); code != http.StatusOK || ack.Dedup != "" || ack.ReportID != 1 {
+		t.Fatalf("first report = %d %+v", code, ack)
+	}
+	// A retry with the same key is acknowledged with the original report
+	retry := strings.Replace(validReport, `"cpu_usage":12`, `"cpu_usage":13`, 1)
+	if code, ack := post("k-1", retry); code != http.StatusOK || ack.Dedup != store.DedupReplay || ack.ReportID != 1 {
+		t.Errorf("replay = %d %+v", code, ack)
+	}
+	// The same reading taken later extends the report instead of adding one
+	later := strings.Replace(validReport, "T10:00", "T10:05", 1)
+	if code, ack := post("k-2", later); code != http.StatusOK || ack.Dedup != store.DedupRepeat || ack.ReportID != 1 {
+		t.Errorf("repeat = %d %+v", code, ack)
+	}
+	if code, ack := post("k-2", later); ack.Dedup != store.DedupReplay {
+		t.Errorf("replayed repeat = %d %+v", code, ack)
+	}
+	rec := do(mux, http.MethodGet, "/reports", "")
+	if !strings.Contains(rec.Body.String(), `"total":1`) || !strings.Contains(rec.Body.String(), `"repeats":1`) {
+		t.Errorf("GET /reports = %s", rec.Body)
+	}
+
+	withKey := `{"idempotency_key":"k-3",` + validReport[1:]
+	if code, _ := post("k-4", withKey); code != http.StatusUnprocessableEntity {
+		t.Errorf("mismatched header and field = %d; want 422", code)
+	}
+	if code, _ := post("has space", validReport); code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid key = %d; want 422", code)
+	}
+}
+
+func TestDeltaReports(t *testing.T) {
+	mux := newTestServer()
+	full := `{"schema_version":2,"os":{"name":"linux","arch":"amd64"},"checks":[{"name":"disk_usage","passed":false}],` + validReport[1:]
+	delta := strings.NewReplacer(`"os":{"name":"linux","arch":"amd64"},`, "", `"checks":[{"name":"disk_usage","passed":false}],`, "",
+		`"schema_version":2,`, `"schema_version":2,"unchanged":["os","checks"],`, "T10:00", "T10:05", `"cpu_usage":12`, `"cpu_usage":30`).Replace(full)
+
+	// Without a previous report there is nothing to fill the delta in from
+	if rec := do(mux, http.MethodPost, "/report", delta); rec.Code != http.StatusConflict {
+		t.Fatalf("delta report before any other = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, http.MethodPost, "/report", full); rec.Code != http.StatusOK {
+		t.Fatalf("full report = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, http.MethodPost, "/report", delta); rec.Code != http.StatusOK {
+		t.Fatalf("delta report = %d: %s", rec.Code, rec.Body)
+	}
+	rec := do(mux, http.MethodGet, "/reports?limit=1", "")
+	var page struct {
+		Reports []store.StoredReport `json:"reports"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if len(page.Reports) != 1 {
+		t.Fatalf("GET /reports = %s", rec.Body)
+	}
+	if got := page.Reports[0]; got.CPUUsage != 30 || got.OS == nil || got.OS.Name != "linux" || len(got.Checks) != 1 || got.Unchanged != nil {
+		t.Errorf("stored delta report = %+v", got)
+	}
+
+	bad := strings.Replace(delta, `["os","checks"]`, `["os","logs"]`, 1)
+	if rec := do(mux, http.MethodPost, "/report", bad); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"field":"unchanged[1]"`) {
+		t.Errorf("delta report leaving out logs = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDeviceHistory(t *testing.T) {
+	mux := newTestServer()
+	for i, ts := range []string{"2024-04-20T10:00:00Z", "2024-04-29T10:00:00Z", "2024-04-30T10:00:00Z", "2024-05-01T09:00:00Z"} {
+		// Vary the reading so consecutive reports aren't folded together
+		body := strings.NewReplacer("2024-05-01T10:00:00Z", ts, `"cpu_usage":12`, `"cpu_usage":`+strconv.Itoa(10+i)).Replace(validReport)
+		if rec := do(mux, http.MethodPost, "/report", body); rec.Code != http.StatusOK {
+			t.Fatalf("POST /report = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	var page History
+	rec := do(mux, http.MethodGet, "/devices/laptop-1/history?since=2024-04-25T00:00:00Z&fields=disk_usage&order=asc&limit=2", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET history = %d: %s", rec.Code, rec.Body)
+	}
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if page.Count != 2 || page.NextCursor != 3 {
+		t.Fatalf("first page = %s", rec.Body)
+	}
+	if got := string(page.Reports[0]); got != `{"disk_usage":95.5,"id":2,"timestamp":"2024-04-29T10:00:00Z"}` {
+		t.Errorf("selected fields = %s", got)
+	}
+
+	rec = do(mux, http.MethodGet, "/devices/laptop-1/history?since=2024-04-25T00:00:00Z&order=asc&limit=2&cursor=3", "")
+	page = History{}
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if page.Count != 1 || page.NextCursor != 0 || !strings.Contains(string(page.Reports[0]), `"id":4`) {
+		t.Errorf("second page = %s", rec.Body)
+	}
+
+	for _, query := range []string{"fields=nope", "since=yesterday", "order=up", "cursor=-1"} {
+		if rec := do(mux, http.MethodGet, "/devices/laptop-1/history?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("history?%s = %d; want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	mux := newTestServer()
+	do(mux, http.MethodPost, "/report", validReport)
+
+	rec := do(mux, http.MethodGet, "/dashboard", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `href="/dashboard/devices/laptop-1"`) {
+		t.Errorf("GET /dashboard = %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(mux, http.MethodGet, "/dashboard/devices/laptop-1", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<h1>laptop-1</h1>") {
+		t.Errorf("GET /dashboard/devices/laptop-1 = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, http.MethodGet, "/dashboard/devices/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /dashboard/devices/missing = %d; want 404", rec.Code)
+	}
+}
+
+func TestDeviceTags(t *testing.T) {
+	mux := newTestServer()
+	do(mux, http.MethodPost, "/report", validReport)
+	do(mux, http.MethodPost, "/report", strings.Replace(validReport, "laptop-1", "laptop-2", 1))
+
+	rec := do(mux, http.MethodPut, "/devices/laptop-1/tags", `{"site":"ams","owner":"alice"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tags":{"owner":"alice","site":"ams"}`) {
+		t.Fatalf("PUT tags = %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(mux, http.MethodPatch, "/devices/laptop-1/tags", `{"site":"lon","owner":null,"ou":"eng"}`)
+	if !strings.Contains(rec.Body.String(), `"tags":{"ou":"eng","site":"lon"}`) {
+		t.Errorf("PATCH tags = %s", rec.Body)
+	}
+
+	rec = do(mux, http.MethodGet, "/devices?tag=site:lon", "")
+	if !strings.Contains(rec.Body.String(), `"total":1`) || !strings.Contains(rec.Body.String(), "laptop-1") {
+		t.Errorf("GET /devices?tag=site:lon = %s", rec.Body)
+	}
+
+	if rec := do(mux, http.MethodPut, "/devices/laptop-1/tags", `{"Bad Key":"x"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid tag name = %d; want 422", rec.Code)
+	}
+	if rec := do(mux, http.MethodPut, "/devices/missing/tags", `{"site":"ams"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("tags on unknown device = %d; want 404", rec.Code)
+	}
+	if rec := do(mux, http.MethodGet, "/devices?tag=site", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed tag filter = %d; want 400", rec.Code)
+	}
+}
+
+func TestServerPolicy(t *testing.T) {
+	mux := newTestServer()
+	if rec := do(mux, http.MethodGet, "/policy", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /policy before one is set = %d; want 404", rec.Code)
+	}
+	if rec := do(mux, http.MethodPut, "/policy", `{"checks":[{"name":"gpu_usage","critical":90}]}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid policy = %d; want 422", rec.Code)
+	}
+
+	// The agent calls 95.5% disk UNHEALTHY; the central policy tolerates it
+	rec := do(mux, http.MethodPut, "/policy", `{"checks":[{"name":"disk_usage","warn":90,"critical":99}]}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"version":1`) {
+		t.Fatalf("PUT /policy = %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(mux, http.MethodPost, "/report", validReport)
+	var ack Ack
+	json.Unmarshal(rec.Body.Bytes(), &ack)
+	if ack.Status != "UNHEALTHY" || ack.ServerStatus != "DEGRADED" || !ack.PolicyMismatch {
+		t.Errorf("ack = %+v, want the agent's UNHEALTHY and the server's DEGRADED", ack)
+	}
+
+	rec = do(mux, http.MethodGet, "/reports?mismatch=true", "")
+	if !strings.Contains(rec.Body.String(), `"total":1`) || !strings.Contains(rec.Body.String(), `"server_verdict":{"policy_version":1,"status":"DEGRADED","score":75`) {
+		t.Errorf("GET /reports?mismatch=true = %s", rec.Body)
+	}
+	rec = do(mux, http.MethodGet, "/devices/laptop-1", "")
+	if !strings.Contains(rec.Body.String(), `"server_status":"DEGRADED","server_score":75,"policy_mismatch":true`) {
+		t.Errorf("GET /devices/laptop-1 = %s", rec.Body)
+	}
+
+	// Agreement isn't flagged
+	do(mux, http.MethodPut, "/policy", `{"checks":[{"name":"disk_usage","critical":90}]}`)
+	ack = Ack{}
+	json.Unmarshal(do(mux, http.MethodPost, "/report", validReport).Body.Bytes(), &ack)
+	if ack.ServerStatus != "UNHEALTHY" || ack.PolicyMismatch {
+		t.Errorf("ack under v2 = %+v", ack)
+	}
+
+	if rec := do(mux, http.MethodDelete, "/policy", ""); rec.Code != http.StatusOK {
+		t.Errorf("DELETE /policy = %d", rec.Code)
+	}
+	ack = Ack{}
+	json.Unmarshal(do(mux, http.MethodPost, "/report", validReport).Body.Bytes(), &ack)
+	if ack.ServerStatus != "" {
+		t.Errorf("ack without a policy = %+v", ack)
+	}
+}
+
+func TestPosture(t *testing.T) {
+	mux := newTestServer()
+	if rec := do(mux, http.MethodGet, "/posture", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /posture without a device = %d; want 400", rec.Code)
+	}
+	if rec := do(mux, http.MethodGet, "/posture?ip=10.0.0.5", ""); rec.Code != http.StatusNotFound || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("unknown device = %d, Cache-Control %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+
+	do(mux, http.MethodPost, "/report", validReport)
+	healthy := strings.NewReplacer("laptop-1", "laptop-2", "10.0.0.5", "10.0.0.6", "UNHEALTHY", "HEALTHY").Replace(validReport)
+	do(mux, http.MethodPost, "/report", healthy)
+
+	rec := do(mux, http.MethodGet, "/posture?ip=10.0.0.6", "")
+	if rec.Header().Get("Cache-Control") != "private, max-age=10" {
+		t.Errorf("Cache-Control = %q", rec.Header().Get("Cache-Control"))
+	}
+	var v PostureVerdict
+	json.Unmarshal(rec.Body.Bytes(), &v)
+	if !v.Compliant || v.DeviceID != "laptop-2" || v.Source != SourceAgent {
+		t.Errorf("verdict for a healthy device = %+v", v)
+	}
+
+	for query, reason := range map[string]string{
+		"device_id=laptop-1":              "agent verdict is UNHEALTHY (failing: disk_usage)",
+		"device_id=laptop-2&ip=10.0.0.9":  "device last reported from 10.0.0.6",
+		"device_id=laptop-2&ip=10.0.0.6":  "",
+		"device_id=laptop-1&ip=not-an-ip": "400",
+		"device_id=missing&ip=10.0.0.6":   "404",
+	} {
+		rec := do(mux, http.MethodGet, "/posture?"+query, "")
+		if reason == "400" || reason == "404" {
+			if strconv.Itoa(rec.Code) != reason {
+				t.Errorf("GET /posture?%s = %d; want %s", query, rec.Code, reason)
+			}
+			continue
+		}
+		v = PostureVerdict{}
+		json.Unmarshal(rec.Body.Bytes(), &v)
+		if v.Reason != reason || v.Compliant != (reason == "") {
+			t.Errorf("GET /posture?%s = %+v; want reason %q", query, v, reason)
+		}
+	}
+
+	// A policy verdict overrides the agent's
+	do(mux, http.MethodPut, "/policy", `{"checks":[{"name":"disk_usage","warn":90,"critical":99}],"healthy_score":70}`)
+	do(mux, http.MethodPost, "/report", validReport)
+	v = PostureVerdict{}
+	json.Unmarshal(do(mux, http.MethodGet, "/posture?device_id=laptop-1", "").Body.Bytes(), &v)
+	if !v.Compliant || v.Source != SourcePolicy || v.Status != "HEALTHY" || v.Score != 75 {
+		t.Errorf("verdict under a policy = %+v", v)
+	}
+}
+
+func TestPostureToken(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	issuer := posturetoken.NewIssuer(key)
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{StaleAfter: time.Hour, PostureTokens: issuer, PostureTokenTTL: time.Minute}).Register(mux)
+
+	if rec := do(mux, http.MethodPost, "/posture/token?device_id=laptop-1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("token for an unknown device = %d", rec.Code)
+	}
+	do(mux, http.MethodPost, "/report", validReport)
+	rec := do(mux, http.MethodPost, "/posture/token?device_id=laptop-1", "")
+	var issued PostureTokenResponse
+	json.Unmarshal(rec.Body.Bytes(), &issued)
+	if rec.Code != http.StatusOK || issued.Verdict.Compliant || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("POST /posture/token = %d %s", rec.Code, rec.Body)
+	}
+	claims, err := posturetoken.NewVerifier(issuer.PublicKey()).Verify(issued.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.DeviceID != "laptop-1" || claims.Compliant || claims.Status != "UNHEALTHY" || !claims.ExpiresAt.Equal(issued.ExpiresAt) {
+		t.Errorf("claims = %+v, expiry in response %v", claims, issued.ExpiresAt)
+	}
+
+	var keys struct{ Keys []PostureTokenKey }
+	json.Unmarshal(do(mux, http.MethodGet, "/posture/keys", "").Body.Bytes(), &keys)
+	if len(keys.Keys) != 1 || keys.Keys[0].ID != issuer.ID() || !strings.Contains(keys.Keys[0].PublicKey, "PUBLIC KEY") {
+		t.Errorf("GET /posture/keys = %+v", keys)
+	}
+}
+
+func TestGrafana(t *testing.T) {
+	mux := newTestServer()
+	do(mux, http.MethodPost, "/report", validReport)
+	do(mux, http.MethodPost, "/report", strings.NewReplacer("laptop-1", "laptop-2", `"UNHEALTHY","score":50`, `"HEALTHY","score":100`).Replace(validReport))
+
+	if rec := do(mux, http.MethodGet, "/grafana/", ""); rec.Code != http.StatusOK {
+		t.Errorf("connection test = %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, "/grafana/search", `{"target":""}`); !strings.Contains(rec.Body.String(), `"avg_score"`) {
+		t.Errorf("search = %s", rec.Body)
+	}
+
+	query := `{"range":{"from":"2024-05-01T09:00:00Z","to":"2024-05-01T12:00:00Z"},"intervalMs":3600000,
+		"targets":[{"target":"avg_score","refId":"A"},{"target":"unhealthy_percent","refId":"B","payload":{"hostname":"laptop-1"}},
+		{"target":"devices","refId":"C","type":"table"}]}`
+	rec := do(mux, http.MethodPost, "/grafana/query", query)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("query = %d: %s", rec.Code, rec.Body)
+	}
+	var out []struct {
+		Target     string
+		Datapoints [][2]float64
+		Type       string
+		Rows       [][]any
+	}
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	bucket := float64(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).UnixMilli())
+	if len(out) != 3 || len(out[0].Datapoints) != 1 || out[0].Datapoints[0] != [2]float64{75, bucket} {
+		t.Fatalf("query = %s", rec.Body)
+	}
+	if out[1].Datapoints[0][0] != 100 {
+		t.Errorf("laptop-1 unhealthy_percent = %v", out[1].Datapoints)
+	}
+	if out[2].Type != "table" || len(out[2].Rows) != 2 {
+		t.Errorf("devices table = %+v", out[2])
+	}
+
+	// Ad hoc filters narrow every target
+	rec = do(mux, http.MethodPost, "/grafana/query", strings.Replace(query, `"intervalMs"`,
+		`"adhocFilters":[{"key":"hostname","operator":"=","value":"laptop-2"}],"intervalMs"`, 1))
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	if out[0].Datapoints[0][0] != 100 || len(out[2].Rows) != 1 {
+		t.Errorf("filtered query = %s", rec.Body)
+	}
+
+	if rec := do(mux, http.MethodPost, "/grafana/query", strings.Replace(query, "avg_score", "uptime", 1)); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown target = %d; want 400", rec.Code)
+	}
+}
+
+type recordingNotifier struct{ kinds []string }
+
+func (n *recordingNotifier) Notify(ctx context.Context, e alert.Event) error {
+	n.kinds = append(n.kinds, e.Kind+":"+e.Device)
+	return nil
+}
+
+func TestAlertsOnTransition(t *testing.T) {
+	notifier := &recordingNotifier{}
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{Notifier: notifier}).Register(mux)
+
+	healthy := strings.Replace(validReport, `"UNHEALTHY"`, `"HEALTHY"`, 1)
+	tamper := strings.Replace(validReport, `"timestamp"`, `"tamper_events":[{"kind":"config_modified","path":"/etc/agent.json","severity":"critical","timestamp":"2024-05-01T10:00:00Z"}],"timestamp"`, 1)
+	for _, body := range []string{validReport, validReport, healthy, validReport, tamper} {
+		do(mux, http.MethodPost, "/report", body)
+	}
+
+	want := "unhealthy:laptop-1 unhealthy:laptop-1 tamper:laptop-1"
+	if got := strings.Join(notifier.kinds, " "); got != want {
+		t.Errorf("alerts = %q, want %q", got, want)
+	}
+}
+
+func doAuth(mux *http.ServeMux, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestEnrollmentAndKeys(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{RequireAuth: true, AdminToken: "admin-secret"}).Register(mux)
+
+	if rec := doAuth(mux, http.MethodPost, "/enrollment-tokens", "wrong", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("token creation without admin = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/enrollment-tokens", "admin-secret", `{"tags":{"Bad Key":"x"}}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("token with invalid tags = %d", rec.Code)
+	}
+	rec := doAuth(mux, http.MethodPost, "/enrollment-tokens", "admin-secret", `{"ttl":"1h","tags":{"group":"eng"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /enrollment-tokens = %d: %s", rec.Code, rec.Body)
+	}
+	var issued struct{ Token string }
+	json.Unmarshal(rec.Body.Bytes(), &issued)
+
+	if rec := do(mux, http.MethodPost, "/report", validReport); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated report = %d", rec.Code)
+	}
+
+	rec = do(mux, http.MethodPost, "/enroll", `{"token":"`+issued.Token+`","hostname":"laptop-1"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /enroll = %d: %s", rec.Code, rec.Body)
+	}
+	var cred Credential
+	json.Unmarshal(rec.Body.Bytes(), &cred)
+	if cred.Tags["group"] != "eng" {
+		t.Errorf("enrolled credential = %+v", cred)
+	}
+	if rec := do(mux, http.MethodPost, "/enroll", `{"token":"`+issued.Token+`","hostname":"laptop-2"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("reused enrollment token = %d", rec.Code)
+	}
+	// The device is listed, in its group, before its first report
+	var device store.Device
+	json.Unmarshal(do(mux, http.MethodGet, "/devices/laptop-1", "").Body.Bytes(), &device)
+	if device.Status != store.StatusEnrolled || device.Tags["group"] != "eng" {
+		t.Errorf("enrolled device = %+v", device)
+	}
+
+	if rec := doAuth(mux, http.MethodPost, "/report", cred.APIKey, validReport); rec.Code != http.StatusOK {
+		t.Fatalf("authenticated report = %d: %s", rec.Code, rec.Body)
+	}
+	other := strings.Replace(validReport, "laptop-1", "laptop-2", 1)
+	if rec := doAuth(mux, http.MethodPost, "/report", cred.APIKey, other); rec.Code != http.StatusForbidden {
+		t.Errorf("report for another device = %d", rec.Code)
+	}
+
+	// Rotation issues a new key; the old one stays valid for the grace period
+	rec = doAuth(mux, http.MethodPost, "/keys/rotate", cred.APIKey, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /keys/rotate = %d: %s", rec.Code, rec.Body)
+	}
+	var rotated Credential
+	json.Unmarshal(rec.Body.Bytes(), &rotated)
+	for _, key := range []string{cred.APIKey, rotated.APIKey} {
+		if rec := doAuth(mux, http.MethodPost, "/report", key, validReport); rec.Code != http.StatusOK {
+			t.Errorf("report after rotation = %d", rec.Code)
+		}
+	}
+
+	if rec := doAuth(mux, http.MethodDelete, "/devices/laptop-1/keys", "admin-secret", ""); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE keys = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/report", rotated.APIKey, validReport); rec.Code != http.StatusUnauthorized {
+		t.Errorf("report with revoked key = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodDelete, "/reports", cred.APIKey, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE /reports with device key = %d", rec.Code)
+	}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{RequireAuth: true, RequireClientCert: true, AdminToken: "admin-secret"}).Register(mux)
+
+	var issued struct{ Token string }
+	json.Unmarshal(doAuth(mux, http.MethodPost, "/enrollment-tokens", "admin-secret", "").Body.Bytes(), &issued)
+	// Enrollment works without a certificate
+	rec := do(mux, http.MethodPost, "/enroll", `{"token":"`+issued.Token+`","hostname":"laptop-1"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /enroll = %d: %s", rec.Code, rec.Body)
+	}
+	var cred Credential
+	json.Unmarshal(rec.Body.Bytes(), &cred)
+
+	send := func(cn string) int {
+		req := httptest.NewRequest(http.MethodPost, "/report", strings.NewReader(validReport))
+		req.Header.Set("Authorization", "Bearer "+cred.APIKey)
+		if cn != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := send(""); code != http.StatusUnauthorized {
+		t.Errorf("report without certificate = %d", code)
+	}
+	if code := send("laptop-2"); code != http.StatusForbidden {
+		t.Errorf("report with another device's certificate = %d", code)
+	}
+	if code := send("laptop-1"); code != http.StatusOK {
+		t.Errorf("report with the device's certificate = %d", code)
+	}
+}
+
+func TestSignedReports(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{RequireAuth: true, RequireSignedReports: true, AdminToken: "admin-secret"}).Register(mux)
+
+	enroll := func(hostname, signingKey string) Credential {
+		var issued struct{ Token string }
+		json.Unmarshal(doAuth(mux, http.MethodPost, "/enrollment-tokens", "admin-secret", "").Body.Bytes(), &issued)
+		var cred Credential
+		json.Unmarshal(do(mux, http.MethodPost, "/enroll", `{"token":"`+issued.Token+`","hostname":"`+hostname+`","signing_key":"`+signingKey+`"}`).Body.Bytes(), &cred)
+		return cred
+	}
+	signer, _ := cryptoutil.GenerateSigner()
+	cred := enroll("laptop-1", base64.StdEncoding.EncodeToString(signer.PublicKey()))
+
+	send := func(cred Credential, body string, sign func(h http.Header)) int {
+		req := httptest.NewRequest(http.MethodPost, "/report", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+cred.APIKey)
+		sign(req.Header)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	signed := func(h http.Header) { cryptoutil.SetSignature(h, "Report", signer.ID(), signer.Sign([]byte(validReport))) }
+	if code := send(cred, validReport, signed); code != http.StatusOK {
+		t.Errorf("signed report = %d", code)
+	}
+	if code := send(cred, validReport, func(http.Header) {}); code != http.StatusForbidden {
+		t.Errorf("unsigned report = %d", code)
+	}
+	if code := send(cred, strings.Replace(validReport, `"score":50`, `"score":99`, 1), signed); code != http.StatusForbidden {
+		t.Errorf("report changed after signing = %d", code)
+	}
+	other, _ := cryptoutil.GenerateSigner()
+	if code := send(cred, validReport, func(h http.Header) {
+		cryptoutil.SetSignature(h, "Report", other.ID(), other.Sign([]byte(validReport)))
+	}); code != http.StatusForbidden {
+		t.Errorf("report signed with another key = %d", code)
+	}
+	// Knowing the API key is not enough to sign
+	mac := cryptoutil.NewHMAC([]byte(cred.APIKey))
+	if code := send(cred, validReport, func(h http.Header) {
+		cryptoutil.SetSignature(h, "Report", mac.ID(), mac.Sign([]byte(validReport)))
+	}); code != http.StatusForbidden {
+		t.Errorf("report signed with the API key = %d", code)
+	}
+
+	// A rotated key keeps the device's signing key
+	rec := doAuth(mux, http.MethodPost, "/keys/rotate", cred.APIKey, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /keys/rotate = %d: %s", rec.Code, rec.Body)
+	}
+	var rotated Credential
+	json.Unmarshal(rec.Body.Bytes(), &rotated)
+	if code := send(rotated, validReport, signed); code != http.StatusOK {
+		t.Errorf("signed report with a rotated key = %d", code)
+	}
+
+	// A device that registered no signing key can't sign
+	unregistered := enroll("laptop-1", "")
+	if code := send(unregistered, validReport, signed); code != http.StatusForbidden {
+		t.Errorf("report from a device without a signing key = %d", code)
+	}
+	if rec := do(mux, http.MethodPost, "/enroll", `{"token":"dpe_x","hostname":"laptop-2","signing_key":"bm90IGEga2V5"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("enrollment with a malformed signing key = %d", rec.Code)
+	}
+}
+
+func TestMultiTenant(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{RequireAuth: true, AdminToken: "admin-secret", MultiTenant: true}).Register(mux)
+
+	adminKeys := make(map[string]string)
+	for _, id := range []string{"acme", "globex"} {
+		rec := doAuth(mux, http.MethodPost, "/tenants", "admin-secret", `{"id":"`+id+`"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("POST /tenants = %d: %s", rec.Code, rec.Body)
+		}
+		var created struct {
+			AdminKey string `json:"admin_key"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &created)
+		adminKeys[id] = created.AdminKey
+
+		// Each tenant enrolls its own laptop-1
+		rec = doAuth(mux, http.MethodPost, "/enrollment-tokens", created.AdminKey, "")
+		var issued struct{ Token, Tenant string }
+		json.Unmarshal(rec.Body.Bytes(), &issued)
+		if issued.Tenant != id {
+			t.Fatalf("enrollment token tenant = %q, want %q", issued.Tenant, id)
+		}
+		rec = do(mux, http.MethodPost, "/enroll", `{"token":"`+issued.Token+`","hostname":"laptop-1"}`)
+		var cred Credential
+		json.Unmarshal(rec.Body.Bytes(), &cred)
+		if rec := doAuth(mux, http.MethodPost, "/report", cred.APIKey, validReport); rec.Code != http.StatusOK {
+			t.Fatalf("%s report = %d: %s", id, rec.Code, rec.Body)
+		}
+	}
+	if rec := doAuth(mux, http.MethodPost, "/tenants", "admin-secret", `{"id":"acme"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate tenant = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/tenants", adminKeys["acme"], ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("tenant admin listing tenants = %d", rec.Code)
+	}
+
+	devices := func(token, path string) []store.Device {
+		t.Helper()
+		rec := doAuth(mux, http.MethodGet, path, token, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", path, rec.Code, rec.Body)
+		}
+		var body struct{ Devices []store.Device }
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return body.Devices
+	}
+	if got := devices(adminKeys["acme"], "/devices"); len(got) != 1 || got[0].Tenant != "acme" {
+		t.Errorf("acme sees %+v", got)
+	}
+	if got := devices("admin-secret", "/devices"); len(got) != 2 {
+		t.Errorf("admin sees %d devices, want 2", len(got))
+	}
+	if got := devices("admin-secret", "/devices?tenant=globex"); len(got) != 1 || got[0].Tenant != "globex" {
+		t.Errorf("admin scoped to globex sees %+v", got)
+	}
+
+	if rec := do(mux, http.MethodGet, "/devices", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous GET /devices = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/devices?tenant=globex", adminKeys["acme"], ""); rec.Code != http.StatusForbidden {
+		t.Errorf("acme reading globex = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/devices?tenant=initech", "admin-secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown tenant = %d", rec.Code)
+	}
+
+	// Browsers send the key as a Basic auth password
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	req.SetBasicAuth("acme", adminKeys["acme"])
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<td>acme</td>") || strings.Contains(rec.Body.String(), "globex") {
+		t.Errorf("acme dashboard = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{RequireAuth: true, AdminToken: "admin-secret", MultiTenant: true}).Register(mux)
+
+	rec := doAuth(mux, http.MethodPost, "/tenants", "admin-secret", `{"id":"acme"}`)
+	var created struct {
+		AdminKey string `json:"admin_key"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	rec = doAuth(mux, http.MethodPost, "/enrollment-tokens", created.AdminKey, "")
+	var issued struct{ Token, ID string }
+	json.Unmarshal(rec.Body.Bytes(), &issued)
+	do(mux, http.MethodPost, "/enroll", `{"token":"`+issued.Token+`","hostname":"laptop-1"}`)
+	do(mux, http.MethodPost, "/enroll", `{"token":"`+issued.Token+`","hostname":"laptop-2"}`) // used
+	doAuth(mux, http.MethodDelete, "/devices/laptop-1/keys", created.AdminKey, "")
+	doAuth(mux, http.MethodGet, "/devices", "guess", "")
+
+	type events struct {
+		Total  int           `json:"total"`
+		Events []audit.Event `json:"events"`
+	}
+	var all events
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/audit", "admin-secret", "").Body.Bytes(), &all)
+	var actions []string
+	for i := len(all.Events) - 1; i >= 0; i-- {
+		actions = append(actions, all.Events[i].Action)
+	}
+	want := "admin.login,tenant.create,admin.login,enrollment_token.create,device.enroll,device.enroll,key.revoke,admin.denied"
+	if got := strings.Join(actions, ","); got != want {
+		t.Fatalf("audit actions = %s\nwant %s", got, want)
+	}
+	enrolled, rejected := all.Events[3], all.Events[2]
+	if enrolled.Actor != "laptop-1" || enrolled.Tenant != "acme" || enrolled.Outcome != audit.OutcomeSuccess ||
+		!strings.Contains(enrolled.Detail, issued.ID) || enrolled.Service != AuditService {
+		t.Errorf("enrollment event = %+v", enrolled)
+	}
+	if rejected.Actor != "laptop-2" || rejected.Tenant != "" || rejected.Outcome != audit.OutcomeDenied {
+		t.Errorf("rejected enrollment event = %+v", rejected)
+	}
+	if revoked := all.Events[1]; revoked.Actor != "tenant-admin" || revoked.Tenant != "acme" || revoked.Object != "device laptop-1" {
+		t.Errorf("revocation event = %+v", revoked)
+	}
+
+	// A tenant admin sees their tenant's events alone
+	var acme events
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/audit?action=device.", created.AdminKey, "").Body.Bytes(), &acme)
+	if acme.Total != 1 || acme.Events[0].Actor != "laptop-1" {
+		t.Errorf("acme's device events = %+v", acme)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/audit/verify", created.AdminKey, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /audit/verify as a tenant admin = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/audit/verify", "admin-secret", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok":true`) {
+		t.Errorf("GET /audit/verify = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/audit?limit=0", "admin-secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /audit?limit=0 = %d", rec.Code)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	mux := http.NewServeMux()
+	api := NewAPI(store.NewMemory(100), Options{
+		RateLimit:      RateLimit{PerDevice: 6, DeviceBurst: 2, Global: 100, GlobalBurst: 3},
+		MaxReportBytes: 1024,
+	})
+	now := time.Date(2024, 5, 1, 10, 0, 5, 0, time.UTC)
+	api.now = func() time.Time { return now }
+	api.Register(mux)
+
+	from := func(ip string) int {
+		req := httptest.NewRequest(http.MethodPost, "/report", strings.NewReader(validReport))
+		req.RemoteAddr = ip + ":40000"
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Error("429 without Retry-After")
+		}
+		return rec.Code
+	}
+
+	// Burst of two, then one report every 10s
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := from("10.0.0.5"); got != want {
+			t.Errorf("report %d = %d, want %d", i, got, want)
+		}
+	}
+	// Another device still fits the global burst, then the fleet is limited
+	if got := from("10.0.0.6"); got != http.StatusOK {
+		t.Errorf("second device = %d", got)
+	}
+	if got := from("10.0.0.7"); got != http.StatusTooManyRequests {
+		t.Errorf("over global burst = %d", got)
+	}
+
+	now = now.Add(10 * time.Second)
+	if got := from("10.0.0.5"); got != http.StatusOK {
+		t.Errorf("after refill = %d", got)
+	}
+
+	big := `{"hostname":"laptop-1","pad":"` + strings.Repeat("x", 2048) + `"}`
+	if rec := do(mux, http.MethodPost, "/report", big); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized report = %d", rec.Code)
+	}
+}
+
+func TestFleetSummary(t *testing.T) {
+	mux := newTestServer()
+	reports := []string{
+		`{"hostname":"a","ip":"10.0.0.1","disk_usage":40,"cpu_usage":1,"memory_usage":1,"status":"HEALTHY","score":100,"timestamp":"2024-05-01T10:00:00Z"}`,
+		`{"hostname":"b","ip":"10.0.0.2","disk_usage":95,"cpu_usage":1,"memory_usage":1,"status":"UNHEALTHY","score":40,"failing_checks":["disk_usage","firewall"],"timestamp":"2024-05-01T10:00:00Z"}`,
+		`{"hostname":"c","ip":"10.0.0.3","disk_usage":70,"cpu_usage":1,"memory_usage":1,"status":"DEGRADED","score":70,"failing_checks":["firewall"],"timestamp":"2024-05-01T10:00:00Z"}`,
+	}
+	for _, body := range reports {
+		if rec := do(mux, http.MethodPost, "/report", body); rec.Code != http.StatusOK {
+			t.Fatalf("POST /report = %d: %s", rec.Code, rec.Body)
+		}
+	}
+	do(mux, http.MethodPut, "/devices/a/tags", `{"site":"ams"}`)
+	do(mux, http.MethodPut, "/devices/b/tags", `{"site":"ams"}`)
+
+	rec := do(mux, http.MethodGet, "/fleet/summary?group_by=site", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /fleet/summary = %d: %s", rec.Code, rec.Body)
+	}
+	var fleet Fleet
+	json.Unmarshal(rec.Body.Bytes(), &fleet)
+	overall := fleet.Overall
+	if overall.Devices != 3 || overall.ByStatus["UNHEALTHY"] != 1 || overall.CompliancePercent != 33.3 || overall.AvgDiskUsage != 68.3 {
+		t.Errorf("fleet = %+v", overall)
+	}
+	if len(overall.TopFailingChecks) != 2 || overall.TopFailingChecks[0] != (CheckCount{Check: "firewall", Devices: 2}) {
+		t.Errorf("top failing checks = %+v", overall.TopFailingChecks)
+	}
+	if len(fleet.Groups) != 2 || fleet.Groups[0].Group != ungrouped || fleet.Groups[1].Group != "ams" ||
+		fleet.Groups[1].Devices != 2 || fleet.Groups[1].CompliancePercent != 50 {
+		t.Errorf("groups = %+v", fleet.Groups)
+	}
+}
+
+func TestExportReports(t *testing.T) {
+	mux := newTestServer()
+	for _, host := range []string{"a", "b", "c", "d", "e"} {
+		body := strings.Replace(validReport, "laptop-1", host, 1)
+		if rec := do(mux, http.MethodPost, "/report", body); rec.Code != http.StatusOK {
+			t.Fatalf("POST /report = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	rec := do(mux, http.MethodGet, "/export/reports?format=csv&limit=3", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("GET /export/reports = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "id,hostname,") || !strings.HasPrefix(lines[1], "1,a,10.0.0.5,UNHEALTHY,50,") {
+		t.Errorf("csv export = %q", lines)
+	}
+	if next := rec.Result().Trailer.Get("X-Next-Cursor"); next != "3" {
+		t.Fatalf("X-Next-Cursor = %q", next)
+	}
+
+	rec = do(mux, http.MethodGet, "/export/reports?format=ndjson&limit=3&cursor=3", "")
+	lines = strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	var last store.StoredReport
+	json.Unmarshal([]byte(lines[len(lines)-1]), &last)
+	if len(lines) != 2 || last.ID != 5 || last.Hostname != "e" {
+		t.Errorf("ndjson page 2 = %q", lines)
+	}
+	if next := rec.Result().Trailer.Get("X-Next-Cursor"); next != "" {
+		t.Errorf("last page has X-Next-Cursor %q", next)
+	}
+
+	if rec := do(mux, http.MethodGet, "/export/reports?format=xml", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("format=xml = %d", rec.Code)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	s := store.NewMemory(100)
+	mux := http.NewServeMux()
+	httpMetrics := middleware.NewMetrics()
+	NewAPI(s, Options{Metrics: metrics.New(s, time.Hour, nil, slog.Default()), HTTPMetrics: httpMetrics}).Register(mux)
+	handler := httpMetrics.Middleware(mux)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	serve(http.MethodPost, "/report", validReport)
+	serve(http.MethodPost, "/report", strings.Replace(validReport, `"10.0.0.5"`, `"nope"`, 1))
+	serve(http.MethodPost, "/report", "{")
+	if rec := serve(http.MethodGet, "/healthz", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /healthz = %d %s", rec.Code, rec.Body.String())
+	}
+
+	body := serve(http.MethodGet, "/metrics", "").Body.String()
+	for _, want := range []string{
+		`posture_collector_reports_total{result="accepted"} 1`,
+		`posture_collector_reports_total{result="invalid"} 1`,
+		`posture_collector_reports_total{result="malformed"} 1`,
+		`posture_collector_validation_failures_total{field="ip"} 1`,
+		`http_requests_total{code="400",method="POST",route="POST /report"} 1`,
+		`http_requests_total{code="200",method="GET",route="GET /healthz"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := httptest.NewServer(newTestServer())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream?hostname=laptop-1&types=report,transition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	// Another device's report is filtered out
+	post := func(body string) {
+		r, err := http.Post(srv.URL+"/report", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+	post(strings.Replace(validReport, "laptop-1", "laptop-2", 1))
+	post(validReport)
+
+	var events []string
+	var first ReportEvent
+	lines := bufio.NewScanner(resp.Body)
+	for len(events) < 2 && lines.Scan() {
+		line := lines.Text()
+		if kind, ok := strings.CutPrefix(line, "event: "); ok {
+			events = append(events, kind)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && len(events) == 1 {
+			if err := json.Unmarshal([]byte(data), &first); err != nil {
+				t.Fatalf("bad report event %s: %v", data, err)
+			}
+		}
+	}
+	if strings.Join(events, ",") != "report,transition" {
+		t.Fatalf("events = %v", events)
+	}
+	if first.Hostname != "laptop-1" || first.Status != "UNHEALTHY" || first.ID == 0 {
+		t.Errorf("report event = %+v", first)
+	}
+
+	if rec := do(newTestServer(), http.MethodGet, "/stream?types=bogus", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("types=bogus = %d", rec.Code)
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	bus := eventbus.NewMemory()
+	events := make(chan eventbus.Event, 10)
+	if _, err := bus.Subscribe("posture.>", func(e eventbus.Event) { events <- e }); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{Events: bus, AdminToken: "admin"}).Register(mux)
+
+	healthy := strings.Replace(validReport, `"UNHEALTHY"`, `"HEALTHY"`, 1)
+	tamper := strings.Replace(healthy, `"timestamp"`, `"tamper_events":[{"kind":"config_modified","path":"/etc/agent.json","severity":"critical","timestamp":"2024-05-01T10:00:00Z"}],"timestamp"`, 1)
+	for _, body := range []string{healthy, healthy, validReport, tamper} {
+		do(mux, http.MethodPost, "/report", body)
+	}
+
+	// The repeated HEALTHY report changes nothing
+	var got []string
+	for len(got) < 4 {
+		select {
+		case e := <-events:
+			switch e.Subject {
+			case eventbus.SubjectPostureChanged:
+				var change eventbus.PostureChange
+				if err := e.Decode(&change); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, change.DeviceID+":"+change.From+"->"+change.To)
+			case eventbus.SubjectPostureTamper:
+				var alert eventbus.TamperAlert
+				if err := e.Decode(&alert); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, alert.DeviceID+":tamper:"+strings.Join(alert.Kinds, ","))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("events = %v, want 4", got)
+		}
+	}
+	want := "laptop-1:->HEALTHY laptop-1:HEALTHY->UNHEALTHY laptop-1:UNHEALTHY->HEALTHY laptop-1:tamper:config_modified"
+	if strings.Join(got, " ") != want {
+		t.Errorf("events = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	if rec := do(mux, http.MethodGet, "/events", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /events without the admin token = %d; want 401", rec.Code)
+	}
+	if rec := do(newTestServer(), http.MethodGet, "/events", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /events without a bus = %d; want 404", rec.Code)
+	}
+}
+
+// TestOpenAPI checks the API's responses against its OpenAPI document
+func TestOpenAPI(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	mux := http.NewServeMux()
+	NewAPI(store.NewMemory(100), Options{
+		StaleAfter:    time.Hour,
+		RequireAuth:   true,
+		AdminToken:    "admin",
+		PostureTokens: posturetoken.NewIssuer(key),
+	}).Register(mux)
+
+	rec := do(mux, http.MethodGet, "/openapi.json", "")
+	var doc openapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("GET /openapi.json = %d: %v", rec.Code, err)
+	}
+	if doc.Info.Title != "Device Posture Collector" || doc.Components.SecuritySchemes["deviceKey"].Scheme != "bearer" {
+		t.Errorf("document = %+v", doc.Info)
+	}
+	// A single-tenant collector's read endpoints are open
+	if op := doc.Paths["/devices/{hostname}/history"]["get"]; op == nil || op.Security != nil || op.Parameters[0].Name != "hostname" {
+		t.Errorf("GET /devices/{hostname}/history = %+v", op)
+	}
+	if op := doc.Paths["/devices/{hostname}/keys"]["delete"]; op == nil || op.Security[0]["adminToken"] == nil {
+		t.Errorf("DELETE /devices/{hostname}/keys = %+v", op)
+	}
+	if op := doc.Paths["/report"]["post"]; op == nil || op.Security[0]["deviceKey"] == nil || op.RequestBody == nil {
+		t.Errorf("POST /report = %+v", op)
+	}
+
+	// call makes a request and checks the response is the one documented
+	call := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := doAuth(mux, method, path, token, body)
+		if err := doc.Validate(method, path, rec.Code, rec.Body.Bytes()); err != nil {
+			t.Error(err)
+		}
+		return rec
+	}
+	var enrollment struct{ Token string }
+	json.Unmarshal(call(http.MethodPost, "/enrollment-tokens", "admin", `{"tags":{"site":"ams"}}`).Body.Bytes(), &enrollment)
+	var cred Credential
+	json.Unmarshal(call(http.MethodPost, "/enroll", "", `{"token":"`+enrollment.Token+`","hostname":"laptop-1"}`).Body.Bytes(), &cred)
+	if cred.APIKey == "" {
+		t.Fatal("enrollment failed")
+	}
+
+	call(http.MethodPost, "/report", cred.APIKey, validReport)
+	call(http.MethodPost, "/report", cred.APIKey, `{"hostname":"laptop-1"}`)
+	call(http.MethodPost, "/reports", cred.APIKey, "["+strings.Replace(validReport, "10:00:00", "10:05:00", 1)+`,{"hostname":""}]`)
+	call(http.MethodPut, "/policy", "admin", `{"checks":[{"name":"disk_usage","warn":90,"critical":99}]}`)
+	call(http.MethodPost, "/report", cred.APIKey, strings.Replace(validReport, "10:00:00", "10:10:00", 1))
+	call(http.MethodPatch, "/devices/laptop-1/tags", "admin", `{"owner":"alice","site":null}`)
+	call(http.MethodPost, "/posture/token", cred.APIKey, "")
+	call(http.MethodPost, "/keys/rotate", cred.APIKey, "")
+	for _, path := range []string{
+		"/", "/health", "/healthz", "/schema", "/reports", "/reports/unhealthy", "/reports/laptop-1",
+		"/devices", "/devices/stale", "/devices/laptop-1", "/devices/laptop-9", "/fleet/summary?group_by=owner",
+		"/posture?device_id=laptop-1", "/posture/keys", "/devices/laptop-1/history?fields=status,score",
+		"/devices/laptop-1/rollups", "/devices/laptop-1/keys", "/enrollment-tokens", "/retention", "/policy", "/grafana",
+	} {
+		call(http.MethodGet, path, "admin", "")
+	}
+	for _, path := range []string{"/grafana/search", "/grafana/metrics", "/grafana/tag-keys"} {
+		call(http.MethodPost, path, "admin", "{}")
+	}
+	call(http.MethodPost, "/grafana/tag-values", "admin", `{"key":"hostname"}`)
+	call(http.MethodPost, "/grafana/query", "admin", `{"range":{"from":"2024-05-01T00:00:00Z","to":"2024-05-02T00:00:00Z"},
+		"targets":[{"target":"avg_disk_usage","type":"timeserie"},{"target":"devices","type":"table"}]}`)
+	call(http.MethodDelete, "/devices/laptop-1/keys", "admin", "")
+	call(http.MethodDelete, "/policy", "admin", "")
+	call(http.MethodDelete, "/reports", "admin", "")
+	call(http.MethodGet, "/reports", "", "")
+}
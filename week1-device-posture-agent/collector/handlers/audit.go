@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+
+	"device-posture-collector/store"
+)
+
+// AuditService names the collector in audit events and syslog
+const AuditService = "device-posture-collector"
+
+// Actors of admin requests, for the audit log
+const (
+	actorAdmin       = "admin"        // the admin token
+	actorTenantAdmin = "tenant-admin" // a tenant's admin key
+)
+
+// adminLoginWindow is how long an admin's requests from one address count
+// as one sign-in in the audit log
+const adminLoginWindow = time.Hour
+
+// Audit query limits
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 10000
+)
+
+// audit records an event r caused in the audit log, in the tenant r is
+// scoped to and by the admin or device that made it unless e names others.
+// An event of no tenant spans them all. What it records has already
+// happened, so a failure to record it is logged rather than answered.
+func (a *API) audit(r *http.Request, e audit.Event) {
+	if e.Tenant == "" {
+		e.Tenant, _ = store.TenantScope(r.Context())
+	}
+	if e.Actor == "" {
+		e.Actor, e.Address = audit.ActorFrom(r.Context())
+		if device, ok := authenticatedDevice(r.Context()); ok {
+			e.Actor, e.Address = device, r.RemoteAddr
+		}
+	}
+	if _, err := a.opts.Audit.Record(r.Context(), e); err != nil {
+		a.log.ErrorContext(r.Context(), "failed to audit", "action", e.Action, "object", e.Object, "error", err)
+	}
+}
+
+// ListAudit returns audit events of the caller's tenant, or with the admin
+// token of every tenant or the one named by ?tenant=, newest first,
+// optionally only those of ?actor=, ?action= (e.g. device.enroll, or key.
+// for every key event), ?object= (e.g. "device laptop-1"), and ?since= and
+// ?until= (RFC 3339), up to ?limit= (default 100)
+func (a *API) ListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := audit.Filter{Actor: q.Get("actor"), Action: q.Get("action"), Object: q.Get("object"), Limit: defaultAuditLimit}
+	f.Tenant, _ = store.TenantScope(r.Context())
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, p.name+" must be an RFC 3339 time such as 2026-06-01T09:00:00Z", nil)
+				return
+			}
+			*p.t = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit), nil)
+			return
+		}
+		f.Limit = n
+	}
+	events, err := a.opts.Audit.Events(r.Context(), f)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to read audit log", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to read audit log", nil)
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total": len(events), "events": events})
+}
+
+// VerifyAudit checks that no audit event of any tenant was changed or
+// removed since it was recorded, answering 409 if one was
+func (a *API) VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	n, err := a.opts.Audit.Verify(r.Context())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "audit log verification failed", "events", n, "error", err)
+		writeJSON(w, http.StatusConflict, map[string]any{"ok": false, "events": n, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "events": n})
+}
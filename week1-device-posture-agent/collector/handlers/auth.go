@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/cryptoutil"
+
+	"device-posture-collector/auth"
+	"device-posture-collector/store"
+)
+
+type deviceKey struct{}
+
+// authenticatedDevice returns the hostname whose API key signed the request
+func authenticatedDevice(ctx context.Context) (string, bool) {
+	key, ok := authenticatedKey(ctx)
+	return key.Hostname, ok
+}
+
+// authenticatedKey returns the API key the request was made with
+func authenticatedKey(ctx context.Context) (store.APIKey, bool) {
+	key, ok := ctx.Value(deviceKey{}).(store.APIKey)
+	return key, ok
+}
+
+// requireDevice rejects requests without a valid, unrevoked device API key,
+// and scopes the rest to the key's tenant. With authentication disabled
+// every request passes.
+func (a *API) requireDevice(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.opts.RequireAuth {
+			next(w, r)
+			return
+		}
+		token := auth.BearerToken(r)
+		if token == "" {
+			unauthorized(w, "missing API key")
+			return
+		}
+		key, err := a.store.GetAPIKey(r.Context(), auth.Hash(token))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			a.log.ErrorContext(r.Context(), "failed to look up API key", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to verify API key", nil)
+			return
+		}
+		if err != nil || !key.Valid(a.now()) {
+			a.log.WarnContext(r.Context(), "rejected request: invalid or revoked API key", "remote_addr", r.RemoteAddr)
+			unauthorized(w, "invalid or revoked API key")
+			return
+		}
+		if a.opts.RequireClientCert {
+			name, ok := auth.CertificateDevice(r.TLS)
+			if !ok {
+				a.log.WarnContext(r.Context(), "rejected request: no client certificate", "remote_addr", r.RemoteAddr)
+				unauthorized(w, "client certificate required")
+				return
+			}
+			if name != key.Hostname {
+				a.log.WarnContext(r.Context(), "rejected request: client certificate issued to another device", "remote_addr", r.RemoteAddr, "certificate", name, "device", key.Hostname)
+				writeError(w, http.StatusForbidden, "client certificate was issued to a different device", nil)
+				return
+			}
+		}
+		ctx := context.WithValue(r.Context(), deviceKey{}, key)
+		next(w, r.WithContext(store.WithTenant(ctx, key.Tenant)))
+	}
+}
+
+// checkSignature verifies the signature a device made of a report body
+// with the signing key it registered at enrollment, answering 403 and
+// returning false when it doesn't match. Unsigned bodies, from agents that
+// predate signing, pass unless RequireSignedReports. Without
+// authentication there is no key to check them with.
+func (a *API) checkSignature(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	key, ok := authenticatedKey(r.Context())
+	if !ok {
+		return true
+	}
+	keyID, sig, err := cryptoutil.Signature(r.Header, "Report")
+	switch {
+	case errors.Is(err, cryptoutil.ErrUnsigned) && !a.opts.RequireSignedReports:
+		return true
+	case err == nil && key.SigningKey == "":
+		err = fmt.Errorf("%w %s: the device registered no signing key; enroll it again", cryptoutil.ErrUnknownKey, keyID)
+	case err == nil:
+		pub, _ := base64.StdEncoding.DecodeString(key.SigningKey) // checked at enrollment
+		err = cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: pub}).Verify(keyID, body, sig)
+	}
+	if err != nil {
+		a.log.WarnContext(r.Context(), "rejected report: bad signature", "device", key.Hostname, "error", err)
+		writeError(w, http.StatusForbidden, "report signature: "+err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// requireAdmin protects management endpoints. The admin token may act on
+// every tenant, or on one named by ?tenant=; a tenant admin key only on its
+// own tenant. Without an admin token configured (development mode) they are
+// open. Admins signing in and requests turned away are audited.
+func (a *API) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		token := auth.Token(r)
+		requested := r.URL.Query().Get("tenant")
+
+		if a.opts.AdminToken == "" || auth.Equal(token, a.opts.AdminToken) {
+			if requested != "" {
+				if _, err := a.store.GetTenant(ctx, requested); err != nil {
+					a.tenantError(w, requested, err)
+					return
+				}
+				ctx = store.WithTenant(ctx, requested)
+			}
+			next(w, r.WithContext(a.signIn(ctx, r, "", actorAdmin)))
+			return
+		}
+
+		if a.opts.MultiTenant && token != "" {
+			tenant, err := a.store.GetTenantByAdminKey(ctx, auth.Hash(token))
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				a.log.ErrorContext(r.Context(), "failed to look up tenant admin key", "error", err)
+				writeError(w, http.StatusInternalServerError, "failed to verify admin key", nil)
+				return
+			}
+			if err == nil {
+				if requested != "" && requested != tenant.ID {
+					a.logins.Failed(ctx, requested, r.RemoteAddr, "admin key of tenant "+tenant.ID)
+					writeError(w, http.StatusForbidden, "admin key belongs to tenant "+tenant.ID, nil)
+					return
+				}
+				ctx = store.WithTenant(ctx, tenant.ID)
+				next(w, r.WithContext(a.signIn(ctx, r, tenant.ID, actorTenantAdmin)))
+				return
+			}
+		}
+
+		a.logins.Failed(ctx, requested, r.RemoteAddr, credentialProblem(token))
+		if a.opts.MultiTenant {
+			// Lets a browser prompt for a key to open the dashboard
+			w.Header().Add("WWW-Authenticate", `Basic realm="device-posture-collector", charset="UTF-8"`)
+		}
+		unauthorized(w, "admin token required")
+	}
+}
+
+// requireSuperAdmin protects endpoints that span tenants, such as creating
+// them, with the admin token alone
+func (a *API) requireSuperAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := auth.Token(r)
+		if a.opts.AdminToken != "" && !auth.Equal(token, a.opts.AdminToken) {
+			a.logins.Failed(r.Context(), "", r.RemoteAddr, credentialProblem(token))
+			unauthorized(w, "admin token required")
+			return
+		}
+		next(w, r.WithContext(a.signIn(r.Context(), r, "", actorAdmin)))
+	}
+}
+
+// signIn notes an admin request for the audit log, returning ctx saying who
+// made it. Without an admin token anybody may act as admin, anonymously.
+func (a *API) signIn(ctx context.Context, r *http.Request, tenant, actor string) context.Context {
+	if a.opts.AdminToken == "" {
+		return audit.WithActor(ctx, audit.ActorAnonymous, r.RemoteAddr)
+	}
+	a.logins.Succeeded(ctx, tenant, actor, r.RemoteAddr)
+	return audit.WithActor(ctx, actor, r.RemoteAddr)
+}
+
+// credentialProblem says what was wrong with the admin credential of a
+// request turned away
+func credentialProblem(token string) string {
+	if token == "" {
+		return "no admin credential"
+	}
+	return "wrong admin credential"
+}
+
+// requireViewer guards read endpoints. A single-tenant collector leaves
+// them open; a multi-tenant one needs an admin credential to know which
+// tenant's data to show.
+func (a *API) requireViewer(next http.HandlerFunc) http.HandlerFunc {
+	if !a.opts.MultiTenant {
+		return next
+	}
+	return a.requireAdmin(next)
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="device-posture-collector"`)
+	writeError(w, http.StatusUnauthorized, msg, nil)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"device-posture-collector/metrics"
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+// MaxBatchReports caps the reports one POST /reports may carry
+const MaxBatchReports = 500
+
+// DefaultMaxBatchBytes caps a batch body
+const DefaultMaxBatchBytes = 16 << 20
+
+// BatchResult is the outcome of one report in a batch. Index is the
+// report's position in the request array and Code the status POST /report
+// would have answered it with.
+type BatchResult struct {
+	Index   int                 `json:"index"`
+	Code    int                 `json:"code"`
+	Ack     *Ack                `json:"ack,omitempty"`
+	Error   string              `json:"error,omitempty"`
+	Details []report.FieldError `json:"details,omitempty"`
+}
+
+// BatchResponse answers POST /reports
+type BatchResponse struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []BatchResult `json:"results"`
+}
+
+// ReceiveBatch stores an array of reports, as an agent sends after
+// batching or flushing reports it couldn't deliver:
+//
+//	POST /reports [{"hostname": "laptop-1", ...}, {"hostname": "laptop-1", ...}]
+//
+// Each report is validated on its own; invalid ones are rejected in their
+// result without affecting the rest. The valid reports are stored in one
+// transaction, oldest first, so device state ends at the newest report.
+// If storage fails nothing is stored and the whole batch can be retried.
+func (a *API) ReceiveBatch(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r, a.opts.MaxBatchBytes, "batch")
+	if !ok || !a.checkSignature(w, r, body) {
+		return
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		writeError(w, http.StatusBadRequest, "batch must be a JSON array of reports: "+err.Error(), nil)
+		return
+	}
+	if len(items) == 0 {
+		writeError(w, http.StatusBadRequest, "batch is empty", nil)
+		return
+	}
+	if len(items) > MaxBatchReports {
+		writeError(w, http.StatusRequestEntityTooLarge, "batch exceeds "+strconv.Itoa(MaxBatchReports)+" reports", nil)
+		return
+	}
+
+	resp := BatchResponse{Results: make([]BatchResult, len(items))}
+	var valid []int
+	statuses := make([]*report.DeviceStatus, len(items))
+	for i, item := range items {
+		resp.Results[i].Index = i
+		status, code, rejection := a.checkReport(r, item, "")
+		if code != 0 {
+			resp.Results[i].Code = code
+			resp.Results[i].Error, resp.Results[i].Details = rejection.Error, rejection.Details
+			resp.Rejected++
+			a.opts.Metrics.ObserveReport(metrics.ResultForStatus(code))
+			continue
+		}
+		statuses[i] = status
+		valid = append(valid, i)
+	}
+	sort.SliceStable(valid, func(x, y int) bool {
+		return statuses[valid[x]].Timestamp.Before(statuses[valid[y]].Timestamp)
+	})
+
+	receivedAt := a.now().UTC()
+	batch := make([]store.NewReport, len(valid))
+	for n, i := range valid {
+		batch[n] = store.NewReport{Status: statuses[i], Verdict: a.evaluate(r.Context(), statuses[i]), ReceivedAt: receivedAt}
+	}
+	previous := make(map[string]store.Device)
+	for _, i := range valid {
+		hostname := statuses[i].Hostname
+		if _, ok := previous[hostname]; !ok {
+			previous[hostname] = a.previousDevice(r.Context(), hostname)
+		}
+	}
+
+	stored, err := a.store.SaveReports(r.Context(), batch)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to store batch", "reports", len(batch), "error", err)
+		for range valid {
+			a.opts.Metrics.ObserveReport(metrics.ResultError)
+		}
+		writeError(w, http.StatusInternalServerError, "failed to store reports", nil)
+		return
+	}
+
+	for n, i := range valid {
+		ack := a.acceptReport(r.Context(), previous[stored[n].Hostname], &stored[n])
+		resp.Results[i].Code, resp.Results[i].Ack = http.StatusOK, &ack
+		resp.Accepted++
+		a.opts.Metrics.ObserveReport(metrics.ResultAccepted)
+		// The next report of the batch follows on from this one
+		if stored[n].Dedup != store.DedupReplay {
+			previous[stored[n].Hostname] = deviceAfter(previous[stored[n].Hostname], &stored[n])
+		}
+	}
+	if resp.Rejected > 0 {
+		a.log.InfoContext(r.Context(), "batch received", "accepted", resp.Accepted, "rejected", resp.Rejected)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// deviceAfter is the device record as a stored report leaves it
+func deviceAfter(previous store.Device, stored *store.StoredReport) store.Device {
+	d := previous
+	d.Hostname = stored.Hostname
+	d.IP = stored.IP
+	d.Status = stored.Status
+	d.Score = stored.Score
+	d.DiskUsage = stored.DiskUsage
+	d.FailingChecks = stored.FailingChecks
+	d.LastSeen = stored.ReceivedAt
+	return d
+}
+
+// countBatches counts batches turned away before their reports were
+// looked at, e.g. by auth or rate limiting. ReceiveBatch counts the
+// reports of the batches it handles one by one.
+func (a *API) countBatches(next http.HandlerFunc) http.HandlerFunc {
+	if a.opts.Metrics == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next(rec, r)
+		if rec.code != http.StatusOK && rec.code != http.StatusInternalServerError {
+			a.opts.Metrics.ObserveReport(metrics.ResultForStatus(rec.code))
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/store"
+)
+
+// dashboardWindow is how far back the device page charts history
+const dashboardWindow = 7 * 24 * time.Hour
+
+// Chart geometry; matches the svg element in devicePage
+const (
+	chartWidth  = 720
+	chartHeight = 160
+)
+
+// fleetView is the data behind the device list page
+type fleetView struct {
+	Devices  []store.Device
+	Counts   map[string]int
+	Selector map[string]string // ?tag= filters in effect
+	Now      time.Time
+	// MultiTenant shows each device's tenant and keeps it in links
+	MultiTenant bool
+}
+
+// deviceView is the data behind one device's page
+type deviceView struct {
+	Device  store.Device
+	Latest  *store.StoredReport
+	History []store.StoredReport // oldest first
+	Recent  []store.StoredReport // newest first
+	Now     time.Time
+	// MultiTenant keeps the device's tenant in the stream URL
+	MultiTenant bool
+}
+
+// Dashboard lists every device with its current status
+func (a *API) Dashboard(w http.ResponseWriter, r *http.Request) {
+	devices, ok := a.listDevices(w, r)
+	if !ok {
+		return
+	}
+	selector, _ := parseTagSelector(w, r)
+	view := fleetView{Devices: devices, Counts: make(map[string]int), Selector: selector, Now: a.now(), MultiTenant: a.opts.MultiTenant}
+	for _, d := range devices {
+		if d.Stale {
+			view.Counts[alert.StatusStale]++
+		}
+		view.Counts[d.Status]++
+	}
+	a.renderPage(w, fleetPage, view)
+}
+
+// DashboardDevice shows one device's latest checks and recent history
+func (a *API) DashboardDevice(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	hostname := r.PathValue("hostname")
+	device, err := a.store.GetDevice(ctx, hostname)
+	if errors.Is(err, store.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to load device", "error", err)
+		http.Error(w, "failed to load device", http.StatusInternalServerError)
+		return
+	}
+
+	now := a.now()
+	device.Stale = a.isStale(device)
+	history, err := a.store.ListReports(ctx, store.Filter{
+		Hostname: hostname,
+		Since:    now.Add(-dashboardWindow),
+		Oldest:   true,
+		Limit:    maxHistoryLimit,
+	})
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to load history", "device", hostname, "error", err)
+		http.Error(w, "failed to load history", http.StatusInternalServerError)
+		return
+	}
+	recent, err := a.store.ListReports(ctx, store.Filter{Hostname: hostname, Limit: 20})
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to load reports", "device", hostname, "error", err)
+		http.Error(w, "failed to load reports", http.StatusInternalServerError)
+		return
+	}
+
+	view := deviceView{Device: device, History: history, Recent: recent, Now: now, MultiTenant: a.opts.MultiTenant}
+	if len(recent) > 0 {
+		view.Latest = &recent[0]
+	}
+	a.renderPage(w, devicePage, view)
+}
+
+func (a *API) renderPage(w http.ResponseWriter, page *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, data); err != nil {
+		a.log.Error("failed to render dashboard", "error", err)
+	}
+}
+
+// ago formats the time since t relative to now, e.g. "5m ago"
+func ago(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// polyline plots a 0-100 metric of each report as SVG polyline points
+func polyline(reports []store.StoredReport, metric string) string {
+	if len(reports) == 0 {
+		return ""
+	}
+	first, last := reports[0].Timestamp, reports[len(reports)-1].Timestamp
+	span := last.Sub(first).Seconds()
+
+	points := make([]string, 0, len(reports))
+	for _, r := range reports {
+		var v float64
+		switch metric {
+		case "disk":
+			v = r.DiskUsage
+		case "cpu":
+			v = r.CPUUsage
+		case "memory":
+			v = r.MemoryUsage
+		}
+		x := 0.0
+		if span > 0 {
+			x = r.Timestamp.Sub(first).Seconds() / span * chartWidth
+		}
+		y := chartHeight - v/100*chartHeight
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return strings.Join(points, " ")
+}
+
+var dashboardFuncs = template.FuncMap{
+	"ago":      ago,
+	"polyline": polyline,
+	"when": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	},
+}
+
+const dashboardStyle = `<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+a { color: #0969da; text-decoration: none; }
+.HEALTHY { color: #1a7f37; } .DEGRADED { color: #9a6700; } .UNHEALTHY { color: #cf222e; } .STALE { color: #6e7781; } .ENROLLED { color: #0969da; }
+table { border-collapse: collapse; margin-top: 1em; }
+td, th { border-bottom: 1px solid #ddd; padding: 4px 12px; text-align: left; }
+.counts span { margin-right: 1.5em; font-weight: bold; }
+svg { border: 1px solid #ddd; margin-top: 1em; }
+.legend span { margin-right: 1em; }
+.tag { background: #eef1f4; border-radius: 3px; padding: 1px 6px; margin-right: 4px; font-size: 0.9em; color: #222; }
+</style>`
+
+// dashboardLive reloads the page shortly after the fleet changes, falling
+// back to polling when the stream is unavailable
+const dashboardLive = `<noscript><meta http-equiv="refresh" content="30"></noscript>
+<script>
+document.addEventListener("DOMContentLoaded", function () {
+  var reload = function () { location.reload(); };
+  if (!window.EventSource) { setTimeout(reload, 30000); return; }
+  var pending, src = new EventSource(document.body.dataset.stream);
+  var changed = function () { clearTimeout(pending); pending = setTimeout(reload, 1000); };
+  src.addEventListener("report", changed);
+  src.addEventListener("transition", changed);
+});
+</script>`
+
+var fleetPage = template.Must(template.New("fleet").Funcs(dashboardFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Device Fleet</title>
+` + dashboardStyle + dashboardLive + `
+</head>
+<body data-stream="/stream?types=report,transition">
+<h1>Device Fleet</h1>
+{{with .Selector}}<p>Filtered by {{range $k, $v := .}}<span class="tag">{{$k}}: {{$v}}</span>{{end}} &middot; <a href="/dashboard">clear</a></p>{{end}}
+<p class="counts">
+<span>{{len .Devices}} devices</span>
+<span class="HEALTHY">{{index .Counts "HEALTHY"}} healthy</span>
+<span class="DEGRADED">{{index .Counts "DEGRADED"}} degraded</span>
+<span class="UNHEALTHY">{{index .Counts "UNHEALTHY"}} unhealthy</span>
+<span class="STALE">{{index .Counts "STALE"}} stale</span>
+</p>
+{{if .Devices}}
+<table>
+<tr><th>Device</th>{{if .MultiTenant}}<th>Tenant</th>{{end}}<th>IP</th><th>Status</th><th>Score</th><th>Last seen</th><th>Failing checks</th><th>Tags</th><th>Reports</th></tr>
+{{range .Devices}}<tr>
+<td><a href="/dashboard/devices/{{.Hostname}}{{if $.MultiTenant}}?tenant={{.Tenant}}{{end}}">{{.Hostname}}</a></td>
+{{if $.MultiTenant}}<td>{{.Tenant}}</td>{{end}}
+<td>{{.IP}}</td>
+<td class="{{.Status}}">{{.Status}}{{if .Stale}} <span class="STALE">(STALE)</span>{{end}}{{if .PolicyMismatch}} <span class="{{.ServerStatus}}" title="Collector policy verdict">(policy: {{.ServerStatus}})</span>{{end}}</td>
+<td>{{.Score}}</td>
+<td title="{{when .LastSeen}} UTC"{{if .Stale}} class="STALE"{{end}}>{{ago .LastSeen $.Now}}</td>
+<td>{{range $i, $c := .FailingChecks}}{{if $i}}, {{end}}{{$c}}{{else}}&ndash;{{end}}</td>
+<td>{{range $k, $v := .Tags}}<a class="tag" href="/dashboard?tag={{$k}}:{{$v}}">{{$k}}: {{$v}}</a>{{end}}</td>
+<td>{{.ReportCount}}</td>
+</tr>
+{{end}}</table>
+{{else}}
+<p>No device has reported yet.</p>
+{{end}}
+</body>
+</html>
+`))
+
+var devicePage = template.Must(template.New("device").Funcs(dashboardFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Device.Hostname}} &middot; Device Posture</title>
+` + dashboardStyle + dashboardLive + `
+</head>
+<body data-stream="/stream?types=report,transition&amp;hostname={{.Device.Hostname}}{{if .MultiTenant}}&amp;tenant={{.Device.Tenant}}{{end}}">
+<p><a href="/dashboard">&larr; All devices</a></p>
+<h1>{{.Device.Hostname}}</h1>
+<h2 class="{{.Device.Status}}">{{.Device.Status}} &middot; score {{.Device.Score}}</h2>
+{{if .Device.Stale}}<p class="STALE">STALE: no report since {{when .Device.LastSeen}} UTC; the status above may be out of date.</p>{{end}}
+{{with .Device.Tags}}<p>{{range $k, $v := .}}<a class="tag" href="/dashboard?tag={{$k}}:{{$v}}">{{$k}}: {{$v}}</a>{{end}}</p>{{end}}
+<p>{{.Device.IP}} &middot; last seen {{ago .Device.LastSeen .Now}} ({{when .Device.LastSeen}} UTC) &middot; {{.Device.ReportCount}} reports</p>
+
+{{with .Latest}}
+{{with .OS}}<p>{{.Name}} {{.Version}} ({{.Arch}})</p>{{end}}
+<p>{{.Message}}</p>
+{{if .Checks}}
+<table>
+<tr><th>Check</th><th>Result</th><th>Details</th></tr>
+{{range .Checks}}<tr><td>{{.Name}}</td><td>{{if .Passed}}✓ passed{{else}}<span class="UNHEALTHY">✗ {{.Severity}}</span>{{end}}</td><td>{{.Message}}{{if .Remediation}}<br><em>{{.Remediation}}</em>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+
+<h3>Last 7 days</h3>
+{{if .History}}
+<svg width="720" height="160" viewBox="0 0 720 160">
+<polyline fill="none" stroke="#0969da" stroke-width="2" points="{{polyline .History "disk"}}"/>
+<polyline fill="none" stroke="#8250df" stroke-width="2" points="{{polyline .History "cpu"}}"/>
+<polyline fill="none" stroke="#bf8700" stroke-width="2" points="{{polyline .History "memory"}}"/>
+</svg>
+<p class="legend"><span style="color:#0969da">&#9632; disk %</span><span style="color:#8250df">&#9632; CPU %</span><span style="color:#bf8700">&#9632; memory %</span></p>
+{{else}}
+<p>No reports in the last 7 days.</p>
+{{end}}
+
+<h3>Recent reports</h3>
+<table>
+<tr><th>Time (UTC)</th><th>Status</th><th>Score</th><th>Disk</th><th>CPU</th><th>Memory</th><th>Failing checks</th></tr>
+{{range .Recent}}<tr>
+<td>{{when .Timestamp}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{.Score}}</td>
+<td>{{printf "%.1f" .DiskUsage}}%</td>
+<td>{{printf "%.1f" .CPUUsage}}%</td>
+<td>{{printf "%.1f" .MemoryUsage}}%</td>
+<td>{{range $i, $c := .FailingChecks}}{{if $i}}, {{end}}{{$c}}{{else}}&ndash;{{end}}</td>
+</tr>
+{{end}}</table>
+<p><a href="/devices/{{.Device.Hostname}}/history?since=7d">JSON history</a></p>
+</body>
+</html>
+`))
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+
+	"device-posture-collector/auth"
+	"device-posture-collector/store"
+)
+
+// Enrollment and key lifetimes
+const (
+	defaultTokenTTL = 24 * time.Hour
+	maxTokenTTL     = 30 * 24 * time.Hour
+	rotationGrace   = time.Hour // the old key keeps working while agents switch
+)
+
+// Credential is a newly issued API key, returned only once
+type Credential struct {
+	Tenant   string            `json:"tenant"`
+	Hostname string            `json:"hostname"`
+	KeyID    string            `json:"key_id"`
+	APIKey   string            `json:"api_key"`
+	Tags     map[string]string `json:"tags,omitempty"` // the device's tags after enrollment
+}
+
+// CreateEnrollmentToken issues a one-time token for enrolling a device into
+// the caller's tenant. Tags, such as the device's group, are assigned to the
+// device when it enrolls:
+//
+//	POST /enrollment-tokens {"ttl": "24h", "tags": {"group": "engineering"}}
+func (a *API) CreateEnrollmentToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TTL  string            `json:"ttl"`
+		Tags map[string]string `json:"tags"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "malformed JSON: "+err.Error(), nil)
+		return
+	}
+	ttl := defaultTokenTTL
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 || ttl > maxTokenTTL {
+			writeError(w, http.StatusBadRequest, "ttl must be a duration up to 720h", nil)
+			return
+		}
+	}
+	if errs := validateTags(req.Tags); len(errs) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, "invalid tags", errs)
+		return
+	}
+
+	secret, err := auth.NewSecret(auth.PrefixEnrollmentToken)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token", nil)
+		return
+	}
+	now := a.now().UTC()
+	token := store.EnrollmentToken{
+		ID:        secret.ID,
+		Tenant:    store.TenantOf(r.Context()),
+		Tags:      req.Tags,
+		Hash:      secret.Hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := a.store.CreateEnrollmentToken(r.Context(), token); err != nil {
+		a.log.ErrorContext(r.Context(), "failed to store enrollment token", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to store token", nil)
+		return
+	}
+	a.log.InfoContext(r.Context(), "enrollment token created", "token", token.ID, "tenant", token.Tenant, "expires_at", token.ExpiresAt)
+	a.audit(r, audit.Event{Tenant: token.Tenant, Action: "enrollment_token.create", Object: "token " + token.ID,
+		Detail: fmt.Sprintf("expires %s, tags %v", token.ExpiresAt.Format(time.RFC3339), token.Tags)})
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"id":         token.ID,
+		"tenant":     token.Tenant,
+		"tags":       token.Tags,
+		"token":      secret.Value,
+		"expires_at": token.ExpiresAt,
+	})
+}
+
+func (a *API) ListEnrollmentTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := a.store.ListEnrollmentTokens(r.Context())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to list enrollment tokens", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list tokens", nil)
+		return
+	}
+	if tokens == nil {
+		tokens = []store.EnrollmentToken{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total": len(tokens), "tokens": tokens})
+}
+
+// Enroll exchanges a one-time enrollment token for a device API key in the
+// token's tenant, and registers the device with the token's tags so it is
+// listed before its first report. Enrolling a hostname again (e.g. after a
+// reinstall) revokes its old keys. The device may register the Ed25519
+// public key, in base64, that it will sign its reports with.
+//
+//	POST /enroll {"token": "dpe_...", "hostname": "laptop-1", "signing_key": "<base64>"}
+func (a *API) Enroll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token      string `json:"token"`
+		Hostname   string `json:"hostname"`
+		SigningKey string `json:"signing_key"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed JSON: "+err.Error(), nil)
+		return
+	}
+	req.Hostname = strings.TrimSpace(req.Hostname)
+	if req.Token == "" || req.Hostname == "" {
+		writeError(w, http.StatusBadRequest, "token and hostname are required", nil)
+		return
+	}
+	if req.SigningKey != "" {
+		if pub, err := base64.StdEncoding.DecodeString(req.SigningKey); err != nil || len(pub) != ed25519.PublicKeySize {
+			writeError(w, http.StatusBadRequest, "signing_key must be an Ed25519 public key in base64", nil)
+			return
+		}
+	}
+
+	now := a.now().UTC()
+	token, err := a.store.ConsumeEnrollmentToken(r.Context(), auth.Hash(req.Token), req.Hostname, now)
+	if errors.Is(err, store.ErrNotFound) {
+		a.log.WarnContext(r.Context(), "enrollment rejected: invalid, used or expired token", "device", req.Hostname, "remote_addr", r.RemoteAddr)
+		a.audit(r, audit.Event{Actor: req.Hostname, Address: r.RemoteAddr, Action: "device.enroll",
+			Object: "device " + req.Hostname, Outcome: audit.OutcomeDenied, Detail: "invalid, used or expired token"})
+		writeError(w, http.StatusForbidden, "invalid, used or expired enrollment token", nil)
+		return
+	}
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to consume enrollment token", "error", err)
+		writeError(w, http.StatusInternalServerError, "enrollment failed", nil)
+		return
+	}
+
+	r = r.WithContext(store.WithTenant(r.Context(), token.Tenant))
+	if _, err := a.store.RevokeAPIKeys(r.Context(), req.Hostname, now); err != nil {
+		a.log.ErrorContext(r.Context(), "failed to revoke old keys", "device", req.Hostname, "error", err)
+		writeError(w, http.StatusInternalServerError, "enrollment failed", nil)
+		return
+	}
+	cred, ok := a.issueKey(w, r, req.Hostname, req.SigningKey)
+	if !ok {
+		return
+	}
+	device, err := a.store.RegisterDevice(r.Context(), req.Hostname, token.Tags, now)
+	if err != nil {
+		// The key is issued; the device record is created by its first report
+		a.log.ErrorContext(r.Context(), "failed to register device", "device", req.Hostname, "error", err)
+	}
+	cred.Tags = device.Tags
+	if device.Status == store.StatusEnrolled {
+		a.stream.publish(EventTransition, device.Tenant, device.Hostname, TransitionEvent{
+			Tenant: device.Tenant, Hostname: device.Hostname, To: store.StatusEnrolled, Time: now,
+		})
+	}
+	a.log.InfoContext(r.Context(), "device enrolled", "device", req.Hostname, "tenant", token.Tenant, "token", token.ID, "key_id", cred.KeyID, "tags", cred.Tags)
+	a.audit(r, audit.Event{Actor: req.Hostname, Address: r.RemoteAddr, Action: "device.enroll", Object: "device " + req.Hostname,
+		Outcome: audit.OutcomeSuccess, Detail: fmt.Sprintf("token %s, key %s", token.ID, cred.KeyID)})
+	writeJSON(w, http.StatusCreated, cred)
+}
+
+// RotateKey replaces the calling device's API key. The old key stays valid
+// for an hour so in-flight reports are not rejected. The device's signing
+// key carries over to the new one.
+//
+//	POST /keys/rotate (Authorization: Bearer <current key>)
+func (a *API) RotateKey(w http.ResponseWriter, r *http.Request) {
+	current, ok := authenticatedKey(r.Context())
+	hostname := current.Hostname
+	if !ok {
+		writeError(w, http.StatusBadRequest, "key rotation needs authentication enabled (-require-auth)", nil)
+		return
+	}
+	expires := a.now().UTC().Add(rotationGrace)
+	if err := a.store.ExpireAPIKey(r.Context(), auth.Hash(auth.BearerToken(r)), expires); err != nil {
+		a.log.ErrorContext(r.Context(), "failed to expire key", "device", hostname, "error", err)
+		writeError(w, http.StatusInternalServerError, "rotation failed", nil)
+		return
+	}
+	cred, ok := a.issueKey(w, r, hostname, current.SigningKey)
+	if !ok {
+		return
+	}
+	a.log.InfoContext(r.Context(), "key rotated", "device", hostname, "key_id", cred.KeyID)
+	a.audit(r, audit.Event{Action: "key.rotate", Object: "device " + hostname,
+		Detail: fmt.Sprintf("key %s, previous key valid until %s", cred.KeyID, expires.Format(time.RFC3339))})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tenant":              cred.Tenant,
+		"hostname":            cred.Hostname,
+		"key_id":              cred.KeyID,
+		"api_key":             cred.APIKey,
+		"previous_expires_at": expires,
+	})
+}
+
+func (a *API) issueKey(w http.ResponseWriter, r *http.Request, hostname, signingKey string) (Credential, bool) {
+	tenant := store.TenantOf(r.Context())
+	secret, err := auth.NewSecret(auth.PrefixAPIKey)
+	if err == nil {
+		err = a.store.CreateAPIKey(r.Context(), store.APIKey{
+			ID:         secret.ID,
+			Tenant:     tenant,
+			Hostname:   hostname,
+			Hash:       secret.Hash,
+			SigningKey: signingKey,
+			CreatedAt:  a.now().UTC(),
+		})
+	}
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to issue key", "device", hostname, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to issue API key", nil)
+		return Credential{}, false
+	}
+	return Credential{Tenant: tenant, Hostname: hostname, KeyID: secret.ID, APIKey: secret.Value}, true
+}
+
+// ListKeys shows a device's keys (never the secrets)
+func (a *API) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.store.ListAPIKeys(r.Context(), r.PathValue("hostname"))
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to list keys", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list keys", nil)
+		return
+	}
+	if keys == nil {
+		keys = []store.APIKey{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total": len(keys), "keys": keys})
+}
+
+// RevokeKeys revokes every key of a device; its reports are rejected until
+// it enrolls again
+func (a *API) RevokeKeys(w http.ResponseWriter, r *http.Request) {
+	hostname := r.PathValue("hostname")
+	n, err := a.store.RevokeAPIKeys(r.Context(), hostname, a.now().UTC())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to revoke keys", "device", hostname, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to revoke keys", nil)
+		return
+	}
+	a.log.InfoContext(r.Context(), "keys revoked", "device", hostname, "count", n)
+	a.audit(r, audit.Event{Tenant: store.TenantOf(r.Context()), Action: "key.revoke", Object: "device " + hostname, Detail: fmt.Sprintf("%d keys", n)})
+	writeJSON(w, http.StatusOK, map[string]any{"hostname": hostname, "revoked": n})
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"device-posture-collector/store"
+)
+
+// Export sizes
+const (
+	defaultExportLimit = 10000
+	maxExportLimit     = 100000
+	exportBatch        = 500 // reports read from the store at a time
+)
+
+// exportColumns is the CSV header; nested data is only in NDJSON
+var exportColumns = []string{
+	"id", "hostname", "ip", "status", "score", "severity", "disk_usage", "cpu_usage", "memory_usage",
+	"failing_checks", "timestamp", "received_at", "schema_version", "tenant", "repeats",
+}
+
+// ExportReports streams reports, oldest first, for offline analysis:
+//
+//	GET /export/reports?format=csv|ndjson&hostname=&status=&since=30d&until=&cursor=&limit=
+//
+// A response holds at most limit reports (default 10000). When more match,
+// the X-Next-Cursor trailer carries the id to pass as ?cursor= for the next
+// page; clients that can't read trailers can pass the last row's id and stop
+// at the first page shorter than limit.
+func (a *API) ExportReports(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := a.now().UTC()
+	filter := store.Filter{Hostname: q.Get("hostname"), Status: q.Get("status"), Oldest: true}
+
+	format := q.Get("format")
+	switch format {
+	case "":
+		format = "ndjson"
+	case "csv", "ndjson":
+	default:
+		writeError(w, http.StatusBadRequest, "format must be csv or ndjson", nil)
+		return
+	}
+
+	var err error
+	if filter.Since, err = parseTime(q.Get("since"), now); err != nil {
+		writeError(w, http.StatusBadRequest, "since: "+err.Error(), nil)
+		return
+	}
+	if filter.Until, err = parseTime(q.Get("until"), now); err != nil {
+		writeError(w, http.StatusBadRequest, "until: "+err.Error(), nil)
+		return
+	}
+	if raw := q.Get("cursor"); raw != "" {
+		filter.Cursor, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || filter.Cursor <= 0 {
+			writeError(w, http.StatusBadRequest, "cursor must be a positive integer", nil)
+			return
+		}
+	}
+	limit, ok := parseLimit(w, r, defaultExportLimit)
+	if !ok {
+		return
+	}
+	if limit == 0 || limit > maxExportLimit {
+		limit = maxExportLimit
+	}
+
+	// Read the first batch before committing to a 200, so storage errors
+	// still get a proper error response
+	filter.Limit = min(exportBatch, limit) + 1
+	batch, err := a.store.ListReports(r.Context(), filter)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "export failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to read reports", nil)
+		return
+	}
+
+	w.Header().Set("Trailer", "X-Next-Cursor")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="reports-%s.%s"`, now.Format("20060102T150405Z"), format))
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	write := exportNDJSON(w)
+	var flush func() error
+	if format == "csv" {
+		write, flush = exportCSV(w)
+	}
+
+	written := 0
+	for {
+		more := len(batch) == filter.Limit
+		if more {
+			batch = batch[:len(batch)-1]
+		}
+		for i := range batch {
+			if err := write(&batch[i]); err != nil {
+				return // client went away
+			}
+		}
+		written += len(batch)
+		if flush != nil {
+			flush()
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if !more {
+			return
+		}
+		filter.Cursor = batch[len(batch)-1].ID
+		if written == limit {
+			w.Header().Set("X-Next-Cursor", strconv.FormatInt(filter.Cursor, 10))
+			return
+		}
+
+		filter.Limit = min(exportBatch, limit-written) + 1
+		if batch, err = a.store.ListReports(r.Context(), filter); err != nil {
+			// Too late for an error status; a truncated export has no trailer
+			a.log.ErrorContext(r.Context(), "export failed", "written", written, "error", err)
+			return
+		}
+	}
+}
+
+func exportNDJSON(w http.ResponseWriter) func(*store.StoredReport) error {
+	enc := json.NewEncoder(w)
+	return func(r *store.StoredReport) error { return enc.Encode(r) }
+}
+
+func exportCSV(w http.ResponseWriter) (func(*store.StoredReport) error, func() error) {
+	cw := csv.NewWriter(w)
+	cw.Write(exportColumns)
+	write := func(r *store.StoredReport) error {
+		return cw.Write([]string{
+			strconv.FormatInt(r.ID, 10),
+			r.Hostname,
+			r.IP,
+			r.Status,
+			strconv.Itoa(r.Score),
+			r.Severity,
+			strconv.FormatFloat(r.DiskUsage, 'f', -1, 64),
+			strconv.FormatFloat(r.CPUUsage, 'f', -1, 64),
+			strconv.FormatFloat(r.MemoryUsage, 'f', -1, 64),
+			strings.Join(r.FailingChecks, ";"),
+			r.Timestamp.UTC().Format(time.RFC3339),
+			r.ReceivedAt.UTC().Format(time.RFC3339Nano),
+			strconv.Itoa(r.SchemaVersion),
+			r.Tenant,
+			strconv.Itoa(r.Repeats),
+		})
+	}
+	flush := func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+	return write, flush
+}
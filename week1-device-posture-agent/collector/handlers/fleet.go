@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+// defaultTopChecks is how many failing checks a summary lists
+const defaultTopChecks = 5
+
+// ungrouped labels devices without the group_by tag
+const ungrouped = "(none)"
+
+// Summary aggregates the posture of a set of devices. A device is compliant
+// when its latest report is HEALTHY and it is still reporting.
+type Summary struct {
+	Devices           int            `json:"devices"`
+	ByStatus          map[string]int `json:"by_status"`
+	CompliancePercent float64        `json:"compliance_percent"`
+	AvgDiskUsage      float64        `json:"avg_disk_usage"`
+	AvgScore          float64        `json:"avg_score"`
+	TopFailingChecks  []CheckCount   `json:"top_failing_checks"`
+}
+
+// CheckCount is how many devices fail one check
+type CheckCount struct {
+	Check   string `json:"check"`
+	Devices int    `json:"devices"`
+}
+
+// GroupSummary is the summary of the devices sharing one tag value
+type GroupSummary struct {
+	Group string `json:"group"`
+	Summary
+}
+
+// Fleet is the response of GET /fleet/summary
+type Fleet struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	GroupBy     string         `json:"group_by,omitempty"`
+	Overall     Summary        `json:"fleet"`
+	Groups      []GroupSummary `json:"groups,omitempty"`
+}
+
+// FleetSummary returns fleet-level posture for executive dashboards:
+//
+//	GET /fleet/summary?group_by=site&tag=ou:finance&top=5
+//
+// group_by adds one summary per value of that tag; tag narrows the fleet
+// first, as on GET /devices. Stale devices count as STALE, not as their last
+// reported status.
+func (a *API) FleetSummary(w http.ResponseWriter, r *http.Request) {
+	top := defaultTopChecks
+	if raw := r.URL.Query().Get("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "top must be a non-negative integer", nil)
+			return
+		}
+		top = n
+	}
+	devices, ok := a.listDevices(w, r)
+	if !ok {
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	out := Fleet{GeneratedAt: a.now().UTC(), GroupBy: groupBy, Overall: summarize(devices, top)}
+	if groupBy != "" {
+		groups := make(map[string][]store.Device)
+		for _, d := range devices {
+			value, ok := d.Tags[groupBy]
+			if !ok {
+				value = ungrouped
+			}
+			groups[value] = append(groups[value], d)
+		}
+		for name, members := range groups {
+			out.Groups = append(out.Groups, GroupSummary{Group: name, Summary: summarize(members, top)})
+		}
+		sort.Slice(out.Groups, func(i, j int) bool { return out.Groups[i].Group < out.Groups[j].Group })
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// summarize aggregates devices whose Stale flag is already set
+func summarize(devices []store.Device, top int) Summary {
+	s := Summary{
+		Devices: len(devices),
+		ByStatus: map[string]int{
+			report.StatusHealthy:   0,
+			report.StatusDegraded:  0,
+			report.StatusUnhealthy: 0,
+			alert.StatusStale:      0,
+		},
+		TopFailingChecks: []CheckCount{},
+	}
+	if len(devices) == 0 {
+		return s
+	}
+
+	var compliant int
+	var disk, score float64
+	failing := make(map[string]int)
+	for _, d := range devices {
+		status := d.Status
+		if d.Stale {
+			status = alert.StatusStale
+		}
+		s.ByStatus[status]++
+		if status == report.StatusHealthy {
+			compliant++
+		}
+		disk += d.DiskUsage
+		score += float64(d.Score)
+		for _, check := range d.FailingChecks {
+			failing[check]++
+		}
+	}
+	n := float64(len(devices))
+	s.CompliancePercent = round1(100 * float64(compliant) / n)
+	s.AvgDiskUsage = round1(disk / n)
+	s.AvgScore = round1(score / n)
+
+	for check, count := range failing {
+		s.TopFailingChecks = append(s.TopFailingChecks, CheckCount{Check: check, Devices: count})
+	}
+	sort.Slice(s.TopFailingChecks, func(i, j int) bool {
+		a, b := s.TopFailingChecks[i], s.TopFailingChecks[j]
+		if a.Devices != b.Devices {
+			return a.Devices > b.Devices
+		}
+		return a.Check < b.Check
+	})
+	if len(s.TopFailingChecks) > top {
+		s.TopFailingChecks = s.TopFailingChecks[:top]
+	}
+	return s
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/store"
+)
+
+// The /grafana endpoints speak the JSON data source protocol (the SimpleJSON
+// and "JSON" Grafana data sources), so an existing Grafana can chart fleet
+// posture by pointing a data source at http://collector:8000/grafana.
+
+// minGrafanaStep keeps a zoomed-in panel from asking for one bucket per
+// report
+const minGrafanaStep = time.Minute
+
+// maxGrafanaPoints caps the buckets one target may return
+const maxGrafanaPoints = 10000
+
+// grafanaSeries are the time series targets, each read from a SeriesPoint
+var grafanaSeries = map[string]func(p store.SeriesPoint) float64{
+	"reports":           func(p store.SeriesPoint) float64 { return float64(p.Reports) },
+	"devices_reporting": func(p store.SeriesPoint) float64 { return float64(p.Devices) },
+	"unhealthy_reports": func(p store.SeriesPoint) float64 { return float64(p.Unhealthy) },
+	"degraded_reports":  func(p store.SeriesPoint) float64 { return float64(p.Degraded) },
+	"unhealthy_percent": func(p store.SeriesPoint) float64 { return 100 * float64(p.Unhealthy) / float64(p.Reports) },
+	"avg_score":         func(p store.SeriesPoint) float64 { return p.AvgScore },
+	"avg_disk_usage":    func(p store.SeriesPoint) float64 { return p.AvgDisk },
+	"avg_cpu_usage":     func(p store.SeriesPoint) float64 { return p.AvgCPU },
+	"avg_memory_usage":  func(p store.SeriesPoint) float64 { return p.AvgMemory },
+}
+
+// grafanaDevicesTable is the table target listing every device's state
+const grafanaDevicesTable = "devices"
+
+// grafanaQuery is the body Grafana posts to /grafana/query
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64 `json:"intervalMs"`
+	MaxDataPoints int64 `json:"maxDataPoints"`
+	Targets       []struct {
+		Target  string `json:"target"`
+		RefID   string `json:"refId"`
+		Type    string `json:"type"`
+		Payload struct {
+			Hostname string `json:"hostname"`
+			Status   string `json:"status"`
+		} `json:"payload"`
+	} `json:"targets"`
+	AdhocFilters []grafanaFilter `json:"adhocFilters"`
+}
+
+type grafanaFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type grafanaTimeSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"` // [value, unix ms]
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	RefID   string          `json:"refId,omitempty"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]any         `json:"rows"`
+}
+
+// GrafanaTest answers the data source's connection test
+func (a *API) GrafanaTest(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GrafanaSearch lists the targets a panel can query
+func (a *API) GrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, grafanaTargets())
+}
+
+// GrafanaMetrics lists the targets in the JSON data source's format
+func (a *API) GrafanaMetrics(w http.ResponseWriter, r *http.Request) {
+	targets := grafanaTargets()
+	out := make([]map[string]string, 0, len(targets))
+	for _, t := range targets {
+		out = append(out, map[string]string{"label": t, "value": t})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// GrafanaTagKeys lists the ad hoc filter keys
+func (a *API) GrafanaTagKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, []map[string]string{
+		{"type": "string", "text": "hostname"},
+		{"type": "string", "text": "status"},
+	})
+}
+
+// GrafanaTagValues lists the values of one ad hoc filter key
+func (a *API) GrafanaTagValues(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req)
+
+	values := []map[string]string{}
+	switch req.Key {
+	case "hostname":
+		devices, err := a.store.ListDevices(r.Context())
+		if err != nil {
+			a.log.ErrorContext(r.Context(), "grafana: failed to list devices", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to list devices", nil)
+			return
+		}
+		for _, d := range devices {
+			values = append(values, map[string]string{"text": d.Hostname})
+		}
+	case "status":
+		for _, s := range []string{"HEALTHY", "DEGRADED", "UNHEALTHY"} {
+			values = append(values, map[string]string{"text": s})
+		}
+	}
+	writeJSON(w, http.StatusOK, values)
+}
+
+// GrafanaQuery returns the requested series over the panel's time range.
+// Series come from the raw reports, so they reach back as far as
+// -retain-reports keeps them.
+func (a *API) GrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	var q grafanaQuery
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&q); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed query: "+err.Error(), nil)
+		return
+	}
+	if q.Range.From.IsZero() || q.Range.To.IsZero() || !q.Range.From.Before(q.Range.To) {
+		writeError(w, http.StatusBadRequest, "range.from and range.to are required, from before to", nil)
+		return
+	}
+	step := grafanaStep(q.Range.To.Sub(q.Range.From), time.Duration(q.IntervalMs)*time.Millisecond, q.MaxDataPoints)
+
+	out := []any{}
+	for _, t := range q.Targets {
+		if t.Target == "" {
+			continue
+		}
+		filter := store.Filter{Since: q.Range.From, Until: q.Range.To, Hostname: t.Payload.Hostname, Status: t.Payload.Status}
+		for _, f := range q.AdhocFilters {
+			if f.Operator != "=" {
+				continue
+			}
+			switch f.Key {
+			case "hostname":
+				filter.Hostname = f.Value
+			case "status":
+				filter.Status = f.Value
+			}
+		}
+
+		if t.Target == grafanaDevicesTable {
+			table, err := a.grafanaDevices(r, filter)
+			if err != nil {
+				a.log.ErrorContext(r.Context(), "grafana: failed to list devices", "error", err)
+				writeError(w, http.StatusInternalServerError, "failed to list devices", nil)
+				return
+			}
+			table.RefID = t.RefID
+			out = append(out, table)
+			continue
+		}
+
+		value, ok := grafanaSeries[t.Target]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "unknown target "+t.Target+"; see POST /grafana/search", nil)
+			return
+		}
+		points, err := a.store.ReportSeries(r.Context(), filter, step)
+		if err != nil {
+			a.log.ErrorContext(r.Context(), "grafana: failed to load series", "target", t.Target, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to load series", nil)
+			return
+		}
+		series := grafanaTimeSeries{Target: t.Target, RefID: t.RefID, Datapoints: make([][2]float64, 0, len(points))}
+		for _, p := range points {
+			series.Datapoints = append(series.Datapoints, [2]float64{value(p), float64(p.Bucket.UnixMilli())})
+		}
+		out = append(out, series)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// grafanaStep picks the bucket width for a panel: Grafana's interval, but
+// no finer than minGrafanaStep and coarse enough to stay within the point
+// limits
+func grafanaStep(span, interval time.Duration, maxPoints int64) time.Duration {
+	step := max(interval, minGrafanaStep)
+	if maxPoints <= 0 || maxPoints > maxGrafanaPoints {
+		maxPoints = maxGrafanaPoints
+	}
+	if limit := span / time.Duration(maxPoints); step < limit {
+		step = limit
+	}
+	return step.Truncate(time.Second)
+}
+
+// grafanaDevices renders the latest state of each device as a table
+func (a *API) grafanaDevices(r *http.Request, filter store.Filter) (grafanaTable, error) {
+	devices, err := a.store.ListDevices(r.Context())
+	if err != nil {
+		return grafanaTable{}, err
+	}
+	table := grafanaTable{
+		Type: "table",
+		Columns: []grafanaColumn{
+			{"Last seen", "time"}, {"Hostname", "string"}, {"Status", "string"}, {"Score", "number"},
+			{"Disk usage", "number"}, {"Failing checks", "string"}, {"Tags", "string"},
+		},
+		Rows: [][]any{},
+	}
+	for _, d := range devices {
+		status := d.Status
+		if a.isStale(d) {
+			status = alert.StatusStale
+		}
+		if (filter.Hostname != "" && d.Hostname != filter.Hostname) || (filter.Status != "" && status != filter.Status) {
+			continue
+		}
+		tags := make([]string, 0, len(d.Tags))
+		for k, v := range d.Tags {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		table.Rows = append(table.Rows, []any{
+			d.LastSeen.UnixMilli(), d.Hostname, status, d.Score,
+			d.DiskUsage, strings.Join(d.FailingChecks, ", "), strings.Join(tags, ", "),
+		})
+	}
+	return table, nil
+}
+
+// grafanaTargets returns every queryable target, sorted
+func grafanaTargets() []string {
+	targets := []string{grafanaDevicesTable}
+	for name := range grafanaSeries {
+		targets = append(targets, name)
+	}
+	sort.Strings(targets)
+	return targets
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"device-posture-collector/store"
+)
+
+// History page sizes
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// historyFields are the report fields that ?fields= may select
+var historyFields = jsonFieldNames(reflect.TypeOf(store.StoredReport{}))
+
+// History is one page of a device's report history
+type History struct {
+	Hostname   string            `json:"hostname"`
+	Since      *time.Time        `json:"since,omitempty"`
+	Until      *time.Time        `json:"until,omitempty"`
+	Count      int               `json:"count"`
+	Reports    []json.RawMessage `json:"reports"`
+	NextCursor int64             `json:"next_cursor,omitempty"`
+}
+
+// DeviceHistory returns a device's reports for trend views:
+//
+//	GET /devices/{hostname}/history?since=7d&fields=disk_usage&order=asc&limit=500&cursor=
+//
+// since and until accept RFC 3339 times or a lookback such as 24h or 7d.
+// fields limits each report to the named fields plus id and timestamp.
+// When more reports match, next_cursor is passed back as ?cursor= to fetch
+// the following page.
+func (a *API) DeviceHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := a.now().UTC()
+	filter := store.Filter{Hostname: r.PathValue("hostname")}
+
+	var err error
+	if filter.Since, err = parseTime(q.Get("since"), now); err != nil {
+		writeError(w, http.StatusBadRequest, "since: "+err.Error(), nil)
+		return
+	}
+	if filter.Until, err = parseTime(q.Get("until"), now); err != nil {
+		writeError(w, http.StatusBadRequest, "until: "+err.Error(), nil)
+		return
+	}
+
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Oldest = true
+	default:
+		writeError(w, http.StatusBadRequest, "order must be asc or desc", nil)
+		return
+	}
+
+	if raw := q.Get("cursor"); raw != "" {
+		filter.Cursor, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || filter.Cursor <= 0 {
+			writeError(w, http.StatusBadRequest, "cursor must be a positive integer", nil)
+			return
+		}
+	}
+
+	limit, ok := parseLimit(w, r, defaultHistoryLimit)
+	if !ok {
+		return
+	}
+	if limit == 0 || limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	var fields []string
+	if raw := q.Get("fields"); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			if !historyFields[name] {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown field %q", name), nil)
+				return
+			}
+			fields = append(fields, name)
+		}
+	}
+
+	// Fetch one extra report to learn whether another page exists
+	filter.Limit = limit + 1
+	reports, err := a.store.ListReports(r.Context(), filter)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to load history", "device", filter.Hostname, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to load history", nil)
+		return
+	}
+
+	page := History{Hostname: filter.Hostname, Reports: []json.RawMessage{}}
+	if !filter.Since.IsZero() {
+		page.Since = &filter.Since
+	}
+	if !filter.Until.IsZero() {
+		page.Until = &filter.Until
+	}
+	if len(reports) > limit {
+		reports = reports[:limit]
+		page.NextCursor = reports[limit-1].ID
+	}
+	for i := range reports {
+		data, err := selectFields(&reports[i], fields)
+		if err != nil {
+			a.log.ErrorContext(r.Context(), "failed to encode report", "report_id", reports[i].ID, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to load history", nil)
+			return
+		}
+		page.Reports = append(page.Reports, data)
+	}
+	page.Count = len(page.Reports)
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseTime reads an RFC 3339 time or a lookback from now ("90m", "24h", "7d")
+func parseTime(raw string, now time.Time) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid lookback %q", raw)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("want an RFC 3339 time or a lookback like 24h or 7d, got %q", raw)
+	}
+	return now.Add(-d), nil
+}
+
+// selectFields encodes a report keeping only the named fields, plus id and
+// timestamp so points can still be plotted and paged
+func selectFields(r *store.StoredReport, fields []string) (json.RawMessage, error) {
+	data, err := json.Marshal(r)
+	if err != nil || len(fields) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	picked := map[string]json.RawMessage{"id": all["id"], "timestamp": all["timestamp"]}
+	for _, name := range fields {
+		if v, ok := all[name]; ok {
+			picked[name] = v
+		}
+	}
+	return json.Marshal(picked)
+}
+
+// jsonFieldNames lists the JSON names of a struct's fields, including those
+// promoted from embedded structs
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for name := range jsonFieldNames(f.Type) {
+				names[name] = true
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"device-posture-collector/metrics"
+)
+
+// statusRecorder remembers the response code a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// countReports counts every POST /report by the result it was answered with
+func (a *API) countReports(next http.HandlerFunc) http.HandlerFunc {
+	if a.opts.Metrics == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next(rec, r)
+		a.opts.Metrics.ObserveReport(metrics.ResultForStatus(rec.code))
+	}
+}
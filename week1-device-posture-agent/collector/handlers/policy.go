@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/nisatyap/shared/audit"
+
+	"device-posture-collector/policy"
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+// maxPolicyBytes caps a policy document
+const maxPolicyBytes = 256 << 10
+
+// policyCache keeps each tenant's compiled policy so reports don't re-parse
+// it; an entry is replaced when the stored version moves on
+type policyCache struct {
+	mu       sync.Mutex
+	compiled map[string]cachedPolicy
+}
+
+type cachedPolicy struct {
+	version int
+	policy  *policy.Policy
+}
+
+// get returns the compiled form of p
+func (c *policyCache) get(p store.Policy) (*policy.Policy, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.compiled[p.Tenant]; ok && cached.version == p.Version {
+		return cached.policy, nil
+	}
+	compiled, err := policy.Parse(p.Document)
+	if err != nil {
+		return nil, err
+	}
+	if c.compiled == nil {
+		c.compiled = make(map[string]cachedPolicy)
+	}
+	c.compiled[p.Tenant] = cachedPolicy{p.Version, compiled}
+	return compiled, nil
+}
+
+// evaluate scores a report against its tenant's policy. It returns nil when
+// the tenant has no policy or the policy can't be loaded; the report is
+// stored either way.
+func (a *API) evaluate(ctx context.Context, status *report.DeviceStatus) *policy.Verdict {
+	stored, err := a.store.GetPolicy(ctx)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			a.log.ErrorContext(ctx, "failed to load policy", "device", status.Hostname, "error", err)
+		}
+		return nil
+	}
+	compiled, err := a.policies.get(stored)
+	if err != nil {
+		a.log.ErrorContext(ctx, "stored policy is invalid", "version", stored.Version, "tenant", stored.Tenant, "error", err)
+		return nil
+	}
+	verdict := compiled.Evaluate(status)
+	verdict.PolicyVersion = stored.Version
+	return &verdict
+}
+
+// GetPolicy returns the tenant's posture policy
+func (a *API) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	p, err := a.store.GetPolicy(r.Context())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no policy set; reports are judged by their agents alone", nil)
+		return
+	}
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to load policy", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to load policy", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// SetPolicy replaces the tenant's posture policy. Reports received from then
+// on are also evaluated by the collector:
+//
+//	PUT /policy {"checks": [{"name": "disk_usage", "warn": 80, "critical": 90}],
+//	             "rules": [{"name": "firewall", "fail_if": "!firewall.enabled"}]}
+func (a *API) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicyBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read policy: "+err.Error(), nil)
+		return
+	}
+	if _, err := policy.Parse(body); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "invalid policy", []report.FieldError{{Field: "policy", Message: err.Error()}})
+		return
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed JSON: "+err.Error(), nil)
+		return
+	}
+
+	p, err := a.store.SetPolicy(r.Context(), compact.Bytes(), a.now().UTC())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to save policy", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy", nil)
+		return
+	}
+	a.log.InfoContext(r.Context(), "policy updated", "tenant", p.Tenant, "version", p.Version)
+	a.audit(r, audit.Event{Tenant: p.Tenant, Action: "policy.set", Object: "policy", Version: int64(p.Version)})
+	writeJSON(w, http.StatusOK, p)
+}
+
+// DeletePolicy removes the tenant's posture policy; agents' verdicts stand
+// alone again
+func (a *API) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	err := a.store.DeletePolicy(r.Context())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no policy set", nil)
+		return
+	}
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to delete policy", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete policy", nil)
+		return
+	}
+	a.log.InfoContext(r.Context(), "policy removed", "tenant", store.TenantOf(r.Context()))
+	a.audit(r, audit.Event{Tenant: store.TenantOf(r.Context()), Action: "policy.delete", Object: "policy"})
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
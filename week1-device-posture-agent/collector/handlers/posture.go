@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/posturetoken"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+// DefaultPostureMaxAge is how long a gateway may cache a posture verdict
+const DefaultPostureMaxAge = 10 * time.Second
+
+// DefaultPostureTokenTTL is how long a posture token is valid. Agents
+// fetch a new one with every report, so a device that stops reporting or
+// turns unhealthy loses its access within about this long.
+const DefaultPostureTokenTTL = 5 * time.Minute
+
+// Verdict sources
+const (
+	SourcePolicy = "policy" // the collector's evaluation under the tenant policy
+	SourceAgent  = "agent"  // the status the agent reported
+)
+
+// PostureVerdict is the access decision input a gateway needs for one device
+type PostureVerdict struct {
+	DeviceID  string    `json:"device_id"`
+	Tenant    string    `json:"tenant"`
+	IP        string    `json:"ip"`
+	Compliant bool      `json:"compliant"`
+	Status    string    `json:"status"` // STALE when the device stopped reporting
+	Source    string    `json:"source"` // policy or agent
+	Score     int       `json:"score"`
+	Reason    string    `json:"reason,omitempty"` // why the device is not compliant
+	LastSeen  time.Time `json:"last_seen"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Posture answers a gateway's access check on the request path:
+//
+//	GET /posture?ip=10.0.0.5
+//	GET /posture?device_id=laptop-1&ip=10.0.0.5
+//
+// device_id is the hostname the device enrolled with. Given both, the device
+// must have last reported from ip. Only HEALTHY, still-reporting devices are
+// compliant; the collector's policy verdict wins over the agent's when a
+// policy is set. Verdicts may be cached for PostureMaxAge.
+func (a *API) Posture(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	deviceID, ip := q.Get("device_id"), q.Get("ip")
+	if deviceID == "" && ip == "" {
+		writeError(w, http.StatusBadRequest, "ip or device_id is required", nil)
+		return
+	}
+	if ip != "" && net.ParseIP(ip) == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("ip %q is not a valid IP address", ip), nil)
+		return
+	}
+
+	var device store.Device
+	var err error
+	if deviceID != "" {
+		device, err = a.store.GetDevice(r.Context(), deviceID)
+	} else {
+		device, err = a.store.GetDeviceByIP(r.Context(), ip)
+	}
+	if err != nil {
+		// An unknown device may enroll at any moment; don't let the miss stick
+		w.Header().Set("Cache-Control", "no-store")
+		a.deviceError(w, err)
+		return
+	}
+
+	verdict := a.postureVerdict(device, ip)
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(a.opts.PostureMaxAge/time.Second)))
+	w.Header().Set("Vary", "Authorization")
+	writeJSON(w, http.StatusOK, verdict)
+}
+
+// postureVerdict decides whether device is compliant. ip, if set, is the
+// address the gateway saw the request come from.
+func (a *API) postureVerdict(device store.Device, ip string) PostureVerdict {
+	now := a.now().UTC()
+	v := PostureVerdict{
+		DeviceID:  device.Hostname,
+		Tenant:    device.Tenant,
+		IP:        device.IP,
+		Status:    device.Status,
+		Source:    SourceAgent,
+		Score:     device.Score,
+		LastSeen:  device.LastSeen,
+		CheckedAt: now,
+	}
+	if device.ServerStatus != "" {
+		v.Status, v.Source = device.ServerStatus, SourcePolicy
+		if device.ServerScore != nil {
+			v.Score = *device.ServerScore
+		}
+	}
+
+	switch {
+	case device.Status == store.StatusEnrolled:
+		v.Reason = "device has enrolled but not reported yet"
+	case a.isStale(device):
+		v.Status = alert.StatusStale
+		v.Reason = fmt.Sprintf("no report for %s", now.Sub(device.LastSeen).Truncate(time.Second))
+	case ip != "" && ip != device.IP:
+		v.Reason = "device last reported from " + device.IP
+	case v.Status != report.StatusHealthy:
+		v.Reason = fmt.Sprintf("%s verdict is %s", v.Source, v.Status)
+		if v.Source == SourceAgent && len(device.FailingChecks) > 0 {
+			v.Reason += " (failing: " + strings.Join(device.FailingChecks, ", ") + ")"
+		}
+	default:
+		v.Compliant = true
+	}
+	return v
+}
+
+// PostureTokenResponse answers POST /posture/token
+type PostureTokenResponse struct {
+	Token     string         `json:"token"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	Verdict   PostureVerdict `json:"verdict"`
+}
+
+// PostureToken issues the calling device a signed token carrying its
+// current verdict, for it to present to the gateway in the
+// X-Posture-Token header. A token is issued whether or not the device is
+// compliant; the gateway decides what a non-compliant device may reach.
+// With authentication disabled, ?device_id= names the device.
+func (a *API) PostureToken(w http.ResponseWriter, r *http.Request) {
+	hostname, ok := authenticatedDevice(r.Context())
+	if !ok {
+		hostname = r.URL.Query().Get("device_id")
+	}
+	if hostname == "" {
+		writeError(w, http.StatusBadRequest, "device_id is required with authentication disabled", nil)
+		return
+	}
+	device, err := a.store.GetDevice(r.Context(), hostname)
+	if a.deviceError(w, err) {
+		return
+	}
+
+	verdict := a.postureVerdict(device, "")
+	token, err := a.opts.PostureTokens.Issue(posturetoken.Claims{
+		DeviceID:  verdict.DeviceID,
+		Tenant:    verdict.Tenant,
+		Compliant: verdict.Compliant,
+		Status:    verdict.Status,
+		Score:     verdict.Score,
+		IssuedAt:  verdict.CheckedAt,
+	}, a.opts.PostureTokenTTL)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to issue posture token", "device", hostname, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to issue posture token", nil)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, PostureTokenResponse{
+		Token:     token,
+		ExpiresAt: verdict.CheckedAt.Add(a.opts.PostureTokenTTL).Truncate(time.Second),
+		Verdict:   verdict,
+	})
+}
+
+// PostureTokenKey is a public key gateways verify posture tokens with
+type PostureTokenKey struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"` // PEM
+}
+
+// PostureKeys publishes the key posture tokens are signed with, for
+// gateways to save to their -posture-keys file
+func (a *API) PostureKeys(w http.ResponseWriter, r *http.Request) {
+	issuer := a.opts.PostureTokens
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []PostureTokenKey{
+		{ID: issuer.ID(), Algorithm: "Ed25519", PublicKey: string(issuer.PublicKeyPEM())},
+	}})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nisatyap/shared/ratelimit"
+
+	"device-posture-collector/store"
+)
+
+// RateLimit bounds how fast reports are accepted. Zero rates disable the
+// corresponding limit.
+type RateLimit struct {
+	// PerDevice is the sustained reports per minute from one device (its
+	// API key's hostname, or the client IP without authentication)
+	PerDevice float64
+	// DeviceBurst is how many reports a device may send back to back
+	DeviceBurst int
+	// Global is the sustained reports per second across all devices
+	Global float64
+	// GlobalBurst absorbs a fleet reporting at the same moment
+	GlobalBurst int
+	// Store keeps the counts, such as in Redis to share them between
+	// collector replicas; nil keeps them in memory
+	Store ratelimit.Store
+}
+
+// DefaultRateLimit leaves room for agents reporting every 10s plus retries
+var DefaultRateLimit = RateLimit{PerDevice: 12, DeviceBurst: 20, Global: 500, GlobalBurst: 1000}
+
+// rateLimiter limits each device, then the fleet as a whole
+type rateLimiter struct {
+	devices *ratelimit.Limiter
+	global  *ratelimit.Limiter
+}
+
+func newRateLimiter(limits RateLimit) *rateLimiter {
+	return &rateLimiter{
+		devices: ratelimit.New("collector-device", ratelimit.PerMinute(limits.PerDevice, limits.DeviceBurst), limits.Store),
+		global:  ratelimit.New("collector-global", ratelimit.PerSecond(limits.Global, limits.GlobalBurst), limits.Store),
+	}
+}
+
+// limitReports answers 429 with Retry-After when a device or the whole
+// fleet reports faster than the configured rates
+func (a *API) limitReports(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := ratelimit.ClientIP(r)
+		if device, ok := authenticatedDevice(r.Context()); ok {
+			key = store.TenantOf(r.Context()) + "/" + device
+		}
+		// The device is charged first so one noisy device can't drain the
+		// global budget once it is over its own limit
+		now := a.now()
+		result, err := a.limiter.devices.AllowAt(r.Context(), key, now)
+		if err == nil && result.Allowed {
+			result, err = a.limiter.global.AllowAt(r.Context(), "", now)
+		}
+		if err != nil {
+			a.log.WarnContext(r.Context(), "rate limit unavailable, accepting report", "key", key, "error", err)
+		}
+		if !result.Allowed {
+			if result.First {
+				a.log.WarnContext(r.Context(), "rate limiting reports", "key", key, "retry_after", result.RetryAfter.Round(time.Millisecond))
+			}
+			ratelimit.SetRetryAfter(w, result)
+			writeError(w, http.StatusTooManyRequests, "too many reports, slow down", nil)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"device-posture-collector/store"
+)
+
+// DeviceRollups returns a device's hourly summaries, which outlive the raw
+// reports:
+//
+//	GET /devices/{hostname}/rollups?since=90d&until=
+func (a *API) DeviceRollups(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := a.now().UTC()
+	since, err := parseTime(q.Get("since"), now)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "since: "+err.Error(), nil)
+		return
+	}
+	until, err := parseTime(q.Get("until"), now)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "until: "+err.Error(), nil)
+		return
+	}
+
+	hostname := r.PathValue("hostname")
+	rollups, err := a.store.ListRollups(r.Context(), hostname, since, until)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to load rollups", "device", hostname, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to load rollups", nil)
+		return
+	}
+	if rollups == nil {
+		rollups = []store.Rollup{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"hostname": hostname,
+		"interval": store.RollupInterval.String(),
+		"count":    len(rollups),
+		"rollups":  rollups,
+	})
+}
+
+// Retention reports the retention policy and what the pruning job has
+// deleted since startup
+func (a *API) Retention(w http.ResponseWriter, r *http.Request) {
+	if a.opts.Retention == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"enabled": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"enabled": true, "stats": a.opts.Retention.Stats()})
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/eventbus"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/store"
+)
+
+// Stream event types
+const (
+	EventReport     = "report"     // a report was accepted
+	EventTransition = "transition" // a device's status changed, including to and from STALE
+	EventAlert      = "alert"      // an alert was raised
+)
+
+// Stream limits
+const (
+	maxSubscribers    = 100
+	subscriberBuffer  = 64 // events queued for a slow client before dropping
+	streamHeartbeat   = 15 * time.Second
+	streamRetryMillis = 3000
+)
+
+// ReportEvent is the data of a report event
+type ReportEvent struct {
+	ID            int64     `json:"id"`
+	Tenant        string    `json:"tenant"`
+	Hostname      string    `json:"hostname"`
+	IP            string    `json:"ip"`
+	Status        string    `json:"status"`
+	Score         int       `json:"score"`
+	FailingChecks []string  `json:"failing_checks,omitempty"`
+	DiskUsage     float64   `json:"disk_usage"`
+	CPUUsage      float64   `json:"cpu_usage"`
+	MemoryUsage   float64   `json:"memory_usage"`
+	Timestamp     time.Time `json:"timestamp"`
+	ReceivedAt    time.Time `json:"received_at"`
+}
+
+// TransitionEvent is the data of a transition event. From is empty for a
+// device's first report.
+type TransitionEvent struct {
+	Tenant   string    `json:"tenant"`
+	Hostname string    `json:"hostname"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Time     time.Time `json:"time"`
+}
+
+type streamEvent struct {
+	id       uint64
+	kind     string
+	tenant   string
+	hostname string
+	data     []byte
+}
+
+type subscriber struct {
+	events   chan streamEvent
+	tenant   string          // "" for every tenant
+	hostname string          // "" for every device
+	kinds    map[string]bool // nil for every type
+}
+
+func (s *subscriber) wants(e streamEvent) bool {
+	return (s.tenant == "" || s.tenant == e.tenant) &&
+		(s.hostname == "" || s.hostname == e.hostname) &&
+		(s.kinds == nil || s.kinds[e.kind])
+}
+
+// Broker fans live events out to GET /stream clients, and posture changes
+// and tamper alerts out to the event bus, if it has one. It is also an
+// alert.Notifier, so alerts raised elsewhere (e.g. stale devices) reach the
+// stream too.
+type Broker struct {
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[*subscriber]bool
+	bus    eventbus.Bus // nil publishes nothing to the bus
+	log    *slog.Logger
+}
+
+// NewBroker creates a broker with no subscribers
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*subscriber]bool), log: slog.Default()}
+}
+
+// publish sends an event to every interested subscriber without blocking;
+// a client too slow to keep up misses events
+func (b *Broker) publish(kind, tenant, hostname string, data any) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		b.log.Error("failed to encode stream event", "kind", kind, "error", err)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	e := streamEvent{id: b.nextID, kind: kind, tenant: tenant, hostname: hostname, data: encoded}
+	for s := range b.subs {
+		if !s.wants(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+		}
+	}
+}
+
+// Notify publishes an alert, and a transition for devices going stale
+func (b *Broker) Notify(ctx context.Context, e alert.Event) error {
+	b.publish(EventAlert, e.Tenant, e.Device, e)
+	switch e.Kind {
+	case alert.KindStale:
+		b.transition(TransitionEvent{
+			Tenant: e.Tenant, Hostname: e.Device, From: e.LastStatus, To: alert.StatusStale, Time: e.Time,
+		})
+	case alert.KindTamper:
+		kinds := make([]string, 0, len(e.Tamper))
+		for _, t := range e.Tamper {
+			kinds = append(kinds, t.Kind)
+		}
+		b.toBus(eventbus.SubjectPostureTamper, eventbus.TamperAlert{
+			DeviceID: e.Device, Tenant: e.Tenant, Kinds: kinds, Summary: e.Summary(), Time: e.Time,
+		})
+	}
+	return nil
+}
+
+// transition publishes a status change to the stream and the bus
+func (b *Broker) transition(t TransitionEvent) {
+	b.publish(EventTransition, t.Tenant, t.Hostname, t)
+	b.toBus(eventbus.SubjectPostureChanged, eventbus.PostureChange{
+		DeviceID: t.Hostname, Tenant: t.Tenant, From: t.From, To: t.To, Time: t.Time,
+	})
+}
+
+// toBus publishes data on the event bus, if there is one
+func (b *Broker) toBus(subject string, data any) {
+	if b.bus == nil {
+		return
+	}
+	if err := b.bus.Publish(context.Background(), subject, data); err != nil {
+		b.log.Error("failed to publish event", "subject", subject, "error", err)
+	}
+}
+
+// publishReport emits the report and, if the status changed, a transition
+func (b *Broker) publishReport(previous store.Device, previousStale bool, stored *store.StoredReport) {
+	b.publish(EventReport, stored.Tenant, stored.Hostname, ReportEvent{
+		ID:            stored.ID,
+		Tenant:        stored.Tenant,
+		Hostname:      stored.Hostname,
+		IP:            stored.IP,
+		Status:        stored.Status,
+		Score:         stored.Score,
+		FailingChecks: stored.FailingChecks,
+		DiskUsage:     stored.DiskUsage,
+		CPUUsage:      stored.CPUUsage,
+		MemoryUsage:   stored.MemoryUsage,
+		Timestamp:     stored.Timestamp,
+		ReceivedAt:    stored.ReceivedAt,
+	})
+	from := previous.Status
+	if previousStale {
+		from = alert.StatusStale
+	}
+	if from != stored.Status {
+		b.transition(TransitionEvent{
+			Tenant: stored.Tenant, Hostname: stored.Hostname, From: from, To: stored.Status, Time: stored.ReceivedAt,
+		})
+	}
+}
+
+func (b *Broker) subscribe(s *subscriber) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.subs) >= maxSubscribers {
+		return false
+	}
+	b.subs[s] = true
+	return true
+}
+
+func (b *Broker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, s)
+}
+
+// Broker returns the API's live event broker
+func (a *API) Broker() *Broker { return a.stream }
+
+// StreamEvents pushes live fleet activity as Server-Sent Events:
+//
+//	GET /stream?hostname=laptop-1&types=report,transition
+//
+// Each event has an id, a type (report, transition or alert) and JSON data.
+// A multi-tenant collector only streams the caller's tenant.
+// Events are not replayed; clients reconnect and re-read state as needed.
+func (a *API) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	sub := &subscriber{events: make(chan streamEvent, subscriberBuffer), hostname: r.URL.Query().Get("hostname")}
+	sub.tenant, _ = store.TenantScope(r.Context())
+	if raw := r.URL.Query().Get("types"); raw != "" {
+		sub.kinds = make(map[string]bool)
+		for _, kind := range strings.Split(raw, ",") {
+			kind = strings.TrimSpace(kind)
+			if kind != EventReport && kind != EventTransition && kind != EventAlert {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown event type %q (want report, transition or alert)", kind), nil)
+				return
+			}
+			sub.kinds[kind] = true
+		}
+	}
+	if !a.stream.subscribe(sub) {
+		writeError(w, http.StatusServiceUnavailable, "too many stream clients", nil)
+		return
+	}
+	defer a.stream.unsubscribe(sub)
+
+	// The server's write timeout would cut the stream off
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // stop nginx buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-sub.events:
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.kind, e.data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
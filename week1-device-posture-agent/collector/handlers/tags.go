@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+// Tag limits
+const (
+	maxTags        = 32
+	maxTagValueLen = 256
+)
+
+var tagKey = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// SetTags replaces a device's tags:
+//
+//	PUT /devices/{hostname}/tags {"ou": "engineering", "site": "ams", "owner": "alice"}
+func (a *API) SetTags(w http.ResponseWriter, r *http.Request) {
+	var tags map[string]string
+	if !decodeTags(w, r, &tags) {
+		return
+	}
+	a.saveTags(w, r, tags)
+}
+
+// PatchTags merges tags into a device's existing tags; a null value removes
+// the tag:
+//
+//	PATCH /devices/{hostname}/tags {"site": "lon", "owner": null}
+func (a *API) PatchTags(w http.ResponseWriter, r *http.Request) {
+	var patch map[string]*string
+	if !decodeTags(w, r, &patch) {
+		return
+	}
+	device, err := a.store.GetDevice(r.Context(), r.PathValue("hostname"))
+	if a.deviceError(w, err) {
+		return
+	}
+	tags := make(map[string]string)
+	for k, v := range device.Tags {
+		tags[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(tags, k)
+		} else {
+			tags[k] = *v
+		}
+	}
+	a.saveTags(w, r, tags)
+}
+
+func (a *API) saveTags(w http.ResponseWriter, r *http.Request, tags map[string]string) {
+	if errs := validateTags(tags); len(errs) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, "invalid tags", errs)
+		return
+	}
+	device, err := a.store.SetTags(r.Context(), r.PathValue("hostname"), tags)
+	if a.deviceError(w, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "device tags updated", "device", device.Hostname, "tags", device.Tags)
+	device.Stale = a.isStale(device)
+	writeJSON(w, http.StatusOK, device)
+}
+
+func decodeTags(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "body must be a JSON object of tag names to values: "+err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// deviceError writes the response for a failed device lookup, returning
+// true if there was one
+func (a *API) deviceError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "device not found", nil)
+	default:
+		a.log.Error("failed to load device", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to load device", nil)
+	}
+	return true
+}
+
+func validateTags(tags map[string]string) []report.FieldError {
+	var errs []report.FieldError
+	if len(tags) > maxTags {
+		errs = append(errs, report.FieldError{Field: "tags", Message: fmt.Sprintf("at most %d tags allowed", maxTags)})
+	}
+	for k, v := range tags {
+		switch {
+		case !tagKey.MatchString(k):
+			errs = append(errs, report.FieldError{Field: k, Message: "tag names are lowercase letters, digits, '_', '.' or '-' (max 63)"})
+		case len(v) > maxTagValueLen:
+			errs = append(errs, report.FieldError{Field: k, Message: fmt.Sprintf("value longer than %d characters", maxTagValueLen)})
+		}
+	}
+	return errs
+}
+
+// parseTagSelector reads repeated ?tag=key:value parameters, all of which a
+// device must match
+func parseTagSelector(w http.ResponseWriter, r *http.Request) (map[string]string, bool) {
+	raw := r.URL.Query()["tag"]
+	if len(raw) == 0 {
+		return nil, true
+	}
+	selector := make(map[string]string, len(raw))
+	for _, pair := range raw {
+		k, v, ok := strings.Cut(pair, ":")
+		if !ok || k == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("tag filter %q must be key:value", pair), nil)
+			return nil, false
+		}
+		selector[k] = v
+	}
+	return selector, true
+}
+
+// filterTags keeps the devices matching selector
+func filterTags(devices []store.Device, selector map[string]string) []store.Device {
+	if len(selector) == 0 {
+		return devices
+	}
+	out := devices[:0]
+	for _, d := range devices {
+		if store.MatchTags(d.Tags, selector) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
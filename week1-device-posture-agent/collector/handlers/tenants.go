@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/nisatyap/shared/audit"
+
+	"device-posture-collector/auth"
+	"device-posture-collector/store"
+)
+
+// tenantIDPattern keeps tenant IDs safe in URLs, logs and query strings
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// CreateTenant adds a tenant and issues its admin key, returned only once:
+//
+//	POST /tenants {"id": "acme", "name": "Acme Corp"}
+func (a *API) CreateTenant(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed JSON: "+err.Error(), nil)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !tenantIDPattern.MatchString(req.ID) {
+		writeError(w, http.StatusBadRequest, "id must be 1-63 lowercase letters, digits or dashes", nil)
+		return
+	}
+	if req.Name == "" {
+		req.Name = req.ID
+	}
+
+	secret, err := auth.NewSecret(auth.PrefixTenantAdminKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate admin key", nil)
+		return
+	}
+	tenant := store.Tenant{ID: req.ID, Name: req.Name, AdminKeyHash: secret.Hash, CreatedAt: a.now().UTC()}
+	err = a.store.CreateTenant(r.Context(), tenant)
+	if errors.Is(err, store.ErrExists) {
+		writeError(w, http.StatusConflict, "tenant "+req.ID+" already exists", nil)
+		return
+	}
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to create tenant", "tenant", req.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to create tenant", nil)
+		return
+	}
+	a.log.InfoContext(r.Context(), "tenant created", "tenant", tenant.ID, "admin_key", secret.ID)
+	a.audit(r, audit.Event{Tenant: tenant.ID, Action: "tenant.create", Object: "tenant " + tenant.ID, Detail: "admin key " + secret.ID})
+	writeJSON(w, http.StatusCreated, map[string]any{"tenant": tenant, "admin_key": secret.Value})
+}
+
+func (a *API) ListTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := a.store.ListTenants(r.Context())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to list tenants", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list tenants", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total": len(tenants), "tenants": tenants})
+}
+
+// RotateTenantAdminKey replaces a tenant's admin key; the old one stops
+// working at once
+func (a *API) RotateTenantAdminKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	secret, err := auth.NewSecret(auth.PrefixTenantAdminKey)
+	if err == nil {
+		err = a.store.SetTenantAdminKey(r.Context(), id, secret.Hash)
+	}
+	if err != nil {
+		a.tenantError(w, id, err)
+		return
+	}
+	a.log.InfoContext(r.Context(), "tenant admin key rotated", "tenant", id, "admin_key", secret.ID)
+	a.audit(r, audit.Event{Tenant: id, Action: "tenant.rotate_admin_key", Object: "tenant " + id, Detail: "admin key " + secret.ID})
+	writeJSON(w, http.StatusOK, map[string]any{"tenant": id, "admin_key": secret.Value})
+}
+
+func (a *API) tenantError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "unknown tenant "+id, nil)
+		return
+	}
+	a.log.Error("failed to load tenant", "tenant", id, "error", err)
+	writeError(w, http.StatusInternalServerError, "failed to load tenant", nil)
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"device-posture-collector/app"
+)
+
+func main() {
+	os.Exit(app.Main("collector", os.Args[1:]))
+}
@@ -0,0 +1,327 @@
+// Package metrics exposes the collector's own metrics in the Prometheus
+// text exposition format.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/promtext"
+
+	"device-posture-collector/alert"
+	"device-posture-collector/report"
+	"device-posture-collector/retention"
+	"device-posture-collector/store"
+)
+
+// Report ingestion results
+const (
+	ResultAccepted     = "accepted"
+	ResultInvalid      = "invalid"   // failed validation (422)
+	ResultMalformed    = "malformed" // not a readable report (400)
+	ResultTooLarge     = "too_large"
+	ResultRateLimited  = "rate_limited"
+	ResultUnauthorized = "unauthorized"
+	ResultForbidden    = "forbidden"
+	ResultConflict     = "conflict" // a delta report without a previous report (409)
+	ResultError        = "error"    // storage failure
+)
+
+// latencyBuckets are the storage latency histogram bounds in seconds
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// fieldIndex collapses list indexes so validation labels stay bounded
+var fieldIndex = regexp.MustCompile(`\[\d+\]`)
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+type alertKey struct {
+	channel, kind, outcome string
+}
+
+type mismatchKey struct {
+	agent, server string
+}
+
+// Registry accumulates counters and reads device and retention state at
+// scrape time. A nil *Registry ignores observations.
+type Registry struct {
+	store      store.Store
+	staleAfter time.Duration
+	retention  *retention.Job // nil when retention is disabled
+	log        *slog.Logger
+
+	mu            sync.Mutex
+	start         time.Time
+	reports       map[string]uint64
+	invalid       map[string]uint64
+	storage       map[string]*histogram
+	storageErrors map[string]uint64
+	alerts        map[alertKey]uint64
+	mismatches    map[mismatchKey]uint64
+	deduplicated  map[string]uint64
+}
+
+// New creates a registry reporting device counts from s, logging the
+// counts it fails to read to logger
+func New(s store.Store, staleAfter time.Duration, job *retention.Job, logger *slog.Logger) *Registry {
+	return &Registry{
+		store:         s,
+		staleAfter:    staleAfter,
+		retention:     job,
+		log:           logger,
+		start:         time.Now(),
+		reports:       make(map[string]uint64),
+		invalid:       make(map[string]uint64),
+		storage:       make(map[string]*histogram),
+		storageErrors: make(map[string]uint64),
+		alerts:        make(map[alertKey]uint64),
+		mismatches:    make(map[mismatchKey]uint64),
+		deduplicated:  make(map[string]uint64),
+	}
+}
+
+// ResultForStatus maps a POST /report response code, or a batch item's
+// code, to its result
+func ResultForStatus(code int) string {
+	switch code {
+	case http.StatusOK:
+		return ResultAccepted
+	case http.StatusUnprocessableEntity:
+		return ResultInvalid
+	case http.StatusRequestEntityTooLarge:
+		return ResultTooLarge
+	case http.StatusTooManyRequests:
+		return ResultRateLimited
+	case http.StatusUnauthorized:
+		return ResultUnauthorized
+	case http.StatusForbidden:
+		return ResultForbidden
+	case http.StatusConflict:
+		return ResultConflict
+	case http.StatusBadRequest:
+		return ResultMalformed
+	default:
+		return ResultError
+	}
+}
+
+// ObserveReport counts one POST /report by result
+func (r *Registry) ObserveReport(result string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports[result]++
+}
+
+// ObserveValidation counts each field a rejected report failed on
+func (r *Registry) ObserveValidation(fields []report.FieldError) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range fields {
+		r.invalid[fieldIndex.ReplaceAllString(f.Field, "[]")]++
+	}
+}
+
+// ObserveStorage records how long a storage operation took
+func (r *Registry) ObserveStorage(op string, d time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.storage[op]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		r.storage[op] = h
+	}
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+	if err != nil {
+		r.storageErrors[op]++
+	}
+}
+
+// ObserveAlert is an alert.DeliveryObserver
+func (r *Registry) ObserveAlert(channel, kind, outcome string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts[alertKey{channel, kind, outcome}]++
+}
+
+// ObservePolicyMismatch counts a report whose agent status disagrees with
+// the collector's policy verdict
+func (r *Registry) ObservePolicyMismatch(agentStatus, serverStatus string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mismatches[mismatchKey{agentStatus, serverStatus}]++
+}
+
+// ObserveDedup counts an accepted report that wasn't stored as a new row,
+// by how it was deduplicated (store.DedupReplay or store.DedupRepeat)
+func (r *Registry) ObserveDedup(kind string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deduplicated[kind]++
+}
+
+// ServeHTTP writes all metrics in Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var b strings.Builder
+	r.renderCounters(&b)
+	if err := r.renderDevices(req.Context(), &b); err != nil {
+		r.log.ErrorContext(req.Context(), "failed to count devices for metrics", "error", err)
+	}
+	r.renderRetention(&b)
+
+	w.Header().Set("Content-Type", promtext.ContentType)
+	fmt.Fprint(w, b.String())
+}
+
+func (r *Registry) renderCounters(b *strings.Builder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	promtext.Metric(b, "posture_collector_start_time_seconds", "gauge",
+		"Unix time the collector process started.", nil, float64(r.start.Unix()))
+
+	promtext.Header(b, "posture_collector_reports_total", "counter", "Reports received on POST /report and in POST /reports batches by result.")
+	for _, result := range sortedKeys(r.reports) {
+		promtext.Sample(b, "posture_collector_reports_total", map[string]string{"result": result}, float64(r.reports[result]))
+	}
+
+	promtext.Header(b, "posture_collector_reports_deduplicated_total", "counter", "Accepted reports not stored as new rows: idempotent replays and repeats of the previous report.")
+	for _, kind := range sortedKeys(r.deduplicated) {
+		promtext.Sample(b, "posture_collector_reports_deduplicated_total", map[string]string{"kind": kind}, float64(r.deduplicated[kind]))
+	}
+
+	promtext.Header(b, "posture_collector_validation_failures_total", "counter", "Report validation failures by field.")
+	for _, field := range sortedKeys(r.invalid) {
+		promtext.Sample(b, "posture_collector_validation_failures_total", map[string]string{"field": field}, float64(r.invalid[field]))
+	}
+
+	const latency = "posture_collector_storage_duration_seconds"
+	promtext.Header(b, latency, "histogram", "Storage operation latency.")
+	for _, op := range sortedKeys(r.storage) {
+		h := r.storage[op]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			promtext.Sample(b, latency+"_bucket", map[string]string{"operation": op, "le": strconv.FormatFloat(bound, 'f', -1, 64)}, float64(cumulative))
+		}
+		promtext.Sample(b, latency+"_bucket", map[string]string{"operation": op, "le": "+Inf"}, float64(h.count))
+		promtext.Sample(b, latency+"_sum", map[string]string{"operation": op}, h.sum)
+		promtext.Sample(b, latency+"_count", map[string]string{"operation": op}, float64(h.count))
+	}
+
+	promtext.Header(b, "posture_collector_storage_errors_total", "counter", "Storage operations that failed.")
+	for _, op := range sortedKeys(r.storageErrors) {
+		promtext.Sample(b, "posture_collector_storage_errors_total", map[string]string{"operation": op}, float64(r.storageErrors[op]))
+	}
+
+	promtext.Header(b, "posture_collector_alerts_total", "counter", "Alert deliveries by channel, kind and outcome.")
+	keys := make([]alertKey, 0, len(r.alerts))
+	for k := range r.alerts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	for _, k := range keys {
+		promtext.Sample(b, "posture_collector_alerts_total",
+			map[string]string{"channel": k.channel, "kind": k.kind, "outcome": k.outcome}, float64(r.alerts[k]))
+	}
+
+	const mismatches = "posture_collector_policy_mismatches_total"
+	promtext.Header(b, mismatches, "counter", "Reports whose agent status disagreed with the collector's policy verdict.")
+	pairs := make([]mismatchKey, 0, len(r.mismatches))
+	for k := range r.mismatches {
+		pairs = append(pairs, k)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return fmt.Sprint(pairs[i]) < fmt.Sprint(pairs[j])
+	})
+	for _, k := range pairs {
+		promtext.Sample(b, mismatches, map[string]string{"agent_status": k.agent, "server_status": k.server}, float64(r.mismatches[k]))
+	}
+}
+
+// renderDevices counts devices by their current status; stale devices are
+// counted as STALE
+func (r *Registry) renderDevices(ctx context.Context, b *strings.Builder) error {
+	devices, err := r.store.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{
+		report.StatusHealthy:   0,
+		report.StatusDegraded:  0,
+		report.StatusUnhealthy: 0,
+		alert.StatusStale:      0,
+	}
+	now := time.Now()
+	for _, d := range devices {
+		status := d.Status
+		if alert.IsStale(d.LastSeen, now, r.staleAfter) {
+			status = alert.StatusStale
+		}
+		counts[status]++
+	}
+	promtext.Header(b, "posture_collector_devices", "gauge", "Devices by current status.")
+	for _, status := range sortedKeys(counts) {
+		promtext.Sample(b, "posture_collector_devices", map[string]string{"status": status}, float64(counts[status]))
+	}
+	return nil
+}
+
+func (r *Registry) renderRetention(b *strings.Builder) {
+	if r.retention == nil {
+		return
+	}
+	stats := r.retention.Stats()
+	promtext.Metric(b, "posture_collector_retention_runs_total", "counter",
+		"Retention job runs.", nil, float64(stats.Runs))
+	promtext.Header(b, "posture_collector_retention_deleted_rows_total", "counter", "Rows deleted by the retention job.")
+	promtext.Sample(b, "posture_collector_retention_deleted_rows_total", map[string]string{"table": "reports"}, float64(stats.ReportsDeleted))
+	promtext.Sample(b, "posture_collector_retention_deleted_rows_total", map[string]string{"table": "rollups"}, float64(stats.RollupsDeleted))
+	promtext.Metric(b, "posture_collector_rollups_written_total", "counter",
+		"Hourly rollups written or refreshed by the retention job.", nil, float64(stats.RollupsWritten))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
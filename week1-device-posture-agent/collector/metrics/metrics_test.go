@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	mem := store.NewMemory(10)
+	m := New(mem, time.Hour, nil, slog.Default())
+	s := Instrument(mem, m)
+
+	s.SaveReport(ctx, &report.DeviceStatus{Hostname: "a", Status: "HEALTHY"}, nil, time.Now())
+	s.SaveReport(ctx, &report.DeviceStatus{Hostname: "b", Status: "UNHEALTHY"}, nil, time.Now().Add(-2*time.Hour))
+	s.GetDevice(ctx, "missing")
+	m.ObserveReport(ResultForStatus(http.StatusOK))
+	m.ObserveReport(ResultForStatus(http.StatusTooManyRequests))
+	m.ObserveValidation([]report.FieldError{{Field: "checks[3].name"}, {Field: "checks[0].name"}})
+	m.ObserveAlert("webhook:ops", "unhealthy", "delivered")
+	m.ObserveStorage("save_report", time.Millisecond, errors.New("disk full"))
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`posture_collector_reports_total{result="accepted"} 1`,
+		`posture_collector_reports_total{result="rate_limited"} 1`,
+		`posture_collector_validation_failures_total{field="checks[].name"} 2`,
+		`posture_collector_storage_duration_seconds_count{operation="save_report"} 3`,
+		`posture_collector_storage_duration_seconds_bucket{le="+Inf",operation="get_device"} 1`,
+		`posture_collector_storage_errors_total{operation="save_report"} 1`,
+		`posture_collector_devices{status="HEALTHY"} 1`,
+		`posture_collector_devices{status="STALE"} 1`,
+		`posture_collector_devices{status="UNHEALTHY"} 0`,
+		`posture_collector_alerts_total{channel="webhook:ops",kind="unhealthy",outcome="delivered"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+	if strings.Contains(body, `storage_errors_total{operation="get_device"}`) {
+		t.Error("ErrNotFound counted as a storage error")
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"device-posture-collector/policy"
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+// instrumented times the storage calls on the ingestion and query paths;
+// everything else passes straight through
+type instrumented struct {
+	store.Store
+	m *Registry
+}
+
+// Instrument wraps s so its latency is recorded in m
+func Instrument(s store.Store, m *Registry) store.Store {
+	return &instrumented{Store: s, m: m}
+}
+
+// observe is deferred with a pointer to the named error result so it sees
+// the value actually returned. A missing row is not a storage failure.
+func (s *instrumented) observe(op string, start time.Time, err *error) {
+	failed := *err
+	if errors.Is(failed, store.ErrNotFound) {
+		failed = nil
+	}
+	s.m.ObserveStorage(op, time.Since(start), failed)
+}
+
+func (s *instrumented) SaveReport(ctx context.Context, status *report.DeviceStatus, verdict *policy.Verdict, receivedAt time.Time) (stored store.StoredReport, err error) {
+	defer s.observe("save_report", time.Now(), &err)
+	return s.Store.SaveReport(ctx, status, verdict, receivedAt)
+}
+
+func (s *instrumented) SaveReports(ctx context.Context, reports []store.NewReport) (stored []store.StoredReport, err error) {
+	defer s.observe("save_reports", time.Now(), &err)
+	return s.Store.SaveReports(ctx, reports)
+}
+
+func (s *instrumented) GetPolicy(ctx context.Context) (p store.Policy, err error) {
+	defer s.observe("get_policy", time.Now(), &err)
+	return s.Store.GetPolicy(ctx)
+}
+
+func (s *instrumented) ListReports(ctx context.Context, filter store.Filter) (out []store.StoredReport, err error) {
+	defer s.observe("list_reports", time.Now(), &err)
+	return s.Store.ListReports(ctx, filter)
+}
+
+func (s *instrumented) ReportSeries(ctx context.Context, filter store.Filter, step time.Duration) (out []store.SeriesPoint, err error) {
+	defer s.observe("report_series", time.Now(), &err)
+	return s.Store.ReportSeries(ctx, filter, step)
+}
+
+func (s *instrumented) ListDevices(ctx context.Context) (out []store.Device, err error) {
+	defer s.observe("list_devices", time.Now(), &err)
+	return s.Store.ListDevices(ctx)
+}
+
+func (s *instrumented) GetDevice(ctx context.Context, hostname string) (d store.Device, err error) {
+	defer s.observe("get_device", time.Now(), &err)
+	return s.Store.GetDevice(ctx, hostname)
+}
+
+func (s *instrumented) GetDeviceByIP(ctx context.Context, ip string) (d store.Device, err error) {
+	defer s.observe("get_device_by_ip", time.Now(), &err)
+	return s.Store.GetDeviceByIP(ctx, ip)
+}
+
+func (s *instrumented) GetAPIKey(ctx context.Context, hash string) (k store.APIKey, err error) {
+	defer s.observe("get_api_key", time.Now(), &err)
+	return s.Store.GetAPIKey(ctx, hash)
+}
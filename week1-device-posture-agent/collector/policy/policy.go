@@ -0,0 +1,221 @@
+// Package policy evaluates reports against a centrally managed posture
+// policy, so thresholds and rules can change without reconfiguring agents.
+// Policies use the agent's -policy file format.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nisatyap/shared/posture"
+
+	"device-posture-collector/report"
+)
+
+// Check failure severities, as reported by the agent
+const (
+	SeverityWarning  = posture.SeverityWarning
+	SeverityCritical = posture.SeverityCritical
+)
+
+// Default score cut-offs, matching the agent's
+const (
+	DefaultHealthyScore   = posture.DefaultHealthyScore
+	DefaultUnhealthyScore = posture.DefaultUnhealthyScore
+)
+
+// Policy describes the thresholds a device must satisfy
+//
+//	{
+//	  "healthy_score": 80,
+//	  "unhealthy_score": 50,
+//	  "checks": [{"name": "disk_usage", "weight": 50, "warn": 80, "critical": 90}],
+//	  "rules": [{"name": "firewall", "fail_if": "!firewall.enabled", "weight": 40}]
+//	}
+type Policy struct {
+	HealthyScore   float64 `json:"healthy_score,omitempty"`
+	UnhealthyScore float64 `json:"unhealthy_score,omitempty"`
+	Checks         []Check `json:"checks"`
+	Rules          []Rule  `json:"rules,omitempty"`
+}
+
+// Check sets the weight and thresholds for one metric
+type Check struct {
+	Name     string  `json:"name"`
+	Weight   float64 `json:"weight,omitempty"`
+	Warn     float64 `json:"warn,omitempty"`
+	Critical float64 `json:"critical,omitempty"`
+}
+
+// Rule fails a device when FailIf evaluates to true
+type Rule struct {
+	Name        string  `json:"name"`
+	FailIf      string  `json:"fail_if"`
+	Severity    string  `json:"severity,omitempty"` // warning or critical (default)
+	Weight      float64 `json:"weight,omitempty"`
+	Message     string  `json:"message,omitempty"`
+	Remediation string  `json:"remediation,omitempty"`
+
+	expr posture.Expr // compiled by Validate
+}
+
+// Verdict is the collector's own evaluation of a report
+type Verdict struct {
+	PolicyVersion int                  `json:"policy_version"`
+	Status        string               `json:"status"`
+	Score         int                  `json:"score"`
+	Severity      string               `json:"severity"`
+	FailingChecks []string             `json:"failing_checks,omitempty"`
+	Checks        []report.CheckResult `json:"checks"`
+}
+
+// Parse decodes and validates a policy document. Unknown fields are
+// rejected so a typo doesn't silently disable a check.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate rejects unknown checks and inconsistent thresholds, and compiles
+// the rule expressions
+func (p *Policy) Validate() error {
+	if len(p.Checks) == 0 && len(p.Rules) == 0 {
+		return fmt.Errorf("policy defines no checks or rules")
+	}
+
+	names := make(map[string]bool)
+	for _, c := range p.Checks {
+		if _, ok := posture.CheckLabels[c.Name]; !ok {
+			return fmt.Errorf("policy references unknown check %q", c.Name)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("check %q is defined twice", c.Name)
+		}
+		names[c.Name] = true
+		if c.Warn == 0 && c.Critical == 0 {
+			return fmt.Errorf("check %q needs a warn or critical threshold", c.Name)
+		}
+		if c.Warn > 0 && c.Critical > 0 && c.Warn >= c.Critical {
+			return fmt.Errorf("check %q: warn (%.0f) must be below critical (%.0f)", c.Name, c.Warn, c.Critical)
+		}
+		if c.Weight < 0 || c.Weight > 100 {
+			return fmt.Errorf("check %q: weight must be between 0 and 100", c.Name)
+		}
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d needs a name", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q: name already used by another check or rule", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Severity != "" && rule.Severity != SeverityWarning && rule.Severity != SeverityCritical {
+			return fmt.Errorf("rule %q: severity must be %q or %q", rule.Name, SeverityWarning, SeverityCritical)
+		}
+		if rule.Weight < 0 || rule.Weight > 100 {
+			return fmt.Errorf("rule %q: weight must be between 0 and 100", rule.Name)
+		}
+		expr, err := posture.CompileExpr(rule.FailIf, posture.Variables)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		rule.expr = expr
+	}
+
+	m := p.model()
+	if m.UnhealthyScore >= m.HealthyScore {
+		return fmt.Errorf("unhealthy_score (%.0f) must be below healthy_score (%.0f)", m.UnhealthyScore, m.HealthyScore)
+	}
+	return nil
+}
+
+// model returns the policy's score cut-offs, falling back to defaults
+func (p *Policy) model() posture.Model {
+	m := posture.DefaultModel()
+	if p.HealthyScore > 0 {
+		m.HealthyScore = p.HealthyScore
+	}
+	if p.UnhealthyScore > 0 {
+		m.UnhealthyScore = p.UnhealthyScore
+	}
+	return m
+}
+
+// Evaluate scores a report's raw metrics the way the agent would under this
+// policy. The policy must have passed Validate.
+func (p *Policy) Evaluate(status *report.DeviceStatus) Verdict {
+	var results []report.CheckResult
+	weights := make(map[string]float64)
+
+	for _, c := range p.Checks {
+		weight := c.Weight
+		if weight == 0 {
+			weight = posture.DefaultCheckWeights[c.Name]
+		}
+		weights[c.Name] = weight
+		results = append(results, posture.Threshold(c.Name, posture.CheckLabels[c.Name], metric(status, c.Name), c.Warn, c.Critical))
+	}
+
+	env := ruleEnv(status)
+	for _, rule := range p.Rules {
+		weight, severity := rule.Weight, rule.Severity
+		if weight == 0 {
+			weight = posture.DefaultRuleWeight
+		}
+		if severity == "" {
+			severity = SeverityCritical
+		}
+		weights[rule.Name] = weight
+		result := posture.Rule(rule.Name, rule.FailIf, rule.expr, env, severity, rule.Message)
+		if !result.Passed {
+			result.Remediation = rule.Remediation // as the agent does
+		}
+		results = append(results, result)
+	}
+
+	m := p.model()
+	v := Verdict{Checks: results}
+	v.Score, v.FailingChecks = m.Score(weights, results)
+	v.Status, v.Severity = m.Status(v.Score), m.Severity(v.Score)
+	return v
+}
+
+func metric(status *report.DeviceStatus, name string) float64 {
+	switch name {
+	case "disk_usage":
+		return status.DiskUsage
+	case "cpu_usage":
+		return status.CPUUsage
+	default:
+		return status.MemoryUsage
+	}
+}
+
+// ruleEnv exposes a report to rule expressions. Facts the report doesn't
+// carry are left out, so rules using them fail to evaluate.
+func ruleEnv(status *report.DeviceStatus) map[string]any {
+	facts := posture.Facts{
+		Hostname:    status.Hostname,
+		IP:          status.IP,
+		DiskUsage:   status.DiskUsage,
+		CPUUsage:    status.CPUUsage,
+		MemoryUsage: status.MemoryUsage,
+		Firewall:    status.Firewall,
+	}
+	if status.OS != nil {
+		facts.OSName, facts.OSVersion, facts.OSArch = status.OS.Name, status.OS.Version, status.OS.Arch
+	}
+	return facts.Env()
+}
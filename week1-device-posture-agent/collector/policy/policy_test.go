@@ -0,0 +1,61 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"device-posture-collector/report"
+)
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"checks": [
+			{"name": "disk_usage", "warn": 70, "critical": 90},
+			{"name": "memory_usage", "critical": 95}
+		],
+		"rules": [{"name": "firewall", "fail_if": "!firewall.enabled", "weight": 40, "remediation": "Turn it on"}]
+	}`))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	off := false
+	status := &report.DeviceStatus{Hostname: "laptop-1", DiskUsage: 75, MemoryUsage: 40, Firewall: &off}
+	v := p.Evaluate(status)
+	// Warning on disk (50/2) plus the critical rule (40)
+	if v.Score != 35 || v.Status != report.StatusUnhealthy || v.Severity != "high" {
+		t.Errorf("verdict = %d %s %s, want 35 UNHEALTHY high", v.Score, v.Status, v.Severity)
+	}
+	if got := strings.Join(v.FailingChecks, ","); got != "disk_usage,firewall" {
+		t.Errorf("failing = %s, want disk_usage,firewall", got)
+	}
+	if v.Checks[2].Remediation != "Turn it on" {
+		t.Errorf("rule result = %+v, want its remediation", v.Checks[2])
+	}
+
+	// Without firewall state the rule can't be evaluated: a warning only
+	status.Firewall = nil
+	status.DiskUsage = 10
+	v = p.Evaluate(status)
+	if v.Score != 80 || v.Status != report.StatusHealthy || v.Checks[2].Severity != SeverityWarning {
+		t.Errorf("verdict = %+v, want 80 HEALTHY with a rule warning", v)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, doc := range []string{
+		`{}`,
+		`{"checks": [{"name": "gpu_usage", "critical": 90}]}`,
+		`{"checks": [{"name": "disk_usage"}]}`,
+		`{"checks": [{"name": "disk_usage", "warn": 90, "critical": 80}]}`,
+		`{"checks": [{"name": "disk_usage", "critical": 90}, {"name": "disk_usage", "warn": 50}]}`,
+		`{"checks": [{"name": "disk_usage", "critical": 90, "treshold": 5}]}`,
+		`{"rules": [{"name": "x", "fail_if": "uptime > 5"}]}`,
+		`{"rules": [{"name": "x", "fail_if": "disk_usage > 5", "severity": "fatal"}]}`,
+		`{"healthy_score": 40, "rules": [{"name": "x", "fail_if": "disk_usage > 5"}]}`,
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("Parse(%s) expected error", doc)
+		}
+	}
+}
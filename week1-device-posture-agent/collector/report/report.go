@@ -0,0 +1,281 @@
+// Package report defines the device status payload the posture agent sends
+// and the rules a payload must satisfy before the collector stores it.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/posture"
+)
+
+// Health statuses reported by the agent
+const (
+	StatusHealthy   = posture.StatusHealthy
+	StatusDegraded  = posture.StatusDegraded
+	StatusUnhealthy = posture.StatusUnhealthy
+)
+
+// Report schema versions. Agents that predate versioning send no
+// schema_version and are treated as SchemaLegacy.
+const (
+	SchemaLegacy  = 1
+	SchemaCurrent = 2
+)
+
+// MaxIdempotencyKeyLength caps a report's idempotency key
+const MaxIdempotencyKeyLength = 128
+
+// Sections a report may leave out as unchanged since the device's
+// previous one, naming them in unchanged; the collector fills them in
+const (
+	SectionOS     = "os"
+	SectionChecks = "checks"
+)
+
+// MaxClockSkew is how far in the future a report timestamp may be before
+// it is rejected
+const MaxClockSkew = 5 * time.Minute
+
+// DeviceStatus mirrors the agent's report payload
+type DeviceStatus struct {
+	SchemaVersion int           `json:"schema_version,omitempty"`
+	Hostname      string        `json:"hostname"`
+	IP            string        `json:"ip"`
+	DiskUsage     float64       `json:"disk_usage"`
+	CPUUsage      float64       `json:"cpu_usage"`
+	MemoryUsage   float64       `json:"memory_usage"`
+	OS            *OSInfo       `json:"os,omitempty"`
+	Firewall      *bool         `json:"firewall_enabled,omitempty"`
+	Status        string        `json:"status"`
+	Score         int           `json:"score"`
+	Severity      string        `json:"severity,omitempty"`
+	FailingChecks []string      `json:"failing_checks,omitempty"`
+	Timestamp     time.Time     `json:"timestamp"`
+	Message       string        `json:"message,omitempty"`
+	Checks        []CheckResult `json:"checks,omitempty"`
+	Crashes       []CrashEvent  `json:"crashes,omitempty"`
+	Tamper        []TamperEvent `json:"tamper_events,omitempty"`
+	Changes       []ChangeEvent `json:"changes,omitempty"`
+	Logs          []LogEntry    `json:"logs,omitempty"`
+	// Unchanged names the sections a delta report leaves out because they
+	// are the same as in the device's previous report
+	Unchanged []string `json:"unchanged,omitempty"`
+
+	// IdempotencyKey identifies a report across retries: the collector
+	// acknowledges a key it has already stored for the device instead of
+	// storing the report twice
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// OSInfo identifies the operating system release
+type OSInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Arch    string `json:"arch"`
+}
+
+// CheckResult is the outcome of one posture check
+type CheckResult = posture.CheckResult
+
+// CrashEvent is a recovered agent panic or loop restart
+type CrashEvent struct {
+	Component string    `json:"component"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TamperEvent is an integrity finding from the agent's self-checks
+type TamperEvent struct {
+	Kind      string    `json:"kind"`
+	Path      string    `json:"path"`
+	Expected  string    `json:"expected,omitempty"`
+	Actual    string    `json:"actual,omitempty"`
+	Severity  string    `json:"severity"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ChangeEvent is one inventory difference between agent snapshots
+type ChangeEvent struct {
+	Kind      string    `json:"kind"`
+	Action    string    `json:"action"`
+	Item      string    `json:"item"`
+	Detail    string    `json:"detail,omitempty"`
+	Previous  string    `json:"previous,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LogEntry is an agent log record forwarded with a report
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// FieldError describes one invalid field in a payload
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found in a payload
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+": "+f.Message)
+	}
+	return "invalid report: " + strings.Join(parts, "; ")
+}
+
+// Decode parses a report body according to its schema_version. Current
+// schema reports must not contain unknown fields; legacy reports are read
+// leniently. An unsupported version is returned as a *ValidationError.
+func Decode(data []byte) (*DeviceStatus, error) {
+	var probe struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	version := SchemaLegacy
+	if probe.SchemaVersion != nil {
+		version = *probe.SchemaVersion
+	}
+	if version < SchemaLegacy || version > SchemaCurrent {
+		return nil, &ValidationError{Fields: []FieldError{{
+			Field:   "schema_version",
+			Message: fmt.Sprintf("unsupported version %d; this collector accepts %d to %d", version, SchemaLegacy, SchemaCurrent),
+		}}}
+	}
+
+	var status DeviceStatus
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if version >= 2 {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&status); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return nil, &ValidationError{Fields: []FieldError{{
+				Field:   strings.Trim(field, `"`),
+				Message: fmt.Sprintf("is not part of schema version %d", version),
+			}}}
+		}
+		return nil, err
+	}
+	status.SchemaVersion = version
+	return &status, nil
+}
+
+// Validate checks the required fields and value ranges, returning a
+// *ValidationError that names every invalid field. now bounds the report
+// timestamp.
+func (s *DeviceStatus) Validate(now time.Time) error {
+	var errs []FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(s.Hostname) == "" {
+		add("hostname", "is required")
+	}
+	if net.ParseIP(s.IP) == nil {
+		add("ip", "must be a valid IP address")
+	}
+	for _, pct := range []struct {
+		field string
+		value float64
+	}{
+		{"disk_usage", s.DiskUsage},
+		{"cpu_usage", s.CPUUsage},
+		{"memory_usage", s.MemoryUsage},
+	} {
+		if pct.value < 0 || pct.value > 100 {
+			add(pct.field, "must be between 0 and 100")
+		}
+	}
+	switch s.Status {
+	case StatusHealthy, StatusDegraded, StatusUnhealthy:
+	case "":
+		add("status", "is required")
+	default:
+		add("status", "must be HEALTHY, DEGRADED or UNHEALTHY")
+	}
+	if s.Score < 0 || s.Score > 100 {
+		add("score", "must be between 0 and 100")
+	}
+	if len(s.IdempotencyKey) > MaxIdempotencyKeyLength {
+		add("idempotency_key", "must be at most %d characters", MaxIdempotencyKeyLength)
+	} else if strings.IndexFunc(s.IdempotencyKey, func(r rune) bool { return r < '!' || r > '~' }) >= 0 {
+		add("idempotency_key", "must be printable ASCII without spaces")
+	}
+	switch {
+	case s.Timestamp.IsZero():
+		add("timestamp", "is required")
+	case s.Timestamp.After(now.Add(MaxClockSkew)):
+		add("timestamp", "is more than %s in the future", MaxClockSkew)
+	}
+
+	if s.SchemaVersion >= 2 {
+		switch s.Severity {
+		case "", "none", "low", "medium", "high", "critical":
+		default:
+			add("severity", "must be none, low, medium, high or critical")
+		}
+		for i, c := range s.Checks {
+			field := fmt.Sprintf("checks[%d]", i)
+			if c.Name == "" {
+				add(field+".name", "is required")
+			}
+			switch c.Severity {
+			case "", "warning", "critical":
+			default:
+				add(field+".severity", "must be warning or critical")
+			}
+		}
+		for i, t := range s.Tamper {
+			if t.Kind == "" || t.Path == "" {
+				add(fmt.Sprintf("tamper_events[%d]", i), "kind and path are required")
+			}
+		}
+		for i, section := range s.Unchanged {
+			field := fmt.Sprintf("unchanged[%d]", i)
+			switch {
+			case section == SectionOS && s.OS != nil, section == SectionChecks && len(s.Checks) > 0:
+				add(field, "names %s, which the report carries", section)
+			case section != SectionOS && section != SectionChecks:
+				add(field, "must be %s or %s", SectionOS, SectionChecks)
+			}
+		}
+	} else if len(s.Unchanged) > 0 {
+		add("unchanged", "needs schema version 2")
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Fields: errs}
+	}
+	return nil
+}
+
+// FillUnchanged takes the sections a delta report names as unchanged from
+// previous, the device's latest stored report, leaving a whole report
+func (s *DeviceStatus) FillUnchanged(previous *DeviceStatus) {
+	for _, section := range s.Unchanged {
+		switch section {
+		case SectionOS:
+			s.OS = previous.OS
+		case SectionChecks:
+			s.Checks = previous.Checks
+		}
+	}
+	s.Unchanged = nil
+}
@@ -0,0 +1,99 @@
+package report
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const currentReport = `{"schema_version":2,"hostname":"laptop-1","ip":"10.0.0.5","disk_usage":50,"cpu_usage":10,
+	"memory_usage":40,"os":{"name":"linux","arch":"amd64"},"status":"HEALTHY","score":100,"severity":"none",
+	"timestamp":"2024-05-01T10:00:00Z","checks":[{"name":"disk_usage","passed":true}]}`
+
+func TestDecodeVersions(t *testing.T) {
+	status, err := Decode([]byte(currentReport))
+	if err != nil || status.SchemaVersion != SchemaCurrent {
+		t.Fatalf("Decode(current) = %+v, %v", status, err)
+	}
+
+	// Older agents send no version and may include fields this collector
+	// doesn't know
+	legacy := `{"hostname":"laptop-1","ip":"10.0.0.5","status":"HEALTHY","timestamp":"2024-05-01T10:00:00Z","uptime":5}`
+	status, err = Decode([]byte(legacy))
+	if err != nil || status.SchemaVersion != SchemaLegacy {
+		t.Fatalf("Decode(legacy) = %+v, %v", status, err)
+	}
+
+	for body, field := range map[string]string{
+		`{"schema_version":3}`:                              "schema_version",
+		`{"schema_version":0}`:                              "schema_version",
+		strings.Replace(currentReport, `"ip"`, `"ipv4"`, 1): "ipv4",
+	} {
+		var verr *ValidationError
+		if _, err := Decode([]byte(body)); !errors.As(err, &verr) || verr.Fields[0].Field != field {
+			t.Errorf("Decode(%s) error = %v, want a %s field error", body, err, field)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	status, _ := Decode([]byte(currentReport))
+	if err := status.Validate(now); err != nil {
+		t.Fatalf("valid report rejected: %v", err)
+	}
+
+	status.Timestamp = now.Add(time.Hour)
+	status.Score = 101
+	status.Severity = "severe"
+	status.Checks[0].Name = ""
+	status.IdempotencyKey = "retry 1"
+	var verr *ValidationError
+	if err := status.Validate(now); !errors.As(err, &verr) {
+		t.Fatalf("Validate = %v, want a ValidationError", err)
+	}
+	var fields []string
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	if got, want := strings.Join(fields, ","), "score,idempotency_key,timestamp,severity,checks[0].name"; got != want {
+		t.Errorf("invalid fields = %s, want %s", got, want)
+	}
+
+	// Legacy reports skip the checks added with schema version 2
+	status.SchemaVersion = SchemaLegacy
+	status.Timestamp, status.Score, status.IdempotencyKey = now, 50, "retry-1"
+	if err := status.Validate(now); err != nil {
+		t.Errorf("legacy report rejected: %v", err)
+	}
+}
+
+func TestUnchangedSections(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	previous, _ := Decode([]byte(currentReport))
+	status, _ := Decode([]byte(currentReport))
+	status.OS, status.Unchanged = nil, []string{SectionOS, SectionChecks, "logs"}
+	var verr *ValidationError
+	if err := status.Validate(now); !errors.As(err, &verr) {
+		t.Fatalf("Validate = %v, want a ValidationError", err)
+	}
+	// The checks are still in the report, and logs can't be left out
+	if len(verr.Fields) != 2 || verr.Fields[0].Field != "unchanged[1]" || verr.Fields[1].Field != "unchanged[2]" {
+		t.Errorf("invalid fields = %+v", verr.Fields)
+	}
+
+	status.Checks, status.Unchanged = nil, []string{SectionOS, SectionChecks}
+	if err := status.Validate(now); err != nil {
+		t.Fatalf("delta report rejected: %v", err)
+	}
+	status.FillUnchanged(previous)
+	if status.OS == nil || *status.OS != *previous.OS || len(status.Checks) != len(previous.Checks) || status.Unchanged != nil {
+		t.Errorf("filled report = %+v", status)
+	}
+
+	status.SchemaVersion, status.Unchanged = SchemaLegacy, []string{SectionOS}
+	if err := status.Validate(now); !errors.As(err, &verr) || verr.Fields[0].Field != "unchanged" {
+		t.Errorf("legacy delta report: Validate = %v", err)
+	}
+}
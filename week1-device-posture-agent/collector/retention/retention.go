@@ -0,0 +1,133 @@
+// Package retention rolls old reports up into hourly summaries and prunes
+// data past its retention window.
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"device-posture-collector/store"
+)
+
+// Policy says how long data is kept. Zero keeps it forever.
+type Policy struct {
+	Reports time.Duration // raw reports
+	Rollups time.Duration // hourly rollups
+}
+
+// DefaultPolicy keeps raw reports for 30 days and rollups for a year
+var DefaultPolicy = Policy{Reports: 30 * 24 * time.Hour, Rollups: 365 * 24 * time.Hour}
+
+// lateReports is how far back each run recomputes rollups, so reports an
+// agent queued while offline still land in their hour
+const lateReports = 24 * time.Hour
+
+// Stats describes what the job has done since the collector started
+type Stats struct {
+	Policy struct {
+		Reports string `json:"reports"`
+		Rollups string `json:"rollups"`
+	} `json:"policy"`
+	Runs           int64      `json:"runs"`
+	LastRun        *time.Time `json:"last_run,omitempty"`
+	LastDuration   float64    `json:"last_duration_seconds"`
+	LastError      string     `json:"last_error,omitempty"`
+	ReportsDeleted int64      `json:"reports_deleted"`
+	RollupsDeleted int64      `json:"rollups_deleted"`
+	RollupsWritten int64      `json:"rollups_written"`
+}
+
+// Job periodically rolls up complete hours and prunes expired data
+type Job struct {
+	store  store.Store
+	policy Policy
+	now    func() time.Time
+	log    *slog.Logger
+
+	mu          sync.Mutex
+	stats       Stats
+	rolledUntil time.Time // end of the last rolled-up range
+}
+
+// NewJob creates a retention job over s, logging its runs to logger
+func NewJob(s store.Store, policy Policy, logger *slog.Logger) *Job {
+	j := &Job{store: s, policy: policy, now: time.Now, log: logger}
+	j.stats.Policy.Reports = describe(policy.Reports)
+	j.stats.Policy.Rollups = describe(policy.Rollups)
+	return j
+}
+
+func describe(d time.Duration) string {
+	if d <= 0 {
+		return "forever"
+	}
+	return d.String()
+}
+
+// Run rolls up and prunes every interval until ctx is cancelled
+func (j *Job) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := j.RunOnce(ctx); err != nil {
+			j.log.Error("retention run failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce rolls up every complete hour, then prunes reports and rollups
+// past the policy. Rolling up first means no hour is pruned before it has
+// a summary; cutoffs fall on hour boundaries so no hour is half pruned.
+func (j *Job) RunOnce(ctx context.Context) error {
+	started := j.now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	to := started.Truncate(store.RollupInterval)
+	from := time.Unix(0, 0) // first run: everything still stored
+	if !j.rolledUntil.IsZero() {
+		from = j.rolledUntil.Add(-lateReports)
+	}
+	written, err := j.store.RollupReports(ctx, from, to)
+	if err == nil {
+		j.rolledUntil = to
+		j.stats.RollupsWritten += written
+	}
+
+	var reports, rollups int64
+	if err == nil && j.policy.Reports > 0 {
+		reports, err = j.store.PruneReports(ctx, started.Add(-j.policy.Reports).Truncate(store.RollupInterval))
+		j.stats.ReportsDeleted += reports
+	}
+	if err == nil && j.policy.Rollups > 0 {
+		rollups, err = j.store.PruneRollups(ctx, started.Add(-j.policy.Rollups).Truncate(store.RollupInterval))
+		j.stats.RollupsDeleted += rollups
+	}
+
+	j.stats.Runs++
+	j.stats.LastRun = &started
+	j.stats.LastDuration = j.now().Sub(started).Seconds()
+	j.stats.LastError = ""
+	if err != nil {
+		j.stats.LastError = err.Error()
+		return err
+	}
+	if reports > 0 || rollups > 0 {
+		j.log.Info("retention run", "device_hours_rolled_up", written, "reports_pruned", reports, "rollups_pruned", rollups)
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the job's counters
+func (j *Job) Stats() Stats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
@@ -0,0 +1,42 @@
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"device-posture-collector/report"
+	"device-posture-collector/store"
+)
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory(100)
+	now := time.Date(2024, 6, 10, 12, 30, 0, 0, time.UTC)
+	for _, age := range []time.Duration{20 * time.Minute, 50 * time.Hour, 72 * time.Hour} {
+		status := report.DeviceStatus{Hostname: "laptop-1", Status: "HEALTHY", Score: 100, Timestamp: now.Add(-age)}
+		s.SaveReport(ctx, &status, nil, status.Timestamp)
+	}
+
+	job := NewJob(s, Policy{Reports: 48 * time.Hour, Rollups: 60 * time.Hour}, slog.Default())
+	job.now = func() time.Time { return now }
+	if err := job.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The current hour is not complete, so it is neither rolled up nor pruned
+	left, _ := s.ListReports(ctx, store.Filter{})
+	if len(left) != 1 {
+		t.Errorf("reports left = %d, want 1", len(left))
+	}
+	rollups, _ := s.ListRollups(ctx, "laptop-1", time.Time{}, time.Time{})
+	if len(rollups) != 1 || !rollups[0].Bucket.Equal(now.Add(-50*time.Hour).Truncate(time.Hour)) {
+		t.Errorf("rollups = %+v", rollups)
+	}
+
+	stats := job.Stats()
+	if stats.Runs != 1 || stats.ReportsDeleted != 2 || stats.RollupsDeleted != 1 || stats.RollupsWritten != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
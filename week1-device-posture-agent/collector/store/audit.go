@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+
+	"github.com/nisatyap/shared/audit"
+)
+
+// AuditEvents keeps the collector's audit log: enrollments, keys issued and
+// revoked, policy changes and admins signing in. Events of every tenant
+// share one hash chain, so that a tenant admin sees their own events while
+// Verify checks them all.
+type AuditEvents interface {
+	// AppendAudit chains e to the last event stored, as audit.Chain does,
+	// and stores it
+	AppendAudit(ctx context.Context, e audit.Event) (audit.Event, error)
+	// ScanAudit calls fn with each event of every tenant, oldest first
+	ScanAudit(ctx context.Context, fn func(audit.Event) error) error
+}
+
+// AuditStore returns s as the store of an audit.Log
+func AuditStore(s AuditEvents) audit.Store {
+	return auditStore{s}
+}
+
+type auditStore struct{ s AuditEvents }
+
+func (a auditStore) Append(ctx context.Context, e audit.Event) (audit.Event, error) {
+	return a.s.AppendAudit(ctx, e)
+}
+
+func (a auditStore) Scan(ctx context.Context, fn func(audit.Event) error) error {
+	return a.s.ScanAudit(ctx, fn)
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// EnrollmentToken is a one-time secret an admin hands to a new device. Only
+// its hash is stored.
+type EnrollmentToken struct {
+	ID        string            `json:"id"`
+	Tenant    string            `json:"tenant"`
+	Tags      map[string]string `json:"tags,omitempty"` // assigned to the enrolled device, e.g. its group
+	Hash      string            `json:"-"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	UsedAt    *time.Time        `json:"used_at,omitempty"`
+	UsedBy    string            `json:"used_by,omitempty"`
+}
+
+// APIKey authenticates one device's reports. Only its hash is stored.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Tenant     string     `json:"tenant"`
+	Hostname   string     `json:"hostname"`
+	Hash       string     `json:"-"`
+	SigningKey string     `json:"signing_key,omitempty"` // the device's Ed25519 public key for signing reports, in base64
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // set when the key is rotated out
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Valid reports whether the key may be used at now
+func (k *APIKey) Valid(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Credentials stores enrollment tokens and device API keys
+type Credentials interface {
+	CreateEnrollmentToken(ctx context.Context, token EnrollmentToken) error
+	// ConsumeEnrollmentToken marks an unused, unexpired token as used by
+	// hostname; ErrNotFound if there is no such token
+	ConsumeEnrollmentToken(ctx context.Context, hash, hostname string, now time.Time) (EnrollmentToken, error)
+	ListEnrollmentTokens(ctx context.Context) ([]EnrollmentToken, error)
+
+	CreateAPIKey(ctx context.Context, key APIKey) error
+	// GetAPIKey looks a key up by hash, including revoked and expired keys
+	GetAPIKey(ctx context.Context, hash string) (APIKey, error)
+	ListAPIKeys(ctx context.Context, hostname string) ([]APIKey, error)
+	// ExpireAPIKey limits a key's remaining lifetime, used when rotating
+	ExpireAPIKey(ctx context.Context, hash string, at time.Time) error
+	// RevokeAPIKeys revokes every active key of a device, returning how many
+	RevokeAPIKeys(ctx context.Context, hostname string, at time.Time) (int64, error)
+}
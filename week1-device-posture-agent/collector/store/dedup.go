@@ -0,0 +1,33 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"device-posture-collector/policy"
+	"device-posture-collector/report"
+)
+
+// How SaveReport deduplicated a report
+const (
+	// DedupReplay marks a report whose idempotency key was already stored
+	// for its device; nothing was changed
+	DedupReplay = "replay"
+	// DedupRepeat marks a report identical to its device's last one apart
+	// from its later timestamp; the last report's repeat count was raised
+	DedupRepeat = "repeat"
+)
+
+// contentHash fingerprints what a report says about its device, leaving out
+// when it was taken and its idempotency key. The verdict is included so a
+// policy change starts a new row.
+func contentHash(status *report.DeviceStatus, verdict *policy.Verdict) string {
+	content := *status
+	content.Timestamp, content.IdempotencyKey = time.Time{}, ""
+	h := sha256.New()
+	json.NewEncoder(h).Encode(content)
+	json.NewEncoder(h).Encode(verdict)
+	return hex.EncodeToString(h.Sum(nil))
+}
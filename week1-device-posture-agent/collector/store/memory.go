@@ -0,0 +1,660 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+
+	"device-posture-collector/policy"
+	"device-posture-collector/report"
+)
+
+// Memory keeps reports in process memory, dropping the oldest beyond a cap.
+// It suits development and tests; data is lost on restart.
+type Memory struct {
+	mu         sync.RWMutex
+	reports    []StoredReport
+	devices    map[deviceID]*Device
+	nextID     int64
+	maxReports int
+	tokens     []EnrollmentToken
+	keys       []APIKey
+	rollups    map[rollupKey]Rollup
+	tenants    map[string]Tenant
+	policies   map[string]Policy
+	reportKeys map[reportKey]int64 // idempotency key to report ID
+	audit      []audit.Event
+}
+
+type deviceID struct {
+	tenant   string
+	hostname string
+}
+
+type reportKey struct {
+	deviceID
+	key string
+}
+
+type rollupKey struct {
+	deviceID
+	bucket int64
+}
+
+// inScope reports whether a record of tenant is visible to ctx
+func inScope(ctx context.Context, tenant string) bool {
+	scoped, ok := TenantScope(ctx)
+	return !ok || scoped == tenant
+}
+
+// NewMemory creates an in-memory store holding at most maxReports reports
+func NewMemory(maxReports int) *Memory {
+	return &Memory{
+		devices:    make(map[deviceID]*Device),
+		nextID:     1,
+		maxReports: maxReports,
+		rollups:    make(map[rollupKey]Rollup),
+		tenants:    map[string]Tenant{DefaultTenant: {ID: DefaultTenant, Name: "Default", CreatedAt: time.Now().UTC()}},
+		policies:   make(map[string]Policy),
+		reportKeys: make(map[reportKey]int64),
+	}
+}
+
+func (m *Memory) SaveReport(ctx context.Context, status *report.DeviceStatus, verdict *policy.Verdict, receivedAt time.Time) (StoredReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saveReport(ctx, status, verdict, receivedAt), nil
+}
+
+func (m *Memory) SaveReports(ctx context.Context, reports []NewReport) ([]StoredReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]StoredReport, 0, len(reports))
+	for _, r := range reports {
+		out = append(out, m.saveReport(ctx, r.Status, r.Verdict, r.ReceivedAt))
+	}
+	return out, nil
+}
+
+// saveReport stores one report; m.mu must be held
+func (m *Memory) saveReport(ctx context.Context, status *report.DeviceStatus, verdict *policy.Verdict, receivedAt time.Time) StoredReport {
+	tenant := TenantOf(ctx)
+	id := deviceID{tenant, status.Hostname}
+	key := reportKey{id, status.IdempotencyKey}
+	if key.key != "" {
+		if i, ok := m.find(m.reportKeys[key]); ok {
+			stored := m.reports[i]
+			stored.Dedup = DedupReplay
+			return stored
+		}
+	}
+
+	hash := contentHash(status, verdict)
+	device, ok := m.devices[id]
+	if ok {
+		// Only a report taken after the last one continues it
+		if i, found := m.find(device.LastReportID); found && m.reports[i].contentHash == hash &&
+			!status.Timestamp.Before(m.reports[i].lastTimestamp()) {
+			last := &m.reports[i]
+			until := status.Timestamp
+			last.Repeats++
+			last.RepeatedUntil = &until
+			device.LastSeen = receivedAt
+			device.ReportCount++
+			if key.key != "" {
+				m.reportKeys[key] = last.ID
+			}
+			stored := *last
+			stored.Dedup = DedupRepeat
+			return stored
+		}
+	}
+
+	stored := StoredReport{ID: m.nextID, Tenant: tenant, ReceivedAt: receivedAt, DeviceStatus: *status, Server: verdict, contentHash: hash}
+	if verdict != nil {
+		stored.PolicyMismatch = policyMismatch(status.Status, verdict.Status)
+	}
+	m.nextID++
+	m.reports = append(m.reports, stored)
+	if key.key != "" {
+		m.reportKeys[key] = stored.ID
+	}
+	if m.maxReports > 0 && len(m.reports) > m.maxReports {
+		m.reports = m.reports[len(m.reports)-m.maxReports:]
+		m.dropKeys()
+	}
+
+	if !ok {
+		device = &Device{Tenant: tenant, Hostname: status.Hostname}
+		m.devices[id] = device
+	}
+	device.IP = status.IP
+	device.Status = status.Status
+	device.Score = status.Score
+	device.ServerStatus, device.ServerScore = "", nil
+	if verdict != nil {
+		score := verdict.Score
+		device.ServerStatus, device.ServerScore = verdict.Status, &score
+	}
+	device.PolicyMismatch = stored.PolicyMismatch
+	device.FailingChecks = status.FailingChecks
+	device.DiskUsage = status.DiskUsage
+	device.CPUUsage = status.CPUUsage
+	device.MemoryUsage = status.MemoryUsage
+	device.LastSeen = receivedAt
+	device.LastReportID = stored.ID
+	device.ReportCount++
+
+	return stored
+}
+
+// find returns the index of the report with the given ID, if still kept
+func (m *Memory) find(id int64) (int, bool) {
+	i := sort.Search(len(m.reports), func(i int) bool { return m.reports[i].ID >= id })
+	return i, i < len(m.reports) && m.reports[i].ID == id
+}
+
+// dropKeys forgets the idempotency keys of reports no longer kept; m.mu
+// must be held
+func (m *Memory) dropKeys() {
+	for key, id := range m.reportKeys {
+		if _, ok := m.find(id); !ok {
+			delete(m.reportKeys, key)
+		}
+	}
+}
+
+func (m *Memory) ListReports(ctx context.Context, filter Filter) ([]StoredReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []StoredReport
+	for n := range m.reports {
+		i := len(m.reports) - 1 - n
+		if filter.Oldest {
+			i = n
+		}
+		r := m.reports[i]
+		if !inScope(ctx, r.Tenant) || !filter.matches(&r) {
+			continue
+		}
+		out = append(out, r)
+		if filter.Limit > 0 && len(out) == filter.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) ReportSeries(ctx context.Context, filter Filter, step time.Duration) ([]SeriesPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filter.Cursor, filter.Oldest = 0, false
+	points := make(map[int64]*SeriesPoint)
+	hosts := make(map[int64]map[deviceID]bool)
+	for i := range m.reports {
+		r := &m.reports[i]
+		if !inScope(ctx, r.Tenant) || !filter.matches(r) {
+			continue
+		}
+		bucket := r.Timestamp.UnixNano() / int64(step) * int64(step)
+		p, ok := points[bucket]
+		if !ok {
+			p = &SeriesPoint{Bucket: time.Unix(0, bucket).UTC()}
+			points[bucket] = p
+			hosts[bucket] = make(map[deviceID]bool)
+		}
+		// Sums for now, counting repeats as reports; turned into averages below
+		n := int64(1 + r.Repeats)
+		p.Reports += n
+		hosts[bucket][deviceID{r.Tenant, r.Hostname}] = true
+		switch r.Status {
+		case report.StatusUnhealthy:
+			p.Unhealthy += n
+		case report.StatusDegraded:
+			p.Degraded += n
+		}
+		p.AvgDisk += float64(n) * r.DiskUsage
+		p.AvgCPU += float64(n) * r.CPUUsage
+		p.AvgMemory += float64(n) * r.MemoryUsage
+		p.AvgScore += float64(n) * float64(r.Score)
+	}
+
+	out := make([]SeriesPoint, 0, len(points))
+	for bucket, p := range points {
+		n := float64(p.Reports)
+		p.Devices = int64(len(hosts[bucket]))
+		p.AvgDisk, p.AvgCPU, p.AvgMemory, p.AvgScore = p.AvgDisk/n, p.AvgCPU/n, p.AvgMemory/n, p.AvgScore/n
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Bucket.Before(out[j].Bucket) })
+	return out, nil
+}
+
+// matches reports whether r passes every filter condition except Limit
+func (f *Filter) matches(r *StoredReport) bool {
+	switch {
+	case f.Hostname != "" && r.Hostname != f.Hostname,
+		f.Status != "" && r.Status != f.Status,
+		f.Mismatch && !r.PolicyMismatch,
+		!f.Since.IsZero() && r.lastTimestamp().Before(f.Since),
+		!f.Until.IsZero() && !r.Timestamp.Before(f.Until),
+		f.Cursor > 0 && !f.Oldest && r.ID >= f.Cursor,
+		f.Cursor > 0 && f.Oldest && r.ID <= f.Cursor:
+		return false
+	}
+	return true
+}
+
+func (m *Memory) ListDevices(ctx context.Context) ([]Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]Device, 0, len(m.devices))
+	for _, d := range m.devices {
+		if inScope(ctx, d.Tenant) {
+			out = append(out, *d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Hostname != out[j].Hostname {
+			return out[i].Hostname < out[j].Hostname
+		}
+		return out[i].Tenant < out[j].Tenant
+	})
+	return out, nil
+}
+
+func (m *Memory) GetDevice(ctx context.Context, hostname string) (Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, ok := m.devices[deviceID{TenantOf(ctx), hostname}]
+	if !ok {
+		return Device{}, ErrNotFound
+	}
+	return *d, nil
+}
+
+func (m *Memory) GetDeviceByIP(ctx context.Context, ip string) (Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenant := TenantOf(ctx)
+	var found *Device
+	for _, d := range m.devices {
+		if d.Tenant == tenant && d.IP == ip && (found == nil || d.LastSeen.After(found.LastSeen)) {
+			found = d
+		}
+	}
+	if found == nil {
+		return Device{}, ErrNotFound
+	}
+	return *found, nil
+}
+
+func (m *Memory) SetTags(ctx context.Context, hostname string, tags map[string]string) (Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.devices[deviceID{TenantOf(ctx), hostname}]
+	if !ok {
+		return Device{}, ErrNotFound
+	}
+	d.Tags = nil
+	if len(tags) > 0 {
+		d.Tags = make(map[string]string, len(tags))
+		for k, v := range tags {
+			d.Tags[k] = v
+		}
+	}
+	return *d, nil
+}
+
+func (m *Memory) RegisterDevice(ctx context.Context, hostname string, tags map[string]string, at time.Time) (Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := deviceID{TenantOf(ctx), hostname}
+	d, ok := m.devices[id]
+	if !ok {
+		d = &Device{Tenant: id.tenant, Hostname: hostname, Status: StatusEnrolled, LastSeen: at}
+		m.devices[id] = d
+	}
+	if len(tags) > 0 {
+		d.Tags = mergeTags(d.Tags, tags)
+	}
+	return *d, nil
+}
+
+func (m *Memory) DeleteReports(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.reports[:0]
+	for _, r := range m.reports {
+		if !inScope(ctx, r.Tenant) {
+			kept = append(kept, r)
+		}
+	}
+	n := int64(len(m.reports) - len(kept))
+	m.reports = kept
+	m.dropKeys()
+	for id := range m.devices {
+		if inScope(ctx, id.tenant) {
+			delete(m.devices, id)
+		}
+	}
+	for key := range m.rollups {
+		if inScope(ctx, key.tenant) {
+			delete(m.rollups, key)
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) Close() error { return nil }
+
+func (m *Memory) CreateEnrollmentToken(ctx context.Context, token EnrollmentToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token.Tenant = recordTenant(ctx, token.Tenant)
+	if len(token.Tags) == 0 {
+		token.Tags = nil
+	}
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *Memory) ConsumeEnrollmentToken(ctx context.Context, hash, hostname string, now time.Time) (EnrollmentToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.tokens {
+		t := &m.tokens[i]
+		if t.Hash != hash || t.UsedAt != nil || !now.Before(t.ExpiresAt) {
+			continue
+		}
+		t.UsedAt, t.UsedBy = &now, hostname
+		return *t, nil
+	}
+	return EnrollmentToken{}, ErrNotFound
+}
+
+func (m *Memory) ListEnrollmentTokens(ctx context.Context) ([]EnrollmentToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []EnrollmentToken
+	for _, t := range m.tokens {
+		if inScope(ctx, t.Tenant) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) CreateAPIKey(ctx context.Context, key APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key.Tenant = recordTenant(ctx, key.Tenant)
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func (m *Memory) GetAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return APIKey{}, ErrNotFound
+}
+
+func (m *Memory) ListAPIKeys(ctx context.Context, hostname string) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []APIKey
+	tenant := TenantOf(ctx)
+	for _, k := range m.keys {
+		if k.Tenant == tenant && k.Hostname == hostname {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) ExpireAPIKey(ctx context.Context, hash string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.keys {
+		if m.keys[i].Hash == hash {
+			m.keys[i].ExpiresAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) RevokeAPIKeys(ctx context.Context, hostname string, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	tenant := TenantOf(ctx)
+	for i := range m.keys {
+		if k := &m.keys[i]; k.Tenant == tenant && k.Hostname == hostname && k.RevokedAt == nil {
+			k.RevokedAt = &at
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) RollupReports(ctx context.Context, from, to time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Sum first, then turn the sums into averages
+	sums := make(map[rollupKey]*Rollup)
+	for _, r := range m.reports {
+		if r.Timestamp.Before(from) || !r.Timestamp.Before(to) {
+			continue
+		}
+		key := rollupKey{deviceID{r.Tenant, r.Hostname}, r.Timestamp.Truncate(RollupInterval).UnixNano()}
+		sum, ok := sums[key]
+		if !ok {
+			sum = &Rollup{Tenant: r.Tenant, Hostname: r.Hostname, Bucket: time.Unix(0, key.bucket).UTC(), MinScore: r.Score}
+			sums[key] = sum
+		}
+		n := int64(1 + r.Repeats)
+		sum.Reports += n
+		switch r.Status {
+		case report.StatusUnhealthy:
+			sum.Unhealthy += n
+		case report.StatusDegraded:
+			sum.Degraded += n
+		}
+		sum.AvgDisk += float64(n) * r.DiskUsage
+		sum.AvgCPU += float64(n) * r.CPUUsage
+		sum.AvgMemory += float64(n) * r.MemoryUsage
+		sum.AvgScore += float64(n) * float64(r.Score)
+		sum.MaxDisk = max(sum.MaxDisk, r.DiskUsage)
+		sum.MaxCPU = max(sum.MaxCPU, r.CPUUsage)
+		sum.MaxMemory = max(sum.MaxMemory, r.MemoryUsage)
+		sum.MinScore = min(sum.MinScore, r.Score)
+	}
+	for key, sum := range sums {
+		n := float64(sum.Reports)
+		sum.AvgDisk /= n
+		sum.AvgCPU /= n
+		sum.AvgMemory /= n
+		sum.AvgScore /= n
+		m.rollups[key] = *sum
+	}
+	return int64(len(sums)), nil
+}
+
+func (m *Memory) ListRollups(ctx context.Context, hostname string, since, until time.Time) ([]Rollup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []Rollup
+	id := deviceID{TenantOf(ctx), hostname}
+	for key, r := range m.rollups {
+		if key.deviceID != id || (!since.IsZero() && r.Bucket.Before(since)) || (!until.IsZero() && !r.Bucket.Before(until)) {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Bucket.Before(out[j].Bucket) })
+	return out, nil
+}
+
+func (m *Memory) PruneReports(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.reports[:0]
+	for _, r := range m.reports {
+		if !r.lastTimestamp().Before(before) {
+			kept = append(kept, r)
+		}
+	}
+	n := int64(len(m.reports) - len(kept))
+	m.reports = kept
+	m.dropKeys()
+	return n, nil
+}
+
+func (m *Memory) PruneRollups(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for key, r := range m.rollups {
+		if r.Bucket.Before(before) {
+			delete(m.rollups, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) CreateTenant(ctx context.Context, tenant Tenant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tenants[tenant.ID]; ok {
+		return ErrExists
+	}
+	m.tenants[tenant.ID] = tenant
+	return nil
+}
+
+func (m *Memory) GetTenant(ctx context.Context, id string) (Tenant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.tenants[id]
+	if !ok {
+		return Tenant{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (m *Memory) GetTenantByAdminKey(ctx context.Context, hash string) (Tenant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, t := range m.tenants {
+		if hash != "" && t.AdminKeyHash == hash {
+			return t, nil
+		}
+	}
+	return Tenant{}, ErrNotFound
+}
+
+func (m *Memory) ListTenants(ctx context.Context) ([]Tenant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]Tenant, 0, len(m.tenants))
+	for _, t := range m.tenants {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (m *Memory) SetTenantAdminKey(ctx context.Context, id, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tenants[id]
+	if !ok {
+		return ErrNotFound
+	}
+	t.AdminKeyHash = hash
+	m.tenants[id] = t
+	return nil
+}
+
+func (m *Memory) GetPolicy(ctx context.Context) (Policy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.policies[TenantOf(ctx)]
+	if !ok {
+		return Policy{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (m *Memory) SetPolicy(ctx context.Context, document json.RawMessage, at time.Time) (Policy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenant := TenantOf(ctx)
+	p := Policy{
+		Tenant:    tenant,
+		Version:   m.policies[tenant].Version + 1,
+		Document:  append(json.RawMessage(nil), document...),
+		UpdatedAt: at,
+	}
+	m.policies[tenant] = p
+	return p, nil
+}
+
+func (m *Memory) DeletePolicy(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenant := TenantOf(ctx)
+	if _, ok := m.policies[tenant]; !ok {
+		return ErrNotFound
+	}
+	delete(m.policies, tenant)
+	return nil
+}
+
+func (m *Memory) AppendAudit(ctx context.Context, e audit.Event) (audit.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var last audit.Event
+	if n := len(m.audit); n > 0 {
+		last = m.audit[n-1]
+	}
+	e = audit.Chain(last, e)
+	m.audit = append(m.audit, e)
+	return e, nil
+}
+
+func (m *Memory) ScanAudit(ctx context.Context, fn func(audit.Event) error) error {
+	m.mu.RLock()
+	events := m.audit[:len(m.audit):len(m.audit)]
+	m.mu.RUnlock()
+	for _, e := range events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
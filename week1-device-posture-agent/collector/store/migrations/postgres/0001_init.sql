@@ -0,0 +1,30 @@
+CREATE TABLE reports (
+    id           BIGSERIAL PRIMARY KEY,
+    hostname     TEXT             NOT NULL,
+    ip           TEXT             NOT NULL,
+    status       TEXT             NOT NULL,
+    score        INTEGER          NOT NULL,
+    disk_usage   DOUBLE PRECISION NOT NULL,
+    cpu_usage    DOUBLE PRECISION NOT NULL,
+    memory_usage DOUBLE PRECISION NOT NULL,
+    timestamp    BIGINT           NOT NULL, -- agent collection time, unix nanoseconds
+    received_at  BIGINT           NOT NULL, -- collector receive time, unix nanoseconds
+    payload      JSONB            NOT NULL  -- full DeviceStatus
+);
+
+CREATE INDEX idx_reports_hostname_timestamp ON reports (hostname, timestamp);
+CREATE INDEX idx_reports_timestamp ON reports (timestamp);
+CREATE INDEX idx_reports_status ON reports (status);
+
+CREATE TABLE devices (
+    hostname       TEXT PRIMARY KEY,
+    ip             TEXT    NOT NULL,
+    status         TEXT    NOT NULL,
+    score          INTEGER NOT NULL,
+    failing_checks JSONB   NOT NULL DEFAULT '[]',
+    last_seen      BIGINT  NOT NULL,
+    last_report_id BIGINT  NOT NULL,
+    report_count   BIGINT  NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_devices_last_seen ON devices (last_seen);
@@ -0,0 +1 @@
+ALTER TABLE devices ADD COLUMN tags JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,20 @@
+-- Timestamps are unix nanoseconds; secrets are stored as SHA-256 hashes
+CREATE TABLE enrollment_tokens (
+    hash       TEXT PRIMARY KEY,
+    id         TEXT   NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    used_at    BIGINT,
+    used_by    TEXT   NOT NULL DEFAULT ''
+);
+
+CREATE TABLE api_keys (
+    hash       TEXT PRIMARY KEY,
+    id         TEXT   NOT NULL,
+    hostname   TEXT   NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT,
+    revoked_at BIGINT
+);
+
+CREATE INDEX idx_api_keys_hostname ON api_keys (hostname);
@@ -0,0 +1,20 @@
+-- Hourly per-device summaries kept after raw reports are pruned.
+-- bucket is the start of the hour in unix nanoseconds.
+CREATE TABLE report_rollups (
+    hostname    TEXT             NOT NULL,
+    bucket      BIGINT           NOT NULL,
+    reports     BIGINT           NOT NULL,
+    unhealthy   BIGINT           NOT NULL,
+    degraded    BIGINT           NOT NULL,
+    avg_disk    DOUBLE PRECISION NOT NULL,
+    max_disk    DOUBLE PRECISION NOT NULL,
+    avg_cpu     DOUBLE PRECISION NOT NULL,
+    max_cpu     DOUBLE PRECISION NOT NULL,
+    avg_memory  DOUBLE PRECISION NOT NULL,
+    max_memory  DOUBLE PRECISION NOT NULL,
+    avg_score   DOUBLE PRECISION NOT NULL,
+    min_score   INTEGER          NOT NULL,
+    PRIMARY KEY (hostname, bucket)
+);
+
+CREATE INDEX idx_report_rollups_bucket ON report_rollups (bucket);
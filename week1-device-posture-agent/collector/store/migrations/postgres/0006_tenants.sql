@@ -0,0 +1,28 @@
+-- Every record belongs to a tenant; existing data moves to the default one
+CREATE TABLE tenants (
+    id             TEXT PRIMARY KEY,
+    name           TEXT   NOT NULL,
+    admin_key_hash TEXT   NOT NULL DEFAULT '', -- SHA-256 of the tenant admin key
+    created_at     BIGINT NOT NULL
+);
+
+CREATE INDEX idx_tenants_admin_key_hash ON tenants (admin_key_hash);
+
+INSERT INTO tenants (id, name, created_at)
+VALUES ('default', 'Default', (EXTRACT(EPOCH FROM now()) * 1000000000)::BIGINT);
+
+ALTER TABLE reports ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX idx_reports_tenant_hostname_timestamp ON reports (tenant, hostname, timestamp);
+
+ALTER TABLE enrollment_tokens ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+DROP INDEX idx_api_keys_hostname;
+CREATE INDEX idx_api_keys_tenant_hostname ON api_keys (tenant, hostname);
+
+-- Hostnames are unique per tenant, so the devices and rollups keys gain the tenant
+ALTER TABLE devices ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE devices DROP CONSTRAINT devices_pkey, ADD PRIMARY KEY (tenant, hostname);
+
+ALTER TABLE report_rollups ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE report_rollups DROP CONSTRAINT report_rollups_pkey, ADD PRIMARY KEY (tenant, hostname, bucket);
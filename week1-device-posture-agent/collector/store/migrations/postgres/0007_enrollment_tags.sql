@@ -0,0 +1,2 @@
+-- Tags an enrollment token assigns to the device that uses it
+ALTER TABLE enrollment_tokens ADD COLUMN tags JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,20 @@
+-- An identical consecutive report extends the previous row instead of adding
+-- one: repeats counts the reports folded into it and last_timestamp is the
+-- newest one's agent time, unix nanoseconds
+ALTER TABLE reports ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE reports ADD COLUMN repeats INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reports ADD COLUMN last_timestamp BIGINT NOT NULL DEFAULT 0;
+UPDATE reports SET last_timestamp = timestamp;
+CREATE INDEX idx_reports_last_timestamp ON reports (last_timestamp);
+
+-- Idempotency keys of stored reports, so a retried report isn't stored twice.
+-- Keys go with their report when it is pruned.
+CREATE TABLE report_keys (
+    tenant    TEXT    NOT NULL,
+    hostname  TEXT    NOT NULL,
+    key       TEXT    NOT NULL,
+    report_id BIGINT  NOT NULL REFERENCES reports (id) ON DELETE CASCADE,
+    PRIMARY KEY (tenant, hostname, key)
+);
+
+CREATE INDEX idx_report_keys_report_id ON report_keys (report_id);
@@ -0,0 +1,3 @@
+-- The Ed25519 public key, in base64, a device registered at enrollment to
+-- sign its reports with; empty if it registered none
+ALTER TABLE api_keys ADD COLUMN signing_key TEXT NOT NULL DEFAULT '';
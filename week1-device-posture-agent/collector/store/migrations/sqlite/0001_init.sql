@@ -0,0 +1,30 @@
+CREATE TABLE reports (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    hostname     TEXT    NOT NULL,
+    ip           TEXT    NOT NULL,
+    status       TEXT    NOT NULL,
+    score        INTEGER NOT NULL,
+    disk_usage   REAL    NOT NULL,
+    cpu_usage    REAL    NOT NULL,
+    memory_usage REAL    NOT NULL,
+    timestamp    INTEGER NOT NULL, -- agent collection time, unix nanoseconds
+    received_at  INTEGER NOT NULL, -- collector receive time, unix nanoseconds
+    payload      TEXT    NOT NULL  -- full DeviceStatus JSON
+);
+
+CREATE INDEX idx_reports_hostname_timestamp ON reports (hostname, timestamp);
+CREATE INDEX idx_reports_timestamp ON reports (timestamp);
+CREATE INDEX idx_reports_status ON reports (status);
+
+CREATE TABLE devices (
+    hostname       TEXT PRIMARY KEY,
+    ip             TEXT    NOT NULL,
+    status         TEXT    NOT NULL,
+    score          INTEGER NOT NULL,
+    failing_checks TEXT    NOT NULL DEFAULT '[]',
+    last_seen      INTEGER NOT NULL,
+    last_report_id INTEGER NOT NULL,
+    report_count   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_devices_last_seen ON devices (last_seen);
@@ -0,0 +1,20 @@
+-- Timestamps are unix nanoseconds; secrets are stored as SHA-256 hashes
+CREATE TABLE enrollment_tokens (
+    hash       TEXT PRIMARY KEY,
+    id         TEXT    NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    used_at    INTEGER,
+    used_by    TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE TABLE api_keys (
+    hash       TEXT PRIMARY KEY,
+    id         TEXT    NOT NULL,
+    hostname   TEXT    NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER,
+    revoked_at INTEGER
+);
+
+CREATE INDEX idx_api_keys_hostname ON api_keys (hostname);
@@ -0,0 +1,20 @@
+-- Hourly per-device summaries kept after raw reports are pruned.
+-- bucket is the start of the hour in unix nanoseconds.
+CREATE TABLE report_rollups (
+    hostname    TEXT    NOT NULL,
+    bucket      INTEGER NOT NULL,
+    reports     INTEGER NOT NULL,
+    unhealthy   INTEGER NOT NULL,
+    degraded    INTEGER NOT NULL,
+    avg_disk    REAL    NOT NULL,
+    max_disk    REAL    NOT NULL,
+    avg_cpu     REAL    NOT NULL,
+    max_cpu     REAL    NOT NULL,
+    avg_memory  REAL    NOT NULL,
+    max_memory  REAL    NOT NULL,
+    avg_score   REAL    NOT NULL,
+    min_score   INTEGER NOT NULL,
+    PRIMARY KEY (hostname, bucket)
+);
+
+CREATE INDEX idx_report_rollups_bucket ON report_rollups (bucket);
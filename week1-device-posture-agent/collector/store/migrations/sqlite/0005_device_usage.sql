@@ -0,0 +1,9 @@
+-- Latest resource usage per device, for fleet summaries
+ALTER TABLE devices ADD COLUMN disk_usage REAL NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN cpu_usage REAL NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN memory_usage REAL NOT NULL DEFAULT 0;
+
+UPDATE devices SET
+    disk_usage = COALESCE((SELECT disk_usage FROM reports WHERE reports.id = devices.last_report_id), 0),
+    cpu_usage = COALESCE((SELECT cpu_usage FROM reports WHERE reports.id = devices.last_report_id), 0),
+    memory_usage = COALESCE((SELECT memory_usage FROM reports WHERE reports.id = devices.last_report_id), 0);
@@ -0,0 +1,78 @@
+-- Every record belongs to a tenant; existing data moves to the default one
+CREATE TABLE tenants (
+    id             TEXT PRIMARY KEY,
+    name           TEXT    NOT NULL,
+    admin_key_hash TEXT    NOT NULL DEFAULT '', -- SHA-256 of the tenant admin key
+    created_at     INTEGER NOT NULL
+);
+
+CREATE INDEX idx_tenants_admin_key_hash ON tenants (admin_key_hash);
+
+INSERT INTO tenants (id, name, created_at)
+VALUES ('default', 'Default', CAST(strftime('%s', 'now') AS INTEGER) * 1000000000);
+
+ALTER TABLE reports ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX idx_reports_tenant_hostname_timestamp ON reports (tenant, hostname, timestamp);
+
+ALTER TABLE enrollment_tokens ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+DROP INDEX idx_api_keys_hostname;
+CREATE INDEX idx_api_keys_tenant_hostname ON api_keys (tenant, hostname);
+
+-- Hostnames are unique per tenant, so the devices and rollups keys gain the
+-- tenant. SQLite can't alter a primary key; the tables are rebuilt.
+CREATE TABLE devices_new (
+    tenant         TEXT    NOT NULL DEFAULT 'default',
+    hostname       TEXT    NOT NULL,
+    ip             TEXT    NOT NULL,
+    status         TEXT    NOT NULL,
+    score          INTEGER NOT NULL,
+    failing_checks TEXT    NOT NULL DEFAULT '[]',
+    last_seen      INTEGER NOT NULL,
+    last_report_id INTEGER NOT NULL,
+    report_count   INTEGER NOT NULL DEFAULT 0,
+    tags           TEXT    NOT NULL DEFAULT '{}',
+    disk_usage     REAL    NOT NULL DEFAULT 0,
+    cpu_usage      REAL    NOT NULL DEFAULT 0,
+    memory_usage   REAL    NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant, hostname)
+);
+
+INSERT INTO devices_new (hostname, ip, status, score, failing_checks, last_seen, last_report_id,
+    report_count, tags, disk_usage, cpu_usage, memory_usage)
+SELECT hostname, ip, status, score, failing_checks, last_seen, last_report_id,
+    report_count, tags, disk_usage, cpu_usage, memory_usage
+FROM devices;
+
+DROP TABLE devices;
+ALTER TABLE devices_new RENAME TO devices;
+CREATE INDEX idx_devices_last_seen ON devices (last_seen);
+
+CREATE TABLE report_rollups_new (
+    tenant      TEXT    NOT NULL DEFAULT 'default',
+    hostname    TEXT    NOT NULL,
+    bucket      INTEGER NOT NULL,
+    reports     INTEGER NOT NULL,
+    unhealthy   INTEGER NOT NULL,
+    degraded    INTEGER NOT NULL,
+    avg_disk    REAL    NOT NULL,
+    max_disk    REAL    NOT NULL,
+    avg_cpu     REAL    NOT NULL,
+    max_cpu     REAL    NOT NULL,
+    avg_memory  REAL    NOT NULL,
+    max_memory  REAL    NOT NULL,
+    avg_score   REAL    NOT NULL,
+    min_score   INTEGER NOT NULL,
+    PRIMARY KEY (tenant, hostname, bucket)
+);
+
+INSERT INTO report_rollups_new (hostname, bucket, reports, unhealthy, degraded, avg_disk, max_disk,
+    avg_cpu, max_cpu, avg_memory, max_memory, avg_score, min_score)
+SELECT hostname, bucket, reports, unhealthy, degraded, avg_disk, max_disk,
+    avg_cpu, max_cpu, avg_memory, max_memory, avg_score, min_score
+FROM report_rollups;
+
+DROP TABLE report_rollups;
+ALTER TABLE report_rollups_new RENAME TO report_rollups;
+CREATE INDEX idx_report_rollups_bucket ON report_rollups (bucket);
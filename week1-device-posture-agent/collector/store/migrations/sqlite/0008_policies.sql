@@ -0,0 +1,15 @@
+-- Each tenant's server-side posture policy; version counts every change
+CREATE TABLE policies (
+    tenant     TEXT PRIMARY KEY,
+    document   TEXT    NOT NULL,
+    version    INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+-- The collector's own verdict next to the agent's; empty when no policy applied
+ALTER TABLE reports ADD COLUMN server_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE reports ADD COLUMN server_verdict TEXT;
+CREATE INDEX idx_reports_server_status ON reports (server_status);
+
+ALTER TABLE devices ADD COLUMN server_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN server_score INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- GET /posture looks devices up by the address they last reported from
+CREATE INDEX idx_devices_tenant_ip ON devices (tenant, ip);
@@ -0,0 +1,6 @@
+-- The audit log. Each event is kept as the JSON it was hashed as; seq
+-- numbers the hash chain, which every tenant's events share.
+CREATE TABLE audit_events (
+    seq   INTEGER PRIMARY KEY,
+    event TEXT NOT NULL
+);
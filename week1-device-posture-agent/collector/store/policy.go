@@ -0,0 +1,32 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Policy is a tenant's server-side posture policy. The collector evaluates
+// every report against it; see package policy for the document format.
+type Policy struct {
+	Tenant    string          `json:"tenant"`
+	Version   int             `json:"version"` // incremented on every change
+	Document  json.RawMessage `json:"policy"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Policies stores one posture policy per tenant
+type Policies interface {
+	// GetPolicy returns the policy of ctx's tenant; ErrNotFound if it has none
+	GetPolicy(ctx context.Context) (Policy, error)
+	// SetPolicy replaces the policy of ctx's tenant and bumps its version
+	SetPolicy(ctx context.Context, document json.RawMessage, at time.Time) (Policy, error)
+	// DeletePolicy removes the policy of ctx's tenant; ErrNotFound if none
+	DeletePolicy(ctx context.Context) error
+}
+
+// policyMismatch reports whether the collector's verdict disagrees with the
+// status the agent reported
+func policyMismatch(agentStatus, serverStatus string) bool {
+	return serverStatus != "" && serverStatus != agentStatus
+}
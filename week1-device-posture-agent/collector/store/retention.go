@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// RollupInterval is the width of one rollup bucket
+const RollupInterval = time.Hour
+
+// Rollup summarises one device's reports over one hour. Rollups outlive the
+// raw reports so long-range trends survive pruning.
+type Rollup struct {
+	Tenant    string    `json:"tenant"`
+	Hostname  string    `json:"hostname"`
+	Bucket    time.Time `json:"bucket"` // start of the hour
+	Reports   int64     `json:"reports"`
+	Unhealthy int64     `json:"unhealthy"`
+	Degraded  int64     `json:"degraded"`
+	AvgDisk   float64   `json:"avg_disk_usage"`
+	MaxDisk   float64   `json:"max_disk_usage"`
+	AvgCPU    float64   `json:"avg_cpu_usage"`
+	MaxCPU    float64   `json:"max_cpu_usage"`
+	AvgMemory float64   `json:"avg_memory_usage"`
+	MaxMemory float64   `json:"max_memory_usage"`
+	AvgScore  float64   `json:"avg_score"`
+	MinScore  int       `json:"min_score"`
+}
+
+// Retention rolls raw reports up into hourly summaries and prunes old data.
+// Reports are bucketed by their agent timestamp.
+type Retention interface {
+	// RollupReports recomputes the rollups of every hour in [from, to) that
+	// still has raw reports, returning how many rollups were written
+	RollupReports(ctx context.Context, from, to time.Time) (int64, error)
+	// ListRollups returns a device's rollups in [since, until), oldest first;
+	// zero times leave that end open
+	ListRollups(ctx context.Context, hostname string, since, until time.Time) ([]Rollup, error)
+	// PruneReports deletes reports whose timestamps, and those of any
+	// repeats folded into them, are before the cutoff
+	PruneReports(ctx context.Context, before time.Time) (int64, error)
+	// PruneRollups deletes rollups of hours starting before the cutoff
+	PruneRollups(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,519 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/sqlstore"
+
+	"device-posture-collector/policy"
+	"device-posture-collector/report"
+)
+
+// sqlStore implements Store over database/sql. Queries are written with
+// "?" placeholders and rebound for dialects that number them.
+type sqlStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// rebind rewrites "?" placeholders as $1, $2, ... for PostgreSQL
+func (s *sqlStore) rebind(query string) string {
+	return sqlstore.Rebind(s.dialect, query)
+}
+
+// scope restricts a query to ctx's tenant; unscoped queries span every tenant
+func scope(ctx context.Context, where []string, args []any) ([]string, []any) {
+	if tenant, ok := TenantScope(ctx); ok {
+		return append(where, "tenant = ?"), append(args, tenant)
+	}
+	return where, args
+}
+
+// whereClause joins conditions into a WHERE clause, or nothing
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(where, " AND ")
+}
+
+func (s *sqlStore) SaveReport(ctx context.Context, status *report.DeviceStatus, verdict *policy.Verdict, receivedAt time.Time) (StoredReport, error) {
+	stored, err := s.SaveReports(ctx, []NewReport{{status, verdict, receivedAt}})
+	if err != nil {
+		return StoredReport{}, err
+	}
+	return stored[0], nil
+}
+
+func (s *sqlStore) SaveReports(ctx context.Context, reports []NewReport) ([]StoredReport, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	out := make([]StoredReport, 0, len(reports))
+	for _, r := range reports {
+		stored, err := s.saveReport(ctx, tx, r.Status, r.Verdict, r.ReceivedAt)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, stored)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// saveReport stores one report and updates its device within tx
+func (s *sqlStore) saveReport(ctx context.Context, tx *sql.Tx, status *report.DeviceStatus, verdict *policy.Verdict, receivedAt time.Time) (StoredReport, error) {
+	tenant := TenantOf(ctx)
+	key := status.IdempotencyKey
+	if key != "" {
+		row := tx.QueryRowContext(ctx, s.rebind(`
+			SELECT `+reportColumns+` FROM reports
+			WHERE id = (SELECT report_id FROM report_keys WHERE tenant = ? AND hostname = ? AND key = ?)`),
+			tenant, status.Hostname, key)
+		stored, err := scanReport(row)
+		if err == nil {
+			stored.Dedup = DedupReplay
+			return stored, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return StoredReport{}, fmt.Errorf("look up idempotency key: %w", err)
+		}
+	}
+
+	hash := contentHash(status, verdict)
+	stored, err := s.repeatReport(ctx, tx, tenant, status, hash, receivedAt)
+	if errors.Is(err, ErrNotFound) {
+		stored, err = s.insertReport(ctx, tx, tenant, status, verdict, hash, receivedAt)
+	}
+	if err != nil {
+		return StoredReport{}, err
+	}
+
+	if key != "" {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO report_keys (tenant, hostname, key, report_id) VALUES (?, ?, ?, ?)`),
+			tenant, status.Hostname, key, stored.ID)
+		if err != nil {
+			return StoredReport{}, fmt.Errorf("record idempotency key: %w", err)
+		}
+	}
+	return stored, nil
+}
+
+// repeatReport folds a report into its device's last report when the two
+// have the same content hash and the report is not older. It returns
+// ErrNotFound otherwise.
+func (s *sqlStore) repeatReport(ctx context.Context, tx *sql.Tx, tenant string, status *report.DeviceStatus, hash string, receivedAt time.Time) (StoredReport, error) {
+	timestamp := status.Timestamp.UnixNano()
+	var id int64
+	err := tx.QueryRowContext(ctx, s.rebind(`
+		SELECT r.id FROM devices d JOIN reports r ON r.id = d.last_report_id
+		WHERE d.tenant = ? AND d.hostname = ? AND r.content_hash = ? AND r.last_timestamp <= ?`),
+		tenant, status.Hostname, hash, timestamp).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return StoredReport{}, ErrNotFound
+	}
+	if err != nil {
+		return StoredReport{}, fmt.Errorf("load last report: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`UPDATE reports SET repeats = repeats + 1, last_timestamp = ? WHERE id = ?`),
+		timestamp, id); err != nil {
+		return StoredReport{}, fmt.Errorf("repeat report: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`
+		UPDATE devices SET last_seen = ?, report_count = report_count + 1
+		WHERE tenant = ? AND hostname = ?`), receivedAt.UnixNano(), tenant, status.Hostname); err != nil {
+		return StoredReport{}, fmt.Errorf("update device: %w", err)
+	}
+
+	stored, err := scanReport(tx.QueryRowContext(ctx, s.rebind(`SELECT `+reportColumns+` FROM reports WHERE id = ?`), id))
+	if err != nil {
+		return StoredReport{}, fmt.Errorf("load repeated report: %w", err)
+	}
+	stored.Dedup = DedupRepeat
+	return stored, nil
+}
+
+// insertReport adds a report row and makes it its device's latest
+func (s *sqlStore) insertReport(ctx context.Context, tx *sql.Tx, tenant string, status *report.DeviceStatus, verdict *policy.Verdict, hash string, receivedAt time.Time) (StoredReport, error) {
+	payload, err := json.Marshal(status)
+	if err != nil {
+		return StoredReport{}, fmt.Errorf("encode report: %w", err)
+	}
+	var serverStatus string
+	var serverScore int
+	var serverVerdict sql.NullString
+	if verdict != nil {
+		encoded, err := json.Marshal(verdict)
+		if err != nil {
+			return StoredReport{}, fmt.Errorf("encode verdict: %w", err)
+		}
+		serverStatus, serverScore = verdict.Status, verdict.Score
+		serverVerdict = sql.NullString{String: string(encoded), Valid: true}
+	}
+	failing, err := json.Marshal(nonNil(status.FailingChecks))
+	if err != nil {
+		return StoredReport{}, fmt.Errorf("encode failing checks: %w", err)
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, s.rebind(`
+		INSERT INTO reports (tenant, hostname, ip, status, score, disk_usage, cpu_usage, memory_usage, timestamp, received_at, payload,
+			server_status, server_verdict, content_hash, last_timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`),
+		tenant, status.Hostname, status.IP, status.Status, status.Score,
+		status.DiskUsage, status.CPUUsage, status.MemoryUsage,
+		status.Timestamp.UnixNano(), receivedAt.UnixNano(), string(payload),
+		serverStatus, serverVerdict, hash, status.Timestamp.UnixNano()).Scan(&id)
+	if err != nil {
+		return StoredReport{}, fmt.Errorf("insert report: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`
+		INSERT INTO devices (tenant, hostname, ip, status, score, server_status, server_score, failing_checks,
+			disk_usage, cpu_usage, memory_usage, last_seen, last_report_id, report_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT (tenant, hostname) DO UPDATE SET
+			ip = excluded.ip,
+			status = excluded.status,
+			score = excluded.score,
+			server_status = excluded.server_status,
+			server_score = excluded.server_score,
+			failing_checks = excluded.failing_checks,
+			disk_usage = excluded.disk_usage,
+			cpu_usage = excluded.cpu_usage,
+			memory_usage = excluded.memory_usage,
+			last_seen = excluded.last_seen,
+			last_report_id = excluded.last_report_id,
+			report_count = devices.report_count + 1`),
+		tenant, status.Hostname, status.IP, status.Status, status.Score, serverStatus, serverScore, string(failing),
+		status.DiskUsage, status.CPUUsage, status.MemoryUsage, receivedAt.UnixNano(), id)
+	if err != nil {
+		return StoredReport{}, fmt.Errorf("upsert device: %w", err)
+	}
+
+	return StoredReport{
+		ID:             id,
+		Tenant:         tenant,
+		ReceivedAt:     receivedAt,
+		DeviceStatus:   *status,
+		Server:         verdict,
+		PolicyMismatch: policyMismatch(status.Status, serverStatus),
+	}, nil
+}
+
+func (s *sqlStore) ListReports(ctx context.Context, filter Filter) ([]StoredReport, error) {
+	where, args := scope(ctx, nil, nil)
+	if filter.Hostname != "" {
+		where = append(where, "hostname = ?")
+		args = append(args, filter.Hostname)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Mismatch {
+		where = append(where, "server_status <> ''", "server_status <> status")
+	}
+
+	if !filter.Since.IsZero() {
+		where = append(where, "last_timestamp >= ?")
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, filter.Until.UnixNano())
+	}
+	order := "DESC"
+	if filter.Oldest {
+		order = "ASC"
+	}
+	if filter.Cursor > 0 {
+		if filter.Oldest {
+			where = append(where, "id > ?")
+		} else {
+			where = append(where, "id < ?")
+		}
+		args = append(args, filter.Cursor)
+	}
+
+	query := `SELECT ` + reportColumns + ` FROM reports` + whereClause(where) + " ORDER BY id " + order
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("list reports: %w", err)
+	}
+	defer rows.Close()
+
+	var out []StoredReport
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqlStore) ReportSeries(ctx context.Context, filter Filter, step time.Duration) ([]SeriesPoint, error) {
+	where, args := scope(ctx, nil, nil)
+	if filter.Hostname != "" {
+		where = append(where, "hostname = ?")
+		args = append(args, filter.Hostname)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Mismatch {
+		where = append(where, "server_status <> ''", "server_status <> status")
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, filter.Until.UnixNano())
+	}
+
+	// Grouping by position keeps PostgreSQL from treating the bucket
+	// expression's two sets of placeholders as different expressions
+	rows, err := s.db.QueryContext(ctx, s.rebind(`
+		SELECT (timestamp / ?) * ?, SUM(1 + repeats), COUNT(DISTINCT tenant || '/' || hostname),
+			SUM(CASE WHEN status = ? THEN 1 + repeats ELSE 0 END),
+			SUM(CASE WHEN status = ? THEN 1 + repeats ELSE 0 END),
+			AVG(disk_usage), AVG(cpu_usage), AVG(memory_usage), CAST(AVG(score) AS DOUBLE PRECISION)
+		FROM reports`+whereClause(where)+`
+		GROUP BY 1 ORDER BY 1`),
+		append([]any{int64(step), int64(step), report.StatusUnhealthy, report.StatusDegraded}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("report series: %w", err)
+	}
+	defer rows.Close()
+
+	var out []SeriesPoint
+	for rows.Next() {
+		var p SeriesPoint
+		var bucket int64
+		if err := rows.Scan(&bucket, &p.Reports, &p.Devices, &p.Unhealthy, &p.Degraded,
+			&p.AvgDisk, &p.AvgCPU, &p.AvgMemory, &p.AvgScore); err != nil {
+			return nil, err
+		}
+		p.Bucket = time.Unix(0, bucket).UTC()
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqlStore) ListDevices(ctx context.Context) ([]Device, error) {
+	where, args := scope(ctx, nil, nil)
+	rows, err := s.db.QueryContext(ctx, s.rebind(`
+		SELECT `+deviceColumns+` FROM devices`+whereClause(where)+` ORDER BY hostname, tenant`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("list devices: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Device
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqlStore) GetDevice(ctx context.Context, hostname string) (Device, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`
+		SELECT `+deviceColumns+` FROM devices WHERE tenant = ? AND hostname = ?`), TenantOf(ctx), hostname)
+	d, err := scanDevice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Device{}, ErrNotFound
+	}
+	return d, err
+}
+
+func (s *sqlStore) GetDeviceByIP(ctx context.Context, ip string) (Device, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`
+		SELECT `+deviceColumns+` FROM devices WHERE tenant = ? AND ip = ? ORDER BY last_seen DESC LIMIT 1`), TenantOf(ctx), ip)
+	d, err := scanDevice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Device{}, ErrNotFound
+	}
+	return d, err
+}
+
+func (s *sqlStore) SetTags(ctx context.Context, hostname string, tags map[string]string) (Device, error) {
+	encoded, err := json.Marshal(nonNilTags(tags))
+	if err != nil {
+		return Device{}, fmt.Errorf("encode tags: %w", err)
+	}
+	res, err := s.db.ExecContext(ctx, s.rebind(`UPDATE devices SET tags = ? WHERE tenant = ? AND hostname = ?`), string(encoded), TenantOf(ctx), hostname)
+	if err != nil {
+		return Device{}, fmt.Errorf("update tags: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Device{}, ErrNotFound
+	}
+	return s.GetDevice(ctx, hostname)
+}
+
+func (s *sqlStore) RegisterDevice(ctx context.Context, hostname string, tags map[string]string, at time.Time) (Device, error) {
+	encoded, err := json.Marshal(nonNilTags(tags))
+	if err != nil {
+		return Device{}, fmt.Errorf("encode tags: %w", err)
+	}
+	res, err := s.db.ExecContext(ctx, s.rebind(`
+		INSERT INTO devices (tenant, hostname, ip, status, score, tags, last_seen, last_report_id, report_count)
+		VALUES (?, ?, '', ?, 0, ?, ?, 0, 0)
+		ON CONFLICT (tenant, hostname) DO NOTHING`),
+		TenantOf(ctx), hostname, StatusEnrolled, string(encoded), at.UnixNano())
+	if err != nil {
+		return Device{}, fmt.Errorf("register device: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 1 || len(tags) == 0 {
+		return s.GetDevice(ctx, hostname)
+	}
+	device, err := s.GetDevice(ctx, hostname)
+	if err != nil {
+		return Device{}, err
+	}
+	return s.SetTags(ctx, hostname, mergeTags(device.Tags, tags))
+}
+
+func (s *sqlStore) DeleteReports(ctx context.Context) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	where, args := scope(ctx, nil, nil)
+	res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM reports`+whereClause(where)), args...)
+	if err != nil {
+		return 0, fmt.Errorf("delete reports: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM devices`+whereClause(where)), args...); err != nil {
+		return 0, fmt.Errorf("delete devices: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM report_rollups`+whereClause(where)), args...); err != nil {
+		return 0, fmt.Errorf("delete rollups: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, tx.Commit()
+}
+
+func (s *sqlStore) Close() error { return s.db.Close() }
+
+// deviceColumns are read by scanDevice, in order
+const deviceColumns = `tenant, hostname, ip, status, score, server_status, server_score, failing_checks, tags,
+	disk_usage, cpu_usage, memory_usage, last_seen, last_report_id, report_count`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// reportColumns are read by scanReport, in order
+const reportColumns = `id, tenant, received_at, payload, server_verdict, repeats, last_timestamp`
+
+func scanReport(row rowScanner) (StoredReport, error) {
+	var r StoredReport
+	var receivedAt, lastTimestamp int64
+	var payload string
+	var verdict sql.NullString
+	if err := row.Scan(&r.ID, &r.Tenant, &receivedAt, &payload, &verdict, &r.Repeats, &lastTimestamp); err != nil {
+		return StoredReport{}, err
+	}
+	if err := json.Unmarshal([]byte(payload), &r.DeviceStatus); err != nil {
+		return StoredReport{}, fmt.Errorf("decode report %d: %w", r.ID, err)
+	}
+	if verdict.Valid {
+		r.Server = new(policy.Verdict)
+		if err := json.Unmarshal([]byte(verdict.String), r.Server); err != nil {
+			return StoredReport{}, fmt.Errorf("decode verdict of report %d: %w", r.ID, err)
+		}
+		r.PolicyMismatch = policyMismatch(r.Status, r.Server.Status)
+	}
+	if r.Repeats > 0 {
+		until := time.Unix(0, lastTimestamp).UTC()
+		r.RepeatedUntil = &until
+	}
+	r.ReceivedAt = time.Unix(0, receivedAt).UTC()
+	return r, nil
+}
+
+func scanDevice(row rowScanner) (Device, error) {
+	var d Device
+	var failing, tags string
+	var lastSeen int64
+	var serverScore int
+	if err := row.Scan(&d.Tenant, &d.Hostname, &d.IP, &d.Status, &d.Score, &d.ServerStatus, &serverScore, &failing, &tags,
+		&d.DiskUsage, &d.CPUUsage, &d.MemoryUsage, &lastSeen, &d.LastReportID, &d.ReportCount); err != nil {
+		return Device{}, err
+	}
+	if err := json.Unmarshal([]byte(failing), &d.FailingChecks); err != nil {
+		return Device{}, fmt.Errorf("decode failing checks for %s: %w", d.Hostname, err)
+	}
+	if len(d.FailingChecks) == 0 {
+		d.FailingChecks = nil
+	}
+	if err := json.Unmarshal([]byte(tags), &d.Tags); err != nil {
+		return Device{}, fmt.Errorf("decode tags for %s: %w", d.Hostname, err)
+	}
+	if len(d.Tags) == 0 {
+		d.Tags = nil
+	}
+	if d.ServerStatus != "" {
+		d.ServerScore = &serverScore
+		d.PolicyMismatch = policyMismatch(d.Status, d.ServerStatus)
+	}
+	d.LastSeen = time.Unix(0, lastSeen).UTC()
+	return d, nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// mergeTags returns base with overrides applied
+func mergeTags(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+func nonNilTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return map[string]string{}
+	}
+	return tags
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nisatyap/shared/audit"
+)
+
+// auditAttempts is how many times AppendAudit tries to chain an event when
+// other collectors on the same database append theirs at the same time
+const auditAttempts = 5
+
+func (s *sqlStore) AppendAudit(ctx context.Context, e audit.Event) (audit.Event, error) {
+	var err error
+	for attempt := 0; attempt < auditAttempts; attempt++ {
+		var stored audit.Event
+		if stored, err = s.appendAudit(ctx, e); err == nil {
+			return stored, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return audit.Event{}, fmt.Errorf("append audit event: %w", err)
+}
+
+// appendAudit chains e to the last event in a transaction, which fails if
+// another collector took its number first
+func (s *sqlStore) appendAudit(ctx context.Context, e audit.Event) (audit.Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return audit.Event{}, err
+	}
+	defer tx.Rollback()
+
+	var last audit.Event
+	var data string
+	err = tx.QueryRowContext(ctx, `SELECT event FROM audit_events ORDER BY seq DESC LIMIT 1`).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return audit.Event{}, err
+	default:
+		if err := json.Unmarshal([]byte(data), &last); err != nil {
+			return audit.Event{}, fmt.Errorf("last audit event: %w", err)
+		}
+	}
+	e = audit.Chain(last, e)
+	event, err := json.Marshal(e)
+	if err != nil {
+		return audit.Event{}, err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO audit_events (seq, event) VALUES (?, ?)`), e.Seq, string(event)); err != nil {
+		return audit.Event{}, err
+	}
+	return e, tx.Commit()
+}
+
+func (s *sqlStore) ScanAudit(ctx context.Context, fn func(audit.Event) error) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT event FROM audit_events ORDER BY seq`)
+	if err != nil {
+		return fmt.Errorf("scan audit events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return fmt.Errorf("scan audit events: %w", err)
+		}
+		var e audit.Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return fmt.Errorf("audit event: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
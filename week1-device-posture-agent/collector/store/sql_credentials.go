@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *sqlStore) CreateEnrollmentToken(ctx context.Context, t EnrollmentToken) error {
+	tags, err := json.Marshal(nonNilTags(t.Tags))
+	if err != nil {
+		return fmt.Errorf("encode tags: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, s.rebind(`
+		INSERT INTO enrollment_tokens (hash, id, tenant, tags, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`),
+		t.Hash, t.ID, recordTenant(ctx, t.Tenant), string(tags), t.CreatedAt.UnixNano(), t.ExpiresAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("create enrollment token: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) ConsumeEnrollmentToken(ctx context.Context, hash, hostname string, now time.Time) (EnrollmentToken, error) {
+	// The conditional update makes concurrent enrollments race safely: only
+	// one of them changes the row
+	res, err := s.db.ExecContext(ctx, s.rebind(`
+		UPDATE enrollment_tokens SET used_at = ?, used_by = ?
+		WHERE hash = ? AND used_at IS NULL AND expires_at > ?`),
+		now.UnixNano(), hostname, hash, now.UnixNano())
+	if err != nil {
+		return EnrollmentToken{}, fmt.Errorf("consume enrollment token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return EnrollmentToken{}, ErrNotFound
+	}
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+tokenColumns+` FROM enrollment_tokens WHERE hash = ?`), hash)
+	return scanToken(row)
+}
+
+func (s *sqlStore) ListEnrollmentTokens(ctx context.Context) ([]EnrollmentToken, error) {
+	where, args := scope(ctx, nil, nil)
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+tokenColumns+` FROM enrollment_tokens`+whereClause(where)+` ORDER BY created_at`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("list enrollment tokens: %w", err)
+	}
+	defer rows.Close()
+	var out []EnrollmentToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqlStore) CreateAPIKey(ctx context.Context, k APIKey) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`
+		INSERT INTO api_keys (hash, id, tenant, hostname, signing_key, created_at, expires_at, revoked_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		k.Hash, k.ID, recordTenant(ctx, k.Tenant), k.Hostname, k.SigningKey, k.CreatedAt.UnixNano(), nullTime(k.ExpiresAt), nullTime(k.RevokedAt))
+	if err != nil {
+		return fmt.Errorf("create api key: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+keyColumns+` FROM api_keys WHERE hash = ?`), hash)
+	k, err := scanKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrNotFound
+	}
+	return k, err
+}
+
+func (s *sqlStore) ListAPIKeys(ctx context.Context, hostname string) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+keyColumns+` FROM api_keys WHERE tenant = ? AND hostname = ? ORDER BY created_at`), TenantOf(ctx), hostname)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer rows.Close()
+	var out []APIKey
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqlStore) ExpireAPIKey(ctx context.Context, hash string, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(`UPDATE api_keys SET expires_at = ? WHERE hash = ?`), at.UnixNano(), hash)
+	if err != nil {
+		return fmt.Errorf("expire api key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) RevokeAPIKeys(ctx context.Context, hostname string, at time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.rebind(`
+		UPDATE api_keys SET revoked_at = ? WHERE tenant = ? AND hostname = ? AND revoked_at IS NULL`),
+		at.UnixNano(), TenantOf(ctx), hostname)
+	if err != nil {
+		return 0, fmt.Errorf("revoke api keys: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+const (
+	tokenColumns = `hash, id, tenant, tags, created_at, expires_at, used_at, used_by`
+	keyColumns   = `hash, id, tenant, hostname, signing_key, created_at, expires_at, revoked_at`
+)
+
+func scanToken(row rowScanner) (EnrollmentToken, error) {
+	var t EnrollmentToken
+	var tags string
+	var created, expires int64
+	var used sql.NullInt64
+	if err := row.Scan(&t.Hash, &t.ID, &t.Tenant, &tags, &created, &expires, &used, &t.UsedBy); err != nil {
+		return EnrollmentToken{}, err
+	}
+	if err := json.Unmarshal([]byte(tags), &t.Tags); err != nil {
+		return EnrollmentToken{}, fmt.Errorf("decode tags of token %s: %w", t.ID, err)
+	}
+	if len(t.Tags) == 0 {
+		t.Tags = nil
+	}
+	t.CreatedAt = time.Unix(0, created).UTC()
+	t.ExpiresAt = time.Unix(0, expires).UTC()
+	t.UsedAt = timePtr(used)
+	return t, nil
+}
+
+func scanKey(row rowScanner) (APIKey, error) {
+	var k APIKey
+	var created int64
+	var expires, revoked sql.NullInt64
+	if err := row.Scan(&k.Hash, &k.ID, &k.Tenant, &k.Hostname, &k.SigningKey, &created, &expires, &revoked); err != nil {
+		return APIKey{}, err
+	}
+	k.CreatedAt = time.Unix(0, created).UTC()
+	k.ExpiresAt = timePtr(expires)
+	k.RevokedAt = timePtr(revoked)
+	return k, nil
+}
+
+func nullTime(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func timePtr(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(0, v.Int64).UTC()
+	return &t
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *sqlStore) GetPolicy(ctx context.Context) (Policy, error) {
+	var p Policy
+	var document string
+	var updated int64
+	err := s.db.QueryRowContext(ctx, s.rebind(`
+		SELECT tenant, document, version, updated_at FROM policies WHERE tenant = ?`), TenantOf(ctx)).
+		Scan(&p.Tenant, &document, &p.Version, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Policy{}, ErrNotFound
+	}
+	if err != nil {
+		return Policy{}, fmt.Errorf("get policy: %w", err)
+	}
+	p.Document = json.RawMessage(document)
+	p.UpdatedAt = time.Unix(0, updated).UTC()
+	return p, nil
+}
+
+func (s *sqlStore) SetPolicy(ctx context.Context, document json.RawMessage, at time.Time) (Policy, error) {
+	_, err := s.db.ExecContext(ctx, s.rebind(`
+		INSERT INTO policies (tenant, document, version, updated_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (tenant) DO UPDATE SET
+			document = excluded.document,
+			version = policies.version + 1,
+			updated_at = excluded.updated_at`),
+		TenantOf(ctx), string(document), at.UnixNano())
+	if err != nil {
+		return Policy{}, fmt.Errorf("set policy: %w", err)
+	}
+	return s.GetPolicy(ctx)
+}
+
+func (s *sqlStore) DeletePolicy(ctx context.Context) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM policies WHERE tenant = ?`), TenantOf(ctx))
+	if err != nil {
+		return fmt.Errorf("delete policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
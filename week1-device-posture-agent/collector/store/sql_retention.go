@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"device-posture-collector/report"
+)
+
+func (s *sqlStore) RollupReports(ctx context.Context, from, to time.Time) (int64, error) {
+	// Integer division truncates the nanosecond timestamp to its hour. The
+	// upsert replaces whole hours, so rerunning over the same range is safe.
+	res, err := s.db.ExecContext(ctx, s.rebind(`
+		INSERT INTO report_rollups (tenant, hostname, bucket, reports, unhealthy, degraded,
+			avg_disk, max_disk, avg_cpu, max_cpu, avg_memory, max_memory, avg_score, min_score)
+		SELECT tenant, hostname, (timestamp / ?) * ?, SUM(1 + repeats),
+			SUM(CASE WHEN status = ? THEN 1 + repeats ELSE 0 END),
+			SUM(CASE WHEN status = ? THEN 1 + repeats ELSE 0 END),
+			AVG(disk_usage), MAX(disk_usage), AVG(cpu_usage), MAX(cpu_usage),
+			AVG(memory_usage), MAX(memory_usage), CAST(AVG(score) AS DOUBLE PRECISION), MIN(score)
+		FROM reports
+		WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY tenant, hostname, (timestamp / ?) * ?
+		ON CONFLICT (tenant, hostname, bucket) DO UPDATE SET
+			reports = excluded.reports, unhealthy = excluded.unhealthy, degraded = excluded.degraded,
+			avg_disk = excluded.avg_disk, max_disk = excluded.max_disk,
+			avg_cpu = excluded.avg_cpu, max_cpu = excluded.max_cpu,
+			avg_memory = excluded.avg_memory, max_memory = excluded.max_memory,
+			avg_score = excluded.avg_score, min_score = excluded.min_score`),
+		int64(RollupInterval), int64(RollupInterval),
+		report.StatusUnhealthy, report.StatusDegraded,
+		from.UnixNano(), to.UnixNano(),
+		int64(RollupInterval), int64(RollupInterval))
+	if err != nil {
+		return 0, fmt.Errorf("roll up reports: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *sqlStore) ListRollups(ctx context.Context, hostname string, since, until time.Time) ([]Rollup, error) {
+	query := `
+		SELECT tenant, hostname, bucket, reports, unhealthy, degraded, avg_disk, max_disk,
+			avg_cpu, max_cpu, avg_memory, max_memory, avg_score, min_score
+		FROM report_rollups WHERE tenant = ? AND hostname = ?`
+	args := []any{TenantOf(ctx), hostname}
+	if !since.IsZero() {
+		query += ` AND bucket >= ?`
+		args = append(args, since.UnixNano())
+	}
+	if !until.IsZero() {
+		query += ` AND bucket < ?`
+		args = append(args, until.UnixNano())
+	}
+	rows, err := s.db.QueryContext(ctx, s.rebind(query+` ORDER BY bucket`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("list rollups: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Rollup
+	for rows.Next() {
+		var r Rollup
+		var bucket int64
+		if err := rows.Scan(&r.Tenant, &r.Hostname, &bucket, &r.Reports, &r.Unhealthy, &r.Degraded,
+			&r.AvgDisk, &r.MaxDisk, &r.AvgCPU, &r.MaxCPU, &r.AvgMemory, &r.MaxMemory,
+			&r.AvgScore, &r.MinScore); err != nil {
+			return nil, err
+		}
+		r.Bucket = time.Unix(0, bucket).UTC()
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqlStore) PruneReports(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM reports WHERE last_timestamp < ?`), before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("prune reports: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *sqlStore) PruneRollups(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM report_rollups WHERE bucket < ?`), before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("prune rollups: %w", err)
+	}
+	return res.RowsAffected()
+}
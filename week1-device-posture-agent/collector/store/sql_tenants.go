@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *sqlStore) CreateTenant(ctx context.Context, t Tenant) error {
+	// Checking first keeps driver-specific constraint errors out of the way;
+	// a concurrent create still fails on the primary key
+	if _, err := s.GetTenant(ctx, t.ID); err == nil {
+		return ErrExists
+	}
+	_, err := s.db.ExecContext(ctx, s.rebind(`
+		INSERT INTO tenants (id, name, admin_key_hash, created_at) VALUES (?, ?, ?, ?)`),
+		t.ID, t.Name, t.AdminKeyHash, t.CreatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("create tenant: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetTenant(ctx context.Context, id string) (Tenant, error) {
+	return s.getTenant(ctx, `id = ?`, id)
+}
+
+func (s *sqlStore) GetTenantByAdminKey(ctx context.Context, hash string) (Tenant, error) {
+	if hash == "" {
+		return Tenant{}, ErrNotFound
+	}
+	return s.getTenant(ctx, `admin_key_hash = ?`, hash)
+}
+
+func (s *sqlStore) getTenant(ctx context.Context, cond string, arg any) (Tenant, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+tenantColumns+` FROM tenants WHERE `+cond), arg)
+	t, err := scanTenant(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tenant{}, ErrNotFound
+	}
+	return t, err
+}
+
+func (s *sqlStore) ListTenants(ctx context.Context) ([]Tenant, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list tenants: %w", err)
+	}
+	defer rows.Close()
+	var out []Tenant
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqlStore) SetTenantAdminKey(ctx context.Context, id, hash string) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(`UPDATE tenants SET admin_key_hash = ? WHERE id = ?`), hash, id)
+	if err != nil {
+		return fmt.Errorf("set tenant admin key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const tenantColumns = `id, name, admin_key_hash, created_at`
+
+func scanTenant(row rowScanner) (Tenant, error) {
+	var t Tenant
+	var created int64
+	if err := row.Scan(&t.ID, &t.Name, &t.AdminKeyHash, &created); err != nil {
+		return Tenant{}, err
+	}
+	t.CreatedAt = time.Unix(0, created).UTC()
+	return t, nil
+}
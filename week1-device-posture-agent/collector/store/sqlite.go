@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nisatyap/shared/sqlstore"
+)
+
+// SQLite stores reports in a single database file
+type SQLite struct {
+	sqlStore
+}
+
+// OpenSQLite opens (creating if needed) the database at path and applies
+// pending migrations
+func OpenSQLite(ctx context.Context, path string) (*SQLite, error) {
+	steps, err := migrations(sqlstore.SQLite)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sqlstore.OpenSQLite(ctx, path, steps)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLite{sqlStore{db: db, dialect: sqlstore.SQLite}}, nil
+}
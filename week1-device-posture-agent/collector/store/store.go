@@ -0,0 +1,146 @@
+// Package store persists device reports and the per-device summary the
+// collector keeps for each host. Every record belongs to a tenant; see
+// WithTenant for how calls are scoped.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"device-posture-collector/policy"
+	"device-posture-collector/report"
+)
+
+// ErrNotFound is returned when a device has never reported
+var ErrNotFound = errors.New("not found")
+
+// StatusEnrolled is the status of a device that has enrolled but not yet
+// reported
+const StatusEnrolled = "ENROLLED"
+
+// StoredReport is a report as accepted by the collector
+type StoredReport struct {
+	ID         int64     `json:"id"`
+	Tenant     string    `json:"tenant"`
+	ReceivedAt time.Time `json:"received_at"`
+	report.DeviceStatus
+	// Server is the collector's verdict under the tenant's policy; nil when
+	// the tenant had none
+	Server         *policy.Verdict `json:"server_verdict,omitempty"`
+	PolicyMismatch bool            `json:"policy_mismatch,omitempty"` // Server disagrees with Status
+	// Repeats counts identical later reports folded into this one, the
+	// newest of which was taken at RepeatedUntil
+	Repeats       int        `json:"repeats,omitempty"`
+	RepeatedUntil *time.Time `json:"repeated_until,omitempty"`
+	// Dedup tells how SaveReport handled a report it didn't store as a new
+	// row: DedupReplay or DedupRepeat
+	Dedup string `json:"-"`
+
+	contentHash string
+}
+
+// lastTimestamp is the agent timestamp of the newest report r stands for
+func (r *StoredReport) lastTimestamp() time.Time {
+	if r.RepeatedUntil != nil {
+		return *r.RepeatedUntil
+	}
+	return r.Timestamp
+}
+
+// NewReport is one validated report of a batch passed to SaveReports
+type NewReport struct {
+	Status     *report.DeviceStatus
+	Verdict    *policy.Verdict // nil when no policy applied
+	ReceivedAt time.Time
+}
+
+// Device is the latest known state of one host
+type Device struct {
+	Tenant         string            `json:"tenant"`
+	Hostname       string            `json:"hostname"`
+	IP             string            `json:"ip"`
+	Status         string            `json:"status"`
+	Score          int               `json:"score"`
+	ServerStatus   string            `json:"server_status,omitempty"` // collector's verdict, if a policy applied
+	ServerScore    *int              `json:"server_score,omitempty"`
+	PolicyMismatch bool              `json:"policy_mismatch,omitempty"`
+	FailingChecks  []string          `json:"failing_checks,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"` // e.g. ou, site, owner
+	DiskUsage      float64           `json:"disk_usage"`     // from the latest report
+	CPUUsage       float64           `json:"cpu_usage"`
+	MemoryUsage    float64           `json:"memory_usage"`
+	LastSeen       time.Time         `json:"last_seen"`
+	LastReportID   int64             `json:"last_report_id"`
+	ReportCount    int64             `json:"report_count"`
+	Stale          bool              `json:"stale"` // set by the API, not stored
+}
+
+// Filter narrows a report listing; zero values match everything
+type Filter struct {
+	Hostname string
+	Status   string
+	Mismatch bool      // only reports whose server verdict disagrees with the agent
+	Since    time.Time // agent timestamp, or that of the latest repeat, at or after
+	Until    time.Time // agent timestamp before
+	Cursor   int64     // continue after this report ID in listing order
+	Oldest   bool      // list oldest first instead of newest first
+	Limit    int       // 0 means no limit
+}
+
+// SeriesPoint aggregates the reports whose agent timestamps fall into one
+// bucket of a time series
+type SeriesPoint struct {
+	Bucket    time.Time `json:"bucket"` // start of the bucket
+	Reports   int64     `json:"reports"`
+	Devices   int64     `json:"devices"` // distinct hosts that reported
+	Unhealthy int64     `json:"unhealthy"`
+	Degraded  int64     `json:"degraded"`
+	AvgDisk   float64   `json:"avg_disk_usage"`
+	AvgCPU    float64   `json:"avg_cpu_usage"`
+	AvgMemory float64   `json:"avg_memory_usage"`
+	AvgScore  float64   `json:"avg_score"`
+}
+
+// Store is implemented by every storage backend
+type Store interface {
+	// SaveReport stores a validated report, with the collector's verdict on
+	// it if a policy applied, and updates its device record. A report whose
+	// idempotency key was seen before returns the stored report unchanged;
+	// one identical to its device's last report is folded into that report.
+	SaveReport(ctx context.Context, status *report.DeviceStatus, verdict *policy.Verdict, receivedAt time.Time) (StoredReport, error)
+	// SaveReports stores a batch in order, all or nothing
+	SaveReports(ctx context.Context, reports []NewReport) ([]StoredReport, error)
+	ListReports(ctx context.Context, filter Filter) ([]StoredReport, error)
+	// ReportSeries aggregates the reports matching filter into buckets of
+	// step, oldest first, skipping empty buckets. Cursor, Oldest and Limit
+	// are ignored.
+	ReportSeries(ctx context.Context, filter Filter, step time.Duration) ([]SeriesPoint, error)
+	ListDevices(ctx context.Context) ([]Device, error)
+	GetDevice(ctx context.Context, hostname string) (Device, error)
+	// GetDeviceByIP returns the device that most recently reported from ip
+	GetDeviceByIP(ctx context.Context, ip string) (Device, error)
+	// SetTags replaces a device's tags; ErrNotFound if it never reported
+	SetTags(ctx context.Context, hostname string, tags map[string]string) (Device, error)
+	// RegisterDevice records a newly enrolled device as ENROLLED, or merges
+	// tags into the record of one enrolling again
+	RegisterDevice(ctx context.Context, hostname string, tags map[string]string, at time.Time) (Device, error)
+	// DeleteReports removes every report and device, returning the report count
+	DeleteReports(ctx context.Context) (int64, error)
+	Credentials
+	Tenants
+	Policies
+	Retention
+	AuditEvents
+	Close() error
+}
+
+// MatchTags reports whether tags include every key/value in selector
+func MatchTags(tags, selector map[string]string) bool {
+	for k, v := range selector {
+		if tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,517 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+
+	"device-posture-collector/policy"
+	"device-posture-collector/report"
+)
+
+// testStore exercises the behaviour every backend must share
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	reports := []report.DeviceStatus{
+		{Hostname: "laptop-1", IP: "10.0.0.5", Status: "HEALTHY", Score: 100, Timestamp: at},
+		{Hostname: "laptop-2", IP: "10.0.0.6", Status: "UNHEALTHY", Score: 40, FailingChecks: []string{"disk_usage"}, Timestamp: at},
+		{Hostname: "laptop-1", IP: "10.0.0.7", Status: "DEGRADED", Score: 75, FailingChecks: []string{"cpu_usage"}, DiskUsage: 81.5, Timestamp: at.Add(time.Minute)},
+	}
+	for i := range reports {
+		stored, err := s.SaveReport(ctx, &reports[i], nil, at.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatalf("SaveReport: %v", err)
+		}
+		if stored.ID == 0 {
+			t.Fatalf("SaveReport returned no ID")
+		}
+	}
+
+	all, err := s.ListReports(ctx, Filter{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("ListReports = %d reports, %v", len(all), err)
+	}
+	if all[0].Hostname != "laptop-1" || all[0].Status != "DEGRADED" {
+		t.Errorf("ListReports not newest first: %+v", all[0])
+	}
+
+	filtered, _ := s.ListReports(ctx, Filter{Hostname: "laptop-1", Limit: 1})
+	if len(filtered) != 1 || filtered[0].IP != "10.0.0.7" {
+		t.Errorf("ListReports(hostname, limit) = %+v", filtered)
+	}
+	unhealthy, _ := s.ListReports(ctx, Filter{Status: "UNHEALTHY"})
+	if len(unhealthy) != 1 || unhealthy[0].Hostname != "laptop-2" {
+		t.Errorf("ListReports(status) = %+v", unhealthy)
+	}
+
+	recent, _ := s.ListReports(ctx, Filter{Since: at.Add(time.Second), Oldest: true})
+	if len(recent) != 1 || recent[0].IP != "10.0.0.7" {
+		t.Errorf("ListReports(since) = %+v", recent)
+	}
+	page, _ := s.ListReports(ctx, Filter{Oldest: true, Cursor: all[2].ID, Limit: 1})
+	if len(page) != 1 || page[0].ID != all[1].ID {
+		t.Errorf("ListReports(cursor) = %+v", page)
+	}
+
+	series, err := s.ReportSeries(ctx, Filter{}, time.Hour)
+	if err != nil || len(series) != 1 {
+		t.Fatalf("ReportSeries(1h) = %+v, %v", series, err)
+	}
+	if p := series[0]; !p.Bucket.Equal(at) || p.Reports != 3 || p.Devices != 2 || p.Unhealthy != 1 || p.Degraded != 1 ||
+		p.AvgScore < 71.6 || p.AvgScore > 71.7 {
+		t.Errorf("ReportSeries(1h) = %+v", p)
+	}
+	series, _ = s.ReportSeries(ctx, Filter{Hostname: "laptop-1"}, time.Minute)
+	if len(series) != 2 || series[1].AvgDisk != 81.5 || series[1].Devices != 1 {
+		t.Errorf("ReportSeries(hostname, 1m) = %+v", series)
+	}
+
+	device, err := s.GetDevice(ctx, "laptop-1")
+	if err != nil {
+		t.Fatalf("GetDevice: %v", err)
+	}
+	if device.ReportCount != 2 || device.Status != "DEGRADED" || device.IP != "10.0.0.7" ||
+		len(device.FailingChecks) != 1 || device.DiskUsage != 81.5 || !device.LastSeen.Equal(at.Add(2*time.Second)) {
+		t.Errorf("GetDevice = %+v", device)
+	}
+	if _, err := s.GetDevice(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetDevice(missing) error = %v, want ErrNotFound", err)
+	}
+	if byIP, err := s.GetDeviceByIP(ctx, "10.0.0.7"); err != nil || byIP.Hostname != "laptop-1" {
+		t.Errorf("GetDeviceByIP = %+v, %v", byIP, err)
+	}
+	if _, err := s.GetDeviceByIP(ctx, "10.0.0.5"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetDeviceByIP(previous address) error = %v, want ErrNotFound", err)
+	}
+
+	tagged, err := s.SetTags(ctx, "laptop-2", map[string]string{"site": "ams", "owner": "alice"})
+	if err != nil || tagged.Tags["site"] != "ams" {
+		t.Errorf("SetTags = %+v, %v", tagged, err)
+	}
+	if _, err := s.SetTags(ctx, "missing", map[string]string{"site": "ams"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetTags(missing) error = %v, want ErrNotFound", err)
+	}
+	// A new report must keep the tags. This one repeats the device's last
+	// report, so it is folded into it rather than stored.
+	later := reports[1]
+	later.Timestamp = at.Add(time.Hour)
+	repeat, err := s.SaveReport(ctx, &later, nil, at.Add(time.Hour))
+	if err != nil || repeat.Dedup != DedupRepeat || repeat.ID != all[1].ID || repeat.Repeats != 1 ||
+		repeat.RepeatedUntil == nil || !repeat.RepeatedUntil.Equal(later.Timestamp) {
+		t.Errorf("SaveReport(repeat) = %+v, %v", repeat, err)
+	}
+	device, _ = s.GetDevice(ctx, "laptop-2")
+	if device.Tags["owner"] != "alice" {
+		t.Errorf("tags lost after report: %+v", device)
+	}
+	if device.ReportCount != 2 || !device.LastSeen.Equal(at.Add(time.Hour)) || device.LastReportID != all[1].ID {
+		t.Errorf("device after repeat = %+v", device)
+	}
+	// The folded report still matches from its first timestamp to its last
+	if got, _ := s.ListReports(ctx, Filter{Hostname: "laptop-2", Since: at.Add(30 * time.Minute)}); len(got) != 1 || got[0].Repeats != 1 {
+		t.Errorf("ListReports(since, repeated) = %+v", got)
+	}
+	if p, _ := s.ReportSeries(ctx, Filter{Hostname: "laptop-2"}, time.Hour); len(p) != 1 || p[0].Reports != 2 {
+		t.Errorf("ReportSeries counts repeats as %+v", p)
+	}
+
+	// A report retried with the same idempotency key is stored once
+	keyed := reports[1]
+	keyed.Score, keyed.IdempotencyKey = 30, "report-1"
+	first, err := s.SaveReport(ctx, &keyed, nil, at.Add(90*time.Minute))
+	if err != nil || first.Dedup != "" {
+		t.Fatalf("SaveReport(keyed) = %+v, %v", first, err)
+	}
+	keyed.Timestamp = at.Add(2 * time.Hour)
+	replay, err := s.SaveReport(ctx, &keyed, nil, at.Add(2*time.Hour))
+	if err != nil || replay.Dedup != DedupReplay || replay.ID != first.ID || !replay.Timestamp.Equal(at) {
+		t.Errorf("SaveReport(replay) = %+v, %v", replay, err)
+	}
+	if device, _ := s.GetDevice(ctx, "laptop-2"); device.ReportCount != 3 || !device.LastSeen.Equal(at.Add(90*time.Minute)) {
+		t.Errorf("device after replay = %+v", device)
+	}
+	// Keys are per device
+	other := keyed
+	other.Hostname = "laptop-3"
+	if stored, _ := s.SaveReport(ctx, &other, nil, at.Add(2*time.Hour)); stored.Dedup != "" {
+		t.Errorf("another device's key was treated as a replay: %+v", stored)
+	}
+
+	devices, _ := s.ListDevices(ctx)
+	if len(devices) != 3 || devices[0].Hostname != "laptop-1" {
+		t.Errorf("ListDevices = %+v", devices)
+	}
+
+	// A batch is stored in order and leaves the device at its last report
+	batch, err := s.SaveReports(ctx, []NewReport{
+		{Status: &reports[0], ReceivedAt: at.Add(2 * time.Hour)},
+		{Status: &reports[2], ReceivedAt: at.Add(2 * time.Hour)},
+	})
+	if err != nil || len(batch) != 2 || batch[1].ID <= batch[0].ID {
+		t.Fatalf("SaveReports = %+v, %v", batch, err)
+	}
+	if device, _ := s.GetDevice(ctx, "laptop-1"); device.ReportCount != 4 || device.Status != "DEGRADED" || device.LastReportID != batch[1].ID {
+		t.Errorf("device after SaveReports = %+v", device)
+	}
+
+	n, err := s.DeleteReports(ctx)
+	if err != nil || n != 7 {
+		t.Errorf("DeleteReports = %d, %v", n, err)
+	}
+	if devices, _ := s.ListDevices(ctx); len(devices) != 0 {
+		t.Errorf("devices left after DeleteReports: %+v", devices)
+	}
+}
+
+// testCredentials covers enrollment tokens and API keys. Hashes are unique
+// per run so a reused Postgres database doesn't collide.
+func testCredentials(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	run := fmt.Sprint(time.Now().UnixNano())
+
+	token := EnrollmentToken{ID: "dpe_" + run, Hash: "token-" + run, Tags: map[string]string{"group": "eng"},
+		CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if err := s.CreateEnrollmentToken(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ConsumeEnrollmentToken(ctx, token.Hash, "laptop-1", now.Add(2*time.Hour)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired token consumed: %v", err)
+	}
+	used, err := s.ConsumeEnrollmentToken(ctx, token.Hash, "laptop-1", now.Add(time.Minute))
+	if err != nil || used.ID != token.ID || used.Tags["group"] != "eng" {
+		t.Fatalf("ConsumeEnrollmentToken = %+v, %v", used, err)
+	}
+	if _, err := s.ConsumeEnrollmentToken(ctx, token.Hash, "laptop-2", now.Add(time.Minute)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("token consumed twice: %v", err)
+	}
+	tokens, err := s.ListEnrollmentTokens(ctx)
+	found := false
+	for _, tok := range tokens {
+		if tok.ID == token.ID {
+			found = tok.UsedBy == "laptop-1" && tok.UsedAt != nil
+		}
+	}
+	if err != nil || !found {
+		t.Errorf("ListEnrollmentTokens missing used token: %+v, %v", tokens, err)
+	}
+
+	host := "host-" + run
+	registered, err := s.RegisterDevice(ctx, host, used.Tags, now)
+	if err != nil || registered.Status != StatusEnrolled || registered.Tags["group"] != "eng" || registered.ReportCount != 0 {
+		t.Fatalf("RegisterDevice = %+v, %v", registered, err)
+	}
+	// Enrolling again merges tags and keeps the record. The report is dated
+	// after testRetention's prune cutoff.
+	later := now.AddDate(1, 0, 0)
+	s.SaveReport(ctx, &report.DeviceStatus{Hostname: host, Status: "HEALTHY", Score: 100, Timestamp: later}, nil, later)
+	registered, err = s.RegisterDevice(ctx, host, map[string]string{"site": "ams"}, now)
+	if err != nil || registered.Status != "HEALTHY" || registered.Tags["group"] != "eng" || registered.Tags["site"] != "ams" {
+		t.Errorf("RegisterDevice again = %+v, %v", registered, err)
+	}
+
+	key := APIKey{ID: "dpk_" + run, Hostname: host, Hash: "key-" + run, SigningKey: "c2lnbmluZy1rZXk=", CreatedAt: now}
+	if err := s.CreateAPIKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetAPIKey(ctx, key.Hash)
+	if err != nil || got.Hostname != host || got.SigningKey != key.SigningKey || !got.Valid(now) {
+		t.Fatalf("GetAPIKey = %+v, %v", got, err)
+	}
+	if _, err := s.GetAPIKey(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAPIKey(unknown) = %v", err)
+	}
+
+	if err := s.ExpireAPIKey(ctx, key.Hash, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = s.GetAPIKey(ctx, key.Hash)
+	if !got.Valid(now) || got.Valid(now.Add(2*time.Hour)) {
+		t.Errorf("expiring key validity wrong: %+v", got)
+	}
+
+	n, err := s.RevokeAPIKeys(ctx, host, now)
+	if err != nil || n != 1 {
+		t.Errorf("RevokeAPIKeys = %d, %v", n, err)
+	}
+	keys, err := s.ListAPIKeys(ctx, host)
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil || keys[0].Valid(now) {
+		t.Errorf("ListAPIKeys after revoke = %+v, %v", keys, err)
+	}
+}
+
+// testRetention rolls reports up by hour and prunes them
+func testRetention(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	hour := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	host := "rollup-" + fmt.Sprint(time.Now().UnixNano())
+
+	reports := []report.DeviceStatus{
+		{Hostname: host, Status: "HEALTHY", Score: 100, DiskUsage: 40, Timestamp: hour.Add(5 * time.Minute)},
+		{Hostname: host, Status: "UNHEALTHY", Score: 40, DiskUsage: 90, Timestamp: hour.Add(50 * time.Minute)},
+		{Hostname: host, Status: "DEGRADED", Score: 70, DiskUsage: 60, Timestamp: hour.Add(70 * time.Minute)},
+	}
+	for i := range reports {
+		if _, err := s.SaveReport(ctx, &reports[i], nil, reports[i].Timestamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rolling up twice must give the same result
+	for i := 0; i < 2; i++ {
+		if n, err := s.RollupReports(ctx, hour, hour.Add(2*time.Hour)); err != nil || n != 2 {
+			t.Fatalf("RollupReports = %d, %v", n, err)
+		}
+	}
+	rollups, err := s.ListRollups(ctx, host, time.Time{}, time.Time{})
+	if err != nil || len(rollups) != 2 {
+		t.Fatalf("ListRollups = %+v, %v", rollups, err)
+	}
+	first := rollups[0]
+	if !first.Bucket.Equal(hour) || first.Reports != 2 || first.Unhealthy != 1 || first.AvgDisk != 65 ||
+		first.MaxDisk != 90 || first.AvgScore != 70 || first.MinScore != 40 {
+		t.Errorf("first rollup = %+v", first)
+	}
+	if rollups[1].Degraded != 1 {
+		t.Errorf("second rollup = %+v", rollups[1])
+	}
+	if later, _ := s.ListRollups(ctx, host, hour.Add(time.Hour), time.Time{}); len(later) != 1 {
+		t.Errorf("ListRollups(since) = %+v", later)
+	}
+
+	if n, err := s.PruneReports(ctx, hour.Add(time.Hour)); err != nil || n != 2 {
+		t.Errorf("PruneReports = %d, %v", n, err)
+	}
+	left, _ := s.ListReports(ctx, Filter{Hostname: host})
+	if len(left) != 1 {
+		t.Errorf("reports left after prune = %+v", left)
+	}
+	// Rollups of pruned hours are kept when the range is rolled up again
+	s.RollupReports(ctx, hour, hour.Add(2*time.Hour))
+	if kept, _ := s.ListRollups(ctx, host, time.Time{}, time.Time{}); len(kept) != 2 || kept[0].Reports != 2 {
+		t.Errorf("rollups after pruning raw reports = %+v", kept)
+	}
+
+	if n, err := s.PruneRollups(ctx, hour.Add(time.Hour)); err != nil || n < 1 {
+		t.Errorf("PruneRollups = %d, %v", n, err)
+	}
+	if kept, _ := s.ListRollups(ctx, host, time.Time{}, time.Time{}); len(kept) != 1 {
+		t.Errorf("rollups after prune = %+v", kept)
+	}
+}
+
+// testTenants checks that a tenant's records are invisible to the others.
+// IDs are unique per run so a reused Postgres database doesn't collide.
+func testTenants(t *testing.T, s Store) {
+	t.Helper()
+	run := fmt.Sprint(time.Now().UnixNano())
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	acme, globex := "acme-"+run, "globex-"+run
+	for _, id := range []string{acme, globex} {
+		if err := s.CreateTenant(context.Background(), Tenant{ID: id, Name: id, CreatedAt: now}); err != nil {
+			t.Fatalf("CreateTenant(%s): %v", id, err)
+		}
+	}
+	if err := s.CreateTenant(context.Background(), Tenant{ID: acme, CreatedAt: now}); !errors.Is(err, ErrExists) {
+		t.Errorf("CreateTenant(duplicate) = %v, want ErrExists", err)
+	}
+	if err := s.SetTenantAdminKey(context.Background(), acme, "admin-"+run); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetTenantByAdminKey(context.Background(), "admin-"+run); err != nil || got.ID != acme {
+		t.Errorf("GetTenantByAdminKey = %+v, %v", got, err)
+	}
+	if _, err := s.GetTenantByAdminKey(context.Background(), ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetTenantByAdminKey(\"\") = %v, want ErrNotFound", err)
+	}
+
+	// The same hostname in two tenants is two devices
+	acmeCtx, globexCtx := WithTenant(context.Background(), acme), WithTenant(context.Background(), globex)
+	for _, c := range []struct {
+		ctx    context.Context
+		status string
+	}{{acmeCtx, "HEALTHY"}, {globexCtx, "UNHEALTHY"}} {
+		st := report.DeviceStatus{Hostname: "shared-" + run, Status: c.status, Score: 50, Timestamp: now}
+		if stored, err := s.SaveReport(c.ctx, &st, nil, now); err != nil || stored.Tenant != TenantOf(c.ctx) {
+			t.Fatalf("SaveReport = %+v, %v", stored, err)
+		}
+	}
+	device, err := s.GetDevice(acmeCtx, "shared-"+run)
+	if err != nil || device.Tenant != acme || device.Status != "HEALTHY" || device.ReportCount != 1 {
+		t.Errorf("GetDevice(acme) = %+v, %v", device, err)
+	}
+	if devices, _ := s.ListDevices(globexCtx); len(devices) != 1 || devices[0].Status != "UNHEALTHY" {
+		t.Errorf("ListDevices(globex) = %+v", devices)
+	}
+	if reports, _ := s.ListReports(globexCtx, Filter{}); len(reports) != 1 || reports[0].Tenant != globex {
+		t.Errorf("ListReports(globex) = %+v", reports)
+	}
+	if _, err := s.GetDevice(context.Background(), "shared-"+run); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unscoped GetDevice found another tenant's device: %v", err)
+	}
+
+	key := APIKey{ID: "dpk_t" + run, Hostname: "shared-" + run, Hash: "tenant-key-" + run, CreatedAt: now}
+	if err := s.CreateAPIKey(acmeCtx, key); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetAPIKey(context.Background(), key.Hash); got.Tenant != acme {
+		t.Errorf("key tenant = %q, want %q", got.Tenant, acme)
+	}
+	if n, _ := s.RevokeAPIKeys(globexCtx, "shared-"+run, now); n != 0 {
+		t.Errorf("globex revoked %d of acme's keys", n)
+	}
+
+	if n, err := s.DeleteReports(globexCtx); err != nil || n != 1 {
+		t.Errorf("DeleteReports(globex) = %d, %v", n, err)
+	}
+	if _, err := s.GetDevice(acmeCtx, "shared-"+run); err != nil {
+		t.Errorf("deleting globex's reports removed acme's device: %v", err)
+	}
+}
+
+func testPolicies(t *testing.T, s Store) {
+	t.Helper()
+	ctx := WithTenant(context.Background(), "policy-"+fmt.Sprint(time.Now().UnixNano()))
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	if _, err := s.GetPolicy(ctx); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetPolicy before SetPolicy = %v, want ErrNotFound", err)
+	}
+	s.SetPolicy(ctx, []byte(`{"checks":[{"name":"disk_usage","critical":90}]}`), now)
+	p, err := s.SetPolicy(ctx, []byte(`{"checks":[{"name":"disk_usage","critical":80}]}`), now.Add(time.Hour))
+	if err != nil || p.Version != 2 || p.Tenant != TenantOf(ctx) || !p.UpdatedAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("SetPolicy = %+v, %v", p, err)
+	}
+	if got, err := s.GetPolicy(ctx); err != nil || got.Version != 2 || !strings.Contains(string(got.Document), "80") {
+		t.Errorf("GetPolicy = %+v, %v", got, err)
+	}
+
+	// The collector's verdict is kept with the report and the device
+	agrees := report.DeviceStatus{Hostname: "judged", Status: "HEALTHY", Score: 100, DiskUsage: 10, Timestamp: now}
+	s.SaveReport(ctx, &agrees, &policy.Verdict{PolicyVersion: 2, Status: "HEALTHY", Score: 100}, now)
+	disagrees := report.DeviceStatus{Hostname: "judged", Status: "HEALTHY", Score: 100, DiskUsage: 85, Timestamp: now.Add(time.Minute)}
+	verdict := &policy.Verdict{PolicyVersion: 2, Status: "UNHEALTHY", Score: 50, FailingChecks: []string{"disk_usage"}}
+	if stored, err := s.SaveReport(ctx, &disagrees, verdict, now.Add(time.Minute)); err != nil || !stored.PolicyMismatch {
+		t.Fatalf("SaveReport(verdict) = %+v, %v", stored, err)
+	}
+	mismatched, _ := s.ListReports(ctx, Filter{Mismatch: true})
+	if len(mismatched) != 1 || mismatched[0].Server == nil || mismatched[0].Server.Status != "UNHEALTHY" || !mismatched[0].PolicyMismatch {
+		t.Errorf("ListReports(mismatch) = %+v", mismatched)
+	}
+	device, err := s.GetDevice(ctx, "judged")
+	if err != nil || device.ServerStatus != "UNHEALTHY" || device.ServerScore == nil || *device.ServerScore != 50 || !device.PolicyMismatch {
+		t.Errorf("GetDevice = %+v, %v", device, err)
+	}
+
+	if err := s.DeletePolicy(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeletePolicy(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeletePolicy = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetPolicy(WithTenant(ctx, DefaultTenant)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("policy leaked to the default tenant: %v", err)
+	}
+}
+
+func testAudit(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	l := audit.New("device-posture-collector", AuditStore(s))
+	before, err := l.Verify(ctx)
+	if err != nil {
+		t.Fatalf("Verify before appending = %v", err)
+	}
+	tenant := "audit-" + fmt.Sprint(time.Now().UnixNano())
+	for _, e := range []audit.Event{
+		{Tenant: tenant, Actor: "admin", Action: "enrollment_token.create", Object: "token et-1"},
+		{Tenant: tenant, Actor: "laptop-1", Address: "10.0.0.5:51234", Action: "device.enroll", Object: "device laptop-1", Outcome: audit.OutcomeSuccess},
+		{Tenant: DefaultTenant, Actor: audit.ActorAnonymous, Action: audit.ActionAdminDenied, Outcome: audit.OutcomeDenied},
+	} {
+		if _, err := l.Record(ctx, e); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if n, err := l.Verify(ctx); n != before+3 || err != nil {
+		t.Errorf("Verify = %d, %v; want %d events", n, err, before+3)
+	}
+	events, err := l.Events(ctx, audit.Filter{Tenant: tenant})
+	if err != nil || len(events) != 2 || events[0].Action != "device.enroll" || events[0].Seq != int64(before+2) || events[0].Prev != events[1].Hash {
+		t.Errorf("Events(tenant) = %+v, %v", events, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	s := NewMemory(100)
+	testStore(t, s)
+	testCredentials(t, s)
+	testRetention(t, s)
+	testTenants(t, s)
+	testPolicies(t, s)
+	testAudit(t, s)
+}
+
+func TestSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collector.db")
+	s, err := OpenSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	testCredentials(t, s)
+	testRetention(t, s)
+	testTenants(t, s)
+	testPolicies(t, s)
+	testAudit(t, s)
+	s.Close()
+
+	// Reopening must not reapply migrations
+	s, err = OpenSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	s.Close()
+}
+
+// TestPostgres runs against a scratch database named by
+// COLLECTOR_TEST_POSTGRES_URL, e.g. postgres://postgres@localhost/collector_test
+func TestPostgres(t *testing.T) {
+	url := os.Getenv("COLLECTOR_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("COLLECTOR_TEST_POSTGRES_URL not set")
+	}
+	s, err := OpenPostgres(context.Background(), url, DefaultPoolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.DeleteReports(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	testCredentials(t, s)
+	testRetention(t, s)
+	testTenants(t, s)
+	testPolicies(t, s)
+	testAudit(t, s)
+}
+
+func TestRebind(t *testing.T) {
+	s := &sqlStore{dialect: "postgres"}
+	got := s.rebind("SELECT * FROM reports WHERE hostname = ? AND status = ? LIMIT ?")
+	if want := "SELECT * FROM reports WHERE hostname = $1 AND status = $2 LIMIT $3"; got != want {
+		t.Errorf("rebind = %q, want %q", got, want)
+	}
+}
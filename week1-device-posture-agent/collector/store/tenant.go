@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultTenant owns everything written without a tenant, including all
+// data from before multi-tenancy and every record of a single-tenant
+// collector
+const DefaultTenant = "default"
+
+// ErrExists is returned when creating a record whose ID is taken
+var ErrExists = errors.New("already exists")
+
+type tenantKey struct{}
+
+// WithTenant scopes the store calls made with ctx to one tenant. Listings
+// and bulk deletes on an unscoped context span every tenant; lookups and
+// writes fall back to DefaultTenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantScope returns the tenant ctx is scoped to, if any
+func TenantScope(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// TenantOf returns the tenant that lookups and writes made with ctx act on
+func TenantOf(ctx context.Context) string {
+	if tenant, ok := TenantScope(ctx); ok {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// recordTenant is the tenant a new record belongs to: its own, or ctx's
+func recordTenant(ctx context.Context, tenant string) string {
+	if tenant != "" {
+		return tenant
+	}
+	return TenantOf(ctx)
+}
+
+// Tenant is an organisation whose devices, keys and reports are kept apart
+// from every other tenant's
+type Tenant struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	AdminKeyHash string    `json:"-"` // empty until an admin key is issued
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Tenants stores the tenants of a multi-tenant collector
+type Tenants interface {
+	// CreateTenant adds a tenant; ErrExists if the ID is taken
+	CreateTenant(ctx context.Context, tenant Tenant) error
+	GetTenant(ctx context.Context, id string) (Tenant, error)
+	// GetTenantByAdminKey finds the tenant whose admin key hashes to hash
+	GetTenantByAdminKey(ctx context.Context, hash string) (Tenant, error)
+	ListTenants(ctx context.Context) ([]Tenant, error)
+	// SetTenantAdminKey replaces a tenant's admin key
+	SetTenantAdminKey(ctx context.Context, id, hash string) error
+}
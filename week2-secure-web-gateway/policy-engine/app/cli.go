@@ -0,0 +1,238 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/secrets"
+	"github.com/nisatyap/week2-swg/policy-engine/handlers"
+	"github.com/nisatyap/week2-swg/policy-engine/signing"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// runCLI runs the export and import commands, which manage the policy of
+// a running policy engine as a YAML document, and returns the exit code
+//
+//	policy-engine export -o policy.yaml
+//	policy-engine import -dry-run policy.yaml
+func runCLI(name, command string, args []string) int {
+	fs := flag.NewFlagSet(name+" "+command, flag.ContinueOnError)
+	server := fs.String("url", "http://localhost:8000", "Policy engine to manage")
+	tokenFlag := fs.String("token", "", "Your API token, or a secret reference such as keychain:swg-policy/admin (default $POLICY_TOKEN, then $POLICY_ADMIN_TOKEN)")
+	tokenFile := fs.String("token-file", "", "File holding your API token, instead of -token")
+	output := fs.String("o", "", "File to write the export to (default stdout)")
+	dryRun := fs.Bool("dry-run", false, "Show what the import would change without changing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  %[1]s export [-o policy.yaml]\n  %[1]s import [-dry-run] policy.yaml\n\nFlags:\n", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	token := *tokenFlag
+	for _, env := range []string{"POLICY_TOKEN", "POLICY_ADMIN_TOKEN"} {
+		if token == "" {
+			token = strings.TrimSpace(os.Getenv(env))
+		}
+	}
+	token, err := secrets.Resolve(context.Background(), token)
+	if err == nil {
+		token, err = secrets.FromFile(token, *tokenFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	c := client{url: strings.TrimSuffix(*server, "/"), token: token}
+
+	switch command {
+	case "export":
+		err = c.export(*output)
+	case "import":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return 2
+		}
+		err = c.importFile(fs.Arg(0), *dryRun)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// rotateKey replaces the policy signing key, keeping the old public key in
+// the .pub file for proxies to accept while the policy engines restart with
+// the new one, and returns the exit code
+//
+//	policy-engine rotate-key -signing-key policy-signing.key -retire-after 24h
+func rotateKey(name string, args []string) int {
+	fs := flag.NewFlagSet(name+" rotate-key", flag.ContinueOnError)
+	signingKey := fs.String("signing-key", "policy-signing.key", "Ed25519 private key (PEM) to replace")
+	retireAfter := fs.Duration("retire-after", 24*time.Hour, "How long the .pub file keeps the old public key, for proxies to accept policies signed with it")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *retireAfter < 0 {
+		fmt.Fprintln(os.Stderr, "rotate-key: -retire-after must not be negative")
+		return 2
+	}
+	signer, retired, err := signing.Rotate(*signingKey, *retireAfter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rotate-key: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Replaced key %s with %s; %s.pub keeps %s until %s.\n", retired.ID, signer.ID(), *signingKey, retired.ID,
+		retired.Expires.Format(time.RFC3339))
+	fmt.Printf("Copy %s.pub to the proxies, then restart the policy engines.\n", *signingKey)
+	return 0
+}
+
+// client calls the policy engine's API
+type client struct {
+	url   string
+	token string
+}
+
+func (c client) do(method, path string, body []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+	resp, err := (&http.Client{Timeout: time.Minute}).Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error    string   `json:"error"`
+			Problems []string `json:"problems"`
+		}
+		if json.Unmarshal(data, &e) != nil || e.Error == "" {
+			return nil, nil, fmt.Errorf("policy engine returned status %d", resp.StatusCode)
+		}
+		for _, p := range e.Problems {
+			e.Error += "\n  " + p
+		}
+		return nil, nil, fmt.Errorf("%s", e.Error)
+	}
+	return resp, data, nil
+}
+
+func (c client) export(output string) error {
+	_, data, err := c.do(http.MethodGet, "/policy/export", nil)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(output, data, 0o644)
+}
+
+func (c client) importFile(path string, dryRun bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Catch syntax errors here, with the file's name, before sending it
+	if _, err := store.ParseDocument(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	endpoint := "/policy/import"
+	if dryRun {
+		endpoint += "?dry_run=true"
+	}
+	resp, body, err := c.do(http.MethodPost, endpoint, data)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		var ap handlers.Approval
+		json.Unmarshal(body, &ap)
+		fmt.Printf("Import is waiting for approval (change %d)\n", ap.ID)
+		return nil
+	}
+	var result handlers.ImportResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("unexpected response: %w", err)
+	}
+	printChanges(os.Stdout, result.Changes)
+	switch {
+	case !result.Changed:
+		fmt.Printf("No changes; the policy is at v%d\n", result.Version)
+	case result.DryRun:
+		fmt.Printf("Dry run: nothing changed; the policy is at v%d\n", result.Version)
+	default:
+		fmt.Printf("Imported as v%d\n", result.Version)
+	}
+	return nil
+}
+
+// printChanges writes changes as a diff: + added, - removed, ~ changed
+func printChanges(w io.Writer, c store.Changes) {
+	rule := func(r store.Rule) string {
+		s := r.Type + " " + r.Domain
+		if len(r.Groups) > 0 {
+			s += " (groups " + strings.Join(r.Groups, ", ") + ")"
+		}
+		return s
+	}
+	if len(c.RulesAdded)+len(c.RulesRemoved)+len(c.RulesChanged) > 0 {
+		fmt.Fprintln(w, "rules:")
+		for _, r := range c.RulesAdded {
+			fmt.Fprintf(w, "  + %s\n", rule(r))
+		}
+		for _, r := range c.RulesRemoved {
+			fmt.Fprintf(w, "  - %s\n", rule(r))
+		}
+		for _, r := range c.RulesChanged {
+			fmt.Fprintf(w, "  ~ %s\n", rule(r))
+		}
+	}
+	for _, named := range []struct {
+		kind    string
+		changes *store.NameChanges
+	}{{"categories", c.Categories}, {"groups", c.Groups}, {"sources", c.Sources}} {
+		if named.changes == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", named.kind)
+		for _, name := range named.changes.Added {
+			fmt.Fprintf(w, "  + %s\n", name)
+		}
+		for _, name := range named.changes.Removed {
+			fmt.Fprintf(w, "  - %s\n", name)
+		}
+		for _, name := range named.changes.Changed {
+			fmt.Fprintf(w, "  ~ %s\n", name)
+		}
+	}
+}
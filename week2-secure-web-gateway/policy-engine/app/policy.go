@@ -0,0 +1,308 @@
+// Package app is the policy engine's command line, which the policy
+// engine's own binary and the unified swg binary run
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+	_ "time/tzdata" // schedule time zones on hosts without a zoneinfo database
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/config"
+	"github.com/nisatyap/shared/lifecycle"
+	"github.com/nisatyap/shared/logging"
+	"github.com/nisatyap/shared/middleware"
+	"github.com/nisatyap/shared/ratelimit"
+	"github.com/nisatyap/shared/secrets"
+	"github.com/nisatyap/week2-swg/policy-engine/handlers"
+	"github.com/nisatyap/week2-swg/policy-engine/importer"
+	"github.com/nisatyap/week2-swg/policy-engine/signing"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// auditService names the policy engine in audit events and syslog
+const auditService = "swg-policy-engine"
+
+// Main runs the policy engine with args, the command line without the
+// program name, until it receives SIGINT or SIGTERM, or runs its export,
+// import or rotate-key command, and returns its exit code. name is how the policy engine
+// is invoked, e.g. "policy-engine" or "swg policy", for usage messages.
+func Main(name string, args []string) int {
+	if len(args) > 0 && (args[0] == "export" || args[0] == "import") {
+		return runCLI(name, args[0], args[1:])
+	}
+	if len(args) > 0 && args[0] == "rotate-key" {
+		return rotateKey(name, args[1:])
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	listen := fs.String("listen", ":8000", "Address to listen on")
+	backend := fs.String("store", "sqlite", "Storage backend: sqlite, postgres or json")
+	db := fs.String("db", "", "SQLite database file (default policy.db) or PostgreSQL URL (default $POLICY_DATABASE_URL)")
+	dbPassword := fs.String("db-password", "", "Password for the PostgreSQL -db, kept out of the URL: a secret reference such as vault:secret/data/swg/policy#db_password")
+	dataFile := fs.String("data", "policy.json", "JSON file the policy is kept in with -store json, and imported from into an empty database otherwise")
+	history := fs.Int("history", store.DefaultHistory, "Number of policy versions to keep for rollback")
+	auditFile := fs.String("audit-log", "", "File the audit log of policy changes and admin sign-ins is appended to (default the -data file with .audit.log added)")
+	auditSyslog := fs.String("audit-syslog", "", "Also send audit events to syslog: local, udp://host:514 or tcp://host:514")
+	auditWebhook := fs.String("audit-webhook", "", "Also POST audit events as JSON to this http or https URL, such as a SIEM's")
+	alertWebhook := fs.String("alert-webhook", "", "URL to POST stale blocklist source alerts to as JSON (default: log only)")
+	adminToken := fs.String("admin-token", "", "Admin token for the management endpoints, or a secret reference such as vault:secret/data/swg/policy#admin_token")
+	adminTokenFile := fs.String("admin-token-file", "", "File holding the admin token, instead of -admin-token")
+	usersFile := fs.String("users-file", "", "JSON file of policy admins, their roles and tokens (see README)")
+	insecureNoAuth := fs.Bool("insecure-no-auth", false, "Leave the management endpoints open to anyone, without an admin token or users; for local development only")
+	requireApproval := fs.Bool("require-approval", false, "Hold high-impact changes, such as category-wide blocks, until a second approver approves them")
+	signingKey := fs.String("signing-key", "policy-signing.key", "Ed25519 private key (PEM) policy documents are signed with; created, with its public key in the same name plus .pub, if missing. May be a secret reference such as vault:secret/data/swg/policy#signing_key")
+	apiRate := fs.Int("api-rate-limit", 300, "Requests to the management endpoints accepted from one client address in any minute (0 disables)")
+	rateLimitRedis := fs.String("rate-limit-redis", "", "Redis URL, as in redis://:password@redis:6379/0, to keep the API rate limits in, shared by every policy engine using it (default in memory)")
+	logOpts := logging.Options{Service: "policy-engine"}
+	logOpts.AddFlags(fs)
+	settings, err := config.Load(fs, args, config.Options{
+		EnvPrefix: "POLICY",
+		Validate: func() error {
+			if *history < 1 {
+				return fmt.Errorf("-history must be at least 1")
+			}
+			for name, webhook := range map[string]string{"alert-webhook": *alertWebhook, "audit-webhook": *auditWebhook} {
+				if webhook == "" {
+					continue
+				}
+				if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("-%s must be an http or https URL", name)
+				}
+			}
+			if *apiRate < 0 {
+				return fmt.Errorf("-api-rate-limit must not be negative")
+			}
+			if *rateLimitRedis != "" {
+				if _, err := ratelimit.OpenRedis(*rateLimitRedis); err != nil {
+					return fmt.Errorf("-rate-limit-redis: %w", err)
+				}
+			}
+			_, err := logging.NewHandler(logOpts)
+			return err
+		},
+	})
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if settings.Print {
+		settings.Dump(os.Stdout)
+		return 0
+	}
+
+	logger, _ := logging.New(logOpts) // checked by Validate
+	logger.Info("Cisco SWG policy engine starting")
+	for _, name := range settings.Plaintext() {
+		logger.Warn("secret set in plaintext; give a secret reference such as env:, file:, vault: or keychain: instead", "flag", name)
+	}
+	token, err := secrets.FromFile(*adminToken, *adminTokenFile)
+	if err != nil {
+		logger.Error("invalid admin token", "error", err)
+		return 1
+	}
+	var users []handlers.User
+	if *usersFile != "" {
+		if users, err = handlers.ReadUsers(*usersFile); err != nil {
+			logger.Error("invalid -users-file", "error", err)
+			return 1
+		}
+		logger.Info("loaded users", "users", len(users), "path", *usersFile)
+	}
+	switch {
+	case *insecureNoAuth && (token != "" || len(users) > 0):
+		logger.Error("-insecure-no-auth can't be combined with an admin token or -users-file")
+		return 1
+	case *insecureNoAuth:
+		logger.Warn("-insecure-no-auth set, anyone who can reach the policy engine can change the policy", "addr", *listen)
+	case token == "" && len(users) == 0:
+		logger.Error("no admin token or users set; give -admin-token, -admin-token-file or -users-file, or -insecure-no-auth to leave the management endpoints open")
+		return 1
+	}
+	if *requireApproval {
+		approvers := 0
+		if token != "" {
+			approvers++
+		}
+		for _, u := range users {
+			if u.Role == handlers.RoleApprover {
+				approvers++
+			}
+		}
+		if approvers < 2 {
+			logger.Error("-require-approval needs at least two approvers, counting the admin token", "approvers", approvers)
+			return 1
+		}
+	}
+	signer, created, err := signing.LoadOrCreate(*signingKey)
+	if err != nil {
+		logger.Error("invalid signing key", "error", err)
+		return 1
+	}
+	if created {
+		logger.Info("created signing key; give proxies its public key", "key_id", signer.ID(), "public_key", *signingKey+".pub")
+	}
+	logger.Info("signing policy documents", "key_id", signer.ID())
+	backendStore, where, err := openStore(*backend, *db, *dbPassword, *dataFile, logger)
+	if err != nil {
+		logger.Error("storage unavailable", "error", err)
+		return 1
+	}
+	policy, err := store.OpenBackend(backendStore, store.DefaultBlocklist)
+	if err != nil {
+		logger.Error("failed to load the policy", "error", err)
+		return 1
+	}
+	defer policy.Close()
+	policy.SetHistoryLimit(*history)
+	if *auditFile == "" {
+		*auditFile = *dataFile + ".audit.log"
+	}
+	auditStore, err := audit.OpenFile(*auditFile)
+	if err != nil {
+		logger.Error("failed to open the audit log", "error", err)
+		return 1
+	}
+	auditLog := audit.New(auditService, auditStore)
+	defer auditLog.Close()
+	if n, err := auditLog.Verify(context.Background()); err != nil {
+		logger.Warn("audit log failed verification", "path", *auditFile, "events", n, "error", err)
+	}
+	if *auditSyslog != "" {
+		sink, err := audit.NewSyslog(*auditSyslog, auditService)
+		if err != nil {
+			logger.Error("invalid -audit-syslog", "error", err)
+			return 1
+		}
+		auditLog.AddSink(sink)
+		logger.Info("sending audit events to syslog", "addr", *auditSyslog)
+	}
+	if *auditWebhook != "" {
+		sink, err := audit.NewWebhook(*auditWebhook, nil, logger)
+		if err != nil {
+			logger.Error("invalid -audit-webhook", "error", err)
+			return 1
+		}
+		auditLog.AddSink(sink)
+		u, _ := url.Parse(*auditWebhook)
+		logger.Info("sending audit events to a webhook", "url", u.Redacted())
+	}
+	p := policy.Policy()
+	logger.Info("policy loaded", "version", p.Version, "from", where, "rules", len(p.Rules),
+		"categories", len(p.Categories), "sources", len(p.Sources))
+
+	run := lifecycle.New(lifecycle.Options{})
+	imports := importer.New(policy)
+	imports.SetAudit(auditLog)
+	imports.SetLogger(logger)
+	run.Go("blocklist imports", func(ctx context.Context) error {
+		imports.Run(ctx, time.Minute)
+		return nil
+	})
+	watcher := importer.NewWatcher(policy, *alertWebhook, logger)
+	run.Go("blocklist source health", func(ctx context.Context) error {
+		watcher.Run(ctx, time.Minute)
+		return nil
+	})
+
+	var limitStore ratelimit.Store
+	if *rateLimitRedis != "" {
+		redis, _ := ratelimit.OpenRedis(*rateLimitRedis) // checked by Validate
+		defer redis.Close()
+		limitStore = redis
+		logger.Info("keeping API rate limits in Redis", "redis", redis.String())
+	}
+	var limiter *ratelimit.Limiter
+	if *apiRate > 0 {
+		limit := ratelimit.Limit{Rate: float64(*apiRate) / 60, Burst: *apiRate, Algorithm: ratelimit.SlidingWindow}
+		limiter = ratelimit.New("policy-api", limit, limitStore)
+	}
+
+	mux := http.NewServeMux()
+	httpMetrics := middleware.NewMetrics()
+	api := handlers.NewAPI(policy, handlers.Options{
+		AdminToken: token, Users: users, InsecureNoAuth: *insecureNoAuth, RequireApproval: *requireApproval, Audit: auditLog, Signer: signer,
+		HTTPMetrics: httpMetrics, RateLimit: limiter, Logger: logger,
+	})
+	api.Register(mux)
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           middleware.Chain(mux, middleware.RequestID, middleware.Log(logger), middleware.Recover(logger), httpMetrics.Middleware),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		MaxHeaderBytes:    64 << 10,
+	}
+	server.RegisterOnShutdown(api.CloseStreams)
+	logger.Info("policy engine listening", "addr", *listen)
+	run.Serve("server", server, server.ListenAndServe)
+
+	<-run.Context().Done()
+	logger.Info("shutting down")
+	if err := run.Wait(); err != nil {
+		logger.Error("policy engine stopped with an error", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// openStore creates the configured storage backend, and says where it
+// keeps the policy. A new database starts from the policy in the JSON
+// file, if there is one.
+func openStore(backend, db, password, dataFile string, logger *slog.Logger) (store.Backend, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var b store.Backend
+	var where string
+	var err error
+	switch backend {
+	case "json":
+		return store.NewJSONFile(dataFile), dataFile, nil
+	case "sqlite":
+		where = db
+		if where == "" {
+			where = "policy.db"
+		}
+		b, err = store.OpenSQLite(ctx, where)
+	case "postgres":
+		// Prefer the environment so the password doesn't show up in ps output
+		url := db
+		if url == "" {
+			url = os.Getenv("POLICY_DATABASE_URL")
+		}
+		if url == "" {
+			return nil, "", fmt.Errorf("-store postgres needs -db or POLICY_DATABASE_URL")
+		}
+		if password != "" {
+			if url, err = secrets.WithPassword(url, password); err != nil {
+				return nil, "", fmt.Errorf("-db: %w", err)
+			}
+		}
+		where = "PostgreSQL"
+		b, err = store.OpenPostgres(ctx, url)
+	default:
+		return nil, "", fmt.Errorf("unknown store %q (want sqlite, postgres or json)", backend)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	imported, err := store.Import(b, dataFile)
+	if err != nil {
+		b.Close()
+		return nil, "", fmt.Errorf("import %s: %w", dataFile, err)
+	}
+	if imported {
+		logger.Info("imported the policy and its history; the JSON file is no longer used", "from", dataFile, "into", where)
+	}
+	return b, where, nil
+}
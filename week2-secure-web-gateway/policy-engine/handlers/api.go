@@ -0,0 +1,661 @@
+// Package handlers serves the policy engine's HTTP API: the policy
+// document the proxy polls, and the endpoints that manage it
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/middleware"
+	"github.com/nisatyap/shared/openapi"
+	"github.com/nisatyap/shared/ratelimit"
+	"github.com/nisatyap/week2-swg/policy-engine/importer"
+	"github.com/nisatyap/week2-swg/policy-engine/signing"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// Version is reported by GET /
+const Version = "2.0.0"
+
+// PolicyResponse is the document GET /policy serves, holding the rules
+// active when it was served and the domains of the imported blocklists,
+// which are merged into Blocked. The proxy blocks Blocked and their subdomains,
+// the host names matching Wildcards and the domains of the categories whose
+// action is block, except for the domains of categories whose action is
+// allow; the other fields are for people and tooling.
+type PolicyResponse struct {
+	Group string `json:"group,omitempty"` // the group the rules were chosen for
+	// Blocked holds the domains blocked with their subdomains, from suffix
+	// rules and sources; Exact the host names blocked without them;
+	// Wildcards and Regexes the patterns of wildcard and regex rules
+	Blocked     []string                  `json:"blocked"`
+	Exact       []string                  `json:"exact"`
+	Wildcards   []string                  `json:"wildcards"`
+	Regexes     []string                  `json:"regexes"`
+	Categories  map[string]PolicyCategory `json:"categories"`
+	Total       int                       `json:"total"` // entries in Blocked, Exact, Wildcards and Regexes
+	Version     int64                     `json:"version"`
+	LastUpdated time.Time                 `json:"last_updated"`
+	// GeneratedAt is the time the active rules were chosen for; pass it
+	// with Version to GET /policy/changes
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// PolicyCategory is a category as the proxy applies it
+type PolicyCategory struct {
+	Action  string   `json:"action"`
+	Domains []string `json:"domains"`
+}
+
+// ChangeResponse answers POST /policy/add and DELETE /policy/remove
+type ChangeResponse struct {
+	Status       string `json:"status"` // added, already_exists, removed or not_found
+	Domain       string `json:"domain"`
+	TotalBlocked int    `json:"total_blocked"`
+	Version      int64  `json:"version"`
+	Message      string `json:"message,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Options configures optional API behaviour
+type Options struct {
+	// AdminToken protects the endpoints that change policy. Without it or
+	// Users, those endpoints answer 401 unless InsecureNoAuth is set.
+	AdminToken string
+	// Users sign in with their own tokens and are allowed what their role
+	// is. The admin token signs in as an approver.
+	Users []User
+	// InsecureNoAuth leaves the endpoints that need a role open to anyone,
+	// as an approver, when there is no AdminToken or Users; for local
+	// development only
+	InsecureNoAuth bool
+	// RequireApproval holds high-impact changes, such as blocking a whole
+	// category, until a second approver approves them
+	RequireApproval bool
+	// Audit records the changes made through the API and admins signing
+	// in; nil records none
+	Audit *audit.Log
+	// Signer signs the policy documents proxies apply, GET /policy and
+	// GET /policy/changes; nil leaves them unsigned
+	Signer *signing.Signer
+	// HTTPMetrics, when set, are served on GET /metrics; the server wraps
+	// its handler in HTTPMetrics.Middleware
+	HTTPMetrics *middleware.Metrics
+	// RateLimit limits each client's requests to the endpoints that need
+	// a role; nil leaves them unlimited
+	RateLimit *ratelimit.Limiter
+	// Logger is what the API logs to; nil logs with slog.Default()
+	Logger *slog.Logger
+}
+
+// API serves the policy kept in a store
+type API struct {
+	store     *store.File
+	importer  *importer.Importer
+	hits      hitTracker
+	approvals approvals
+	streams   streams
+	opts      Options
+	logins    *audit.Logins
+	now       func() time.Time
+	log       *slog.Logger
+	// mux serves the approved changes replayed by ApproveChange
+	mux *http.ServeMux
+}
+
+// NewAPI creates an API over the given store
+func NewAPI(s *store.File, opts Options) *API {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	im := importer.New(s)
+	im.SetAudit(opts.Audit)
+	im.SetLogger(opts.Logger)
+	return &API{store: s, importer: im, opts: opts, logins: audit.NewLogins(opts.Audit, adminLoginWindow), now: time.Now, log: opts.Logger}
+}
+
+// Register adds the API's routes to mux, with their OpenAPI document on
+// GET /openapi.json
+func (a *API) Register(mux *http.ServeMux) {
+	a.mux = mux
+	spec := a.spec()
+	api := spec.Mux(mux)
+	bearer := ""
+	if !a.devMode() {
+		bearer = "bearer"
+		spec.Security(bearer, openapi.Bearer("The admin token, or a user's token; the user's role must allow the endpoint"))
+	}
+	// role registers a route only users with role or above may use
+	role := func(pattern, role string, handler http.HandlerFunc, op openapi.Operation) {
+		op.Auth = bearer
+		op.Description = "Needs the " + role + " role."
+		api.HandleFunc(pattern, a.limit(a.requireRole(role, handler)), op)
+	}
+	// held is the answer of changes held for approval
+	var held map[int]any
+	if a.opts.RequireApproval {
+		held = map[int]any{http.StatusAccepted: Approval{}}
+	}
+	scope := openapi.Params("group", "device", "at")
+
+	api.HandleFunc("GET /{$}", a.Index, openapi.Operation{
+		Summary:  "Service identification",
+		Response: openapi.Object{"service": "", "status": "", "version": ""},
+	})
+	api.HandleFunc("GET /health", a.Health, openapi.Operation{
+		Summary:  "Health check, with blocklist sources counted by health",
+		Response: openapi.Object{"status": "", "sources": map[string]int{}, "subscribers": 0},
+	})
+	role("GET /health/sources", RoleViewer, a.SourceHealth, openapi.Operation{
+		Summary:  "How each blocklist source's refreshes are going",
+		Response: openapi.Object{"status": "", "sources": []SourceHealth{}, "total": 0},
+	})
+	api.Handle("GET /healthz", middleware.Healthz(nil), openapi.Operation{
+		Summary:  "Readiness check",
+		Response: openapi.Object{"status": "", "checks": openapi.Optional(map[string]string{})},
+	})
+	if a.opts.HTTPMetrics != nil {
+		api.Handle("GET /metrics", a.opts.HTTPMetrics.Handler(), openapi.Operation{
+			Summary:      "Prometheus metrics",
+			ResponseType: "text/plain",
+		})
+	}
+	api.HandleFunc("GET /policy", a.GetPolicy, openapi.Operation{
+		Summary:  "The blocklist and categories proxies enforce",
+		Query:    scope,
+		Response: PolicyResponse{},
+	})
+	api.HandleFunc("GET /policy/domains", a.ListDomains, openapi.Operation{
+		Summary:  "Blocked domains",
+		Response: openapi.Object{"domains": []string{}, "total": 0},
+	})
+	api.HandleFunc("GET /policy/changes", a.PolicyChanges, openapi.Operation{
+		Summary: "What changed since the policy a proxy holds",
+		Query: append([]openapi.Param{
+			{Name: "since", Type: "integer", Required: true, Description: "The version held"},
+			{Name: "since_time", Required: true, Description: "The generated_at of the version held"},
+		}, scope...),
+		Response: ChangesResponse{},
+	})
+	api.HandleFunc("GET /policy/stream", a.PolicyStream, openapi.Operation{
+		Summary:      "Policy versions as Server-Sent Events",
+		ResponseType: "text/event-stream",
+	})
+	api.HandleFunc("GET /policy/keys", a.PolicyKeys, openapi.Operation{
+		Summary:  "Public keys that policy documents are signed with",
+		Response: openapi.Object{"keys": []PolicyKey{}},
+	})
+	role("POST /policy/hits", RoleViewer, a.ReportHits, openapi.Operation{
+		Summary: "Report how often policy entries matched traffic",
+		Request: HitsReport{},
+		Status:  http.StatusNoContent,
+	})
+	api.HandleFunc("GET /ui/", a.UI, openapi.Operation{
+		Summary:      "Admin UI",
+		ResponseType: "text/html",
+	})
+	role("GET /entries", RoleViewer, a.SearchEntries, openapi.Operation{
+		Summary:  "Search everything the policy blocks or allows",
+		Query:    openapi.Params("q", "limit:integer"),
+		Response: openapi.Object{"entries": []Entry{}, "total": 0, "version": int64(0)},
+	})
+	role("GET /audit", RoleViewer, a.ListAudit, openapi.Operation{
+		Summary:  "Audit log of changes",
+		Query:    openapi.Params("actor", "action", "object", "since", "until", "limit:integer"),
+		Response: openapi.Object{"events": []audit.Event{}, "total": 0},
+	})
+	role("GET /audit/verify", RoleViewer, a.VerifyAudit, openapi.Operation{
+		Summary:  "Verify the audit log's hash chain",
+		Response: openapi.Object{"ok": true, "events": 0},
+	})
+	role("POST /policy/add", RoleEditor, a.AddDomain, openapi.Operation{
+		Summary:   "Block a domain",
+		Query:     []openapi.Param{{Name: "domain", Required: true}},
+		Status:    http.StatusCreated,
+		Response:  ChangeResponse{},
+		Responses: map[int]any{http.StatusOK: ChangeResponse{}},
+	})
+	role("DELETE /policy/remove", RoleEditor, a.RemoveDomain, openapi.Operation{
+		Summary:   "Unblock a domain",
+		Query:     []openapi.Param{{Name: "domain", Required: true}},
+		Response:  ChangeResponse{},
+		Responses: map[int]any{http.StatusNotFound: ChangeResponse{}},
+	})
+	role("POST /policy/test", RoleViewer, a.TestPolicy, openapi.Operation{
+		Summary:  "Verdicts on URLs under the current policy and proposed changes",
+		Query:    scope,
+		Request:  PolicyTestInput{},
+		Response: openapi.Object{"group": "", "at": time.Time{}, "version": int64(0), "results": []PolicyTestResult{}, "total": 0, "changed": 0},
+	})
+	role("GET /lookup", RoleViewer, a.Lookup, openapi.Operation{
+		Summary:  "Whether the proxy blocks a domain, and why",
+		Query:    append([]openapi.Param{{Name: "domain", Required: true}}, scope...),
+		Response: LookupResponse{},
+	})
+	role("GET /policy/history", RoleViewer, a.ListHistory, openapi.Operation{
+		Summary:  "Versions kept for rollback",
+		Response: openapi.Object{"revisions": []store.Revision{}, "total": 0, "version": int64(0)},
+	})
+	role("GET /policy/history/{version}", RoleViewer, a.GetRevision, openapi.Operation{
+		Summary:  "One version's changes",
+		Query:    openapi.Params("against:integer"),
+		Response: store.Revision{},
+	})
+	role("GET /policy/export", RoleViewer, a.ExportPolicy, openapi.Operation{
+		Summary:      "The policy as a YAML document",
+		ResponseType: "application/yaml",
+	})
+	role("POST /policy/import", RoleEditor, a.requireApproval(importImpact, a.ImportPolicy), openapi.Operation{
+		Summary:     "Replace the policy with a YAML document",
+		Query:       openapi.Params("dry_run:boolean"),
+		RequestType: "application/yaml",
+		Response:    ImportResponse{},
+		Responses:   held,
+	})
+	role("POST /policy/rollback", RoleEditor, a.requireApproval(always("rollback"), a.Rollback), openapi.Operation{
+		Summary:   "Restore an earlier version",
+		Request:   RollbackRequest{},
+		Response:  RollbackResponse{},
+		Responses: held,
+	})
+	role("GET /rules", RoleViewer, a.ListRules, openapi.Operation{
+		Summary:  "List rules",
+		Query:    openapi.Params("type", "category", "group", "state"),
+		Response: openapi.Object{"rules": []store.Rule{}, "total": 0, "version": int64(0)},
+	})
+	role("POST /rules", RoleEditor, a.requireApproval(patternRule, a.CreateRule), openapi.Operation{
+		Summary:   "Create a rule",
+		Request:   RuleInput{},
+		Status:    http.StatusCreated,
+		Response:  RuleResponse{},
+		Responses: held,
+	})
+	role("GET /rules/{id}", RoleViewer, a.GetRule, openapi.Operation{
+		Summary:  "Get a rule",
+		Response: store.Rule{},
+	})
+	role("PUT /rules/{id}", RoleEditor, a.requireApproval(patternRule, a.UpdateRule), openapi.Operation{
+		Summary:   "Replace a rule",
+		Request:   RuleInput{},
+		Response:  RuleResponse{},
+		Responses: held,
+	})
+	role("DELETE /rules/{id}", RoleEditor, a.DeleteRule, openapi.Operation{
+		Summary: "Delete a rule",
+		Status:  http.StatusNoContent,
+	})
+	role("GET /categories", RoleViewer, a.ListCategories, openapi.Operation{
+		Summary:  "List categories, without their domains",
+		Response: openapi.Object{"categories": []CategorySummary{}, "total": 0, "version": int64(0)},
+	})
+	role("POST /categories", RoleEditor, a.requireApproval(blockCategory, a.CreateCategory), openapi.Operation{
+		Summary:   "Create a category",
+		Request:   CategoryInput{},
+		Status:    http.StatusCreated,
+		Response:  CategoryResponse{},
+		Responses: held,
+	})
+	role("GET /categories/{name}", RoleViewer, a.GetCategory, openapi.Operation{
+		Summary:  "Get a category with its domains",
+		Response: store.Category{},
+	})
+	role("PUT /categories/{name}", RoleEditor, a.requireApproval(blockCategory, a.UpdateCategory), openapi.Operation{
+		Summary:   "Replace a category",
+		Request:   CategoryInput{},
+		Response:  CategoryResponse{},
+		Responses: held,
+	})
+	role("DELETE /categories/{name}", RoleEditor, a.requireApproval(always("category delete"), a.DeleteCategory), openapi.Operation{
+		Summary:   "Delete a category",
+		Status:    http.StatusNoContent,
+		Responses: held,
+	})
+	role("POST /categories/{name}/domains", RoleEditor, a.requireApproval(a.blockCategoryDomains, a.AddCategoryDomains), openapi.Operation{
+		Summary:   "Add domains to a category",
+		Request:   openapi.Object{"domains": []string{}},
+		Response:  CategoryResponse{},
+		Responses: held,
+	})
+	role("DELETE /categories/{name}/domains/{domain}", RoleEditor, a.RemoveCategoryDomain, openapi.Operation{
+		Summary:  "Remove a domain from a category",
+		Response: CategoryResponse{},
+	})
+	role("GET /groups", RoleViewer, a.ListGroups, openapi.Operation{
+		Summary:  "List groups with their devices",
+		Response: openapi.Object{"groups": []store.Group{}, "total": 0, "version": int64(0)},
+	})
+	role("POST /groups", RoleEditor, a.CreateGroup, openapi.Operation{
+		Summary:  "Create a group",
+		Request:  GroupInput{},
+		Status:   http.StatusCreated,
+		Response: GroupResponse{},
+	})
+	role("GET /groups/{name}", RoleViewer, a.GetGroup, openapi.Operation{
+		Summary:  "Get a group",
+		Response: store.Group{},
+	})
+	role("PUT /groups/{name}", RoleEditor, a.UpdateGroup, openapi.Operation{
+		Summary:  "Replace a group",
+		Request:  GroupInput{},
+		Response: GroupResponse{},
+	})
+	role("DELETE /groups/{name}", RoleEditor, a.DeleteGroup, openapi.Operation{
+		Summary: "Delete a group",
+		Status:  http.StatusNoContent,
+	})
+	role("PUT /groups/{name}/devices/{device}", RoleEditor, a.AssignDevice, openapi.Operation{
+		Summary:  "Add a device to a group",
+		Response: GroupResponse{},
+	})
+	role("DELETE /groups/{name}/devices/{device}", RoleEditor, a.UnassignDevice, openapi.Operation{
+		Summary:  "Remove a device from a group",
+		Response: GroupResponse{},
+	})
+	// A new flag is created, and may be held like the other changes
+	flagSet := map[int]any{http.StatusCreated: FlagResponse{}}
+	for status, body := range held {
+		flagSet[status] = body
+	}
+	api.HandleFunc("GET /flags", a.GetFlags, openapi.Operation{
+		Summary:  "Feature flag values proxies and agents apply",
+		Response: flags.Document{},
+	})
+	role("GET /flags/{name}", RoleViewer, a.GetFlag, openapi.Operation{
+		Summary:  "Get a feature flag",
+		Response: store.Flag{},
+	})
+	role("PUT /flags/{name}", RoleEditor, a.requireApproval(fleetWideFlag, a.SetFlag), openapi.Operation{
+		Summary:   "Set a feature flag for the fleet",
+		Request:   FlagInput{},
+		Response:  FlagResponse{},
+		Responses: flagSet,
+	})
+	role("DELETE /flags/{name}", RoleEditor, a.DeleteFlag, openapi.Operation{
+		Summary: "Delete a feature flag",
+		Status:  http.StatusNoContent,
+	})
+	role("GET /feeds", RoleViewer, a.ListFeeds, openapi.Operation{
+		Summary:  "Threat feeds a source can import",
+		Response: openapi.Object{"feeds": []importer.Feed{}, "total": 0},
+	})
+	role("GET /sources", RoleViewer, a.ListSources, openapi.Operation{
+		Summary:  "List blocklist sources",
+		Response: openapi.Object{"sources": []SourceSummary{}, "total": 0, "version": int64(0)},
+	})
+	role("POST /sources", RoleEditor, a.requireApproval(always("blocklist source"), a.CreateSource), openapi.Operation{
+		Summary:   "Add a blocklist source and import it",
+		Request:   SourceInput{},
+		Status:    http.StatusCreated,
+		Response:  SourceResponse{},
+		Responses: held,
+	})
+	role("GET /sources/{name}", RoleViewer, a.GetSource, openapi.Operation{
+		Summary:  "Get a blocklist source",
+		Response: SourceSummary{},
+	})
+	role("DELETE /sources/{name}", RoleEditor, a.requireApproval(always("blocklist source delete"), a.DeleteSource), openapi.Operation{
+		Summary:   "Delete a blocklist source and unblock its domains",
+		Status:    http.StatusNoContent,
+		Responses: held,
+	})
+	role("POST /sources/{name}/refresh", RoleEditor, a.RefreshSource, openapi.Operation{
+		Summary:   "Import a blocklist source again now",
+		Response:  SourceResponse{},
+		Responses: map[int]any{http.StatusBadGateway: SourceResponse{}},
+	})
+	role("GET /approvals", RoleViewer, a.ListApprovals, openapi.Operation{
+		Summary:  "Changes held for approval",
+		Query:    openapi.Params("status"),
+		Response: openapi.Object{"approvals": []Approval{}, "total": 0},
+	})
+	role("GET /approvals/{id}", RoleViewer, a.GetApproval, openapi.Operation{
+		Summary:  "Get a change held for approval",
+		Response: Approval{},
+	})
+	decision := openapi.Object{"comment": openapi.Optional("")}
+	role("POST /approvals/{id}/approve", RoleApprover, a.ApproveChange, openapi.Operation{
+		Summary:  "Approve and make a change",
+		Request:  decision,
+		Response: Approval{},
+	})
+	role("POST /approvals/{id}/reject", RoleApprover, a.RejectChange, openapi.Operation{
+		Summary:  "Reject a change",
+		Request:  decision,
+		Response: Approval{},
+	})
+	mux.Handle("GET /openapi.json", spec)
+}
+
+// spec starts the API's OpenAPI document, with errorResponse as the body
+// of every error
+func (a *API) spec() *openapi.Spec {
+	spec := openapi.New(openapi.Info{
+		Title:       "SWG Policy Engine",
+		Version:     Version,
+		Description: "Serves the web gateway's blocklist to proxies, and its rules, categories, groups and sources to admins.",
+	})
+	spec.Errors(errorResponse{})
+	return spec
+}
+
+// Index identifies the service
+func (a *API) Index(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"service": "Cisco SWG Policy Engine",
+		"status":  "running",
+		"version": Version,
+	})
+}
+
+// Health answers container and load balancer health checks. It also
+// counts the blocklist sources by health, which doesn't make the policy
+// engine unhealthy: GET /health/sources has the details. subscribers is
+// the number of proxies on GET /policy/stream.
+func (a *API) Health(w http.ResponseWriter, r *http.Request) {
+	sources := map[string]int{store.HealthOK: 0, store.HealthFailing: 0, store.HealthStale: 0, store.HealthPending: 0}
+	now := a.now()
+	for _, s := range a.store.Policy().Sources {
+		sources[s.Health(now)]++
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "healthy", "sources": sources, "subscribers": a.streams.subscribed()})
+}
+
+// GetPolicy serves the current blocklist to proxies. Scheduled rules are
+// included only while they are in effect and their window is open, so
+// their changes show within one proxy refresh. ?at= previews the policy at
+// another time, e.g. to check a campaign configured ahead of time.
+//
+// ?group= adds the rules scoped to that group to the ones that apply to
+// everyone; ?device= does the same for the group the device is in, and
+// gets only the rules for everyone if it is in none.
+func (a *API) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	p := a.store.Policy()
+	group, at, ok := a.policyScope(w, r, p)
+	if !ok {
+		return
+	}
+	b := p.Blocked(at, group)
+	categories := policyCategories(p)
+	a.log.InfoContext(r.Context(), "policy requested", "version", p.Version, "remote_addr", r.RemoteAddr, "group", group, "domains", len(b.Domains),
+		"exact", len(b.Exact), "wildcards", len(b.Wildcards), "regexes", len(b.Regexes), "categories", len(categories))
+	a.writeSigned(w, http.StatusOK, cryptoutil.PolicyDocument, 0, at, PolicyResponse{
+		Group:       group,
+		Blocked:     b.Domains,
+		Exact:       b.Exact,
+		Wildcards:   b.Wildcards,
+		Regexes:     b.Regexes,
+		Categories:  categories,
+		Total:       b.Len(),
+		Version:     p.Version,
+		LastUpdated: p.UpdatedAt,
+		GeneratedAt: at,
+	})
+}
+
+// policyScope reads the group and time a policy is requested for from
+// ?group= or ?device= and ?at=, answering 400 or 404 if they are invalid
+func (a *API) policyScope(w http.ResponseWriter, r *http.Request, p store.Policy) (group string, at time.Time, ok bool) {
+	q := r.URL.Query()
+	group = q.Get("group")
+	switch {
+	case group != "" && q.Has("device"):
+		writeError(w, http.StatusBadRequest, "give group or device, not both")
+		return "", time.Time{}, false
+	case group != "":
+		if _, ok := p.Group(group); !ok {
+			writeError(w, http.StatusNotFound, store.ErrGroupNotFound.Error())
+			return "", time.Time{}, false
+		}
+	case q.Get("device") != "":
+		device, err := store.NormalizeDevice(q.Get("device"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return "", time.Time{}, false
+		}
+		group, _ = p.DeviceGroup(device)
+	}
+	at = a.now().UTC()
+	if v := q.Get("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "at must be an RFC 3339 time such as 2026-06-01T09:00:00Z")
+			return "", time.Time{}, false
+		}
+		at = t
+	}
+	return group, at, true
+}
+
+// policyCategories returns the categories of p as the proxy applies them
+func policyCategories(p store.Policy) map[string]PolicyCategory {
+	categories := make(map[string]PolicyCategory, len(p.Categories))
+	for _, c := range p.Categories {
+		categories[c.Name] = PolicyCategory{Action: c.Action, Domains: c.Domains}
+	}
+	return categories
+}
+
+// ListDomains lists the domains of the domain rules, sorted
+func (a *API) ListDomains(w http.ResponseWriter, r *http.Request) {
+	domains := a.store.Policy().Domains()
+	writeJSON(w, http.StatusOK, map[string]any{"domains": domains, "total": len(domains)})
+}
+
+// AddDomain blocks ?domain= (or a form field of that name)
+func (a *API) AddDomain(w http.ResponseWriter, r *http.Request) {
+	domain, err := store.NormalizeDomain(r.FormValue("domain"))
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	p, err := a.store.AddDomain(domain)
+	resp := ChangeResponse{Domain: domain, TotalBlocked: len(p.Domains()), Version: p.Version}
+	switch {
+	case errors.Is(err, store.ErrExists):
+		resp.Status, resp.Message = "already_exists", domain+" is already in the blocklist"
+		writeJSON(w, http.StatusOK, resp)
+	case err != nil:
+		a.log.ErrorContext(r.Context(), "failed to add domain", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+	default:
+		a.log.InfoContext(r.Context(), "domain added to blocklist", "domain", domain, "version", p.Version)
+		a.audit(r, "domain.add", "domain "+domain, "", p.Version)
+		resp.Status = "added"
+		writeJSON(w, http.StatusCreated, resp)
+	}
+}
+
+// RemoveDomain unblocks ?domain=, deleting all of its domain rules
+func (a *API) RemoveDomain(w http.ResponseWriter, r *http.Request) {
+	domain, err := store.NormalizeDomain(r.FormValue("domain"))
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	p, err := a.store.RemoveDomain(domain)
+	resp := ChangeResponse{Domain: domain, TotalBlocked: len(p.Domains()), Version: p.Version}
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		resp.Status, resp.Message = "not_found", domain+" is not in the blocklist"
+		writeJSON(w, http.StatusNotFound, resp)
+	case err != nil:
+		a.log.ErrorContext(r.Context(), "failed to remove domain", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+	default:
+		a.log.InfoContext(r.Context(), "domain removed from blocklist", "domain", domain, "version", p.Version)
+		a.audit(r, "domain.remove", "domain "+domain, "", p.Version)
+		resp.Status = "removed"
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// readJSON decodes a JSON body of at most limit bytes into v, answering
+// 400 if it is malformed or has unknown fields
+func readJSON(w http.ResponseWriter, r *http.Request, limit int64, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeSigned writes v as JSON like writeJSON, with the signature of the
+// body and the signing key's ID in headers if the API has a signer. The
+// signature covers the document type, the version a delta applies to and
+// when the document was generated, so a proxy can't be given one in place
+// of another.
+func (a *API) writeSigned(w http.ResponseWriter, code int, document string, since int64, generatedAt time.Time, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to encode policy")
+		return
+	}
+	body = append(body, '\n')
+	if s := a.opts.Signer; s != nil {
+		w.Header().Set(signing.HeaderSignature, s.Sign(cryptoutil.PolicyMessage(body, document, since, generatedAt)))
+		w.Header().Set(signing.HeaderKeyID, s.ID())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// PolicyKey is a key proxies can verify policy signatures with
+type PolicyKey struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"` // PEM
+}
+
+// PolicyKeys lists the keys policy documents are signed with. Proxies
+// should be given the key out of band and pinned with -policy-key: one
+// fetched over the connection it protects is only as trustworthy as that
+// connection.
+func (a *API) PolicyKeys(w http.ResponseWriter, r *http.Request) {
+	keys := []PolicyKey{}
+	if s := a.opts.Signer; s != nil {
+		keys = append(keys, PolicyKey{ID: s.ID(), Algorithm: signing.Algorithm, PublicKey: string(s.PublicKeyPEM())})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Error: msg})
+}
@@ -0,0 +1,1474 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/openapi"
+	"github.com/nisatyap/shared/ratelimit"
+	"github.com/nisatyap/week2-swg/policy-engine/importer"
+	"github.com/nisatyap/week2-swg/policy-engine/signing"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+func newTestServer(t *testing.T) *http.ServeMux {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), []string{"facebook.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewAPI(s, Options{InsecureNoAuth: true}).Register(mux)
+	return mux
+}
+
+func do(mux *http.ServeMux, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestPolicy(t *testing.T) {
+	mux := newTestServer(t)
+
+	rec := do(mux, http.MethodPost, "/policy/add?domain=TikTok.com")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /policy/add = %d: %s", rec.Code, rec.Body)
+	}
+	var change ChangeResponse
+	json.Unmarshal(rec.Body.Bytes(), &change)
+	if change.Status != "added" || change.Domain != "tiktok.com" || change.TotalBlocked != 2 || change.Version != 2 {
+		t.Errorf("add response = %+v", change)
+	}
+	if rec := do(mux, http.MethodPost, "/policy/add?domain=tiktok.com"); rec.Code != http.StatusOK {
+		t.Errorf("adding twice = %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodPost, "/policy/add?domain=http://bad"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("adding an invalid domain = %d", rec.Code)
+	}
+
+	// The proxy's view of the policy
+	rec = do(mux, http.MethodGet, "/policy")
+	var policy struct {
+		Blocked []string `json:"blocked"`
+		Version int64    `json:"version"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &policy)
+	if rec.Code != http.StatusOK || len(policy.Blocked) != 2 || policy.Blocked[1] != "tiktok.com" || policy.Version != 2 {
+		t.Errorf("GET /policy = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(mux, http.MethodDelete, "/policy/remove?domain=facebook.com"); rec.Code != http.StatusOK {
+		t.Errorf("DELETE /policy/remove = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, http.MethodDelete, "/policy/remove?domain=facebook.com"); rec.Code != http.StatusNotFound {
+		t.Errorf("removing twice = %d", rec.Code)
+	}
+	rec = do(mux, http.MethodGet, "/policy/domains")
+	var list struct {
+		Domains []string `json:"domains"`
+		Total   int      `json:"total"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if list.Total != 1 || list.Domains[0] != "tiktok.com" {
+		t.Errorf("GET /policy/domains = %s", rec.Body)
+	}
+}
+
+func doAuth(mux *http.ServeMux, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRules(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI(s, Options{AdminToken: "admin-secret"})
+	// Monday 10:00 UTC
+	api.now = func() time.Time { return time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC) }
+	mux := http.NewServeMux()
+	api.Register(mux)
+
+	if rec := doAuth(mux, http.MethodPost, "/rules", "", `{"domain":"example.com"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /rules without token = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/policy/add?domain=example.com", "wrong", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /policy/add with wrong token = %d", rec.Code)
+	}
+	for _, body := range []string{
+		`{"type":"glob","domain":"example.com"}`,
+		`{"type":"regex","domain":"ads(-[0-9]+\\.example\\.com"}`,
+		`{"type":"regex","domain":".*"}`,
+		`{"type":"exact","domain":"*.example.com"}`,
+		`{"type":"wildcard","domain":"example.com"}`,
+		`{"domain":"*.example.com"}`,
+		`{"domain":"example.com","category":"Social Media"}`,
+		`{"domain":"example.com","schedule":{"start":"9am","end":"17:00"}}`,
+		`{"domain":"example.com","schedule":{"days":["funday"],"start":"09:00","end":"17:00"}}`,
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/rules", "admin-secret", body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("POST /rules %s = %d", body, rec.Code)
+		}
+	}
+
+	create := func(body string) RuleResponse {
+		t.Helper()
+		rec := doAuth(mux, http.MethodPost, "/rules", "admin-secret", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("POST /rules %s = %d: %s", body, rec.Code, rec.Body)
+		}
+		var resp RuleResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+	social := create(`{"domain":"Facebook.com","category":"social"}`)
+	create(`{"type":"wildcard","domain":"ads-*.example.com","category":"ads"}`)
+	// Active on weekday business hours only
+	create(`{"domain":"youtube.com","schedule":{"days":["mon","tue","wed","thu","fri"],"start":"09:00","end":"17:00"}}`)
+	night := create(`{"domain":"games.example","schedule":{"start":"22:00","end":"06:00"}}`)
+	if social.Rule.ID != 1 || social.Rule.Domain != "facebook.com" || night.Version != 5 {
+		t.Errorf("created rules %+v, %+v", social, night)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/rules", "admin-secret", `{"domain":"facebook.com"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate rule = %d", rec.Code)
+	}
+
+	policy := func() PolicyResponse {
+		t.Helper()
+		var p PolicyResponse
+		json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &p)
+		return p
+	}
+	p := policy()
+	if strings.Join(p.Blocked, ",") != "facebook.com,youtube.com" || strings.Join(p.Wildcards, ",") != "ads-*.example.com" || p.Total != 3 {
+		t.Errorf("policy on Monday morning = %+v", p)
+	}
+
+	// Saturday 23:00: only the overnight rule and the unscheduled ones
+	api.now = func() time.Time { return time.Date(2026, 3, 7, 23, 0, 0, 0, time.UTC) }
+	if p := policy(); strings.Join(p.Blocked, ",") != "facebook.com,games.example" {
+		t.Errorf("policy on Saturday night = %+v", p.Blocked)
+	}
+
+	// Changes take effect on the next GET /policy
+	rec := doAuth(mux, http.MethodPut, "/rules/1", "admin-secret", `{"domain":"instagram.com","category":"social"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT /rules/1 = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodDelete, "/rules/4", "admin-secret", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE /rules/4 = %d", rec.Code)
+	}
+	if p := policy(); strings.Join(p.Blocked, ",") != "instagram.com" || p.Version != 7 {
+		t.Errorf("policy after update and delete = %+v", p)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/rules/4", "admin-secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted rule = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPut, "/rules/99", "admin-secret", `{"domain":"example.com"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("PUT missing rule = %d", rec.Code)
+	}
+
+	var list struct {
+		Rules []store.Rule `json:"rules"`
+		Total int          `json:"total"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/rules?category=social", "admin-secret", "").Body.Bytes(), &list)
+	if list.Total != 1 || list.Rules[0].Domain != "instagram.com" {
+		t.Errorf("GET /rules?category=social = %+v", list)
+	}
+}
+
+func TestRuleTypes(t *testing.T) {
+	mux := newTestServer(t)
+	var full PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &full)
+
+	for _, body := range []string{
+		`{"type":"exact","domain":"login.example.org"}`,
+		`{"type":"regex","domain":"ads[0-9]+\\.tracker\\.net"}`,
+		`{"type":"domain","domain":"tiktok.com"}`, // the old name of suffix
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/rules", "", body); rec.Code != http.StatusCreated {
+			t.Fatalf("POST /rules %s = %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+	// A regex that doesn't compile is refused before it is published
+	rec := doAuth(mux, http.MethodPost, "/rules", "", `{"type":"regex","domain":"ads(-[0-9]+"}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "missing closing )") {
+		t.Errorf("POST /rules with an invalid regex = %d: %s", rec.Code, rec.Body)
+	}
+
+	var p PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &p)
+	if strings.Join(p.Blocked, ",") != "facebook.com,tiktok.com" || strings.Join(p.Exact, ",") != "login.example.org" ||
+		strings.Join(p.Regexes, ",") != `ads[0-9]+\.tracker\.net` || len(p.Wildcards) != 0 || p.Total != 4 {
+		t.Errorf("policy = %+v", p)
+	}
+
+	var c ChangesResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy/changes?since=1&since_time="+full.GeneratedAt.Format(time.RFC3339Nano)).Body.Bytes(), &c)
+	if strings.Join(c.Added, ",") != "tiktok.com" || strings.Join(c.ExactAdded, ",") != "login.example.org" ||
+		strings.Join(c.RegexesAdded, ",") != `ads[0-9]+\.tracker\.net` || len(c.ExactRemoved)+len(c.RegexesRemoved) != 0 {
+		t.Errorf("changes since v1 = %+v", c)
+	}
+
+	var list struct {
+		Rules []store.Rule `json:"rules"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/rules?type=domain", "", "").Body.Bytes(), &list)
+	if len(list.Rules) != 2 || list.Rules[1].Type != store.TypeSuffix {
+		t.Errorf("GET /rules?type=domain = %+v", list.Rules)
+	}
+}
+
+func TestNoCredentials(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), []string{"facebook.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		opts     Options
+		wantCode int
+	}{
+		{"closed by default", Options{}, http.StatusUnauthorized},
+		{"open with InsecureNoAuth", Options{InsecureNoAuth: true}, http.StatusCreated},
+		{"credentials win over InsecureNoAuth", Options{InsecureNoAuth: true, AdminToken: "admin-secret"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			NewAPI(s, tt.opts).Register(mux)
+			if rec := do(mux, http.MethodPost, "/policy/add?domain=tiktok.com"); rec.Code != tt.wantCode {
+				t.Errorf("POST /policy/add without a token = %d, want %d", rec.Code, tt.wantCode)
+			}
+			s.RemoveDomain("tiktok.com")
+			if rec := do(mux, http.MethodGet, "/policy"); rec.Code != http.StatusOK {
+				t.Errorf("GET /policy = %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestCategories(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), []string{"facebook.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewAPI(s, Options{AdminToken: "admin-secret"}).Register(mux)
+
+	if rec := doAuth(mux, http.MethodGet, "/categories", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /categories without token = %d", rec.Code)
+	}
+	for _, body := range []string{
+		`{"name":"Social Media"}`,
+		`{"name":"social","action":"redirect"}`,
+		`{"name":"social","domains":["http://bad"]}`,
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/categories", "admin-secret", body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("POST /categories %s = %d", body, rec.Code)
+		}
+	}
+	if rec := doAuth(mux, http.MethodPost, "/categories", "admin-secret", `{"name":"social","colour":"red"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /categories with an unknown field = %d", rec.Code)
+	}
+
+	rec := doAuth(mux, http.MethodPost, "/categories", "admin-secret", `{"name":"social","domains":["TikTok.com","instagram.com"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /categories = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/categories", "admin-secret", `{"name":"social"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate category = %d", rec.Code)
+	}
+	// facebook.com is blocked by a rule but allowed by a category
+	if rec := doAuth(mux, http.MethodPost, "/categories", "admin-secret", `{"name":"work","action":"allow","domains":["facebook.com"]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /categories allow = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = doAuth(mux, http.MethodPost, "/categories/social/domains", "admin-secret", `{"domains":["reddit.com","tiktok.com"]}`)
+	var resp CategoryResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || strings.Join(resp.Category.Domains, ",") != "instagram.com,reddit.com,tiktok.com" {
+		t.Errorf("POST /categories/social/domains = %d %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodDelete, "/categories/social/domains/instagram.com", "admin-secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("DELETE member = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodDelete, "/categories/social/domains/instagram.com", "admin-secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE missing member = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPut, "/categories/social", "admin-secret", `{"name":"gaming"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("renaming with PUT = %d", rec.Code)
+	}
+
+	var p PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &p)
+	if c := p.Categories["social"]; c.Action != store.ActionBlock || strings.Join(c.Domains, ",") != "reddit.com,tiktok.com" {
+		t.Errorf("social in /policy = %+v", c)
+	}
+	if c := p.Categories["work"]; c.Action != store.ActionAllow || len(c.Domains) != 1 {
+		t.Errorf("work in /policy = %+v", c)
+	}
+
+	if rec := doAuth(mux, http.MethodDelete, "/categories/social", "admin-secret", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE /categories/social = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/categories/social", "admin-secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted category = %d", rec.Code)
+	}
+	var list struct {
+		Total int `json:"total"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/categories", "admin-secret", "").Body.Bytes(), &list)
+	if list.Total != 1 {
+		t.Errorf("GET /categories total = %d", list.Total)
+	}
+}
+
+func TestSources(t *testing.T) {
+	status := http.StatusOK
+	lists := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("||ads.example.com^\n||tracker.example.com^\n"))
+	}))
+	defer lists.Close()
+	mux := newTestServer(t)
+
+	for _, body := range []string{
+		`{"name":"ads","url":"ftp://example.com/list","format":"adblock"}`,
+		`{"name":"ads","format":"adblock"}`,
+		`{"name":"ads","url":"` + lists.URL + `","format":"csv"}`,
+		`{"name":"ads","url":"` + lists.URL + `","format":"adblock","refresh":"1s"}`,
+		`{"name":"ads","url":"` + lists.URL + `","format":"adblock","refresh":"6h","expire":"1h"}`,
+		`{"feed":"nosuchfeed"}`,
+		`{"feed":"urlhaus","url":"` + lists.URL + `"}`,
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/sources", "", body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("POST /sources %s = %d", body, rec.Code)
+		}
+	}
+
+	rec := doAuth(mux, http.MethodPost, "/sources", "", `{"name":"ads","url":"`+lists.URL+`","format":"adblock","refresh":"6h"}`)
+	var resp SourceResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusCreated || resp.Source.Domains != 2 || resp.Source.LastDiff.Added != 2 || resp.Error != "" {
+		t.Fatalf("POST /sources = %d: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"refresh":"6h0m0s"`) {
+		t.Errorf("refresh interval in %s", rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/sources", "", `{"name":"ads","url":"`+lists.URL+`","format":"adblock"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate source = %d", rec.Code)
+	}
+
+	var p PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &p)
+	if strings.Join(p.Blocked, ",") != "ads.example.com,facebook.com,tracker.example.com" {
+		t.Errorf("blocked with an imported list = %v", p.Blocked)
+	}
+
+	status = http.StatusInternalServerError
+	rec = doAuth(mux, http.MethodPost, "/sources/ads/refresh", "", "")
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusBadGateway || resp.Error == "" || resp.Source.Domains != 2 {
+		t.Errorf("failed refresh = %d: %s", rec.Code, rec.Body)
+	}
+	var health struct {
+		Status  string         `json:"status"`
+		Sources []SourceHealth `json:"sources"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/health/sources", "", "").Body.Bytes(), &health)
+	if h := health.Sources; health.Status != "degraded" || len(h) != 1 || h[0].Health != store.HealthFailing ||
+		h[0].Failures != 1 || h[0].Domains != 2 || h[0].LastError == "" || h[0].StaleAfter != "18h0m0s" {
+		t.Errorf("GET /health/sources = %+v", health)
+	}
+	if rec := do(mux, http.MethodGet, "/health"); !strings.Contains(rec.Body.String(), `"failing":1`) {
+		t.Errorf("GET /health = %s", rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/sources/missing/refresh", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("refreshing a missing source = %d", rec.Code)
+	}
+
+	if rec := doAuth(mux, http.MethodDelete, "/sources/ads", "", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE /sources/ads = %d", rec.Code)
+	}
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &p)
+	if strings.Join(p.Blocked, ",") != "facebook.com" {
+		t.Errorf("blocked after deleting the source = %v", p.Blocked)
+	}
+
+	var feeds struct {
+		Feeds []importer.Feed `json:"feeds"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/feeds", "", "").Body.Bytes(), &feeds)
+	if len(feeds.Feeds) != len(importer.Feeds) || feeds.Feeds[0].Category == "" {
+		t.Errorf("GET /feeds = %+v", feeds)
+	}
+}
+
+func TestScheduledActivation(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI(s, Options{InsecureNoAuth: true})
+	api.now = func() time.Time { return time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC) }
+	mux := http.NewServeMux()
+	api.Register(mux)
+
+	if rec := doAuth(mux, http.MethodPost, "/rules", "", `{"domain":"netflix.com","effective_from":"2026-06-13T00:00:00Z","effective_until":"2026-06-08T00:00:00Z"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("backwards window = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/rules", "", `{"domain":"netflix.com","effective_from":"next week"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unparseable effective_from = %d", rec.Code)
+	}
+	// Exams week in London, configured a week ahead
+	body := `{"domain":"netflix.com","category":"streaming","effective_from":"2026-06-08T00:00:00+01:00","effective_until":"2026-06-13T00:00:00+01:00"}`
+	if rec := doAuth(mux, http.MethodPost, "/rules", "", body); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /rules = %d: %s", rec.Code, rec.Body)
+	}
+
+	blocked := func(path string) string {
+		t.Helper()
+		rec := do(mux, http.MethodGet, path)
+		var p PolicyResponse
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		return strings.Join(p.Blocked, ",")
+	}
+	if got := blocked("/policy"); got != "" {
+		t.Errorf("blocked before exams week = %q", got)
+	}
+	if got := blocked("/policy?at=2026-06-09T10:00:00Z"); got != "netflix.com" {
+		t.Errorf("blocked during exams week = %q", got)
+	}
+	if got := blocked("/policy?at=2026-06-12T23:30:00Z"); got != "" {
+		t.Errorf("blocked after exams week = %q", got)
+	}
+	if rec := do(mux, http.MethodGet, "/policy?at=tomorrow"); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /policy?at=tomorrow = %d", rec.Code)
+	}
+
+	var list struct {
+		Total int `json:"total"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/rules?state=scheduled", "", "").Body.Bytes(), &list)
+	if list.Total != 1 {
+		t.Errorf("scheduled rules = %d", list.Total)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	mux := newTestServer(t)
+
+	if rec := doAuth(mux, http.MethodPost, "/rules", "", `{"domain":"youtube.com","groups":["students"]}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("rule scoped to a missing group = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/groups", "", `{"name":"students","devices":["Lab-PC-01","lab-pc-02"]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /groups = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/groups", "", `{"name":"engineering","devices":["lab-pc-01"]}`); rec.Code != http.StatusConflict {
+		t.Errorf("device in two groups = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/groups", "", `{"name":"engineering","devices":["laptop 42"]}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid device = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/groups", "", `{"name":"engineering"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /groups = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPut, "/groups/engineering/devices/laptop-42", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("assigning a device = %d: %s", rec.Code, rec.Body)
+	}
+	for _, body := range []string{
+		`{"domain":"youtube.com","groups":["students"]}`,
+		`{"domain":"steampowered.com","groups":["students","engineering"]}`,
+		`{"domain":"facebook.com","groups":["students"]}`, // already blocked for everyone, but not a duplicate
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/rules", "", body); rec.Code != http.StatusCreated {
+			t.Fatalf("POST /rules %s = %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+
+	blocked := func(query string) string {
+		t.Helper()
+		rec := do(mux, http.MethodGet, "/policy"+query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /policy%s = %d: %s", query, rec.Code, rec.Body)
+		}
+		var p PolicyResponse
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		return strings.Join(p.Blocked, ",")
+	}
+	for query, want := range map[string]string{
+		"":                        "facebook.com",
+		"?group=students":         "facebook.com,steampowered.com,youtube.com",
+		"?group=engineering":      "facebook.com,steampowered.com",
+		"?device=LAB-PC-02":       "facebook.com,steampowered.com,youtube.com",
+		"?device=laptop-42":       "facebook.com,steampowered.com",
+		"?device=unknown-device1": "facebook.com",
+	} {
+		if got := blocked(query); got != want {
+			t.Errorf("GET /policy%s blocked %s, want %s", query, got, want)
+		}
+	}
+	if rec := do(mux, http.MethodGet, "/policy?group=missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /policy for a missing group = %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodGet, "/policy?group=students&device=laptop-42"); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /policy with group and device = %d", rec.Code)
+	}
+
+	if rec := doAuth(mux, http.MethodDelete, "/groups/engineering", "", ""); rec.Code != http.StatusConflict {
+		t.Errorf("deleting a group rules are scoped to = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodDelete, "/groups/engineering/devices/laptop-42", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("unassigning a device = %d", rec.Code)
+	}
+	if got := blocked("?device=laptop-42"); got != "facebook.com" {
+		t.Errorf("unassigned device blocked %s", got)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	mux := newTestServer(t)
+	doAuth(mux, http.MethodPost, "/policy/add?domain=tiktok.com", "", "")        // v2
+	doAuth(mux, http.MethodDelete, "/policy/remove?domain=facebook.com", "", "") // v3
+
+	var history struct {
+		Revisions []store.Revision `json:"revisions"`
+		Version   int64            `json:"version"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/policy/history", "", "").Body.Bytes(), &history)
+	if len(history.Revisions) != 3 || history.Version != 3 || history.Revisions[0].Changes.RulesRemoved[0].Domain != "facebook.com" {
+		t.Fatalf("GET /policy/history = %+v", history)
+	}
+
+	var rev store.Revision
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/policy/history/3?against=1", "", "").Body.Bytes(), &rev)
+	if c := rev.Changes; len(c.RulesAdded) != 1 || c.RulesAdded[0].Domain != "tiktok.com" || len(c.RulesRemoved) != 1 {
+		t.Errorf("v3 against v1 = %+v", c)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/policy/history/99", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET unknown revision = %d", rec.Code)
+	}
+
+	for body, want := range map[string]int{
+		`{"version":3}`:  http.StatusUnprocessableEntity,
+		`{"version":99}`: http.StatusNotFound,
+		`{"v":1}`:        http.StatusBadRequest,
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/policy/rollback", "", body); rec.Code != want {
+			t.Errorf("POST /policy/rollback %s = %d, want %d", body, rec.Code, want)
+		}
+	}
+	rec := doAuth(mux, http.MethodPost, "/policy/rollback", "", `{"version":1}`)
+	var resp RollbackResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.Version != 4 || resp.RestoredFrom != 1 {
+		t.Fatalf("POST /policy/rollback = %d: %s", rec.Code, rec.Body)
+	}
+	var p PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &p)
+	if strings.Join(p.Blocked, ",") != "facebook.com" || p.Version != 4 {
+		t.Errorf("policy after rollback = %+v", p)
+	}
+}
+
+func TestPolicyChanges(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), []string{"facebook.com", "tiktok.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI(s, Options{InsecureNoAuth: true})
+	monday := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	api.now = func() time.Time { return monday }
+	mux := http.NewServeMux()
+	api.Register(mux)
+
+	var full PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &full)
+
+	doAuth(mux, http.MethodDelete, "/policy/remove?domain=tiktok.com", "", "")
+	doAuth(mux, http.MethodPost, "/rules", "", `{"type":"wildcard","domain":"ads-*.example.com"}`)
+	doAuth(mux, http.MethodPost, "/rules", "", `{"domain":"youtube.com","schedule":{"start":"09:00","end":"17:00"}}`)
+	doAuth(mux, http.MethodPost, "/categories", "", `{"name":"social","domains":["reddit.com"]}`)
+	// An hour later the scheduled rule is active, with no new version
+	api.now = func() time.Time { return monday.Add(time.Hour) }
+
+	changes := func(query string) (int, ChangesResponse) {
+		t.Helper()
+		rec := do(mux, http.MethodGet, "/policy/changes"+query)
+		var resp ChangesResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+	code, c := changes("?since=1&since_time=" + full.GeneratedAt.Format(time.RFC3339Nano))
+	if code != http.StatusOK || c.Version != 5 ||
+		strings.Join(c.Added, ",") != "youtube.com" || strings.Join(c.Removed, ",") != "tiktok.com" ||
+		strings.Join(c.WildcardsAdded, ",") != "ads-*.example.com" || len(c.Categories["social"].Domains) != 1 {
+		t.Errorf("changes since v1 = %d %+v", code, c)
+	}
+
+	// Applying the delta to the full policy gives the current one
+	var current PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &current)
+	blocked := map[string]bool{}
+	for _, d := range full.Blocked {
+		blocked[d] = true
+	}
+	for _, d := range c.Added {
+		blocked[d] = true
+	}
+	for _, d := range c.Removed {
+		delete(blocked, d)
+	}
+	if len(blocked) != len(current.Blocked) {
+		t.Errorf("delta applied = %v, want %v", blocked, current.Blocked)
+	}
+
+	code, c = changes("?since=5&since_time=" + current.GeneratedAt.Format(time.RFC3339))
+	if code != http.StatusOK || len(c.Added)+len(c.Removed)+len(c.Categories)+len(c.CategoriesRemoved) != 0 {
+		t.Errorf("changes since the current version = %d %+v", code, c)
+	}
+	for query, want := range map[string]int{
+		"?since_time=2026-03-02T08:00:00Z":         http.StatusBadRequest,
+		"?since=1":                                 http.StatusBadRequest,
+		"?since=9&since_time=2026-03-02T08:00:00Z": http.StatusBadRequest,
+	} {
+		if code, _ := changes(query); code != want {
+			t.Errorf("GET /policy/changes%s = %d, want %d", query, code, want)
+		}
+	}
+
+	s.SetHistoryLimit(1)
+	doAuth(mux, http.MethodPost, "/policy/add?domain=bet365.com", "", "")
+	if code, _ := changes("?since=1&since_time=2026-03-02T08:00:00Z"); code != http.StatusGone {
+		t.Errorf("changes since a version no longer kept = %d", code)
+	}
+}
+
+func TestEntriesAndHits(t *testing.T) {
+	mux := newTestServer(t)
+	doAuth(mux, http.MethodPost, "/rules", "", `{"type":"wildcard","domain":"ads-*.example.com","category":"ads"}`)
+	doAuth(mux, http.MethodPost, "/categories", "", `{"name":"work","action":"allow","domains":["docs.example.com"]}`)
+
+	report := `{"hits":[{"type":"domain","entry":"facebook.com","count":3,"last_matched":"2026-03-02T09:00:00Z"},{"type":"allow","entry":"docs.example.com","count":1}]}`
+	if rec := doAuth(mux, http.MethodPost, "/policy/hits", "", report); rec.Code != http.StatusNoContent {
+		t.Fatalf("POST /policy/hits = %d: %s", rec.Code, rec.Body)
+	}
+	doAuth(mux, http.MethodPost, "/policy/hits", "", `{"hits":[{"type":"domain","entry":"facebook.com","count":2,"last_matched":"2026-03-01T09:00:00Z"}]}`)
+	for _, body := range []string{
+		`{"hits":[{"type":"glob","entry":"x","count":1}]}`,
+		`{"hits":[{"type":"domain","entry":"facebook.com","count":0}]}`,
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/policy/hits", "", body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("POST /policy/hits %s = %d", body, rec.Code)
+		}
+	}
+
+	var list struct {
+		Entries []Entry `json:"entries"`
+		Total   int     `json:"total"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/entries?q=example", "", "").Body.Bytes(), &list)
+	if list.Total != 2 || list.Entries[0].Origin != "rule" || list.Entries[0].State != store.StateActive ||
+		list.Entries[1].Origin != "category" || list.Entries[1].Hits != 1 {
+		t.Errorf("GET /entries?q=example = %+v", list)
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/entries?q=facebook", "", "").Body.Bytes(), &list)
+	if e := list.Entries[0]; e.Hits != 5 || !e.LastMatched.Equal(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("facebook.com entry = %+v", e)
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/entries?limit=1", "", "").Body.Bytes(), &list)
+	if list.Total != 3 || len(list.Entries) != 1 {
+		t.Errorf("GET /entries?limit=1 = %+v", list)
+	}
+
+	rec := do(mux, http.MethodGet, "/ui/")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "SWG Policy Admin") || rec.Header().Get("Content-Security-Policy") == "" {
+		t.Errorf("GET /ui/ = %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodGet, "/ui/app.js"); rec.Code != http.StatusOK {
+		t.Errorf("GET /ui/app.js = %d", rec.Code)
+	}
+}
+
+func TestReportHitsAuth(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), []string{"facebook.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewAPI(s, Options{AdminToken: "admin-secret", Users: []User{{Name: "proxy", Role: RoleViewer, Token: "proxy-token"}}}).Register(mux)
+
+	report := `{"hits":[{"type":"domain","entry":"facebook.com","count":1}]}`
+	for token, want := range map[string]int{
+		"":            http.StatusUnauthorized,
+		"guess":       http.StatusUnauthorized,
+		"proxy-token": http.StatusNoContent,
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/policy/hits", token, report); rec.Code != want {
+			t.Errorf("POST /policy/hits with token %q = %d, want %d", token, rec.Code, want)
+		}
+	}
+}
+
+func TestHitTracker(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	policy := func(version int64, domains ...string) store.Policy {
+		p := store.Policy{Version: version}
+		for i, d := range domains {
+			p.Rules = append(p.Rules, store.Rule{ID: int64(i + 1), Type: store.TypeSuffix, Domain: d})
+		}
+		return p
+	}
+
+	var tr hitTracker
+	tr.sync(policy(1, "a.com", "b.com"))
+	if tr.add(Hit{Type: HitDomain, Entry: "nosuch.com", Count: 1, LastMatched: at}) {
+		t.Error("added a hit on an entry the policy doesn't have")
+	}
+	if tr.add(Hit{Type: HitWildcard, Entry: "a.com", Count: 1, LastMatched: at}) {
+		t.Error("added a hit on an entry of another type")
+	}
+	tr.add(Hit{Type: HitDomain, Entry: "a.com", Count: math.MaxInt64 - 1, LastMatched: at})
+	tr.add(Hit{Type: HitDomain, Entry: "a.com", Count: 5, LastMatched: at.Add(-time.Hour)})
+	if h, _ := tr.get(HitDomain, "a.com"); h.Count != math.MaxInt64 || !h.LastMatched.Equal(at) {
+		t.Errorf("a.com hits = %+v, want a saturated count last matched at %v", h, at)
+	}
+	tr.add(Hit{Type: HitDomain, Entry: "b.com", Count: 1, LastMatched: at})
+
+	// Entries leaving the policy take their hits with them
+	tr.sync(policy(2, "a.com"))
+	if _, ok := tr.get(HitDomain, "b.com"); ok {
+		t.Error("kept the hits of b.com after it left the policy")
+	}
+	if _, ok := tr.get(HitDomain, "a.com"); !ok {
+		t.Error("dropped the hits of a.com")
+	}
+
+	// A full tracker makes way for new entries by dropping the entry
+	// reported least recently
+	domains := make([]string, maxTrackedHits+1)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("d%d.com", i)
+	}
+	tr.sync(policy(3, domains...))
+	for _, d := range domains[:maxTrackedHits] {
+		tr.add(Hit{Type: HitDomain, Entry: d, Count: 1, LastMatched: at})
+	}
+	tr.add(Hit{Type: HitDomain, Entry: domains[0], Count: 1, LastMatched: at})
+	if !tr.add(Hit{Type: HitDomain, Entry: domains[maxTrackedHits], Count: 1, LastMatched: at}) {
+		t.Fatal("a full tracker refused a new entry")
+	}
+	if len(tr.hits) != maxTrackedHits {
+		t.Errorf("tracking %d entries, want %d", len(tr.hits), maxTrackedHits)
+	}
+	if _, ok := tr.get(HitDomain, domains[1]); ok {
+		t.Errorf("kept %s, the entry reported least recently", domains[1])
+	}
+	for _, d := range []string{domains[0], domains[2], domains[maxTrackedHits]} {
+		if _, ok := tr.get(HitDomain, d); !ok {
+			t.Errorf("dropped %s", d)
+		}
+	}
+}
+
+func TestTestPolicy(t *testing.T) {
+	mux := newTestServer(t)
+	doAuth(mux, http.MethodPost, "/rules", "", `{"type":"wildcard","domain":"ads-*.example.com"}`)
+
+	body := `{"urls":["https://www.facebook.com/login","ads-1.example.com:443","khanacademy.org","not a url!"],
+		"proposed":{"add_rules":[{"domain":"khanacademy.org"}],"remove_rules":[1],
+			"categories":[{"name":"ads","action":"allow","domains":["ads-1.example.com"]}]}}`
+	rec := doAuth(mux, http.MethodPost, "/policy/test", "", body)
+	var resp struct {
+		Version int64              `json:"version"`
+		Changed int                `json:"changed"`
+		Results []PolicyTestResult `json:"results"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Results) != 4 || resp.Changed != 3 {
+		t.Fatalf("POST /policy/test = %d: %s", rec.Code, rec.Body)
+	}
+	fb, ads, khan, bad := resp.Results[0], resp.Results[1], resp.Results[2], resp.Results[3]
+	if !fb.Current.Blocked || fb.Current.RuleID != 1 || fb.Proposed.Blocked || !fb.Changed {
+		t.Errorf("facebook = %+v, %+v", fb.Current, fb.Proposed)
+	}
+	if !ads.Current.Blocked || ads.Proposed.Blocked || ads.Proposed.Name != "ads" {
+		t.Errorf("ads = %+v, %+v", ads.Current, ads.Proposed)
+	}
+	if khan.Current.Blocked || !khan.Proposed.Blocked || khan.Proposed.RuleID != 3 {
+		t.Errorf("khanacademy = %+v, %+v", khan.Current, khan.Proposed)
+	}
+	if bad.Error == "" || bad.Current != nil {
+		t.Errorf("invalid input = %+v", bad)
+	}
+
+	// Nothing proposed is made
+	var p PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &p)
+	if p.Version != resp.Version || strings.Join(p.Blocked, ",") != "facebook.com" {
+		t.Errorf("policy after a dry run = %+v", p)
+	}
+
+	for body, code := range map[string]int{
+		`{"urls":[]}`: http.StatusUnprocessableEntity,
+		`{"urls":["a.com"],"proposed":{"remove_rules":[99]}}`:                                http.StatusUnprocessableEntity,
+		`{"urls":["a.com"],"proposed":{"add_rules":[{"domain":"a.com","groups":["nope"]}]}}`: http.StatusUnprocessableEntity,
+	} {
+		if rec := doAuth(mux, http.MethodPost, "/policy/test", "", body); rec.Code != code {
+			t.Errorf("POST /policy/test %s = %d, want %d", body, rec.Code, code)
+		}
+	}
+	if rec := doAuth(mux, http.MethodPost, "/policy/test?group=nope", "", `{"urls":["a.com"]}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown group = %d", rec.Code)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.Open(filepath.Join(dir, "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog := openAudit(t, filepath.Join(dir, "audit.log"))
+	defer auditLog.Close()
+	mux := http.NewServeMux()
+	NewAPI(s, Options{AdminToken: "admin-secret", Audit: auditLog}).Register(mux)
+
+	if rec := doAuth(mux, http.MethodPost, "/rules", "", `{"domain":"tiktok.com"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("POST /rules without a token = %d", rec.Code)
+	}
+	doAuth(mux, http.MethodPost, "/rules", "admin-secret", `{"domain":"tiktok.com","category":"social","groups":[]}`)
+	doAuth(mux, http.MethodDelete, "/rules/1", "admin-secret", "")
+	doAuth(mux, http.MethodPost, "/policy/rollback", "admin-secret", `{"version":2}`)
+
+	var resp struct {
+		Events []audit.Event `json:"events"`
+		Total  int           `json:"total"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/audit", "admin-secret", "").Body.Bytes(), &resp)
+	if resp.Total != 5 {
+		t.Fatalf("GET /audit = %+v", resp)
+	}
+	rollback, del, create, login, denied := resp.Events[0], resp.Events[1], resp.Events[2], resp.Events[3], resp.Events[4]
+	if denied.Action != audit.ActionAdminDenied || denied.Detail != "no token" || denied.Outcome != audit.OutcomeDenied {
+		t.Errorf("denied event = %+v", denied)
+	}
+	// The admin's later requests are part of the same sign-in
+	if login.Action != audit.ActionAdminLogin || login.Actor != "admin" || login.Service != "swg-policy-engine" {
+		t.Errorf("login event = %+v", login)
+	}
+	if create.Action != "rule.create" || create.Object != "rule 1" || create.Actor != "admin" || create.Address == "" ||
+		create.Detail != "suffix tiktok.com category=social" || create.Version != 2 {
+		t.Errorf("create event = %+v", create)
+	}
+	if del.Action != "rule.delete" || del.Detail != "suffix tiktok.com category=social" {
+		t.Errorf("delete event = %+v", del)
+	}
+	if rollback.Action != "policy.rollback" || rollback.Object != "version 2" || rollback.Version != 4 {
+		t.Errorf("rollback event = %+v", rollback)
+	}
+
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/audit?action=rule.&limit=1", "admin-secret", "").Body.Bytes(), &resp)
+	if resp.Total != 1 || resp.Events[0].Action != "rule.delete" {
+		t.Errorf("GET /audit?action=rule.&limit=1 = %+v", resp)
+	}
+	for _, q := range []string{"?since=yesterday", "?limit=0"} {
+		if rec := doAuth(mux, http.MethodGet, "/audit"+q, "admin-secret", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /audit%s = %d", q, rec.Code)
+		}
+	}
+	if rec := doAuth(mux, http.MethodGet, "/audit/verify", "admin-secret", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"events":5`) {
+		t.Errorf("GET /audit/verify = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// openAudit opens an audit log at path for the policy engine
+func openAudit(t *testing.T, path string) *audit.Log {
+	t.Helper()
+	file, err := audit.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return audit.New("swg-policy-engine", file)
+}
+
+func TestRoles(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewAPI(s, Options{Users: []User{
+		{Name: "vera", Role: RoleViewer, Token: "vera-token"},
+		{Name: "ed", Role: RoleEditor, Token: "ed-token"},
+	}}).Register(mux)
+
+	if rec := doAuth(mux, http.MethodGet, "/rules", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /rules without a token = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/rules", "vera-token", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /rules as viewer = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/rules", "vera-token", `{"domain":"tiktok.com"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("POST /rules as viewer = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/rules", "ed-token", `{"domain":"tiktok.com"}`); rec.Code != http.StatusCreated {
+		t.Errorf("POST /rules as editor = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/approvals/1/approve", "ed-token", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("approving as editor = %d", rec.Code)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewAPI(s, Options{
+		AdminToken: "admin-token",
+		RateLimit:  ratelimit.New("policy-api", ratelimit.Limit{Rate: 2.0 / 60, Burst: 2, Algorithm: ratelimit.SlidingWindow}, nil),
+	}).Register(mux)
+
+	// Guessing tokens counts as much as using one
+	if rec := doAuth(mux, http.MethodGet, "/rules", "guess", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /rules with a wrong token = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodGet, "/rules", "admin-token", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /rules = %d", rec.Code)
+	}
+	rec := doAuth(mux, http.MethodGet, "/rules", "admin-token", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("GET /rules over the limit = %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// The proxies' endpoints aren't limited
+	if rec := do(mux, http.MethodGet, "/policy"); rec.Code != http.StatusOK {
+		t.Errorf("GET /policy = %d", rec.Code)
+	}
+}
+
+func TestApprovals(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.Open(filepath.Join(dir, "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog := openAudit(t, filepath.Join(dir, "audit.log"))
+	defer auditLog.Close()
+	mux := http.NewServeMux()
+	NewAPI(s, Options{
+		AdminToken:      "admin-secret",
+		Users:           []User{{Name: "ed", Role: RoleEditor, Token: "ed-token"}, {Name: "ann", Role: RoleApprover, Token: "ann-token"}},
+		RequireApproval: true,
+		Audit:           auditLog,
+	}).Register(mux)
+
+	// Ordinary changes don't wait
+	if rec := doAuth(mux, http.MethodPost, "/rules", "ed-token", `{"domain":"tiktok.com"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /rules = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/categories", "ed-token", `{"name":"tutoring","action":"allow","domains":["khanacademy.org"]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /categories allow = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := doAuth(mux, http.MethodPost, "/categories", "ed-token", `{"name":"gaming","domains":["roblox.com","steampowered.com"]}`)
+	var ap Approval
+	json.Unmarshal(rec.Body.Bytes(), &ap)
+	if rec.Code != http.StatusAccepted || ap.ID != 1 || ap.Status != ApprovalPending || ap.RequestedBy != "ed" || ap.Reason != "category-wide block" {
+		t.Fatalf("POST /categories block = %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := s.Policy().Category("gaming"); ok {
+		t.Fatal("category was created before it was approved")
+	}
+	if rec := doAuth(mux, http.MethodPost, "/rules", "ed-token", `{"type":"wildcard","domain":"*.casino.com"}`); rec.Code != http.StatusAccepted {
+		t.Errorf("POST /rules wildcard = %d", rec.Code)
+	}
+
+	if rec := doAuth(mux, http.MethodPost, "/approvals/1/approve", "ed-token", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("approving as editor = %d", rec.Code)
+	}
+	rec = doAuth(mux, http.MethodPost, "/approvals/1/approve", "ann-token", `{"comment":"ok"}`)
+	json.Unmarshal(rec.Body.Bytes(), &ap)
+	if rec.Code != http.StatusOK || ap.Status != ApprovalApproved || ap.DecidedBy != "ann" || ap.Result == nil || ap.Result.Status != http.StatusCreated {
+		t.Fatalf("approve = %d: %s", rec.Code, rec.Body)
+	}
+	if c, ok := s.Policy().Category("gaming"); !ok || len(c.Domains) != 2 {
+		t.Errorf("approved category = %+v, %v", c, ok)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/approvals/1/reject", "ann-token", ""); rec.Code != http.StatusConflict {
+		t.Errorf("rejecting an approved change = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/approvals/9/approve", "ann-token", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("approving a missing change = %d", rec.Code)
+	}
+
+	// Approvers can't approve their own changes
+	rec = doAuth(mux, http.MethodDelete, "/categories/tutoring", "ann-token", "")
+	json.Unmarshal(rec.Body.Bytes(), &ap)
+	if rec.Code != http.StatusAccepted || ap.ID != 3 {
+		t.Fatalf("DELETE /categories = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/approvals/3/approve", "ann-token", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("approving one's own change = %d", rec.Code)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/approvals/3/reject", "admin-secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("reject = %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := s.Policy().Category("tutoring"); !ok {
+		t.Error("rejected change was made")
+	}
+
+	var list struct {
+		Approvals []Approval `json:"approvals"`
+		Total     int        `json:"total"`
+	}
+	json.Unmarshal(doAuth(mux, http.MethodGet, "/approvals?status=pending", "ed-token", "").Body.Bytes(), &list)
+	if list.Total != 1 || list.Approvals[0].ID != 2 {
+		t.Errorf("GET /approvals?status=pending = %+v", list)
+	}
+
+	// The change is recorded as its requester's, and its approval as the
+	// approver's
+	events, _ := auditLog.Events(context.Background(), audit.Filter{Action: "category.create"})
+	if len(events) != 2 || events[0].Object != "category gaming" || events[0].Actor != "ed" {
+		t.Errorf("category.create events = %+v", events)
+	}
+	events, _ = auditLog.Events(context.Background(), audit.Filter{Action: "approval.approve"})
+	if len(events) != 1 || events[0].Actor != "ann" {
+		t.Errorf("approval.approve events = %+v", events)
+	}
+}
+
+func TestReadUsers(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		body string
+		ok   bool
+	}{
+		{`{"users":[{"name":"ann","role":"approver","token":"t1"},{"name":"ed","role":"editor","token_sha256":"` + strings.Repeat("ab", 32) + `"}]}`, true},
+		{`{"users":[{"name":"admin","role":"viewer","token":"t1"}]}`, false},
+		{`{"users":[{"name":"ann","role":"owner","token":"t1"}]}`, false},
+		{`{"users":[{"name":"ann","role":"viewer"}]}`, false},
+		{`{"users":[{"name":"ann","role":"viewer","token_sha256":"abc"}]}`, false},
+		{`{"users":[{"name":"ann","role":"viewer","token":"t1"},{"name":"ed","role":"viewer","token":"t1"}]}`, false},
+		{`{"users":[{"name":"ann","role":"viewer","token":"t1"},{"name":"ann","role":"viewer","token":"t2"}]}`, false},
+	} {
+		path := filepath.Join(dir, "users.json")
+		os.WriteFile(path, []byte(tc.body), 0o600)
+		if _, err := ReadUsers(path); (err == nil) != tc.ok {
+			t.Errorf("ReadUsers(%s) error = %v", tc.body, err)
+		}
+	}
+}
+
+func TestPolicyStream(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), []string{"facebook.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI(s, Options{InsecureNoAuth: true})
+	mux := http.NewServeMux()
+	api.Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/policy/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+	next := func() StreamEvent {
+		t.Helper()
+		var ev StreamEvent
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading stream: %v", err)
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				if err := json.Unmarshal([]byte(data), &ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if line == "\n" {
+				return ev
+			}
+		}
+	}
+	if ev := next(); ev.Version != s.Policy().Version {
+		t.Errorf("first event version = %d, want %d", ev.Version, s.Policy().Version)
+	}
+	do(mux, http.MethodPost, "/policy/add?domain=tiktok.com")
+	if ev := next(); ev.Version != s.Policy().Version {
+		t.Errorf("event after a change has version %d, want %d", ev.Version, s.Policy().Version)
+	}
+
+	var health struct {
+		Subscribers int `json:"subscribers"`
+	}
+	json.Unmarshal(do(mux, http.MethodGet, "/health").Body.Bytes(), &health)
+	if health.Subscribers != 1 {
+		t.Errorf("subscribers = %d, want 1", health.Subscribers)
+	}
+
+	// Shutting down ends the stream, and turns new subscribers away
+	api.CloseStreams()
+	if _, err := events.ReadString('\n'); err != io.EOF {
+		t.Errorf("reading stream after CloseStreams: %v, want EOF", err)
+	}
+	if rec := do(mux, http.MethodGet, "/policy/stream"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /policy/stream after CloseStreams = %d", rec.Code)
+	}
+}
+
+func TestSignedPolicy(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), []string{"facebook.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, _ := ed25519.GenerateKey(nil)
+	signer := signing.New(key)
+	mux := http.NewServeMux()
+	NewAPI(s, Options{Signer: signer}).Register(mux)
+	do(mux, http.MethodPost, "/policy/add?domain=tiktok.com")
+
+	verify := func(path, document string, since int64) {
+		t.Helper()
+		rec := do(mux, http.MethodGet, path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", path, rec.Code, rec.Body)
+		}
+		if id := rec.Header().Get(signing.HeaderKeyID); id != signer.ID() {
+			t.Errorf("GET %s key ID = %q, want %q", path, id, signer.ID())
+		}
+		var doc struct {
+			GeneratedAt time.Time `json:"generated_at"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &doc)
+		sig, err := base64.StdEncoding.DecodeString(rec.Header().Get(signing.HeaderSignature))
+		if err != nil || !ed25519.Verify(signer.PublicKey(), cryptoutil.PolicyMessage(rec.Body.Bytes(), document, since, doc.GeneratedAt), sig) {
+			t.Errorf("GET %s signature does not verify", path)
+		}
+		// The body alone, or the body as another document, doesn't verify
+		if ed25519.Verify(signer.PublicKey(), rec.Body.Bytes(), sig) {
+			t.Errorf("GET %s signature verifies the body alone", path)
+		}
+		other := cryptoutil.PolicyDocument
+		if document == other {
+			other = cryptoutil.ChangesDocument
+		}
+		if ed25519.Verify(signer.PublicKey(), cryptoutil.PolicyMessage(rec.Body.Bytes(), other, since, doc.GeneratedAt), sig) {
+			t.Errorf("GET %s signature verifies as a %s document", path, other)
+		}
+	}
+	verify("/policy", cryptoutil.PolicyDocument, 0)
+	var p PolicyResponse
+	json.Unmarshal(do(mux, http.MethodGet, "/policy").Body.Bytes(), &p)
+	verify("/policy/changes?since=1&since_time="+p.GeneratedAt.Format(time.RFC3339), cryptoutil.ChangesDocument, 1)
+
+	var keys struct {
+		Keys []PolicyKey `json:"keys"`
+	}
+	json.Unmarshal(do(mux, http.MethodGet, "/policy/keys").Body.Bytes(), &keys)
+	if len(keys.Keys) != 1 || keys.Keys[0].ID != signer.ID() || !strings.Contains(keys.Keys[0].PublicKey, "PUBLIC KEY") {
+		t.Errorf("GET /policy/keys = %+v", keys)
+	}
+
+	// Without a signer, policies go out unsigned
+	if rec := do(newTestServer(t), http.MethodGet, "/policy"); rec.Header().Get(signing.HeaderSignature) != "" {
+		t.Error("unsigned API signed the policy")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	mux := newTestServer(t)
+	rec := do(mux, http.MethodGet, "/policy/export")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/yaml" {
+		t.Fatalf("GET /policy/export = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	exported := rec.Body.String()
+	if !strings.Contains(exported, "domain: facebook.com") {
+		t.Errorf("export lacks the seeded rule:\n%s", exported)
+	}
+
+	// Add a rule to the end of the rules list
+	edited := strings.Replace(exported, "categories:", "  - type: domain\n    domain: tiktok.com\ncategories:", 1)
+	rec = doAuth(mux, http.MethodPost, "/policy/import?dry_run=true", "", edited)
+	var resp ImportResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || !resp.DryRun || !resp.Changed || resp.Version != 1 || len(resp.Changes.RulesAdded) != 1 {
+		t.Fatalf("dry run = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, http.MethodGet, "/policy/export"); rec.Body.String() != exported {
+		t.Error("dry run changed the policy")
+	}
+
+	rec = doAuth(mux, http.MethodPost, "/policy/import", "", edited)
+	resp = ImportResponse{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.DryRun || resp.Version != 2 {
+		t.Fatalf("import = %d %s", rec.Code, rec.Body)
+	}
+	// The same document again changes nothing
+	rec = doAuth(mux, http.MethodPost, "/policy/import", "", edited)
+	resp = ImportResponse{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Changed || resp.Version != 2 {
+		t.Errorf("importing again = %s", rec.Body)
+	}
+
+	if rec := doAuth(mux, http.MethodPost, "/policy/import", "", "rules: [\n"); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed YAML = %d", rec.Code)
+	}
+	rec = doAuth(mux, http.MethodPost, "/policy/import", "", "rules:\n  - domain: bad..example\n  - domain: ok.example\n    groups: [nobody]\n")
+	var problems struct {
+		Problems []string `json:"problems"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &problems)
+	if rec.Code != http.StatusUnprocessableEntity || len(problems.Problems) != 2 {
+		t.Errorf("invalid document = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	lists := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0.0.0.0 tiktok.com\n"))
+	}))
+	defer lists.Close()
+	mux := newTestServer(t)
+	doAuth(mux, http.MethodPost, "/policy/add?domain=tiktok.com", "", "")
+	doAuth(mux, http.MethodPost, "/sources", "", `{"name":"lists","url":"`+lists.URL+`","format":"hosts"}`)
+	doAuth(mux, http.MethodPost, "/categories", "", `{"name":"learning","action":"allow","domains":["khanacademy.org"]}`)
+	doAuth(mux, http.MethodPost, "/rules", "", `{"type":"wildcard","domain":"*.khanacademy.org"}`)
+
+	lookup := func(query string) LookupResponse {
+		t.Helper()
+		rec := doAuth(mux, http.MethodGet, "/lookup?"+query, "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /lookup?%s = %d: %s", query, rec.Code, rec.Body)
+		}
+		var resp LookupResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// The rule decides; the source would if the rule went
+	resp := lookup("domain=https://www.TikTok.com/foryou")
+	if !resp.Blocked || resp.Host != "www.tiktok.com" || resp.Rule == nil || resp.Rule.Domain != "tiktok.com" ||
+		len(resp.Matches) != 2 || resp.Matches[1].Name != "lists" {
+		t.Errorf("lookup of a blocked domain = %+v", resp)
+	}
+	if rec := doAuth(mux, http.MethodDelete, "/rules/"+strconv.FormatInt(resp.RuleID, 10), "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE rule = %d", rec.Code)
+	}
+	if resp = lookup("domain=tiktok.com"); resp.Match != store.MatchSource || resp.Source == nil || resp.Source.Name != "lists" {
+		t.Errorf("lookup of a domain a source blocks = %+v", resp)
+	}
+
+	// The allow category wins over the pattern
+	if resp = lookup("domain=www.khanacademy.org"); resp.Blocked || resp.Name != "learning" || len(resp.Matches) != 2 {
+		t.Errorf("lookup of an allowed domain = %+v", resp)
+	}
+	if resp = lookup("domain=example.org"); resp.Blocked || resp.Match != "" || len(resp.Matches) != 0 {
+		t.Errorf("lookup of an unmatched domain = %+v", resp)
+	}
+	for _, query := range []string{"", "domain=not%20a%20host"} {
+		if rec := doAuth(mux, http.MethodGet, "/lookup?"+query, "", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /lookup?%s = %d", query, rec.Code)
+		}
+	}
+}
+
+func TestFlags(t *testing.T) {
+	mux := newTestServer(t)
+
+	rec := doAuth(mux, http.MethodPut, "/flags/mitm", "", `{"value":"10%","description":"Intercept HTTPS"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PUT /flags/mitm = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doAuth(mux, http.MethodPut, "/flags/fail-closed", "", `{"value":"on"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT /flags/fail-closed = %d: %s", rec.Code, rec.Body)
+	}
+	rec = doAuth(mux, http.MethodPut, "/flags/mitm", "", `{"value":"25%"}`)
+	var set FlagResponse
+	json.Unmarshal(rec.Body.Bytes(), &set)
+	if rec.Code != http.StatusOK || set.Flag.Value != 25 || set.Flag.Description != "" {
+		t.Errorf("PUT /flags/mitm again = %d: %s", rec.Code, rec.Body)
+	}
+	for path, body := range map[string]string{"/flags/mitm": `{"value":"most"}`, "/flags/MITM_Mode": `{"value":"on"}`} {
+		if rec := doAuth(mux, http.MethodPut, path, "", body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("PUT %s %s = %d", path, body, rec.Code)
+		}
+	}
+
+	// Services read the values the flags package applies
+	rec = do(mux, http.MethodGet, "/flags")
+	var doc flags.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || doc.Flags[flags.MITM] != 25 || doc.Flags[flags.FailClosed] != flags.On || doc.Version != set.Version {
+		t.Errorf("GET /flags = %s, %v", rec.Body, err)
+	}
+	if rec := do(mux, http.MethodGet, "/flags/mitm"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"value":"25%"`) {
+		t.Errorf("GET /flags/mitm = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, http.MethodDelete, "/flags/mitm"); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE /flags/mitm = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, http.MethodGet, "/flags/mitm"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET a deleted flag = %d", rec.Code)
+	}
+	if rec := do(mux, http.MethodDelete, "/flags/mitm"); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE a deleted flag = %d", rec.Code)
+	}
+}
+
+func TestFlagApproval(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewAPI(s, Options{
+		Users:           []User{{Name: "ed", Role: RoleEditor, Token: "ed-token"}, {Name: "ann", Role: RoleApprover, Token: "ann-token"}},
+		RequireApproval: true,
+	}).Register(mux)
+
+	// A rollout to some devices goes straight through; turning a flag on
+	// for the whole fleet needs a second person
+	if rec := doAuth(mux, http.MethodPut, "/flags/mitm", "ed-token", `{"value":"10%"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT 10%% = %d: %s", rec.Code, rec.Body)
+	}
+	rec := doAuth(mux, http.MethodPut, "/flags/mitm", "ed-token", `{"value":"on"}`)
+	var held Approval
+	json.Unmarshal(rec.Body.Bytes(), &held)
+	if rec.Code != http.StatusAccepted || held.Reason != "fleet-wide flag" {
+		t.Fatalf("PUT on = %d: %s", rec.Code, rec.Body)
+	}
+	if fl, _ := s.Policy().Flag("mitm"); fl.Value != 10 {
+		t.Errorf("held change applied: %+v", fl)
+	}
+	if rec := doAuth(mux, http.MethodPost, "/approvals/"+strconv.FormatInt(held.ID, 10)+"/approve", "ann-token", ""); rec.Code != http.StatusOK {
+		t.Fatalf("approve = %d: %s", rec.Code, rec.Body)
+	}
+	if fl, _ := s.Policy().Flag("mitm"); fl.Value != flags.On {
+		t.Errorf("approved flag = %+v", fl)
+	}
+}
+
+// TestOpenAPI checks the API's responses against its OpenAPI document
+func TestOpenAPI(t *testing.T) {
+	lists := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("||ads.example.com^\n"))
+	}))
+	defer lists.Close()
+	dir := t.TempDir()
+	s, err := store.Open(filepath.Join(dir, "policy.json"), []string{"facebook.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog := openAudit(t, filepath.Join(dir, "audit.log"))
+	defer auditLog.Close()
+	mux := http.NewServeMux()
+	NewAPI(s, Options{
+		AdminToken:      "admin-secret",
+		Users:           []User{{Name: "ed", Role: RoleEditor, Token: "ed-token"}},
+		RequireApproval: true,
+		Audit:           auditLog,
+	}).Register(mux)
+
+	rec := do(mux, http.MethodGet, "/openapi.json")
+	var doc openapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("GET /openapi.json = %d: %v", rec.Code, err)
+	}
+	if doc.Info.Version != Version || doc.Components.SecuritySchemes["bearer"].Scheme != "bearer" {
+		t.Errorf("document = %+v, %+v", doc.Info, doc.Components.SecuritySchemes)
+	}
+	if op := doc.Paths["/categories"]["post"]; op == nil || op.Security == nil || op.Responses["201"] == nil || op.Responses["202"] == nil {
+		t.Errorf("POST /categories = %+v", op)
+	}
+	if op := doc.Paths["/policy"]["get"]; op == nil || op.Security != nil || len(op.Parameters) != 3 {
+		t.Errorf("GET /policy = %+v", op)
+	}
+
+	// call makes a request and checks the response is the one documented
+	call := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := doAuth(mux, method, path, token, body)
+		if err := doc.Validate(method, path, rec.Code, rec.Body.Bytes()); err != nil {
+			t.Error(err)
+		}
+		return rec
+	}
+	call(http.MethodPost, "/policy/add?domain=tiktok.com", "ed-token", "")
+	call(http.MethodPost, "/policy/add?domain=tiktok.com", "ed-token", "")
+	call(http.MethodDelete, "/policy/remove?domain=nosuch.example", "ed-token", "")
+	call(http.MethodPost, "/rules", "ed-token", `{"domain":"roblox.com","category":"gaming","effective_from":"2024-01-01T00:00:00Z"}`)
+	call(http.MethodPost, "/rules", "ed-token", `{"type":"wildcard","domain":"*.ads.example"}`)
+	call(http.MethodPut, "/rules/2", "ed-token", `{"domain":"roblox.com","category":"games"}`)
+	call(http.MethodPost, "/categories", "ed-token", `{"name":"tutoring","action":"allow","domains":["khanacademy.org"]}`)
+	call(http.MethodPost, "/categories", "ed-token", `{"name":"gaming","domains":["steampowered.com"]}`)
+	call(http.MethodDelete, "/categories/tutoring/domains/khanacademy.org", "ed-token", "")
+	call(http.MethodPost, "/groups", "ed-token", `{"name":"students","devices":["laptop-1"]}`)
+	call(http.MethodPut, "/groups/students/devices/laptop-2", "ed-token", "")
+	call(http.MethodPost, "/approvals/1/approve", "admin-secret", `{"comment":"ok"}`)
+	call(http.MethodPost, "/approvals/2/reject", "admin-secret", "")
+	call(http.MethodPost, "/sources", "admin-secret", `{"name":"ads","url":"`+lists.URL+`","format":"adblock"}`)
+	call(http.MethodPost, "/sources/ads/refresh", "ed-token", "")
+	call(http.MethodPost, "/policy/hits", "ed-token", `{"hits":[{"type":"domain","entry":"facebook.com","count":3,"last_matched":"2024-05-01T10:00:00Z"}]}`)
+	call(http.MethodPost, "/policy/test?group=students", "ed-token", `{"urls":["https://www.facebook.com/x","khanacademy.org","::"],
+		"proposed":{"add_rules":[{"domain":"khanacademy.org"}]}}`)
+	call(http.MethodPost, "/policy/import?dry_run=true", "ed-token", "rules: []\n")
+	call(http.MethodPut, "/flags/mitm", "ed-token", `{"value":"10%"}`)
+	call(http.MethodPut, "/flags/mitm", "ed-token", `{"value":"20%"}`)
+	call(http.MethodPut, "/flags/mitm", "ed-token", `{"value":"on"}`)
+	call(http.MethodPost, "/policy/rollback", "admin-secret", `{"version":2}`)
+	for _, path := range []string{
+		"/", "/health", "/health/sources", "/healthz", "/policy?group=students", "/policy/domains",
+		"/policy/keys", "/entries?q=face", "/audit", "/audit/verify", "/lookup?domain=www.facebook.com",
+		"/lookup?domain=ads.example.com", "/policy/history", "/policy/history/2", "/rules", "/rules/1", "/rules/9",
+		"/categories", "/categories/tutoring", "/groups", "/groups/students", "/feeds", "/sources", "/sources/ads",
+		"/approvals", "/approvals/1", "/flags", "/flags/mitm", "/flags/nosuch",
+	} {
+		call(http.MethodGet, path, "ed-token", "")
+	}
+	rec = call(http.MethodGet, "/policy", "", "")
+	var policy PolicyResponse
+	json.Unmarshal(rec.Body.Bytes(), &policy)
+	call(http.MethodGet, "/policy/changes?since=2&since_time="+policy.GeneratedAt.Format(time.RFC3339), "", "")
+	call(http.MethodDelete, "/rules/1", "ed-token", "")
+	call(http.MethodDelete, "/groups/students", "ed-token", "")
+	call(http.MethodDelete, "/sources/ads", "ed-token", "")
+	call(http.MethodGet, "/rules", "", "")
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// Approval statuses
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved" // approved and made; Result says how that went
+	ApprovalRejected = "rejected"
+)
+
+// maxPendingApprovals caps the changes waiting for approval, and
+// maxApprovals the ones kept, pending or decided
+const (
+	maxPendingApprovals = 100
+	maxApprovals        = 1000
+)
+
+// Approval is a high-impact change waiting for, or given, a second
+// person's approval. The change is the request as it was made; approving
+// it makes the request again on behalf of the person who made it.
+type Approval struct {
+	ID          int64           `json:"id"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	Reason      string          `json:"reason"` // why the change needs approval
+	Status      string          `json:"status"`
+	RequestedBy string          `json:"requested_by"`
+	RequestedAt time.Time       `json:"requested_at"`
+	DecidedBy   string          `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time      `json:"decided_at,omitempty"`
+	Comment     string          `json:"comment,omitempty"`
+	// Result is the response the change got when it was made
+	Result *ApprovalResult `json:"result,omitempty"`
+
+	requester User
+	address   string
+}
+
+// ApprovalResult is the response an approved change got
+type ApprovalResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// approvalKey marks a request made by approving an Approval
+type approvalKey struct{}
+
+// approvals holds the changes waiting for approval and the ones decided
+// since the policy engine started, in memory
+type approvals struct {
+	mu     sync.Mutex
+	nextID int64
+	list   []*Approval
+}
+
+// impact says why a change needs approval, or "" if it doesn't. body is
+// the request body.
+type impact func(r *http.Request, body []byte) string
+
+// always marks every change made through a route as high-impact
+func always(reason string) impact {
+	return func(*http.Request, []byte) string { return reason }
+}
+
+// patternRule marks rules that block by pattern, wildcard or regex, which
+// can match far more hosts than their author expects
+func patternRule(r *http.Request, body []byte) string {
+	var in struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(body, &in) == nil && (in.Type == store.TypeWildcard || in.Type == store.TypeRegex) {
+		return in.Type + " rule"
+	}
+	return ""
+}
+
+// blockCategory marks categories that block, all of whose domains are
+// blocked at once; trusted categories block them for untrusted devices
+func blockCategory(r *http.Request, body []byte) string {
+	var in CategoryInput
+	if json.Unmarshal(body, &in) == nil && (in.Action == "" || in.Action == store.ActionBlock || in.Action == store.ActionTrusted) {
+		return "category-wide block"
+	}
+	return ""
+}
+
+// blockCategoryDomains marks domains added to a category that blocks
+func (a *API) blockCategoryDomains(r *http.Request, body []byte) string {
+	if c, ok := a.store.Policy().Category(r.PathValue("name")); ok && (c.Action == store.ActionBlock || c.Action == store.ActionTrusted) {
+		return "category-wide block"
+	}
+	return ""
+}
+
+// requireApproval holds the high-impact changes made through next for a
+// second person's approval, answering 202 with the Approval, if approvals
+// are required. Other changes, and approved ones, go straight through.
+func (a *API) requireApproval(why impact, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.opts.RequireApproval {
+			next(w, r)
+			return
+		}
+		if _, approved := r.Context().Value(approvalKey{}).(Approval); approved {
+			next(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDocumentBytes)) // the largest body a change takes
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		reason := why(r, body)
+		if reason == "" {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next(w, r)
+			return
+		}
+		if len(body) > 0 && !json.Valid(body) {
+			writeError(w, http.StatusBadRequest, "malformed body: not JSON")
+			return
+		}
+		ap, err := a.approvals.add(r, body, reason, a.now().UTC())
+		if err != nil {
+			writeError(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
+		a.log.InfoContext(r.Context(), "change needs approval", "change", ap.ID, "requested_by", ap.RequestedBy, "method", ap.Method, "path", ap.Path, "reason", reason)
+		a.audit(r, "approval.request", fmt.Sprintf("approval %d", ap.ID), fmt.Sprintf("%s %s (%s)", ap.Method, ap.Path, reason), 0)
+		writeJSON(w, http.StatusAccepted, ap)
+	}
+}
+
+func (q *approvals) add(r *http.Request, body []byte, reason string, now time.Time) (Approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := 0
+	for _, ap := range q.list {
+		if ap.Status == ApprovalPending {
+			pending++
+		}
+	}
+	if pending >= maxPendingApprovals {
+		return Approval{}, fmt.Errorf("%d changes are already waiting for approval", pending)
+	}
+	q.nextID++
+	u := currentUser(r)
+	ap := &Approval{
+		ID: q.nextID, Method: r.Method, Path: r.URL.RequestURI(), Body: body, Reason: reason,
+		Status: ApprovalPending, RequestedBy: u.Name, RequestedAt: now,
+		requester: u, address: r.RemoteAddr,
+	}
+	if len(body) == 0 {
+		ap.Body = nil
+	}
+	q.list = append(q.list, ap)
+	for i := 0; len(q.list) > maxApprovals; {
+		if q.list[i].Status == ApprovalPending {
+			i++
+			continue
+		}
+		q.list = append(q.list[:i], q.list[i+1:]...)
+	}
+	return *ap, nil
+}
+
+// get returns the approval with the given ID
+func (q *approvals) get(id int64) (*Approval, bool) {
+	for _, ap := range q.list {
+		if ap.ID == id {
+			return ap, true
+		}
+	}
+	return nil, false
+}
+
+// ListApprovals lists the changes waiting for approval and the ones
+// decided, newest first, optionally only those of ?status=
+func (a *API) ListApprovals(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	a.approvals.mu.Lock()
+	out := []Approval{}
+	for i := len(a.approvals.list) - 1; i >= 0; i-- {
+		if ap := a.approvals.list[i]; status == "" || ap.Status == status {
+			out = append(out, *ap)
+		}
+	}
+	a.approvals.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"approvals": out, "total": len(out)})
+}
+
+// GetApproval returns one change waiting for or given approval
+func (a *API) GetApproval(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	a.approvals.mu.Lock()
+	ap, ok := a.approvals.get(id)
+	var out Approval
+	if ok {
+		out = *ap
+	}
+	a.approvals.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "approval not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// ApproveChange makes a change waiting for approval, on behalf of the
+// person who asked for it. Nobody can approve their own change.
+//
+//	POST /approvals/3/approve {"comment": "checked with the exams office"}
+func (a *API) ApproveChange(w http.ResponseWriter, r *http.Request) {
+	ap, comment, ok := a.decide(w, r, ApprovalApproved)
+	if !ok {
+		return
+	}
+	// Make the change as the requester, from a copy of their request
+	ctx := context.WithValue(r.Context(), approvalKey{}, ap)
+	ctx = context.WithValue(ctx, userKey{}, ap.requester)
+	ctx = audit.WithActor(ctx, ap.requester.Name, ap.address)
+	req, err := http.NewRequestWithContext(ctx, ap.Method, ap.Path, bytes.NewReader(ap.Body))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to replay change")
+		return
+	}
+	req.RemoteAddr = ap.address
+	rec := &recorder{header: make(http.Header), status: http.StatusOK}
+	a.mux.ServeHTTP(rec, req)
+	result := &ApprovalResult{Status: rec.status}
+	if json.Valid(rec.body.Bytes()) {
+		result.Body = rec.body.Bytes()
+	}
+
+	a.approvals.mu.Lock()
+	if p, ok := a.approvals.get(ap.ID); ok {
+		p.Result = result
+		ap = *p
+	}
+	a.approvals.mu.Unlock()
+	a.log.InfoContext(r.Context(), "change approved", "change", ap.ID, "approved_by", ap.DecidedBy, "method", ap.Method, "path", ap.Path, "status", result.Status)
+	a.audit(r, "approval.approve", fmt.Sprintf("approval %d", ap.ID), fmt.Sprintf("%s %s by %s -> %d %s", ap.Method, ap.Path, ap.RequestedBy, result.Status, comment), 0)
+	writeJSON(w, http.StatusOK, ap)
+}
+
+// RejectChange turns down a change waiting for approval
+func (a *API) RejectChange(w http.ResponseWriter, r *http.Request) {
+	ap, comment, ok := a.decide(w, r, ApprovalRejected)
+	if !ok {
+		return
+	}
+	a.log.InfoContext(r.Context(), "change rejected", "change", ap.ID, "rejected_by", ap.DecidedBy, "method", ap.Method, "path", ap.Path)
+	a.audit(r, "approval.reject", fmt.Sprintf("approval %d", ap.ID), fmt.Sprintf("%s %s by %s %s", ap.Method, ap.Path, ap.RequestedBy, comment), 0)
+	writeJSON(w, http.StatusOK, ap)
+}
+
+// decide records the current user's decision on the approval in the path,
+// answering 404, 409 or 403 if it is missing, already decided or their
+// own
+func (a *API) decide(w http.ResponseWriter, r *http.Request, status string) (Approval, string, bool) {
+	var in struct {
+		Comment string `json:"comment"`
+	}
+	if r.ContentLength != 0 && !readJSON(w, r, maxRuleBytes, &in) {
+		return Approval{}, "", false
+	}
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	u := currentUser(r)
+	a.approvals.mu.Lock()
+	defer a.approvals.mu.Unlock()
+	ap, ok := a.approvals.get(id)
+	switch {
+	case !ok:
+		writeError(w, http.StatusNotFound, "approval not found")
+		return Approval{}, "", false
+	case ap.Status != ApprovalPending:
+		writeError(w, http.StatusConflict, "change was already "+ap.Status+" by "+ap.DecidedBy)
+		return Approval{}, "", false
+	case ap.RequestedBy == u.Name:
+		writeError(w, http.StatusForbidden, "changes need a second person's approval; you asked for this one")
+		return Approval{}, "", false
+	}
+	now := a.now().UTC()
+	ap.Status, ap.DecidedBy, ap.DecidedAt, ap.Comment = status, u.Name, &now, in.Comment
+	return *ap, in.Comment, true
+}
+
+// recorder keeps the response to a replayed request
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wrote {
+		rec.status, rec.wrote = status, true
+	}
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(p)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// Audit query limits
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 10000
+)
+
+// audit records a change r made in the audit log. The change is already
+// saved, so a failure to record it is logged rather than answered.
+func (a *API) audit(r *http.Request, action, object, detail string, version int64) {
+	actor, address := audit.ActorFrom(r.Context())
+	_, err := a.opts.Audit.Record(r.Context(), audit.Event{Actor: actor, Address: address, Action: action, Object: object, Detail: detail, Version: version})
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to audit", "action", action, "object", object, "error", err)
+	}
+}
+
+// describeRule summarizes a rule for the audit log
+func describeRule(r store.Rule) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", r.Type, r.Domain)
+	if r.Category != "" {
+		fmt.Fprintf(&b, " category=%s", r.Category)
+	}
+	if len(r.Groups) > 0 {
+		fmt.Fprintf(&b, " groups=%s", strings.Join(r.Groups, ","))
+	}
+	if r.EffectiveFrom != nil {
+		fmt.Fprintf(&b, " from=%s", r.EffectiveFrom.Format(time.RFC3339))
+	}
+	if r.EffectiveUntil != nil {
+		fmt.Fprintf(&b, " until=%s", r.EffectiveUntil.Format(time.RFC3339))
+	}
+	if s := r.Schedule; s != nil {
+		fmt.Fprintf(&b, " schedule=%s-%s", s.Start, s.End)
+		if len(s.Days) > 0 {
+			fmt.Fprintf(&b, ",%s", strings.Join(s.Days, ","))
+		}
+	}
+	return b.String()
+}
+
+// ListAudit returns audit events, newest first, optionally only those of
+// ?actor=, ?action= (e.g. rule.create, or rule. for every rule change),
+// ?object= (e.g. "rule 12"), and ?since= and ?until= (RFC 3339), up to
+// ?limit= (default 100)
+func (a *API) ListAudit(w http.ResponseWriter, r *http.Request) {
+	if a.opts.Audit == nil {
+		writeError(w, http.StatusNotFound, "audit log is not enabled")
+		return
+	}
+	q := r.URL.Query()
+	f := audit.Filter{Actor: q.Get("actor"), Action: q.Get("action"), Object: q.Get("object"), Limit: defaultAuditLimit}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, p.name+" must be an RFC 3339 time such as 2026-06-01T09:00:00Z")
+				return
+			}
+			*p.t = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit))
+			return
+		}
+		f.Limit = n
+	}
+	events, err := a.opts.Audit.Events(r.Context(), f)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to read audit log", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to read audit log")
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events, "total": len(events)})
+}
+
+// VerifyAudit checks that no audit event was changed or removed since it
+// was recorded, answering 409 if one was
+func (a *API) VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	if a.opts.Audit == nil {
+		writeError(w, http.StatusNotFound, "audit log is not enabled")
+		return
+	}
+	n, err := a.opts.Audit.Verify(r.Context())
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "audit log verification failed", "events", n, "error", err)
+		writeJSON(w, http.StatusConflict, map[string]any{"ok": false, "events": n, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "events": n})
+}
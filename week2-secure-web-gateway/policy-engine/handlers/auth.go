@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+)
+
+// Roles, each allowed what the one before it is
+const (
+	RoleViewer   = "viewer"   // read the policy, history, audit log and sources, and test URLs
+	RoleEditor   = "editor"   // change the policy
+	RoleApprover = "approver" // approve other people's changes that need approval
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleApprover: 3}
+
+// actorAdmin is the user the admin token signs in as
+const actorAdmin = "admin"
+
+// adminLoginWindow is how long a user's requests from one address count as
+// one sign-in in the audit log
+const adminLoginWindow = time.Hour
+
+// User is a policy admin, signed in by their API token
+type User struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Token is the user's API token, or TokenSHA256 its SHA-256 in hex so
+	// the users file doesn't hold the token itself
+	Token       string `json:"token,omitempty"`
+	TokenSHA256 string `json:"token_sha256,omitempty"`
+}
+
+// can reports whether the user has role or a role above it
+func (u User) can(role string) bool {
+	return roleRank[u.Role] >= roleRank[role]
+}
+
+// tokenHash returns the SHA-256 of the user's token
+func (u User) tokenHash() []byte {
+	if u.Token != "" {
+		sum := sha256.Sum256([]byte(u.Token))
+		return sum[:]
+	}
+	sum, _ := hex.DecodeString(u.TokenSHA256)
+	return sum
+}
+
+// ReadUsers reads the users file: {"users": [{"name": "alice", "role":
+// "approver", "token_sha256": "..."}]}
+func ReadUsers(path string) ([]User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	var file struct {
+		Users []User `json:"users"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse users %s: %w", path, err)
+	}
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i, u := range file.Users {
+		switch {
+		case u.Name == "" || u.Name == actorAdmin || u.Name == audit.ActorAnonymous || u.Name == audit.ActorScheduler:
+			return nil, fmt.Errorf("users[%d]: name %q is missing or reserved", i, u.Name)
+		case names[u.Name]:
+			return nil, fmt.Errorf("users[%d]: %s is listed twice", i, u.Name)
+		case roleRank[u.Role] == 0:
+			return nil, fmt.Errorf("users[%d]: role must be %s, %s or %s", i, RoleViewer, RoleEditor, RoleApprover)
+		case (u.Token == "") == (u.TokenSHA256 == ""):
+			return nil, fmt.Errorf("users[%d]: exactly one of token and token_sha256 is required", i)
+		case len(u.tokenHash()) != sha256.Size:
+			return nil, fmt.Errorf("users[%d]: token_sha256 must be 64 hex digits", i)
+		case tokens[string(u.tokenHash())]:
+			return nil, fmt.Errorf("users[%d]: %s has the same token as another user", i, u.Name)
+		}
+		names[u.Name], tokens[string(u.tokenHash())] = true, true
+	}
+	return file.Users, nil
+}
+
+type userKey struct{}
+
+// requireRole protects the endpoints that read or change the admin side of
+// the policy, letting only users with role or above through. Without an
+// admin token or users configured they are closed, unless the API was
+// explicitly left open (development mode). The request's context says who
+// is making it, for the audit log.
+func (a *API) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(User)
+		if !ok {
+			if u, ok = a.authenticate(r); !ok {
+				detail := "wrong token"
+				if bearerToken(r) == "" {
+					detail = "no token"
+				}
+				a.logins.Failed(r.Context(), "", r.RemoteAddr, detail)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="swg-policy-engine"`)
+				writeError(w, http.StatusUnauthorized, "admin token required")
+				return
+			}
+			if !a.devMode() {
+				a.logins.Succeeded(r.Context(), "", u.Name, r.RemoteAddr)
+			}
+		}
+		if !u.can(role) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%s role required; %s is a %s", role, u.Name, u.Role))
+			return
+		}
+		ctx := context.WithValue(r.Context(), userKey{}, u)
+		if _, replayed := r.Context().Value(approvalKey{}).(Approval); !replayed {
+			ctx = audit.WithActor(ctx, u.Name, r.RemoteAddr)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// authenticate returns the user the request's bearer token signs in
+func (a *API) authenticate(r *http.Request) (User, bool) {
+	if a.devMode() {
+		return User{Name: audit.ActorAnonymous, Role: RoleApprover}, true
+	}
+	sum := sha256.Sum256([]byte(bearerToken(r)))
+	if a.opts.AdminToken != "" && tokenEqual(bearerToken(r), a.opts.AdminToken) {
+		return User{Name: actorAdmin, Role: RoleApprover}, true
+	}
+	for _, u := range a.opts.Users {
+		if subtle.ConstantTimeCompare(sum[:], u.tokenHash()) == 1 {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// devMode reports whether the API was left open, with InsecureNoAuth and
+// no credentials
+func (a *API) devMode() bool {
+	return a.opts.InsecureNoAuth && a.opts.AdminToken == "" && len(a.opts.Users) == 0
+}
+
+// currentUser returns the user requireRole let through
+func currentUser(r *http.Request) User {
+	u, _ := r.Context().Value(userKey{}).(User)
+	return u
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// tokenEqual compares tokens in constant time, whatever their lengths
+func tokenEqual(presented, expected string) bool {
+	a, b := sha256.Sum256([]byte(presented)), sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// maxCategoryBytes caps a category body, which may list many domains
+const maxCategoryBytes = 4 << 20
+
+// CategoryInput is the body of POST /categories and PUT /categories/{name}
+type CategoryInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Action      string   `json:"action"` // block (default) or allow
+	Domains     []string `json:"domains"`
+}
+
+// CategoryResponse answers the category endpoints that change a category
+type CategoryResponse struct {
+	Category store.Category `json:"category"`
+	Version  int64          `json:"version"`
+}
+
+// CategorySummary is a category without its member domains, as
+// GET /categories lists it
+type CategorySummary struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Action      string    `json:"action"`
+	Domains     int       `json:"domains"` // how many
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// errInvalid marks an update rejected as invalid, answered with 422
+type errInvalid struct{ error }
+
+// ListCategories lists the categories without their member domains, which
+// GET /categories/{name} returns
+func (a *API) ListCategories(w http.ResponseWriter, r *http.Request) {
+	p := a.store.Policy()
+	out := make([]CategorySummary, len(p.Categories))
+	for i, c := range p.Categories {
+		out[i] = CategorySummary{Name: c.Name, Description: c.Description, Action: c.Action, Domains: len(c.Domains), UpdatedAt: c.UpdatedAt}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"categories": out, "total": len(out), "version": p.Version})
+}
+
+// GetCategory returns one category with its member domains
+func (a *API) GetCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.store.Policy().Category(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, store.ErrCategoryNotFound.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// CreateCategory adds a category, which takes effect on the next
+// GET /policy:
+//
+//	POST /categories {"name": "social", "description": "Social networks", "action": "block", "domains": ["facebook.com", "tiktok.com"]}
+func (a *API) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCategory(w, r)
+	if !ok {
+		return
+	}
+	c, p, err := a.store.CreateCategory(c)
+	if !a.categorySaved(w, "create", c.Name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "category created", "category", c.Name, "action", c.Action, "domains", len(c.Domains), "version", p.Version)
+	a.audit(r, "category.create", "category "+c.Name, fmt.Sprintf("%s %d domains", c.Action, len(c.Domains)), p.Version)
+	writeJSON(w, http.StatusCreated, CategoryResponse{Category: c, Version: p.Version})
+}
+
+// UpdateCategory replaces a category's description, action and domains
+func (a *API) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	in, ok := readCategory(w, r)
+	if !ok {
+		return
+	}
+	if in.Name != name {
+		writeError(w, http.StatusUnprocessableEntity, "name cannot be changed; create a new category instead")
+		return
+	}
+	c, p, err := a.store.UpdateCategory(name, func(c *store.Category) error {
+		c.Description, c.Action, c.Domains = in.Description, in.Action, in.Domains
+		return nil
+	})
+	if !a.categorySaved(w, "update", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "category updated", "category", c.Name, "action", c.Action, "domains", len(c.Domains), "version", p.Version)
+	a.audit(r, "category.update", "category "+c.Name, fmt.Sprintf("%s %d domains", c.Action, len(c.Domains)), p.Version)
+	writeJSON(w, http.StatusOK, CategoryResponse{Category: c, Version: p.Version})
+}
+
+// DeleteCategory removes a category
+func (a *API) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, err := a.store.DeleteCategory(name)
+	if !a.categorySaved(w, "delete", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "category deleted", "category", name, "version", p.Version)
+	a.audit(r, "category.delete", "category "+name, "", p.Version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddCategoryDomains adds members to a category without listing the rest:
+//
+//	POST /categories/social/domains {"domains": ["instagram.com"]}
+func (a *API) AddCategoryDomains(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Domains []string `json:"domains"`
+	}
+	if !readJSON(w, r, maxCategoryBytes, &in) {
+		return
+	}
+	if len(in.Domains) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "domains is required")
+		return
+	}
+	for i, d := range in.Domains {
+		domain, err := store.NormalizeDomain(d)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		in.Domains[i] = domain
+	}
+	name := r.PathValue("name")
+	c, p, err := a.store.UpdateCategory(name, func(c *store.Category) error {
+		c.Domains = append(c.Domains, in.Domains...)
+		if err := c.Validate(); err != nil {
+			return errInvalid{err}
+		}
+		return nil
+	})
+	if !a.categorySaved(w, "update", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "domains added to category", "category", name, "domains", len(in.Domains), "version", p.Version)
+	a.audit(r, "category.add_domains", "category "+name, strings.Join(in.Domains, " "), p.Version)
+	writeJSON(w, http.StatusOK, CategoryResponse{Category: c, Version: p.Version})
+}
+
+// RemoveCategoryDomain removes one member from a category
+func (a *API) RemoveCategoryDomain(w http.ResponseWriter, r *http.Request) {
+	domain, err := store.NormalizeDomain(r.PathValue("domain"))
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	name := r.PathValue("name")
+	c, p, err := a.store.UpdateCategory(name, func(c *store.Category) error {
+		i := slices.Index(c.Domains, domain)
+		if i < 0 {
+			return store.ErrNotFound
+		}
+		c.Domains = slices.Delete(c.Domains, i, i+1)
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, domain+" is not in category "+name)
+		return
+	}
+	if !a.categorySaved(w, "update", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "domain removed from category", "category", name, "domain", domain, "version", p.Version)
+	a.audit(r, "category.remove_domain", "category "+name, domain, p.Version)
+	writeJSON(w, http.StatusOK, CategoryResponse{Category: c, Version: p.Version})
+}
+
+// readCategory decodes and validates a category body, answering 400 or
+// 422 if it is not a valid category
+func readCategory(w http.ResponseWriter, r *http.Request) (store.Category, bool) {
+	var in CategoryInput
+	if !readJSON(w, r, maxCategoryBytes, &in) {
+		return store.Category{}, false
+	}
+	c := store.Category{Name: in.Name, Description: in.Description, Action: in.Action, Domains: in.Domains}
+	if c.Domains == nil {
+		c.Domains = []string{}
+	}
+	if err := c.Validate(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return store.Category{}, false
+	}
+	return c, true
+}
+
+// categorySaved answers a failed category change and reports whether it
+// succeeded
+func (a *API) categorySaved(w http.ResponseWriter, action, name string, err error) bool {
+	var invalid errInvalid
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &invalid):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, store.ErrCategoryNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrCategoryExists):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		a.log.Error("failed to save category", "action", action, "category", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// ChangesResponse answers GET /policy/changes: how to turn the policy a
+// proxy holds into the current one. Categories lists the categories added
+// or changed, in full.
+type ChangesResponse struct {
+	Group             string                    `json:"group,omitempty"`
+	Since             int64                     `json:"since"`
+	Version           int64                     `json:"version"`
+	GeneratedAt       time.Time                 `json:"generated_at"`
+	Added             []string                  `json:"added"`
+	Removed           []string                  `json:"removed"`
+	ExactAdded        []string                  `json:"exact_added"`
+	ExactRemoved      []string                  `json:"exact_removed"`
+	WildcardsAdded    []string                  `json:"wildcards_added"`
+	WildcardsRemoved  []string                  `json:"wildcards_removed"`
+	RegexesAdded      []string                  `json:"regexes_added"`
+	RegexesRemoved    []string                  `json:"regexes_removed"`
+	Categories        map[string]PolicyCategory `json:"categories"`
+	CategoriesRemoved []string                  `json:"categories_removed"`
+}
+
+// PolicyChanges serves the difference between the policy a proxy got from
+// GET /policy and the current one, so a proxy with a large blocklist can
+// apply a delta instead of rebuilding it:
+//
+//	GET /policy/changes?since=41&since_time=2026-06-01T09:00:00Z&group=students
+//
+// since and since_time are the version and generated_at of the policy the
+// proxy holds, which matter because scheduled rules change what is blocked
+// without a new version. The group, device and at parameters work as for
+// GET /policy. A version no longer in the history answers 410, and the
+// proxy should fetch GET /policy in full.
+func (a *API) PolicyChanges(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	since, err := strconv.ParseInt(q.Get("since"), 10, 64)
+	if err != nil || since <= 0 {
+		writeError(w, http.StatusBadRequest, "since must be a policy version")
+		return
+	}
+	sinceTime, err := time.Parse(time.RFC3339, q.Get("since_time"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "since_time must be the RFC 3339 generated_at of that version")
+		return
+	}
+	p := a.store.Policy()
+	if since > p.Version {
+		writeError(w, http.StatusBadRequest, "since is later than the current version")
+		return
+	}
+	group, at, ok := a.policyScope(w, r, p)
+	if !ok {
+		return
+	}
+	old, err := a.store.Snapshot(since)
+	if errors.Is(err, store.ErrVersionNotFound) {
+		writeError(w, http.StatusGone, "version "+strconv.FormatInt(since, 10)+" is no longer in the history; fetch /policy")
+		return
+	}
+	if err != nil {
+		a.historyError(w, err)
+		return
+	}
+
+	was, now := old.Blocked(sinceTime, group), p.Blocked(at, group)
+	resp := ChangesResponse{Group: group, Since: since, Version: p.Version, GeneratedAt: at, Categories: map[string]PolicyCategory{}}
+	resp.Added, resp.Removed = diffSorted(was.Domains, now.Domains)
+	resp.ExactAdded, resp.ExactRemoved = diffSorted(was.Exact, now.Exact)
+	resp.WildcardsAdded, resp.WildcardsRemoved = diffSorted(was.Wildcards, now.Wildcards)
+	resp.RegexesAdded, resp.RegexesRemoved = diffSorted(was.Regexes, now.Regexes)
+	oldCategories, categories := policyCategories(old), policyCategories(p)
+	for name, c := range categories {
+		if prev, ok := oldCategories[name]; !ok || !reflect.DeepEqual(prev, c) {
+			resp.Categories[name] = c
+		}
+	}
+	resp.CategoriesRemoved = []string{}
+	for _, c := range old.Categories {
+		if _, ok := categories[c.Name]; !ok {
+			resp.CategoriesRemoved = append(resp.CategoriesRemoved, c.Name)
+		}
+	}
+	a.log.InfoContext(r.Context(), "policy changes requested", "from_version", since, "version", p.Version, "remote_addr", r.RemoteAddr, "group", group,
+		"domains_added", len(resp.Added), "domains_removed", len(resp.Removed), "exact_added", len(resp.ExactAdded), "exact_removed", len(resp.ExactRemoved),
+		"wildcards_added", len(resp.WildcardsAdded), "wildcards_removed", len(resp.WildcardsRemoved), "regexes_added", len(resp.RegexesAdded), "regexes_removed", len(resp.RegexesRemoved))
+	a.writeSigned(w, http.StatusOK, cryptoutil.ChangesDocument, since, at, resp)
+}
+
+// diffSorted compares sorted, deduplicated lists
+func diffSorted(old, new []string) (added, removed []string) {
+	added, removed = []string{}, []string{}
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case j == len(new) || (i < len(old) && old[i] < new[j]):
+			removed = append(removed, old[i])
+			i++
+		case i == len(old) || new[j] < old[i]:
+			added = append(added, new[j])
+			j++
+		default:
+			i, j = i+1, j+1
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// maxTestURLs caps the URLs one POST /policy/test checks
+const maxTestURLs = 1000
+
+// PolicyTestInput is the body of POST /policy/test
+type PolicyTestInput struct {
+	URLs     []string         `json:"urls"` // URLs or host names
+	Proposed *ProposedChanges `json:"proposed"`
+}
+
+// ProposedChanges are changes to test against the current policy without
+// making them
+type ProposedChanges struct {
+	AddRules    []RuleInput `json:"add_rules"`
+	RemoveRules []int64     `json:"remove_rules"`
+	// Categories are added, or replace the category of the same name
+	Categories       []CategoryInput `json:"categories"`
+	RemoveCategories []string        `json:"remove_categories"`
+}
+
+// PolicyTestResult is the verdict on one URL under the current policy and,
+// if changes were proposed, under them
+type PolicyTestResult struct {
+	Input    string         `json:"input"`
+	Error    string         `json:"error,omitempty"` // why the input is not a URL or host name
+	Current  *store.Verdict `json:"current,omitempty"`
+	Proposed *store.Verdict `json:"proposed,omitempty"`
+	Changed  bool           `json:"changed,omitempty"` // the proposed changes would block or allow it instead
+}
+
+// TestPolicy returns the verdict each URL would get from the proxy, so
+// admins can check changes before making them:
+//
+//	POST /policy/test?group=students {"urls": ["https://www.tiktok.com/foryou", "khanacademy.org"],
+//	    "proposed": {"add_rules": [{"domain": "khanacademy.org"}], "remove_rules": [4]}}
+//
+// ?group=, ?device= and ?at= work as they do for GET /policy. Proposed
+// rules get the IDs they would be created with, in order.
+func (a *API) TestPolicy(w http.ResponseWriter, r *http.Request) {
+	p := a.store.Policy()
+	group, at, ok := a.policyScope(w, r, p)
+	if !ok {
+		return
+	}
+	var in PolicyTestInput
+	if !readJSON(w, r, maxCategoryBytes, &in) {
+		return
+	}
+	switch {
+	case len(in.URLs) == 0:
+		writeError(w, http.StatusUnprocessableEntity, "urls is required")
+		return
+	case len(in.URLs) > maxTestURLs:
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d urls can be tested at once", maxTestURLs))
+		return
+	}
+	var proposed store.Policy
+	if in.Proposed != nil {
+		var err error
+		if proposed, err = propose(p, *in.Proposed); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+
+	results := make([]PolicyTestResult, len(in.URLs))
+	changed := 0
+	for i, u := range in.URLs {
+		res := PolicyTestResult{Input: u}
+		host, err := testHost(u)
+		if err != nil {
+			res.Error = err.Error()
+			results[i] = res
+			continue
+		}
+		current := p.Match(host, at, group)
+		res.Current = &current
+		if in.Proposed != nil {
+			v := proposed.Match(host, at, group)
+			res.Proposed = &v
+			res.Changed = v.Blocked != current.Blocked
+			if res.Changed {
+				changed++
+			}
+		}
+		results[i] = res
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"group":   group,
+		"at":      at,
+		"version": p.Version,
+		"results": results,
+		"total":   len(results),
+		"changed": changed,
+	})
+}
+
+// testHost returns the normalized host name of a URL, a host name or a
+// host:port
+func testHost(input string) (string, error) {
+	s := strings.TrimSpace(input)
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("%q is not a URL or host name", input)
+	}
+	return store.NormalizeDomain(u.Hostname())
+}
+
+// propose returns p with the proposed changes made, checked as the store
+// would check them
+func propose(p store.Policy, c ProposedChanges) (store.Policy, error) {
+	next := p
+	next.Rules = slices.Clone(p.Rules)
+	for _, id := range c.RemoveRules {
+		i := slices.IndexFunc(next.Rules, func(r store.Rule) bool { return r.ID == id })
+		if i < 0 {
+			return p, fmt.Errorf("remove_rules: rule %d not found", id)
+		}
+		next.Rules = slices.Delete(next.Rules, i, i+1)
+	}
+	for i, in := range c.AddRules {
+		rule := store.Rule{
+			ID: p.NextID + int64(i), Type: in.Type, Domain: in.Domain, Category: in.Category, Groups: in.Groups,
+			EffectiveFrom: in.EffectiveFrom, EffectiveUntil: in.EffectiveUntil, Schedule: in.Schedule,
+		}
+		if err := rule.Validate(); err != nil {
+			return p, fmt.Errorf("add_rules[%d]: %w", i, err)
+		}
+		for _, g := range rule.Groups {
+			if _, ok := p.Group(g); !ok {
+				return p, fmt.Errorf("add_rules[%d]: group %s not found", i, g)
+			}
+		}
+		next.Rules = append(next.Rules, rule)
+	}
+
+	next.Categories = slices.Clone(p.Categories)
+	for _, name := range c.RemoveCategories {
+		i := slices.IndexFunc(next.Categories, func(c store.Category) bool { return c.Name == name })
+		if i < 0 {
+			return p, fmt.Errorf("remove_categories: category %s not found", name)
+		}
+		next.Categories = slices.Delete(next.Categories, i, i+1)
+	}
+	for i, in := range c.Categories {
+		cat := store.Category{Name: in.Name, Description: in.Description, Action: in.Action, Domains: slices.Clone(in.Domains)}
+		if err := cat.Validate(); err != nil {
+			return p, fmt.Errorf("categories[%d]: %w", i, err)
+		}
+		j := slices.IndexFunc(next.Categories, func(c store.Category) bool { return c.Name == cat.Name })
+		if j < 0 {
+			next.Categories = append(next.Categories, cat)
+		} else {
+			next.Categories[j] = cat
+		}
+	}
+	sort.Slice(next.Categories, func(i, j int) bool { return next.Categories[i].Name < next.Categories[j].Name })
+	return next, nil
+}
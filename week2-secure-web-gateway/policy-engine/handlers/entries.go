@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// Search limits for GET /entries
+const (
+	defaultEntries = 100
+	maxEntries     = 1000
+)
+
+// Entry is one thing the policy blocks or allows, wherever it came from:
+// a rule, a category member or a domain of an imported blocklist
+type Entry struct {
+	Origin   string   `json:"origin"`            // rule, category or source
+	RuleID   int64    `json:"rule_id,omitempty"` // for rules
+	Name     string   `json:"name,omitempty"`    // the category or source the entry is in
+	Type     string   `json:"type"`              // the rule type, suffix for sources; block or allow for categories
+	Entry    string   `json:"entry"`             // the domain or pattern
+	Category string   `json:"category,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	State    string   `json:"state,omitempty"` // for rules: active, idle, scheduled or expired
+
+	Hits        int64      `json:"hits"`
+	LastMatched *time.Time `json:"last_matched,omitempty"`
+}
+
+// SearchEntries finds the entries whose domain or pattern contains ?q=, or
+// all of them without it, listing at most ?limit= (default 100). Rules come
+// first, then categories, then imported blocklists.
+func (a *API) SearchEntries(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	limit := defaultEntries
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(n, maxEntries)
+	}
+
+	p := a.store.Policy()
+	entries := []Entry{}
+	total := 0
+	eachEntry(p, a.now(), func(e Entry, hitType string) {
+		if !strings.Contains(e.Entry, q) {
+			return
+		}
+		total++
+		if len(entries) >= limit {
+			return
+		}
+		if h, ok := a.hits.get(hitType, e.Entry); ok {
+			e.Hits, e.LastMatched = h.Count, &h.LastMatched
+		}
+		entries = append(entries, e)
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries, "total": total, "version": p.Version})
+}
+
+// eachEntry calls add with each entry of p, rules stated as of now, and the
+// type the proxies report its hits under
+func eachEntry(p store.Policy, now time.Time, add func(e Entry, hitType string)) {
+	for _, rule := range p.Rules {
+		add(Entry{
+			Origin: "rule", RuleID: rule.ID, Type: rule.Type, Entry: rule.Domain,
+			Category: rule.Category, Groups: rule.Groups, State: rule.State(now),
+		}, ruleHitType(rule.Type))
+	}
+	for _, c := range p.Categories {
+		hitType := HitCategory
+		switch c.Action {
+		case store.ActionAllow:
+			hitType = HitAllow
+		case store.ActionTrusted:
+			hitType = HitTrusted
+		}
+		for _, d := range c.Domains {
+			add(Entry{Origin: "category", Name: c.Name, Type: c.Action, Entry: d, Category: c.Name}, hitType)
+		}
+	}
+	for _, s := range p.Sources {
+		for _, d := range s.Domains {
+			add(Entry{Origin: "source", Name: s.Name, Type: store.TypeSuffix, Entry: d, Category: s.Category}, HitDomain)
+		}
+	}
+}
+
+// ruleHitType returns the type the proxies report hits on rules of a type
+// under: the list of the policy the rule's entry is in
+func ruleHitType(ruleType string) string {
+	switch ruleType {
+	case store.TypeExact:
+		return HitExact
+	case store.TypeWildcard:
+		return HitWildcard
+	case store.TypeRegex:
+		return HitRegex
+	}
+	return HitDomain
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// maxDocumentBytes caps a policy document to import; categories can hold
+// many domains
+const maxDocumentBytes = 16 << 20
+
+// ImportResponse answers POST /policy/import
+type ImportResponse struct {
+	DryRun  bool          `json:"dry_run"`
+	Changed bool          `json:"changed"`
+	Version int64         `json:"version"` // the version made, or the current one
+	Changes store.Changes `json:"changes"`
+}
+
+// ExportPolicy serves the policy as a YAML document to review and keep in
+// version control, and to import again with POST /policy/import
+func (a *API) ExportPolicy(w http.ResponseWriter, r *http.Request) {
+	p := a.store.Policy()
+	data, err := p.Document().YAML()
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "export failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to export policy")
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Content-Disposition", `attachment; filename="policy.yaml"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// ImportPolicy makes the policy match a YAML document, as one new version,
+// and answers with what changed. The whole document is checked first: one
+// with problems answers 422 listing them all and changes nothing. With
+// ?dry_run=true it only answers with what would change.
+//
+//	POST /policy/import?dry_run=true
+//	rules:
+//	  - type: suffix
+//	    domain: tiktok.com
+//	categories: []
+//	...
+func (a *API) ImportPolicy(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDocumentBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "policy document too large")
+		return
+	}
+	doc, err := store.ParseDocument(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	changes, p, err := a.store.Apply(doc, dryRun)
+	var invalid *store.InvalidDocumentError
+	if errors.As(err, &invalid) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": "invalid policy document", "problems": invalid.Problems})
+		return
+	}
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "import failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+		return
+	}
+	resp := ImportResponse{DryRun: dryRun, Changed: !changes.Empty(), Version: p.Version, Changes: changes}
+	if dryRun || !resp.Changed {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	summary := changeSummary(changes)
+	a.log.InfoContext(r.Context(), "policy document imported", "version", p.Version, "summary", summary)
+	a.audit(r, "policy.import", "", summary, p.Version)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// importImpact holds imports for approval, which can change anything, but
+// not dry runs, which change nothing
+func importImpact(r *http.Request, body []byte) string {
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run")); dryRun {
+		return ""
+	}
+	return "policy import"
+}
+
+// changeSummary counts the changes, e.g. "+2 -1 ~0 rules, +1 -0 ~1 categories"
+func changeSummary(c store.Changes) string {
+	named := func(n *store.NameChanges) (added, removed, changed int) {
+		if n == nil {
+			return 0, 0, 0
+		}
+		return len(n.Added), len(n.Removed), len(n.Changed)
+	}
+	ca, cr, cc := named(c.Categories)
+	ga, gr, gc := named(c.Groups)
+	sa, sr, sc := named(c.Sources)
+	return fmt.Sprintf("+%d -%d ~%d rules, +%d -%d ~%d categories, +%d -%d ~%d groups, +%d -%d ~%d sources",
+		len(c.RulesAdded), len(c.RulesRemoved), len(c.RulesChanged), ca, cr, cc, ga, gr, gc, sa, sr, sc)
+}
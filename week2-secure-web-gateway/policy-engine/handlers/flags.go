@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// maxFlagBytes caps a flag body
+const maxFlagBytes = 4 << 10
+
+// FlagInput is the body of PUT /flags/{name}
+type FlagInput struct {
+	Value       string `json:"value"` // on, off or a percentage, e.g. 25%
+	Description string `json:"description"`
+}
+
+// FlagResponse answers PUT /flags/{name}
+type FlagResponse struct {
+	Flag    store.Flag `json:"flag"`
+	Version int64      `json:"version"`
+}
+
+// GetFlags serves the fleet's feature flag values, which proxies and
+// agents poll and which win over their own configuration
+func (a *API) GetFlags(w http.ResponseWriter, r *http.Request) {
+	p := a.store.Policy()
+	writeJSON(w, http.StatusOK, flags.Document{Flags: p.FlagValues(), Version: p.Version})
+}
+
+// GetFlag returns one flag with its description and when it was set
+func (a *API) GetFlag(w http.ResponseWriter, r *http.Request) {
+	fl, ok := a.store.Policy().Flag(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, store.ErrFlagNotFound.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, fl)
+}
+
+// SetFlag sets a flag for the fleet, adding it if it is new:
+//
+//	PUT /flags/mitm {"value": "10%", "description": "Intercept HTTPS"}
+func (a *API) SetFlag(w http.ResponseWriter, r *http.Request) {
+	var in FlagInput
+	if !readJSON(w, r, maxFlagBytes, &in) {
+		return
+	}
+	value, err := flags.ParseValue(in.Value)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	fl := store.Flag{Name: r.PathValue("name"), Description: in.Description, Value: value}
+	if err := fl.Validate(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	fl, added, p, err := a.store.SetFlag(fl)
+	if err != nil {
+		a.log.ErrorContext(r.Context(), "failed to set flag", "flag", fl.Name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+		return
+	}
+	a.log.InfoContext(r.Context(), "flag set", "flag", fl.Name, "value", fl.Value, "version", p.Version)
+	a.audit(r, "flag.set", "flag "+fl.Name, fl.Value.String(), p.Version)
+	code := http.StatusOK
+	if added {
+		code = http.StatusCreated
+	}
+	writeJSON(w, code, FlagResponse{Flag: fl, Version: p.Version})
+}
+
+// DeleteFlag removes a flag, so that services go back to their own
+// configuration for it
+func (a *API) DeleteFlag(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, err := a.store.DeleteFlag(name)
+	switch {
+	case errors.Is(err, store.ErrFlagNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		a.log.ErrorContext(r.Context(), "failed to delete flag", "flag", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+		return
+	}
+	a.log.InfoContext(r.Context(), "flag deleted", "flag", name, "version", p.Version)
+	a.audit(r, "flag.delete", "flag "+name, "", p.Version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fleetWideFlag marks flags turned on for every device at once, rather
+// than rolled out to a percentage of them first
+func fleetWideFlag(r *http.Request, body []byte) string {
+	var in FlagInput
+	if json.Unmarshal(body, &in) == nil {
+		if v, err := flags.ParseValue(in.Value); err == nil && v == flags.On {
+			return "fleet-wide flag"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// maxGroupBytes caps a group body, which may list many devices
+const maxGroupBytes = 1 << 20
+
+// GroupInput is the body of POST /groups and PUT /groups/{name}
+type GroupInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Devices     []string `json:"devices"`
+}
+
+// GroupResponse answers the group endpoints that change a group
+type GroupResponse struct {
+	Group   store.Group `json:"group"`
+	Version int64       `json:"version"`
+}
+
+// ListGroups lists the groups with their devices
+func (a *API) ListGroups(w http.ResponseWriter, r *http.Request) {
+	p := a.store.Policy()
+	groups := p.Groups
+	if groups == nil {
+		groups = []store.Group{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"groups": groups, "total": len(groups), "version": p.Version})
+}
+
+// GetGroup returns one group
+func (a *API) GetGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := a.store.Policy().Group(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, store.ErrGroupNotFound.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+// CreateGroup adds a group, to which rules can then be scoped:
+//
+//	POST /groups {"name": "engineering", "devices": ["laptop-42", "build-01"]}
+func (a *API) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := readGroup(w, r)
+	if !ok {
+		return
+	}
+	g, p, err := a.store.CreateGroup(g)
+	if !a.groupSaved(w, "create", g.Name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "group created", "group", g.Name, "devices", len(g.Devices), "version", p.Version)
+	a.audit(r, "group.create", "group "+g.Name, strings.Join(g.Devices, " "), p.Version)
+	writeJSON(w, http.StatusCreated, GroupResponse{Group: g, Version: p.Version})
+}
+
+// UpdateGroup replaces a group's description and devices
+func (a *API) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	in, ok := readGroup(w, r)
+	if !ok {
+		return
+	}
+	if in.Name != name {
+		writeError(w, http.StatusUnprocessableEntity, "name cannot be changed; create a new group instead")
+		return
+	}
+	g, p, err := a.store.UpdateGroup(name, func(g *store.Group) error {
+		g.Description, g.Devices = in.Description, in.Devices
+		return nil
+	})
+	if !a.groupSaved(w, "update", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "group updated", "group", g.Name, "devices", len(g.Devices), "version", p.Version)
+	a.audit(r, "group.update", "group "+g.Name, strings.Join(g.Devices, " "), p.Version)
+	writeJSON(w, http.StatusOK, GroupResponse{Group: g, Version: p.Version})
+}
+
+// DeleteGroup removes a group no rule is scoped to
+func (a *API) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, err := a.store.DeleteGroup(name)
+	if !a.groupSaved(w, "delete", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "group deleted", "group", name, "version", p.Version)
+	a.audit(r, "group.delete", "group "+name, "", p.Version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AssignDevice puts a device in a group. A device is in at most one group,
+// so one already in another group is refused with 409.
+func (a *API) AssignDevice(w http.ResponseWriter, r *http.Request) {
+	device, err := store.NormalizeDevice(r.PathValue("device"))
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	name := r.PathValue("name")
+	g, p, err := a.store.UpdateGroup(name, func(g *store.Group) error {
+		if i, found := slices.BinarySearch(g.Devices, device); !found {
+			g.Devices = slices.Insert(g.Devices, i, device)
+		}
+		return nil
+	})
+	if !a.groupSaved(w, "update", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "device assigned to group", "device", device, "group", name, "version", p.Version)
+	a.audit(r, "group.assign_device", "group "+name, device, p.Version)
+	writeJSON(w, http.StatusOK, GroupResponse{Group: g, Version: p.Version})
+}
+
+// UnassignDevice takes a device out of a group
+func (a *API) UnassignDevice(w http.ResponseWriter, r *http.Request) {
+	device, err := store.NormalizeDevice(r.PathValue("device"))
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	name := r.PathValue("name")
+	g, p, err := a.store.UpdateGroup(name, func(g *store.Group) error {
+		i, found := slices.BinarySearch(g.Devices, device)
+		if !found {
+			return store.ErrNotFound
+		}
+		g.Devices = slices.Delete(g.Devices, i, i+1)
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, device+" is not in group "+name)
+		return
+	}
+	if !a.groupSaved(w, "update", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "device removed from group", "device", device, "group", name, "version", p.Version)
+	a.audit(r, "group.unassign_device", "group "+name, device, p.Version)
+	writeJSON(w, http.StatusOK, GroupResponse{Group: g, Version: p.Version})
+}
+
+// readGroup decodes and validates a group body, answering 400 or 422 if
+// it is not a valid group
+func readGroup(w http.ResponseWriter, r *http.Request) (store.Group, bool) {
+	var in GroupInput
+	if !readJSON(w, r, maxGroupBytes, &in) {
+		return store.Group{}, false
+	}
+	g := store.Group{Name: in.Name, Description: in.Description, Devices: in.Devices}
+	if err := g.Validate(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return store.Group{}, false
+	}
+	return g, true
+}
+
+// groupSaved answers a failed group change and reports whether it
+// succeeded
+func (a *API) groupSaved(w http.ResponseWriter, action, name string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrGroupNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrGroupExists), errors.Is(err, store.ErrGroupInUse), errors.Is(err, store.ErrDeviceAssigned):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		a.log.Error("failed to save group", "action", action, "group", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+	}
+	return false
+}
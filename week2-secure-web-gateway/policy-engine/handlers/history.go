@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// RollbackRequest is the body of POST /policy/rollback
+type RollbackRequest struct {
+	Version int64 `json:"version"`
+}
+
+// RollbackResponse answers POST /policy/rollback
+type RollbackResponse struct {
+	Version      int64         `json:"version"` // the new version
+	RestoredFrom int64         `json:"restored_from"`
+	Changes      store.Changes `json:"changes"` // from the version rolled back from
+}
+
+// ListHistory lists the versions kept for rollback, newest first, each with
+// what changed from the version before it
+func (a *API) ListHistory(w http.ResponseWriter, r *http.Request) {
+	history := a.store.History()
+	writeJSON(w, http.StatusOK, map[string]any{"revisions": history, "total": len(history), "version": a.store.Policy().Version})
+}
+
+// GetRevision returns one version's changes. With ?against=<version> it
+// compares the version with that one instead of the version before it.
+func (a *API) GetRevision(w http.ResponseWriter, r *http.Request) {
+	version, ok := versionParam(w, r.PathValue("version"))
+	if !ok {
+		return
+	}
+	rev, err := a.store.Revision(version)
+	if err != nil {
+		a.historyError(w, err)
+		return
+	}
+	if v := r.URL.Query().Get("against"); v != "" {
+		against, ok := versionParam(w, v)
+		if !ok {
+			return
+		}
+		from, err := a.store.Snapshot(against)
+		if err != nil {
+			a.historyError(w, err)
+			return
+		}
+		to, err := a.store.Snapshot(version)
+		if err != nil {
+			a.historyError(w, err)
+			return
+		}
+		rev.Changes = store.Compare(from, to)
+	}
+	writeJSON(w, http.StatusOK, rev)
+}
+
+// Rollback restores a version from the history as a new version:
+//
+//	POST /policy/rollback {"version": 41}
+func (a *API) Rollback(w http.ResponseWriter, r *http.Request) {
+	var in RollbackRequest
+	if !readJSON(w, r, 1<<10, &in) {
+		return
+	}
+	current := a.store.Policy().Version
+	if in.Version == current {
+		writeError(w, http.StatusUnprocessableEntity, "version "+strconv.FormatInt(in.Version, 10)+" is the current version")
+		return
+	}
+	p, err := a.store.Rollback(in.Version)
+	if err != nil {
+		a.historyError(w, err)
+		return
+	}
+	rev, _ := a.store.Revision(p.Version)
+	a.log.InfoContext(r.Context(), "policy rolled back", "from_version", current, "to_version", in.Version, "version", p.Version)
+	a.audit(r, "policy.rollback", fmt.Sprintf("version %d", in.Version), fmt.Sprintf("from v%d", current), p.Version)
+	writeJSON(w, http.StatusOK, RollbackResponse{Version: p.Version, RestoredFrom: in.Version, Changes: rev.Changes})
+}
+
+// versionParam parses a policy version, answering 404 if it isn't one
+func versionParam(w http.ResponseWriter, v string) (int64, bool) {
+	version, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || version <= 0 {
+		writeError(w, http.StatusNotFound, store.ErrVersionNotFound.Error())
+		return 0, false
+	}
+	return version, true
+}
+
+// historyError answers a failed history lookup or rollback
+func (a *API) historyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrVersionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	a.log.Error("history error", "error", err)
+	writeError(w, http.StatusInternalServerError, "failed to read policy history")
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// Hit limits: entries per report, and entries tracked in all
+const (
+	maxHitsPerReport = 1000
+	maxTrackedHits   = 100000
+)
+
+// Hit types, naming the list of the policy an entry is in
+const (
+	HitDomain   = "domain"   // blocked, an entry of blocked
+	HitExact    = "exact"    // blocked, an entry of exact
+	HitWildcard = "wildcard" // blocked, an entry of wildcards
+	HitRegex    = "regex"    // blocked, an entry of regexes
+	HitCategory = "category" // blocked, a domain of a block category
+	HitAllow    = "allow"    // allowed, a domain of an allow category
+	HitTrusted  = "trusted"  // a domain of a trusted category, allowed or blocked by the device's posture
+)
+
+// Hit is how often an entry of the policy matched traffic at the proxies
+type Hit struct {
+	Type        string    `json:"type"`
+	Entry       string    `json:"entry"` // the domain or pattern that matched
+	Count       int64     `json:"count"`
+	LastMatched time.Time `json:"last_matched"`
+}
+
+// HitsReport is the body of POST /policy/hits
+type HitsReport struct {
+	Hits []Hit `json:"hits"`
+}
+
+// hitTracker keeps the hits the proxies report on the policy's entries, in
+// memory: they are statistics, not policy, and start again when the policy
+// engine restarts. Past maxTrackedHits entries, the one reported least
+// recently makes way for a new one.
+type hitTracker struct {
+	mu    sync.Mutex
+	hits  map[string]*list.Element // of Hit, by hitKey
+	order *list.List               // most recently reported first
+	// known holds the hit keys of the entries of the policy at version
+	known   map[string]bool
+	version int64
+}
+
+func hitKey(typ, entry string) string { return typ + " " + entry }
+
+// sync makes the entries of p the ones hits are kept for, dropping the
+// hits of entries p no longer has
+func (t *hitTracker) sync(p store.Policy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.known != nil && t.version == p.Version {
+		return
+	}
+	t.known = make(map[string]bool)
+	eachEntry(p, time.Time{}, func(e Entry, hitType string) {
+		t.known[hitKey(hitType, e.Entry)] = true
+	})
+	t.version = p.Version
+	for key, el := range t.hits {
+		if !t.known[key] {
+			t.order.Remove(el)
+			delete(t.hits, key)
+		}
+	}
+}
+
+// add folds a reported hit into the tracked ones, reporting false if its
+// entry isn't in the policy last synced
+func (t *hitTracker) add(h Hit) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := hitKey(h.Type, h.Entry)
+	if !t.known[key] {
+		return false
+	}
+	if t.hits == nil {
+		t.hits = make(map[string]*list.Element)
+		t.order = list.New()
+	}
+	if el, ok := t.hits[key]; ok {
+		old := el.Value.(Hit)
+		if h.Count > math.MaxInt64-old.Count {
+			h.Count = math.MaxInt64
+		} else {
+			h.Count += old.Count
+		}
+		if old.LastMatched.After(h.LastMatched) {
+			h.LastMatched = old.LastMatched
+		}
+		el.Value = h
+		t.order.MoveToFront(el)
+		return true
+	}
+	if len(t.hits) >= maxTrackedHits {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		old := oldest.Value.(Hit)
+		delete(t.hits, hitKey(old.Type, old.Entry))
+	}
+	t.hits[key] = t.order.PushFront(h)
+	return true
+}
+
+// get returns the hits of an entry
+func (t *hitTracker) get(typ, entry string) (Hit, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	el, ok := t.hits[hitKey(typ, entry)]
+	if !ok {
+		return Hit{}, false
+	}
+	return el.Value.(Hit), true
+}
+
+// ReportHits records the entries that matched traffic at a proxy since its
+// last report:
+//
+//	POST /policy/hits {"hits": [{"type": "domain", "entry": "facebook.com", "count": 12, "last_matched": "2026-06-01T09:00:00Z"}]}
+//
+// Hits are statistics for people, so the hits of entries the policy doesn't
+// have, e.g. since removed, are dropped rather than failing the report.
+func (a *API) ReportHits(w http.ResponseWriter, r *http.Request) {
+	var in HitsReport
+	if !readJSON(w, r, 1<<20, &in) {
+		return
+	}
+	if len(in.Hits) > maxHitsPerReport {
+		writeError(w, http.StatusRequestEntityTooLarge, "too many hits in one report")
+		return
+	}
+	now := a.now().UTC()
+	a.hits.sync(a.store.Policy())
+	dropped := 0
+	for _, h := range in.Hits {
+		switch h.Type {
+		case HitDomain, HitExact, HitWildcard, HitRegex, HitCategory, HitAllow, HitTrusted:
+		default:
+			writeError(w, http.StatusUnprocessableEntity, "unknown hit type "+h.Type)
+			return
+		}
+		if h.Entry == "" || len(h.Entry) > 253 || h.Count <= 0 {
+			writeError(w, http.StatusUnprocessableEntity, "each hit needs an entry and a positive count")
+			return
+		}
+		if h.LastMatched.IsZero() || h.LastMatched.After(now) {
+			h.LastMatched = now
+		}
+		if !a.hits.add(h) {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		a.log.DebugContext(r.Context(), "dropped hits on entries not in the policy", "dropped", dropped, "remote_addr", r.RemoteAddr)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
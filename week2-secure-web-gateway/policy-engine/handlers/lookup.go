@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/importer"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// LookupResponse answers GET /lookup: what the proxy does with a domain,
+// and the rule, source or category that decides it
+type LookupResponse struct {
+	store.Verdict
+	Group   string    `json:"group,omitempty"`
+	At      time.Time `json:"at"`
+	Version int64     `json:"version"`
+	// Rule or Source is the entry that decided, in full, if it is one.
+	// Feed names the threat feed the source imports, if it is one.
+	Rule   *store.Rule    `json:"rule,omitempty"`
+	Source *SourceSummary `json:"source,omitempty"`
+	Feed   string         `json:"feed,omitempty"`
+	// Matches is everything that matches, in the order the proxy checks
+	// them. The first decides; if it went, the next would.
+	Matches []store.Verdict `json:"matches"`
+}
+
+// Lookup says whether the proxy blocks a domain and why, to answer a user
+// who complains about a block:
+//
+//	GET /lookup?domain=www.tiktok.com&device=lab-pc-07
+//
+// domain may also be a URL. ?group=, ?device= and ?at= work as they do
+// for GET /policy.
+func (a *API) Lookup(w http.ResponseWriter, r *http.Request) {
+	p := a.store.Policy()
+	group, at, ok := a.policyScope(w, r, p)
+	if !ok {
+		return
+	}
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		writeError(w, http.StatusBadRequest, "domain is required")
+		return
+	}
+	host, err := testHost(domain)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := LookupResponse{Verdict: p.Match(host, at, group), Group: group, At: at, Version: p.Version, Matches: p.Matches(host, at, group)}
+	if resp.Matches == nil {
+		resp.Matches = []store.Verdict{}
+	}
+	switch resp.Match {
+	case store.MatchRule:
+		for _, rule := range p.Rules {
+			if rule.ID == resp.RuleID {
+				resp.Rule = &rule
+				break
+			}
+		}
+	case store.MatchSource:
+		if s, ok := p.Source(resp.Name); ok {
+			summary := summarize(s, a.now())
+			resp.Source = &summary
+			resp.Feed = feedOf(s)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// feedOf returns the name of the threat feed a source imports, or ""
+func feedOf(s store.Source) string {
+	for _, f := range importer.Feeds {
+		if s.URL != "" && f.URL == s.URL {
+			return f.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nisatyap/shared/ratelimit"
+)
+
+// limit answers 429 with Retry-After when a client calls the endpoints
+// that need a role faster than Options.RateLimit allows. It runs before
+// authentication, so that tokens can't be guessed at speed either.
+func (a *API) limit(next http.HandlerFunc) http.HandlerFunc {
+	if a.opts.RateLimit == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, replayed := r.Context().Value(approvalKey{}).(Approval); replayed {
+			next(w, r) // charged when it was requested
+			return
+		}
+		key := ratelimit.ClientIP(r)
+		result, err := a.opts.RateLimit.Allow(r.Context(), key)
+		if err != nil {
+			a.log.WarnContext(r.Context(), "rate limit unavailable, allowing request", "key", key, "error", err)
+		}
+		if !result.Allowed {
+			if result.First {
+				a.log.WarnContext(r.Context(), "rate limiting API requests", "key", key, "retry_after", result.RetryAfter.Round(time.Millisecond))
+			}
+			ratelimit.SetRetryAfter(w, result)
+			writeError(w, http.StatusTooManyRequests, "too many requests, slow down")
+			return
+		}
+		next(w, r)
+	}
+}
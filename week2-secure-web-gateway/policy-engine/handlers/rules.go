@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// maxRuleBytes caps a rule body
+const maxRuleBytes = 64 << 10
+
+// RuleInput is the body of POST /rules and PUT /rules/{id}
+type RuleInput struct {
+	Type           string          `json:"type"` // exact, suffix (default), wildcard or regex
+	Domain         string          `json:"domain"`
+	Category       string          `json:"category"`
+	Groups         []string        `json:"groups"`          // empty applies the rule to everyone
+	EffectiveFrom  *time.Time      `json:"effective_from"`  // RFC 3339
+	EffectiveUntil *time.Time      `json:"effective_until"` // RFC 3339
+	Schedule       *store.Schedule `json:"schedule"`
+}
+
+// RuleResponse answers the rule endpoints that change a rule
+type RuleResponse struct {
+	Rule    store.Rule `json:"rule"`
+	Version int64      `json:"version"` // policy version the change produced
+}
+
+// ListRules lists the rules, optionally only those of ?type=, ?category=,
+// ?group= or ?state=: active, idle (outside its schedule), scheduled (not
+// in effect yet) or expired.
+func (a *API) ListRules(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	typ := q.Get("type")
+	if typ == store.TypeDomain {
+		typ = store.TypeSuffix
+	}
+	p := a.store.Policy()
+	now := a.now()
+	rules := []store.Rule{}
+	for _, rule := range p.Rules {
+		if (typ == "" || rule.Type == typ) &&
+			(q.Get("category") == "" || rule.Category == q.Get("category")) &&
+			(q.Get("group") == "" || slices.Contains(rule.Groups, q.Get("group"))) &&
+			(q.Get("state") == "" || rule.State(now) == q.Get("state")) {
+			rules = append(rules, rule)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"rules": rules, "total": len(rules), "version": p.Version})
+}
+
+// GetRule returns one rule
+func (a *API) GetRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := ruleID(w, r)
+	if !ok {
+		return
+	}
+	rule, err := a.store.GetRule(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// CreateRule adds a block rule, which takes effect on the next GET /policy:
+//
+//	POST /rules {"type": "wildcard", "domain": "*.example.com", "category": "ads"}
+//	POST /rules {"domain": "youtube.com", "schedule": {"days": ["mon", "tue", "wed", "thu", "fri"], "start": "09:00", "end": "17:00", "timezone": "Europe/London"}}
+//	POST /rules {"domain": "netflix.com", "category": "streaming", "effective_from": "2026-06-08T00:00:00+01:00", "effective_until": "2026-06-13T00:00:00+01:00"}
+func (a *API) CreateRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := readRule(w, r)
+	if !ok {
+		return
+	}
+	rule, p, err := a.store.CreateRule(rule)
+	if !a.ruleSaved(w, "create", rule, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "rule created", "rule", rule.ID, "type", rule.Type, "domain", rule.Domain, "version", p.Version)
+	a.audit(r, "rule.create", fmt.Sprintf("rule %d", rule.ID), describeRule(rule), p.Version)
+	writeJSON(w, http.StatusCreated, RuleResponse{Rule: rule, Version: p.Version})
+}
+
+// UpdateRule replaces a rule with the body, which takes the same fields as
+// POST /rules
+func (a *API) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := ruleID(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := readRule(w, r)
+	if !ok {
+		return
+	}
+	rule.ID = id
+	rule, p, err := a.store.UpdateRule(rule)
+	if !a.ruleSaved(w, "update", rule, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "rule updated", "rule", rule.ID, "type", rule.Type, "domain", rule.Domain, "version", p.Version)
+	a.audit(r, "rule.update", fmt.Sprintf("rule %d", rule.ID), describeRule(rule), p.Version)
+	writeJSON(w, http.StatusOK, RuleResponse{Rule: rule, Version: p.Version})
+}
+
+// DeleteRule removes a rule
+func (a *API) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := ruleID(w, r)
+	if !ok {
+		return
+	}
+	old, _ := a.store.GetRule(id)
+	p, err := a.store.DeleteRule(id)
+	if !a.ruleSaved(w, "delete", store.Rule{ID: id}, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "rule deleted", "rule", id, "version", p.Version)
+	a.audit(r, "rule.delete", fmt.Sprintf("rule %d", id), describeRule(old), p.Version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readRule decodes and validates a rule body, answering 400 or 422 if it
+// is not a valid rule
+func readRule(w http.ResponseWriter, r *http.Request) (store.Rule, bool) {
+	var in RuleInput
+	if !readJSON(w, r, maxRuleBytes, &in) {
+		return store.Rule{}, false
+	}
+	rule := store.Rule{
+		Type: in.Type, Domain: in.Domain, Category: in.Category, Groups: in.Groups,
+		EffectiveFrom: in.EffectiveFrom, EffectiveUntil: in.EffectiveUntil, Schedule: in.Schedule,
+	}
+	if err := rule.Validate(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return store.Rule{}, false
+	}
+	return rule, true
+}
+
+// ruleID parses the {id} path value, answering 404 if it isn't one
+func ruleID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusNotFound, store.ErrNotFound.Error())
+		return 0, false
+	}
+	return id, true
+}
+
+// ruleSaved answers a failed rule change and reports whether it succeeded
+func (a *API) ruleSaved(w http.ResponseWriter, action string, rule store.Rule, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrGroupNotFound):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		a.log.Error("failed to save rule", "action", action, "rule", rule.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/importer"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// maxSourceBytes caps a source body
+const maxSourceBytes = 64 << 10
+
+// SourceInput is the body of POST /sources. Feed names a threat feed
+// connector, which fills in the URL, format, category, refresh and expiry;
+// the name, category, refresh and expiry can still be given.
+type SourceInput struct {
+	Name     string         `json:"name"`
+	Feed     string         `json:"feed"`
+	URL      string         `json:"url"`
+	Path     string         `json:"path"`
+	Format   string         `json:"format"` // hosts, adblock, domains or urls
+	Category string         `json:"category"`
+	Refresh  store.Duration `json:"refresh"` // e.g. "6h"; default 24h
+	Expire   store.Duration `json:"expire"`  // e.g. "168h"; default never
+}
+
+// SourceSummary is a source with the number of domains it blocks in place
+// of the domains themselves and when each was last seen, which
+// GET /sources/{name} returns
+type SourceSummary struct {
+	store.Source
+	Domains int    `json:"domains"`
+	Health  string `json:"health"` // ok, failing, stale or pending
+}
+
+// SourceResponse answers the source endpoints that refresh a source
+type SourceResponse struct {
+	Source  SourceSummary `json:"source"`
+	Version int64         `json:"version"`
+	Error   string        `json:"error,omitempty"` // why the refresh failed
+}
+
+func summarize(s store.Source, now time.Time) SourceSummary {
+	health := s.Health(now)
+	s.LastSeen = nil
+	return SourceSummary{Source: s, Domains: len(s.Domains), Health: health}
+}
+
+// SourceHealth is how one source's refreshes are going
+type SourceHealth struct {
+	Name       string    `json:"name"`
+	Category   string    `json:"category,omitempty"`
+	Health     string    `json:"health"`
+	Domains    int       `json:"domains"`
+	Skipped    int       `json:"skipped"` // lines the last successful refresh could not parse
+	CheckedAt  time.Time `json:"checked_at"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	Failures   int       `json:"failures"`
+	LastError  string    `json:"last_error,omitempty"`
+	StaleAfter string    `json:"stale_after"`
+}
+
+// SourceHealth reports each source's last successful refresh, domain
+// count and errors. status is "stale" if any source is stale, "degraded"
+// if any is failing, and "ok" otherwise.
+func (a *API) SourceHealth(w http.ResponseWriter, r *http.Request) {
+	now := a.now()
+	status := "ok"
+	sources := a.store.Policy().Sources
+	out := make([]SourceHealth, len(sources))
+	for i, s := range sources {
+		h := SourceHealth{
+			Name:       s.Name,
+			Category:   s.Category,
+			Health:     s.Health(now),
+			Domains:    len(s.Domains),
+			CheckedAt:  s.CheckedAt,
+			FetchedAt:  s.FetchedAt,
+			Failures:   s.Failures,
+			LastError:  s.LastError,
+			StaleAfter: s.StaleAfter().String(),
+		}
+		if s.LastDiff != nil {
+			h.Skipped = s.LastDiff.Skipped
+		}
+		switch {
+		case h.Health == store.HealthStale:
+			status = store.HealthStale
+		case h.Health == store.HealthFailing && status == "ok":
+			status = "degraded"
+		}
+		out[i] = h
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": status, "sources": out, "total": len(out)})
+}
+
+// ListSources lists the imported blocklists and how their last refreshes
+// went
+func (a *API) ListSources(w http.ResponseWriter, r *http.Request) {
+	p := a.store.Policy()
+	out := make([]SourceSummary, len(p.Sources))
+	for i, s := range p.Sources {
+		out[i] = summarize(s, a.now())
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sources": out, "total": len(out), "version": p.Version})
+}
+
+// GetSource returns one source with its domains
+func (a *API) GetSource(w http.ResponseWriter, r *http.Request) {
+	s, ok := a.store.Policy().Source(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, store.ErrSourceNotFound.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// CreateSource adds a blocklist and imports it straight away:
+//
+//	POST /sources {"name": "stevenblack", "url": "https://raw.githubusercontent.com/StevenBlack/hosts/master/hosts", "format": "hosts", "refresh": "24h"}
+//	POST /sources {"feed": "urlhaus"}
+//
+// The source is created even if the first import fails; the response
+// carries the error and the import is retried on the source's schedule.
+func (a *API) CreateSource(w http.ResponseWriter, r *http.Request) {
+	var in SourceInput
+	if !readJSON(w, r, maxSourceBytes, &in) {
+		return
+	}
+	s, ok := sourceFromInput(w, in)
+	if !ok {
+		return
+	}
+	if err := s.Validate(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	s, p, err := a.store.CreateSource(s)
+	if !a.sourceSaved(w, "create", s.Name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "source created", "source", s.Name, "format", s.Format, "location", s.URL+s.Path,
+		"category", s.Category, "expire", time.Duration(s.Expire), "version", p.Version)
+	a.audit(r, "source.create", "source "+s.Name, fmt.Sprintf("%s from %s%s", s.Format, s.URL, s.Path), p.Version)
+	a.refresh(w, r, http.StatusCreated, s.Name)
+}
+
+// sourceFromInput returns the source a body describes, answering 422 for
+// an unknown feed or a feed given with its own location
+func sourceFromInput(w http.ResponseWriter, in SourceInput) (store.Source, bool) {
+	if in.Feed == "" {
+		return store.Source{Name: in.Name, URL: in.URL, Path: in.Path, Format: in.Format,
+			Category: in.Category, Refresh: in.Refresh, Expire: in.Expire}, true
+	}
+	feed, ok := importer.LookupFeed(in.Feed)
+	if !ok {
+		writeError(w, http.StatusUnprocessableEntity, "unknown feed "+in.Feed+"; GET /feeds lists them")
+		return store.Source{}, false
+	}
+	if in.URL != "" || in.Path != "" || in.Format != "" {
+		writeError(w, http.StatusUnprocessableEntity, "url, path and format come from the feed")
+		return store.Source{}, false
+	}
+	s := feed.Source()
+	if in.Name != "" {
+		s.Name = in.Name
+	}
+	if in.Category != "" {
+		s.Category = in.Category
+	}
+	if in.Refresh != 0 {
+		s.Refresh = in.Refresh
+	}
+	if in.Expire != 0 {
+		s.Expire = in.Expire
+	}
+	return s, true
+}
+
+// ListFeeds lists the threat feeds POST /sources has connectors for
+func (a *API) ListFeeds(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"feeds": importer.Feeds, "total": len(importer.Feeds)})
+}
+
+// RefreshSource imports a source again now rather than on its schedule.
+// The response's last_diff reports what changed.
+func (a *API) RefreshSource(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.store.Policy().Source(r.PathValue("name")); !ok {
+		writeError(w, http.StatusNotFound, store.ErrSourceNotFound.Error())
+		return
+	}
+	a.refresh(w, r, http.StatusOK, r.PathValue("name"))
+}
+
+// refresh imports the source called name, answering code if the import
+// succeeds and 502 if fetching or parsing the list fails
+func (a *API) refresh(w http.ResponseWriter, r *http.Request, code int, name string) {
+	s, p, err := a.importer.Refresh(r.Context(), name)
+	var fetchErr *importer.FetchError
+	if err != nil && !errors.As(err, &fetchErr) {
+		a.sourceSaved(w, "refresh", name, err)
+		return
+	}
+	resp := SourceResponse{Source: summarize(s, a.now()), Version: p.Version}
+	if fetchErr != nil {
+		resp.Error = fetchErr.Error()
+		if code == http.StatusOK {
+			code = http.StatusBadGateway
+		}
+	}
+	writeJSON(w, code, resp)
+}
+
+// DeleteSource removes a source and unblocks its domains
+func (a *API) DeleteSource(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, err := a.store.DeleteSource(name)
+	if !a.sourceSaved(w, "delete", name, err) {
+		return
+	}
+	a.log.InfoContext(r.Context(), "source deleted", "source", name, "version", p.Version)
+	a.audit(r, "source.delete", "source "+name, "", p.Version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sourceSaved answers a failed source change and reports whether it
+// succeeded
+func (a *API) sourceSaved(w http.ResponseWriter, action, name string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrSourceNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrSourceExists):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		a.log.Error("failed to save source", "action", action, "source", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save policy")
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Stream limits: proxies subscribed at once, how often a quiet stream
+// sends a comment so proxies and middleboxes know it is alive, and how
+// long one event may take to write
+const (
+	maxStreams         = 1000
+	streamKeepalive    = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// StreamEvent is the data of a "policy" event on GET /policy/stream
+type StreamEvent struct {
+	Version int64 `json:"version"`
+}
+
+// streams counts the subscribed proxies and ends their streams when the
+// policy engine shuts down
+type streams struct {
+	mu    sync.Mutex
+	count int
+	done  chan struct{}
+}
+
+// join admits a subscriber, reporting false if there are too many or the
+// policy engine is shutting down
+func (s *streams) join() (<-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+	select {
+	case <-s.done:
+		return nil, false
+	default:
+	}
+	if s.count >= maxStreams {
+		return nil, false
+	}
+	s.count++
+	return s.done, true
+}
+
+func (s *streams) leave() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count--
+}
+
+func (s *streams) subscribed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// CloseStreams ends the policy streams, which would otherwise keep a
+// graceful shutdown waiting for them; register it with the server's
+// RegisterOnShutdown. Proxies reconnect to another instance or when this
+// one is back.
+func (a *API) CloseStreams() {
+	a.streams.mu.Lock()
+	defer a.streams.mu.Unlock()
+	if a.streams.done == nil {
+		a.streams.done = make(chan struct{})
+	}
+	select {
+	case <-a.streams.done:
+	default:
+		close(a.streams.done)
+	}
+}
+
+// PolicyStream pushes the policy version to proxies as server-sent events,
+// so they update as soon as the policy changes instead of at their next
+// poll. Each subscriber gets the current version when it connects and
+// every version after; a proxy that is behind fetches the changes from
+// GET /policy/changes as it does when polling. Versions made in quick
+// succession may arrive as one event for the latest.
+//
+//	event: policy
+//	id: 43
+//	data: {"version":43}
+//
+// Scheduled rules come into effect without a new version, so proxies keep
+// polling as well, less often.
+func (a *API) PolicyStream(w http.ResponseWriter, r *http.Request) {
+	done, ok := a.streams.join()
+	if !ok {
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, "too many policy subscribers")
+		return
+	}
+	defer a.streams.leave()
+
+	rc := http.NewResponseController(w)
+	send := func(msg string) bool {
+		// Streams outlive the server's write timeout; each write gets its own
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprint(w, msg); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise buffer the events
+	w.WriteHeader(http.StatusOK)
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+	sent := int64(-1)
+	for {
+		version, changed := a.store.Watch()
+		if version != sent {
+			data, _ := json.Marshal(StreamEvent{Version: version})
+			if !send(fmt.Sprintf("event: policy\nid: %d\ndata: %s\n\n", version, data)) {
+				return
+			}
+			sent = version
+		}
+		select {
+		case <-changed:
+		case <-keepalive.C:
+			if !send(": keepalive\n\n") {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-done:
+			return
+		}
+	}
+}
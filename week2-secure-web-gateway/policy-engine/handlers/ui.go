@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiServer serves the admin UI's static files from under /ui/
+var uiServer = func() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServerFS(files))
+}()
+
+// UI serves the admin UI, a single page that browses, searches, adds and
+// tests rules with the admin API. The page itself holds no policy, so it
+// is served without a token; it asks for one and sends it with its API
+// calls.
+func (a *API) UI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	uiServer.ServeHTTP(w, r)
+}
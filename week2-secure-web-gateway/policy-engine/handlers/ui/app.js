@@ -0,0 +1,147 @@
+// Admin UI for the policy engine. Everything goes through the admin API
+// with the token from the header field, which is kept for the session.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+const token = $("token");
+token.value = sessionStorage.getItem("token") || "";
+token.addEventListener("change", () => {
+    sessionStorage.setItem("token", token.value);
+    refresh();
+});
+
+async function api(method, path, body) {
+    const headers = {};
+    if (token.value) headers["Authorization"] = "Bearer " + token.value;
+    if (body !== undefined) headers["Content-Type"] = "application/json";
+    const resp = await fetch(path, {method, headers, body: body === undefined ? undefined : JSON.stringify(body)});
+    const data = resp.status === 204 ? null : await resp.json();
+    if (!resp.ok) throw new Error((data && data.error) || resp.statusText);
+    return data;
+}
+
+function status(message, isError) {
+    $("status").textContent = message;
+    $("status").className = isError ? "error" : "muted";
+}
+
+function cell(row, text, className) {
+    const td = row.insertCell();
+    td.textContent = text === undefined || text === null ? "" : text;
+    if (className) td.className = className;
+    return td;
+}
+
+async function search() {
+    try {
+        const data = await api("GET", "/entries?q=" + encodeURIComponent($("search").value) + "&limit=200");
+        const body = $("entries");
+        body.replaceChildren();
+        for (const e of data.entries) {
+            const row = body.insertRow();
+            cell(row, e.entry, "entry");
+            cell(row, e.type);
+            cell(row, e.origin === "rule" ? "rule " + e.rule_id : e.origin + " " + e.name);
+            cell(row, e.category);
+            cell(row, (e.groups || []).join(", ") || "everyone");
+            cell(row, e.state);
+            cell(row, e.hits);
+            cell(row, e.last_matched ? new Date(e.last_matched).toLocaleString() : "never", e.last_matched ? "" : "muted");
+            const actions = row.insertCell();
+            if (e.origin === "rule") {
+                const del = document.createElement("button");
+                del.textContent = "Delete";
+                del.addEventListener("click", () => deleteRule(e.rule_id, e.entry));
+                actions.appendChild(del);
+            }
+        }
+        $("total").textContent = data.total > data.entries.length
+            ? `showing ${data.entries.length} of ${data.total}` : `${data.total} entries`;
+        $("version").textContent = "policy v" + data.version;
+    } catch (err) {
+        status(err.message, true);
+    }
+}
+
+async function deleteRule(id, entry) {
+    if (!confirm(`Delete rule ${id} (${entry})?`)) return;
+    try {
+        await api("DELETE", "/rules/" + id);
+        status(`Deleted rule ${id}`);
+        search();
+    } catch (err) {
+        status(err.message, true);
+    }
+}
+
+async function loadGroups() {
+    try {
+        const data = await api("GET", "/groups");
+        const select = $("test-group");
+        select.replaceChildren(new Option("Everyone", ""));
+        for (const g of data.groups) select.add(new Option(g.name, g.name));
+    } catch (err) {
+        status(err.message, true);
+    }
+}
+
+async function test() {
+    const host = $("test-host").value.trim();
+    if (!host) return;
+    try {
+        const group = $("test-group").value;
+        const data = await api("POST", "/policy/test" + (group ? "?group=" + encodeURIComponent(group) : ""), {urls: [host]});
+        const res = data.results[0];
+        $("verdict").replaceChildren();
+        if (res.error) {
+            $("verdict").textContent = res.error;
+            return;
+        }
+        const v = res.current;
+        const strong = document.createElement("span");
+        strong.textContent = v.blocked ? "BLOCKED" : "ALLOWED";
+        strong.className = v.blocked ? "blocked" : "allowed";
+        const rule = v.rule_id ? ` (rule ${v.rule_id})` : "";
+        $("verdict").append(strong, ` ${v.host}: ${v.reason}${rule} (policy v${data.version})`);
+    } catch (err) {
+        status(err.message, true);
+    }
+}
+
+$("add").addEventListener("submit", async (ev) => {
+    ev.preventDefault();
+    const rule = {
+        type: $("add-type").value,
+        domain: $("add-domain").value,
+        category: $("add-category").value,
+        groups: $("add-groups").value.split(",").map((g) => g.trim()).filter((g) => g),
+    };
+    if ($("add-from").value) rule.effective_from = new Date($("add-from").value).toISOString();
+    if ($("add-until").value) rule.effective_until = new Date($("add-until").value).toISOString();
+    try {
+        const data = await api("POST", "/rules", rule);
+        if (data.status === "pending") {
+            status(`Rule for ${rule.domain} is waiting for approval (change ${data.id})`);
+        } else {
+            status(`Added rule ${data.rule.id}: ${data.rule.domain} (policy v${data.version})`);
+        }
+        $("add").reset();
+        search();
+    } catch (err) {
+        status(err.message, true);
+    }
+});
+
+let timer;
+$("search").addEventListener("input", () => {
+    clearTimeout(timer);
+    timer = setTimeout(search, 250);
+});
+$("test").addEventListener("click", test);
+$("test-host").addEventListener("keydown", (ev) => { if (ev.key === "Enter") test(); });
+
+function refresh() {
+    search();
+    loadGroups();
+}
+refresh();
@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// defaultExpire is how long a threat feed's indicators stay blocked after
+// they drop off the feed
+const defaultExpire = store.Duration(7 * 24 * time.Hour)
+
+// Feed is a public threat-intelligence feed the importer has a connector
+// for: where to fetch it, how to parse it and what its indicators are
+type Feed struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	URL         string         `json:"url"`
+	Format      string         `json:"format"`
+	Category    string         `json:"category"`
+	Refresh     store.Duration `json:"refresh"`
+	Expire      store.Duration `json:"expire"`
+}
+
+// Feeds are the threat feeds with connectors, sorted by name. The refresh
+// intervals keep to what the feeds ask of their users.
+var Feeds = []Feed{
+	{
+		Name:        "openphish",
+		Description: "OpenPhish community feed of phishing URLs",
+		URL:         "https://openphish.com/feed.txt",
+		Format:      store.FormatURLs,
+		Category:    "phishing",
+		Refresh:     store.Duration(6 * time.Hour),
+		Expire:      defaultExpire,
+	},
+	{
+		Name:        "threatfox",
+		Description: "abuse.ch ThreatFox domains used by malware and botnet C2",
+		URL:         "https://threatfox.abuse.ch/downloads/hostfile/",
+		Format:      store.FormatHosts,
+		Category:    "malware",
+		Refresh:     store.Duration(time.Hour),
+		Expire:      defaultExpire,
+	},
+	{
+		Name:        "urlhaus",
+		Description: "abuse.ch URLhaus domains serving malware",
+		URL:         "https://urlhaus.abuse.ch/downloads/hostfile/",
+		Format:      store.FormatHosts,
+		Category:    "malware",
+		Refresh:     store.Duration(time.Hour),
+		Expire:      defaultExpire,
+	},
+}
+
+// LookupFeed returns the feed called name
+func LookupFeed(name string) (Feed, bool) {
+	for _, f := range Feeds {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Feed{}, false
+}
+
+// Source returns a source that imports the feed, named after it
+func (f Feed) Source() store.Source {
+	return store.Source{
+		Name:     f.Name,
+		URL:      f.URL,
+		Format:   f.Format,
+		Category: f.Category,
+		Refresh:  f.Refresh,
+		Expire:   f.Expire,
+	}
+}
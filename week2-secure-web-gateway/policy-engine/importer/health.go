@@ -0,0 +1,153 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// Alert is sent when a source goes stale: its list has not been refreshed
+// for long enough that the domains it blocks may be out of date
+type Alert struct {
+	Kind       string    `json:"kind"` // always "stale"
+	Source     string    `json:"source"`
+	Category   string    `json:"category,omitempty"`
+	URL        string    `json:"url,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Domains    int       `json:"domains"`
+	FetchedAt  time.Time `json:"fetched_at"` // zero if the source was never refreshed
+	Failures   int       `json:"failures"`
+	LastError  string    `json:"last_error,omitempty"`
+	StaleAfter string    `json:"stale_after"`
+	Message    string    `json:"message"`
+	Time       time.Time `json:"time"`
+}
+
+// Watcher alerts once when a source goes stale, logging the alert and
+// posting it to a webhook if one is set. A source that refreshes again is
+// re-armed.
+type Watcher struct {
+	store   *store.File
+	webhook string
+	client  *http.Client
+	now     func() time.Time
+	log     *slog.Logger
+
+	stale  map[string]bool
+	seeded bool
+}
+
+// NewWatcher creates a Watcher for the sources in s. webhook is an http(s)
+// URL the alerts are posted to as JSON, or empty to only log them to
+// logger.
+func NewWatcher(s *store.File, webhook string, logger *slog.Logger) *Watcher {
+	return &Watcher{
+		store:   s,
+		webhook: webhook,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+		log:     logger,
+		stale:   make(map[string]bool),
+	}
+}
+
+// Run checks the sources every interval until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check alerts for the sources that went stale since the previous check.
+// Sources already stale at the first check are logged but not posted, so
+// restarting the policy engine doesn't repeat alerts.
+func (w *Watcher) Check(ctx context.Context) []Alert {
+	now := w.now()
+	var alerts []Alert
+	current := make(map[string]bool)
+	for _, s := range w.store.Policy().Sources {
+		if s.Health(now) != store.HealthStale {
+			if w.stale[s.Name] {
+				w.log.InfoContext(ctx, "source is refreshing again", "source", s.Name)
+			}
+			continue
+		}
+		current[s.Name] = true
+		if w.stale[s.Name] {
+			continue
+		}
+		a := staleAlert(s, now)
+		w.log.WarnContext(ctx, "alert", "source", s.Name, "message", a.Message)
+		if !w.seeded {
+			continue
+		}
+		alerts = append(alerts, a)
+		if w.webhook != "" {
+			if err := w.post(ctx, a); err != nil {
+				w.log.ErrorContext(ctx, "failed to send stale alert", "source", s.Name, "error", err)
+			}
+		}
+	}
+	w.stale = current
+	w.seeded = true
+	return alerts
+}
+
+func staleAlert(s store.Source, now time.Time) Alert {
+	msg := fmt.Sprintf("source %s is stale: never refreshed successfully", s.Name)
+	if !s.FetchedAt.IsZero() {
+		msg = fmt.Sprintf("source %s is stale: last refreshed %s ago", s.Name, now.Sub(s.FetchedAt).Round(time.Minute))
+	}
+	if s.LastError != "" {
+		msg += fmt.Sprintf(", %d failures in a row, last: %s", s.Failures, s.LastError)
+	}
+	return Alert{
+		Kind:       store.HealthStale,
+		Source:     s.Name,
+		Category:   s.Category,
+		URL:        s.URL,
+		Path:       s.Path,
+		Domains:    len(s.Domains),
+		FetchedAt:  s.FetchedAt,
+		Failures:   s.Failures,
+		LastError:  s.LastError,
+		StaleAfter: s.StaleAfter().String(),
+		Message:    msg,
+		Time:       now,
+	}
+}
+
+// post sends an alert to the webhook
+func (w *Watcher) post(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
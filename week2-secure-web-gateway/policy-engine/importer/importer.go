@@ -0,0 +1,155 @@
+// Package importer keeps the policy's external blocklists up to date. It
+// fetches each source from its URL or file, parses it and stores the
+// domains, refreshing the sources on their schedules.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// FetchError is a refresh that failed because the source could not be
+// fetched or parsed, rather than because the policy could not be saved
+type FetchError struct {
+	Source string
+	Err    error
+}
+
+func (e *FetchError) Error() string { return e.Err.Error() }
+func (e *FetchError) Unwrap() error { return e.Err }
+
+// Importer refreshes the sources of a policy store
+type Importer struct {
+	store  *store.File
+	audit  *audit.Log
+	client *http.Client
+	now    func() time.Time
+	log    *slog.Logger
+}
+
+// New creates an Importer for the sources in s
+func New(s *store.File) *Importer {
+	return &Importer{store: s, client: &http.Client{Timeout: 30 * time.Second}, now: time.Now, log: slog.Default()}
+}
+
+// SetAudit records every refresh in l, as made by the actor the refresh's
+// context carries
+func (im *Importer) SetAudit(l *audit.Log) {
+	im.audit = l
+}
+
+// SetLogger logs refreshes to l instead of slog.Default()
+func (im *Importer) SetLogger(l *slog.Logger) {
+	im.log = l
+}
+
+// Refresh fetches and parses the source called name and stores its
+// domains. A failed fetch keeps the domains the source had, records the
+// error on the source and returns it as a *FetchError.
+func (im *Importer) Refresh(ctx context.Context, name string) (store.Source, store.Policy, error) {
+	src, ok := im.store.Policy().Source(name)
+	if !ok {
+		return store.Source{}, store.Policy{}, store.ErrSourceNotFound
+	}
+	domains, skipped, err := im.fetch(ctx, src)
+	if err != nil {
+		im.log.ErrorContext(ctx, "failed to refresh source", "source", name, "error", err)
+	}
+	s, p, saveErr := im.store.RecordRefresh(name, domains, skipped, err)
+	if saveErr != nil {
+		return s, p, saveErr
+	}
+	if err != nil {
+		im.record(ctx, s, p, "failed: "+err.Error())
+		return s, p, &FetchError{Source: name, Err: err}
+	}
+	d := s.LastDiff
+	im.record(ctx, s, p, fmt.Sprintf("%d domains, +%d -%d, %d lines skipped", len(s.Domains), d.Added, d.Removed, d.Skipped))
+	im.log.InfoContext(ctx, "source refreshed", "source", name, "domains", len(s.Domains), "added", d.Added, "removed", d.Removed,
+		"skipped", d.Skipped, "added_sample", d.AddedSample, "removed_sample", d.RemovedSample, "version", p.Version)
+	return s, p, nil
+}
+
+// record adds a refresh of s to the audit log
+func (im *Importer) record(ctx context.Context, s store.Source, p store.Policy, detail string) {
+	actor, address := audit.ActorFrom(ctx)
+	_, err := im.audit.Record(ctx, audit.Event{Actor: actor, Address: address, Action: "source.refresh",
+		Object: "source " + s.Name, Detail: detail, Version: p.Version})
+	if err != nil {
+		im.log.ErrorContext(ctx, "failed to audit refresh", "source", s.Name, "error", err)
+	}
+}
+
+// fetch reads and parses a source. An empty list is an error rather than
+// a reason to unblock everything the source blocked.
+func (im *Importer) fetch(ctx context.Context, src store.Source) ([]string, int, error) {
+	body, err := im.open(ctx, src)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer body.Close()
+	domains, skipped, err := Parse(body, src.Format)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(domains) == 0 {
+		return nil, 0, fmt.Errorf("no %s entries found (%d lines skipped)", src.Format, skipped)
+	}
+	return domains, skipped, nil
+}
+
+// open returns the source's contents from its URL or file
+func (im *Importer) open(ctx context.Context, src store.Source) (io.ReadCloser, error) {
+	if src.Path != "" {
+		return os.Open(src.Path)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := im.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %s", src.URL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// RefreshDue refreshes the sources whose refresh interval has passed, one
+// at a time
+func (im *Importer) RefreshDue(ctx context.Context) {
+	for _, src := range im.store.Policy().Sources {
+		if ctx.Err() != nil {
+			return
+		}
+		if src.Due(im.now()) {
+			// Failures are logged and recorded on the source
+			im.Refresh(ctx, src.Name)
+		}
+	}
+}
+
+// Run refreshes due sources every interval until ctx is cancelled
+func (im *Importer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		im.RefreshDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		format  string
+		list    string
+		want    []string
+		skipped int
+	}{
+		{store.FormatHosts, `# StevenBlack-style hosts file
+127.0.0.1 localhost
+::1 ip6-localhost ip6-loopback
+0.0.0.0 0.0.0.0
+0.0.0.0 Ads.Example.com tracker.example.com # two on one line
+127.0.0.1	ads.example.com
+ads.example.net
+0.0.0.0 bad_name.example
+`, []string{"ads.example.com", "tracker.example.com"}, 2},
+		{store.FormatAdblock, `[Adblock Plus 2.0]
+! Title: test list
+||ads.example.com^
+||Tracker.example.com^
+||ads.example.com/banner^
+||cdn.example.com^$third-party
+@@||good.example.com^
+example.com##.ad
+`, []string{"ads.example.com", "tracker.example.com"}, 4},
+		{store.FormatDomains, `# Pi-hole list
+ads.example.com
+tracker.example.com # inline comment
+
+0.0.0.0 ads.example.net
+*.example.org
+`, []string{"ads.example.com", "tracker.example.com"}, 2},
+		{store.FormatURLs, `https://Login.example.com/verify.php?id=1
+http://login.example.com:8080/other
+pay.example.net/update # no scheme
+http://[::1
+http://bad_host.example/
+`, []string{"login.example.com", "pay.example.net"}, 2},
+	} {
+		got, skipped, err := Parse(strings.NewReader(c.list), c.format)
+		if err != nil || !reflect.DeepEqual(got, c.want) || skipped != c.skipped {
+			t.Errorf("Parse(%s) = %v, %d skipped, %v; want %v, %d skipped", c.format, got, skipped, err, c.want, c.skipped)
+		}
+	}
+	if _, _, err := Parse(strings.NewReader(""), "csv"); err == nil {
+		t.Error("parsed an unknown format")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	list := "0.0.0.0 a.example\n0.0.0.0 b.example\n"
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(list))
+	}))
+	defer srv.Close()
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := store.Source{Name: "hosts", URL: srv.URL, Format: store.FormatHosts, Refresh: store.Duration(time.Hour)}
+	if err := src.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.CreateSource(src); err != nil {
+		t.Fatal(err)
+	}
+	im := New(s)
+	ctx := context.Background()
+
+	got, p, err := im.Refresh(ctx, "hosts")
+	if err != nil || got.LastDiff.Added != 2 || p.Version != 3 {
+		t.Fatalf("first refresh = %+v in v%d, %v", got, p.Version, err)
+	}
+	if b := p.Blocked(time.Now(), ""); strings.Join(b.Domains, ",") != "a.example,b.example" {
+		t.Errorf("blocked after import = %v", b.Domains)
+	}
+
+	// Unchanged lists leave the version alone
+	if _, p, _ := im.Refresh(ctx, "hosts"); p.Version != 3 {
+		t.Errorf("unchanged refresh bumped the version to %d", p.Version)
+	}
+
+	list = "0.0.0.0 b.example\n0.0.0.0 c.example\n"
+	got, p, err = im.Refresh(ctx, "hosts")
+	if d := got.LastDiff; err != nil || d.Added != 1 || d.Removed != 1 || d.AddedSample[0] != "c.example" || d.RemovedSample[0] != "a.example" || p.Version != 4 {
+		t.Errorf("changed refresh = %+v in v%d, %v", got.LastDiff, p.Version, err)
+	}
+
+	// Failures keep the domains and are recorded; so is an empty list
+	for _, fail := range []func(){
+		func() { status = http.StatusNotFound },
+		func() { status, list = http.StatusOK, "# nothing here\n" },
+	} {
+		fail()
+		got, _, err = im.Refresh(ctx, "hosts")
+		var fetchErr *FetchError
+		if !errors.As(err, &fetchErr) || got.LastError == "" || len(got.Domains) != 2 {
+			t.Errorf("failed refresh = %+v, %v", got, err)
+		}
+	}
+
+	if _, _, err := im.Refresh(ctx, "missing"); !errors.Is(err, store.ErrSourceNotFound) {
+		t.Errorf("refreshing a missing source: %v", err)
+	}
+}
+
+func TestRefreshDue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte("a.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := store.Source{Name: "local", Path: path, Format: store.FormatDomains}
+	if err := src.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.CreateSource(src); err != nil {
+		t.Fatal(err)
+	}
+	im := New(s)
+	im.RefreshDue(context.Background())
+	got, _ := s.Policy().Source("local")
+	if len(got.Domains) != 1 || got.Due(time.Now()) || !got.Due(time.Now().Add(store.DefaultRefresh)) {
+		t.Errorf("source after RefreshDue = %+v", got)
+	}
+}
+
+func TestRefreshExpires(t *testing.T) {
+	list := "http://a.example/x\nhttp://b.example/y\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(list))
+	}))
+	defer srv.Close()
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, ok := LookupFeed("openphish")
+	if !ok {
+		t.Fatal("no openphish feed")
+	}
+	src := feed.Source()
+	src.URL = srv.URL
+	if err := src.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.CreateSource(src); err != nil {
+		t.Fatal(err)
+	}
+	im := New(s)
+	ctx := context.Background()
+	if _, _, err := im.Refresh(ctx, "openphish"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Domains that drop off the feed stay blocked until they expire
+	list = "http://b.example/z\n"
+	got, _, err := im.Refresh(ctx, "openphish")
+	if err != nil || strings.Join(got.Domains, ",") != "a.example,b.example" || got.Category != "phishing" {
+		t.Fatalf("refresh after a domain dropped off = %v (%s), %v", got.Domains, got.Category, err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	var posted []Alert
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		posted = append(posted, a)
+	}))
+	defer hook.Close()
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte("a.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"gone", "local"} {
+		src := store.Source{Name: name, Path: path, Format: store.FormatDomains, Refresh: store.Duration(time.Hour)}
+		if err := src.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.CreateSource(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	im := New(s)
+	ctx := context.Background()
+	im.RefreshDue(ctx)
+	os.Remove(path)
+	im.Refresh(ctx, "gone")
+
+	now := time.Now()
+	w := NewWatcher(s, hook.URL, slog.Default())
+	w.now = func() time.Time { return now }
+	if alerts := w.Check(ctx); len(alerts) != 0 {
+		t.Fatalf("alerts while fresh = %+v", alerts)
+	}
+
+	// Three refresh intervals on, both are stale; each is alerted once
+	now = now.Add(4 * time.Hour)
+	if alerts := w.Check(ctx); len(alerts) != 2 || len(posted) != 2 {
+		t.Fatalf("alerts once stale = %+v, posted %d", alerts, len(posted))
+	}
+	if a := posted[0]; a.Source != "gone" || a.Failures != 1 || a.LastError == "" || a.Kind != store.HealthStale {
+		t.Errorf("posted alert for the failing source = %+v", a)
+	}
+	if a := posted[1]; a.Source != "local" || a.Failures != 0 || a.Domains != 1 {
+		t.Errorf("posted alert for the unrefreshed source = %+v", a)
+	}
+	if alerts := w.Check(ctx); len(alerts) != 0 {
+		t.Errorf("alerted again: %+v", alerts)
+	}
+}
@@ -0,0 +1,153 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/nisatyap/week2-swg/policy-engine/store"
+)
+
+// maxListBytes caps a blocklist; the large public lists are a few MB
+const maxListBytes = 64 << 20
+
+// hostsNames are the host names hosts files map for the local machine
+// rather than to block them
+var hostsNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// Parse reads a blocklist in the given format and returns its domains,
+// normalized, sorted and deduplicated, and the number of lines skipped
+// because they held no domain the policy can block, such as AdBlock rules
+// with options or element hiding. Comments and blank lines don't count as
+// skipped.
+func Parse(r io.Reader, format string) (domains []string, skipped int, err error) {
+	var parseLine func(string) ([]string, bool)
+	switch format {
+	case store.FormatHosts:
+		parseLine = parseHosts
+	case store.FormatAdblock:
+		parseLine = parseAdblock
+	case store.FormatDomains:
+		parseLine = parseDomains
+	case store.FormatURLs:
+		parseLine = parseURLs
+	default:
+		return nil, 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	lr := &io.LimitedReader{R: r, N: maxListBytes + 1}
+	scanner := bufio.NewScanner(lr)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		names, ok := parseLine(strings.TrimSpace(scanner.Text()))
+		if !ok {
+			skipped++
+			continue
+		}
+		for _, name := range names {
+			domain, err := store.NormalizeDomain(name)
+			if err != nil {
+				skipped++
+				continue
+			}
+			domains = append(domains, domain)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("read list: %w", err)
+	}
+	if lr.N == 0 {
+		return nil, 0, fmt.Errorf("list is larger than %d MB", maxListBytes>>20)
+	}
+	return dedupe(domains), skipped, nil
+}
+
+// parseHosts parses "0.0.0.0 ads.example.com tracker.example.com # note"
+func parseHosts(line string) ([]string, bool) {
+	line, _, _ = strings.Cut(line, "#")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, true
+	}
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		return nil, false
+	}
+	var names []string
+	for _, name := range fields[1:] {
+		if !hostsNames[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	return names, true
+}
+
+// parseAdblock parses "||ads.example.com^", the only AdBlock Plus rule that
+// blocks a whole domain. Comments start with '!' and the header with '['.
+func parseAdblock(line string) ([]string, bool) {
+	if line == "" || line[0] == '!' || line[0] == '[' {
+		return nil, true
+	}
+	name, ok := strings.CutPrefix(line, "||")
+	if !ok {
+		return nil, false
+	}
+	name, ok = strings.CutSuffix(name, "^")
+	if !ok || strings.ContainsAny(name, "/*$^|") {
+		return nil, false
+	}
+	return []string{name}, true
+}
+
+// parseDomains parses "ads.example.com # note"
+func parseDomains(line string) ([]string, bool) {
+	line, _, _ = strings.Cut(line, "#")
+	fields := strings.Fields(line)
+	switch len(fields) {
+	case 0:
+		return nil, true
+	case 1:
+		return fields, true
+	}
+	return nil, false
+}
+
+// parseURLs parses "http://login.example.com/verify.php # note", taking the
+// host. Lines without a scheme are taken as URLs without one.
+func parseURLs(line string) ([]string, bool) {
+	line, _, _ = strings.Cut(line, "#")
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, true
+	}
+	if !strings.Contains(line, "://") {
+		line = "http://" + line
+	}
+	u, err := url.Parse(line)
+	if err != nil || u.Hostname() == "" {
+		return nil, false
+	}
+	return []string{u.Hostname()}, true
+}
+
+// dedupe sorts domains and drops repeats
+func dedupe(domains []string) []string {
+	slices.Sort(domains)
+	return slices.Compact(domains)
+}
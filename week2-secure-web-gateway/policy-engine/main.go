@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/nisatyap/week2-swg/policy-engine/app"
+)
+
+func main() {
+	os.Exit(app.Main("policy-engine", os.Args[1:]))
+}
@@ -0,0 +1,81 @@
+// Package signing signs the policy documents the policy engine publishes,
+// so proxies can check that a policy came from it unchanged before they
+// enforce it. Signatures are Ed25519 over cryptoutil.PolicyMessage of the
+// exact bytes of the response body, which adds the document type, the
+// version a delta applies to and when it was generated, and are sent in
+// headers as cryptoutil formats signatures.
+package signing
+
+import (
+	"crypto/ed25519"
+	"time"
+
+	"github.com/nisatyap/shared/cryptoutil"
+)
+
+// Response headers carrying the signature of the body and the ID of the
+// key that made it
+const (
+	HeaderSignature = "X-Policy-Signature"
+	HeaderKeyID     = "X-Policy-Key-ID"
+)
+
+// Algorithm names the signature scheme in published keys
+const Algorithm = cryptoutil.Ed25519
+
+// Signer signs with the policy engine's private key
+type Signer struct {
+	key *cryptoutil.Signer
+}
+
+// New returns a signer for key
+func New(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: cryptoutil.NewSigner(key)}
+}
+
+// LoadOrCreate reads the PEM-encoded PKCS #8 Ed25519 private key at path.
+// If there is no file, it generates a key and writes it there, readable
+// only by its owner, with the public key next to it in path+".pub" for
+// the proxies. It reports whether it created the key.
+//
+// path may instead be a secret reference, such as
+// vault:secret/data/swg#signing_key, to a key kept in a secret store, which
+// is read but never created.
+func LoadOrCreate(path string) (*Signer, bool, error) {
+	key, created, err := cryptoutil.LoadOrCreateSigner(path, "signing key")
+	if err != nil {
+		return nil, false, err
+	}
+	return &Signer{key: key}, created, nil
+}
+
+// Rotate replaces the key at path with a new one, keeping the old public
+// key, which it returns, in path+".pub" for retireAfter, so proxies given
+// the file accept policies signed with either while the policy engines
+// restart with the new key
+func Rotate(path string, retireAfter time.Duration) (*Signer, cryptoutil.PublicKey, error) {
+	key, retired, err := cryptoutil.RotateSigner(path, "signing key", retireAfter, time.Now())
+	if err != nil {
+		return nil, cryptoutil.PublicKey{}, err
+	}
+	return &Signer{key: key}, retired, nil
+}
+
+// KeyID identifies a public key: the first 8 bytes of its SHA-256, in hex
+func KeyID(pub ed25519.PublicKey) string {
+	return cryptoutil.KeyID(pub)
+}
+
+// ID returns the ID of the signer's key
+func (s *Signer) ID() string { return s.key.ID() }
+
+// PublicKey returns the public key proxies verify signatures with
+func (s *Signer) PublicKey() ed25519.PublicKey { return s.key.PublicKey() }
+
+// PublicKeyPEM returns the public key as a PEM "PUBLIC KEY" block
+func (s *Signer) PublicKeyPEM() []byte { return s.key.PublicKeyPEM() }
+
+// Sign returns the signature of data, base64-encoded
+func (s *Signer) Sign(data []byte) string {
+	return cryptoutil.EncodeSignature(s.key.Sign(data))
+}
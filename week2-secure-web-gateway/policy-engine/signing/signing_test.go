@@ -0,0 +1,91 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+	s, created, err := LoadOrCreate(path)
+	if err != nil || !created {
+		t.Fatalf("LoadOrCreate new key = %v, %v", created, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("private key file: %v, %v", info.Mode(), err)
+	}
+
+	again, created, err := LoadOrCreate(path)
+	if err != nil || created {
+		t.Fatalf("LoadOrCreate existing key = %v, %v", created, err)
+	}
+	if again.ID() != s.ID() {
+		t.Errorf("reloaded key ID = %s, want %s", again.ID(), s.ID())
+	}
+
+	// The .pub file verifies what the key signs
+	data, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"version":3}` + "\n")
+	sig, _ := base64.StdEncoding.DecodeString(again.Sign(body))
+	if !ed25519.Verify(pub.(ed25519.PublicKey), body, sig) {
+		t.Error("signature does not verify with the .pub key")
+	}
+	if KeyID(pub.(ed25519.PublicKey)) != s.ID() {
+		t.Errorf("KeyID of .pub = %s, want %s", KeyID(pub.(ed25519.PublicKey)), s.ID())
+	}
+	if ed25519.Verify(pub.(ed25519.PublicKey), []byte(`{"version":4}`+"\n"), sig) {
+		t.Error("signature verifies a different body")
+	}
+}
+
+func TestLoadFromSecretStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+	s, _, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	t.Setenv("TEST_SIGNING_KEY", string(data))
+	fromEnv, created, err := LoadOrCreate("env:TEST_SIGNING_KEY")
+	if err != nil || created || fromEnv.ID() != s.ID() {
+		t.Errorf("LoadOrCreate from the environment = %v, %v", created, err)
+	}
+	// A key that isn't in the store is never created there
+	if _, _, err := LoadOrCreate("env:TEST_NO_SIGNING_KEY"); err == nil {
+		t.Error("LoadOrCreate of a missing secret succeeded")
+	}
+}
+
+func TestLoadOrCreateRejectsOtherKeys(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	for name, data := range map[string][]byte{
+		"rsa.key":  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		"junk.key": []byte("not a key\n"),
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0o600)
+		if _, _, err := LoadOrCreate(path); err == nil {
+			t.Errorf("LoadOrCreate(%s) succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNoPolicy is returned by Backend.Load when nothing is stored yet
+var ErrNoPolicy = errors.New("no policy stored")
+
+// Backend keeps the policy and its history for a File: a JSON file, or a
+// SQLite or PostgreSQL database. A File calls it with its lock held, so
+// implementations need not be safe for concurrent use.
+type Backend interface {
+	// Load returns the stored policy and its revisions, oldest first, or
+	// ErrNoPolicy
+	Load() (Policy, []Revision, error)
+	// Commit stores p as the current policy. If rev is not nil, p is a
+	// new version: it is snapshotted as rev, and history holds the
+	// revisions kept from now on, oldest first and ending with rev.
+	// Snapshots of the other revisions are dropped.
+	Commit(p Policy, rev *Revision, history []Revision) error
+	// Snapshot returns the policy as it was at a revision's version
+	Snapshot(version int64) (Policy, error)
+	Close() error
+}
+
+// Import copies the policy and the history kept in the JSON file at path
+// into b, if b holds no policy yet and the file exists. It reports whether
+// it did.
+func Import(b Backend, path string) (bool, error) {
+	if _, _, err := b.Load(); !errors.Is(err, ErrNoPolicy) {
+		return false, err
+	}
+	j := NewJSONFile(path)
+	p, history, err := j.Load()
+	if errors.Is(err, ErrNoPolicy) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var kept []Revision
+	for _, rev := range history {
+		snapshot, err := j.Snapshot(rev.Version)
+		if errors.Is(err, ErrVersionNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		kept = append(kept, rev)
+		if err := b.Commit(snapshot, &rev, kept); err != nil {
+			return false, err
+		}
+	}
+	if err := b.Commit(p, nil, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// JSONFile keeps the policy in a JSON file, and its history in a directory
+// next to it holding an index of the revisions and a snapshot of each
+type JSONFile struct {
+	path string
+}
+
+// NewJSONFile returns a backend keeping the policy in the JSON file at path
+func NewJSONFile(path string) *JSONFile {
+	return &JSONFile{path: path}
+}
+
+func (j *JSONFile) Load() (Policy, []Revision, error) {
+	var p Policy
+	data, err := os.ReadFile(j.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return Policy{}, nil, ErrNoPolicy
+	case err != nil:
+		return Policy{}, nil, fmt.Errorf("read policy: %w", err)
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Policy{}, nil, fmt.Errorf("parse %s: %w", j.path, err)
+	}
+	var history []Revision
+	data, err = os.ReadFile(j.indexPath())
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &history); err != nil {
+			return Policy{}, nil, fmt.Errorf("parse history index: %w", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return Policy{}, nil, fmt.Errorf("read history: %w", err)
+	}
+	return p, history, nil
+}
+
+// Commit writes the snapshot and the index before the policy, so the
+// history never lacks the current version. A crash between them leaves a
+// revision of a version the policy never reached, which the next commit
+// of that version replaces.
+func (j *JSONFile) Commit(p Policy, rev *Revision, history []Revision) error {
+	if rev != nil {
+		if err := os.MkdirAll(j.historyDir(), 0o755); err != nil {
+			return fmt.Errorf("create history: %w", err)
+		}
+		if err := writeFile(j.snapshotPath(rev.Version), p); err != nil {
+			return err
+		}
+		if err := writeFile(j.indexPath(), history); err != nil {
+			return err
+		}
+		j.dropSnapshots(history)
+	}
+	return writeFile(j.path, p)
+}
+
+// dropSnapshots removes the snapshots of revisions not in history
+func (j *JSONFile) dropSnapshots(history []Revision) {
+	kept := make(map[int64]bool, len(history))
+	for _, r := range history {
+		kept[r.Version] = true
+	}
+	names, _ := filepath.Glob(filepath.Join(j.historyDir(), "v*.json"))
+	for _, name := range names {
+		v, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), "v"), ".json"), 10, 64)
+		if err == nil && !kept[v] {
+			os.Remove(name)
+		}
+	}
+}
+
+func (j *JSONFile) Snapshot(version int64) (Policy, error) {
+	data, err := os.ReadFile(j.snapshotPath(version))
+	if errors.Is(err, os.ErrNotExist) {
+		return Policy{}, ErrVersionNotFound
+	}
+	if err != nil {
+		return Policy{}, fmt.Errorf("read snapshot: %w", err)
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Policy{}, fmt.Errorf("parse snapshot v%d: %w", version, err)
+	}
+	return p, nil
+}
+
+func (j *JSONFile) Close() error { return nil }
+
+// historyDir is where the snapshots and the index of revisions are kept
+func (j *JSONFile) historyDir() string {
+	return j.path + ".history"
+}
+
+func (j *JSONFile) indexPath() string {
+	return filepath.Join(j.historyDir(), "index.json")
+}
+
+func (j *JSONFile) snapshotPath(version int64) string {
+	return filepath.Join(j.historyDir(), fmt.Sprintf("v%d.json", version))
+}
+
+// writeFile replaces the JSON file at path atomically: readers and a crash
+// mid-write see either the old file or the new one
+func writeFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save policy: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save policy: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save policy: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save policy: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save policy: %w", err)
+	}
+	return nil
+}
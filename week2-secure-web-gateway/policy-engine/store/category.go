@@ -0,0 +1,59 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Category actions
+const (
+	ActionBlock = "block" // block the member domains and their subdomains
+	ActionAllow = "allow" // always allow them, even where a rule or another category blocks them
+	// ActionTrusted blocks the member domains, except for devices that
+	// present a posture token the collector signed for a compliant
+	// device. Proxies that predate it block them for every device.
+	ActionTrusted = "trusted"
+)
+
+// maxDescription caps a category description
+const maxDescription = 500
+
+// Category is a named set of domains the proxy blocks or allows as a whole,
+// e.g. "social" or "gambling"
+type Category struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Action      string    `json:"action"`
+	Domains     []string  `json:"domains"`
+	AddedAt     time.Time `json:"added_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate normalizes the category's fields and checks them. Member
+// domains are sorted and deduplicated.
+func (c *Category) Validate() error {
+	c.Name = strings.ToLower(strings.TrimSpace(c.Name))
+	if !categoryPattern.MatchString(c.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits, '-' or '_'", c.Name)
+	}
+	c.Description = strings.TrimSpace(c.Description)
+	if len(c.Description) > maxDescription {
+		return fmt.Errorf("description is longer than %d characters", maxDescription)
+	}
+	if c.Action == "" {
+		c.Action = ActionBlock
+	}
+	if c.Action != ActionBlock && c.Action != ActionAllow && c.Action != ActionTrusted {
+		return fmt.Errorf("action must be %q, %q or %q", ActionBlock, ActionAllow, ActionTrusted)
+	}
+	for i, d := range c.Domains {
+		domain, err := NormalizeDomain(d)
+		if err != nil {
+			return err
+		}
+		c.Domains[i] = domain
+	}
+	c.Domains = dedupe(c.Domains)
+	return nil
+}
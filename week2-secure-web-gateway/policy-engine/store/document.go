@@ -0,0 +1,328 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/flags"
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the policy as people write and review it, e.g. in a git
+// repository: the rules, categories, groups and sources, without the IDs,
+// timestamps and fetched domains the policy engine keeps with them, and
+// the fleet's feature flags.
+type Document struct {
+	// Version is the policy version the document was exported from. It is
+	// for the reader; Apply ignores it.
+	Version    int64              `yaml:"version,omitempty"`
+	Rules      []DocumentRule     `yaml:"rules"`
+	Categories []DocumentCategory `yaml:"categories"`
+	Groups     []DocumentGroup    `yaml:"groups"`
+	Sources    []DocumentSource   `yaml:"sources"`
+	Flags      []DocumentFlag     `yaml:"flags"`
+}
+
+// DocumentRule is a rule in a Document
+type DocumentRule struct {
+	Type           string     `yaml:"type,omitempty"` // suffix if empty
+	Domain         string     `yaml:"domain"`
+	Category       string     `yaml:"category,omitempty"`
+	Groups         []string   `yaml:"groups,omitempty,flow"`
+	EffectiveFrom  *time.Time `yaml:"effective_from,omitempty"`
+	EffectiveUntil *time.Time `yaml:"effective_until,omitempty"`
+	Schedule       *Schedule  `yaml:"schedule,omitempty"`
+}
+
+// DocumentCategory is a category in a Document
+type DocumentCategory struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Action      string   `yaml:"action,omitempty"` // block if empty
+	Domains     []string `yaml:"domains"`
+}
+
+// DocumentGroup is a device group in a Document
+type DocumentGroup struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Devices     []string `yaml:"devices"`
+}
+
+// DocumentSource is a blocklist source in a Document. Its domains are
+// fetched, not written down.
+type DocumentSource struct {
+	Name     string   `yaml:"name"`
+	URL      string   `yaml:"url,omitempty"`
+	Path     string   `yaml:"path,omitempty"`
+	Format   string   `yaml:"format"`
+	Category string   `yaml:"category,omitempty"`
+	Refresh  Duration `yaml:"refresh,omitempty"`
+	Expire   Duration `yaml:"expire,omitempty"`
+}
+
+// DocumentFlag is a feature flag in a Document
+type DocumentFlag struct {
+	Name        string      `yaml:"name"`
+	Description string      `yaml:"description,omitempty"`
+	Value       flags.Value `yaml:"value"`
+}
+
+// InvalidDocumentError lists everything wrong with a document, so it can
+// be fixed in one go
+type InvalidDocumentError struct {
+	Problems []string
+}
+
+func (e *InvalidDocumentError) Error() string {
+	return "invalid policy document: " + strings.Join(e.Problems, "; ")
+}
+
+// Document returns the policy as a Document
+func (p Policy) Document() Document {
+	d := Document{
+		Version:    p.Version,
+		Rules:      make([]DocumentRule, 0, len(p.Rules)),
+		Categories: make([]DocumentCategory, 0, len(p.Categories)),
+		Groups:     make([]DocumentGroup, 0, len(p.Groups)),
+		Sources:    make([]DocumentSource, 0, len(p.Sources)),
+		Flags:      make([]DocumentFlag, 0, len(p.Flags)),
+	}
+	for _, r := range p.Rules {
+		d.Rules = append(d.Rules, DocumentRule{
+			Type: r.Type, Domain: r.Domain, Category: r.Category, Groups: r.Groups,
+			EffectiveFrom: r.EffectiveFrom, EffectiveUntil: r.EffectiveUntil, Schedule: r.Schedule,
+		})
+	}
+	for _, c := range p.Categories {
+		d.Categories = append(d.Categories, DocumentCategory{Name: c.Name, Description: c.Description, Action: c.Action, Domains: c.Domains})
+	}
+	for _, g := range p.Groups {
+		d.Groups = append(d.Groups, DocumentGroup{Name: g.Name, Description: g.Description, Devices: g.Devices})
+	}
+	for _, s := range p.Sources {
+		d.Sources = append(d.Sources, DocumentSource{
+			Name: s.Name, URL: s.URL, Path: s.Path, Format: s.Format, Category: s.Category, Refresh: s.Refresh, Expire: s.Expire,
+		})
+	}
+	for _, fl := range p.Flags {
+		d.Flags = append(d.Flags, DocumentFlag{Name: fl.Name, Description: fl.Description, Value: fl.Value})
+	}
+	return d
+}
+
+// YAML returns the document as YAML
+func (d Document) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseDocument reads a YAML document, or a JSON one, which is YAML too.
+// Unknown fields are errors: a misspelt one would otherwise be dropped
+// without a word.
+func ParseDocument(data []byte) (Document, error) {
+	var d Document
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&d); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Document{}, errors.New("empty policy document")
+		}
+		return Document{}, fmt.Errorf("parse policy document: %w", err)
+	}
+	return d, nil
+}
+
+// Apply makes the policy match d, as one new version. Rules the policy
+// already has, and categories, groups, sources and flags of the same names, are
+// kept with their IDs and timestamps; sources still at the same location
+// keep their fetched domains, and the others are fetched on the next
+// refresh. A document that changes nothing makes no new version, and with
+// dryRun nothing is changed either way. Apply returns what changed, or
+// would have, and the current policy.
+func (f *File) Apply(d Document, dryRun bool) (Changes, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next, err := f.fromDocument(d, f.now().UTC())
+	if err != nil {
+		return Changes{}, f.policy, err
+	}
+	changes := Compare(f.policy, next)
+	if dryRun || changes.Empty() {
+		return changes, f.policy, nil
+	}
+	p, err := f.commit(next)
+	return changes, p, err
+}
+
+// fromDocument builds the next version of the policy from d, checking all
+// of it before it gives up
+func (f *File) fromDocument(d Document, now time.Time) (Policy, error) {
+	var problems []string
+	bad := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	next := f.next(now)
+	next.Rules, next.Categories, next.Groups, next.Sources, next.Flags = []Rule{}, []Category{}, []Group{}, []Source{}, nil
+
+	deviceGroup := make(map[string]string)
+	for i, in := range d.Groups {
+		g := Group{Name: in.Name, Description: in.Description, Devices: slices.Clone(in.Devices)}
+		if err := g.Validate(); err != nil {
+			bad("groups[%d]: %v", i, err)
+			continue
+		}
+		if _, ok := next.Group(g.Name); ok {
+			bad("groups[%d]: group %s is listed twice", i, g.Name)
+			continue
+		}
+		for _, device := range g.Devices {
+			if other, ok := deviceGroup[device]; ok {
+				bad("groups[%d]: device %s is also in %s", i, device, other)
+			}
+			deviceGroup[device] = g.Name
+		}
+		g.AddedAt, g.UpdatedAt = now, now
+		if old, ok := f.policy.Group(g.Name); ok {
+			g.AddedAt, g.UpdatedAt = old.AddedAt, old.UpdatedAt
+			if !reflect.DeepEqual(old, g) {
+				g.UpdatedAt = now
+			}
+		}
+		next.Groups = insertSorted(next.Groups, g, func(g Group) string { return g.Name })
+	}
+
+	for i, in := range d.Categories {
+		c := Category{Name: in.Name, Description: in.Description, Action: in.Action, Domains: slices.Clone(in.Domains)}
+		if err := c.Validate(); err != nil {
+			bad("categories[%d]: %v", i, err)
+			continue
+		}
+		if _, ok := next.Category(c.Name); ok {
+			bad("categories[%d]: category %s is listed twice", i, c.Name)
+			continue
+		}
+		c.AddedAt, c.UpdatedAt = now, now
+		if old, ok := f.policy.Category(c.Name); ok {
+			c.AddedAt, c.UpdatedAt = old.AddedAt, old.UpdatedAt
+			if !reflect.DeepEqual(old, c) {
+				c.UpdatedAt = now
+			}
+		}
+		next.Categories = insertSorted(next.Categories, c, func(c Category) string { return c.Name })
+	}
+
+	for i, in := range d.Sources {
+		s := Source{Name: in.Name, URL: in.URL, Path: in.Path, Format: in.Format, Category: in.Category, Refresh: in.Refresh, Expire: in.Expire}
+		if err := s.Validate(); err != nil {
+			bad("sources[%d]: %v", i, err)
+			continue
+		}
+		if _, ok := next.Source(s.Name); ok {
+			bad("sources[%d]: source %s is listed twice", i, s.Name)
+			continue
+		}
+		s.AddedAt = now
+		if old, ok := f.policy.Source(s.Name); ok {
+			s.AddedAt = old.AddedAt
+			if old.URL == s.URL && old.Path == s.Path && old.Format == s.Format {
+				s.Domains, s.LastSeen, s.LastDiff = old.Domains, old.LastSeen, old.LastDiff
+				s.CheckedAt, s.FetchedAt, s.LastError, s.Failures = old.CheckedAt, old.FetchedAt, old.LastError, old.Failures
+			}
+		}
+		next.Sources = insertSorted(next.Sources, s, func(s Source) string { return s.Name })
+	}
+
+	for i, in := range d.Flags {
+		fl := Flag{Name: in.Name, Description: in.Description, Value: in.Value}
+		if err := fl.Validate(); err != nil {
+			bad("flags[%d]: %v", i, err)
+			continue
+		}
+		if _, ok := next.Flag(fl.Name); ok {
+			bad("flags[%d]: flag %s is listed twice", i, fl.Name)
+			continue
+		}
+		fl.AddedAt, fl.UpdatedAt = now, now
+		if old, ok := f.policy.Flag(fl.Name); ok {
+			fl.AddedAt, fl.UpdatedAt = old.AddedAt, old.UpdatedAt
+			if !reflect.DeepEqual(old, fl) {
+				fl.UpdatedAt = now
+			}
+		}
+		next.Flags = insertSorted(next.Flags, fl, func(fl Flag) string { return fl.Name })
+	}
+
+	kept := make(map[int64]bool)
+	for i, in := range d.Rules {
+		r := Rule{
+			Type: in.Type, Domain: in.Domain, Category: in.Category, Groups: slices.Clone(in.Groups),
+			EffectiveFrom: cloneTime(in.EffectiveFrom), EffectiveUntil: cloneTime(in.EffectiveUntil),
+		}
+		if in.Schedule != nil {
+			schedule := *in.Schedule
+			schedule.Days = slices.Clone(schedule.Days)
+			r.Schedule = &schedule
+		}
+		if err := r.Validate(); err != nil {
+			bad("rules[%d]: %v", i, err)
+			continue
+		}
+		for _, g := range r.Groups {
+			if _, ok := next.Group(g); !ok {
+				bad("rules[%d]: group %s is not in the document", i, g)
+			}
+		}
+		if slices.ContainsFunc(next.Rules, r.duplicates) {
+			bad("rules[%d]: %s %s is listed twice", i, r.Type, r.Domain)
+			continue
+		}
+		j := slices.IndexFunc(f.policy.Rules, func(old Rule) bool { return !kept[old.ID] && old.duplicates(r) })
+		if j >= 0 {
+			old := f.policy.Rules[j]
+			r.ID, r.AddedAt, r.UpdatedAt = old.ID, old.AddedAt, old.UpdatedAt
+			if !reflect.DeepEqual(old, r) {
+				r.UpdatedAt = now
+			}
+			kept[r.ID] = true
+		} else {
+			r.ID, r.AddedAt, r.UpdatedAt = next.NextID, now, now
+			next.NextID++
+		}
+		next.Rules = append(next.Rules, r)
+	}
+
+	if problems != nil {
+		return Policy{}, &InvalidDocumentError{Problems: problems}
+	}
+	return next, nil
+}
+
+// insertSorted inserts v into list, which is sorted by name
+func insertSorted[T any](list []T, v T, name func(T) string) []T {
+	i := sort.Search(len(list), func(i int) bool { return name(list[i]) >= name(v) })
+	return slices.Insert(list, i, v)
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/flags"
+)
+
+// Flag is a feature flag the policy engine sets for the fleet, e.g.
+// mitm at 10% to have the proxies intercept HTTPS for a tenth of the
+// devices. Services read the flags they know of from GET /flags, and the
+// values set here win over their own configuration.
+type Flag struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Value       flags.Value `json:"value"`
+	AddedAt     time.Time   `json:"added_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// Validate normalizes the flag's fields and checks them
+func (fl *Flag) Validate() error {
+	fl.Name = strings.ToLower(strings.TrimSpace(fl.Name))
+	if !flags.ValidName(fl.Name) {
+		return fmt.Errorf("name %q must be lowercase letters and digits, in words joined by '-'", fl.Name)
+	}
+	fl.Description = strings.TrimSpace(fl.Description)
+	if len(fl.Description) > maxDescription {
+		return fmt.Errorf("description is longer than %d characters", maxDescription)
+	}
+	if fl.Value < flags.Off || fl.Value > flags.On {
+		return fmt.Errorf("value %d%% is not from 0%% to 100%%", int(fl.Value))
+	}
+	return nil
+}
+
+// Flag returns the flag called name
+func (p Policy) Flag(name string) (Flag, bool) {
+	if fl := findNamed(p.Flags, name, func(fl Flag) string { return fl.Name }); fl != nil {
+		return *fl, true
+	}
+	return Flag{}, false
+}
+
+// FlagValues returns the flags' values by name, as services read them
+func (p Policy) FlagValues() map[string]flags.Value {
+	values := make(map[string]flags.Value, len(p.Flags))
+	for _, fl := range p.Flags {
+		values[fl.Name] = fl.Value
+	}
+	return values
+}
+
+// SetFlag sets the value and description of the flag called fl.Name,
+// adding it if the policy has none, and reports whether it was added
+func (f *File) SetFlag(fl Flag) (Flag, bool, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now().UTC()
+	old, exists := f.policy.Flag(fl.Name)
+	if exists && old.Value == fl.Value && old.Description == fl.Description {
+		return old, false, f.policy, nil
+	}
+	next := f.next(now)
+	fl.AddedAt, fl.UpdatedAt = now, now
+	if exists {
+		fl.AddedAt = old.AddedAt
+		*findNamed(next.Flags, fl.Name, func(fl Flag) string { return fl.Name }) = fl
+	} else {
+		next.Flags = insertSorted(next.Flags, fl, func(fl Flag) string { return fl.Name })
+	}
+	p, err := f.commit(next)
+	return fl, !exists, p, err
+}
+
+// DeleteFlag removes the flag called name, so that services go back to
+// their configured values
+func (f *File) DeleteFlag(name string) (Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.policy.Flag(name); !ok {
+		return f.policy, ErrFlagNotFound
+	}
+	next := f.next(f.now().UTC())
+	next.Flags = next.Flags[:0]
+	for _, fl := range f.policy.Flags {
+		if fl.Name != name {
+			next.Flags = append(next.Flags, fl)
+		}
+	}
+	return f.commit(next)
+}
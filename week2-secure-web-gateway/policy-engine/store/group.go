@@ -0,0 +1,70 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// devicePattern matches device IDs: the host names the posture agents
+// report, or any other ID the proxy knows its clients by
+var devicePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,252}$`)
+
+// Group is a set of devices that gets the rules scoped to it on top of the
+// rules that apply to everyone, e.g. "engineering" or "students"
+type Group struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Devices     []string  `json:"devices"`
+	AddedAt     time.Time `json:"added_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate normalizes the group's fields and checks them. Devices are
+// sorted and deduplicated.
+func (g *Group) Validate() error {
+	g.Name = strings.ToLower(strings.TrimSpace(g.Name))
+	if !categoryPattern.MatchString(g.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits, '-' or '_'", g.Name)
+	}
+	g.Description = strings.TrimSpace(g.Description)
+	if len(g.Description) > maxDescription {
+		return fmt.Errorf("description is longer than %d characters", maxDescription)
+	}
+	for i, d := range g.Devices {
+		device, err := NormalizeDevice(d)
+		if err != nil {
+			return err
+		}
+		g.Devices[i] = device
+	}
+	if g.Devices == nil {
+		g.Devices = []string{}
+	}
+	g.Devices = dedupe(g.Devices)
+	return nil
+}
+
+// NormalizeDevice lowercases a device ID and checks it
+func NormalizeDevice(device string) (string, error) {
+	d := strings.ToLower(strings.TrimSpace(device))
+	if !devicePattern.MatchString(d) {
+		return "", fmt.Errorf("device %q must be letters, digits, '.', '-' or '_'", device)
+	}
+	return d, nil
+}
+
+// appliesTo reports whether a rule scoped to groups applies to group; an
+// unscoped rule applies to everyone
+func appliesTo(groups []string, group string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"time"
+)
+
+// DefaultHistory is how many versions are kept for rollback by default
+const DefaultHistory = 100
+
+// ErrVersionNotFound is returned for versions the history no longer or
+// never held
+var ErrVersionNotFound = errors.New("version not in history")
+
+// Revision is one version of the policy and what changed to make it
+type Revision struct {
+	Version   int64     `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// RestoredFrom is the version a rollback restored, if this version
+	// is one
+	RestoredFrom int64   `json:"restored_from,omitempty"`
+	Changes      Changes `json:"changes"`
+}
+
+// Changes is the difference between two versions of the policy. Rules are
+// matched by ID, and the others by name.
+type Changes struct {
+	RulesAdded   []Rule `json:"rules_added,omitempty"`
+	RulesRemoved []Rule `json:"rules_removed,omitempty"`
+	RulesChanged []Rule `json:"rules_changed,omitempty"` // as they are in the later version
+
+	Categories *NameChanges `json:"categories,omitempty"`
+	Groups     *NameChanges `json:"groups,omitempty"`
+	Sources    *NameChanges `json:"sources,omitempty"`
+	Flags      *NameChanges `json:"flags,omitempty"`
+}
+
+// Empty reports whether nothing changed
+func (c Changes) Empty() bool {
+	return c.RulesAdded == nil && c.RulesRemoved == nil && c.RulesChanged == nil &&
+		c.Categories == nil && c.Groups == nil && c.Sources == nil && c.Flags == nil
+}
+
+// NameChanges lists the named objects added, removed and changed
+type NameChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Compare returns what changed from one version of the policy to another
+func Compare(from, to Policy) Changes {
+	var c Changes
+	before := make(map[int64]Rule, len(from.Rules))
+	for _, r := range from.Rules {
+		before[r.ID] = r
+	}
+	for _, r := range to.Rules {
+		old, ok := before[r.ID]
+		switch {
+		case !ok:
+			c.RulesAdded = append(c.RulesAdded, r)
+		case !reflect.DeepEqual(old, r):
+			c.RulesChanged = append(c.RulesChanged, r)
+		}
+		delete(before, r.ID)
+	}
+	for _, r := range from.Rules {
+		if _, ok := before[r.ID]; ok {
+			c.RulesRemoved = append(c.RulesRemoved, r)
+		}
+	}
+	c.Categories = compareNamed(from.Categories, to.Categories, func(c Category) string { return c.Name })
+	c.Groups = compareNamed(from.Groups, to.Groups, func(g Group) string { return g.Name })
+	c.Sources = compareNamed(from.Sources, to.Sources, func(s Source) string { return s.Name })
+	c.Flags = compareNamed(from.Flags, to.Flags, func(fl Flag) string { return fl.Name })
+	return c
+}
+
+// compareNamed compares two lists of named objects, returning nil if they
+// are the same
+func compareNamed[T any](from, to []T, name func(T) string) *NameChanges {
+	var c NameChanges
+	before := make(map[string]T, len(from))
+	for _, v := range from {
+		before[name(v)] = v
+	}
+	for _, v := range to {
+		old, ok := before[name(v)]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, name(v))
+		case !reflect.DeepEqual(old, v):
+			c.Changed = append(c.Changed, name(v))
+		}
+		delete(before, name(v))
+	}
+	for _, v := range from {
+		if _, ok := before[name(v)]; ok {
+			c.Removed = append(c.Removed, name(v))
+		}
+	}
+	if c.Added == nil && c.Removed == nil && c.Changed == nil {
+		return nil
+	}
+	return &c
+}
+
+// startHistory starts the history with the current version if it lacks
+// it, committing the policy as it goes
+func (f *File) startHistory() error {
+	if n := len(f.history); n > 0 && f.history[n-1].Version == f.policy.Version {
+		return nil
+	}
+	return f.record(Revision{Version: f.policy.Version, UpdatedAt: f.policy.UpdatedAt}, f.policy)
+}
+
+// record commits p as the revision rev, replacing any revision of the same
+// or a later version a failed commit left behind, and dropping the oldest
+// beyond the history limit
+func (f *File) record(rev Revision, p Policy) error {
+	history := f.history[:0:0]
+	for _, r := range f.history {
+		if r.Version < rev.Version {
+			history = append(history, r)
+		}
+	}
+	history = append(history, rev)
+	if limit := max(f.historyLimit, 1); len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	if err := f.backend.Commit(p, &rev, history); err != nil {
+		return err
+	}
+	f.history = history
+	return nil
+}
+
+// SetHistoryLimit sets how many versions are kept for rollback, from the
+// next change on
+func (f *File) SetHistoryLimit(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.historyLimit = n
+}
+
+// History returns the revisions held, newest first
+func (f *File) History() []Revision {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]Revision, len(f.history))
+	for i, r := range f.history {
+		out[len(out)-1-i] = r
+	}
+	return out
+}
+
+// Revision returns the revision of the given version
+func (f *File) Revision(version int64) (Revision, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, r := range f.history {
+		if r.Version == version {
+			return r, nil
+		}
+	}
+	return Revision{}, ErrVersionNotFound
+}
+
+// Snapshot returns the policy as it was at the given version
+func (f *File) Snapshot(version int64) (Policy, error) {
+	if _, err := f.Revision(version); err != nil {
+		return Policy{}, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	p, err := f.backend.Snapshot(version)
+	upgradeTypes(p.Rules)
+	return p, err
+}
+
+// Rollback makes the policy as it was at the given version current again,
+// as a new version. Rule IDs are never reused, so rules created after that
+// version keep their IDs out of circulation.
+func (f *File) Rollback(version int64) (Policy, error) {
+	old, err := f.Snapshot(version)
+	if err != nil {
+		return Policy{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next := f.next(f.now().UTC())
+	next.Rules, next.Categories, next.Sources, next.Groups = old.Rules, old.Categories, old.Sources, old.Groups
+	next.Flags = old.Flags
+	next.NextID = max(next.NextID, old.NextID)
+	next.RestoredFrom = version
+	return f.commit(next)
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/hostmatch"
+)
+
+// What a Verdict matched
+const (
+	MatchRule     = "rule"
+	MatchSource   = "source"
+	MatchCategory = "category"
+)
+
+// Verdict is what the proxy does with a host under a policy, and why
+type Verdict struct {
+	Host    string `json:"host"`
+	Blocked bool   `json:"blocked"`
+	// Match is what decided the verdict: a rule, a source or a category.
+	// It is empty for a host nothing matches, which is allowed.
+	Match    string `json:"match,omitempty"`
+	Entry    string `json:"entry,omitempty"` // the domain or pattern that matched
+	RuleID   int64  `json:"rule_id,omitempty"`
+	Name     string `json:"name,omitempty"` // the source or category
+	Category string `json:"category,omitempty"`
+	// Trusted marks a host that is blocked only for devices without a
+	// posture token for a compliant device, by a trusted category
+	Trusted bool   `json:"trusted,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// Match returns the verdict on host, which must be normalized, for the
+// devices of group at t. It decides as the proxy does: allow categories
+// first, then exact and suffix rules and sources, block categories,
+// trusted categories, then wildcard rules and regex rules last; a suffix
+// rule or a source's domain matches its subdomains, an exact rule only the
+// host itself.
+func (p Policy) Match(host string, t time.Time, group string) Verdict {
+	if matches := p.Matches(host, t, group); len(matches) > 0 {
+		return matches[0]
+	}
+	return Verdict{Host: host, Reason: "no rule matches"}
+}
+
+// Matches returns everything in the policy that matches host for the
+// devices of group at t, in the order the proxy checks them. The first
+// decides; the others would decide if it went.
+func (p Policy) Matches(host string, t time.Time, group string) []Verdict {
+	labels := strings.Split(host, ".")
+	suffixes := make([]string, len(labels))
+	for i := range labels {
+		suffixes[i] = strings.Join(labels[i:], ".")
+	}
+
+	var matches []Verdict
+	for _, c := range p.Categories {
+		if d, ok := findSuffix(c.Domains, suffixes); ok && c.Action == ActionAllow {
+			matches = append(matches, Verdict{Host: host, Match: MatchCategory, Entry: d, Name: c.Name, Category: c.Name,
+				Reason: "allowed by category " + c.Name})
+		}
+	}
+	for _, d := range suffixes {
+		for _, r := range p.Rules {
+			exact := r.Type == TypeExact && d == host
+			if (r.Type == TypeSuffix || exact) && r.Domain == d && r.Active(t) && appliesTo(r.Groups, group) {
+				matches = append(matches, Verdict{Host: host, Blocked: true, Match: MatchRule, Entry: d, RuleID: r.ID, Category: r.Category,
+					Reason: "blocked by rule for " + d})
+			}
+		}
+		for _, s := range p.Sources {
+			if _, found := slices.BinarySearch(s.Domains, d); found {
+				matches = append(matches, Verdict{Host: host, Blocked: true, Match: MatchSource, Entry: d, Name: s.Name, Category: s.Category,
+					Reason: "blocked by source " + s.Name})
+			}
+		}
+	}
+	for _, c := range p.Categories {
+		if d, ok := findSuffix(c.Domains, suffixes); ok && c.Action == ActionBlock {
+			matches = append(matches, Verdict{Host: host, Blocked: true, Match: MatchCategory, Entry: d, Name: c.Name, Category: c.Name,
+				Reason: "blocked by category " + c.Name})
+		}
+	}
+	for _, c := range p.Categories {
+		if d, ok := findSuffix(c.Domains, suffixes); ok && c.Action == ActionTrusted {
+			matches = append(matches, Verdict{Host: host, Blocked: true, Trusted: true, Match: MatchCategory, Entry: d, Name: c.Name, Category: c.Name,
+				Reason: "blocked by category " + c.Name + " unless the device is trusted"})
+		}
+	}
+	for _, r := range p.Rules {
+		if r.Type == TypeWildcard && r.Active(t) && appliesTo(r.Groups, group) && hostmatch.Wildcard(r.Domain, labels) {
+			matches = append(matches, Verdict{Host: host, Blocked: true, Match: MatchRule, Entry: r.Domain, RuleID: r.ID, Category: r.Category,
+				Reason: "blocked by pattern " + r.Domain})
+		}
+	}
+	for _, r := range p.Rules {
+		if r.Type != TypeRegex || !r.Active(t) || !appliesTo(r.Groups, group) {
+			continue
+		}
+		if re, err := p.regex(r.Domain); err == nil && re.MatchString(host) {
+			matches = append(matches, Verdict{Host: host, Blocked: true, Match: MatchRule, Entry: r.Domain, RuleID: r.ID, Category: r.Category,
+				Reason: "blocked by regex " + r.Domain})
+		}
+	}
+	return matches
+}
+
+// findSuffix returns the first of suffixes in the sorted domains
+func findSuffix(domains, suffixes []string) (string, bool) {
+	for _, d := range suffixes {
+		if _, found := slices.BinarySearch(domains, d); found {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// regex returns the compiled pattern of a regex rule: the one compiled
+// when the policy was published, or, for a rule the policy wasn't
+// published with, such as one a dry run proposes, a new one
+func (p Policy) regex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := p.regexes[pattern]; ok {
+		return re, nil
+	}
+	return hostmatch.Regex(pattern)
+}
+
+// compileRegexes compiles the patterns of the policy's regex rules as it
+// is published, for Matches to reuse for every URL of a dry run. Only the
+// published versions' rules are kept, so what callers propose can't grow
+// them.
+func (p *Policy) compileRegexes() {
+	p.regexes = make(map[string]*regexp.Regexp)
+	for _, r := range p.Rules {
+		if r.Type != TypeRegex {
+			continue
+		}
+		if re, err := hostmatch.Regex(r.Domain); err == nil {
+			p.regexes[r.Domain] = re
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package store
+
+import (
+	"embed"
+
+	"github.com/nisatyap/shared/sqlstore"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrations returns the schema steps in migrations/<dialect>, which
+// sqlstore applies when it opens a database
+func migrations(dialect string) ([]sqlstore.Migration, error) {
+	return sqlstore.ReadMigrations(migrationFiles, "migrations/"+dialect)
+}
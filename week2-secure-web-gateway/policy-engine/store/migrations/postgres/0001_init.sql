@@ -0,0 +1,68 @@
+-- The current policy's version and counters: a single row
+CREATE TABLE policy (
+    id            INTEGER PRIMARY KEY CHECK (id = 1),
+    version       BIGINT  NOT NULL,
+    updated_at    BIGINT  NOT NULL, -- unix nanoseconds
+    next_id       BIGINT  NOT NULL,
+    restored_from BIGINT  NOT NULL DEFAULT 0
+);
+
+CREATE TABLE rules (
+    id       BIGINT PRIMARY KEY,
+    type     TEXT NOT NULL,
+    domain   TEXT NOT NULL,
+    category TEXT NOT NULL DEFAULT '',
+    payload  JSONB NOT NULL -- full Rule
+);
+
+CREATE INDEX idx_rules_domain ON rules (domain);
+
+-- Categories, groups and sources hold their fields but their domains and
+-- devices in payload; the long lists have tables of their own
+CREATE TABLE categories (
+    name    TEXT PRIMARY KEY,
+    action  TEXT NOT NULL,
+    payload JSONB NOT NULL
+);
+
+CREATE TABLE category_domains (
+    category TEXT NOT NULL REFERENCES categories (name) ON DELETE CASCADE,
+    domain   TEXT NOT NULL,
+    PRIMARY KEY (category, domain)
+);
+
+CREATE TABLE device_groups (
+    name    TEXT PRIMARY KEY,
+    payload JSONB NOT NULL
+);
+
+CREATE TABLE group_devices (
+    group_name TEXT NOT NULL REFERENCES device_groups (name) ON DELETE CASCADE,
+    device     TEXT NOT NULL,
+    PRIMARY KEY (group_name, device)
+);
+
+CREATE INDEX idx_group_devices_device ON group_devices (device);
+
+CREATE TABLE sources (
+    name    TEXT PRIMARY KEY,
+    payload JSONB NOT NULL
+);
+
+CREATE TABLE source_domains (
+    source    TEXT    NOT NULL REFERENCES sources (name) ON DELETE CASCADE,
+    domain    TEXT    NOT NULL,
+    last_seen BIGINT  NOT NULL DEFAULT 0, -- unix nanoseconds, for sources that expire their domains
+    PRIMARY KEY (source, domain)
+);
+
+CREATE INDEX idx_source_domains_domain ON source_domains (domain);
+
+-- The versions kept for rollback, each with the policy as it was
+CREATE TABLE revisions (
+    version       BIGINT  PRIMARY KEY,
+    updated_at    BIGINT  NOT NULL,
+    restored_from BIGINT  NOT NULL DEFAULT 0,
+    changes       JSONB NOT NULL, -- Changes
+    snapshot      JSONB NOT NULL  -- Policy
+);
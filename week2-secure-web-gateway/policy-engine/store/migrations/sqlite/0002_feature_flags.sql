@@ -0,0 +1,5 @@
+-- The fleet's feature flags, whole in payload
+CREATE TABLE feature_flags (
+    name    TEXT PRIMARY KEY,
+    payload TEXT NOT NULL
+);
@@ -0,0 +1,271 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/hostmatch"
+)
+
+// Rule types
+const (
+	TypeExact    = "exact"    // the host name itself, but not its subdomains
+	TypeSuffix   = "suffix"   // the domain and all its subdomains
+	TypeWildcard = "wildcard" // host names matching a pattern such as *.example.com
+	TypeRegex    = "regex"    // host names a regular expression matches in full
+	// TypeDomain is what suffix rules were called before there were exact
+	// and regex rules. It is still accepted, and stored as suffix.
+	TypeDomain = "domain"
+)
+
+// maxRegexLength caps the pattern of a regex rule. Go's regexp runs in
+// linear time, but a huge pattern is still slow to compile on every proxy.
+const maxRegexLength = 512
+
+// Rule states at a given time
+const (
+	StateActive    = "active"    // blocking now
+	StateIdle      = "idle"      // in effect, but outside its schedule
+	StateScheduled = "scheduled" // not in effect yet
+	StateExpired   = "expired"   // no longer in effect
+)
+
+// Rule blocks the hosts it matches, optionally only between EffectiveFrom
+// and EffectiveUntil and only while its schedule is active
+type Rule struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	Domain   string `json:"domain"` // the domain, or the pattern of a wildcard or regex rule
+	Category string `json:"category,omitempty"`
+	// Groups scopes the rule to the devices of these groups; empty applies
+	// it to everyone
+	Groups []string `json:"groups,omitempty"`
+	// EffectiveFrom and EffectiveUntil bound when the rule is in effect,
+	// e.g. exams week; nil leaves that end open. Until is exclusive.
+	EffectiveFrom  *time.Time `json:"effective_from,omitempty"`
+	EffectiveUntil *time.Time `json:"effective_until,omitempty"`
+	// Schedule limits when the rule blocks while it is in effect; nil
+	// blocks at all times
+	Schedule  *Schedule `json:"schedule,omitempty"`
+	AddedAt   time.Time `json:"added_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Schedule is a recurring weekly window, e.g. weekdays 09:00-17:00
+type Schedule struct {
+	Days     []string `json:"days,omitempty" yaml:"days,omitempty,flow"` // mon ... sun; empty means every day
+	Start    string   `json:"start" yaml:"start"`                        // HH:MM
+	End      string   `json:"end" yaml:"end"`                            // HH:MM; before Start spans midnight, equal to it the whole day
+	Timezone string   `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var categoryPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Validate normalizes the rule's fields and checks them
+func (r *Rule) Validate() error {
+	if r.Type == "" || r.Type == TypeDomain {
+		r.Type = TypeSuffix
+	}
+	var err error
+	switch r.Type {
+	case TypeExact, TypeSuffix:
+		r.Domain, err = NormalizeDomain(r.Domain)
+	case TypeWildcard:
+		r.Domain, err = NormalizeWildcard(r.Domain)
+	case TypeRegex:
+		r.Domain, err = NormalizeRegex(r.Domain)
+	default:
+		return fmt.Errorf("type must be %q, %q, %q or %q", TypeExact, TypeSuffix, TypeWildcard, TypeRegex)
+	}
+	if err != nil {
+		return err
+	}
+	r.Category = strings.ToLower(strings.TrimSpace(r.Category))
+	if r.Category != "" && !categoryPattern.MatchString(r.Category) {
+		return fmt.Errorf("category %q must be lowercase letters, digits, '-' or '_'", r.Category)
+	}
+	for i, g := range r.Groups {
+		r.Groups[i] = strings.ToLower(strings.TrimSpace(g))
+		if !categoryPattern.MatchString(r.Groups[i]) {
+			return fmt.Errorf("group %q must be lowercase letters, digits, '-' or '_'", g)
+		}
+	}
+	if len(r.Groups) == 0 {
+		r.Groups = nil
+	} else {
+		r.Groups = dedupe(r.Groups)
+	}
+	for _, t := range []*time.Time{r.EffectiveFrom, r.EffectiveUntil} {
+		if t != nil {
+			*t = t.UTC()
+		}
+	}
+	if r.EffectiveFrom != nil && r.EffectiveUntil != nil && !r.EffectiveUntil.After(*r.EffectiveFrom) {
+		return fmt.Errorf("effective_until must be after effective_from")
+	}
+	if r.Schedule != nil {
+		if err := r.Schedule.Validate(); err != nil {
+			return fmt.Errorf("schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+// Active reports whether the rule blocks at t
+func (r Rule) Active(t time.Time) bool {
+	return r.State(t) == StateActive
+}
+
+// State returns the rule's state at t
+func (r Rule) State(t time.Time) string {
+	switch {
+	case r.EffectiveFrom != nil && t.Before(*r.EffectiveFrom):
+		return StateScheduled
+	case r.EffectiveUntil != nil && !t.Before(*r.EffectiveUntil):
+		return StateExpired
+	case r.Schedule != nil && !r.Schedule.Active(t):
+		return StateIdle
+	}
+	return StateActive
+}
+
+// duplicates reports whether two rules block the same hosts for the same
+// devices at the same times; only their labels may differ
+func (r Rule) duplicates(other Rule) bool {
+	return r.Type == other.Type && r.Domain == other.Domain && slices.Equal(r.Groups, other.Groups) &&
+		r.sameWindow(other) && reflect.DeepEqual(r.Schedule, other.Schedule)
+}
+
+// sameWindow reports whether two rules are in effect over the same period
+func (r Rule) sameWindow(other Rule) bool {
+	equal := func(a, b *time.Time) bool { return (a == nil && b == nil) || (a != nil && b != nil && a.Equal(*b)) }
+	return equal(r.EffectiveFrom, other.EffectiveFrom) && equal(r.EffectiveUntil, other.EffectiveUntil)
+}
+
+// Validate normalizes the schedule's fields and checks them
+func (s *Schedule) Validate() error {
+	for i, d := range s.Days {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if len(d) < 3 {
+			return fmt.Errorf("unknown day %q", s.Days[i])
+		}
+		day, ok := weekdays[d[:3]]
+		if !ok || (len(d) > 3 && d != strings.ToLower(day.String())) {
+			return fmt.Errorf("unknown day %q", s.Days[i])
+		}
+		s.Days[i] = d[:3]
+	}
+	if _, err := clock(s.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if _, err := clock(s.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	return nil
+}
+
+// Active reports whether t falls in the window. A window spanning
+// midnight belongs to the day it starts on.
+func (s Schedule) Active(t time.Time) bool {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	start, _ := clock(s.Start)
+	end, _ := clock(s.End)
+	now := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	switch {
+	case start == end:
+		return s.on(today)
+	case start < end:
+		return s.on(today) && now >= start && now < end
+	default:
+		return (s.on(today) && now >= start) || (s.on(yesterday) && now < end)
+	}
+}
+
+// on reports whether the schedule applies on day
+func (s Schedule) on(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if weekdays[d] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// clock parses HH:MM into minutes after midnight
+func clock(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", hhmm)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// NormalizeWildcard lowercases a wildcard pattern and checks it. '*' stands
+// for any run of characters within one label, so *.example.com matches
+// www.example.com but neither example.com nor a.b.example.com.
+func NormalizeWildcard(pattern string) (string, error) {
+	p := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+	if !strings.Contains(p, "*") {
+		return "", fmt.Errorf("wildcard %q has no '*'; use a suffix or exact rule", pattern)
+	}
+	labels := strings.Split(p, ".")
+	if len(labels) < 2 || strings.Contains(labels[len(labels)-1], "*") {
+		return "", fmt.Errorf("wildcard %q must end in a fixed top-level domain", pattern)
+	}
+	// Check the pattern as a host name with each '*' standing for a letter
+	if _, err := NormalizeDomain(strings.ReplaceAll(p, "*", "x")); err != nil {
+		return "", fmt.Errorf("wildcard %q is not a host name pattern", pattern)
+	}
+	return p, nil
+}
+
+// NormalizeRegex checks the pattern of a regex rule, so a mistake is
+// caught before it is published rather than by every proxy. The pattern is
+// in Go (RE2) syntax and must match the whole host name, which is
+// lowercase without a trailing dot: ads[0-9]+\.example\.com matches
+// ads1.example.com but not ads1.example.com.evil.test.
+func NormalizeRegex(pattern string) (string, error) {
+	p := strings.TrimSpace(pattern)
+	if p == "" {
+		return "", fmt.Errorf("regex is empty")
+	}
+	if len(p) > maxRegexLength {
+		return "", fmt.Errorf("regex is longer than %d characters", maxRegexLength)
+	}
+	re, err := hostmatch.Regex(p)
+	var syntaxErr *syntax.Error
+	if errors.As(err, &syntaxErr) {
+		// Not err itself, which quotes the anchored pattern
+		return "", fmt.Errorf("regex %q: %s", pattern, syntaxErr.Code)
+	}
+	if err != nil {
+		return "", fmt.Errorf("regex %q: %v", pattern, err)
+	}
+	// .* and the like would block the whole web
+	if re.MatchString("") {
+		return "", fmt.Errorf("regex %q matches the empty host name, so it matches far too much", pattern)
+	}
+	return p, nil
+}
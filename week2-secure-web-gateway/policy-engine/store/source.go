@@ -0,0 +1,216 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Blocklist formats a source can be in
+const (
+	FormatHosts   = "hosts"   // hosts file: "0.0.0.0 ads.example.com"
+	FormatAdblock = "adblock" // AdBlock Plus domain rules: "||ads.example.com^"
+	FormatDomains = "domains" // one domain per line, as Pi-hole lists are
+	FormatURLs    = "urls"    // one URL per line, as phishing feeds are; the hosts are blocked
+)
+
+// Refresh interval bounds for a source
+const (
+	DefaultRefresh = 24 * time.Hour
+	minRefresh     = 5 * time.Minute
+)
+
+// staleRefreshes is how many refresh intervals a source can go without a
+// successful refresh before it is stale
+const staleRefreshes = 3
+
+// Source health statuses
+const (
+	HealthOK      = "ok"      // the last refresh succeeded
+	HealthFailing = "failing" // the last refresh failed, but the source is not stale yet
+	HealthStale   = "stale"   // no successful refresh for StaleAfter
+	HealthPending = "pending" // not refreshed yet
+)
+
+// maxDiffSample caps the domains a Diff lists by name
+const maxDiffSample = 20
+
+// Source is an external blocklist the policy engine imports. Its domains
+// are blocked alongside the rules and are replaced on every refresh.
+//
+// Threat feeds list only recent indicators, so a source with Expire set
+// keeps blocking a domain that drops off the list until Expire has passed
+// since the domain was last seen in it.
+type Source struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url,omitempty"`  // http or https
+	Path     string   `json:"path,omitempty"` // a file on the policy engine's host
+	Format   string   `json:"format"`
+	Category string   `json:"category,omitempty"` // e.g. malware or phishing, as rules are labelled
+	Refresh  Duration `json:"refresh"`
+	Expire   Duration `json:"expire,omitempty"`
+	Domains  []string `json:"domains"`
+	// LastSeen is when each domain was last in the list, for sources that
+	// expire their domains
+	LastSeen map[string]time.Time `json:"last_seen,omitempty"`
+
+	AddedAt   time.Time `json:"added_at"`
+	CheckedAt time.Time `json:"checked_at"`           // last refresh attempt
+	FetchedAt time.Time `json:"fetched_at"`           // last successful refresh
+	LastError string    `json:"last_error,omitempty"` // why the last refresh failed, if it did
+	Failures  int       `json:"failures,omitempty"`   // refreshes failed in a row
+	LastDiff  *Diff     `json:"last_diff,omitempty"`  // what the last successful refresh changed
+}
+
+// Diff is how a refresh changed a source's domains
+type Diff struct {
+	At      time.Time `json:"at"`
+	Added   int       `json:"added"`
+	Removed int       `json:"removed"`
+	Skipped int       `json:"skipped"` // lines that held no usable domain
+	// The first few added and removed domains
+	AddedSample   []string `json:"added_sample,omitempty"`
+	RemovedSample []string `json:"removed_sample,omitempty"`
+}
+
+// Changed reports whether the refresh added or removed domains
+func (d Diff) Changed() bool { return d.Added > 0 || d.Removed > 0 }
+
+// Duration is a time.Duration written as a string such as "6h" in JSON
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Validate normalizes the source's fields and checks them. The domains
+// are left alone; refreshes set them.
+func (s *Source) Validate() error {
+	s.Name = strings.ToLower(strings.TrimSpace(s.Name))
+	if !categoryPattern.MatchString(s.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits, '-' or '_'", s.Name)
+	}
+	if (s.URL == "") == (s.Path == "") {
+		return fmt.Errorf("exactly one of url and path is required")
+	}
+	if s.URL != "" {
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url %q must be an http or https URL", s.URL)
+		}
+	}
+	switch s.Format {
+	case FormatHosts, FormatAdblock, FormatDomains, FormatURLs:
+	default:
+		return fmt.Errorf("format must be %q, %q, %q or %q", FormatHosts, FormatAdblock, FormatDomains, FormatURLs)
+	}
+	s.Category = strings.ToLower(strings.TrimSpace(s.Category))
+	if s.Category != "" && !categoryPattern.MatchString(s.Category) {
+		return fmt.Errorf("category %q must be lowercase letters, digits, '-' or '_'", s.Category)
+	}
+	if s.Refresh == 0 {
+		s.Refresh = Duration(DefaultRefresh)
+	}
+	if time.Duration(s.Refresh) < minRefresh {
+		return fmt.Errorf("refresh must be at least %s", minRefresh)
+	}
+	// Expiring sooner than the next refresh would unblock domains the
+	// list still holds
+	if s.Expire != 0 && s.Expire < s.Refresh {
+		return fmt.Errorf("expire must be at least the refresh interval, %s", time.Duration(s.Refresh))
+	}
+	if s.Domains == nil {
+		s.Domains = []string{}
+	}
+	return nil
+}
+
+// Due reports whether the source should be refreshed at t: it has never
+// been tried, or its refresh interval has passed since the last attempt
+func (s Source) Due(t time.Time) bool {
+	return s.CheckedAt.IsZero() || !t.Before(s.CheckedAt.Add(time.Duration(s.Refresh)))
+}
+
+// StaleAfter is how long the source can go without a successful refresh
+// before it is stale
+func (s Source) StaleAfter() time.Duration {
+	return staleRefreshes * time.Duration(s.Refresh)
+}
+
+// Health returns the source's health status at t. A source that has never
+// been refreshed successfully goes stale StaleAfter its creation.
+func (s Source) Health(t time.Time) string {
+	since := s.FetchedAt
+	if since.IsZero() {
+		since = s.AddedAt
+	}
+	switch {
+	case t.Sub(since) > s.StaleAfter():
+		return HealthStale
+	case s.LastError != "":
+		return HealthFailing
+	case s.FetchedAt.IsZero():
+		return HealthPending
+	}
+	return HealthOK
+}
+
+// expire returns the domains an expiring source blocks at now: those just
+// fetched, which may be none if the refresh failed, and those seen within
+// the source's expiry. It records when each was last seen.
+func (s *Source) expire(fetched []string, now time.Time) []string {
+	seen := make(map[string]time.Time, len(s.LastSeen)+len(fetched))
+	for d, t := range s.LastSeen {
+		if now.Sub(t) < time.Duration(s.Expire) {
+			seen[d] = t
+		}
+	}
+	for _, d := range fetched {
+		seen[d] = now
+	}
+	domains := make([]string, 0, len(seen))
+	for d := range seen {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	s.LastSeen = seen
+	return domains
+}
+
+// diff compares sorted, deduplicated domain lists
+func diff(old, new []string) Diff {
+	var d Diff
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case j == len(new) || (i < len(old) && old[i] < new[j]):
+			d.Removed++
+			if len(d.RemovedSample) < maxDiffSample {
+				d.RemovedSample = append(d.RemovedSample, old[i])
+			}
+			i++
+		case i == len(old) || new[j] < old[i]:
+			d.Added++
+			if len(d.AddedSample) < maxDiffSample {
+				d.AddedSample = append(d.AddedSample, new[j])
+			}
+			j++
+		default:
+			i, j = i+1, j+1
+		}
+	}
+	return d
+}
@@ -0,0 +1,499 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/sqlstore"
+)
+
+// batchRows caps the rows one INSERT or DELETE statement carries, well
+// under the bound parameter limits of SQLite and PostgreSQL
+const batchRows = 300
+
+// queryTimeout bounds each load or commit
+const queryTimeout = time.Minute
+
+// sqlBackend implements Backend over database/sql. Queries are written with
+// "?" placeholders and rebound for dialects that number them.
+//
+// Rules, categories, groups, sources and flags each have a row, and the domains
+// and devices they list a row each, so a commit writes only what changed
+// rather than the whole policy. The snapshots kept for rollback hold the
+// whole policy as JSON, as the JSON file backend's do.
+type sqlBackend struct {
+	db      *sql.DB
+	dialect string
+	// last is the policy as last loaded or committed, which Commit compares
+	// with to find what changed
+	last Policy
+}
+
+// rebind rewrites "?" placeholders as $1, $2, ... for PostgreSQL
+func (b *sqlBackend) rebind(query string) string {
+	return sqlstore.Rebind(b.dialect, query)
+}
+
+func (b *sqlBackend) Load() (Policy, []Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	var p Policy
+	var updated int64
+	err := b.db.QueryRowContext(ctx, `SELECT version, updated_at, next_id, restored_from FROM policy WHERE id = 1`).
+		Scan(&p.Version, &updated, &p.NextID, &p.RestoredFrom)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Policy{}, nil, ErrNoPolicy
+	}
+	if err != nil {
+		return Policy{}, nil, fmt.Errorf("load policy: %w", err)
+	}
+	p.UpdatedAt = time.Unix(0, updated).UTC()
+
+	p.Rules = []Rule{}
+	err = b.scan(ctx, `SELECT payload FROM rules ORDER BY id`, func(rows *sql.Rows) error {
+		var r Rule
+		if err := scanJSON(rows, &r); err != nil {
+			return err
+		}
+		p.Rules = append(p.Rules, r)
+		return nil
+	})
+	if err != nil {
+		return Policy{}, nil, fmt.Errorf("load rules: %w", err)
+	}
+
+	if p.Categories, err = loadNamed(ctx, b, `SELECT payload FROM categories`, func(c Category) string { return c.Name }); err != nil {
+		return Policy{}, nil, fmt.Errorf("load categories: %w", err)
+	}
+	for i := range p.Categories {
+		p.Categories[i].Domains = []string{}
+	}
+	err = b.scan(ctx, `SELECT category, domain FROM category_domains`, func(rows *sql.Rows) error {
+		var name, domain string
+		if err := rows.Scan(&name, &domain); err != nil {
+			return err
+		}
+		if c := findNamed(p.Categories, name, func(c Category) string { return c.Name }); c != nil {
+			c.Domains = append(c.Domains, domain)
+		}
+		return nil
+	})
+	if err != nil {
+		return Policy{}, nil, fmt.Errorf("load category domains: %w", err)
+	}
+	for _, c := range p.Categories {
+		sort.Strings(c.Domains)
+	}
+
+	if p.Groups, err = loadNamed(ctx, b, `SELECT payload FROM device_groups`, func(g Group) string { return g.Name }); err != nil {
+		return Policy{}, nil, fmt.Errorf("load groups: %w", err)
+	}
+	for i := range p.Groups {
+		p.Groups[i].Devices = []string{}
+	}
+	err = b.scan(ctx, `SELECT group_name, device FROM group_devices`, func(rows *sql.Rows) error {
+		var name, device string
+		if err := rows.Scan(&name, &device); err != nil {
+			return err
+		}
+		if g := findNamed(p.Groups, name, func(g Group) string { return g.Name }); g != nil {
+			g.Devices = append(g.Devices, device)
+		}
+		return nil
+	})
+	if err != nil {
+		return Policy{}, nil, fmt.Errorf("load group devices: %w", err)
+	}
+	for _, g := range p.Groups {
+		sort.Strings(g.Devices)
+	}
+
+	if p.Flags, err = loadNamed(ctx, b, `SELECT payload FROM feature_flags`, func(fl Flag) string { return fl.Name }); err != nil {
+		return Policy{}, nil, fmt.Errorf("load flags: %w", err)
+	}
+
+	if p.Sources, err = loadNamed(ctx, b, `SELECT payload FROM sources`, func(s Source) string { return s.Name }); err != nil {
+		return Policy{}, nil, fmt.Errorf("load sources: %w", err)
+	}
+	for i := range p.Sources {
+		p.Sources[i].Domains = []string{}
+		if p.Sources[i].Expire != 0 {
+			p.Sources[i].LastSeen = make(map[string]time.Time)
+		}
+	}
+	err = b.scan(ctx, `SELECT source, domain, last_seen FROM source_domains`, func(rows *sql.Rows) error {
+		var name, domain string
+		var seen int64
+		if err := rows.Scan(&name, &domain, &seen); err != nil {
+			return err
+		}
+		if s := findNamed(p.Sources, name, func(s Source) string { return s.Name }); s != nil {
+			s.Domains = append(s.Domains, domain)
+			if s.LastSeen != nil && seen != 0 {
+				s.LastSeen[domain] = time.Unix(0, seen).UTC()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Policy{}, nil, fmt.Errorf("load source domains: %w", err)
+	}
+	for _, s := range p.Sources {
+		sort.Strings(s.Domains)
+	}
+
+	var history []Revision
+	err = b.scan(ctx, `SELECT version, updated_at, restored_from, changes FROM revisions ORDER BY version`, func(rows *sql.Rows) error {
+		var r Revision
+		var changes []byte
+		if err := rows.Scan(&r.Version, &updated, &r.RestoredFrom, &changes); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(changes, &r.Changes); err != nil {
+			return fmt.Errorf("revision %d: %w", r.Version, err)
+		}
+		r.UpdatedAt = time.Unix(0, updated).UTC()
+		history = append(history, r)
+		return nil
+	})
+	if err != nil {
+		return Policy{}, nil, fmt.Errorf("load history: %w", err)
+	}
+	b.last = p
+	return p, history, nil
+}
+
+// loadNamed loads the objects whose JSON a query selects, sorted by name
+// as the policy keeps them
+func loadNamed[T any](ctx context.Context, b *sqlBackend, query string, name func(T) string) ([]T, error) {
+	var out []T
+	err := b.scan(ctx, query, func(rows *sql.Rows) error {
+		var v T
+		if err := scanJSON(rows, &v); err != nil {
+			return err
+		}
+		out = append(out, v)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return name(out[i]) < name(out[j]) })
+	return out, err
+}
+
+// findNamed returns the object called name in the sorted list
+func findNamed[T any](list []T, name string, nameOf func(T) string) *T {
+	i := sort.Search(len(list), func(i int) bool { return nameOf(list[i]) >= name })
+	if i < len(list) && nameOf(list[i]) == name {
+		return &list[i]
+	}
+	return nil
+}
+
+// scan calls fn with each row the query returns
+func (b *sqlBackend) scan(ctx context.Context, query string, fn func(*sql.Rows) error, args ...any) error {
+	rows, err := b.db.QueryContext(ctx, b.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scanJSON decodes the row's single JSON column into v
+func scanJSON(rows *sql.Rows, v any) error {
+	var data []byte
+	if err := rows.Scan(&data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Commit writes what changed since the last load or commit, and the
+// revision, in one transaction
+func (b *sqlBackend) Commit(p Policy, rev *Revision, history []Revision) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("save policy: %w", err)
+	}
+	defer tx.Rollback()
+	w := sqlWriter{b: b, tx: tx, ctx: ctx}
+
+	if rev != nil {
+		changes, err := json.Marshal(rev.Changes)
+		if err != nil {
+			return err
+		}
+		snapshot, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		w.exec(`DELETE FROM revisions WHERE version >= ? OR version < ?`, rev.Version, history[0].Version)
+		w.exec(`INSERT INTO revisions (version, updated_at, restored_from, changes, snapshot) VALUES (?, ?, ?, ?, ?)`,
+			rev.Version, rev.UpdatedAt.UnixNano(), rev.RestoredFrom, string(changes), string(snapshot))
+	}
+	w.exec(`INSERT INTO policy (id, version, updated_at, next_id, restored_from) VALUES (1, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET version = excluded.version, updated_at = excluded.updated_at,
+		next_id = excluded.next_id, restored_from = excluded.restored_from`,
+		p.Version, p.UpdatedAt.UnixNano(), p.NextID, p.RestoredFrom)
+	w.rules(b.last.Rules, p.Rules)
+	w.categories(b.last.Categories, p.Categories)
+	w.groups(b.last.Groups, p.Groups)
+	w.sources(b.last.Sources, p.Sources)
+	w.flags(b.last.Flags, p.Flags)
+	if w.err != nil {
+		return fmt.Errorf("save policy: %w", w.err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save policy: %w", err)
+	}
+	b.last = p
+	return nil
+}
+
+func (b *sqlBackend) Snapshot(version int64) (Policy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	var data []byte
+	err := b.db.QueryRowContext(ctx, b.rebind(`SELECT snapshot FROM revisions WHERE version = ?`), version).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Policy{}, ErrVersionNotFound
+	}
+	if err != nil {
+		return Policy{}, fmt.Errorf("read snapshot: %w", err)
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Policy{}, fmt.Errorf("parse snapshot v%d: %w", version, err)
+	}
+	return p, nil
+}
+
+func (b *sqlBackend) Close() error {
+	return b.db.Close()
+}
+
+// sqlWriter writes changes within a transaction, keeping the first error
+// so a commit can make its writes in a row and check once
+type sqlWriter struct {
+	b   *sqlBackend
+	tx  *sql.Tx
+	ctx context.Context
+	err error
+}
+
+func (w *sqlWriter) exec(query string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.tx.ExecContext(w.ctx, w.b.rebind(query), args...)
+}
+
+// insert inserts rows of values for columns, batchRows at a time. suffix
+// follows the values, e.g. an ON CONFLICT clause.
+func (w *sqlWriter) insert(table, columns, suffix string, rows [][]any) {
+	for len(rows) > 0 && w.err == nil {
+		batch := rows[:min(len(rows), batchRows)]
+		rows = rows[len(batch):]
+		placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(batch[0])), ", ") + ")"
+		values := make([]string, len(batch))
+		var args []any
+		for i, row := range batch {
+			values[i] = placeholders
+			args = append(args, row...)
+		}
+		w.exec(`INSERT INTO `+table+` (`+columns+`) VALUES `+strings.Join(values, ", ")+` `+suffix, args...)
+	}
+}
+
+// deleteKeys deletes the rows of table whose column is one of keys, and
+// whose parent column is parent if it is not empty
+func (w *sqlWriter) deleteKeys(table, parentColumn, parent, column string, keys []any) {
+	for len(keys) > 0 && w.err == nil {
+		batch := keys[:min(len(keys), batchRows)]
+		keys = keys[len(batch):]
+		var args []any
+		where := ""
+		if parentColumn != "" {
+			where, args = parentColumn+` = ? AND `, append(args, parent)
+		}
+		args = append(args, batch...)
+		w.exec(`DELETE FROM `+table+` WHERE `+where+column+` IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")+`)`, args...)
+	}
+}
+
+// payload returns v's JSON for a payload column
+func (w *sqlWriter) payload(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return string(data)
+}
+
+func (w *sqlWriter) rules(last, next []Rule) {
+	before := make(map[int64]Rule, len(last))
+	for _, r := range last {
+		before[r.ID] = r
+	}
+	var rows [][]any
+	for _, r := range next {
+		if old, ok := before[r.ID]; !ok || !reflect.DeepEqual(old, r) {
+			rows = append(rows, []any{r.ID, r.Type, r.Domain, r.Category, w.payload(r)})
+		}
+		delete(before, r.ID)
+	}
+	var removed []any
+	for id := range before {
+		removed = append(removed, id)
+	}
+	w.deleteKeys("rules", "", "", "id", removed)
+	w.insert("rules", "id, type, domain, category, payload", `ON CONFLICT (id) DO UPDATE SET
+		type = excluded.type, domain = excluded.domain, category = excluded.category, payload = excluded.payload`, rows)
+}
+
+func (w *sqlWriter) categories(last, next []Category) {
+	changed, removed := diffNamed(last, next, func(c Category) string { return c.Name })
+	w.deleteKeys("categories", "", "", "name", anys(removed))
+	for _, c := range changed {
+		var old []string
+		if o := findNamed(last, c.Name, func(c Category) string { return c.Name }); o != nil {
+			old = o.Domains
+		}
+		row := c
+		row.Domains = nil
+		w.exec(`INSERT INTO categories (name, action, payload) VALUES (?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET action = excluded.action, payload = excluded.payload`, c.Name, c.Action, w.payload(row))
+		w.list("category_domains", "category", "domain", c.Name, old, c.Domains)
+	}
+}
+
+func (w *sqlWriter) groups(last, next []Group) {
+	changed, removed := diffNamed(last, next, func(g Group) string { return g.Name })
+	w.deleteKeys("device_groups", "", "", "name", anys(removed))
+	for _, g := range changed {
+		var old []string
+		if o := findNamed(last, g.Name, func(g Group) string { return g.Name }); o != nil {
+			old = o.Devices
+		}
+		row := g
+		row.Devices = nil
+		w.exec(`INSERT INTO device_groups (name, payload) VALUES (?, ?)
+			ON CONFLICT (name) DO UPDATE SET payload = excluded.payload`, g.Name, w.payload(row))
+		w.list("group_devices", "group_name", "device", g.Name, old, g.Devices)
+	}
+}
+
+func (w *sqlWriter) flags(last, next []Flag) {
+	changed, removed := diffNamed(last, next, func(fl Flag) string { return fl.Name })
+	w.deleteKeys("feature_flags", "", "", "name", anys(removed))
+	for _, fl := range changed {
+		w.exec(`INSERT INTO feature_flags (name, payload) VALUES (?, ?)
+			ON CONFLICT (name) DO UPDATE SET payload = excluded.payload`, fl.Name, w.payload(fl))
+	}
+}
+
+func (w *sqlWriter) sources(last, next []Source) {
+	changed, removed := diffNamed(last, next, func(s Source) string { return s.Name })
+	w.deleteKeys("sources", "", "", "name", anys(removed))
+	for _, s := range changed {
+		var old Source
+		if o := findNamed(last, s.Name, func(s Source) string { return s.Name }); o != nil {
+			old = *o
+		}
+		row := s
+		row.Domains, row.LastSeen = nil, nil
+		w.exec(`INSERT INTO sources (name, payload) VALUES (?, ?)
+			ON CONFLICT (name) DO UPDATE SET payload = excluded.payload`, s.Name, w.payload(row))
+
+		added, gone := diffSorted(old.Domains, s.Domains)
+		w.deleteKeys("source_domains", "source", s.Name, "domain", anys(gone))
+		// Domains still listed are written again if they were seen since
+		var rows [][]any
+		for _, d := range s.Domains {
+			seen, ok := s.LastSeen[d]
+			if added[d] || (ok && !seen.Equal(old.LastSeen[d])) {
+				var at int64
+				if ok {
+					at = seen.UnixNano()
+				}
+				rows = append(rows, []any{s.Name, d, at})
+			}
+		}
+		w.insert("source_domains", "source, domain, last_seen", `ON CONFLICT (source, domain) DO UPDATE SET last_seen = excluded.last_seen`, rows)
+	}
+}
+
+// list brings the rows of a category's domains or a group's devices from
+// old to next
+func (w *sqlWriter) list(table, parentColumn, column, parent string, old, next []string) {
+	added, gone := diffSorted(old, next)
+	w.deleteKeys(table, parentColumn, parent, column, anys(gone))
+	var rows [][]any
+	for _, v := range next {
+		if added[v] {
+			rows = append(rows, []any{parent, v})
+		}
+	}
+	w.insert(table, parentColumn+", "+column, "", rows)
+}
+
+// diffNamed returns the objects of next that are new or changed since last,
+// and the names of those last had that next doesn't
+func diffNamed[T any](last, next []T, name func(T) string) (changed []T, removed []string) {
+	before := make(map[string]T, len(last))
+	for _, v := range last {
+		before[name(v)] = v
+	}
+	for _, v := range next {
+		if old, ok := before[name(v)]; !ok || !reflect.DeepEqual(old, v) {
+			changed = append(changed, v)
+		}
+		delete(before, name(v))
+	}
+	for n := range before {
+		removed = append(removed, n)
+	}
+	return changed, removed
+}
+
+// diffSorted compares sorted, deduplicated lists, returning the values
+// next added and those it dropped
+func diffSorted(old, next []string) (added map[string]bool, removed []string) {
+	added = make(map[string]bool)
+	i, j := 0, 0
+	for i < len(old) || j < len(next) {
+		switch {
+		case j == len(next) || (i < len(old) && old[i] < next[j]):
+			removed = append(removed, old[i])
+			i++
+		case i == len(old) || next[j] < old[i]:
+			added[next[j]] = true
+			j++
+		default:
+			i, j = i+1, j+1
+		}
+	}
+	return added, removed
+}
+
+// anys returns the strings as query arguments
+func anys(values []string) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
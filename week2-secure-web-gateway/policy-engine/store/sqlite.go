@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nisatyap/shared/sqlstore"
+)
+
+// OpenSQLite opens (creating if needed) the database at path and applies
+// pending migrations
+func OpenSQLite(ctx context.Context, path string) (Backend, error) {
+	steps, err := migrations(sqlstore.SQLite)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sqlstore.OpenSQLite(ctx, path, steps)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlBackend{db: db, dialect: sqlstore.SQLite}, nil
+}
@@ -0,0 +1,685 @@
+// Package store keeps the gateway policy in a JSON file or a database, so
+// block rules and categories survive restarts of the policy engine
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by the store
+var (
+	ErrExists           = errors.New("an identical rule already exists")
+	ErrNotFound         = errors.New("rule not found")
+	ErrCategoryExists   = errors.New("category already exists")
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrSourceExists     = errors.New("source already exists")
+	ErrSourceNotFound   = errors.New("source not found")
+	ErrGroupExists      = errors.New("group already exists")
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrGroupInUse       = errors.New("group is still used by rules")
+	ErrDeviceAssigned   = errors.New("device is already in another group")
+	ErrFlagNotFound     = errors.New("flag not found")
+)
+
+// DefaultBlocklist seeds a new policy file
+var DefaultBlocklist = []string{
+	"facebook.com",
+	"tiktok.com",
+	"twitter.com",
+	"instagram.com",
+	"reddit.com",
+	"youtube.com",
+	"gambling.com",
+	"bet365.com",
+	"pokerstars.com",
+}
+
+// Policy is the stored policy document. Version goes up by one with every
+// change, so a proxy can tell whether the blocklist it holds is current.
+type Policy struct {
+	Version   int64     `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+	NextID    int64     `json:"next_id"`
+	Rules     []Rule    `json:"rules"`
+	// Categories, Sources, Groups and Flags are sorted by name
+	Categories []Category `json:"categories"`
+	Sources    []Source   `json:"sources"`
+	Groups     []Group    `json:"groups"`
+	Flags      []Flag     `json:"flags,omitempty"`
+	// RestoredFrom is the version a rollback restored to make this one
+	RestoredFrom int64 `json:"restored_from,omitempty"`
+	// regexes are the regex rules' compiled patterns, set when the policy
+	// is published and shared, unchanged, by its copies
+	regexes map[string]*regexp.Regexp
+}
+
+// Domains returns the domains of the suffix rules, sorted, whether or not
+// their schedules are active
+func (p Policy) Domains() []string {
+	var domains []string
+	for _, r := range p.Rules {
+		if r.Type == TypeSuffix {
+			domains = append(domains, r.Domain)
+		}
+	}
+	return dedupe(domains)
+}
+
+// Blocklist is what a policy blocks for some devices at some time, by
+// type of entry, each list sorted
+type Blocklist struct {
+	Domains   []string // suffix rules and the sources' domains
+	Exact     []string
+	Wildcards []string
+	Regexes   []string
+}
+
+// Len returns the number of entries
+func (b Blocklist) Len() int {
+	return len(b.Domains) + len(b.Exact) + len(b.Wildcards) + len(b.Regexes)
+}
+
+// Blocked returns what the active rules and the imported sources block at
+// t for the devices of group. An empty group gets only the rules that
+// apply to everyone.
+func (p Policy) Blocked(t time.Time, group string) Blocklist {
+	var b Blocklist
+	for _, s := range p.Sources {
+		b.Domains = append(b.Domains, s.Domains...)
+	}
+	for _, r := range p.Rules {
+		if !r.Active(t) || !appliesTo(r.Groups, group) {
+			continue
+		}
+		switch r.Type {
+		case TypeExact:
+			b.Exact = append(b.Exact, r.Domain)
+		case TypeWildcard:
+			b.Wildcards = append(b.Wildcards, r.Domain)
+		case TypeRegex:
+			b.Regexes = append(b.Regexes, r.Domain)
+		default:
+			b.Domains = append(b.Domains, r.Domain)
+		}
+	}
+	return Blocklist{Domains: dedupe(b.Domains), Exact: dedupe(b.Exact), Wildcards: dedupe(b.Wildcards), Regexes: dedupe(b.Regexes)}
+}
+
+// Category returns the category called name
+func (p Policy) Category(name string) (Category, bool) {
+	i := sort.Search(len(p.Categories), func(i int) bool { return p.Categories[i].Name >= name })
+	if i < len(p.Categories) && p.Categories[i].Name == name {
+		return p.Categories[i], true
+	}
+	return Category{}, false
+}
+
+// Group returns the group called name
+func (p Policy) Group(name string) (Group, bool) {
+	i := sort.Search(len(p.Groups), func(i int) bool { return p.Groups[i].Name >= name })
+	if i < len(p.Groups) && p.Groups[i].Name == name {
+		return p.Groups[i], true
+	}
+	return Group{}, false
+}
+
+// DeviceGroup returns the name of the group device is in
+func (p Policy) DeviceGroup(device string) (string, bool) {
+	for _, g := range p.Groups {
+		if _, found := slices.BinarySearch(g.Devices, device); found {
+			return g.Name, true
+		}
+	}
+	return "", false
+}
+
+// Source returns the source called name
+func (p Policy) Source(name string) (Source, bool) {
+	i := sort.Search(len(p.Sources), func(i int) bool { return p.Sources[i].Name >= name })
+	if i < len(p.Sources) && p.Sources[i].Name == name {
+		return p.Sources[i], true
+	}
+	return Source{}, false
+}
+
+// dedupe sorts values and drops repeats, returning an empty, not nil,
+// slice for none
+func dedupe(values []string) []string {
+	sort.Strings(values)
+	out := []string{}
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// File is the policy engine's copy of the policy, kept in a Backend.
+// Every change is committed to the backend before it is visible, so a
+// crash never loses an acknowledged change. Every version is also kept, up
+// to a limit, for rollback.
+type File struct {
+	backend Backend
+	now     func() time.Time
+
+	mu           sync.RWMutex
+	policy       Policy
+	history      []Revision // oldest first
+	historyLimit int
+	// changed is closed, and replaced, when the version changes
+	changed chan struct{}
+}
+
+// Open loads the policy file at path. A missing file starts a new policy
+// with the seed domains, which is written out straight away.
+func Open(path string, seed []string) (*File, error) {
+	return OpenBackend(NewJSONFile(path), seed)
+}
+
+// OpenBackend loads the policy kept in b. If b holds none, a new policy
+// with the seed domains is committed to it straight away.
+func OpenBackend(b Backend, seed []string) (*File, error) {
+	f := &File{backend: b, now: time.Now, historyLimit: DefaultHistory, changed: make(chan struct{})}
+	p, history, err := b.Load()
+	switch {
+	case err == nil:
+		f.policy, f.history = p, history
+		f.upgrade()
+		f.policy.compileRegexes()
+		if err := f.startHistory(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case !errors.Is(err, ErrNoPolicy):
+		return nil, err
+	}
+
+	now := f.now().UTC()
+	f.policy = Policy{Version: 1, UpdatedAt: now, NextID: 1, Rules: []Rule{}}
+	for _, domain := range seed {
+		domain, err := NormalizeDomain(domain)
+		if err != nil {
+			return nil, err
+		}
+		f.policy.Rules = append(f.policy.Rules, Rule{ID: f.policy.NextID, Type: TypeSuffix, Domain: domain, AddedAt: now, UpdatedAt: now})
+		f.policy.NextID++
+	}
+	f.policy.compileRegexes()
+	if err := f.startHistory(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close closes the backend
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.backend.Close()
+}
+
+// upgrade fills in what files written before rules had IDs and types lack
+func (f *File) upgrade() {
+	if f.policy.NextID == 0 {
+		f.policy.NextID = 1
+	}
+	upgradeTypes(f.policy.Rules)
+	for i := range f.policy.Rules {
+		r := &f.policy.Rules[i]
+		if r.UpdatedAt.IsZero() {
+			r.UpdatedAt = r.AddedAt
+		}
+		if r.ID == 0 {
+			r.ID = f.policy.NextID
+			f.policy.NextID++
+		}
+		f.policy.NextID = max(f.policy.NextID, r.ID+1)
+	}
+}
+
+// upgradeTypes gives rules stored without a type, or as domain rules, the
+// type they have now
+func upgradeTypes(rules []Rule) {
+	for i := range rules {
+		if rules[i].Type == "" || rules[i].Type == TypeDomain {
+			rules[i].Type = TypeSuffix
+		}
+	}
+}
+
+// Policy returns the current policy
+func (f *File) Policy() Policy {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	p := f.policy
+	p.Rules = append([]Rule(nil), f.policy.Rules...)
+	p.Categories = append([]Category(nil), f.policy.Categories...)
+	p.Sources = append([]Source(nil), f.policy.Sources...)
+	p.Groups = append([]Group(nil), f.policy.Groups...)
+	p.Flags = append([]Flag(nil), f.policy.Flags...)
+	return p
+}
+
+// GetRule returns the rule with the given ID
+func (f *File) GetRule(id int64) (Rule, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if i := f.find(id); i >= 0 {
+		return f.policy.Rules[i], nil
+	}
+	return Rule{}, ErrNotFound
+}
+
+// CreateRule adds a validated rule, assigning its ID and timestamps
+func (f *File) CreateRule(r Rule) (Rule, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkGroups(r); err != nil {
+		return Rule{}, f.policy, err
+	}
+	if f.duplicate(r, 0) {
+		return Rule{}, f.policy, ErrExists
+	}
+	now := f.now().UTC()
+	next := f.next(now)
+	r.ID, r.AddedAt, r.UpdatedAt = next.NextID, now, now
+	next.NextID++
+	next.Rules = append(next.Rules, r)
+	p, err := f.commit(next)
+	return r, p, err
+}
+
+// UpdateRule replaces the rule with r's ID by the validated rule r
+func (f *File) UpdateRule(r Rule) (Rule, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.find(r.ID)
+	if i < 0 {
+		return Rule{}, f.policy, ErrNotFound
+	}
+	if err := f.checkGroups(r); err != nil {
+		return Rule{}, f.policy, err
+	}
+	if f.duplicate(r, r.ID) {
+		return Rule{}, f.policy, ErrExists
+	}
+	now := f.now().UTC()
+	next := f.next(now)
+	r.AddedAt, r.UpdatedAt = f.policy.Rules[i].AddedAt, now
+	next.Rules[i] = r
+	p, err := f.commit(next)
+	return r, p, err
+}
+
+// DeleteRule removes the rule with the given ID
+func (f *File) DeleteRule(id int64) (Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.find(id)
+	if i < 0 {
+		return f.policy, ErrNotFound
+	}
+	next := f.next(f.now().UTC())
+	next.Rules = append(next.Rules[:i], next.Rules[i+1:]...)
+	return f.commit(next)
+}
+
+// CreateCategory adds a validated category
+func (f *File) CreateCategory(c Category) (Category, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.policy.Category(c.Name); ok {
+		return Category{}, f.policy, ErrCategoryExists
+	}
+	now := f.now().UTC()
+	next := f.next(now)
+	c.AddedAt, c.UpdatedAt = now, now
+	next.Categories = append(next.Categories, c)
+	sort.Slice(next.Categories, func(i, j int) bool { return next.Categories[i].Name < next.Categories[j].Name })
+	p, err := f.commit(next)
+	return c, p, err
+}
+
+// UpdateCategory changes the category called name with update, which
+// gets a copy to modify and must leave it valid. An error from update
+// leaves the category as it was and is returned as is.
+func (f *File) UpdateCategory(name string, update func(c *Category) error) (Category, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.policy.Category(name)
+	if !ok {
+		return Category{}, f.policy, ErrCategoryNotFound
+	}
+	c.Domains = append([]string(nil), c.Domains...)
+	if err := update(&c); err != nil {
+		return Category{}, f.policy, err
+	}
+	c.Name = name
+	now := f.now().UTC()
+	next := f.next(now)
+	c.UpdatedAt = now
+	for i := range next.Categories {
+		if next.Categories[i].Name == name {
+			next.Categories[i] = c
+		}
+	}
+	p, err := f.commit(next)
+	return c, p, err
+}
+
+// DeleteCategory removes the category called name. Rules labelled with
+// it keep their label.
+func (f *File) DeleteCategory(name string) (Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.policy.Category(name); !ok {
+		return f.policy, ErrCategoryNotFound
+	}
+	next := f.next(f.now().UTC())
+	next.Categories = next.Categories[:0]
+	for _, c := range f.policy.Categories {
+		if c.Name != name {
+			next.Categories = append(next.Categories, c)
+		}
+	}
+	return f.commit(next)
+}
+
+// CreateGroup adds a validated group
+func (f *File) CreateGroup(g Group) (Group, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.policy.Group(g.Name); ok {
+		return Group{}, f.policy, ErrGroupExists
+	}
+	if err := f.checkDevices(g); err != nil {
+		return Group{}, f.policy, err
+	}
+	now := f.now().UTC()
+	next := f.next(now)
+	g.AddedAt, g.UpdatedAt = now, now
+	next.Groups = append(next.Groups, g)
+	sort.Slice(next.Groups, func(i, j int) bool { return next.Groups[i].Name < next.Groups[j].Name })
+	p, err := f.commit(next)
+	return g, p, err
+}
+
+// UpdateGroup changes the group called name with update, which gets a
+// copy to modify and must leave it valid. An error from update leaves the
+// group as it was and is returned as is.
+func (f *File) UpdateGroup(name string, update func(g *Group) error) (Group, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	g, ok := f.policy.Group(name)
+	if !ok {
+		return Group{}, f.policy, ErrGroupNotFound
+	}
+	g.Devices = append([]string(nil), g.Devices...)
+	if err := update(&g); err != nil {
+		return Group{}, f.policy, err
+	}
+	g.Name = name
+	if err := f.checkDevices(g); err != nil {
+		return Group{}, f.policy, err
+	}
+	now := f.now().UTC()
+	next := f.next(now)
+	g.UpdatedAt = now
+	for i := range next.Groups {
+		if next.Groups[i].Name == name {
+			next.Groups[i] = g
+		}
+	}
+	p, err := f.commit(next)
+	return g, p, err
+}
+
+// DeleteGroup removes the group called name, which no rule may be scoped
+// to: dropping the group from a rule scoped only to it would apply the
+// rule to everyone.
+func (f *File) DeleteGroup(name string) (Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.policy.Group(name); !ok {
+		return f.policy, ErrGroupNotFound
+	}
+	for _, r := range f.policy.Rules {
+		if slices.Contains(r.Groups, name) {
+			return f.policy, fmt.Errorf("%w, e.g. rule %d", ErrGroupInUse, r.ID)
+		}
+	}
+	next := f.next(f.now().UTC())
+	next.Groups = next.Groups[:0]
+	for _, g := range f.policy.Groups {
+		if g.Name != name {
+			next.Groups = append(next.Groups, g)
+		}
+	}
+	return f.commit(next)
+}
+
+// checkGroups checks that the groups r is scoped to exist
+func (f *File) checkGroups(r Rule) error {
+	for _, g := range r.Groups {
+		if _, ok := f.policy.Group(g); !ok {
+			return fmt.Errorf("%w: %s", ErrGroupNotFound, g)
+		}
+	}
+	return nil
+}
+
+// checkDevices checks that none of g's devices is in another group
+func (f *File) checkDevices(g Group) error {
+	for _, other := range f.policy.Groups {
+		if other.Name == g.Name {
+			continue
+		}
+		for _, d := range g.Devices {
+			if _, found := slices.BinarySearch(other.Devices, d); found {
+				return fmt.Errorf("%w: %s is in %s", ErrDeviceAssigned, d, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateSource adds a validated source, which blocks nothing until its
+// first refresh
+func (f *File) CreateSource(s Source) (Source, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.policy.Source(s.Name); ok {
+		return Source{}, f.policy, ErrSourceExists
+	}
+	now := f.now().UTC()
+	next := f.next(now)
+	s.AddedAt = now
+	next.Sources = append(next.Sources, s)
+	sort.Slice(next.Sources, func(i, j int) bool { return next.Sources[i].Name < next.Sources[j].Name })
+	p, err := f.commit(next)
+	return s, p, err
+}
+
+// RecordRefresh stores the outcome of refreshing the source called name:
+// its new domains, sorted and deduplicated, and the number of lines
+// skipped, or the error that stopped the refresh, which keeps the domains
+// it had. A source that expires its domains keeps those it has seen
+// recently either way, and drops the rest. The policy version only goes
+// up if the domains changed.
+func (f *File) RecordRefresh(name string, domains []string, skipped int, refreshErr error) (Source, Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := sort.Search(len(f.policy.Sources), func(i int) bool { return f.policy.Sources[i].Name >= name })
+	if i == len(f.policy.Sources) || f.policy.Sources[i].Name != name {
+		return Source{}, f.policy, ErrSourceNotFound
+	}
+	now := f.now().UTC()
+	next := f.next(now)
+	s := next.Sources[i]
+	s.CheckedAt = now
+	changed := false
+	if s.Expire != 0 {
+		if refreshErr != nil {
+			domains = nil
+		}
+		domains = s.expire(domains, now)
+	}
+	if refreshErr != nil {
+		s.LastError = refreshErr.Error()
+		s.Failures++
+		if s.Expire != 0 {
+			changed = len(domains) != len(s.Domains)
+			s.Domains = domains
+		}
+	} else {
+		d := diff(s.Domains, domains)
+		d.At, d.Skipped = now, skipped
+		s.Domains, s.FetchedAt, s.LastError, s.Failures, s.LastDiff = domains, now, "", 0, &d
+		changed = d.Changed()
+	}
+	if !changed {
+		next.Version, next.UpdatedAt = f.policy.Version, f.policy.UpdatedAt
+	}
+	next.Sources[i] = s
+	p, err := f.commit(next)
+	return s, p, err
+}
+
+// DeleteSource removes the source called name and the domains it blocks
+func (f *File) DeleteSource(name string) (Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.policy.Source(name); !ok {
+		return f.policy, ErrSourceNotFound
+	}
+	next := f.next(f.now().UTC())
+	next.Sources = next.Sources[:0]
+	for _, s := range f.policy.Sources {
+		if s.Name != name {
+			next.Sources = append(next.Sources, s)
+		}
+	}
+	return f.commit(next)
+}
+
+// AddDomain blocks domain, which must already be normalized, at all times
+func (f *File) AddDomain(domain string) (Policy, error) {
+	_, p, err := f.CreateRule(Rule{Type: TypeSuffix, Domain: domain})
+	return p, err
+}
+
+// RemoveDomain deletes every suffix rule for domain, scheduled or not
+func (f *File) RemoveDomain(domain string) (Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next := f.next(f.now().UTC())
+	next.Rules = next.Rules[:0]
+	for _, r := range f.policy.Rules {
+		if r.Type != TypeSuffix || r.Domain != domain {
+			next.Rules = append(next.Rules, r)
+		}
+	}
+	if len(next.Rules) == len(f.policy.Rules) {
+		return f.policy, ErrNotFound
+	}
+	return f.commit(next)
+}
+
+// find returns the index of the rule with the given ID, or -1
+func (f *File) find(id int64) int {
+	for i, r := range f.policy.Rules {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// duplicate reports whether a rule other than except blocks the same
+// target for the same groups, over the same period and on the same
+// schedule as r
+func (f *File) duplicate(r Rule, except int64) bool {
+	for _, other := range f.policy.Rules {
+		if other.ID != except && other.duplicates(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// next starts the policy's next version from a copy of the current one
+func (f *File) next(now time.Time) Policy {
+	return Policy{
+		Version:    f.policy.Version + 1,
+		UpdatedAt:  now,
+		NextID:     f.policy.NextID,
+		Rules:      append([]Rule(nil), f.policy.Rules...),
+		Categories: append([]Category(nil), f.policy.Categories...),
+		Sources:    append([]Source(nil), f.policy.Sources...),
+		Groups:     append([]Group(nil), f.policy.Groups...),
+		Flags:      append([]Flag(nil), f.policy.Flags...),
+	}
+}
+
+// commit commits next to the backend and makes it the current policy,
+// recording it in the history if it is a new version
+func (f *File) commit(next Policy) (Policy, error) {
+	next.compileRegexes()
+	if next.Version == f.policy.Version {
+		if err := f.backend.Commit(next, nil, nil); err != nil {
+			return f.policy, err
+		}
+		f.policy = next
+		return next, nil
+	}
+	rev := Revision{Version: next.Version, UpdatedAt: next.UpdatedAt, RestoredFrom: next.RestoredFrom, Changes: Compare(f.policy, next)}
+	if err := f.record(rev, next); err != nil {
+		return f.policy, err
+	}
+	f.policy = next
+	close(f.changed)
+	f.changed = make(chan struct{})
+	return next, nil
+}
+
+// Watch returns the current version and a channel that is closed when the
+// version changes from it
+func (f *File) Watch() (int64, <-chan struct{}) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.policy.Version, f.changed
+}
+
+// NormalizeDomain lowercases domain and checks that it is a valid host
+// name, e.g. "WWW.Example.COM." -> "www.example.com"
+func NormalizeDomain(domain string) (string, error) {
+	d := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if d == "" {
+		return "", errors.New("domain is required")
+	}
+	if len(d) > 253 {
+		return "", fmt.Errorf("domain %q is longer than 253 characters", domain)
+	}
+	for _, label := range strings.Split(d, ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("domain %q has an empty or over-long label", domain)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("domain %q has a label starting or ending with '-'", domain)
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return "", fmt.Errorf("domain %q may only contain letters, digits, '-' and '.'", domain)
+			}
+		}
+	}
+	return d, nil
+}
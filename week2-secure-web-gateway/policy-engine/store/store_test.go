@@ -0,0 +1,780 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/shared/flags"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	f, err := Open(path, []string{"b.example", "A.example."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := f.Policy(); p.Version != 1 || !reflect.DeepEqual(p.Domains(), []string{"a.example", "b.example"}) {
+		t.Fatalf("seeded policy = %+v", p)
+	}
+
+	if _, err := f.AddDomain("a.example"); !errors.Is(err, ErrExists) {
+		t.Errorf("adding a blocked domain: %v", err)
+	}
+	if p, err := f.AddDomain("c.example"); err != nil || p.Version != 2 {
+		t.Fatalf("AddDomain = v%d, %v", p.Version, err)
+	}
+	if _, err := f.RemoveDomain("missing.example"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removing an unblocked domain: %v", err)
+	}
+	if p, err := f.RemoveDomain("b.example"); err != nil || p.Version != 3 {
+		t.Fatalf("RemoveDomain = v%d, %v", p.Version, err)
+	}
+
+	// Changes survive a restart, and the seed only applies to a new file
+	f, err = Open(path, []string{"ignored.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := f.Policy(); p.Version != 3 || !reflect.DeepEqual(p.Domains(), []string{"a.example", "c.example"}) {
+		t.Errorf("reopened policy = %+v", p)
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	for in, want := range map[string]string{
+		"Example.COM":        "example.com",
+		" www.example.com. ": "www.example.com",
+		"xn--bcher-kva.ch":   "xn--bcher-kva.ch",
+		"localhost":          "localhost",
+	} {
+		if got, err := NormalizeDomain(in); err != nil || got != want {
+			t.Errorf("NormalizeDomain(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "http://example.com", "example..com", "-example.com", "exa mple.com", "*.example.com"} {
+		if got, err := NormalizeDomain(in); err == nil {
+			t.Errorf("NormalizeDomain(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestUpgradeLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	legacy := `{"version":4,"updated_at":"2026-01-01T00:00:00Z","rules":[{"domain":"a.example","added_at":"2026-01-01T00:00:00Z"},` +
+		`{"id":7,"type":"domain","domain":"c.example","added_at":"2026-01-01T00:00:00Z"}]}`
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, p, err := f.CreateRule(Rule{Type: TypeSuffix, Domain: "b.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Policy().Rules[0]; got.ID != 1 || got.Type != TypeSuffix || got.UpdatedAt.IsZero() {
+		t.Errorf("upgraded rule = %+v", got)
+	}
+	if got := f.Policy().Rules[1]; got.ID != 7 || got.Type != TypeSuffix {
+		t.Errorf("upgraded domain rule = %+v", got)
+	}
+	if r.ID != 8 || p.Version != 5 {
+		t.Errorf("rule created after upgrade = %+v in v%d", r, p.Version)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 30, 0, 0, time.UTC) } // 2 March 2026 is a Monday
+	business := Schedule{Days: []string{"Monday", "fri"}, Start: "09:00", End: "17:00"}
+	overnight := Schedule{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+	tokyo := Schedule{Start: "09:00", End: "10:00", Timezone: "Asia/Tokyo"}
+	for _, s := range []*Schedule{&business, &overnight, &tokyo} {
+		if err := s.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		s    Schedule
+		t    time.Time
+		want bool
+	}{
+		{business, at(2, 9), true},
+		{business, at(2, 17), false},
+		{business, at(3, 10), false},
+		{overnight, at(6, 23), true},
+		{overnight, at(7, 5), true}, // Saturday morning, still Friday's window
+		{overnight, at(7, 23), false},
+		{tokyo, at(2, 0), true}, // 09:30 in Tokyo
+		{tokyo, at(2, 9), false},
+	} {
+		if got := c.s.Active(c.t); got != c.want {
+			t.Errorf("%+v at %s = %v, want %v", c.s, c.t, got, c.want)
+		}
+	}
+	for _, bad := range []Schedule{
+		{Start: "25:00", End: "06:00"},
+		{Days: []string{"mo"}, Start: "09:00", End: "10:00"},
+		{Days: []string{"monkey"}, Start: "09:00", End: "10:00"},
+		{Start: "09:00", End: "10:00", Timezone: "Mars/Olympus"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%+v validated", bad)
+		}
+	}
+}
+
+func TestNormalizeWildcard(t *testing.T) {
+	if got, err := NormalizeWildcard("*.Example.COM"); err != nil || got != "*.example.com" {
+		t.Errorf("NormalizeWildcard = %q, %v", got, err)
+	}
+	for _, in := range []string{"example.com", "*", "example.*", "*..example.com", "* .example.com"} {
+		if got, err := NormalizeWildcard(in); err == nil {
+			t.Errorf("NormalizeWildcard(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestCategories(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	f, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	social := Category{Name: "Social", Domains: []string{"tiktok.com", "Facebook.com", "tiktok.com"}}
+	if err := social.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if social.Name != "social" || social.Action != ActionBlock || !reflect.DeepEqual(social.Domains, []string{"facebook.com", "tiktok.com"}) {
+		t.Errorf("validated category = %+v", social)
+	}
+	if _, _, err := f.CreateCategory(social); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateCategory(Category{Name: "news", Action: ActionAllow, Domains: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateCategory(social); !errors.Is(err, ErrCategoryExists) {
+		t.Errorf("creating a category twice: %v", err)
+	}
+	c, p, err := f.UpdateCategory("social", func(c *Category) error {
+		c.Domains = append(c.Domains, "instagram.com")
+		return c.Validate()
+	})
+	if err != nil || len(c.Domains) != 3 || p.Version != 4 {
+		t.Fatalf("UpdateCategory = %+v in v%d, %v", c, p.Version, err)
+	}
+	if _, _, err := f.UpdateCategory("missing", func(*Category) error { return nil }); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("updating a missing category: %v", err)
+	}
+
+	// Categories survive a restart, in name order
+	f, err = Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = f.Policy()
+	if len(p.Categories) != 2 || p.Categories[0].Name != "news" || p.Categories[1].Domains[1] != "instagram.com" {
+		t.Errorf("reopened categories = %+v", p.Categories)
+	}
+	if p, err := f.DeleteCategory("news"); err != nil || len(p.Categories) != 1 {
+		t.Errorf("DeleteCategory = %+v, %v", p.Categories, err)
+	}
+	if _, err := f.DeleteCategory("news"); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("deleting twice: %v", err)
+	}
+}
+
+func TestRuleState(t *testing.T) {
+	from := time.Date(2026, 6, 8, 0, 0, 0, 0, time.UTC)
+	until := from.AddDate(0, 0, 5)
+	exams := Rule{Domain: "netflix.com", EffectiveFrom: &from, EffectiveUntil: &until}
+	evenings := exams
+	evenings.Schedule = &Schedule{Start: "18:00", End: "23:00"}
+	for _, r := range []*Rule{&exams, &evenings} {
+		if err := r.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		r    Rule
+		t    time.Time
+		want string
+	}{
+		{exams, from.Add(-time.Second), StateScheduled},
+		{exams, from, StateActive},
+		{exams, until.Add(-time.Second), StateActive},
+		{exams, until, StateExpired},
+		{evenings, from.Add(12 * time.Hour), StateIdle},
+		{evenings, from.Add(20 * time.Hour), StateActive},
+		{evenings, until.Add(20 * time.Hour), StateExpired},
+	} {
+		if got := c.r.State(c.t); got != c.want {
+			t.Errorf("state at %s = %s, want %s", c.t, got, c.want)
+		}
+	}
+
+	backwards := Rule{Domain: "netflix.com", EffectiveFrom: &until, EffectiveUntil: &from}
+	if err := backwards.Validate(); err == nil {
+		t.Error("a window ending before it starts validated")
+	}
+
+	// The same domain can be scheduled for different periods
+	f, err := Open(filepath.Join(t.TempDir(), "policy.json"), []string{"netflix.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateRule(exams); err != nil {
+		t.Errorf("scheduling a blocked domain for exams week: %v", err)
+	}
+	if _, _, err := f.CreateRule(exams); !errors.Is(err, ErrExists) {
+		t.Errorf("scheduling it twice: %v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	f, err := Open(path, []string{"a.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetHistoryLimit(3)
+	if _, err := f.AddDomain("b.example"); err != nil { // v2
+		t.Fatal(err)
+	}
+	r, _ := f.GetRule(1)
+	r.Category = "test"
+	if _, _, err := f.UpdateRule(r); err != nil { // v3
+		t.Fatal(err)
+	}
+	if _, err := f.RemoveDomain("b.example"); err != nil { // v4
+		t.Fatal(err)
+	}
+
+	history := f.History()
+	if len(history) != 3 || history[0].Version != 4 || history[2].Version != 2 {
+		t.Fatalf("history = %+v", history)
+	}
+	if c := history[1].Changes; len(c.RulesChanged) != 1 || c.RulesChanged[0].Category != "test" || c.RulesAdded != nil {
+		t.Errorf("v3 changes = %+v", c)
+	}
+	if c := history[0].Changes; len(c.RulesRemoved) != 1 || c.RulesRemoved[0].Domain != "b.example" {
+		t.Errorf("v4 changes = %+v", c)
+	}
+	// v1 fell out of the history, snapshot and all
+	if _, err := f.Snapshot(1); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("snapshot of a dropped version: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(path+".history", "v1.json")); !os.IsNotExist(err) {
+		t.Errorf("dropped snapshot still on disk: %v", err)
+	}
+
+	p, err := f.Rollback(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != 5 || p.RestoredFrom != 2 || !reflect.DeepEqual(p.Domains(), []string{"a.example", "b.example"}) || p.Rules[0].Category != "" {
+		t.Errorf("rolled back policy = %+v", p)
+	}
+	if rev, _ := f.Revision(5); rev.RestoredFrom != 2 || len(rev.Changes.RulesAdded) != 1 || len(rev.Changes.RulesChanged) != 1 {
+		t.Errorf("rollback revision = %+v", rev)
+	}
+	// New rules don't reuse the IDs of rules rolled back past
+	if r, _, err := f.CreateRule(Rule{Type: TypeSuffix, Domain: "c.example"}); err != nil || r.ID != 3 {
+		t.Errorf("rule created after rollback = %+v, %v", r, err)
+	}
+
+	// The history survives a restart
+	f, err = Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history := f.History(); len(history) != 3 || history[0].Version != 6 {
+		t.Errorf("reopened history = %+v", history)
+	}
+	if _, err := f.Rollback(99); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("rolling back to an unknown version: %v", err)
+	}
+}
+
+func TestSourceExpiry(t *testing.T) {
+	f, err := Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	src := Source{Name: "phish", URL: "https://feed.example/urls", Format: FormatURLs, Category: "Phishing",
+		Refresh: Duration(time.Hour), Expire: Duration(48 * time.Hour)}
+	if err := src.Validate(); err != nil || src.Category != "phishing" {
+		t.Fatalf("Validate = %v, category %q", err, src.Category)
+	}
+	if _, _, err := f.CreateSource(src); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := f.RecordRefresh("phish", []string{"a.example", "b.example"}, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(24 * time.Hour)
+	s, _, err := f.RecordRefresh("phish", []string{"b.example"}, 0, nil)
+	if err != nil || !reflect.DeepEqual(s.Domains, []string{"a.example", "b.example"}) || s.LastDiff.Changed() {
+		t.Fatalf("refresh after a.example dropped off = %v, %+v, %v", s.Domains, s.LastDiff, err)
+	}
+
+	// a.example expires 48h after it was last seen, even if the feed is down
+	now = now.Add(24 * time.Hour)
+	s, p, err := f.RecordRefresh("phish", nil, 0, errors.New("feed down"))
+	if err != nil || !reflect.DeepEqual(s.Domains, []string{"b.example"}) || s.LastError == "" || p.Version != 4 {
+		t.Errorf("failed refresh after expiry = %v in v%d, %v", s.Domains, p.Version, err)
+	}
+	if _, ok := s.LastSeen["a.example"]; ok {
+		t.Errorf("expired domain still seen: %v", s.LastSeen)
+	}
+
+	bad := Source{Name: "phish", URL: "https://feed.example/urls", Format: FormatURLs, Refresh: Duration(time.Hour), Expire: Duration(time.Minute)}
+	if err := bad.Validate(); err == nil {
+		t.Error("expiry shorter than the refresh interval passed validation")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	p := Policy{
+		Rules: []Rule{
+			{ID: 1, Type: TypeSuffix, Domain: "facebook.com", Category: "social"},
+			{ID: 2, Type: TypeWildcard, Domain: "ads-*.example.com"},
+			{ID: 3, Type: TypeSuffix, Domain: "tiktok.com", Groups: []string{"students"}},
+			{ID: 4, Type: TypeSuffix, Domain: "bet365.com", EffectiveFrom: &later},
+			{ID: 5, Type: TypeExact, Domain: "login.example.org"},
+			{ID: 6, Type: TypeRegex, Domain: `ads[0-9]+\.tracker\.net`},
+		},
+		Categories: []Category{
+			{Name: "news", Action: ActionAllow, Domains: []string{"ads-1.example.com", "bbc.co.uk"}},
+			{Name: "social", Action: ActionBlock, Domains: []string{"reddit.com"}},
+			{Name: "intranet", Action: ActionTrusted, Domains: []string{"corp.example", "reddit.com"}},
+		},
+		Sources: []Source{{Name: "urlhaus", Category: "malware", Domains: []string{"bad.example", "evil.example"}}},
+	}
+	for _, c := range []struct {
+		host, group string
+		blocked     bool
+		match       string
+		entry       string
+		id          int64
+		name        string
+	}{
+		{"www.facebook.com", "", true, MatchRule, "facebook.com", 1, ""},
+		{"ads-2.example.com", "", true, MatchRule, "ads-*.example.com", 2, ""},
+		{"ads-1.example.com", "", false, MatchCategory, "ads-1.example.com", 0, "news"},
+		{"tiktok.com", "", false, "", "", 0, ""},
+		{"tiktok.com", "students", true, MatchRule, "tiktok.com", 3, ""},
+		{"bet365.com", "", false, "", "", 0, ""},
+		{"old.reddit.com", "", true, MatchCategory, "reddit.com", 0, "social"},
+		{"wiki.corp.example", "", true, MatchCategory, "corp.example", 0, "intranet"},
+		{"cdn.evil.example", "", true, MatchSource, "evil.example", 0, "urlhaus"},
+		{"login.example.org", "", true, MatchRule, "login.example.org", 5, ""},
+		{"www.login.example.org", "", false, "", "", 0, ""},
+		{"ads12.tracker.net", "", true, MatchRule, `ads[0-9]+\.tracker\.net`, 6, ""},
+		{"ads12.tracker.net.example", "", false, "", "", 0, ""},
+	} {
+		v := p.Match(c.host, now, c.group)
+		if v.Blocked != c.blocked || v.Match != c.match || v.Entry != c.entry || v.RuleID != c.id || v.Name != c.name || v.Reason == "" {
+			t.Errorf("Match(%s, %q) = %+v", c.host, c.group, v)
+		}
+	}
+	if v := p.Match("cdn.evil.example", now, ""); v.Category != "malware" {
+		t.Errorf("source verdict category = %q", v.Category)
+	}
+	if v := p.Match("wiki.corp.example", now, ""); !v.Trusted {
+		t.Errorf("trusted category verdict = %+v", v)
+	}
+	if v := p.Match("old.reddit.com", now, ""); v.Trusted {
+		t.Errorf("a block category lost to a trusted one: %+v", v)
+	}
+	b := p.Blocked(now, "")
+	if !slices.Equal(b.Domains, []string{"bad.example", "evil.example", "facebook.com"}) || !slices.Equal(b.Exact, []string{"login.example.org"}) ||
+		!slices.Equal(b.Wildcards, []string{"ads-*.example.com"}) || !slices.Equal(b.Regexes, []string{`ads[0-9]+\.tracker\.net`}) || b.Len() != 6 {
+		t.Errorf("Blocked = %+v", b)
+	}
+}
+
+func TestRegexCache(t *testing.T) {
+	f, err := Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateRule(Rule{Type: TypeRegex, Domain: `ads[0-9]+\.example\.com`}); err != nil {
+		t.Fatal(err)
+	}
+	p := f.Policy()
+	if len(p.regexes) != 1 || p.regexes[`ads[0-9]+\.example\.com`] == nil {
+		t.Fatalf("published regexes = %v", p.regexes)
+	}
+
+	// A rule proposed in a copy matches, but isn't kept
+	proposed := p
+	proposed.Rules = append(slices.Clone(p.Rules), Rule{ID: 99, Type: TypeRegex, Domain: `track[0-9]+\.example\.com`})
+	now := time.Now()
+	if v := proposed.Match("track1.example.com", now, ""); v.RuleID != 99 {
+		t.Errorf("proposed regex verdict = %+v", v)
+	}
+	if v := proposed.Match("ads1.example.com", now, ""); !v.Blocked {
+		t.Errorf("published regex verdict = %+v", v)
+	}
+	if len(p.regexes) != 1 || len(f.Policy().regexes) != 1 {
+		t.Errorf("proposed rule was cached: %v", f.Policy().regexes)
+	}
+}
+
+func TestRuleTypes(t *testing.T) {
+	for _, c := range []struct{ typ, domain, wantType, want string }{
+		{"", "Example.COM.", TypeSuffix, "example.com"},
+		{TypeDomain, "example.com", TypeSuffix, "example.com"},
+		{TypeExact, "WWW.example.com", TypeExact, "www.example.com"},
+		{TypeWildcard, "*.Example.com", TypeWildcard, "*.example.com"},
+		{TypeRegex, ` ads[0-9]+\.example\.com `, TypeRegex, `ads[0-9]+\.example\.com`},
+	} {
+		r := Rule{Type: c.typ, Domain: c.domain}
+		if err := r.Validate(); err != nil || r.Type != c.wantType || r.Domain != c.want {
+			t.Errorf("Validate(%s %q) = %s %q, %v", c.typ, c.domain, r.Type, r.Domain, err)
+		}
+	}
+	for _, r := range []Rule{
+		{Type: "glob", Domain: "example.com"},
+		{Type: TypeExact, Domain: "*.example.com"},
+		{Type: TypeRegex, Domain: "ads(-[0-9]+"},
+		{Type: TypeRegex, Domain: `(?P<x`},
+		{Type: TypeRegex, Domain: ".*"},
+		{Type: TypeRegex, Domain: "(www\\.)?"},
+		{Type: TypeRegex, Domain: "   "},
+		{Type: TypeRegex, Domain: strings.Repeat("a", maxRegexLength+1)},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("Validate(%s %q) passed", r.Type, r.Domain)
+		}
+	}
+	// The error quotes the pattern as written, not as compiled
+	r := Rule{Type: TypeRegex, Domain: "ads(-[0-9]+"}
+	if err := r.Validate(); err == nil || err.Error() != `regex "ads(-[0-9]+": missing closing )` {
+		t.Errorf("invalid regex error = %v", err)
+	}
+}
+
+// sameJSON reports whether a and b encode the same
+func sameJSON(t *testing.T, a, b any) bool {
+	t.Helper()
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// testBackend makes changes of every kind and checks that they survive a
+// restart. open opens the backend, which must start empty.
+func testBackend(t *testing.T, open func() Backend) {
+	f, err := OpenBackend(open(), []string{"a.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	if _, _, err := f.CreateGroup(Group{Name: "students", Devices: []string{"lab-1", "lab-2"}}); err != nil { // v2
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateRule(Rule{Type: TypeWildcard, Domain: "*.casino.example", Groups: []string{"students"}}); err != nil { // v3
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateCategory(Category{Name: "social", Action: ActionBlock, Domains: []string{"b.example", "c.example"}}); err != nil { // v4
+		t.Fatal(err)
+	}
+	src := Source{Name: "phish", URL: "https://feed.example/urls", Format: FormatURLs, Refresh: Duration(time.Hour), Expire: Duration(48 * time.Hour)}
+	if _, _, err := f.CreateSource(src); err != nil { // v5
+		t.Fatal(err)
+	}
+	if _, _, err := f.RecordRefresh("phish", []string{"x.example", "y.example"}, 0, nil); err != nil { // v6
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	if _, _, err := f.RecordRefresh("phish", []string{"z.example"}, 0, nil); err != nil { // v7
+		t.Fatal(err)
+	}
+	if _, _, err := f.UpdateCategory("social", func(c *Category) error { c.Domains = []string{"c.example", "d.example"}; return nil }); err != nil { // v8
+		t.Fatal(err)
+	}
+	if _, _, err := f.UpdateGroup("students", func(g *Group) error { g.Devices = []string{"lab-2", "lab-3"}; return nil }); err != nil { // v9
+		t.Fatal(err)
+	}
+	if _, err := f.RemoveDomain("a.example"); err != nil { // v10
+		t.Fatal(err)
+	}
+	if _, _, _, err := f.SetFlag(Flag{Name: "mitm", Value: 10}); err != nil { // v11
+		t.Fatal(err)
+	}
+	want := f.Policy()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything survives a restart as it was
+	reopen := func() *File {
+		t.Helper()
+		f, err := OpenBackend(open(), []string{"ignored.example"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	f = reopen()
+	if got := f.Policy(); !sameJSON(t, got, want) {
+		t.Errorf("reopened policy = %+v\nwant %+v", got, want)
+	}
+	if s, _ := f.Policy().Source("phish"); len(s.Domains) != 3 || !s.LastSeen["z.example"].Equal(now) {
+		t.Errorf("reopened source = %+v", s)
+	}
+	if fl, _ := f.Policy().Flag("mitm"); fl.Value != 10 || !fl.AddedAt.Equal(now) {
+		t.Errorf("reopened flag = %+v", fl)
+	}
+	if history := f.History(); len(history) != 11 || history[0].Version != 11 || history[0].Changes.Flags == nil || len(history[1].Changes.RulesRemoved) != 1 {
+		t.Errorf("reopened history = %+v", history)
+	}
+
+	f.SetHistoryLimit(5)
+	p, err := f.Rollback(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != 12 || len(p.Rules) != 2 || len(p.Flags) != 0 {
+		t.Errorf("rolled back policy = %+v", p)
+	}
+	if _, err := f.Snapshot(6); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("snapshot of a dropped version: %v", err)
+	}
+	want = f.Policy()
+	f.Close()
+	f = reopen()
+	defer f.Close()
+	if got := f.Policy(); !sameJSON(t, got, want) {
+		t.Errorf("policy reopened after rollback = %+v\nwant %+v", got, want)
+	}
+	if history := f.History(); len(history) != 5 || history[0].RestoredFrom != 8 {
+		t.Errorf("history reopened after rollback = %+v", history)
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.db")
+	testBackend(t, func() Backend {
+		t.Helper()
+		b, err := OpenSQLite(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	})
+}
+
+// TestPostgres runs against a scratch database named by
+// POLICY_TEST_POSTGRES_URL, e.g. postgres://postgres@localhost/policy_test
+func TestPostgres(t *testing.T) {
+	url := os.Getenv("POLICY_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("POLICY_TEST_POSTGRES_URL not set")
+	}
+	open := func() Backend {
+		t.Helper()
+		b, err := OpenPostgres(context.Background(), url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	b := open()
+	for _, table := range []string{"policy", "rules", "categories", "device_groups", "sources", "feature_flags", "revisions"} {
+		if _, err := b.(*sqlBackend).db.Exec(`DELETE FROM ` + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Close()
+	testBackend(t, open)
+}
+
+func TestRebind(t *testing.T) {
+	b := &sqlBackend{dialect: "postgres"}
+	if got := b.rebind(`DELETE FROM rules WHERE id IN (?, ?)`); got != `DELETE FROM rules WHERE id IN ($1, $2)` {
+		t.Errorf("rebind = %s", got)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "policy.json")
+	f, err := Open(jsonPath, []string{"a.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateCategory(Category{Name: "social", Action: ActionBlock, Domains: []string{"b.example"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.AddDomain("c.example"); err != nil {
+		t.Fatal(err)
+	}
+	want := f.Policy()
+
+	b, err := OpenSQLite(context.Background(), filepath.Join(dir, "policy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Import(b, filepath.Join(dir, "missing.json")); ok || err != nil {
+		t.Errorf("importing a missing file = %v, %v", ok, err)
+	}
+	if ok, err := Import(b, jsonPath); !ok || err != nil {
+		t.Fatalf("Import = %v, %v", ok, err)
+	}
+	if ok, err := Import(b, jsonPath); ok || err != nil {
+		t.Errorf("importing into a database with a policy = %v, %v", ok, err)
+	}
+	db, err := OpenBackend(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := db.Policy(); !sameJSON(t, got, want) {
+		t.Errorf("imported policy = %+v\nwant %+v", got, want)
+	}
+	if history := db.History(); len(history) != 3 {
+		t.Errorf("imported history = %+v", history)
+	}
+	if p, err := db.Snapshot(1); err != nil || len(p.Rules) != 1 {
+		t.Errorf("imported snapshot of v1 = %+v, %v", p, err)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	f, err := Open(filepath.Join(t.TempDir(), "policy.json"), []string{"facebook.com", "tiktok.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	if _, _, err := f.CreateGroup(Group{Name: "students", Devices: []string{"lab-01"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateCategory(Category{Name: "gambling", Action: ActionBlock, Domains: []string{"bet365.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.CreateRule(Rule{Type: TypeSuffix, Domain: "youtube.com", Groups: []string{"students"},
+		Schedule: &Schedule{Days: []string{"mon", "tue"}, Start: "09:00", End: "17:00"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := f.SetFlag(Flag{Name: "fail-closed", Value: flags.On}); err != nil {
+		t.Fatal(err)
+	}
+	before := f.Policy()
+
+	// An exported document imports as it is, changing nothing
+	data, err := before.Document().YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseDocument(data)
+	if err != nil {
+		t.Fatalf("parsing the export: %v\n%s", err, data)
+	}
+	if changes, p, err := f.Apply(doc, false); err != nil || !changes.Empty() || p.Version != before.Version {
+		t.Fatalf("re-importing the export = %+v, v%d, %v", changes, p.Version, err)
+	}
+
+	// Edit it: drop tiktok.com, add a rule and a category domain
+	doc.Rules = append(doc.Rules[:1], doc.Rules[2:]...)
+	doc.Rules = append(doc.Rules, DocumentRule{Type: TypeWildcard, Domain: "ads-*.example.com"})
+	doc.Categories[0].Domains = append(doc.Categories[0].Domains, "pokerstars.com")
+	doc.Flags = append(doc.Flags, DocumentFlag{Name: "mitm", Value: 25})
+	now = now.Add(time.Hour)
+	changes, p, err := f.Apply(doc, true)
+	if err != nil || p.Version != before.Version {
+		t.Fatalf("dry run = v%d, %v", p.Version, err)
+	}
+	if len(changes.RulesAdded) != 1 || len(changes.RulesRemoved) != 1 || changes.RulesRemoved[0].Domain != "tiktok.com" ||
+		changes.Categories == nil || !reflect.DeepEqual(changes.Categories.Changed, []string{"gambling"}) ||
+		changes.Flags == nil || !reflect.DeepEqual(changes.Flags.Added, []string{"mitm"}) {
+		t.Errorf("dry run changes = %+v", changes)
+	}
+	if _, p, err = f.Apply(doc, false); err != nil || p.Version != before.Version+1 {
+		t.Fatalf("Apply = v%d, %v", p.Version, err)
+	}
+	// Rules it kept keep their IDs; the new one gets the next
+	if p.Rules[0].ID != before.Rules[0].ID || p.Rules[1].ID != before.Rules[2].ID || p.Rules[2].ID != before.NextID {
+		t.Errorf("rule IDs after Apply = %d, %d, %d", p.Rules[0].ID, p.Rules[1].ID, p.Rules[2].ID)
+	}
+	if c, _ := p.Category("gambling"); !c.AddedAt.Equal(before.Categories[0].AddedAt) || !c.UpdatedAt.Equal(now) {
+		t.Errorf("gambling category after Apply = %+v", c)
+	}
+	if values := p.FlagValues(); len(values) != 2 || values["fail-closed"] != flags.On || values["mitm"] != 25 {
+		t.Errorf("flags after Apply = %v", values)
+	}
+
+	// Every problem is reported, and nothing changes
+	bad := Document{
+		Rules:  []DocumentRule{{Domain: "not a domain"}, {Domain: "a.example", Groups: []string{"staff"}}, {Domain: "b.example"}, {Domain: "B.example"}},
+		Groups: []DocumentGroup{{Name: "one", Devices: []string{"pc"}}, {Name: "two", Devices: []string{"pc"}}},
+		Flags:  []DocumentFlag{{Name: "Not A Flag"}},
+	}
+	_, _, err = f.Apply(bad, false)
+	var invalid *InvalidDocumentError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 5 {
+		t.Errorf("Apply of a bad document = %v", err)
+	}
+	if f.Policy().Version != p.Version {
+		t.Error("a bad document changed the policy")
+	}
+
+	if _, err := ParseDocument([]byte("rules:\n  - domian: typo.example\n")); err == nil {
+		t.Error("ParseDocument accepted an unknown field")
+	}
+	if _, err := ParseDocument(nil); err == nil {
+		t.Error("ParseDocument accepted an empty document")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	f, err := Open(filepath.Join(t.TempDir(), "policy.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl, added, p, err := f.SetFlag(Flag{Name: "mitm", Value: 10, Description: "Intercept HTTPS"})
+	if err != nil || !added || p.Version != 2 || fl.AddedAt.IsZero() {
+		t.Fatalf("SetFlag = %+v, %v, v%d, %v", fl, added, p.Version, err)
+	}
+	// Setting what is already set makes no new version
+	if _, added, p, err = f.SetFlag(fl); err != nil || added || p.Version != 2 {
+		t.Errorf("SetFlag again = %v, v%d, %v", added, p.Version, err)
+	}
+	if fl, added, p, err = f.SetFlag(Flag{Name: "mitm", Value: 50}); err != nil || added || p.Version != 3 || fl.Description != "" {
+		t.Errorf("SetFlag to 50%% = %+v, %v, v%d, %v", fl, added, p.Version, err)
+	}
+	if rev, _ := f.Revision(3); rev.Changes.Flags == nil || rev.Changes.Flags.Changed[0] != "mitm" {
+		t.Errorf("revision 3 = %+v", rev.Changes)
+	}
+	if _, err := f.DeleteFlag("nosuch"); !errors.Is(err, ErrFlagNotFound) {
+		t.Errorf("DeleteFlag(nosuch) = %v", err)
+	}
+	if p, err = f.DeleteFlag("mitm"); err != nil || len(p.FlagValues()) != 0 {
+		t.Errorf("DeleteFlag = %+v, %v", p.Flags, err)
+	}
+
+	for _, bad := range []Flag{{Name: "MITM mode"}, {Name: "mitm", Value: 101}, {Name: "mitm", Description: strings.Repeat("x", maxDescription+1)}} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/middleware"
+	"github.com/nisatyap/shared/openapi"
+)
+
+// checkPolicy tells /healthz whether the proxy holds a policy yet; until
+// it does, it blocks nothing, or everything with the fail-closed flag on
+func (ps *ProxyServer) checkPolicy(ctx context.Context) error {
+	ps.blocklistMutex.RLock()
+	defer ps.blocklistMutex.RUnlock()
+	if ps.version == 0 {
+		return fmt.Errorf("no policy loaded yet")
+	}
+	return nil
+}
+
+// adminHandler serves the admin port: /healthz, /metrics with the
+// requests the proxy and the admin port answered and the feature flags,
+// /flags, and /openapi.json documenting them. With a token, all but
+// /healthz, which load balancers probe, need it as a bearer token.
+func (ps *ProxyServer) adminHandler(httpMetrics *middleware.Metrics, token string) http.Handler {
+	mux := http.NewServeMux()
+	spec := openapi.New(openapi.Info{Title: "SWG Proxy admin", Version: "1.0.0"})
+	var auth string
+	protect := func(h http.Handler) http.Handler { return h }
+	if token != "" {
+		auth = "bearer"
+		spec.Security(auth, openapi.Bearer("The proxy's -admin-token"))
+		protect = func(h http.Handler) http.Handler { return requireToken(token, ps.logins, h) }
+	}
+	// Method-less patterns, which the spec documents as GET: the module's
+	// go version predates method patterns
+	admin := spec.Mux(mux)
+	health := openapi.Object{"status": "", "checks": openapi.Optional(map[string]string{})}
+	admin.Handle("/healthz", middleware.Healthz(map[string]middleware.Check{"policy": ps.checkPolicy}), openapi.Operation{
+		Summary:   "Readiness check, 503 until a policy is loaded",
+		Response:  health,
+		Responses: map[int]any{http.StatusServiceUnavailable: health},
+	})
+	admin.Handle("/metrics", protect(httpMetrics.Handler(ps.features.Handler())), openapi.Operation{
+		Summary:      "Prometheus metrics",
+		Auth:         auth,
+		ResponseType: "text/plain",
+	})
+	admin.Handle("/flags", protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ps.features.Flags())
+	})), openapi.Operation{
+		Summary:  "The feature flags the proxy checks, their values and where they came from",
+		Auth:     auth,
+		Response: []flags.Status{},
+	})
+	admin.Handle("/openapi.json", protect(spec), openapi.Operation{Summary: "This document", Auth: auth})
+	return middleware.Chain(mux, middleware.RequestID, middleware.Log(ps.log), middleware.Recover(ps.log), httpMetrics.Middleware)
+}
+
+// adminActor is who presents the -admin-token, in the audit log
+const adminActor = "admin"
+
+// adminLoginWindow is how long the admin port's requests from one address
+// count as one sign-in in the audit log
+const adminLoginWindow = time.Hour
+
+// requireToken lets through the requests that present token as an
+// "Authorization: Bearer" header, and answers the others 401, noting both
+// in logins
+func requireToken(token string, logins *audit.Logins, next http.Handler) http.Handler {
+	want := sha256.Sum256([]byte(token))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, presented, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		// Comparing digests keeps the time taken the same whatever the length
+		got := sha256.Sum256([]byte(strings.TrimSpace(presented)))
+		if !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+			detail := "wrong token"
+			if presented == "" {
+				detail = "no token"
+			}
+			logins.Failed(r.Context(), "", r.RemoteAddr, detail)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="swg-proxy-admin"`)
+			http.Error(w, "admin token required", http.StatusUnauthorized)
+			return
+		}
+		logins.Succeeded(r.Context(), "", adminActor, r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
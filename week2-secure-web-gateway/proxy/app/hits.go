@@ -0,0 +1,122 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hit counts the requests one policy entry matched
+type hit struct {
+	Type        string    `json:"type"`
+	Entry       string    `json:"entry"`
+	Count       int64     `json:"count"`
+	LastMatched time.Time `json:"last_matched"`
+}
+
+// hitCounter collects the policy entries requests matched between reports
+// to the policy engine, which shows them to admins
+type hitCounter struct {
+	mu   sync.Mutex
+	hits map[string]*hit
+}
+
+func (c *hitCounter) record(hitType, entry string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hits == nil {
+		c.hits = make(map[string]*hit)
+	}
+	key := hitType + " " + entry
+	h := c.hits[key]
+	if h == nil {
+		h = &hit{Type: hitType, Entry: entry}
+		c.hits[key] = h
+	}
+	h.Count++
+	h.LastMatched = time.Now().UTC()
+}
+
+// take returns the hits collected so far and starts counting afresh
+func (c *hitCounter) take() []hit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]hit, 0, len(c.hits))
+	for _, h := range c.hits {
+		out = append(out, *h)
+	}
+	c.hits = nil
+	return out
+}
+
+// RunHitReports reports the entries requests matched to the policy engine
+// every interval until ctx is cancelled, then reports the hits left. A
+// failed report is logged and its hits dropped; they are statistics, not
+// policy.
+func (ps *ProxyServer) RunHitReports(ctx context.Context, interval time.Duration) {
+	u, err := url.Parse(ps.policyURL)
+	if err != nil {
+		ps.log.Error("not reporting hits", "error", err)
+		return
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/hits"
+	u.RawQuery = ""
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// The run is stopping, so the last report gets a few seconds of its own
+			final, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			ps.reportHits(final, u.String())
+			cancel()
+			return
+		case <-ticker.C:
+			ps.reportHits(ctx, u.String())
+		}
+	}
+}
+
+// reportHits posts the hits taken since the last report
+func (ps *ProxyServer) reportHits(ctx context.Context, rawURL string) {
+	hits := ps.hits.take()
+	for len(hits) > 0 {
+		n := min(len(hits), 1000) // the policy engine's limit per report
+		if err := ps.postHits(ctx, rawURL, hits[:n]); err != nil {
+			ps.log.Warn("hit report failed", "error", err)
+			return
+		}
+		hits = hits[n:]
+	}
+}
+
+func (ps *ProxyServer) postHits(ctx context.Context, rawURL string, hits []hit) error {
+	body, err := json.Marshal(map[string][]hit{"hits": hits})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ps.hitsToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ps.hitsToken)
+	}
+	resp, err := ps.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("policy engine returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/config"
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/eventbus"
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/lifecycle"
+	"github.com/nisatyap/shared/logging"
+	"github.com/nisatyap/shared/middleware"
+	"github.com/nisatyap/shared/posturetoken"
+	"github.com/nisatyap/shared/ratelimit"
+	"github.com/nisatyap/shared/tlsutil"
+)
+
+// proxyFlags are the features the proxy checks
+var proxyFlags = []flags.Flag{
+	{Name: flags.MITM, Description: "Intercept HTTPS with -mitm-ca, for the devices it is on for, to apply the policy inside it"},
+	{Name: flags.FailClosed, Description: "Block every request until a policy is loaded, instead of allowing them"},
+}
+
+// Main runs the proxy with args, the command line without the program
+// name, and returns its exit code if it fails to start or to serve. name
+// is how the proxy is invoked, e.g. "proxy" or "swg proxy", for its usage
+// message.
+func Main(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	listen := fs.String("listen", ":8080", "Address to listen on")
+	adminListen := fs.String("admin-listen", "localhost:9090", "Address to serve /healthz, /metrics, /flags and /openapi.json on (empty disables)")
+	adminToken := fs.String("admin-token", "", "Bearer token the admin port requires for all but /healthz, or a secret reference such as vault:secret/data/swg/proxy#admin_token (empty requires none)")
+	policyURL := fs.String("policy-url", "http://localhost:8000/policy", "Policy engine's policy endpoint")
+	updateInterval := fs.Duration("update-interval", 5*time.Minute, "How often to fetch the policy, besides the updates the stream announces")
+	hitInterval := fs.Duration("hit-report-interval", 30*time.Second, "How often to report the policy entries requests matched")
+	hitsToken := fs.String("hits-token", "", "Policy engine user's token, with the viewer role, to report hits with, or a secret reference such as env:PROXY_HITS_TOKEN (empty for a policy engine without auth)")
+	group := fs.String("group", "", "Policy group whose rules this proxy enforces on top of the rules for everyone")
+	subscribe := fs.Bool("subscribe", true, "Update the blocklist as soon as the policy changes, over the policy engine's stream")
+	policyKey := fs.String("policy-key", "", "PEM file of the policy engine's public keys; policies not signed with one are rejected")
+	postureKeys := fs.String("posture-keys", "", "PEM file of the collector's posture token keys; without it, trusted categories are blocked for every device")
+	eventBus := fs.String("event-bus", eventbus.LocalSpec, "Event bus to quarantine devices from: local for the in-process bus, the collector's /events URL, or empty to disable")
+	eventBusToken := fs.String("event-bus-token", "", "Bearer token for a remote -event-bus, e.g. the collector's admin token, or a secret reference such as env:COLLECTOR_ADMIN_TOKEN")
+	quarantineFor := fs.Duration("quarantine", time.Hour, "How long a device that reports tampering is refused trusted categories")
+	quarantineTTL := fs.Duration("quarantine-ttl", DefaultQuarantineTTL, "How long a quarantined device's tokens are refused at most; must outlast the tokens the collector issues")
+	features := fs.String("features", "", "Feature flags, e.g. mitm=10%,fail-closed=on; the policy engine's values win (flags: mitm, fail-closed)")
+	featuresURL := fs.String("flags-url", "", "Policy engine's flags endpoint (default: /flags beside -policy-url)")
+	mitmCA := fs.String("mitm-ca", "", "PEM CA certificate to intercept HTTPS with, for the devices the mitm flag is on for; devices must trust it")
+	clientRate := fs.Float64("client-rate-limit", 100, "Requests per second accepted from one client address (0 disables)")
+	clientBurst := fs.Int("client-burst", 200, "Requests a client may make back to back")
+	rateLimitRedis := fs.String("rate-limit-redis", "", "Redis URL, as in redis://:password@redis:6379/0, to keep the client rate limits in, shared by every proxy using it (default in memory)")
+	auditFile := fs.String("audit-log", "", "File to append an audit log of the requests blocked and admin port sign-ins to (empty disables)")
+	auditSyslog := fs.String("audit-syslog", "", "Also send audit events to syslog: local, udp://host:514 or tcp://host:514 (needs -audit-log)")
+	auditWebhook := fs.String("audit-webhook", "", "Also POST audit events as JSON to this http or https URL, such as a SIEM's (needs -audit-log)")
+	mitmCAKey := fs.String("mitm-ca-key", "", "PEM private key for -mitm-ca, or a secret reference such as vault:secret/data/swg/proxy#mitm_ca_key")
+	var listenTLS, policyTLS tlsutil.Config
+	fs.StringVar(&listenTLS.CertFile, "tls-cert", "", "PEM certificate to serve the proxy over HTTPS with (reloaded when it changes)")
+	fs.StringVar(&listenTLS.KeyFile, "tls-key", "", "PEM private key for -tls-cert")
+	fs.StringVar(&listenTLS.CAFile, "client-ca", "", "PEM bundle client certificates are verified against")
+	fs.StringVar(&listenTLS.ClientAuth, "client-auth", "", "Client certificates with -client-ca: request (the default) or require")
+	fs.StringVar(&listenTLS.MinVersion, "tls-min-version", "1.2", "Lowest TLS version accepted: 1.2 or 1.3")
+	fs.StringVar(&policyTLS.CAFile, "policy-ca", "", "PEM bundle the policy engine's certificate is verified against (default: system roots)")
+	fs.StringVar(&policyTLS.CertFile, "policy-tls-cert", "", "PEM certificate presented to the policy engine")
+	fs.StringVar(&policyTLS.KeyFile, "policy-tls-key", "", "PEM private key for -policy-tls-cert")
+	logOpts := logging.Options{Service: "proxy", Version: version}
+	logOpts.AddFlags(fs)
+	settings, err := config.Load(fs, args, config.Options{
+		EnvPrefix: "PROXY",
+		Validate: func() error {
+			if u, err := url.Parse(*policyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("-policy-url must be an http or https URL")
+			}
+			if *rateLimitRedis != "" {
+				if _, err := ratelimit.OpenRedis(*rateLimitRedis); err != nil {
+					return fmt.Errorf("-rate-limit-redis: %w", err)
+				}
+			}
+			if *updateInterval <= 0 || *hitInterval <= 0 {
+				return fmt.Errorf("-update-interval and -hit-report-interval must be positive")
+			}
+			if *eventBus != "" && *eventBus != eventbus.LocalSpec {
+				if u, err := url.Parse(*eventBus); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("-event-bus must be local or an http or https URL")
+				}
+			}
+			if *quarantineFor < 0 {
+				return fmt.Errorf("-quarantine must not be negative")
+			}
+			if *quarantineTTL <= 0 {
+				return fmt.Errorf("-quarantine-ttl must be positive")
+			}
+			if err := flags.New("", proxyFlags...).Configure(*features); err != nil {
+				return fmt.Errorf("-features: %w", err)
+			}
+			if *featuresURL != "" {
+				if u, err := url.Parse(*featuresURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("-flags-url must be an http or https URL")
+				}
+			}
+			if *auditFile == "" && (*auditSyslog != "" || *auditWebhook != "") {
+				return fmt.Errorf("-audit-syslog and -audit-webhook need -audit-log")
+			}
+			if *auditWebhook != "" {
+				if u, err := url.Parse(*auditWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("-audit-webhook must be an http or https URL")
+				}
+			}
+			if (*mitmCA == "") != (*mitmCAKey == "") {
+				return fmt.Errorf("-mitm-ca and -mitm-ca-key must be set together")
+			}
+			if listenTLS.CertFile == "" && (listenTLS.KeyFile != "" || listenTLS.CAFile != "") {
+				return fmt.Errorf("-tls-key and -client-ca need -tls-cert")
+			}
+			if err := listenTLS.Validate(); err != nil {
+				return fmt.Errorf("-tls-cert, -tls-key, -client-ca: %w", err)
+			}
+			if err := policyTLS.Validate(); err != nil {
+				return fmt.Errorf("-policy-ca, -policy-tls-cert, -policy-tls-key: %w", err)
+			}
+			_, err := logging.NewHandler(logOpts)
+			return err
+		},
+	})
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if settings.Print {
+		settings.Dump(os.Stdout)
+		return 0
+	}
+	logger, _ := logging.New(logOpts) // checked by Validate
+	for _, name := range settings.Plaintext() {
+		logger.Warn("secret set in plaintext; give a secret reference such as env:, file:, vault: or keychain: instead", "flag", name)
+	}
+	if *group != "" {
+		*policyURL += "?group=" + url.QueryEscape(*group)
+	}
+
+	logger.Info("starting proxy server", "listen", *listen, "policy_url", *policyURL, "update_interval", *updateInterval)
+
+	// Create proxy server
+	proxy := NewProxyServer(*policyURL, logger)
+	if policyTLS.Enabled() {
+		if err := proxy.UsePolicyTLS(policyTLS); err != nil {
+			logger.Error("invalid policy engine TLS settings", "error", err)
+			return 1
+		}
+	}
+	if *policyKey != "" {
+		keys, err := cryptoutil.ReadKeyRing(*policyKey)
+		if err != nil {
+			logger.Error("reading policy keys failed", "error", err)
+			return 1
+		}
+		proxy.policyKeys = keys
+		logger.Info("verifying policy signatures", "keys", keys.Len(), "file", *policyKey)
+	} else {
+		logger.Warn("no -policy-key, applying policies without checking their signatures")
+	}
+	if *postureKeys != "" {
+		verifier, err := posturetoken.ReadVerifier(*postureKeys)
+		if err != nil {
+			logger.Error("reading posture token keys failed", "error", err)
+			return 1
+		}
+		proxy.postureTokens = verifier
+		logger.Info("verifying posture tokens", "keys", verifier.Keys(), "file", *postureKeys)
+	}
+	proxy.hitsToken = *hitsToken
+	proxy.quarantineFor = *quarantineFor
+	proxy.quarantineTTL = *quarantineTTL
+	proxy.features.Configure(*features) // checked by Validate
+	if *featuresURL != "" {
+		proxy.flagsURL = *featuresURL
+	}
+	if *mitmCA != "" {
+		ca, err := readMITMCA(*mitmCA, *mitmCAKey)
+		if err != nil {
+			logger.Error("reading the MITM CA failed", "error", err)
+			return 1
+		}
+		proxy.mitmCA = ca
+		logger.Info("intercepting HTTPS for the devices the mitm flag is on for", "ca", ca.Leaf.Subject.CommonName)
+	}
+	if *auditFile != "" {
+		auditStore, err := audit.OpenFile(*auditFile)
+		if err != nil {
+			logger.Error("opening the audit log failed", "error", err)
+			return 1
+		}
+		proxy.audit = audit.New(auditService, auditStore)
+		defer proxy.audit.Close()
+		if n, err := proxy.audit.Verify(context.Background()); err != nil {
+			logger.Warn("audit log failed verification", "file", *auditFile, "events", n, "error", err)
+		}
+		if *auditSyslog != "" {
+			sink, err := audit.NewSyslog(*auditSyslog, auditService)
+			if err != nil {
+				logger.Error("connecting to syslog failed", "error", err)
+				return 1
+			}
+			proxy.audit.AddSink(sink)
+		}
+		if *auditWebhook != "" {
+			sink, err := audit.NewWebhook(*auditWebhook, nil, logger)
+			if err != nil {
+				logger.Error("invalid audit webhook", "error", err)
+				return 1
+			}
+			proxy.audit.AddSink(sink)
+		}
+		proxy.logins = audit.NewLogins(proxy.audit, adminLoginWindow)
+		u, _ := url.Parse(*auditWebhook)
+		logger.Info("recording an audit log", "file", *auditFile, "syslog", *auditSyslog, "webhook", u.Redacted())
+	}
+	var unsubscribe func()
+	if *eventBus != "" {
+		bus, err := eventbus.Open(*eventBus, eventbus.Options{Token: *eventBusToken, Logger: logger})
+		if err == nil {
+			unsubscribe, err = proxy.SubscribePostureEvents(bus)
+		}
+		if err != nil {
+			logger.Error("subscribing to posture events failed", "error", err)
+			return 1
+		}
+		defer unsubscribe()
+	}
+
+	// Initial blocklist load
+	if err := proxy.UpdateFlags(); err != nil {
+		logger.Warn("could not load feature flags; using -features until the next update", "error", err)
+	}
+	if err := proxy.UpdateBlocklist(); err != nil {
+		if proxy.features.Enabled(flags.FailClosed) {
+			logger.Warn("could not load initial blocklist; blocking every request until it loads", "error", err)
+		} else {
+			logger.Warn("could not load initial blocklist; retrying in the background with an empty blocklist", "error", err)
+		}
+	}
+
+	var certs *tlsutil.Reloader
+	if listenTLS.CertFile != "" {
+		if certs, err = tlsutil.New(listenTLS); err != nil {
+			logger.Error("invalid TLS settings", "error", err)
+			return 1
+		}
+	}
+
+	run := lifecycle.New(lifecycle.Options{})
+	run.Go("blocklist updates", func(ctx context.Context) error {
+		proxy.RunPeriodicUpdate(ctx, *updateInterval)
+		return nil
+	})
+	if *subscribe {
+		run.Go("policy stream", func(ctx context.Context) error {
+			proxy.RunPolicyStream(ctx)
+			return nil
+		})
+	}
+	run.Go("hit reports", func(ctx context.Context) error {
+		proxy.RunHitReports(ctx, *hitInterval)
+		return nil
+	})
+
+	httpMetrics := middleware.NewMetrics()
+	if *adminListen != "" {
+		admin := &http.Server{
+			Addr:              *adminListen,
+			Handler:           proxy.adminHandler(httpMetrics, *adminToken),
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+		}
+		logger.Info("admin server listening", "listen", *adminListen)
+		run.Serve("admin server", admin, admin.ListenAndServe)
+	}
+
+	var limitStore ratelimit.Store
+	if *rateLimitRedis != "" {
+		redis, _ := ratelimit.OpenRedis(*rateLimitRedis) // checked by Validate
+		defer redis.Close()
+		limitStore = redis
+		logger.Info("keeping client rate limits in Redis", "redis", redis.String())
+	}
+	clients := ratelimit.New("proxy-client", ratelimit.PerSecond(*clientRate, *clientBurst), limitStore)
+
+	// Start the HTTP server
+	server := &http.Server{
+		Addr:         *listen,
+		Handler:      middleware.Chain(proxy, middleware.RequestID, middleware.Recover(logger), httpMetrics.Middleware, clients.Middleware(ratelimit.ClientIP)),
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+
+	if certs != nil {
+		server.TLSConfig, _ = certs.ServerConfig() // -tls-cert is set
+		logger.Info("proxy server listening over HTTPS; configure your browser to use this proxy", "listen", *listen)
+		run.Serve("server", server, func() error { return server.ListenAndServeTLS("", "") })
+	} else {
+		logger.Info("proxy server listening; configure your browser to use this proxy", "listen", *listen)
+		run.Serve("server", server, server.ListenAndServe)
+	}
+
+	<-run.Context().Done()
+	logger.Info("shutting down", "signal", run.Signal())
+	if err := run.Wait(); err != nil {
+		logger.Error("shutdown", "error", err)
+		return 1
+	}
+	return 0
+}
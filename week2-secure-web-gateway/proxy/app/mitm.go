@@ -0,0 +1,217 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/posturetoken"
+	"github.com/nisatyap/shared/secrets"
+)
+
+// connectEstablished answers a CONNECT the proxy takes the connection of
+const connectEstablished = "HTTP/1.1 200 Connection Established\r\n\r\n"
+
+// hijack takes over the client's connection for a CONNECT and tells the
+// client it is established. The server's deadlines are lifted: the
+// connection now lives as long as the client keeps it.
+func hijack(w http.ResponseWriter) (net.Conn, error) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	if _, err := io.WriteString(conn, connectEstablished); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// tunnel relays a CONNECT to its destination without looking inside
+func (ps *ProxyServer) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", connectAddr(r.Host), 10*time.Second)
+	if err != nil {
+		http.Error(w, "Error connecting to the destination", http.StatusBadGateway)
+		ps.log.WarnContext(r.Context(), "tunnel failed", "host", r.Host, "error", err)
+		return
+	}
+	conn, err := hijack(w)
+	if err != nil {
+		upstream.Close()
+		ps.log.ErrorContext(r.Context(), "taking over the connection failed", "host", r.Host, "error", err)
+		return
+	}
+	go func() {
+		io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
+
+// connectAddr returns the address a CONNECT is for, on port 443 if it
+// names none
+func connectAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return net.JoinHostPort(host, "443")
+	}
+	return host
+}
+
+// intercept terminates the TLS of a CONNECT with a certificate for its
+// host signed by the MITM CA, and serves the requests inside as the proxy
+// serves any other: checked against the policy, then forwarded over HTTPS.
+// They carry the CONNECT's posture token, which the client sends only
+// with the CONNECT.
+func (ps *ProxyServer) intercept(w http.ResponseWriter, r *http.Request) {
+	conn, err := hijack(w)
+	if err != nil {
+		http.Error(w, "Error intercepting the connection", http.StatusInternalServerError)
+		ps.log.ErrorContext(r.Context(), "taking over the connection failed", "host", r.Host, "error", err)
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	tlsConn := tls.Server(conn, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return ps.mitmCertificate(hello.ServerName)
+			}
+			return ps.mitmCertificate(host)
+		},
+	})
+	token := posturetoken.FromRequest(r)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, inner *http.Request) {
+			if token != "" && posturetoken.FromRequest(inner) == "" {
+				inner.Header.Set(posturetoken.HeaderToken, token)
+			}
+			ps.ServeHTTP(w, inner)
+		}),
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ErrorLog:          slog.NewLogLogger(ps.log.Handler(), slog.LevelDebug),
+	}
+	server.Serve(&connListener{conn: tlsConn})
+}
+
+// connListener accepts one connection, which the server then serves until
+// it closes
+type connListener struct {
+	conn net.Conn
+	once sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = l.conn })
+	if conn == nil {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (l *connListener) Close() error   { return nil }
+func (l *connListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+// maxMITMCerts caps the intercepted hosts' certificates kept
+const maxMITMCerts = 1000
+
+// mitmCertificate returns a certificate for host signed by the MITM CA,
+// minting one valid for a day if none is cached or the cached one is
+// about to expire
+func (ps *ProxyServer) mitmCertificate(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(host)
+	now := time.Now()
+	ps.mitmLock.Lock()
+	defer ps.mitmLock.Unlock()
+	if cert, ok := ps.mitmCerts[host]; ok && now.Add(time.Hour).Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ps.mitmCA.Leaf, &key.PublicKey, ps.mitmCA.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign a certificate for %s: %w", host, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{der, ps.mitmCA.Certificate[0]}, PrivateKey: key, Leaf: leaf}
+	if len(ps.mitmCerts) >= maxMITMCerts {
+		ps.mitmCerts = make(map[string]*tls.Certificate)
+	}
+	ps.mitmCerts[host] = cert
+	return cert, nil
+}
+
+// readMITMCA reads the CA certificate and key HTTPS is intercepted with.
+// keyFile may instead be a secret reference to the PEM key.
+func readMITMCA(certFile, keyFile string) (*tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the MITM CA: %w", err)
+	}
+	var keyPEM []byte
+	if secrets.IsReference(keyFile) {
+		var key string
+		key, err = secrets.Resolve(context.Background(), keyFile)
+		keyPEM = []byte(key)
+	} else {
+		keyPEM, err = os.ReadFile(keyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the MITM CA key: %w", err)
+	}
+	ca, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the MITM CA: %w", err)
+	}
+	if ca.Leaf, err = x509.ParseCertificate(ca.Certificate[0]); err != nil {
+		return nil, fmt.Errorf("failed to read the MITM CA: %w", err)
+	}
+	if !ca.Leaf.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certFile)
+	}
+	return &ca, nil
+}
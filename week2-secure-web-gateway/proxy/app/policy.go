@@ -0,0 +1,436 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/hostmatch"
+	"github.com/nisatyap/shared/httpclient"
+	"github.com/nisatyap/shared/tlsutil"
+)
+
+// PolicyResponse represents the response from the policy engine
+type PolicyResponse struct {
+	Blocked     []string                  `json:"blocked"`   // domains, blocked with their subdomains
+	Exact       []string                  `json:"exact"`     // host names, blocked without their subdomains
+	Wildcards   []string                  `json:"wildcards"` // e.g. *.example.com; '*' matches within one label
+	Regexes     []string                  `json:"regexes"`   // RE2 patterns matching whole host names
+	Categories  map[string]PolicyCategory `json:"categories"`
+	Version     int64                     `json:"version"`
+	GeneratedAt time.Time                 `json:"generated_at"`
+}
+
+// PolicyCategory is a named set of domains the policy engine blocks or
+// allows as a whole
+type PolicyCategory struct {
+	Action  string   `json:"action"` // block, allow or trusted
+	Domains []string `json:"domains"`
+}
+
+// ChangesResponse is the policy engine's delta from the policy the proxy
+// holds to the current one
+type ChangesResponse struct {
+	Since             int64                     `json:"since"` // the version the delta applies to
+	Version           int64                     `json:"version"`
+	GeneratedAt       time.Time                 `json:"generated_at"`
+	Added             []string                  `json:"added"`
+	Removed           []string                  `json:"removed"`
+	ExactAdded        []string                  `json:"exact_added"`
+	ExactRemoved      []string                  `json:"exact_removed"`
+	WildcardsAdded    []string                  `json:"wildcards_added"`
+	WildcardsRemoved  []string                  `json:"wildcards_removed"`
+	RegexesAdded      []string                  `json:"regexes_added"`
+	RegexesRemoved    []string                  `json:"regexes_removed"`
+	Categories        map[string]PolicyCategory `json:"categories"` // added or changed
+	CategoriesRemoved []string                  `json:"categories_removed"`
+}
+
+// flagsURL returns the policy engine's GET /flags, beside its policy
+// endpoint
+func flagsURL(policyURL string) string {
+	u, err := url.Parse(policyURL)
+	if err != nil {
+		return ""
+	}
+	u.Path = path.Join(path.Dir(u.Path), "flags")
+	u.RawQuery = ""
+	return u.String()
+}
+
+// UpdateFlags applies the flag values the policy engine sets for the
+// fleet, which win over -features
+func (ps *ProxyServer) UpdateFlags() error {
+	if ps.flagsURL == "" {
+		return nil
+	}
+	return ps.features.Fetch(context.Background(), ps.client, ps.flagsURL)
+}
+
+// UsePolicyTLS makes the proxy verify the policy engine, and present a
+// certificate to it, as cfg says
+func (ps *ProxyServer) UsePolicyTLS(cfg tlsutil.Config) error {
+	tlsConfig, err := tlsutil.ClientConfig(cfg)
+	if err != nil {
+		return err
+	}
+	opts := policyClientOptions(ps.log)
+	opts.TLS = tlsConfig
+	client, err := httpclient.New(opts)
+	if err != nil {
+		return err
+	}
+	ps.client = client
+	return nil
+}
+
+// policyClientOptions configure the client the proxy calls the policy
+// engine with: policy fetches are retried, so that a policy engine that is
+// restarting doesn't leave the blocklist stale until the next update
+func policyClientOptions(logger *slog.Logger) httpclient.Options {
+	return httpclient.Options{
+		Timeout:   10 * time.Second,
+		Attempts:  3,
+		UserAgent: "swg-proxy/" + version,
+		OnAttempt: func(a httpclient.Attempt) {
+			if a.Retry == 0 {
+				return
+			}
+			err := a.Err
+			if err == nil {
+				err = fmt.Errorf("policy engine returned status: %d", a.StatusCode)
+			}
+			logger.Warn("policy engine request failed, retrying", "url", a.Request.URL.String(), "attempt", a.Number, "retry_in", a.Retry, "error", err)
+		},
+	}
+}
+
+// UpdateBlocklist brings the blocklist up to date with the policy engine.
+// Once the proxy holds a policy it asks only for the changes since, and
+// falls back to fetching the whole policy if the engine can't give them.
+func (ps *ProxyServer) UpdateBlocklist() error {
+	ps.updateMutex.Lock()
+	defer ps.updateMutex.Unlock()
+	ps.blocklistMutex.RLock()
+	version, generatedAt := ps.version, ps.generatedAt
+	ps.blocklistMutex.RUnlock()
+
+	if version > 0 {
+		err := ps.applyChanges(version, generatedAt)
+		if err == nil {
+			return nil
+		}
+		ps.log.Warn("incremental update failed, fetching the full policy", "error", err)
+	}
+	return ps.fetchPolicy()
+}
+
+// fetchPolicy replaces the blocklist with the full policy, unless it is
+// older than the one held
+func (ps *ProxyServer) fetchPolicy() error {
+	var policy PolicyResponse
+	if err := ps.getJSON(ps.policyURL, cryptoutil.PolicyDocument, 0, &policy); err != nil {
+		return err
+	}
+
+	// Update the blocklist with write lock
+	ps.blocklistMutex.Lock()
+	defer ps.blocklistMutex.Unlock()
+	if policy.Version < ps.version || (policy.Version == ps.version && policy.GeneratedAt.Before(ps.generatedAt)) {
+		return fmt.Errorf("policy version %d generated at %s is older than the version %d held", policy.Version, policy.GeneratedAt.Format(time.RFC3339), ps.version)
+	}
+
+	// Clear and rebuild the blocklist
+	ps.blocklist = make(map[string]bool, len(policy.Blocked))
+	for _, domain := range policy.Blocked {
+		ps.blocklist[strings.ToLower(domain)] = true
+	}
+	ps.exact = make(map[string]bool, len(policy.Exact))
+	for _, host := range policy.Exact {
+		ps.exact[strings.ToLower(host)] = true
+	}
+	ps.wildcards = make(map[string]bool, len(policy.Wildcards))
+	for _, pattern := range policy.Wildcards {
+		ps.wildcards[strings.ToLower(pattern)] = true
+		ps.log.Debug("blocked pattern", "pattern", pattern)
+	}
+	ps.regexes = make(map[string]*regexp.Regexp, len(policy.Regexes))
+	for _, pattern := range policy.Regexes {
+		ps.addRegex(pattern)
+	}
+	ps.categories = policy.Categories
+	if ps.categories == nil {
+		ps.categories = make(map[string]PolicyCategory)
+	}
+	ps.rebuildCategories()
+	ps.version, ps.generatedAt = policy.Version, policy.GeneratedAt
+
+	ps.log.Info("blocklist updated", "version", ps.version,
+		"domains", len(ps.blocklist), "exact_hosts", len(ps.exact), "patterns", len(ps.wildcards), "regexes", len(ps.regexes),
+		"category_domains_blocked", len(ps.categoryBlocks), "domains_allowed", len(ps.allowlist))
+	return nil
+}
+
+// applyChanges fetches the changes since the policy held and applies them
+func (ps *ProxyServer) applyChanges(version int64, generatedAt time.Time) error {
+	u, err := url.Parse(ps.policyURL)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/changes"
+	q := u.Query()
+	q.Set("since", fmt.Sprint(version))
+	q.Set("since_time", generatedAt.Format(time.RFC3339Nano))
+	u.RawQuery = q.Encode()
+
+	var changes ChangesResponse
+	if err := ps.getJSON(u.String(), cryptoutil.ChangesDocument, version, &changes); err != nil {
+		return err
+	}
+	switch {
+	case changes.Since != version:
+		return fmt.Errorf("policy changes are from version %d, not the version %d held", changes.Since, version)
+	case changes.Version < version || changes.GeneratedAt.Before(generatedAt):
+		return fmt.Errorf("policy changes to version %d generated at %s are older than the version %d held", changes.Version, changes.GeneratedAt.Format(time.RFC3339), version)
+	}
+
+	ps.blocklistMutex.Lock()
+	defer ps.blocklistMutex.Unlock()
+	if ps.version != version {
+		return nil // a full fetch got there first
+	}
+	for _, domain := range changes.Added {
+		ps.blocklist[strings.ToLower(domain)] = true
+	}
+	for _, domain := range changes.Removed {
+		delete(ps.blocklist, strings.ToLower(domain))
+	}
+	for _, host := range changes.ExactAdded {
+		ps.exact[strings.ToLower(host)] = true
+	}
+	for _, host := range changes.ExactRemoved {
+		delete(ps.exact, strings.ToLower(host))
+	}
+	for _, pattern := range changes.WildcardsAdded {
+		ps.wildcards[strings.ToLower(pattern)] = true
+	}
+	for _, pattern := range changes.WildcardsRemoved {
+		delete(ps.wildcards, strings.ToLower(pattern))
+	}
+	for _, pattern := range changes.RegexesAdded {
+		ps.addRegex(pattern)
+	}
+	for _, pattern := range changes.RegexesRemoved {
+		delete(ps.regexes, pattern)
+	}
+	for name, category := range changes.Categories {
+		ps.categories[name] = category
+	}
+	for _, name := range changes.CategoriesRemoved {
+		delete(ps.categories, name)
+	}
+	if len(changes.Categories) > 0 || len(changes.CategoriesRemoved) > 0 {
+		ps.rebuildCategories()
+	}
+	ps.version, ps.generatedAt = changes.Version, changes.GeneratedAt
+
+	ps.log.Info("blocklist updated", "from_version", version, "version", changes.Version,
+		"domains_added", len(changes.Added), "domains_removed", len(changes.Removed),
+		"exact_hosts_added", len(changes.ExactAdded), "exact_hosts_removed", len(changes.ExactRemoved),
+		"patterns_added", len(changes.WildcardsAdded), "patterns_removed", len(changes.WildcardsRemoved),
+		"regexes_added", len(changes.RegexesAdded), "regexes_removed", len(changes.RegexesRemoved),
+		"categories_changed", len(changes.Categories), "categories_removed", len(changes.CategoriesRemoved))
+	return nil
+}
+
+// addRegex compiles a regex rule's pattern to match whole host names, as
+// the policy engine does; the caller holds the write lock. The engine
+// checks patterns before publishing them, so one that fails here is
+// logged and skipped rather than failing the update.
+func (ps *ProxyServer) addRegex(pattern string) {
+	re, err := hostmatch.Regex(pattern)
+	if err != nil {
+		ps.log.Warn("skipping invalid regex", "pattern", pattern, "error", err)
+		return
+	}
+	ps.regexes[pattern] = re
+}
+
+// rebuildCategories recomputes the category block, allow and trusted
+// lists from the categories; the caller holds the write lock
+func (ps *ProxyServer) rebuildCategories() {
+	ps.categoryBlocks = make(map[string]bool)
+	ps.allowlist = make(map[string]bool)
+	ps.trustedOnly = make(map[string]bool)
+	for name, category := range ps.categories {
+		list := ps.categoryBlocks
+		switch category.Action {
+		case "allow":
+			list = ps.allowlist
+		case "trusted":
+			list = ps.trustedOnly
+		}
+		for _, domain := range category.Domains {
+			list[strings.ToLower(domain)] = true
+		}
+		ps.log.Debug("category loaded", "category", name, "action", category.Action, "domains", len(category.Domains))
+	}
+}
+
+// getJSON fetches a policy document from the policy engine, checking its
+// signature first if the proxy has policy keys. document and since are
+// what the proxy asked for, a full policy or the changes since a version,
+// which the signature must cover.
+func (ps *ProxyServer) getJSON(rawURL, document string, since int64, v any) error {
+	resp, err := ps.client.Get(context.Background(), rawURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch policy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("policy engine returned status: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to fetch policy: %w", err)
+	}
+	var signed struct {
+		GeneratedAt time.Time `json:"generated_at"`
+	}
+	if err := json.Unmarshal(body, &signed); err != nil {
+		return fmt.Errorf("failed to decode policy: %w", err)
+	}
+	if err := ps.verifyPolicy(resp.Header, cryptoutil.PolicyMessage(body, document, since, signed.GeneratedAt)); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode policy: %w", err)
+	}
+	return nil
+}
+
+// verifyPolicy checks the policy engine's signature of a policy document,
+// msg as cryptoutil.PolicyMessage builds it, against the proxy's policy
+// keys. A document that is unsigned, or signed with another key or one
+// retired since, is rejected and the blocklist kept as it is.
+func (ps *ProxyServer) verifyPolicy(header http.Header, msg []byte) error {
+	if ps.policyKeys == nil {
+		return nil
+	}
+	keyID, sig, err := cryptoutil.Signature(header, "Policy")
+	switch {
+	case errors.Is(err, cryptoutil.ErrUnsigned):
+		return fmt.Errorf("policy is not signed")
+	case err != nil:
+		return fmt.Errorf("malformed policy signature: %w", err)
+	}
+	if err := ps.policyKeys.Verify(keyID, msg, sig); err != nil {
+		return fmt.Errorf("policy %w", err)
+	}
+	return nil
+}
+
+// RunPeriodicUpdate updates the blocklist and the feature flags every
+// interval until ctx is cancelled
+func (ps *ProxyServer) RunPeriodicUpdate(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ps.log.Debug("updating blocklist from policy engine")
+		if err := ps.UpdateBlocklist(); err != nil {
+			ps.log.Error("blocklist update failed", "error", err)
+		}
+		if err := ps.UpdateFlags(); err != nil {
+			ps.log.Warn("feature flag update failed", "error", err)
+		}
+	}
+}
+
+// IsBlocked checks if a domain is in the blocklist
+func (ps *ProxyServer) IsBlocked(host string) bool {
+	hitType, _ := ps.match(host)
+	return hitType != "" && hitType != hitAllow
+}
+
+// Hit types, naming the policy list an entry matched in
+const (
+	hitDomain   = "domain"
+	hitExact    = "exact"
+	hitWildcard = "wildcard"
+	hitRegex    = "regex"
+	hitCategory = "category"
+	hitAllow    = "allow"
+	hitTrusted  = "trusted"
+)
+
+// match returns the policy entry a host matches and the list it is in, or
+// "" for neither if no entry matches
+func (ps *ProxyServer) match(host string) (hitType, entry string) {
+	ps.blocklistMutex.RLock()
+	defer ps.blocklistMutex.RUnlock()
+
+	// Remove port if present
+	domain := strings.Split(host, ":")[0]
+	domain = strings.ToLower(domain)
+
+	// Allowed categories win over everything else
+	parts := strings.Split(domain, ".")
+	if entry, ok := matchDomain(ps.allowlist, parts); ok {
+		return hitAllow, entry
+	}
+
+	if ps.exact[domain] {
+		return hitExact, domain
+	}
+	if entry, ok := matchDomain(ps.blocklist, parts); ok {
+		return hitDomain, entry
+	}
+	if entry, ok := matchDomain(ps.categoryBlocks, parts); ok {
+		return hitCategory, entry
+	}
+	if entry, ok := matchDomain(ps.trustedOnly, parts); ok {
+		return hitTrusted, entry
+	}
+
+	// Check wildcard patterns label by label
+	for pattern := range ps.wildcards {
+		if hostmatch.Wildcard(pattern, parts) {
+			return hitWildcard, pattern
+		}
+	}
+	for pattern, re := range ps.regexes {
+		if re.MatchString(domain) {
+			return hitRegex, pattern
+		}
+	}
+
+	return "", ""
+}
+
+// matchDomain returns the host or the parent domain of it that is in the
+// set (e.g., www.facebook.com matches facebook.com)
+func matchDomain(set map[string]bool, labels []string) (string, bool) {
+	for i := range labels {
+		if d := strings.Join(labels[i:], "."); set[d] {
+			return d, true
+		}
+	}
+	return "", false
+}
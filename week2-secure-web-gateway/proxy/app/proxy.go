@@ -0,0 +1,327 @@
+// Package app is the secure web gateway's filtering proxy, which the
+// proxy's own binary and the unified swg binary run
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisatyap/shared/audit"
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/httpclient"
+	"github.com/nisatyap/shared/logging"
+	"github.com/nisatyap/shared/posturetoken"
+)
+
+// version is the proxy release; override at build time with
+// -ldflags "-X github.com/nisatyap/week2-swg/proxy/app.version=1.2.3"
+var version = "1.0.0"
+
+// auditService names the proxy in audit events and syslog
+const auditService = "swg-proxy"
+
+// ProxyServer handles HTTP proxy requests with domain blocking
+type ProxyServer struct {
+	blocklist      map[string]bool // domains of rules and imported blocklists
+	exact          map[string]bool // host names blocked without their subdomains
+	wildcards      map[string]bool
+	regexes        map[string]*regexp.Regexp // by pattern
+	categories     map[string]PolicyCategory
+	categoryBlocks map[string]bool // domains of block categories
+	allowlist      map[string]bool // domains of allow categories, which win over blocks
+	trustedOnly    map[string]bool // domains of trusted categories, for compliant devices only
+	version        int64           // policy version held; 0 until the first update
+	generatedAt    time.Time       // when the policy engine chose the rules held
+	blocklistMutex sync.RWMutex
+	updateMutex    sync.Mutex // one update at a time, polled or pushed
+	policyURL      string
+	client         *httpclient.Client // for the policy engine
+	hits           hitCounter
+	// hitsToken signs the hit reports in to the policy engine, which needs
+	// a user's token with the viewer role unless it runs without auth
+	hitsToken string
+	// policyKeys verify the policy engine's signatures; with none,
+	// policies are applied unverified
+	policyKeys *cryptoutil.KeyRing
+	// postureTokens verifies the tokens devices present to reach trusted
+	// categories; with none, trusted categories are blocked for everyone
+	postureTokens *posturetoken.Verifier
+	// quarantined holds the devices the collector's posture events put in
+	// quarantine, by tenant and device ID
+	quarantined    map[deviceKey]quarantine
+	quarantineFor  time.Duration // after a tamper alert
+	quarantineTTL  time.Duration // how long an entry is kept at most
+	quarantineLock sync.Mutex
+	// features are the flags the proxy checks, set by -features and the
+	// policy engine's GET /flags at flagsURL
+	features *flags.Set
+	flagsURL string
+	// mitmCA signs the certificates HTTPS is intercepted with, for devices
+	// the mitm flag is on for; with none, HTTPS is tunnelled
+	mitmCA    *tls.Certificate
+	mitmCerts map[string]*tls.Certificate // by host name
+	mitmLock  sync.Mutex
+	// audit records the requests blocked and the admin port's sign-ins;
+	// with none, they are only logged
+	audit  *audit.Log
+	logins *audit.Logins
+	log    *slog.Logger
+}
+
+// NewProxyServer creates a new proxy server instance
+func NewProxyServer(policyURL string, logger *slog.Logger) *ProxyServer {
+	client, _ := httpclient.New(policyClientOptions(logger)) // fails only for a bad proxy URL
+	hostname, _ := os.Hostname()
+	features := flags.New(hostname, proxyFlags...)
+	features.SetLogger(logger)
+	return &ProxyServer{
+		blocklist:      make(map[string]bool),
+		exact:          make(map[string]bool),
+		wildcards:      make(map[string]bool),
+		regexes:        make(map[string]*regexp.Regexp),
+		categories:     make(map[string]PolicyCategory),
+		categoryBlocks: make(map[string]bool),
+		allowlist:      make(map[string]bool),
+		trustedOnly:    make(map[string]bool),
+		quarantined:    make(map[deviceKey]quarantine),
+		quarantineTTL:  DefaultQuarantineTTL,
+		policyURL:      policyURL,
+		client:         client,
+		features:       features,
+		flagsURL:       flagsURL(policyURL),
+		mitmCerts:      make(map[string]*tls.Certificate),
+		log:            logger,
+	}
+}
+
+// ServeHTTP handles incoming proxy requests
+func (ps *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+
+	ctx := r.Context()
+	posture, postureErr := ps.devicePosture(r)
+	if postureErr == nil {
+		ctx = logging.WithDeviceID(ctx, posture.DeviceID)
+	}
+	ps.log.DebugContext(ctx, "request", "method", r.Method, "host", host, "remote_addr", r.RemoteAddr)
+
+	if !ps.hasPolicy() && ps.features.Enabled(flags.FailClosed) {
+		ps.log.WarnContext(ctx, "blocked", "host", host, "reason", "no policy loaded", "remote_addr", r.RemoteAddr)
+		ps.auditBlock(ctx, r, host, posture, postureErr, "no policy loaded")
+		ps.serveBlockedPage(w, host, "Websites are blocked until this gateway has loaded your organization's security policy. Please try again shortly.")
+		return
+	}
+
+	// Intercepted HTTPS requests are checked one by one below, as they
+	// come through the connection intercepted
+	if r.Method == http.MethodConnect && ps.mitmCA != nil && ps.features.EnabledFor(flags.MITM, rolloutUnit(r, posture, postureErr)) {
+		ps.log.InfoContext(ctx, "intercepting", "host", host, "remote_addr", r.RemoteAddr)
+		ps.intercept(w, r)
+		return
+	}
+
+	// Check if the domain is blocked
+	hitType, entry := ps.match(host)
+	if hitType != "" {
+		ps.hits.record(hitType, entry)
+	}
+	if hitType == hitTrusted {
+		// Trusted categories are for devices the collector found compliant
+		if postureErr == nil && !posture.Compliant {
+			postureErr = fmt.Errorf("device %s is %s", posture.DeviceID, posture.Status)
+		}
+		if postureErr == nil {
+			postureErr = ps.checkQuarantine(posture)
+		}
+		if postureErr != nil {
+			ps.log.InfoContext(ctx, "blocked", "host", host, "match", hitType, "entry", entry, "remote_addr", r.RemoteAddr, "posture", postureErr)
+			ps.auditBlock(ctx, r, host, posture, postureErr, fmt.Sprintf("%s %s: %v", hitType, entry, postureErr))
+			ps.serveBlockedPage(w, host, "This website is only available from trusted devices that meet your organization's security requirements: "+postureErr.Error()+".")
+			return
+		}
+	} else if hitType != "" && hitType != hitAllow {
+		ps.log.InfoContext(ctx, "blocked", "host", host, "match", hitType, "entry", entry, "remote_addr", r.RemoteAddr)
+		ps.auditBlock(ctx, r, host, posture, postureErr, hitType+" "+entry)
+		ps.serveBlockedPage(w, host, "The website you are trying to access has been blocked by your organization's security policy.")
+		return
+	}
+
+	// Allow the request - forward it to the actual destination
+	ps.log.InfoContext(ctx, "allowed", "method", r.Method, "host", host, "remote_addr", r.RemoteAddr)
+	if r.Method == http.MethodConnect {
+		ps.tunnel(w, r)
+		return
+	}
+	ps.forwardRequest(w, r)
+}
+
+// auditBlock records a request to host blocked for reason in the audit log,
+// by its device if it presented a valid posture token and by its client's
+// address otherwise
+func (ps *ProxyServer) auditBlock(ctx context.Context, r *http.Request, host string, posture posturetoken.Claims, postureErr error, reason string) {
+	if ps.audit == nil {
+		return
+	}
+	ps.blocklistMutex.RLock()
+	version := ps.version
+	ps.blocklistMutex.RUnlock()
+	e := audit.Event{Actor: rolloutUnit(r, posture, postureErr), Address: r.RemoteAddr, Action: audit.ActionBlock,
+		Object: "host " + host, Outcome: audit.OutcomeDenied, Detail: reason, Version: version}
+	if _, err := ps.audit.Record(ctx, e); err != nil {
+		ps.log.ErrorContext(ctx, "failed to audit block", "host", host, "error", err)
+	}
+}
+
+// rolloutUnit is what a percentage of a flag is rolled out across for a
+// request: its device, or its client's address if it has no posture token
+func rolloutUnit(r *http.Request, posture posturetoken.Claims, postureErr error) string {
+	if postureErr == nil {
+		return posture.DeviceID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hasPolicy reports whether the proxy has loaded a policy yet
+func (ps *ProxyServer) hasPolicy() bool {
+	ps.blocklistMutex.RLock()
+	defer ps.blocklistMutex.RUnlock()
+	return ps.version > 0
+}
+
+// serveBlockedPage returns a 403 Forbidden page explaining why with message
+func (ps *ProxyServer) serveBlockedPage(w http.ResponseWriter, host, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+
+	html := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Access Denied</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
+            display: flex;
+            justify-content: center;
+            align-items: center;
+            height: 100vh;
+            margin: 0;
+        }
+        .container {
+            background: white;
+            padding: 40px;
+            border-radius: 10px;
+            box-shadow: 0 10px 40px rgba(0,0,0,0.3);
+            text-align: center;
+            max-width: 500px;
+        }
+        h1 {
+            color: #e74c3c;
+            margin-top: 0;
+        }
+        .blocked-icon {
+            font-size: 72px;
+            color: #e74c3c;
+        }
+        .domain {
+            background: #f8f9fa;
+            padding: 10px;
+            border-radius: 5px;
+            margin: 20px 0;
+            font-family: monospace;
+            word-break: break-all;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="blocked-icon">🚫</div>
+        <h1>Access Denied by Cisco Security</h1>
+        <p>%s</p>
+        <div class="domain">%s</div>
+        <p><small>If you believe this is an error, please contact your IT administrator.</small></p>
+    </div>
+</body>
+</html>`, html.EscapeString(message), html.EscapeString(host))
+
+	fmt.Fprint(w, html)
+}
+
+// forwardRequest forwards the request to the actual destination
+func (ps *ProxyServer) forwardRequest(w http.ResponseWriter, r *http.Request) {
+	// Build the target URL
+	targetURL := r.URL.String()
+	if !strings.HasPrefix(targetURL, "http") {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		targetURL = fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+		if r.URL.RawQuery != "" {
+			targetURL += "?" + r.URL.RawQuery
+		}
+	}
+
+	// Create a new request
+	proxyReq, err := http.NewRequest(r.Method, targetURL, r.Body)
+	if err != nil {
+		http.Error(w, "Error creating proxy request", http.StatusInternalServerError)
+		ps.log.ErrorContext(r.Context(), "creating the upstream request failed", "url", targetURL, "error", err)
+		return
+	}
+
+	// Copy headers, but not the device's posture token, which is for the
+	// proxy alone
+	for key, values := range r.Header {
+		for _, value := range values {
+			proxyReq.Header.Add(key, value)
+		}
+	}
+	posturetoken.Strip(proxyReq.Header)
+
+	// Execute the request
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // Don't follow redirects
+		},
+	}
+
+	resp, err := client.Do(proxyReq)
+	if err != nil {
+		http.Error(w, "Error forwarding request", http.StatusBadGateway)
+		ps.log.WarnContext(r.Context(), "forwarding failed", "url", targetURL, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Copy response headers
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	// Write status code and body
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
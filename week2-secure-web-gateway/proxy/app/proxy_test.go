@@ -0,0 +1,762 @@
+package app
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisatyap/shared/cryptoutil"
+	"github.com/nisatyap/shared/eventbus"
+	"github.com/nisatyap/shared/flags"
+	"github.com/nisatyap/shared/posturetoken"
+)
+
+// newTestProxy returns a proxy for policyURL holding a policy at version 1
+// with the given lists
+func newTestProxy(t *testing.T, policyURL string, policy PolicyResponse) *ProxyServer {
+	t.Helper()
+	ps := NewProxyServer(policyURL, slog.Default())
+	for _, domain := range policy.Blocked {
+		ps.blocklist[domain] = true
+	}
+	for _, host := range policy.Exact {
+		ps.exact[host] = true
+	}
+	for _, pattern := range policy.Wildcards {
+		ps.wildcards[pattern] = true
+	}
+	for _, pattern := range policy.Regexes {
+		ps.addRegex(pattern)
+	}
+	for name, category := range policy.Categories {
+		ps.categories[name] = category
+	}
+	ps.rebuildCategories()
+	ps.version, ps.generatedAt = 1, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return ps
+}
+
+func TestMatch(t *testing.T) {
+	ps := newTestProxy(t, "http://policy.invalid/policy", PolicyResponse{
+		Blocked:   []string{"facebook.com"},
+		Exact:     []string{"ads.example.com"},
+		Wildcards: []string{"*.tracker.net", "cdn-*.example.org"},
+		Regexes:   []string{`[a-z]+\d+\.bad\.io`},
+		Categories: map[string]PolicyCategory{
+			"gambling": {Action: "block", Domains: []string{"casino.com"}},
+			"partners": {Action: "allow", Domains: []string{"ok.facebook.com"}},
+			"finance":  {Action: "trusted", Domains: []string{"bank.com"}},
+		},
+	})
+
+	tests := []struct {
+		host      string
+		wantType  string
+		wantEntry string
+	}{
+		{"facebook.com", hitDomain, "facebook.com"},
+		{"www.facebook.com", hitDomain, "facebook.com"},
+		{"WWW.Facebook.COM", hitDomain, "facebook.com"},
+		{"www.facebook.com:443", hitDomain, "facebook.com"},
+		{"notfacebook.com", "", ""},
+		{"ok.facebook.com", hitAllow, "ok.facebook.com"},
+		{"api.ok.facebook.com:8443", hitAllow, "ok.facebook.com"},
+		{"ads.example.com", hitExact, "ads.example.com"},
+		{"ads.example.com:80", hitExact, "ads.example.com"},
+		{"www.ads.example.com", "", ""},
+		{"a.tracker.net", hitWildcard, "*.tracker.net"},
+		{"tracker.net", "", ""},
+		{"a.b.tracker.net", "", ""},
+		{"cdn-eu.example.org:443", hitWildcard, "cdn-*.example.org"},
+		{"img.example.org", "", ""},
+		{"host42.bad.io", hitRegex, `[a-z]+\d+\.bad\.io`},
+		{"host42.bad.io:8080", hitRegex, `[a-z]+\d+\.bad\.io`},
+		{"x.host42.bad.io", "", ""},
+		{"poker.casino.com", hitCategory, "casino.com"},
+		{"online.bank.com", hitTrusted, "bank.com"},
+		{"example.com", "", ""},
+	}
+	for _, tt := range tests {
+		gotType, gotEntry := ps.match(tt.host)
+		if gotType != tt.wantType || gotEntry != tt.wantEntry {
+			t.Errorf("match(%q) = %q, %q, want %q, %q", tt.host, gotType, gotEntry, tt.wantType, tt.wantEntry)
+		}
+		blocked := tt.wantType != "" && tt.wantType != hitAllow
+		if got := ps.IsBlocked(tt.host); got != blocked {
+			t.Errorf("IsBlocked(%q) = %v, want %v", tt.host, got, blocked)
+		}
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	set := map[string]bool{"example.com": true, "deep.sub.test.org": true}
+	tests := []struct {
+		host      string
+		wantEntry string
+		wantOK    bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "example.com", true},
+		{"a.b.c.example.com", "example.com", true},
+		{"example.com.evil.net", "", false},
+		{"myexample.com", "", false},
+		{"com", "", false},
+		{"sub.test.org", "", false},
+		{"x.deep.sub.test.org", "deep.sub.test.org", true},
+	}
+	for _, tt := range tests {
+		entry, ok := matchDomain(set, strings.Split(tt.host, "."))
+		if entry != tt.wantEntry || ok != tt.wantOK {
+			t.Errorf("matchDomain(%q) = %q, %v, want %q, %v", tt.host, entry, ok, tt.wantEntry, tt.wantOK)
+		}
+	}
+}
+
+func TestReportHits(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		wantAuthz string
+	}{
+		{"with a token", "proxy-token", "Bearer proxy-token"},
+		{"without a token", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var authz string
+			var report struct {
+				Hits []hit `json:"hits"`
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authz = r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&report)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+
+			ps := NewProxyServer(srv.URL+"/policy", slog.Default())
+			ps.hitsToken = tt.token
+			ps.hits.record(hitDomain, "facebook.com")
+			ps.hits.record(hitDomain, "facebook.com")
+			ps.reportHits(context.Background(), srv.URL+"/policy/hits")
+			if authz != tt.wantAuthz {
+				t.Errorf("Authorization = %q, want %q", authz, tt.wantAuthz)
+			}
+			if len(report.Hits) != 1 || report.Hits[0].Entry != "facebook.com" || report.Hits[0].Count != 2 {
+				t.Errorf("reported %+v", report.Hits)
+			}
+		})
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	base := PolicyResponse{
+		Blocked:   []string{"old.com", "kept.com"},
+		Exact:     []string{"ads.old.com"},
+		Wildcards: []string{"*.old.net"},
+		Regexes:   []string{`old\d+\.io`},
+		Categories: map[string]PolicyCategory{
+			"gambling": {Action: "block", Domains: []string{"casino.com"}},
+			"social":   {Action: "block", Domains: []string{"social.com"}},
+		},
+	}
+	newAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		changes     ChangesResponse
+		held        int64 // the version the proxy holds when the changes arrive
+		wantVersion int64
+		blocked     []string
+		allowed     []string
+	}{
+		{
+			name: "adds and removes entries of every list",
+			changes: ChangesResponse{
+				Since: 1, Version: 2, GeneratedAt: newAt,
+				Added: []string{"New.com"}, Removed: []string{"old.com"},
+				ExactAdded: []string{"ads.new.com"}, ExactRemoved: []string{"ads.old.com"},
+				WildcardsAdded: []string{"*.new.net"}, WildcardsRemoved: []string{"*.old.net"},
+				RegexesAdded: []string{`new\d+\.io`}, RegexesRemoved: []string{`old\d+\.io`},
+				Categories:        map[string]PolicyCategory{"gambling": {Action: "allow", Domains: []string{"casino.com"}}},
+				CategoriesRemoved: []string{"social"},
+			},
+			held:        1,
+			wantVersion: 2,
+			blocked:     []string{"www.new.com", "kept.com", "ads.new.com", "a.new.net", "new1.io"},
+			allowed:     []string{"old.com", "ads.old.com", "a.old.net", "old1.io", "casino.com", "social.com"},
+		},
+		{
+			name:        "empty changes move the version on",
+			changes:     ChangesResponse{Since: 1, Version: 2, GeneratedAt: newAt},
+			held:        1,
+			wantVersion: 2,
+			blocked:     []string{"old.com", "kept.com", "ads.old.com", "a.old.net", "old1.io", "casino.com", "social.com"},
+		},
+		{
+			name:        "changes for a version since replaced are dropped",
+			changes:     ChangesResponse{Since: 1, Version: 2, GeneratedAt: newAt, Added: []string{"new.com"}, Removed: []string{"old.com"}},
+			held:        5,
+			wantVersion: 5,
+			blocked:     []string{"old.com", "kept.com"},
+			allowed:     []string{"new.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/policy/changes" {
+					http.NotFound(w, r)
+					return
+				}
+				query = r.URL.RawQuery
+				json.NewEncoder(w).Encode(tt.changes)
+			}))
+			defer srv.Close()
+
+			ps := newTestProxy(t, srv.URL+"/api/policy", base)
+			since := ps.generatedAt
+			ps.version = tt.held
+			if err := ps.applyChanges(1, since); err != nil {
+				t.Fatalf("applyChanges: %v", err)
+			}
+			if want := fmt.Sprintf("since=1&since_time=%s", strings.ReplaceAll(since.Format(time.RFC3339Nano), ":", "%3A")); query != want {
+				t.Errorf("query = %q, want %q", query, want)
+			}
+			if ps.version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", ps.version, tt.wantVersion)
+			}
+			for _, host := range tt.blocked {
+				if !ps.IsBlocked(host) {
+					t.Errorf("%s is allowed, want it blocked", host)
+				}
+			}
+			for _, host := range tt.allowed {
+				if ps.IsBlocked(host) {
+					t.Errorf("%s is blocked, want it allowed", host)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyPolicy(t *testing.T) {
+	signer, err := cryptoutil.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cryptoutil.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"blocked":["example.com"],"version":2}`)
+	signed := func(s *cryptoutil.Signer, data []byte) http.Header {
+		h := make(http.Header)
+		cryptoutil.SetSignature(h, "Policy", s.ID(), s.Sign(data))
+		return h
+	}
+	malformed := make(http.Header)
+	malformed.Set("X-Policy-Signature", "not base64!")
+	malformed.Set("X-Policy-Key-ID", signer.ID())
+
+	tests := []struct {
+		name    string
+		keys    *cryptoutil.KeyRing
+		header  http.Header
+		wantErr string
+	}{
+		{"signed", cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: signer.PublicKey()}), signed(signer, body), ""},
+		{"unsigned", cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: signer.PublicKey()}), make(http.Header), "policy is not signed"},
+		{"malformed signature", cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: signer.PublicKey()}), malformed, "malformed policy signature"},
+		{"another body's signature", cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: signer.PublicKey()}), signed(signer, []byte("{}")), "policy"},
+		{"untrusted key", cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: signer.PublicKey()}), signed(other, body), "policy"},
+		{"retired key", cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: signer.PublicKey(), Expires: time.Now().Add(-time.Hour)}), signed(signer, body), "policy"},
+		{"no policy keys", nil, make(http.Header), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := NewProxyServer("http://policy.invalid/policy", slog.Default())
+			ps.policyKeys = tt.keys
+			err := ps.verifyPolicy(tt.header, body)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("verifyPolicy: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("verifyPolicy succeeded, want an error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("verifyPolicy: %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// signedDocument is a policy document as the policy engine sent it,
+// signed for the request it answered
+type signedDocument struct {
+	document string
+	since    int64
+	body     any
+}
+
+func TestPolicyReplay(t *testing.T) {
+	signer, err := cryptoutil.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2, t3 := t1.Add(time.Hour), t1.Add(2*time.Hour)
+	v1 := signedDocument{cryptoutil.PolicyDocument, 0, PolicyResponse{Blocked: []string{"old.com"}, Version: 1, GeneratedAt: t1}}
+	v2 := signedDocument{cryptoutil.PolicyDocument, 0, PolicyResponse{Blocked: []string{"kept.com"}, Version: 2, GeneratedAt: t2}}
+	delta12 := signedDocument{cryptoutil.ChangesDocument, 1, ChangesResponse{Since: 1, Version: 2, GeneratedAt: t2, Added: []string{"kept.com"}, Removed: []string{"old.com"}}}
+	delta23 := signedDocument{cryptoutil.ChangesDocument, 2, ChangesResponse{Since: 2, Version: 3, GeneratedAt: t3, Added: []string{"new.com"}}}
+
+	tests := []struct {
+		name     string
+		policy   signedDocument // served at /policy, fetched if changes is unset
+		changes  signedDocument // served at /policy/changes
+		unsigned bool
+		blocked  []string // with version 2 of the policy held
+		allowed  []string
+		wantErr  string
+	}{
+		{name: "current delta", policy: v2, changes: delta23, blocked: []string{"kept.com", "new.com"}},
+		{name: "older policy", policy: v1, blocked: []string{"kept.com"}, allowed: []string{"old.com"}, wantErr: "older than the version 2 held"},
+		{name: "delta from another version", policy: v2, changes: delta12, blocked: []string{"kept.com"}, allowed: []string{"old.com"}, wantErr: "signature does not verify"},
+		{name: "unsigned delta from another version", policy: v2, changes: delta12, unsigned: true, blocked: []string{"kept.com"}, wantErr: "from version 1, not the version 2 held"},
+		{name: "delta in place of the policy", policy: delta23, blocked: []string{"kept.com"}, wantErr: "signature does not verify"},
+		{name: "policy in place of a delta", policy: v2, changes: v1, blocked: []string{"kept.com"}, allowed: []string{"old.com"}, wantErr: "signature does not verify"},
+		{name: "unsigned policy in place of a delta", policy: v2, changes: v2, unsigned: true, blocked: []string{"kept.com"}, wantErr: "from version 0, not the version 2 held"},
+		{name: "unsigned older policy", policy: v1, unsigned: true, blocked: []string{"kept.com"}, allowed: []string{"old.com"}, wantErr: "older than the version 2 held"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				doc := tt.policy
+				if r.URL.Path == "/policy/changes" {
+					doc = tt.changes
+				}
+				if doc.body == nil {
+					http.Error(w, "gone", http.StatusGone)
+					return
+				}
+				body, _ := json.Marshal(doc.body)
+				var at struct {
+					GeneratedAt time.Time `json:"generated_at"`
+				}
+				json.Unmarshal(body, &at)
+				if !tt.unsigned {
+					cryptoutil.SetSignature(w.Header(), "Policy", signer.ID(), signer.Sign(cryptoutil.PolicyMessage(body, doc.document, doc.since, at.GeneratedAt)))
+				}
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			ps := newTestProxy(t, srv.URL+"/policy", PolicyResponse{Blocked: []string{"kept.com"}})
+			ps.version, ps.generatedAt = 2, t2
+			if !tt.unsigned {
+				ps.policyKeys = cryptoutil.NewKeyRing(cryptoutil.PublicKey{Key: signer.PublicKey()})
+			}
+			var err error
+			if tt.changes.body != nil {
+				err = ps.applyChanges(2, t2)
+			} else {
+				err = ps.fetchPolicy()
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("update: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("update succeeded, want an error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("update: %v, want an error containing %q", err, tt.wantErr)
+			}
+			for _, host := range tt.blocked {
+				if !ps.IsBlocked(host) {
+					t.Errorf("%s is allowed, want it blocked", host)
+				}
+			}
+			for _, host := range tt.allowed {
+				if ps.IsBlocked(host) {
+					t.Errorf("%s is blocked, want it allowed", host)
+				}
+			}
+		})
+	}
+}
+
+// postureFixture is a proxy trusting an issuer's posture tokens
+type postureFixture struct {
+	ps     *ProxyServer
+	issuer *posturetoken.Issuer
+}
+
+func newPostureFixture(t *testing.T, policyURL string, policy PolicyResponse) postureFixture {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := posturetoken.NewIssuer(key)
+	ps := newTestProxy(t, policyURL, policy)
+	ps.postureTokens = posturetoken.NewVerifier(issuer.PublicKey())
+	ps.quarantineFor = time.Hour
+	return postureFixture{ps: ps, issuer: issuer}
+}
+
+// token issues a token for device, issued at issuedAt
+func (f postureFixture) token(t *testing.T, device, status string, issuedAt time.Time) string {
+	t.Helper()
+	return f.tenantToken(t, "", device, status, issuedAt)
+}
+
+// tenantToken issues a token for device in tenant, issued at issuedAt
+func (f postureFixture) tenantToken(t *testing.T, tenant, device, status string, issuedAt time.Time) string {
+	t.Helper()
+	token, err := f.issuer.Issue(posturetoken.Claims{
+		DeviceID: device, Tenant: tenant, Compliant: status == "HEALTHY", Status: status, Score: 100, IssuedAt: issuedAt,
+	}, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func event(t *testing.T, subject string, data any) eventbus.Event {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eventbus.Event{Subject: subject, Time: time.Now(), Data: raw}
+}
+
+func TestDevicePosture(t *testing.T) {
+	f := newPostureFixture(t, "http://policy.invalid/policy", PolicyResponse{})
+	other := newPostureFixture(t, "http://policy.invalid/policy", PolicyResponse{})
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		verify  bool // whether the proxy verifies posture tokens
+		wantErr bool
+	}{
+		{"token header", http.Header{posturetoken.HeaderToken: {f.token(t, "dev-1", "HEALTHY", now)}}, true, false},
+		{"proxy authorization", http.Header{posturetoken.HeaderProxyAuthz: {"Bearer " + f.token(t, "dev-1", "HEALTHY", now)}}, true, false},
+		{"no token", http.Header{}, true, true},
+		{"another issuer's token", http.Header{posturetoken.HeaderToken: {other.token(t, "dev-1", "HEALTHY", now)}}, true, true},
+		{"expired token", http.Header{posturetoken.HeaderToken: {f.token(t, "dev-1", "HEALTHY", now.Add(-48*time.Hour))}}, true, true},
+		{"garbage", http.Header{posturetoken.HeaderToken: {"not.a.token"}}, true, true},
+		{"proxy without a verifier", http.Header{posturetoken.HeaderToken: {f.token(t, "dev-1", "HEALTHY", now)}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := f.ps
+			if !tt.verify {
+				ps = NewProxyServer("http://policy.invalid/policy", slog.Default())
+			}
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			r.Header = tt.header
+			claims, err := ps.devicePosture(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("devicePosture: %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && claims.DeviceID != "dev-1" {
+				t.Errorf("device = %q, want dev-1", claims.DeviceID)
+			}
+		})
+	}
+}
+
+func TestOnPostureEvent(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tamper := event(t, eventbus.SubjectPostureTamper, eventbus.TamperAlert{DeviceID: "dev-1", Summary: "agent binary changed", Time: at})
+	degraded := event(t, eventbus.SubjectPostureChanged, eventbus.PostureChange{DeviceID: "dev-1", From: "HEALTHY", To: "DEGRADED", Time: at})
+	healthy := event(t, eventbus.SubjectPostureChanged, eventbus.PostureChange{DeviceID: "dev-1", From: "DEGRADED", To: "HEALTHY", Time: at.Add(time.Minute)})
+
+	tests := []struct {
+		name       string
+		events     []eventbus.Event
+		expired    bool // whether a tamper quarantine has run out before the last event
+		wantHeld   bool
+		wantReason string
+		wantUntil  bool // whether the quarantine refuses every token for a while
+	}{
+		{"tamper", []eventbus.Event{tamper}, false, true, "agent binary changed", true},
+		{"status change", []eventbus.Event{degraded}, false, true, "device dev-1 is DEGRADED", false},
+		{"recovery", []eventbus.Event{degraded, healthy}, false, false, "", false},
+		{"recovery during a tamper quarantine", []eventbus.Event{tamper, healthy}, false, true, "agent binary changed", true},
+		{"status change during a tamper quarantine", []eventbus.Event{tamper, degraded}, false, true, "agent binary changed", true},
+		{"recovery after a tamper quarantine", []eventbus.Event{tamper, healthy}, true, false, "", false},
+		{"healthy device", []eventbus.Event{healthy}, false, false, "", false},
+		{"other subject", []eventbus.Event{event(t, "posture.enrolled", eventbus.PostureChange{DeviceID: "dev-1", To: "ENROLLED"})}, false, false, "", false},
+		{"malformed", []eventbus.Event{{Subject: eventbus.SubjectPostureTamper, Data: json.RawMessage(`[`)}}, false, false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := NewProxyServer("http://policy.invalid/policy", slog.Default())
+			ps.quarantineFor = time.Hour
+			for i, e := range tt.events {
+				if tt.expired && i == len(tt.events)-1 {
+					q := ps.quarantined[deviceKey{"", "dev-1"}]
+					q.until = time.Now().Add(-time.Second)
+					ps.quarantined[deviceKey{"", "dev-1"}] = q
+				}
+				ps.onPostureEvent(e)
+			}
+			q, held := ps.quarantined[deviceKey{"", "dev-1"}]
+			if held != tt.wantHeld {
+				t.Fatalf("quarantined = %v, want %v", held, tt.wantHeld)
+			}
+			if q.reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", q.reason, tt.wantReason)
+			}
+			if got := time.Now().Before(q.until); got != tt.wantUntil {
+				t.Errorf("tamper quarantine in force = %v, want %v", got, tt.wantUntil)
+			}
+			if held && !q.expires.After(time.Now().Add(ps.quarantineTTL-time.Minute)) {
+				t.Errorf("expires = %v, want %v from now", q.expires, ps.quarantineTTL)
+			}
+		})
+	}
+}
+
+func TestOnPostureEventByTenant(t *testing.T) {
+	at := time.Now().Add(-time.Minute)
+	ps := NewProxyServer("http://policy.invalid/policy", slog.Default())
+	ps.quarantineFor = time.Hour
+	ps.onPostureEvent(event(t, eventbus.SubjectPostureTamper, eventbus.TamperAlert{DeviceID: "dev-1", Tenant: "acme", Summary: "tampered", Time: at}))
+	ps.onPostureEvent(event(t, eventbus.SubjectPostureChanged, eventbus.PostureChange{DeviceID: "dev-1", Tenant: "globex", To: "DEGRADED", Time: at}))
+	// Another tenant's device of the same ID recovering leaves acme's be
+	ps.onPostureEvent(event(t, eventbus.SubjectPostureChanged, eventbus.PostureChange{DeviceID: "dev-1", Tenant: "initech", To: "HEALTHY", Time: at}))
+
+	want := map[deviceKey]string{
+		{"acme", "dev-1"}:   "tampered",
+		{"globex", "dev-1"}: "device dev-1 is DEGRADED",
+	}
+	if len(ps.quarantined) != len(want) {
+		t.Errorf("quarantined = %v, want %v", ps.quarantined, want)
+	}
+	for key, reason := range want {
+		if q := ps.quarantined[key]; q.reason != reason {
+			t.Errorf("quarantined[%v] reason = %q, want %q", key, q.reason, reason)
+		}
+	}
+
+	f := newPostureFixture(t, "http://policy.invalid/policy", PolicyResponse{})
+	f.ps.quarantined = ps.quarantined
+	for _, tc := range []struct {
+		tenant  string
+		wantErr bool
+	}{
+		{"acme", true},
+		{"globex", true},
+		{"initech", false},
+		{"", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://bank.com/", nil)
+		r.Header.Set(posturetoken.HeaderToken, f.tenantToken(t, tc.tenant, "dev-1", "HEALTHY", at.Add(-time.Hour)))
+		claims, err := f.ps.devicePosture(r)
+		if err != nil {
+			t.Fatalf("devicePosture: %v", err)
+		}
+		if err := f.ps.checkQuarantine(claims); (err != nil) != tc.wantErr {
+			t.Errorf("checkQuarantine(tenant %q): %v, want error %v", tc.tenant, err, tc.wantErr)
+		}
+	}
+}
+
+func TestQuarantineExpires(t *testing.T) {
+	ps := NewProxyServer("http://policy.invalid/policy", slog.Default())
+	ps.quarantineFor = time.Hour
+	ps.quarantineTTL = 30 * time.Minute
+	at := time.Now()
+	ps.onPostureEvent(event(t, eventbus.SubjectPostureTamper, eventbus.TamperAlert{DeviceID: "dev-1", Summary: "tampered", Time: at}))
+	ps.onPostureEvent(event(t, eventbus.SubjectPostureChanged, eventbus.PostureChange{DeviceID: "dev-2", To: "UNHEALTHY", Time: at}))
+
+	// A tamper quarantine is kept at least as long as it refuses every token
+	if q := ps.quarantined[deviceKey{"", "dev-1"}]; q.expires.Before(q.until) {
+		t.Errorf("tamper quarantine expires at %v, before it ends at %v", q.expires, q.until)
+	}
+	if q := ps.quarantined[deviceKey{"", "dev-2"}]; q.expires.After(time.Now().Add(ps.quarantineTTL)) {
+		t.Errorf("status quarantine expires at %v, later than -quarantine-ttl", q.expires)
+	}
+
+	// Expired entries are dropped by the next event, whatever device it is for
+	for key, q := range ps.quarantined {
+		q.expires = time.Now().Add(-time.Second)
+		ps.quarantined[key] = q
+	}
+	ps.onPostureEvent(event(t, eventbus.SubjectPostureChanged, eventbus.PostureChange{DeviceID: "dev-3", To: "DEGRADED", Time: at}))
+	if _, held := ps.quarantined[deviceKey{"", "dev-3"}]; !held || len(ps.quarantined) != 1 {
+		t.Errorf("quarantined = %v, want only dev-3", ps.quarantined)
+	}
+
+	// and by checking a token against them
+	q := ps.quarantined[deviceKey{"", "dev-3"}]
+	q.expires = time.Now().Add(-time.Second)
+	ps.quarantined[deviceKey{"", "dev-3"}] = q
+	if err := ps.checkQuarantine(posturetoken.Claims{DeviceID: "dev-3", IssuedAt: at.Add(-time.Hour)}); err != nil {
+		t.Errorf("checkQuarantine after the entry expired: %v", err)
+	}
+	if len(ps.quarantined) != 0 {
+		t.Errorf("quarantined = %v, want none", ps.quarantined)
+	}
+}
+
+func TestCheckQuarantine(t *testing.T) {
+	f := newPostureFixture(t, "http://policy.invalid/policy", PolicyResponse{})
+	now := time.Now().Truncate(time.Second)
+	// Quarantined two hours ago, so that tokens issued after it aren't
+	// issued in the future either
+	since := now.Add(-2 * time.Hour)
+	before, after := since.Add(-time.Hour), since.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		q        *quarantine // held for dev-1
+		issuedAt time.Time
+		wantErr  bool
+	}{
+		{"not quarantined", nil, before, false},
+		{"status quarantine, token issued before", &quarantine{since: since, reason: "device dev-1 is DEGRADED"}, before, true},
+		{"status quarantine, token issued at the same second", &quarantine{since: since, reason: "device dev-1 is DEGRADED"}, since, true},
+		{"status quarantine, token issued after", &quarantine{since: since, reason: "device dev-1 is DEGRADED"}, after, false},
+		{"tamper quarantine, token issued before", &quarantine{since: since, until: now.Add(2 * time.Hour), reason: "tampered"}, before, true},
+		{"tamper quarantine, token issued after", &quarantine{since: since, until: now.Add(2 * time.Hour), reason: "tampered"}, after, true},
+		{"tamper quarantine over, token issued after", &quarantine{since: since, until: now.Add(-time.Minute), reason: "tampered"}, after, false},
+		{"tamper quarantine over, token issued before", &quarantine{since: since, until: now.Add(-time.Minute), reason: "tampered"}, before, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.ps.quarantined = make(map[deviceKey]quarantine)
+			if tt.q != nil {
+				q := *tt.q
+				q.expires = now.Add(24 * time.Hour)
+				f.ps.quarantined[deviceKey{"", "dev-1"}] = q
+			}
+			r := httptest.NewRequest(http.MethodGet, "http://bank.com/", nil)
+			r.Header.Set(posturetoken.HeaderToken, f.token(t, "dev-1", "HEALTHY", tt.issuedAt))
+			claims, err := f.ps.devicePosture(r)
+			if err != nil {
+				t.Fatalf("devicePosture: %v", err)
+			}
+			err = f.ps.checkQuarantine(claims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkQuarantine: %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.q.reason) {
+				t.Errorf("checkQuarantine: %v, want the reason %q", err, tt.q.reason)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(posturetoken.HeaderToken) != "" {
+			t.Error("the posture token was forwarded upstream")
+		}
+		fmt.Fprint(w, "upstream")
+	}))
+	defer upstream.Close()
+
+	policy := PolicyResponse{
+		Blocked: []string{"blocked.com"},
+		Categories: map[string]PolicyCategory{
+			"finance":  {Action: "trusted", Domains: []string{"bank.com"}},
+			"partners": {Action: "allow", Domains: []string{"partner.blocked.com"}},
+		},
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		host       string
+		token      func(f postureFixture) string
+		noPolicy   bool
+		failClosed bool
+		quarantine *quarantine
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "blocked domain", host: "www.blocked.com", wantStatus: http.StatusForbidden, wantBody: "blocked by your organization"},
+		{name: "allowed domain", host: "example.com", wantStatus: http.StatusOK, wantBody: "upstream"},
+		{name: "allow category wins", host: "partner.blocked.com", wantStatus: http.StatusOK, wantBody: "upstream"},
+		{name: "trusted without a token", host: "bank.com", wantStatus: http.StatusForbidden, wantBody: errNoPostureToken.Error()},
+		{
+			name: "trusted with a compliant token", host: "bank.com",
+			token:      func(f postureFixture) string { return f.token(t, "dev-1", "HEALTHY", now) },
+			wantStatus: http.StatusOK, wantBody: "upstream",
+		},
+		{
+			name: "trusted with a non-compliant token", host: "bank.com",
+			token:      func(f postureFixture) string { return f.token(t, "dev-1", "DEGRADED", now) },
+			wantStatus: http.StatusForbidden, wantBody: "device dev-1 is DEGRADED",
+		},
+		{
+			name: "trusted with a token from before a quarantine", host: "bank.com",
+			token:      func(f postureFixture) string { return f.token(t, "dev-1", "HEALTHY", now.Add(-time.Hour)) },
+			quarantine: &quarantine{since: now.Add(-time.Minute), reason: "device dev-1 is UNHEALTHY"},
+			wantStatus: http.StatusForbidden, wantBody: "device is quarantined",
+		},
+		{
+			name: "trusted with a token from after a quarantine", host: "bank.com",
+			token:      func(f postureFixture) string { return f.token(t, "dev-1", "HEALTHY", now) },
+			quarantine: &quarantine{since: now.Add(-time.Hour), reason: "device dev-1 is UNHEALTHY"},
+			wantStatus: http.StatusOK, wantBody: "upstream",
+		},
+		{
+			name: "trusted under a tamper quarantine", host: "bank.com",
+			token:      func(f postureFixture) string { return f.token(t, "dev-1", "HEALTHY", now) },
+			quarantine: &quarantine{since: now.Add(-time.Hour), until: now.Add(time.Hour), reason: "agent binary changed"},
+			wantStatus: http.StatusForbidden, wantBody: "agent binary changed",
+		},
+		{name: "fail closed without a policy", host: "example.com", noPolicy: true, failClosed: true, wantStatus: http.StatusForbidden, wantBody: "until this gateway has loaded"},
+		{name: "fail open without a policy", host: "example.com", noPolicy: true, wantStatus: http.StatusOK, wantBody: "upstream"},
+		{name: "fail closed with a policy", host: "example.com", failClosed: true, wantStatus: http.StatusOK, wantBody: "upstream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPostureFixture(t, "http://policy.invalid/policy", policy)
+			if tt.noPolicy {
+				f.ps.version = 0
+			}
+			if tt.failClosed {
+				if err := f.ps.features.Configure(flags.FailClosed); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.quarantine != nil {
+				q := *tt.quarantine
+				q.expires = now.Add(24 * time.Hour)
+				f.ps.quarantined[deviceKey{"", "dev-1"}] = q
+			}
+
+			// The request goes to the upstream server whatever host it
+			// names, so that allowed requests have somewhere to go
+			r := httptest.NewRequest(http.MethodGet, upstream.URL+"/page", nil)
+			r.Host = tt.host
+			if tt.token != nil {
+				r.Header.Set(posturetoken.HeaderToken, tt.token(f))
+			}
+			w := httptest.NewRecorder()
+			f.ps.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if body := w.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nisatyap/shared/eventbus"
+	"github.com/nisatyap/shared/posturetoken"
+)
+
+// DefaultQuarantineTTL is how long a quarantine entry is kept at most: by
+// then the tokens it refuses have expired, as long as the collector issues
+// them for less time
+const DefaultQuarantineTTL = 24 * time.Hour
+
+// deviceKey names a device; device IDs are only unique within a tenant
+type deviceKey struct {
+	tenant, device string
+}
+
+// quarantine is why a device's posture tokens are refused
+type quarantine struct {
+	since   time.Time // tokens issued before then are refused
+	until   time.Time // after a tamper alert, every token is refused until then
+	expires time.Time // when the entry is dropped
+	reason  string
+}
+
+// errNoPostureToken is the posture of a request without a token
+var errNoPostureToken = errors.New("no posture token was presented")
+
+// devicePosture returns the claims of the posture token r presents, or
+// why it has none that can be trusted
+func (ps *ProxyServer) devicePosture(r *http.Request) (posturetoken.Claims, error) {
+	token := posturetoken.FromRequest(r)
+	switch {
+	case token == "":
+		return posturetoken.Claims{}, errNoPostureToken
+	case ps.postureTokens == nil:
+		return posturetoken.Claims{}, errors.New("this proxy does not verify posture tokens")
+	}
+	return ps.postureTokens.Verify(token)
+}
+
+// SubscribePostureEvents quarantines devices as the collector's posture
+// events on bus report them tampered with or no longer HEALTHY, so that
+// the posture tokens they already hold stop opening trusted categories
+// before they expire. It returns a function that unsubscribes.
+func (ps *ProxyServer) SubscribePostureEvents(bus eventbus.Bus) (func(), error) {
+	return bus.Subscribe("posture.>", ps.onPostureEvent)
+}
+
+func (ps *ProxyServer) onPostureEvent(e eventbus.Event) {
+	switch e.Subject {
+	case eventbus.SubjectPostureTamper:
+		var alert eventbus.TamperAlert
+		if err := e.Decode(&alert); err != nil {
+			ps.log.Warn("ignoring malformed posture event", "error", err)
+			return
+		}
+		now := time.Now()
+		until := now.Add(ps.quarantineFor)
+		ps.quarantineLock.Lock()
+		ps.pruneQuarantine(now)
+		ps.quarantined[deviceKey{alert.Tenant, alert.DeviceID}] = quarantine{
+			since: alert.Time, until: until, expires: laterOf(until, now.Add(ps.quarantineTTL)), reason: alert.Summary,
+		}
+		ps.quarantineLock.Unlock()
+		ps.log.Warn("quarantining device", "tenant", alert.Tenant, "device_id", alert.DeviceID, "reason", alert.Summary, "until", until)
+	case eventbus.SubjectPostureChanged:
+		var change eventbus.PostureChange
+		if err := e.Decode(&change); err != nil {
+			ps.log.Warn("ignoring malformed posture event", "error", err)
+			return
+		}
+		now := time.Now()
+		key := deviceKey{change.Tenant, change.DeviceID}
+		ps.quarantineLock.Lock()
+		defer ps.quarantineLock.Unlock()
+		ps.pruneQuarantine(now)
+		q, held := ps.quarantined[key]
+		if held && now.Before(q.until) {
+			return // a tamper quarantine outlasts status changes
+		}
+		if change.To == "HEALTHY" {
+			if held {
+				delete(ps.quarantined, key)
+				ps.log.Info("device left quarantine", "tenant", change.Tenant, "device_id", change.DeviceID)
+			}
+			return
+		}
+		reason := fmt.Sprintf("device %s is %s", change.DeviceID, change.To)
+		ps.quarantined[key] = quarantine{since: change.Time, expires: now.Add(ps.quarantineTTL), reason: reason}
+		ps.log.Info("quarantining device", "tenant", change.Tenant, "device_id", change.DeviceID, "reason", reason)
+	}
+}
+
+// checkQuarantine returns why claims can't be trusted if its device was
+// quarantined after the token was issued, or is under a tamper quarantine
+func (ps *ProxyServer) checkQuarantine(claims posturetoken.Claims) error {
+	now := time.Now()
+	key := deviceKey{claims.Tenant, claims.DeviceID}
+	ps.quarantineLock.Lock()
+	defer ps.quarantineLock.Unlock()
+	q, held := ps.quarantined[key]
+	if held && !now.Before(q.expires) {
+		delete(ps.quarantined, key)
+		held = false
+	}
+	if held && (now.Before(q.until) || !claims.IssuedAt.After(q.since)) {
+		return fmt.Errorf("device is quarantined: %s", q.reason)
+	}
+	return nil
+}
+
+// pruneQuarantine drops the quarantine entries that expired by now, so
+// that devices never heard from again don't stay in memory; the caller
+// holds quarantineLock
+func (ps *ProxyServer) pruneQuarantine(now time.Time) {
+	for key, q := range ps.quarantined {
+		if !now.Before(q.expires) {
+			delete(ps.quarantined, key)
+		}
+	}
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
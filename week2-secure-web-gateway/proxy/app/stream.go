@@ -0,0 +1,131 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Policy stream timing: a stream that has been quiet for streamIdle,
+// twice the policy engine's keepalive, is taken as dead; reconnects back
+// off from streamRetryMin to streamRetryMax
+const (
+	streamIdle     = time.Minute
+	streamRetryMin = time.Second
+	streamRetryMax = time.Minute
+)
+
+// RunPolicyStream subscribes to the policy engine's stream of policy
+// versions and updates the blocklist as soon as a version newer than the
+// one held is announced, reconnecting whenever the stream drops, until ctx
+// is cancelled. Periodic updates still pick up scheduled rules and cover
+// the gaps.
+func (ps *ProxyServer) RunPolicyStream(ctx context.Context) {
+	u, err := url.Parse(ps.policyURL)
+	if err != nil {
+		ps.log.Error("not subscribing to policy updates", "error", err)
+		return
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/stream"
+	u.RawQuery = ""
+	retry := streamRetryMin
+	for {
+		start := time.Now()
+		err := ps.followStream(ctx, u.String())
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > streamRetryMax {
+			retry = streamRetryMin // it was up for a while; this is a new failure
+		}
+		ps.log.Warn("policy stream closed", "error", err, "retry_in", retry)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, streamRetryMax)
+	}
+}
+
+// followStream reads the policy stream until it fails or goes quiet. The
+// policy engine sends events like
+//
+//	event: policy
+//	id: 43
+//	data: {"version":43}
+//
+// and comments, lines starting with ':', to keep it alive.
+func (ps *ProxyServer) followStream(ctx context.Context, rawURL string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := ps.client.Stream(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("policy engine returned status: %d", resp.StatusCode)
+	}
+	ps.log.Info("subscribed to policy updates", "url", rawURL)
+
+	idle := time.AfterFunc(streamIdle, cancel)
+	defer idle.Stop()
+	scanner := bufio.NewScanner(resp.Body)
+	var data string
+	for scanner.Scan() {
+		idle.Reset(streamIdle)
+		line := scanner.Text()
+		switch {
+		case line == "":
+			ps.onStreamEvent(data)
+			data = ""
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// onStreamEvent updates the blocklist if an event announces a newer
+// policy than the one held
+func (ps *ProxyServer) onStreamEvent(data string) {
+	if data == "" {
+		return
+	}
+	var event struct {
+		Version int64 `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		ps.log.Warn("ignoring malformed policy event", "error", err)
+		return
+	}
+	ps.blocklistMutex.RLock()
+	current := ps.version
+	ps.blocklistMutex.RUnlock()
+	if event.Version <= current {
+		return
+	}
+	ps.log.Info("policy engine announced a new version, updating blocklist", "version", event.Version)
+	if err := ps.UpdateBlocklist(); err != nil {
+		ps.log.Error("blocklist update failed", "error", err)
+	}
+	// A new version may also have changed the flags
+	if err := ps.UpdateFlags(); err != nil {
+		ps.log.Warn("feature flag update failed", "error", err)
+	}
+}
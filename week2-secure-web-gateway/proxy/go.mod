@@ -1,3 +1,9 @@
 module github.com/nisatyap/week2-swg/proxy
 
 go 1.21
+
+require github.com/nisatyap/shared v0.0.0
+
+require golang.org/x/sync v0.8.0 // indirect
+
+replace github.com/nisatyap/shared => ../../shared